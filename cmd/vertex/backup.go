@@ -0,0 +1,610 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ataiva-software/vertex/internal/flow"
+	"github.com/ataiva-software/vertex/internal/hub"
+	"github.com/ataiva-software/vertex/internal/monitor"
+	syncservice "github.com/ataiva-software/vertex/internal/sync"
+	"github.com/ataiva-software/vertex/internal/task"
+	"github.com/ataiva-software/vertex/internal/vault"
+	"github.com/ataiva-software/vertex/pkg/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+)
+
+// backupFormatVersion is bumped when the archive layout changes incompatibly
+const backupFormatVersion = 1
+
+const backupManifestName = "manifest.json"
+
+const (
+	// maxBackupArchiveBytes caps the size of an archive uploaded for import
+	maxBackupArchiveBytes = 256 << 20
+	// maxBackupContentBytes caps the total size of an archive's files once
+	// decompressed
+	maxBackupContentBytes = 1 << 30
+)
+
+// backupResources lists the files in an archive with the schema version of each,
+// in the order they are imported
+var backupResources = []struct {
+	name    string
+	version int
+}{
+	{"secrets.json", 1},
+	{"environments.json", 1},
+	{"workflows.json", 1},
+	{"tasks.json", 1},
+	{"alerts.json", 1},
+	{"sync_jobs.json", 1},
+	{"integrations.json", 1},
+}
+
+// errInvalidBackup is wrapped by every error caused by a malformed archive
+var errInvalidBackup = errors.New("invalid backup archive")
+
+// backupManifest describes an archive's contents so imports can verify them
+type backupManifest struct {
+	FormatVersion int          `json:"format_version"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UserID        string       `json:"user_id"`
+	Files         []backupFile `json:"files"`
+}
+
+type backupFile struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Count   int    `json:"count"`
+	SHA256  string `json:"sha256"`
+}
+
+// backupIntegration is an integration in an archive. Its config holds
+// credentials such as webhook secrets and tokens, so it is encrypted with the
+// backup passphrase like secret values are.
+type backupIntegration struct {
+	*hub.Integration
+	Config string `json:"config"` // base64, encrypted with the backup passphrase
+}
+
+// sealIntegrations encrypts the integrations' configs with passphrase
+func sealIntegrations(integrations []*hub.Integration, passphrase string) ([]*backupIntegration, error) {
+	sealed := make([]*backupIntegration, len(integrations))
+	for i, integration := range integrations {
+		config, err := json.Marshal(integration.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode integration '%s': %w", integration.Name, err)
+		}
+		encrypted, err := crypto.EncryptAES(config, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export integration '%s': %w", integration.Name, err)
+		}
+		sealed[i] = &backupIntegration{Integration: integration, Config: base64.StdEncoding.EncodeToString(encrypted)}
+	}
+	return sealed, nil
+}
+
+// openIntegrations decrypts the configs of integrations read from an archive
+func openIntegrations(sealed []*backupIntegration, passphrase string) ([]*hub.Integration, error) {
+	integrations := make([]*hub.Integration, len(sealed))
+	for i, integration := range sealed {
+		if integration.Integration == nil {
+			return nil, fmt.Errorf("%w: empty integration", errInvalidBackup)
+		}
+		encrypted, err := base64.StdEncoding.DecodeString(integration.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode integration '%s': %v", errInvalidBackup, integration.Name, err)
+		}
+		config, err := crypto.DecryptAES(encrypted, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decrypt integration '%s'", vault.ErrWrongPassphrase, integration.Name)
+		}
+		if err := json.Unmarshal(config, &integration.Integration.Config); err != nil {
+			return nil, fmt.Errorf("%w: failed to decode integration '%s': %v", errInvalidBackup, integration.Name, err)
+		}
+		integrations[i] = integration.Integration
+	}
+	return integrations, nil
+}
+
+// backupServices exports and imports a user's resources across services
+type backupServices struct {
+	vault   *vault.Service
+	flow    *flow.Service
+	task    *task.Service
+	monitor *monitor.Service
+	sync    *syncservice.Service
+	hub     *hub.Service
+}
+
+func newBackupServices(instances map[string]interface{}) (*backupServices, error) {
+	services := &backupServices{}
+	var ok bool
+	if services.vault, ok = instances["vault"].(*vault.Service); !ok {
+		return nil, errors.New("backup requires the vault service")
+	}
+	if services.flow, ok = instances["flow"].(*flow.Service); !ok {
+		return nil, errors.New("backup requires the flow service")
+	}
+	if services.task, ok = instances["task"].(*task.Service); !ok {
+		return nil, errors.New("backup requires the task service")
+	}
+	if services.monitor, ok = instances["monitor"].(*monitor.Service); !ok {
+		return nil, errors.New("backup requires the monitor service")
+	}
+	if services.sync, ok = instances["sync"].(*syncservice.Service); !ok {
+		return nil, errors.New("backup requires the sync service")
+	}
+	if services.hub, ok = instances["hub"].(*hub.Service); !ok {
+		return nil, errors.New("backup requires the hub service")
+	}
+	return services, nil
+}
+
+// Export writes all of the user's resources to w as a gzipped tar archive.
+// Secrets and integration configs are encrypted with passphrase.
+func (b *backupServices) Export(ctx context.Context, userID, passphrase string, w io.Writer) error {
+	secrets, err := b.vault.ExportSecrets(ctx, userID, passphrase)
+	if err != nil {
+		return err
+	}
+	environments, err := b.flow.ListEnvironments(ctx, userID)
+	if err != nil {
+		return err
+	}
+	workflows, err := b.flow.ListWorkflows(ctx, userID)
+	if err != nil {
+		return err
+	}
+	tasks, err := b.task.ListTasks(ctx, userID)
+	if err != nil {
+		return err
+	}
+	alerts, err := b.monitor.GetAlerts(ctx, userID)
+	if err != nil {
+		return err
+	}
+	syncJobs, err := b.sync.GetSyncJobs(ctx, userID)
+	if err != nil {
+		return err
+	}
+	integrations, err := b.hub.GetIntegrations(ctx, userID)
+	if err != nil {
+		return err
+	}
+	sealedIntegrations, err := sealIntegrations(integrations, passphrase)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]interface{}{
+		"secrets.json":      secrets,
+		"environments.json": environments,
+		"workflows.json":    workflows,
+		"tasks.json":        tasks,
+		"alerts.json":       alerts,
+		"sync_jobs.json":    syncJobs,
+		"integrations.json": sealedIntegrations,
+	}
+	counts := map[string]int{
+		"secrets.json":      len(secrets),
+		"environments.json": len(environments),
+		"workflows.json":    len(workflows),
+		"tasks.json":        len(tasks),
+		"alerts.json":       len(alerts),
+		"sync_jobs.json":    len(syncJobs),
+		"integrations.json": len(integrations),
+	}
+
+	manifest := backupManifest{FormatVersion: backupFormatVersion, CreatedAt: time.Now().UTC(), UserID: userID}
+	contents := make(map[string][]byte, len(backupResources))
+	for _, resource := range backupResources {
+		data, err := json.MarshalIndent(resources[resource.name], "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", resource.name, err)
+		}
+		sum := sha256.Sum256(data)
+		contents[resource.name] = data
+		manifest.Files = append(manifest.Files, backupFile{
+			Name:    resource.name,
+			Version: resource.version,
+			Count:   counts[resource.name],
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	writeFile := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := archive.Write(data)
+		return err
+	}
+	if err := writeFile(backupManifestName, manifestData); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	for _, resource := range backupResources {
+		if err := writeFile(resource.name, contents[resource.name]); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return gz.Close()
+}
+
+// Import restores an archive written by Export for the user. The manifest and
+// every checksum are verified before anything is imported; IDs are reassigned
+// and references between resources rewritten to match. Import is not atomic
+// across services, so a failure part way leaves earlier resources in place.
+func (b *backupServices) Import(ctx context.Context, userID, passphrase string, r io.Reader) (map[string]int, error) {
+	manifest, contents, err := readBackup(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		secrets      []*vault.ExportedSecret
+		environments []*flow.Environment
+		workflows    []*flow.Workflow
+		tasks        []*task.Task
+		alerts       []*monitor.Alert
+		syncJobs     []*syncservice.SyncJob
+		sealed       []*backupIntegration
+	)
+	targets := map[string]interface{}{
+		"secrets.json":      &secrets,
+		"environments.json": &environments,
+		"workflows.json":    &workflows,
+		"tasks.json":        &tasks,
+		"alerts.json":       &alerts,
+		"sync_jobs.json":    &syncJobs,
+		"integrations.json": &sealed,
+	}
+	for _, file := range manifest.Files {
+		if err := json.Unmarshal(contents[file.Name], targets[file.Name]); err != nil {
+			return nil, fmt.Errorf("%w: failed to decode %s: %v", errInvalidBackup, file.Name, err)
+		}
+	}
+	// Decrypted before anything is imported, so a wrong passphrase imports nothing
+	integrations, err := openIntegrations(sealed, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	importedSecrets, err := b.vault.ImportSecrets(ctx, userID, passphrase, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import secrets: %w", err)
+	}
+
+	// Workflows refer to environments, and environments to secrets, by name
+	for _, env := range environments {
+		env.ID = 0
+		env.UserID = userID
+		if err := b.flow.CreateEnvironment(ctx, env); err != nil {
+			return nil, fmt.Errorf("failed to import environment '%s': %w", env.Name, err)
+		}
+	}
+
+	workflowIDs, err := b.flow.ImportWorkflows(ctx, userID, workflows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import workflows: %w", err)
+	}
+
+	for _, t := range tasks {
+		t.ID = 0
+		t.UserID = userID
+		if err := b.task.CreateTask(ctx, t); err != nil {
+			return nil, fmt.Errorf("failed to import task '%s': %w", t.Name, err)
+		}
+	}
+
+	// Integrations get new IDs, so alerts are pointed at them as they are imported
+	integrationIDs := make(map[uint]uint, len(integrations))
+	for _, integration := range integrations {
+		sourceID := integration.ID
+		integration.ID = 0
+		integration.UserID = userID
+		if err := b.hub.CreateIntegration(ctx, integration); err != nil {
+			return nil, fmt.Errorf("failed to import integration '%s': %w", integration.Name, err)
+		}
+		integrationIDs[sourceID] = integration.ID
+	}
+
+	for _, alert := range alerts {
+		if alert.OnTriggerWorkflowID != 0 {
+			workflowID, ok := workflowIDs[alert.OnTriggerWorkflowID]
+			if !ok {
+				return nil, fmt.Errorf("%w: alert '%s' references unknown workflow %d", errInvalidBackup, alert.Name, alert.OnTriggerWorkflowID)
+			}
+			alert.OnTriggerWorkflowID = workflowID
+		}
+		if alert.IntegrationID != 0 {
+			integrationID, ok := integrationIDs[alert.IntegrationID]
+			if !ok {
+				return nil, fmt.Errorf("%w: alert '%s' references unknown integration %d", errInvalidBackup, alert.Name, alert.IntegrationID)
+			}
+			alert.IntegrationID = integrationID
+		}
+		alert.ID = 0
+		alert.UserID = userID
+		if err := b.monitor.CreateAlert(ctx, alert); err != nil {
+			return nil, fmt.Errorf("failed to import alert '%s': %w", alert.Name, err)
+		}
+	}
+
+	// Run history and checkpoints belong to the source deployment
+	for _, job := range syncJobs {
+		*job = syncservice.SyncJob{
+			Name:           job.Name,
+			UserID:         userID,
+			Source:         job.Source,
+			Destination:    job.Destination,
+			Mode:           job.Mode,
+			BandwidthLimit: job.BandwidthLimit,
+			Concurrency:    job.Concurrency,
+			Resume:         job.Resume,
+			// Vault keys, restored with the secrets above
+			SourceCredentials:      job.SourceCredentials,
+			DestinationCredentials: job.DestinationCredentials,
+		}
+		if err := b.sync.CreateSyncJob(ctx, job); err != nil {
+			return nil, fmt.Errorf("failed to import sync job '%s': %w", job.Name, err)
+		}
+	}
+
+	return map[string]int{
+		"secrets":      importedSecrets,
+		"environments": len(environments),
+		"workflows":    len(workflows),
+		"tasks":        len(tasks),
+		"alerts":       len(alerts),
+		"sync_jobs":    len(syncJobs),
+		"integrations": len(integrations),
+	}, nil
+}
+
+// readBackup reads an archive and verifies it against its manifest. Its files
+// may add up to at most maxBackupContentBytes.
+func readBackup(r io.Reader) (*backupManifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errInvalidBackup, err)
+	}
+	defer gz.Close()
+
+	contents := make(map[string][]byte)
+	remaining := int64(maxBackupContentBytes)
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errInvalidBackup, err)
+		}
+		if header.Size > remaining {
+			return nil, nil, fmt.Errorf("%w: files exceed %d bytes", errInvalidBackup, maxBackupContentBytes)
+		}
+		// The header's size is not trusted, so reads stop at the limit too
+		data, err := io.ReadAll(io.LimitReader(archive, remaining+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errInvalidBackup, err)
+		}
+		if int64(len(data)) > remaining {
+			return nil, nil, fmt.Errorf("%w: files exceed %d bytes", errInvalidBackup, maxBackupContentBytes)
+		}
+		remaining -= int64(len(data))
+		contents[header.Name] = data
+	}
+
+	data, ok := contents[backupManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: missing %s", errInvalidBackup, backupManifestName)
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to decode manifest: %v", errInvalidBackup, err)
+	}
+	if manifest.FormatVersion != backupFormatVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported format version %d", errInvalidBackup, manifest.FormatVersion)
+	}
+
+	versions := make(map[string]int, len(backupResources))
+	for _, resource := range backupResources {
+		versions[resource.name] = resource.version
+	}
+	for _, file := range manifest.Files {
+		version, ok := versions[file.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: unknown file %s", errInvalidBackup, file.Name)
+		}
+		if file.Version > version {
+			return nil, nil, fmt.Errorf("%w: %s has unsupported version %d", errInvalidBackup, file.Name, file.Version)
+		}
+		data, ok := contents[file.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: missing %s", errInvalidBackup, file.Name)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			return nil, nil, fmt.Errorf("%w: checksum mismatch for %s", errInvalidBackup, file.Name)
+		}
+	}
+
+	return &manifest, contents, nil
+}
+
+func addBackupRoutes(v1 *gin.RouterGroup, serviceInstances map[string]interface{}) {
+	backup, err := newBackupServices(serviceInstances)
+	if err != nil {
+		return
+	}
+
+	v1.GET("/export", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		passphrase := c.GetHeader("X-Backup-Passphrase")
+		if passphrase == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "X-Backup-Passphrase header is required"})
+			return
+		}
+
+		var archive bytes.Buffer
+		if err := backup.Export(c.Request.Context(), userID, passphrase, &archive); err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="vertex-backup.tar.gz"`)
+		c.Data(http.StatusOK, "application/gzip", archive.Bytes())
+	})
+
+	v1.POST("/import", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		passphrase := c.GetHeader("X-Backup-Passphrase")
+		if passphrase == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "X-Backup-Passphrase header is required"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBackupArchiveBytes)
+		imported, err := backup.Import(c.Request.Context(), userID, passphrase, c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			switch {
+			case errors.As(err, &tooLarge):
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			case errors.Is(err, errInvalidBackup), errors.Is(err, vault.ErrWrongPassphrase):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"imported": imported})
+	})
+}
+
+func exportCmd() *cobra.Command {
+	var output, passphrase string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all of your resources to a backup archive",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if passphrase == "" {
+				return &usageError{err: errors.New("a passphrase is required (--passphrase or VERTEX_BACKUP_PASSPHRASE)")}
+			}
+
+			req, err := newRequest("GET", serviceURL(8000, "/api/v1/export"), nil)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("X-Backup-Passphrase", passphrase)
+			resp, err := sendRequest(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			var w io.Writer = cli.stdout
+			if output != "-" {
+				file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				w = file
+			}
+			if _, err := io.Copy(w, resp.Body); err != nil {
+				return fmt.Errorf("failed to write archive: %w", err)
+			}
+			if output != "-" {
+				cli.Infof("Exported to %s", output)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "vertex-backup.tar.gz", "Archive path, or - for stdout")
+	cmd.Flags().StringVar(&passphrase, "passphrase", os.Getenv("VERTEX_BACKUP_PASSPHRASE"), "Passphrase used to encrypt secrets in the archive")
+
+	return cmd
+}
+
+func importCmd() *cobra.Command {
+	var format, passphrase string
+
+	cmd := &cobra.Command{
+		Use:   "import [archive]",
+		Short: "Import resources from a backup archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if passphrase == "" {
+				return &usageError{err: errors.New("a passphrase is required (--passphrase or VERTEX_BACKUP_PASSPHRASE)")}
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			req, err := newRequest("POST", serviceURL(8000, "/api/v1/import"), file)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("X-Backup-Passphrase", passphrase)
+			resp, err := sendRequest(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			output, err := formatOutput(string(body), format)
+			if err != nil {
+				return fmt.Errorf("failed to format output: %w", err)
+			}
+			cli.Result(output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
+	cmd.Flags().StringVar(&passphrase, "passphrase", os.Getenv("VERTEX_BACKUP_PASSPHRASE"), "Passphrase the archive's secrets were encrypted with")
+
+	return cmd
+}
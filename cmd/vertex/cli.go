@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// cliLogger separates command results, written to stdout, from diagnostics, written
+// to stderr. Quiet mode drops informational messages so stdout stays machine
+// parseable; verbose mode adds request URLs and timings.
+type cliLogger struct {
+	stdout  io.Writer
+	stderr  io.Writer
+	quiet   bool
+	verbose bool
+}
+
+var cli = &cliLogger{stdout: os.Stdout, stderr: os.Stderr}
+
+// Result writes command output to stdout
+func (l *cliLogger) Result(output string) {
+	fmt.Fprintln(l.stdout, output)
+}
+
+// Resultf writes formatted command output to stdout
+func (l *cliLogger) Resultf(format string, args ...interface{}) {
+	fmt.Fprintf(l.stdout, format, args...)
+}
+
+// Infof writes non-essential messages to stderr unless in quiet mode
+func (l *cliLogger) Infof(format string, args ...interface{}) {
+	if !l.quiet {
+		fmt.Fprintf(l.stderr, format+"\n", args...)
+	}
+}
+
+// Debugf writes diagnostics such as request URLs and timings in verbose mode
+func (l *cliLogger) Debugf(format string, args ...interface{}) {
+	if l.verbose {
+		fmt.Fprintf(l.stderr, format+"\n", args...)
+	}
+}
+
+// Errorf writes errors to stderr in every mode
+func (l *cliLogger) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(l.stderr, format+"\n", args...)
+}
+
+// doRequest sends a CLI request to a service, logging it in verbose mode. Responses
+// with an error status are returned as errors.
+func doRequest(method, url string, body interface{}) (*http.Response, error) {
+	req, err := newRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return sendRequest(req)
+}
+
+// newRequest builds a CLI request. Readers are sent as-is; any other body is
+// encoded as JSON.
+func newRequest(method, url string, body interface{}) (*http.Request, error) {
+	contentType := "application/json"
+	var reqBody io.Reader
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reqBody = b
+		contentType = "application/octet-stream"
+	default:
+		jsonBody, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewBuffer(jsonBody)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-User-ID", "cli-user")
+	return req, nil
+}
+
+// sendRequest sends a request built by newRequest
+func sendRequest(req *http.Request) (*http.Response, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	method, url := req.Method, req.URL.String()
+	cli.Debugf("→ %s %s", method, url)
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		cli.Debugf("✗ %s %s failed after %s: %v", method, url, time.Since(start).Round(time.Millisecond), err)
+		return nil, err
+	}
+	cli.Debugf("← %s %s %d in %s", method, url, resp.StatusCode, time.Since(start).Round(time.Millisecond))
+
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, &httpError{StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// printRequest sends a request and writes the formatted response as the command result
+func printRequest(method, url string, body interface{}, format string) error {
+	resp, err := makeRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	output, err := formatOutput(resp, format)
+	if err != nil {
+		return fmt.Errorf("failed to format output: %w", err)
+	}
+	cli.Result(output)
+	return nil
+}
+
+// serviceURL builds the URL for a service endpoint. VERTEX_API_URL points every
+// command at a single base such as the gateway; otherwise each service is reached
+// on its default local port.
+func serviceURL(port int, path string) string {
+	if base := os.Getenv("VERTEX_API_URL"); base != "" {
+		return strings.TrimSuffix(base, "/") + path
+	}
+	return fmt.Sprintf("http://localhost:%d%s", port, path)
+}
+
+// Exit codes returned by the CLI so scripts can branch on the kind of failure
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 4
+	exitAuth     = 5
+)
+
+// httpError is returned for responses with an error status
+type httpError struct {
+	StatusCode int
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// usageError marks invalid flags, arguments or commands
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	// cobra reports unknown subcommands with an untyped error
+	var usage *usageError
+	if errors.As(err, &usage) || strings.HasPrefix(err.Error(), "unknown command") {
+		return exitUsage
+	}
+
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusNotFound:
+			return exitNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		}
+	}
+	return exitError
+}
+
+// usageArgs wraps a positional argument validator so its failures are usage errors
+func usageArgs(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return &usageError{err: err}
+		}
+		return nil
+	}
+}
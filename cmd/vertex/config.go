@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/internal/api-gateway"
+	"github.com/ataiva-software/vertex/internal/flow"
+	"github.com/ataiva-software/vertex/internal/hub"
+	"github.com/ataiva-software/vertex/internal/insight"
+	"github.com/ataiva-software/vertex/internal/monitor"
+	syncservice "github.com/ataiva-software/vertex/internal/sync"
+	"github.com/ataiva-software/vertex/internal/task"
+	"github.com/ataiva-software/vertex/internal/vault"
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gopkg.in/yaml.v3"
+)
+
+// configPath is the YAML config file given with --config or VERTEX_CONFIG
+var configPath string
+
+// fileConfig is the layout of the config file, e.g.
+//
+//	pagination:
+//	  default: {default: 100, max: 1000}
+//	  endpoints:
+//	    tasks: {default: 50, max: 200}
+//	services:
+//	  auth: {enabled: true, key_env: VERTEX_SERVICE_KEY, token_ttl: 1m}
+//	  vault: {master_key_source: file, master_key_file: /run/secrets/vertex-key}
+//	  task: {workers: 4, stale_after: 2m}
+type fileConfig struct {
+	Pagination core.PaginationConfig `yaml:"pagination"`
+	Services   serviceConfigs        `yaml:"services"`
+}
+
+// serviceConfigs holds the config of each service, keyed in the file by the
+// service's name, and how the services authenticate calls between them
+type serviceConfigs struct {
+	Gateway apigateway.Config  `yaml:"api-gateway"`
+	Vault   vault.Config       `yaml:"vault"`
+	Flow    flow.Config        `yaml:"flow"`
+	Task    task.Config        `yaml:"task"`
+	Monitor monitor.Config     `yaml:"monitor"`
+	Sync    syncservice.Config `yaml:"sync"`
+	Insight insight.Config     `yaml:"insight"`
+	Hub     hub.Config         `yaml:"hub"`
+
+	// Auth requires calls to every service but the gateway to be signed by another service
+	Auth core.ServiceAuthConfig `yaml:"auth"`
+}
+
+// defaultServiceConfigs returns every service's default config
+func defaultServiceConfigs() serviceConfigs {
+	return serviceConfigs{
+		Gateway: apigateway.DefaultConfig(),
+		Vault:   vault.DefaultConfig(),
+		Flow:    flow.DefaultConfig(),
+		Task:    task.DefaultConfig(),
+		Monitor: monitor.DefaultConfig(),
+		Sync:    syncservice.DefaultConfig(),
+		Insight: insight.DefaultConfig(),
+		Hub:     hub.DefaultConfig(),
+		Auth:    core.DefaultServiceAuthConfig(),
+	}
+}
+
+// Validate validates every service's config, naming the service at fault
+func (c serviceConfigs) Validate() error {
+	for _, service := range []struct {
+		name   string
+		config interface{ Validate() error }
+	}{
+		{"api-gateway", c.Gateway},
+		{"vault", c.Vault},
+		{"flow", c.Flow},
+		{"task", c.Task},
+		{"monitor", c.Monitor},
+		{"sync", c.Sync},
+		{"insight", c.Insight},
+		{"hub", c.Hub},
+		{"service auth", c.Auth},
+	} {
+		if err := service.config.Validate(); err != nil {
+			return fmt.Errorf("invalid %s config: %w", service.name, err)
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides the config with the environment variables that predate
+// the config file
+func (c *serviceConfigs) applyEnv() error {
+	if path := os.Getenv("VERTEX_MASTER_KEY_FILE"); path != "" {
+		c.Vault.MasterKeySource = vault.MasterKeySourceFile
+		c.Vault.MasterKeyFile = path
+	}
+	if err := envInt("VERTEX_TASK_WORKERS", &c.Task.Workers); err != nil {
+		return err
+	}
+	if groupBy := os.Getenv("VERTEX_ALERT_GROUP_BY"); groupBy != "" {
+		c.Monitor.Notifications.GroupBy = strings.Split(groupBy, ",")
+	}
+	for env, target := range map[string]*time.Duration{
+		"VERTEX_TASK_STALE_AFTER":      &c.Task.StaleAfter,
+		"VERTEX_STEP_RETRY_DELAY":      &c.Flow.RetryDelay,
+		"VERTEX_ALERT_GROUP_WAIT":      &c.Monitor.Notifications.GroupWait,
+		"VERTEX_ALERT_GROUP_INTERVAL":  &c.Monitor.Notifications.GroupInterval,
+		"VERTEX_ALERT_REPEAT_INTERVAL": &c.Monitor.Notifications.RepeatInterval,
+	} {
+		if err := envDuration(env, target); err != nil {
+			return err
+		}
+	}
+	for env, target := range map[string]*string{
+		"VERTEX_SYNC_S3_ENDPOINT":          &c.Sync.S3.Endpoint,
+		"VERTEX_SYNC_S3_REGION":            &c.Sync.S3.Region,
+		"VERTEX_SYNC_S3_ACCESS_KEY_ID":     &c.Sync.S3.AccessKeyID,
+		"VERTEX_SYNC_S3_SECRET_ACCESS_KEY": &c.Sync.S3.SecretAccessKey,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*target = value
+		}
+	}
+	return nil
+}
+
+func envInt(name string, target *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+func envDuration(name string, target *time.Duration) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+// loadConfigFile applies the pagination settings of a config file and returns
+// the services' configs, overridden by the environment and validated.
+// Anything the file does not set keeps its default, and no path leaves every
+// default in place.
+func loadConfigFile(path string) (serviceConfigs, error) {
+	config := fileConfig{
+		Pagination: core.DefaultPaginationConfig(),
+		Services:   defaultServiceConfigs(),
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return serviceConfigs{}, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return serviceConfigs{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if err := core.SetPaginationConfig(config.Pagination); err != nil {
+			return serviceConfigs{}, fmt.Errorf("invalid pagination config: %w", err)
+		}
+	}
+
+	if err := config.Services.applyEnv(); err != nil {
+		return serviceConfigs{}, err
+	}
+	if err := config.Services.Validate(); err != nil {
+		return serviceConfigs{}, err
+	}
+	return config.Services, nil
+}
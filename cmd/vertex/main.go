@@ -1,15 +1,17 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -20,6 +22,7 @@ import (
 	"github.com/ataiva-software/vertex/internal/hub"
 	"github.com/ataiva-software/vertex/internal/insight"
 	"github.com/ataiva-software/vertex/internal/monitor"
+	"github.com/ataiva-software/vertex/internal/monitor/condition"
 	syncservice "github.com/ataiva-software/vertex/internal/sync"
 	"github.com/ataiva-software/vertex/internal/task"
 	"github.com/ataiva-software/vertex/internal/vault"
@@ -40,15 +43,31 @@ var (
 	dbSSLMode  string
 	basePort   int
 	services   []string
-	allServiceInstances map[string]interface{} // Global access to all service instances
 )
 
+// shutdownFlushTimeout bounds how long shutdown waits for buffered data to be
+// written out
+const shutdownFlushTimeout = 10 * time.Second
+
 func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		cli.Errorf("Error: %v", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func newRootCmd() *cobra.Command {
 	var rootCmd = &cobra.Command{
 		Use:   "vertex",
 		Short: "Vertex DevOps Suite - All-in-One Binary",
 		Long:  "A comprehensive DevOps platform with secrets management, workflow automation, and more.",
+		// Errors are printed once by main, which also picks the exit code
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&dbHost, "db-host", getEnv("DB_HOST", "localhost"), "Database host")
@@ -58,6 +77,10 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&dbPassword, "db-password", getEnv("DB_PASSWORD", "secret"), "Database password")
 	rootCmd.PersistentFlags().StringVar(&dbSSLMode, "db-ssl-mode", getEnv("DB_SSL_MODE", "disable"), "Database SSL mode")
 	rootCmd.PersistentFlags().IntVar(&basePort, "base-port", 8000, "Base port for services")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", os.Getenv("VERTEX_CONFIG"), "Path to a YAML config file, e.g. for page size limits")
+	rootCmd.PersistentFlags().BoolVarP(&cli.quiet, "quiet", "q", false, "Only print results and errors")
+	rootCmd.PersistentFlags().BoolVarP(&cli.verbose, "verbose", "v", false, "Print request URLs and timings to stderr")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
 
 	// Add subcommands
 	rootCmd.AddCommand(serverCmd())
@@ -70,10 +93,20 @@ func main() {
 	rootCmd.AddCommand(syncCmd())
 	rootCmd.AddCommand(insightCmd())
 	rootCmd.AddCommand(hubCmd())
+	rootCmd.AddCommand(exportCmd())
+	rootCmd.AddCommand(importCmd())
+
+	wrapUsageArgs(rootCmd)
+	return rootCmd
+}
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+// wrapUsageArgs makes argument validation failures anywhere in the tree usage errors
+func wrapUsageArgs(cmd *cobra.Command) {
+	if cmd.Args != nil {
+		cmd.Args = usageArgs(cmd.Args)
+	}
+	for _, child := range cmd.Commands() {
+		wrapUsageArgs(child)
 	}
 }
 
@@ -84,10 +117,10 @@ func serverCmd() *cobra.Command {
 		Long:  "Start all Vertex services in a single process",
 		Run: func(cmd *cobra.Command, args []string) {
 			// Check for master password
-			if os.Getenv("VERTEX_MASTER_PASSWORD") == "" {
-				fmt.Println("⚠️  WARNING: VERTEX_MASTER_PASSWORD not set!")
-				fmt.Println("Setting development default. DO NOT USE IN PRODUCTION!")
-				fmt.Println("Set VERTEX_MASTER_PASSWORD environment variable for production.")
+			if os.Getenv("VERTEX_MASTER_PASSWORD") == "" && os.Getenv("VERTEX_MASTER_KEY_FILE") == "" {
+				cli.Errorf("⚠️  WARNING: VERTEX_MASTER_PASSWORD not set!")
+				cli.Errorf("Setting development default. DO NOT USE IN PRODUCTION!")
+				cli.Errorf("Set VERTEX_MASTER_PASSWORD or VERTEX_MASTER_KEY_FILE for production.")
 				os.Setenv("VERTEX_MASTER_PASSWORD", "dev-password-change-in-production")
 			}
 			
@@ -117,6 +150,10 @@ func serviceCmd() *cobra.Command {
 
 func runAllServices(cmd *cobra.Command, args []string) {
 	log.Println("🚀 Starting Vertex DevOps Suite - All Services")
+	configs, err := loadConfigFile(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 	
 	// Database configuration
 	dbConfig := &database.Config{
@@ -135,39 +172,45 @@ func runAllServices(cmd *cobra.Command, args []string) {
 	}
 	defer pool.Close()
 
-	// Auto-migrate all schemas
-	if err := migrateAllSchemas(pool); err != nil {
+	// Create service plugins and auto-migrate all schemas
+	flushes := core.NewFlushRegistry()
+	scheduler := core.NewScheduler()
+	plugins, err := newServicePlugins(pool.DB, configs, flushes, scheduler)
+	if err != nil {
+		log.Fatalf("Failed to create services: %v", err)
+	}
+	serviceAuth, err := configs.Auth.NewServiceAuth()
+	if err != nil {
+		log.Fatalf("Failed to set up service authentication: %v", err)
+	}
+	if err := migrateSchemas(pool.DB, plugins); err != nil {
 		log.Fatalf("Failed to migrate database schemas: %v", err)
 	}
 
-	// Create service instances
-	serviceInstances := createServiceInstances(pool)
-	allServiceInstances = serviceInstances // Set global reference for API Gateway
+	// The API Gateway also serves every other service for the web portal
+	for _, plugin := range plugins {
+		if gateway, ok := plugin.(*gatewayPlugin); ok {
+			gateway.mount(plugins)
+		}
+	}
 
 	// Start all services concurrently
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Define service ports
-	ports := map[string]int{
-		"api-gateway": 8000,
-		"vault":       8080,
-		"flow":        8081,
-		"task":        8082,
-		"monitor":     8083,
-		"sync":        8084,
-		"insight":     8085,
-		"hub":         8086,
-	}
-
 	// Start each service in its own goroutine
 	for _, serviceName := range services {
+		plugin, err := findPlugin(plugins, serviceName)
+		if err != nil {
+			log.Printf("⚠️  Skipping service: %v", err)
+			continue
+		}
 		wg.Add(1)
-		go func(name string, port int) {
+		go func(plugin ServicePlugin) {
 			defer wg.Done()
-			startService(ctx, name, port, serviceInstances[name])
-		}(serviceName, ports[serviceName])
+			startService(ctx, plugin, plugin.DefaultPort(), serviceAuth)
+		}(plugin)
 	}
 
 	// Wait for interrupt signal
@@ -191,17 +234,19 @@ func runAllServices(cmd *cobra.Command, args []string) {
 	case <-time.After(30 * time.Second):
 		log.Println("⚠️  Timeout waiting for services to stop")
 	}
+	stopScheduler(scheduler)
+	flushBuffers(flushes)
 }
 
 func runSingleService(cmd *cobra.Command, args []string) {
 	serviceName := args[0]
 	port, _ := cmd.Flags().GetInt("port")
-	
-	if port == 0 {
-		port = getDefaultPort(serviceName)
-	}
 
-	log.Printf("🚀 Starting Vertex %s service on port %d", strings.Title(serviceName), port)
+	log.Printf("🚀 Starting Vertex %s service", strings.Title(serviceName))
+	configs, err := loadConfigFile(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
 	// Database configuration
 	dbConfig := &database.Config{
@@ -220,19 +265,33 @@ func runSingleService(cmd *cobra.Command, args []string) {
 	}
 	defer pool.Close()
 
-	// Migrate schema for this service
-	if err := migrateServiceSchema(pool, serviceName); err != nil {
+	// Create service plugins and migrate the schema for this service
+	flushes := core.NewFlushRegistry()
+	scheduler := core.NewScheduler()
+	plugins, err := newServicePlugins(pool.DB, configs, flushes, scheduler)
+	if err != nil {
+		log.Fatalf("Failed to create services: %v", err)
+	}
+	plugin, err := findPlugin(plugins, serviceName)
+	if err != nil {
+		log.Fatalf("Failed to start service: %v", err)
+	}
+	serviceAuth, err := configs.Auth.NewServiceAuth()
+	if err != nil {
+		log.Fatalf("Failed to set up service authentication: %v", err)
+	}
+	if err := migrateSchemas(pool.DB, []ServicePlugin{plugin}); err != nil {
 		log.Fatalf("Failed to migrate %s schema: %v", serviceName, err)
 	}
-
-	// Create service instances
-	serviceInstances := createServiceInstances(pool)
+	if port == 0 {
+		port = plugin.DefaultPort()
+	}
 
 	// Start the specific service
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go startService(ctx, serviceName, port, serviceInstances[serviceName])
+	go startService(ctx, plugin, port, serviceAuth)
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -243,55 +302,128 @@ func runSingleService(cmd *cobra.Command, args []string) {
 	cancel()
 	
 	time.Sleep(2 * time.Second)
+	stopScheduler(scheduler)
+	flushBuffers(flushes)
 	log.Printf("✅ %s service stopped", serviceName)
 }
 
-func createServiceInstances(pool *database.ConnectionPool) map[string]interface{} {
-	instances := make(map[string]interface{})
-
-	// Create API Gateway
-	gatewayService := apigateway.NewService()
-	instances["api-gateway"] = gatewayService
-
-	// Create Vault service
-	vaultService := vault.NewService()
-	vaultService.SetDB(pool.DB)
-	instances["vault"] = vaultService
-
-	// Create Flow service
-	flowService := flow.NewService()
-	flowService.SetDB(pool.DB)
-	instances["flow"] = flowService
-
-	// Create Task service
-	taskService := task.NewService()
-	taskService.SetDB(pool.DB)
-	instances["task"] = taskService
-
-	// Create Monitor service
-	monitorService := monitor.NewService()
-	monitorService.SetDB(pool.DB)
-	instances["monitor"] = monitorService
-
-	// Create Sync service
-	syncService := syncservice.NewService()
-	syncService.SetDB(pool.DB)
-	instances["sync"] = syncService
-
-	// Create Insight service
-	insightService := insight.NewService()
-	insightService.SetDB(pool.DB)
-	instances["insight"] = insightService
-
-	// Create Hub service
-	hubService := hub.NewService()
-	hubService.SetDB(pool.DB)
-	instances["hub"] = hubService
-
-	return instances
+// stopScheduler stops the periodic work services left scheduled, waiting up
+// to shutdownFlushTimeout for runs in progress
+func stopScheduler(scheduler *core.Scheduler) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	if err := scheduler.Close(ctx); err != nil {
+		log.Printf("⚠️  Failed to stop scheduled jobs: %v", err)
+	}
+}
+
+// flushBuffers writes out the data services still buffer in memory, such as
+// notification digests, before the process exits, giving up on whatever is
+// not written within shutdownFlushTimeout
+func flushBuffers(flushes *core.FlushRegistry) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	if err := flushes.Flush(ctx); err != nil {
+		log.Printf("⚠️  Failed to flush buffered data: %v", err)
+		return
+	}
+	log.Println("✅ Buffered data flushed")
+}
+
+// flowWorkflowTrigger lets the monitor service start remediation workflows
+type flowWorkflowTrigger struct {
+	service *flow.Service
+}
+
+func (t *flowWorkflowTrigger) TriggerWorkflow(ctx context.Context, userID string, workflowID uint, input map[string]interface{}) error {
+	_, err := t.service.ExecuteWorkflow(ctx, userID, workflowID, input)
+	return err
+}
+
+// hubAlertNotifier delivers alerts that fire or resolve through the owner's
+// hub integration, formatted for its type (Slack, generic webhook, ...)
+type hubAlertNotifier struct {
+	service *hub.Service
+}
+
+func (n *hubAlertNotifier) NotifyIntegration(ctx context.Context, integrationID uint, alert *monitor.Alert, firing bool) error {
+	event := &hub.Event{
+		Type:     "alert.resolved",
+		Title:    fmt.Sprintf("Resolved: %s", alert.Name),
+		Message:  alert.Description,
+		Severity: hub.EventSeverityInfo,
+		Source:   "monitor",
+		Fields: map[string]string{
+			"alert_id":  strconv.FormatUint(uint64(alert.ID), 10),
+			"condition": alert.Condition,
+		},
+	}
+	if firing {
+		event.Type = "alert.firing"
+		event.Title = fmt.Sprintf("Firing: %s", alert.Name)
+		event.Severity = hub.EventSeverityCritical
+	}
+	err := n.service.Notify(ctx, alert.UserID, integrationID, event)
+	if errors.Is(err, hub.ErrIntegrationDisabled) {
+		return fmt.Errorf("%w: %v", monitor.ErrIntegrationPaused, err)
+	}
+	return err
+}
+
+// vaultSecretStore lets workflow environments and sync jobs read the user's
+// vault secrets
+type vaultSecretStore struct {
+	service *vault.Service
+}
+
+func (s *vaultSecretStore) GetSecret(ctx context.Context, userID, key string) (string, error) {
+	secret, err := s.service.GetUserSecret(ctx, userID, key)
+	if err != nil {
+		return "", err
+	}
+	return secret.Value, nil
+}
+
+// gatewayServiceCaller lets workflow service steps call other services
+// through the API gateway
+type gatewayServiceCaller struct {
+	service *apigateway.Service
+}
+
+func (c *gatewayServiceCaller) CallService(ctx context.Context, call *flow.ServiceCall) (*flow.ServiceCallResult, error) {
+	response, err := c.service.CallService(ctx, &apigateway.ServiceCall{
+		Service: call.Service,
+		Method:  call.Method,
+		Path:    call.Path,
+		Body:    call.Body,
+		UserID:  call.UserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &flow.ServiceCallResult{StatusCode: response.StatusCode, Body: response.Body}, nil
+}
+
+// newArtifactStore uses an S3-compatible bucket when VERTEX_ARTIFACT_S3_BUCKET is set
+// and a local directory otherwise
+func newArtifactStore() (flow.ArtifactStore, error) {
+	if bucket := os.Getenv("VERTEX_ARTIFACT_S3_BUCKET"); bucket != "" {
+		return flow.NewS3ArtifactStore(flow.S3Config{
+			Endpoint:        getEnv("VERTEX_ARTIFACT_S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:          os.Getenv("VERTEX_ARTIFACT_S3_REGION"),
+			Bucket:          bucket,
+			AccessKeyID:     os.Getenv("VERTEX_ARTIFACT_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("VERTEX_ARTIFACT_S3_SECRET_ACCESS_KEY"),
+		})
+	}
+	return flow.NewLocalArtifactStore(getEnv("VERTEX_ARTIFACT_DIR", "./data/artifacts"))
 }
 
-func startService(ctx context.Context, serviceName string, port int, serviceInstance interface{}) {
+// startService serves a plugin on port until ctx is done. Every service but
+// the gateway only accepts calls signed by another service when auth is set.
+func startService(ctx context.Context, plugin ServicePlugin, port int, auth *core.ServiceAuth) {
+	serviceName := plugin.Name()
+	instance := serviceInstance(plugin)
 	serviceInfo := core.NewServiceInfo(serviceName, "1.0.0", port)
 	router := gin.Default()
 
@@ -313,13 +445,32 @@ func startService(ctx context.Context, serviceName string, port int, serviceInst
 		c.JSON(http.StatusOK, serviceInfo)
 	})
 
+	addReadinessRoute(router, serviceName, instance)
+
 	// Add service-specific routes
-	addServiceRoutes(router, serviceName, serviceInstance)
+	plugin.RegisterRoutes(router.Group("/api/v1"))
+
+	// The gateway hosts the web portal, proxies paths it does not serve itself
+	// to the services of registered routes, and enforces per-route rate limits
+	// in front of its routes, keyed by the user authentication verified
+	var handler http.Handler = router
+	if gateway, ok := instance.(*apigateway.Service); ok {
+		addPortalRoutes(router)
+		router.NoRoute(gin.WrapH(gateway.ProxyHandler()))
+		handler = gateway.AuthHandler(gateway.RateLimitHandler(handler))
+	} else {
+		handler = auth.Handler(handler)
+	}
 
-	// Create HTTP server
+	// Create HTTP server; every hop honours the X-Request-Timeout budget
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: router,
+		Handler: apigateway.RequestBudgetHandler(handler),
+	}
+
+	// Start background work such as task workers; it is stopped by Close below
+	if starter, ok := instance.(interface{ Start() }); ok {
+		starter.Start()
 	}
 
 	// Start server in a goroutine
@@ -343,72 +494,88 @@ func startService(ctx context.Context, serviceName string, port int, serviceInst
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("⚠️  %s service forced shutdown: %v", serviceName, err)
 	}
+	// Flush anything the service still has buffered, such as hub digests, and
+	// drain task workers
+	if closer, ok := instance.(interface{ Close(context.Context) error }); ok {
+		if err := closer.Close(shutdownCtx); err != nil {
+			log.Printf("⚠️  %s service failed to close cleanly: %v", serviceName, err)
+		}
+	}
 	serviceInfo.SetStatus(core.ServiceStatusStopped)
 }
 
-func addServiceRoutes(router *gin.Engine, serviceName string, serviceInstance interface{}) {
-	v1 := router.Group("/api/v1")
+// addReadinessRoute serves /readyz from the service's own dependency checks, so a
+// service is only ready when what it needs is reachable
+func addReadinessRoute(router gin.IRoutes, serviceName string, instance interface{}) {
+	checkers := map[string]core.HealthChecker{}
+	if checker, ok := instance.(core.HealthChecker); ok {
+		checkers[serviceName] = checker
+	}
 
-	switch serviceName {
-	case "api-gateway":
-		// Add web portal routes
-		router.Static("/static", "./web")
-		router.StaticFile("/", "./web/index.html")
-		router.GET("/portal", func(c *gin.Context) {
-			c.File("./web/index.html")
-		})
-		
-		// API Gateway routes
-		addAPIGatewayRoutes(v1, serviceInstance.(*apigateway.Service))
-		
-		// Add ALL service routes to API Gateway for web portal
-		// This allows the web portal to access all services through port 8000
-		if len(allServiceInstances) > 0 {
-			if vaultService, ok := allServiceInstances["vault"].(*vault.Service); ok {
-				addVaultRoutes(v1, vaultService)
-			}
-			if flowService, ok := allServiceInstances["flow"].(*flow.Service); ok {
-				addFlowRoutes(v1, flowService)
-			}
-			if taskService, ok := allServiceInstances["task"].(*task.Service); ok {
-				addTaskRoutes(v1, taskService)
-			}
-			if monitorService, ok := allServiceInstances["monitor"].(*monitor.Service); ok {
-				addMonitorRoutes(v1, monitorService)
-			}
-			if syncService, ok := allServiceInstances["sync"].(*syncservice.Service); ok {
-				addSyncRoutes(v1, syncService)
-			}
-			if insightService, ok := allServiceInstances["insight"].(*insight.Service); ok {
-				addInsightRoutes(v1, insightService)
-			}
-			if hubService, ok := allServiceInstances["hub"].(*hub.Service); ok {
-				addHubRoutes(v1, hubService)
-			}
+	router.GET("/readyz", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		status := core.CheckReadiness(ctx, checkers)
+		code := http.StatusOK
+		if !status.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, status)
+	})
+}
+
+func addPortalRoutes(router *gin.Engine) {
+	router.Static("/static", "./web")
+	router.StaticFile("/", "./web/index.html")
+	router.GET("/portal", func(c *gin.Context) {
+		c.File("./web/index.html")
+	})
+}
+
+// paginate responds with the page of items the request asks for under key,
+// bounded by the page limits configured for endpoint. It is for lists already
+// held in memory; lists read from the store use listPage.
+func paginate[T any](c *gin.Context, endpoint, key string, items []T) {
+	page, err := core.Paginate(c.Writer, c.Request, endpoint, items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{key: page.Items, "page": page.Page, "page_size": page.PageSize, "total": page.Total})
+}
+
+// listPage responds with the page of a list the request asks for under key,
+// bounded by the page limits configured for endpoint. list reads only that page
+// from the store.
+func listPage[T any](c *gin.Context, endpoint, key string, list func(request core.PageRequest) (*core.Page[T], error)) {
+	request, err := core.ParsePageRequest(c.Request, endpoint)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := list(request)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
 		}
-	case "vault":
-		addVaultRoutes(v1, serviceInstance.(*vault.Service))
-	case "flow":
-		addFlowRoutes(v1, serviceInstance.(*flow.Service))
-	case "task":
-		addTaskRoutes(v1, serviceInstance.(*task.Service))
-	case "monitor":
-		addMonitorRoutes(v1, serviceInstance.(*monitor.Service))
-	case "sync":
-		addSyncRoutes(v1, serviceInstance.(*syncservice.Service))
-	case "insight":
-		addInsightRoutes(v1, serviceInstance.(*insight.Service))
-	case "hub":
-		addHubRoutes(v1, serviceInstance.(*hub.Service))
+		c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
+		return
 	}
+	core.WritePageWarning(c.Writer, request)
+	c.JSON(http.StatusOK, gin.H{key: page.Items, "page": page.Page, "page_size": page.PageSize, "total": page.Total})
 }
 
 // Service route handlers (simplified versions of the individual service mains)
 func addAPIGatewayRoutes(v1 *gin.RouterGroup, service *apigateway.Service) {
 	v1.GET("/routes", func(c *gin.Context) {
 		routes := service.GetRoutes()
-		c.JSON(http.StatusOK, gin.H{"routes": routes})
+		paginate(c, "routes", "routes", routes)
 	})
+
+	v1.POST("/instances/health", gin.WrapH(service.HealthPushHandler()))
+	v1.POST("/instances/heartbeat", gin.WrapH(service.HeartbeatHandler()))
 }
 
 func addVaultRoutes(v1 *gin.RouterGroup, service *vault.Service) {
@@ -418,12 +585,9 @@ func addVaultRoutes(v1 *gin.RouterGroup, service *vault.Service) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		secrets, err := service.ListSecrets(c.Request.Context(), userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"secrets": secrets})
+		listPage(c, "secrets", "secrets", func(request core.PageRequest) (*core.Page[*vault.SecretListItem], error) {
+			return service.ListSecretsPage(vaultContext(c), userID, request)
+		})
 	})
 
 	v1.POST("/secrets", func(c *gin.Context) {
@@ -438,12 +602,18 @@ func addVaultRoutes(v1 *gin.RouterGroup, service *vault.Service) {
 			Value       string   `json:"value" binding:"required"`
 			Description string   `json:"description"`
 			Tags        []string `json:"tags"`
+			TTL         string   `json:"ttl"`
 		}
 		
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		ttl, err := parseSecretTTL(req.TTL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		
 		secret := &vault.Secret{
 			UserID:      userID,
@@ -451,17 +621,102 @@ func addVaultRoutes(v1 *gin.RouterGroup, service *vault.Service) {
 			Value:       req.Value,
 			Description: req.Description,
 			Tags:        req.Tags,
+			TTL:         ttl,
 		}
 		
-		err := service.StoreSecret(c.Request.Context(), userID, secret)
+		err = service.StoreSecret(vaultContext(c), userID, secret)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 			return
 		}
 		
 		c.JSON(http.StatusCreated, gin.H{"message": "Secret stored successfully"})
 	})
 
+	v1.POST("/secrets/verify", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+
+		verify := service.VerifySecrets
+		if c.Query("repair") == "true" {
+			verify = service.RepairSecrets
+		}
+		results, err := verify(vaultContext(c), userID)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	})
+
+	// Re-encrypts every secret under a new master password. Only a caller who
+	// knows the current master password can rotate it.
+	v1.POST("/secrets/rotate-master", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		var req struct {
+			OldPassword string `json:"old_password" binding:"required"`
+			NewPassword string `json:"new_password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.OldPassword == req.NewPassword {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "new password must differ from the old one"})
+			return
+		}
+
+		rotated, err := service.RotateMasterPassword(vaultContext(c), req.OldPassword, req.NewPassword)
+		switch {
+		case errors.Is(err, vault.ErrWrongMasterPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error(), "rotated": rotated})
+		default:
+			c.JSON(http.StatusOK, gin.H{"rotated": rotated})
+		}
+	})
+
+	// Retags or redescribes many secrets at once, all or nothing
+	v1.POST("/secrets/metadata", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		var req struct {
+			Keys        []string `json:"keys" binding:"required"`
+			AddTags     []string `json:"add_tags"`
+			RemoveTags  []string `json:"remove_tags"`
+			Description *string  `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		results, err := service.BulkUpdateMetadata(vaultContext(c), userID, req.Keys, req.AddTags, req.RemoveTags, req.Description)
+		switch {
+		case errors.Is(err, vault.ErrBulkKeysNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "results": results})
+		case errors.Is(err, vault.ErrBulkUpdateFailed):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "results": results})
+		case errors.Is(err, vault.ErrInvalidBulkUpdate):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, gin.H{"results": results})
+		}
+	})
+
 	v1.GET("/secrets/:key", func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
@@ -469,12 +724,24 @@ func addVaultRoutes(v1 *gin.RouterGroup, service *vault.Service) {
 			return
 		}
 		key := c.Param("key")
-		secret, err := service.GetSecret(c.Request.Context(), userID, key)
+		// A secret granted by another user is addressed by its owner, which
+		// tells it apart from other owners' secrets with the same key
+		var secret *vault.Secret
+		var err error
+		if owner := c.Query("owner"); owner != "" {
+			secret, err = service.GetSharedSecret(vaultContext(c), userID, owner, key)
+		} else {
+			secret, err = service.GetSecret(vaultContext(c), userID, key)
+		}
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") {
+			if errors.Is(err, vault.ErrSecretExpired) {
+				c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			} else if errors.Is(err, vault.ErrAmbiguousSecret) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			} else if strings.Contains(err.Error(), "not found") {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 			}
 			return
 		}
@@ -493,26 +760,33 @@ func addVaultRoutes(v1 *gin.RouterGroup, service *vault.Service) {
 			Value       string   `json:"value" binding:"required"`
 			Description string   `json:"description"`
 			Tags        []string `json:"tags"`
+			TTL         string   `json:"ttl"`
 		}
 		
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		ttl, err := parseSecretTTL(req.TTL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		
 		secret := &vault.Secret{
 			Key:         key,
 			Value:       req.Value,
 			Description: req.Description,
 			Tags:        req.Tags,
+			TTL:         ttl,
 		}
 		
-		err := service.UpdateSecret(c.Request.Context(), userID, secret)
+		err = service.UpdateSecret(vaultContext(c), userID, secret)
 		if err != nil {
 			if strings.Contains(err.Error(), "not found") {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 			}
 			return
 		}
@@ -528,235 +802,850 @@ func addVaultRoutes(v1 *gin.RouterGroup, service *vault.Service) {
 		}
 		
 		key := c.Param("key")
-		err := service.DeleteSecret(c.Request.Context(), userID, key)
+		err := service.DeleteSecret(vaultContext(c), userID, key)
 		if err != nil {
 			if strings.Contains(err.Error(), "not found") {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 			}
 			return
 		}
 		
 		c.JSON(http.StatusOK, gin.H{"message": "Secret deleted successfully"})
 	})
-}
 
-func addFlowRoutes(v1 *gin.RouterGroup, service *flow.Service) {
-	v1.GET("/workflows", func(c *gin.Context) {
+	v1.GET("/secrets/:key/grants", func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		workflows, err := service.ListWorkflows(c.Request.Context(), userID)
+		grants, err := service.ListSecretGrants(vaultContext(c), userID, c.Param("key"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondSecretError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"workflows": workflows})
+		c.JSON(http.StatusOK, gin.H{"grants": grants})
 	})
 
-	v1.POST("/workflows", func(c *gin.Context) {
+	v1.POST("/secrets/:key/grants", func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		
 		var req struct {
-			Name        string `json:"name" binding:"required"`
-			Description string `json:"description"`
+			GranteeID string `json:"grantee_id" binding:"required"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		
-		workflow := &flow.Workflow{
-			Name:        req.Name,
-			Description: req.Description,
+		if err := service.GrantSecret(vaultContext(c), userID, c.Param("key"), req.GranteeID); err != nil {
+			respondSecretError(c, err)
+			return
 		}
-		
-		err := service.CreateWorkflow(c.Request.Context(), workflow)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusOK, gin.H{"message": "Secret granted successfully"})
+	})
+
+	v1.DELETE("/secrets/:key/grants/:grantee", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		
-		c.JSON(http.StatusCreated, gin.H{"message": "Workflow created successfully"})
+		if err := service.RevokeSecret(vaultContext(c), userID, c.Param("key"), c.Param("grantee")); err != nil {
+			respondSecretError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Secret grant revoked successfully"})
 	})
-}
 
-func addTaskRoutes(v1 *gin.RouterGroup, service *task.Service) {
-	v1.GET("/tasks", func(c *gin.Context) {
+	v1.GET("/audit-logs", func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		tasks, err := service.ListTasks(c.Request.Context(), userID)
+		page, err := core.ParsePageRequest(c.Request, "audit-logs")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"tasks": tasks})
-	})
-}
+		filter := vault.AuditFilter{
+			SecretKey: c.Query("key"),
+			Action:    c.Query("action"),
+			Page:      page.Page,
+			PageSize:  page.PageSize,
+		}
+		for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if value := c.Query(param); value != "" {
+				if *target, err = time.Parse(time.RFC3339, value); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s: must be an RFC 3339 time", param)})
+					return
+				}
+			}
+		}
 
-func addMonitorRoutes(v1 *gin.RouterGroup, service *monitor.Service) {
-	v1.GET("/metrics/:service", func(c *gin.Context) {
-		serviceName := c.Param("service")
-		metrics, err := service.GetMetrics(c.Request.Context(), serviceName)
+		core.WritePageWarning(c.Writer, page)
+		logs, err := service.GetAuditLogs(c.Request.Context(), userID, filter)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"metrics": metrics})
+		c.JSON(http.StatusOK, logs)
 	})
 }
 
-func addSyncRoutes(v1 *gin.RouterGroup, service *syncservice.Service) {
-	v1.GET("/sync-jobs", func(c *gin.Context) {
+// vaultContext returns the request's context recording the client, so vault
+// audit entries name its IP address and user agent
+func vaultContext(c *gin.Context) context.Context {
+	return vault.WithClient(c.Request.Context(), c.ClientIP(), c.Request.UserAgent())
+}
+
+// parseSecretTTL parses an optional secret TTL such as "1h"
+func parseSecretTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %w", err)
+	}
+	return ttl, nil
+}
+
+// respondSecretError responds with 404 for secrets the user cannot see or
+// grants that do not exist, and 500 otherwise
+func respondSecretError(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "not granted") {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+}
+
+func addFlowRoutes(v1 *gin.RouterGroup, service *flow.Service) {
+	v1.GET("/workflows", func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		jobs, err := service.GetSyncJobs(c.Request.Context(), userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"sync_jobs": jobs})
+		listPage(c, "workflows", "workflows", func(request core.PageRequest) (*core.Page[*flow.Workflow], error) {
+			return service.ListWorkflowsPage(c.Request.Context(), userID, request)
+		})
 	})
-}
 
-func addInsightRoutes(v1 *gin.RouterGroup, service *insight.Service) {
-	v1.GET("/reports", func(c *gin.Context) {
+	v1.POST("/workflows", func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		reports, err := service.GetReports(c.Request.Context(), userID)
+		
+		var req struct {
+			Name        string `json:"name" binding:"required"`
+			Description string `json:"description"`
+			Environment string `json:"environment"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		
+		workflow := &flow.Workflow{
+			Name:        req.Name,
+			Description: req.Description,
+			Environment: req.Environment,
+		}
+		
+		err := service.CreateWorkflow(c.Request.Context(), workflow)
+		if errors.Is(err, core.ErrJSONTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"reports": reports})
+		
+		c.JSON(http.StatusCreated, gin.H{"message": "Workflow created successfully"})
 	})
-}
 
-func addHubRoutes(v1 *gin.RouterGroup, service *hub.Service) {
-	v1.GET("/integrations", func(c *gin.Context) {
+	v1.GET("/workflows/:id/graph", func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
 			return
 		}
-		integrations, err := service.GetIntegrations(c.Request.Context(), userID)
+		workflowID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+			return
+		}
+		format := c.DefaultQuery("format", flow.GraphFormatDOT)
+		graph, err := service.ExportWorkflowGraph(c.Request.Context(), userID, uint(workflowID), format)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			} else if strings.Contains(err.Error(), "unsupported graph format") || strings.Contains(err.Error(), "cycle") {
+				status = http.StatusBadRequest
+			}
+			c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"integrations": integrations})
+		contentType := "text/vnd.graphviz"
+		if format == flow.GraphFormatMermaid {
+			contentType = "text/plain; charset=utf-8"
+		}
+		c.Data(http.StatusOK, contentType, graph)
 	})
-}
 
-func migrateAllSchemas(pool *database.ConnectionPool) error {
-	// Migrate all service schemas
-	if err := pool.DB.AutoMigrate(&vault.Secret{}); err != nil {
-		return fmt.Errorf("vault migration failed: %w", err)
-	}
-	if err := pool.DB.AutoMigrate(&flow.Workflow{}, &flow.WorkflowExecution{}, &flow.WorkflowStep{}, &flow.StepExecution{}, &flow.WorkflowTemplate{}); err != nil {
-		return fmt.Errorf("flow migration failed: %w", err)
-	}
-	if err := pool.DB.AutoMigrate(&task.Task{}); err != nil {
-		return fmt.Errorf("task migration failed: %w", err)
-	}
-	if err := pool.DB.AutoMigrate(&monitor.Metric{}, &monitor.Alert{}); err != nil {
-		return fmt.Errorf("monitor migration failed: %w", err)
-	}
-	if err := pool.DB.AutoMigrate(&syncservice.SyncJob{}); err != nil {
-		return fmt.Errorf("sync migration failed: %w", err)
-	}
-	if err := pool.DB.AutoMigrate(&insight.Report{}); err != nil {
-		return fmt.Errorf("insight migration failed: %w", err)
+	v1.GET("/environments", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		listPage(c, "environments", "environments", func(request core.PageRequest) (*core.Page[*flow.Environment], error) {
+			return service.ListEnvironmentsPage(c.Request.Context(), userID, request)
+		})
+	})
+
+	v1.POST("/environments", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		var req struct {
+			Name      string            `json:"name" binding:"required"`
+			Variables flow.JSONMap      `json:"variables"`
+			Secrets   map[string]string `json:"secrets"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		environment := &flow.Environment{UserID: userID, Name: req.Name, Variables: req.Variables, Secrets: req.Secrets}
+		err := service.CreateEnvironment(c.Request.Context(), environment)
+		if errors.Is(err, core.ErrJSONTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, environment)
+	})
+
+	v1.GET("/executions/:id/junit", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		executionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution ID"})
+			return
+		}
+		report, err := service.ExportExecutionJUnit(c.Request.Context(), userID, uint(executionID))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			} else if strings.Contains(err.Error(), "not finished") {
+				status = http.StatusConflict
+			}
+			c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/xml", report)
+	})
+
+	v1.GET("/executions/:id/artifacts", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		executionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution ID"})
+			return
+		}
+		listPage(c, "artifacts", "artifacts", func(request core.PageRequest) (*core.Page[*flow.Artifact], error) {
+			return service.ListArtifactsPage(c.Request.Context(), userID, uint(executionID), request)
+		})
+	})
+
+	v1.GET("/executions/:id/artifacts/:name", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		executionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution ID"})
+			return
+		}
+		artifact, content, err := service.OpenArtifact(c.Request.Context(), userID, uint(executionID), c.Param("name"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			}
+			c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
+			return
+		}
+		defer content.Close()
+		c.DataFromReader(http.StatusOK, artifact.Size, "application/octet-stream", content, map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename=%q", artifact.Name),
+			"X-Checksum-Sha256":   artifact.Checksum,
+		})
+	})
+}
+
+func addTaskRoutes(v1 *gin.RouterGroup, service *task.Service) {
+	v1.GET("/tasks", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		listPage(c, "tasks", "tasks", func(request core.PageRequest) (*core.Page[*task.Task], error) {
+			return service.ListTasksPage(c.Request.Context(), userID, request)
+		})
+	})
+}
+
+func addMonitorRoutes(v1 *gin.RouterGroup, service *monitor.Service) {
+	// Dashboards fetch several services at once; services that fail are
+	// reported alongside the rest, e.g. /metrics?services=vault,flow,task
+	v1.GET("/metrics", func(c *gin.Context) {
+		result, err := service.GetMetricsForServices(c.Request.Context(), strings.Split(c.Query("services"), ","))
+		if errors.Is(err, monitor.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		if result.Failed() {
+			c.JSON(http.StatusInternalServerError, result)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	v1.GET("/metrics/:service", func(c *gin.Context) {
+		serviceName := c.Param("service")
+		listPage(c, "metrics", "metrics", func(request core.PageRequest) (*core.Page[*monitor.Metric], error) {
+			return service.GetMetricsPage(c.Request.Context(), serviceName, request)
+		})
+	})
+
+	// e.g. /metrics/api/latency/query?op=gt&threshold=500&from=2024-01-01T00:00:00Z
+	v1.GET("/metrics/:service/:name/query", func(c *gin.Context) {
+		threshold, err := strconv.ParseFloat(c.Query("threshold"), 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a number"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		var window monitor.TimeRange
+		for param, target := range map[string]*time.Time{"from": &window.From, "to": &window.To} {
+			if value := c.Query(param); value != "" {
+				if *target, err = time.Parse(time.RFC3339, value); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC 3339 time", param)})
+					return
+				}
+			}
+		}
+
+		metrics, err := service.QueryMetricsByValue(c.Request.Context(), c.Param("service"), c.Param("name"), c.Query("op"), threshold, limit, window)
+		if errors.Is(err, monitor.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"metrics": metrics})
+	})
+
+	// Dashboards read bucketed summaries, served from rollups where available,
+	// e.g. /metrics/api/latency/summary?resolution=hour&from=2024-01-01T00:00:00Z
+	v1.GET("/metrics/:service/:name/summary", func(c *gin.Context) {
+		resolution := monitor.RollupResolution(c.DefaultQuery("resolution", string(monitor.RollupMinute)))
+		var window monitor.TimeRange
+		for param, target := range map[string]*time.Time{"from": &window.From, "to": &window.To} {
+			if value := c.Query(param); value != "" {
+				var err error
+				if *target, err = time.Parse(time.RFC3339, value); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC 3339 time", param)})
+					return
+				}
+			}
+		}
+
+		summaries, err := service.SummarizeMetrics(c.Request.Context(), c.Param("service"), c.Param("name"), resolution, window)
+		if errors.Is(err, monitor.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"summaries": summaries})
+	})
+
+	// Time series over any bucket width,
+	// e.g. /metrics/api/latency/aggregate?fn=avg&bucket=5m&from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z
+	v1.GET("/metrics/:service/:name/aggregate", func(c *gin.Context) {
+		bucket, err := time.ParseDuration(c.DefaultQuery("bucket", "1m"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bucket must be a duration such as 1m, 5m or 1h"})
+			return
+		}
+		var window monitor.TimeRange
+		for param, target := range map[string]*time.Time{"from": &window.From, "to": &window.To} {
+			if value := c.Query(param); value != "" {
+				if *target, err = time.Parse(time.RFC3339, value); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC 3339 time", param)})
+					return
+				}
+			}
+		}
+		if window.To.IsZero() {
+			window.To = time.Now()
+		}
+
+		fn := monitor.AggregateFunc(c.DefaultQuery("fn", string(monitor.AggregateAvg)))
+		points, err := service.AggregateMetrics(c.Request.Context(), c.Param("service"), c.Param("name"), fn, window.From, window.To, bucket)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"points": points})
+	})
+
+	v1.POST("/metrics/batch", func(c *gin.Context) {
+		var req struct {
+			Metrics []*monitor.Metric `json:"metrics" binding:"required"`
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxBatchBytes())
+		if err := c.ShouldBindJSON(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "max_batch_size": service.MaxBatchSize()})
+				return
+			}
+			c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+			return
+		}
+
+		results, err := service.IngestBatch(c.Request.Context(), req.Metrics)
+		if err != nil {
+			switch {
+			case errors.Is(err, monitor.ErrBatchTooLarge):
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "max_batch_size": service.MaxBatchSize()})
+			case errors.Is(err, monitor.ErrIngestBusy):
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			default:
+				c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		accepted, dropped := 0, 0
+		for _, result := range results {
+			switch {
+			case result.Accepted:
+				accepted++
+			case result.Dropped:
+				dropped++
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"accepted": accepted,
+			"rejected": len(results) - accepted - dropped,
+			"dropped":  dropped,
+			"results":  results,
+		})
+	})
+
+	// Previews whether an alert condition would fire now, without saving it
+	v1.POST("/alerts/test", func(c *gin.Context) {
+		var req struct {
+			Condition string `json:"condition" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		fired, detail, err := service.EvaluateCondition(c.Request.Context(), req.Condition)
+		if err != nil {
+			var syntaxErr *condition.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"fired": fired, "detail": detail})
+	})
+}
+
+func addSyncRoutes(v1 *gin.RouterGroup, service *syncservice.Service) {
+	v1.GET("/sync-jobs", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		listPage(c, "sync-jobs", "sync_jobs", func(request core.PageRequest) (*core.Page[*syncservice.SyncJob], error) {
+			return service.GetSyncJobsPage(c.Request.Context(), userID, request)
+		})
+	})
+
+	v1.GET("/sync-jobs/:id/plan", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync job ID"})
+			return
+		}
+		plan, err := service.PlanSyncJob(c.Request.Context(), userID, uint(jobID))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			}
+			c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"plan": plan})
+	})
+
+	v1.POST("/sync-jobs/:id/run", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync job ID"})
+			return
+		}
+
+		// Transfers outlive the request, so the job runs in the background
+		go func() {
+			if _, err := service.RunSyncJob(context.Background(), userID, uint(jobID)); err != nil {
+				log.Printf("⚠️  Sync job %d failed: %v", jobID, err)
+			}
+		}()
+		c.JSON(http.StatusAccepted, gin.H{"message": "Sync job started"})
+	})
+}
+
+func addInsightRoutes(v1 *gin.RouterGroup, service *insight.Service) {
+	v1.GET("/reports", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		listPage(c, "reports", "reports", func(request core.PageRequest) (*core.Page[*insight.Report], error) {
+			return service.GetReportsPage(c.Request.Context(), userID, request)
+		})
+	})
+
+	v1.GET("/reports/cache/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"query_cache": service.QueryCacheStats()})
+	})
+
+	v1.POST("/reports/:id/generate", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		reportID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+			return
+		}
+		force := c.Query("force") == "true"
+		data, err := service.GenerateReport(c.Request.Context(), userID, uint(reportID), force)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			}
+			c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": data})
+	})
+
+	v1.GET("/reports/:id/compare", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		reportID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+			return
+		}
+		current, previous, err := comparisonRanges(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		comparison, err := service.CompareReport(c.Request.Context(), userID, uint(reportID), current, previous)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			} else if strings.Contains(err.Error(), "invalid range") {
+				status = http.StatusBadRequest
+			}
+			c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"comparison": comparison})
+	})
+}
+
+// comparisonRanges reads explicit from/to and previous_from/previous_to RFC3339
+// ranges, falling back to a calendar period (default month)
+func comparisonRanges(c *gin.Context) (insight.TimeRange, insight.TimeRange, error) {
+	if c.Query("from") == "" {
+		return insight.PeriodRanges(c.DefaultQuery("period", "month"), time.Now())
+	}
+
+	var values [4]time.Time
+	for i, name := range []string{"from", "to", "previous_from", "previous_to"} {
+		value, err := time.Parse(time.RFC3339, c.Query(name))
+		if err != nil {
+			return insight.TimeRange{}, insight.TimeRange{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		values[i] = value.UTC()
 	}
-	if err := pool.DB.AutoMigrate(&hub.Integration{}); err != nil {
-		return fmt.Errorf("hub migration failed: %w", err)
+	return insight.TimeRange{From: values[0], To: values[1]}, insight.TimeRange{From: values[2], To: values[3]}, nil
+}
+
+func addHubRoutes(v1 *gin.RouterGroup, service *hub.Service) {
+	v1.GET("/integrations", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		listPage(c, "integrations", "integrations", func(request core.PageRequest) (*core.Page[*hub.Integration], error) {
+			return service.GetIntegrationsPage(c.Request.Context(), userID, request)
+		})
+	})
+
+	v1.GET("/integrations/:id/deliveries", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		integrationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid integration ID"})
+			return
+		}
+		listPage(c, "deliveries", "deliveries", func(request core.PageRequest) (*core.Page[*hub.WebhookDelivery], error) {
+			return service.ListDeliveriesPage(c.Request.Context(), userID, uint(integrationID), request)
+		})
+	})
+
+	setStatus := func(update func(ctx context.Context, userID string, integrationID uint) (*hub.Integration, error)) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			userID := getUserID(c)
+			if userID == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+				return
+			}
+			integrationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid integration ID"})
+				return
+			}
+			integration, err := update(c.Request.Context(), userID, uint(integrationID))
+			if err != nil {
+				status := http.StatusInternalServerError
+				if strings.Contains(err.Error(), "not found") {
+					status = http.StatusNotFound
+				}
+				c.JSON(errorStatus(err, status), gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, integration)
+		}
 	}
-	return nil
+	v1.POST("/integrations/:id/disable", setStatus(service.DisableIntegration))
+	v1.POST("/integrations/:id/enable", setStatus(service.EnableIntegration))
+
+	// Receives webhooks sent to an integration. Senders are authenticated by
+	// the webhook signature rather than a user ID.
+	v1.POST("/integrations/:id/webhook", func(c *gin.Context) {
+		integrationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid integration ID"})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, hub.MaxWebhookBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err = service.ReceiveWebhook(c.Request.Context(), uint(integrationID), c.Request.Header, body)
+		switch {
+		case errors.Is(err, hub.ErrWebhookSignature), errors.Is(err, hub.ErrWebhookStale):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, hub.ErrWebhookReplayed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, hub.ErrIntegrationDisabled):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil && strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		default:
+			c.Status(http.StatusNoContent)
+		}
+	})
 }
 
-func migrateServiceSchema(pool *database.ConnectionPool, serviceName string) error {
-	switch serviceName {
-	case "vault":
-		return pool.DB.AutoMigrate(&vault.Secret{})
-	case "flow":
-		return pool.DB.AutoMigrate(&flow.Workflow{}, &flow.WorkflowExecution{}, &flow.WorkflowStep{}, &flow.StepExecution{}, &flow.WorkflowTemplate{})
-	case "task":
-		return pool.DB.AutoMigrate(&task.Task{})
-	case "monitor":
-		return pool.DB.AutoMigrate(&monitor.Metric{}, &monitor.Alert{})
-	case "sync":
-		return pool.DB.AutoMigrate(&syncservice.SyncJob{})
-	case "insight":
-		return pool.DB.AutoMigrate(&insight.Report{})
-	case "hub":
-		return pool.DB.AutoMigrate(&hub.Integration{})
-	}
-	return nil
+func addSearchRoutes(v1 *gin.RouterGroup, serviceInstances map[string]interface{}) {
+	var searchers []core.Searcher
+	for _, name := range []string{"vault", "flow", "task", "hub"} {
+		if searcher, ok := serviceInstances[name].(core.Searcher); ok {
+			searchers = append(searchers, searcher)
+		}
+	}
+	coordinator := core.NewSearchCoordinator(searchers...)
+
+	v1.GET("/search", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+			return
+		}
+		page, err := core.ParsePageRequest(c.Request, "search")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		core.WritePageWarning(c.Writer, page)
+		results, err := coordinator.Search(c.Request.Context(), userID, query, page.Page, page.PageSize)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	})
 }
 
-func getDefaultPort(serviceName string) int {
-	ports := map[string]int{
-		"api-gateway": 8000,
-		"vault":       8080,
-		"flow":        8081,
-		"task":        8082,
-		"monitor":     8083,
-		"sync":        8084,
-		"insight":     8085,
-		"hub":         8086,
-	}
-	if port, exists := ports[serviceName]; exists {
-		return port
-	}
-	return 8000
+func addOverviewRoutes(v1 *gin.RouterGroup, serviceInstances map[string]interface{}) {
+	var counters []core.Counter
+	for _, name := range []string{"vault", "flow", "task", "monitor", "sync", "insight", "hub"} {
+		if counter, ok := serviceInstances[name].(core.Counter); ok {
+			counters = append(counters, counter)
+		}
+	}
+	coordinator := core.NewOverviewCoordinator(counters...)
+
+	v1.GET("/overview", func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID required"})
+			return
+		}
+		filter := core.CountFilter{GroupByStatus: c.Query("by_status") == "true"}
+		if since := c.Query("since"); since != "" {
+			createdAfter, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since (RFC 3339 timestamp)"})
+				return
+			}
+			filter.CreatedAfter = createdAfter
+		}
+		overview, err := coordinator.Overview(c.Request.Context(), userID, filter)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, overview)
+	})
 }
 
 // CLI command implementations (from the original CLI)
 func statusCmd() *cobra.Command {
-	return &cobra.Command{
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show system status",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Vertex DevOps Suite Status")
-			fmt.Println("========================")
+			cli.Infof("Vertex DevOps Suite Status")
+			cli.Infof("========================")
 			
-			services := []struct {
-				name string
-				port int
-			}{
-				{"API Gateway", 8000},
-				{"Vault", 8080},
-				{"Flow", 8081},
-				{"Task", 8082},
-				{"Monitor", 8083},
-				{"Sync", 8084},
-				{"Insight", 8085},
-				{"Hub", 8086},
+			services := []serviceHealthTarget{
+				{"API Gateway", "http://localhost:8000/health"},
+				{"Vault", "http://localhost:8080/health"},
+				{"Flow", "http://localhost:8081/health"},
+				{"Task", "http://localhost:8082/health"},
+				{"Monitor", "http://localhost:8083/health"},
+				{"Sync", "http://localhost:8084/health"},
+				{"Insight", "http://localhost:8085/health"},
+				{"Hub", "http://localhost:8086/health"},
 			}
 
-			for _, service := range services {
-				url := fmt.Sprintf("http://localhost:%d/health", service.port)
-				status := checkServiceHealth(url)
-				fmt.Printf("%-12s: %s\n", service.name, status)
+			statuses := checkServicesHealth(cmd.Context(), services, timeout)
+			for i, service := range services {
+				cli.Resultf("%-12s: %s\n", service.name, statuses[i])
 			}
 		},
 	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 2*time.Second, "Deadline for each service's health check")
+
+	return cmd
 }
 
 // Include the CLI commands from the original implementation
@@ -771,19 +1660,9 @@ func vaultCmd() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List secrets",
-		Run: func(cmd *cobra.Command, args []string) {
-			url := fmt.Sprintf("http://localhost:8080/api/v1/secrets")
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := serviceURL(8080, "/api/v1/secrets")
+			return streamPages(url, "secrets", format, cli.stdout)
 		},
 	}
 	listCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -792,52 +1671,36 @@ func vaultCmd() *cobra.Command {
 		Use:   "get [key]",
 		Short: "Get a secret",
 		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			key := args[0]
-			url := fmt.Sprintf("http://localhost:8080/api/v1/secrets/%s", key)
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
+			path := "/api/v1/secrets/" + key
+			if owner, _ := cmd.Flags().GetString("owner"); owner != "" {
+				path += "?owner=" + url.QueryEscape(owner)
 			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+			return printRequest("GET", serviceURL(8080, path), nil, format)
 		},
 	}
 	getCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
+	getCmd.Flags().String("owner", "", "Owner of a secret granted to you")
 
 	storeCmd := &cobra.Command{
 		Use:   "store [key] [value]",
 		Short: "Store a secret",
 		Args:  cobra.ExactArgs(2),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			key := args[0]
 			value := args[1]
 			description, _ := cmd.Flags().GetString("description")
 			tags, _ := cmd.Flags().GetStringSlice("tags")
 			
-			url := fmt.Sprintf("http://localhost:8080/api/v1/secrets")
+			url := serviceURL(8080, "/api/v1/secrets")
 			body := map[string]interface{}{
 				"key":         key,
 				"value":       value,
 				"description": description,
 				"tags":        tags,
 			}
-			resp, err := makeRequest("POST", url, body)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+			return printRequest("POST", url, body, format)
 		},
 	}
 	storeCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -848,29 +1711,19 @@ func vaultCmd() *cobra.Command {
 		Use:   "update [key] [value]",
 		Short: "Update a secret",
 		Args:  cobra.ExactArgs(2),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			key := args[0]
 			value := args[1]
 			description, _ := cmd.Flags().GetString("description")
 			tags, _ := cmd.Flags().GetStringSlice("tags")
 			
-			url := fmt.Sprintf("http://localhost:8080/api/v1/secrets/%s", key)
+			url := serviceURL(8080, "/api/v1/secrets/"+key)
 			body := map[string]interface{}{
 				"value":       value,
 				"description": description,
 				"tags":        tags,
 			}
-			resp, err := makeRequest("PUT", url, body)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+			return printRequest("PUT", url, body, format)
 		},
 	}
 	updateCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -881,28 +1734,52 @@ func vaultCmd() *cobra.Command {
 		Use:   "delete [key]",
 		Short: "Delete a secret",
 		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			key := args[0]
-			url := fmt.Sprintf("http://localhost:8080/api/v1/secrets/%s", key)
-			resp, err := makeRequest("DELETE", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
+			url := serviceURL(8080, "/api/v1/secrets/"+key)
+			return printRequest("DELETE", url, nil, format)
+		},
+	}
+	deleteCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that every secret decrypts, without showing values",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/api/v1/secrets/verify"
+			if repair, _ := cmd.Flags().GetBool("repair"); repair {
+				path += "?repair=true"
 			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
+			url := serviceURL(8080, path)
+			return printRequest("POST", url, nil, format)
+		},
+	}
+	verifyCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
+	verifyCmd.Flags().Bool("repair", false, "Re-encrypt secrets written under a previous master key")
+
+	var oldPassword, newPassword string
+	rotateCmd := &cobra.Command{
+		Use:   "rotate-master",
+		Short: "Re-encrypt every secret under a new master password",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if oldPassword == "" || newPassword == "" {
+				return &usageError{err: errors.New("old and new passwords are required (--old-password or VERTEX_MASTER_PASSWORD, --new-password or VERTEX_NEW_MASTER_PASSWORD)")}
 			}
-			fmt.Println(output)
+			url := serviceURL(8080, "/api/v1/secrets/rotate-master")
+			body := map[string]string{"old_password": oldPassword, "new_password": newPassword}
+			return printRequest("POST", url, body, format)
 		},
 	}
-	deleteCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
+	rotateCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
+	rotateCmd.Flags().StringVar(&oldPassword, "old-password", os.Getenv("VERTEX_MASTER_PASSWORD"), "Current master password")
+	rotateCmd.Flags().StringVar(&newPassword, "new-password", os.Getenv("VERTEX_NEW_MASTER_PASSWORD"), "New master password; configure it as the master password before the next restart")
 
-	cmd.AddCommand(listCmd, getCmd, storeCmd, updateCmd, deleteCmd)
+	cmd.AddCommand(listCmd, getCmd, storeCmd, updateCmd, deleteCmd, verifyCmd, rotateCmd)
 	return cmd
 }
 
+// formatOutput formats a small response in memory; list commands use streamOutput
 func formatOutput(jsonStr, format string) (string, error) {
 	if format == "yaml" {
 		var data interface{}
@@ -929,19 +1806,9 @@ func flowCmd() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List workflows",
-		Run: func(cmd *cobra.Command, args []string) {
-			url := fmt.Sprintf("http://localhost:8081/api/v1/workflows")
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := serviceURL(8081, "/api/v1/workflows")
+			return streamPages(url, "workflows", format, cli.stdout)
 		},
 	}
 	listCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -961,19 +1828,9 @@ func taskCmd() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List tasks",
-		Run: func(cmd *cobra.Command, args []string) {
-			url := fmt.Sprintf("http://localhost:8082/api/v1/tasks")
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := serviceURL(8082, "/api/v1/tasks")
+			return streamPages(url, "tasks", format, cli.stdout)
 		},
 	}
 	listCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -994,20 +1851,10 @@ func monitorCmd() *cobra.Command {
 		Use:   "metrics [service]",
 		Short: "Get service metrics",
 		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			service := args[0]
-			url := fmt.Sprintf("http://localhost:8083/api/v1/metrics/%s", service)
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+			url := serviceURL(8083, "/api/v1/metrics/"+service)
+			return streamPages(url, "metrics", format, cli.stdout)
 		},
 	}
 	metricsCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -1027,24 +1874,26 @@ func syncCmd() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List sync jobs",
-		Run: func(cmd *cobra.Command, args []string) {
-			url := fmt.Sprintf("http://localhost:8084/api/v1/sync-jobs")
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := serviceURL(8084, "/api/v1/sync-jobs")
+			return streamPages(url, "sync_jobs", format, cli.stdout)
 		},
 	}
 	listCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
 
+	planCmd := &cobra.Command{
+		Use:   "plan [id]",
+		Short: "Show what running a sync job would copy, skip or delete",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := serviceURL(8084, "/api/v1/sync-jobs/"+args[0]+"/plan")
+			return printRequest("GET", url, nil, format)
+		},
+	}
+	planCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
+
 	cmd.AddCommand(listCmd)
+	cmd.AddCommand(planCmd)
 	return cmd
 }
 
@@ -1059,19 +1908,9 @@ func insightCmd() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List reports",
-		Run: func(cmd *cobra.Command, args []string) {
-			url := fmt.Sprintf("http://localhost:8085/api/v1/reports")
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := serviceURL(8085, "/api/v1/reports")
+			return streamPages(url, "reports", format, cli.stdout)
 		},
 	}
 	listCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -1091,19 +1930,9 @@ func hubCmd() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List integrations",
-		Run: func(cmd *cobra.Command, args []string) {
-			url := fmt.Sprintf("http://localhost:8086/api/v1/integrations")
-			resp, err := makeRequest("GET", url, nil)
-			if err != nil {
-				fmt.Printf("Error: %v\n", err)
-				return
-			}
-			output, err := formatOutput(resp, format)
-			if err != nil {
-				fmt.Printf("Error formatting output: %v\n", err)
-				return
-			}
-			fmt.Println(output)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url := serviceURL(8086, "/api/v1/integrations")
+			return streamPages(url, "integrations", format, cli.stdout)
 		},
 	}
 	listCmd.Flags().StringVar(&format, "format", "json", "Output format (json|yaml)")
@@ -1144,6 +1973,19 @@ func loggingMiddleware() gin.HandlerFunc {
 	})
 }
 
+// errorStatus returns the status to respond with for err: 503 while the
+// database is unavailable, 504 when the request ran out of time, and status
+// otherwise
+func errorStatus(err error, status int) int {
+	switch {
+	case core.CodeOf(err) == core.ErrorCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case database.IsTimeout(err):
+		return http.StatusGatewayTimeout
+	}
+	return status
+}
+
 func getUserID(c *gin.Context) string {
 	return c.GetHeader("X-User-ID")
 }
@@ -1156,50 +1998,69 @@ func getEnv(key, defaultValue string) string {
 }
 
 // Include helper functions from original CLI
-func checkServiceHealth(url string) string {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(url)
-	if err != nil {
-		return "❌ Unhealthy"
+// Health check states shown by the status command
+const (
+	healthStatusHealthy   = "✅ Healthy"
+	healthStatusDegraded  = "⚠️  Degraded"
+	healthStatusUnhealthy = "❌ Unhealthy"
+	healthStatusTimeout   = "⏱️  Timeout"
+)
+
+type serviceHealthTarget struct {
+	name string
+	url  string
+}
+
+// checkServicesHealth checks every service concurrently, each with its own
+// deadline, so the total runtime is bounded by a single timeout
+func checkServicesHealth(ctx context.Context, services []serviceHealthTarget, timeout time.Duration) []string {
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		return "✅ Healthy"
+	statuses := make([]string, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			statuses[i] = checkServiceHealth(checkCtx, url)
+		}(i, service.url)
 	}
-	return "⚠️  Degraded"
+	wg.Wait()
+
+	return statuses
 }
 
-func makeRequest(method, url string, body interface{}) (string, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-	
-	var reqBody io.Reader
-	if body != nil {
-		jsonBody, err := json.Marshal(body)
-		if err != nil {
-			return "", err
-		}
-		reqBody = bytes.NewBuffer(jsonBody)
+func checkServiceHealth(ctx context.Context, url string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return healthStatusUnhealthy
 	}
-	
-	req, err := http.NewRequest(method, url, reqBody)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", err
+		if errors.Is(err, context.DeadlineExceeded) {
+			return healthStatusTimeout
+		}
+		return healthStatusUnhealthy
 	}
+	defer resp.Body.Close()
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-User-ID", "cli-user")
+	if resp.StatusCode == http.StatusOK {
+		return healthStatusHealthy
+	}
+	return healthStatusDegraded
+}
 
-	resp, err := client.Do(req)
+func makeRequest(method, url string, body interface{}) (string, error) {
+	resp, err := doRequest(method, url, body)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
@@ -1,17 +1,43 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	apigateway "github.com/ataiva-software/vertex/internal/api-gateway"
+	"github.com/ataiva-software/vertex/internal/flow"
+	"github.com/ataiva-software/vertex/internal/hub"
+	"github.com/ataiva-software/vertex/internal/insight"
+	"github.com/ataiva-software/vertex/internal/monitor"
+	syncservice "github.com/ataiva-software/vertex/internal/sync"
+	"github.com/ataiva-software/vertex/internal/task"
+	"github.com/ataiva-software/vertex/internal/vault"
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestFormatOutput(t *testing.T) {
@@ -133,7 +159,7 @@ func TestVaultCommands(t *testing.T) {
 	
 	// Check subcommands
 	subcommands := cmd.Commands()
-	assert.Len(t, subcommands, 5) // list, get, store, update, delete
+	assert.Len(t, subcommands, 7) // list, get, store, update, delete, verify, rotate-master
 	
 	commandNames := make([]string, len(subcommands))
 	for i, subcmd := range subcommands {
@@ -144,6 +170,8 @@ func TestVaultCommands(t *testing.T) {
 	assert.Contains(t, commandNames, "store [key] [value]")
 	assert.Contains(t, commandNames, "update [key] [value]")
 	assert.Contains(t, commandNames, "delete [key]")
+	assert.Contains(t, commandNames, "verify")
+	assert.Contains(t, commandNames, "rotate-master")
 }
 
 func TestAllCommandsHaveFormatFlag(t *testing.T) {
@@ -263,6 +291,12 @@ func TestErrorHandling(t *testing.T) {
 	assert.NoError(t, err) // Should default to JSON
 }
 
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusServiceUnavailable, errorStatus(fmt.Errorf("failed to list tasks: %w", database.ErrUnavailable), http.StatusInternalServerError))
+	assert.Equal(t, http.StatusGatewayTimeout, errorStatus(fmt.Errorf("failed to list tasks: %w", context.DeadlineExceeded), http.StatusBadRequest))
+	assert.Equal(t, http.StatusBadRequest, errorStatus(fmt.Errorf("invalid threshold"), http.StatusBadRequest))
+}
+
 // Benchmark tests
 func BenchmarkFormatOutputJSON(b *testing.B) {
 	input := `{"key":"value","number":123,"array":[1,2,3]}`
@@ -279,3 +313,1181 @@ func BenchmarkFormatOutputYAML(b *testing.B) {
 		formatOutput(input, "yaml")
 	}
 }
+
+func setupMonitorRouter(t *testing.T) (*gin.Engine, *monitor.Service) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&monitor.Metric{}, &monitor.Alert{}, &monitor.MetricRollup{}, &monitor.MetricRollupWatermark{}))
+
+	service := monitor.NewService()
+	service.SetDB(db)
+
+	router := gin.New()
+	addMonitorRoutes(router.Group("/api/v1"), service)
+	return router, service
+}
+
+func TestMetricBatchEndpoint(t *testing.T) {
+	router, service := setupMonitorRouter(t)
+
+	t.Run("should return per-item results for a mixed batch", func(t *testing.T) {
+		body := `{"metrics":[{"service_name":"api","name":"requests","value":1},{"service_name":"api","name":""}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/metrics/batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp struct {
+			Accepted int                     `json:"accepted"`
+			Rejected int                     `json:"rejected"`
+			Results  []*monitor.IngestResult `json:"results"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, 1, resp.Accepted)
+		assert.Equal(t, 1, resp.Rejected)
+		assert.True(t, resp.Results[0].Accepted)
+		assert.False(t, resp.Results[1].Accepted)
+	})
+
+	t.Run("should return 413 when the batch is too large", func(t *testing.T) {
+		service.SetMaxBatchSize(1)
+		body := `{"metrics":[{"service_name":"api","name":"a"},{"service_name":"api","name":"b"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/metrics/batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("should return 413 before decoding an oversized body", func(t *testing.T) {
+		service.SetMaxBatchSize(1)
+		body := `{"metrics":[{"service_name":"api","name":"a","tags":"` + strings.Repeat("x", monitor.MaxMetricBytes) + `"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/metrics/batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
+
+func TestMetricQueryEndpoint(t *testing.T) {
+	router, service := setupMonitorRouter(t)
+
+	t.Run("should return 400 for invalid queries", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/api/latency/query?op=like&threshold=1", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should return 500 when the store fails", func(t *testing.T) {
+		// Without tables every query fails
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		require.NoError(t, err)
+		service.SetDB(db)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/api/latency/query?op=gt&threshold=1", nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestMultiServiceMetricsEndpoint(t *testing.T) {
+	router, service := setupMonitorRouter(t)
+
+	t.Run("should return 400 without services", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?services=", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should return 500 when every query fails", func(t *testing.T) {
+		// Without tables every query fails
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		require.NoError(t, err)
+		service.SetDB(db)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?services=vault,flow", nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestMetricSummaryEndpoint(t *testing.T) {
+	router, service := setupMonitorRouter(t)
+	from := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	t.Run("should return 400 for invalid queries", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/api/latency/summary?resolution=day&from="+from, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("should return 500 when the store fails", func(t *testing.T) {
+		// Without tables every query fails
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		require.NoError(t, err)
+		service.SetDB(db)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/api/latency/summary?from="+from, nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestVaultAuditEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&vault.Secret{}, &vault.SecretVersion{}, &vault.SecretGrant{}, &vault.AuditLog{}, &vault.KeySalt{}))
+	service := vault.NewService(vault.StaticKeyProvider("test-password"))
+	service.SetDB(db)
+	router := gin.New()
+	addVaultRoutes(router.Group("/api/v1"), service)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-User-ID", "user1")
+		req.Header.Set("User-Agent", "vertex-cli/1.0")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/v1/secrets", `{"key":"db-password","value":"hunter2"}`).Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/secrets/db-password", "").Code)
+
+	t.Run("should return a page of audit entries with the client", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/api/v1/audit-logs?action=create&from=2000-01-01T00:00:00Z", "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page core.Page[*vault.AuditLog]
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		assert.Equal(t, 1, page.Total)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "db-password", page.Items[0].SecretKey)
+		assert.Equal(t, "192.0.2.1", page.Items[0].IPAddress)
+		assert.Equal(t, "vertex-cli/1.0", page.Items[0].UserAgent)
+	})
+
+	t.Run("should reject an invalid time range", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/api/v1/audit-logs?to=yesterday", "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid to")
+	})
+}
+
+func TestRotateMasterPasswordEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&vault.Secret{}, &vault.SecretVersion{}, &vault.SecretGrant{}, &vault.AuditLog{}, &vault.KeySalt{}))
+	service := vault.NewService(vault.StaticKeyProvider("old-password"))
+	service.SetDB(db)
+	require.NoError(t, service.StoreSecret(context.Background(), "user1", &vault.Secret{Key: "db", Value: "s3cret"}))
+	router := gin.New()
+	addVaultRoutes(router.Group("/api/v1"), service)
+
+	rotate := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/rotate-master", strings.NewReader(body))
+		req.Header.Set("X-User-ID", "user1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, rotate(`{"old_password":"old-password"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, rotate(`{"old_password":"old-password","new_password":"old-password"}`).Code)
+	assert.Equal(t, http.StatusForbidden, rotate(`{"old_password":"guess","new_password":"new-password"}`).Code)
+
+	rec := rotate(`{"old_password":"old-password","new_password":"new-password"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"rotated":1}`, rec.Body.String())
+
+	restarted := vault.NewService(vault.StaticKeyProvider("new-password"))
+	restarted.SetDB(db)
+	secret, err := restarted.GetSecret(context.Background(), "user1", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", secret.Value)
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&vault.Secret{}, &vault.SecretGrant{}, &flow.Workflow{}, &flow.WorkflowStep{}, &task.Task{}, &hub.Integration{}))
+
+	require.NoError(t, db.Create(&vault.Secret{UserID: "user1", Key: "deploy-token", Value: "x", Description: "CI token"}).Error)
+	require.NoError(t, db.Create(&vault.Secret{UserID: "user2", Key: "deploy-other", Value: "x"}).Error)
+	require.NoError(t, db.Create(&flow.Workflow{UserID: "user1", Name: "Deploy"}).Error)
+	require.NoError(t, db.Create(&task.Task{UserID: "user1", Name: "backup", Type: "shell", Description: "runs before deploy"}).Error)
+	require.NoError(t, db.Create(&hub.Integration{UserID: "user1", Name: "slack", Type: "chat"}).Error)
+
+	os.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	defer os.Unsetenv("VERTEX_MASTER_PASSWORD")
+	vaultService := vault.NewService(vault.NewEnvKeyProvider())
+	vaultService.SetDB(db)
+	flowService := flow.NewService()
+	flowService.SetDB(db)
+	taskService := task.NewService()
+	taskService.SetDB(db)
+	hubService := hub.NewService()
+	hubService.SetDB(db)
+
+	router := gin.New()
+	addSearchRoutes(router.Group("/api/v1"), map[string]interface{}{
+		"vault": vaultService,
+		"flow":  flowService,
+		"task":  taskService,
+		"hub":   hubService,
+	})
+
+	search := func(userID, rawQuery string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/search?"+rawQuery, nil)
+		if userID != "" {
+			req.Header.Set("X-User-ID", userID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("should return ranked hits across resources for the user", func(t *testing.T) {
+		rec := search("user1", "q=deploy")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var results core.SearchResults
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		require.Equal(t, 3, results.Total)
+		assert.Equal(t, core.ResourceTypeWorkflow, results.Hits[0].ResourceType)
+		assert.Equal(t, core.ResourceTypeSecret, results.Hits[1].ResourceType)
+		assert.Equal(t, "deploy-token", results.Hits[1].ID)
+		assert.Equal(t, core.ResourceTypeTask, results.Hits[2].ResourceType)
+	})
+
+	t.Run("should paginate", func(t *testing.T) {
+		rec := search("user1", "q=deploy&page=2&page_size=2")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var results core.SearchResults
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, 3, results.Total)
+		require.Len(t, results.Hits, 1)
+		assert.Equal(t, core.ResourceTypeTask, results.Hits[0].ResourceType)
+	})
+
+	t.Run("should reject invalid requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, search("", "q=deploy").Code)
+		assert.Equal(t, http.StatusBadRequest, search("user1", "q=").Code)
+		assert.Equal(t, http.StatusBadRequest, search("user1", "q=deploy&page_size=0").Code)
+	})
+
+	t.Run("should clamp an oversized page", func(t *testing.T) {
+		rec := search("user1", "q=deploy&page_size=500")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Header().Get("Warning"), "clamped")
+
+		var results core.SearchResults
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, 100, results.PageSize)
+	})
+}
+
+func TestArtifactEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&flow.StepExecution{}, &flow.Artifact{}))
+
+	store, err := flow.NewLocalArtifactStore(t.TempDir())
+	require.NoError(t, err)
+	service := flow.NewService()
+	service.SetDB(db)
+	service.SetArtifactStore(store)
+
+	execution := &flow.WorkflowExecution{ID: 7, UserID: "user1"}
+	_, err = service.SaveArtifact(context.Background(), execution, &flow.StepExecution{ID: 3}, "report.txt", strings.NewReader("done"))
+	require.NoError(t, err)
+
+	router := gin.New()
+	addFlowRoutes(router.Group("/api/v1"), service)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User-ID", "user1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("should list execution artifacts", func(t *testing.T) {
+		rec := get("/api/v1/executions/7/artifacts")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"name":"report.txt"`)
+	})
+
+	t.Run("should download an artifact", func(t *testing.T) {
+		rec := get("/api/v1/executions/7/artifacts/report.txt")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "done", rec.Body.String())
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), "report.txt")
+	})
+
+	t.Run("should return 404 for unknown artifacts", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/api/v1/executions/7/artifacts/missing").Code)
+	})
+}
+
+func TestOversizedJSONEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&flow.Environment{}))
+	service := flow.NewService()
+	service.SetDB(db)
+	router := gin.New()
+	addFlowRoutes(router.Group("/api/v1"), service)
+
+	core.SetMaxJSONSize(16)
+	defer core.SetMaxJSONSize(0)
+
+	t.Run("should return 413 for oversized environment variables", func(t *testing.T) {
+		body := `{"name":"prod","variables":{"region":"eu-west-1","tier":"premium"}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/environments", strings.NewReader(body))
+		req.Header.Set("X-User-ID", "user1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
+
+type widget struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+type widgetPlugin struct{}
+
+func (widgetPlugin) Name() string          { return "widget" }
+func (widgetPlugin) Models() []interface{} { return []interface{}{&widget{}} }
+func (widgetPlugin) DefaultPort() int      { return 8099 }
+
+func (widgetPlugin) RegisterRoutes(v1 *gin.RouterGroup) {
+	v1.GET("/widgets", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"widgets": []string{"sprocket"}})
+	})
+}
+
+func TestServicePlugins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	t.Setenv("VERTEX_ARTIFACT_DIR", t.TempDir())
+	plugins := append(testServicePlugins(t, db), widgetPlugin{})
+
+	t.Run("should migrate every plugin's models", func(t *testing.T) {
+		require.NoError(t, migrateSchemas(db, plugins))
+		assert.True(t, db.Migrator().HasTable(&widget{}))
+		assert.True(t, db.Migrator().HasTable(&hub.Integration{}))
+	})
+
+	t.Run("should register a plugin's routes", func(t *testing.T) {
+		router := gin.New()
+		widgetPlugin{}.RegisterRoutes(router.Group("/api/v1"))
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/widgets", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "sprocket")
+	})
+
+	t.Run("should mount plugin routes on the gateway", func(t *testing.T) {
+		gateway, err := findPlugin(plugins, "api-gateway")
+		require.NoError(t, err)
+		gateway.(*gatewayPlugin).mount(plugins)
+
+		router := gin.New()
+		gateway.RegisterRoutes(router.Group("/api/v1"))
+
+		for _, path := range []string{"/api/v1/routes", "/api/v1/widgets", "/api/v1/integrations"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("X-User-ID", "user1")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code, path)
+		}
+	})
+
+	t.Run("should resolve ports and reject unknown services", func(t *testing.T) {
+		plugin, err := findPlugin(plugins, "widget")
+		require.NoError(t, err)
+		assert.Equal(t, 8099, plugin.DefaultPort())
+
+		hubPlugin, err := findPlugin(plugins, "hub")
+		require.NoError(t, err)
+		assert.Equal(t, 8086, hubPlugin.DefaultPort())
+		assert.IsType(t, &hub.Service{}, serviceInstance(hubPlugin))
+
+		_, err = findPlugin(plugins, "unknown")
+		assert.ErrorContains(t, err, "unknown service")
+	})
+}
+
+func TestStreamOutput(t *testing.T) {
+	items := make([]map[string]interface{}, 5000)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"id":    i,
+			"name":  fmt.Sprintf("workflow-%d", i),
+			"tags":  []string{"ci", "nightly"},
+			"notes": "line one\nline two",
+			"meta":  map[string]interface{}{"owner": "team-a", "weight": 1.5, "enabled": i%2 == 0, "parent": nil},
+		}
+	}
+	document, err := json.Marshal(map[string]interface{}{"workflows": items, "total": len(items), "filters": map[string]interface{}{}})
+	require.NoError(t, err)
+
+	t.Run("should stream JSON unchanged", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, streamOutput(bytes.NewReader(document), &out, "json"))
+		assert.JSONEq(t, string(document), out.String())
+	})
+
+	t.Run("should stream YAML equivalent to the buffered output", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, streamOutput(bytes.NewReader(document), &out, "yaml"))
+
+		buffered, err := formatOutput(string(document), "yaml")
+		require.NoError(t, err)
+
+		var streamed, expected interface{}
+		require.NoError(t, yaml.Unmarshal(out.Bytes(), &streamed))
+		require.NoError(t, yaml.Unmarshal([]byte(buffered), &expected))
+		assert.Equal(t, expected, streamed)
+	})
+
+	t.Run("should stream top-level arrays and scalars", func(t *testing.T) {
+		for _, input := range []string{`[{"a":1},{"b":[1,2]}]`, `[]`, `{}`, `"text"`, `42`} {
+			var out bytes.Buffer
+			require.NoError(t, streamOutput(strings.NewReader(input), &out, "yaml"), input)
+
+			var streamed, expected interface{}
+			require.NoError(t, yaml.Unmarshal(out.Bytes(), &streamed))
+			require.NoError(t, json.Unmarshal([]byte(input), &expected))
+			streamedJSON, err := json.Marshal(streamed)
+			require.NoError(t, err)
+			assert.JSONEq(t, input, string(streamedJSON))
+		}
+	})
+
+	t.Run("should fail on malformed input", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.Error(t, streamOutput(strings.NewReader(`{"workflows":[{"id":1},`), &out, "yaml"))
+	})
+
+	t.Run("should stream responses from the server", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "cli-user", r.Header.Get("X-User-ID"))
+			w.Write(document)
+		}))
+		defer server.Close()
+
+		var out bytes.Buffer
+		require.NoError(t, streamRequest(http.MethodGet, server.URL, "json", &out))
+		assert.JSONEq(t, string(document), out.String())
+	})
+}
+
+func TestStreamPages(t *testing.T) {
+	// The server clamps every page to two of its five tasks
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.Query().Get("page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		items := []map[string]int{}
+		for id := (page-1)*2 + 1; id <= min(page*2, 5); id++ {
+			items = append(items, map[string]int{"id": id})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tasks": items, "page": page, "page_size": 2, "total": 5})
+	}))
+	defer server.Close()
+
+	t.Run("should fetch and write every page as one list", func(t *testing.T) {
+		pages = nil
+		var out bytes.Buffer
+		require.NoError(t, streamPages(server.URL+"/tasks", "tasks", "json", &out))
+		assert.JSONEq(t, `{"tasks":[{"id":1},{"id":2},{"id":3},{"id":4},{"id":5}],"total":5}`, out.String())
+		assert.Equal(t, []string{"1", "2", "3"}, pages)
+	})
+
+	t.Run("should write every page as YAML", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, streamPages(server.URL+"/tasks", "tasks", "yaml", &out))
+		assert.Equal(t, "tasks:\n- id: 1\n- id: 2\n- id: 3\n- id: 4\n- id: 5\ntotal: 5\n", out.String())
+	})
+
+	t.Run("should write an empty list", func(t *testing.T) {
+		empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"tasks":[],"page":1,"page_size":1000,"total":0}`))
+		}))
+		defer empty.Close()
+
+		var out bytes.Buffer
+		require.NoError(t, streamPages(empty.URL, "tasks", "json", &out))
+		assert.JSONEq(t, `{"tasks":[],"total":0}`, out.String())
+		out.Reset()
+		require.NoError(t, streamPages(empty.URL, "tasks", "yaml", &out))
+		assert.Equal(t, "tasks: []\ntotal: 0\n", out.String())
+	})
+}
+
+func setupCLI(t *testing.T, quiet, verbose bool) (*bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	previous := cli
+	cli = &cliLogger{stdout: stdout, stderr: stderr, quiet: quiet, verbose: verbose}
+	t.Cleanup(func() { cli = previous })
+	return stdout, stderr
+}
+
+func TestCLIOutputModes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"tasks":[{"id":1}]}`))
+	}))
+	defer server.Close()
+
+	run := func() {
+		cli.Infof("Listing tasks")
+		if err := streamRequest(http.MethodGet, server.URL+"/tasks", "json", cli.stdout); err != nil {
+			cli.Errorf("Error: %v", err)
+		}
+		if _, err := makeRequest(http.MethodGet, server.URL+"/missing", nil); err != nil {
+			cli.Errorf("Error: %v", err)
+		}
+	}
+
+	t.Run("should keep results on stdout and diagnostics on stderr by default", func(t *testing.T) {
+		stdout, stderr := setupCLI(t, false, false)
+		run()
+
+		assert.JSONEq(t, `{"tasks":[{"id":1}]}`, stdout.String())
+		assert.Equal(t, "Listing tasks\nError: HTTP 404\n", stderr.String())
+	})
+
+	t.Run("should only print results and errors in quiet mode", func(t *testing.T) {
+		stdout, stderr := setupCLI(t, true, false)
+		run()
+
+		assert.JSONEq(t, `{"tasks":[{"id":1}]}`, stdout.String())
+		assert.Equal(t, "Error: HTTP 404\n", stderr.String())
+	})
+
+	t.Run("should log requests and timings to stderr in verbose mode", func(t *testing.T) {
+		stdout, stderr := setupCLI(t, false, true)
+		run()
+
+		assert.JSONEq(t, `{"tasks":[{"id":1}]}`, stdout.String())
+		assert.Contains(t, stderr.String(), "→ GET "+server.URL+"/tasks\n")
+		assert.Regexp(t, `← GET `+server.URL+`/tasks 200 in \S+\n`, stderr.String())
+		assert.Regexp(t, `← GET `+server.URL+`/missing 404 in \S+\n`, stderr.String())
+		assert.Contains(t, stderr.String(), "Error: HTTP 404\n")
+	})
+
+	t.Run("should reject --quiet with --verbose", func(t *testing.T) {
+		setupCLI(t, false, false)
+		root := newRootCmd()
+		root.SetArgs([]string{"--quiet", "--verbose", "task", "list"})
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+
+		err := root.Execute()
+		assert.ErrorContains(t, err, "none of the others can be")
+	})
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/secrets/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/api/v1/secrets/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/api/v1/workflows":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/api/v1/tasks":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"key":"db-password"}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("VERTEX_API_URL", server.URL)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"success", []string{"vault", "get", "db-password"}, exitOK},
+		{"not found", []string{"vault", "get", "missing"}, exitNotFound},
+		{"forbidden", []string{"vault", "delete", "forbidden"}, exitAuth},
+		{"unauthorized", []string{"flow", "list"}, exitAuth},
+		{"server error", []string{"task", "list"}, exitError},
+		{"wrong argument count", []string{"vault", "get"}, exitUsage},
+		{"unknown flag", []string{"vault", "get", "key", "--bogus"}, exitUsage},
+		{"unknown command", []string{"bogus"}, exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupCLI(t, true, false)
+			root := newRootCmd()
+			root.SetArgs(tt.args)
+			root.SetOut(io.Discard)
+			root.SetErr(io.Discard)
+
+			assert.Equal(t, tt.code, exitCode(root.Execute()))
+		})
+	}
+}
+
+// testServicePlugins creates every service with its default config
+func testServicePlugins(t *testing.T, db *gorm.DB) []ServicePlugin {
+	plugins, err := newServicePlugins(db, defaultServiceConfigs(), core.NewFlushRegistry(), core.NewScheduler())
+	require.NoError(t, err)
+	return plugins
+}
+
+// newBackupDeployment returns backup services over a fresh database with its own master password
+func newBackupDeployment(t *testing.T, masterPassword string) (*backupServices, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	plugins := testServicePlugins(t, db)
+	require.NoError(t, migrateSchemas(db, plugins))
+
+	backup, err := newBackupServices(serviceInstances(plugins))
+	require.NoError(t, err)
+	backup.vault.SetMasterPassword(masterPassword)
+	return backup, db
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	t.Setenv("VERTEX_ARTIFACT_DIR", t.TempDir())
+
+	source, _ := newBackupDeployment(t, "source-password")
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, source.vault.StoreSecret(ctx, "user1", &vault.Secret{Key: "db-password", Value: "hunter2", Tags: vault.StringSlice{"prod"}, ExpiresAt: &expiresAt}))
+	require.NoError(t, source.flow.CreateEnvironment(ctx, &flow.Environment{Name: "production", UserID: "user1", Variables: flow.JSONMap{"region": "eu-west-1"}, Secrets: map[string]string{"DB_PASSWORD": "db-password"}}))
+	workflow := &flow.Workflow{
+		Name:        "Deploy",
+		UserID:      "user1",
+		Environment: "production",
+		Steps: []flow.WorkflowStep{
+			{Name: "build", Order: 1},
+			{Name: "release", Order: 2},
+		},
+	}
+	require.NoError(t, source.flow.CreateWorkflow(ctx, workflow))
+	workflow.Steps[1].DependsOn = []uint{workflow.Steps[0].ID}
+	require.NoError(t, source.flow.UpdateWorkflow(ctx, "user1", workflow))
+	require.NoError(t, source.task.CreateTask(ctx, &task.Task{Name: "backup", Type: "shell", UserID: "user1"}))
+	integration := &hub.Integration{Name: "slack", Type: "slack", UserID: "user1", Config: map[string]string{"channel": "#ops", "token": "xoxb-token"}}
+	require.NoError(t, source.hub.CreateIntegration(ctx, integration))
+	require.NoError(t, source.monitor.CreateAlert(ctx, &monitor.Alert{Name: "High CPU", UserID: "user1", Condition: "cpu > 90", OnTriggerWorkflowID: workflow.ID, IntegrationID: integration.ID}))
+	require.NoError(t, source.sync.CreateSyncJob(ctx, &syncservice.SyncJob{Name: "Mirror", UserID: "user1", Source: "file:///a", Destination: "file:///b", Concurrency: 4, SourceCredentials: "source-creds", DestinationCredentials: "destination-creds"}))
+
+	var archive bytes.Buffer
+	require.NoError(t, source.Export(ctx, "user1", "backup-passphrase", &archive))
+
+	t.Run("should not write integration credentials in plaintext", func(t *testing.T) {
+		_, contents, err := readBackup(bytes.NewReader(archive.Bytes()))
+		require.NoError(t, err)
+		assert.NotContains(t, string(contents["integrations.json"]), "xoxb-token")
+	})
+
+	t.Run("should restore resources and relationships into another deployment", func(t *testing.T) {
+		target, _ := newBackupDeployment(t, "target-password")
+		// Offset IDs so the import has to remap references
+		require.NoError(t, target.flow.CreateWorkflow(ctx, &flow.Workflow{Name: "Existing", UserID: "user2", Steps: []flow.WorkflowStep{{Name: "a", Order: 1}, {Name: "b", Order: 2}}}))
+		require.NoError(t, target.hub.CreateIntegration(ctx, &hub.Integration{Name: "existing", Type: "webhook", UserID: "user2"}))
+
+		imported, err := target.Import(ctx, "user1", "backup-passphrase", bytes.NewReader(archive.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"secrets": 1, "environments": 1, "workflows": 1, "tasks": 1, "alerts": 1, "sync_jobs": 1, "integrations": 1}, imported)
+
+		secret, err := target.vault.GetSecret(ctx, "user1", "db-password")
+		require.NoError(t, err)
+		assert.Equal(t, "hunter2", secret.Value)
+		assert.Equal(t, vault.StringSlice{"prod"}, secret.Tags)
+		require.NotNil(t, secret.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*secret.ExpiresAt))
+
+		env, err := target.flow.GetEnvironment(ctx, "user1", "production")
+		require.NoError(t, err)
+		assert.Equal(t, flow.JSONMap{"region": "eu-west-1"}, env.Variables)
+		assert.Equal(t, map[string]string{"DB_PASSWORD": "db-password"}, env.Secrets)
+
+		workflows, err := target.flow.ListWorkflows(ctx, "user1")
+		require.NoError(t, err)
+		require.Len(t, workflows, 1)
+		restored := workflows[0]
+		assert.NotEqual(t, workflow.ID, restored.ID)
+		assert.Equal(t, "production", restored.Environment)
+		require.Len(t, restored.Steps, 2)
+		assert.Equal(t, []uint{restored.Steps[0].ID}, restored.Steps[1].DependsOn)
+
+		alerts, err := target.monitor.GetAlerts(ctx, "user1")
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, restored.ID, alerts[0].OnTriggerWorkflowID)
+
+		jobs, err := target.sync.GetSyncJobs(ctx, "user1")
+		require.NoError(t, err)
+		require.Len(t, jobs, 1)
+		assert.Equal(t, 4, jobs[0].Concurrency)
+		assert.Equal(t, "source-creds", jobs[0].SourceCredentials)
+		assert.Equal(t, "destination-creds", jobs[0].DestinationCredentials)
+
+		integrations, err := target.hub.GetIntegrations(ctx, "user1")
+		require.NoError(t, err)
+		require.Len(t, integrations, 1)
+		assert.Equal(t, map[string]string{"channel": "#ops", "token": "xoxb-token"}, integrations[0].Config)
+		assert.NotEqual(t, integration.ID, integrations[0].ID)
+		assert.Equal(t, integrations[0].ID, alerts[0].IntegrationID)
+	})
+
+	t.Run("should reject a wrong passphrase without importing", func(t *testing.T) {
+		target, db := newBackupDeployment(t, "target-password")
+
+		_, err := target.Import(ctx, "user1", "wrong-passphrase", bytes.NewReader(archive.Bytes()))
+		assert.ErrorIs(t, err, vault.ErrWrongPassphrase)
+
+		var count int64
+		require.NoError(t, db.Model(&vault.Secret{}).Count(&count).Error)
+		assert.Zero(t, count)
+		require.NoError(t, db.Model(&hub.Integration{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("should reject archives whose checksums do not match", func(t *testing.T) {
+		target, _ := newBackupDeployment(t, "target-password")
+
+		gz, err := gzip.NewReader(bytes.NewReader(archive.Bytes()))
+		require.NoError(t, err)
+		var tampered bytes.Buffer
+		gzw := gzip.NewWriter(&tampered)
+		tw := tar.NewWriter(gzw)
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			if header.Name == "tasks.json" {
+				data = bytes.Replace(data, []byte("backup"), []byte("rm -rf"), 1)
+				header.Size = int64(len(data))
+			}
+			require.NoError(t, tw.WriteHeader(header))
+			_, err = tw.Write(data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gzw.Close())
+
+		_, err = target.Import(ctx, "user1", "backup-passphrase", &tampered)
+		assert.ErrorIs(t, err, errInvalidBackup)
+		assert.ErrorContains(t, err, "checksum mismatch for tasks.json")
+	})
+
+	t.Run("should reject archives whose files are too large", func(t *testing.T) {
+		target, _ := newBackupDeployment(t, "target-password")
+
+		// Only the header is written: its size alone must be refused
+		var oversized bytes.Buffer
+		gzw := gzip.NewWriter(&oversized)
+		tw := tar.NewWriter(gzw)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "tasks.json", Mode: 0o600, Size: maxBackupContentBytes + 1}))
+		require.NoError(t, gzw.Close())
+
+		_, err := target.Import(ctx, "user1", "backup-passphrase", &oversized)
+		assert.ErrorIs(t, err, errInvalidBackup)
+		assert.ErrorContains(t, err, "files exceed")
+	})
+}
+
+func TestReadiness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	t.Setenv("VERTEX_ARTIFACT_DIR", t.TempDir())
+
+	healthyDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	downDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := downDB.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	readyz := func(plugins []ServicePlugin, name string) (int, core.HealthStatus) {
+		plugin, err := findPlugin(plugins, name)
+		require.NoError(t, err)
+		router := gin.New()
+		addReadinessRoute(router, name, serviceInstance(plugin))
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var status core.HealthStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+		return rec.Code, status
+	}
+
+	healthy := testServicePlugins(t, healthyDB)
+	down := testServicePlugins(t, downDB)
+
+	t.Run("should report not ready when the database is down", func(t *testing.T) {
+		code, status := readyz(down, "vault")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.False(t, status.Healthy)
+		assert.Equal(t, "Not ready: vault unhealthy", status.Message)
+	})
+
+	t.Run("should keep the gateway ready since it has no external dependencies", func(t *testing.T) {
+		code, status := readyz(down, "api-gateway")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, status.Healthy)
+	})
+
+	t.Run("should report ready when the database is reachable", func(t *testing.T) {
+		for _, name := range []string{"vault", "flow", "task", "monitor", "sync", "insight", "hub"} {
+			code, _ := readyz(healthy, name)
+			assert.Equal(t, http.StatusOK, code, name)
+		}
+	})
+}
+
+func TestCheckServicesHealth(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	degraded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer degraded.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	services := []serviceHealthTarget{
+		{"healthy", healthy.URL},
+		{"degraded", degraded.URL},
+		{"slow-1", slow.URL},
+		{"slow-2", slow.URL},
+		{"down", down.URL},
+	}
+
+	start := time.Now()
+	statuses := checkServicesHealth(context.Background(), services, 200*time.Millisecond)
+	elapsed := time.Since(start)
+
+	assert.Equal(t, []string{
+		healthStatusHealthy,
+		healthStatusDegraded,
+		healthStatusTimeout,
+		healthStatusTimeout,
+		healthStatusUnhealthy,
+	}, statuses)
+	// Checks run concurrently, so two slow services cost a single deadline
+	assert.Less(t, elapsed, time.Second)
+}
+
+func TestWorkflowServiceStep(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&vault.Secret{}, &vault.SecretGrant{}, &vault.AuditLog{}, &vault.KeySalt{}, &flow.Workflow{}, &flow.WorkflowStep{}, &flow.WorkflowExecution{}, &flow.StepExecution{}))
+
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	vaultService := vault.NewService(vault.NewEnvKeyProvider())
+	vaultService.SetDB(db)
+	router := gin.New()
+	addVaultRoutes(router.Group("/api/v1"), vaultService)
+	vaultServer := httptest.NewServer(router)
+	defer vaultServer.Close()
+
+	gatewayService := apigateway.NewService()
+	host, port, err := net.SplitHostPort(vaultServer.Listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	require.NoError(t, gatewayService.RegisterInstance(&apigateway.ServiceInstance{ServiceName: "vault", Address: host, Port: portNumber}))
+
+	flowService := flow.NewService()
+	flowService.SetDB(db)
+	flowService.SetServiceCaller(&gatewayServiceCaller{service: gatewayService})
+
+	workflow := &flow.Workflow{Name: "Rotate", UserID: "user1", Steps: []flow.WorkflowStep{{
+		Name: "store", Type: flow.StepTypeService, Order: 1,
+		Config: flow.JSONMap{"service": "vault", "method": "POST", "path": "/api/v1/secrets",
+			"body": map[string]interface{}{"key": "db-password", "value": "hunter2"}},
+	}}}
+	require.NoError(t, flowService.CreateWorkflow(ctx, workflow))
+	execution, err := flowService.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+	require.NoError(t, err)
+
+	stepExecution, err := flowService.RunStep(ctx, execution, &workflow.Steps[0], nil)
+	require.NoError(t, err)
+	result, err := stepExecution.Result()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, result.HTTPStatus)
+
+	// The secret was stored as the workflow's user
+	secret, err := vaultService.GetUserSecret(ctx, "user1", "db-password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", secret.Value)
+	_, err = vaultService.GetUserSecret(ctx, "user2", "db-password")
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	writeConfig := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "vertex.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("should use the defaults without a config file", func(t *testing.T) {
+		configs, err := loadConfigFile("")
+		require.NoError(t, err)
+		assert.Equal(t, defaultServiceConfigs(), configs)
+	})
+
+	t.Run("should read service configs and apply environment overrides", func(t *testing.T) {
+		path := writeConfig(t, "services:\n  task: {workers: 4, stale_after: 2m}\n  flow: {retry_delay: 5s}\n  vault: {master_key_source: file, master_key_file: /run/secrets/key}\n  auth: {enabled: true}\n")
+		t.Setenv("VERTEX_TASK_WORKERS", "8")
+		t.Setenv("VERTEX_ALERT_GROUP_BY", "name,user_id")
+
+		configs, err := loadConfigFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 8, configs.Task.Workers)
+		assert.Equal(t, 2*time.Minute, configs.Task.StaleAfter)
+		assert.Equal(t, 5*time.Second, configs.Flow.RetryDelay)
+		assert.Equal(t, "/run/secrets/key", configs.Vault.MasterKeyFile)
+		assert.Equal(t, []string{"name", "user_id"}, configs.Monitor.Notifications.GroupBy)
+		assert.Equal(t, hub.DefaultConfig(), configs.Hub)
+		assert.True(t, configs.Auth.Enabled)
+		assert.Equal(t, core.DefaultServiceTokenTTL, configs.Auth.TokenTTL)
+	})
+
+	t.Run("should reject invalid service configs", func(t *testing.T) {
+		_, err := loadConfigFile(writeConfig(t, "services:\n  task: {workers: -1}\n"))
+		assert.ErrorContains(t, err, "invalid task config: workers must not be negative")
+
+		_, err = loadConfigFile(writeConfig(t, "services:\n  vault: {master_key_source: file}\n"))
+		assert.ErrorContains(t, err, "invalid vault config: master key file is required")
+
+		_, err = loadConfigFile(writeConfig(t, "services:\n  auth: {enabled: true, token_ttl: 0s}\n"))
+		assert.ErrorContains(t, err, "invalid service auth config: service token TTL must be positive")
+
+		t.Setenv("VERTEX_STEP_RETRY_DELAY", "soon")
+		_, err = loadConfigFile("")
+		assert.ErrorContains(t, err, "invalid VERTEX_STEP_RETRY_DELAY")
+	})
+}
+
+func TestListPagination(t *testing.T) {
+	router, service := setupMonitorRouter(t)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, service.CreateMetric(context.Background(), &monitor.Metric{ServiceName: "api", Name: "requests", Value: float64(i)}))
+	}
+
+	path := filepath.Join(t.TempDir(), "vertex.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("pagination:\n  endpoints:\n    metrics: {default: 1, max: 2}\n"), 0o600))
+	t.Cleanup(func() { require.NoError(t, core.SetPaginationConfig(core.DefaultPaginationConfig())) })
+	_, err := loadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, core.PageLimits{Default: 20, Max: 100}, core.PageLimitsFor("search"))
+
+	list := func(query string) (*httptest.ResponseRecorder, []*monitor.Metric, int) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/api?"+query, nil))
+		var resp struct {
+			Metrics  []*monitor.Metric `json:"metrics"`
+			PageSize int               `json:"page_size"`
+			Total    int               `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, 3, resp.Total)
+		return rec, resp.Metrics, resp.PageSize
+	}
+
+	t.Run("should use the configured default page size", func(t *testing.T) {
+		rec, metrics, pageSize := list("")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, metrics, 1)
+		assert.Equal(t, 1, pageSize)
+	})
+
+	t.Run("should clamp an over-limit request to the configured maximum", func(t *testing.T) {
+		rec, metrics, pageSize := list("limit=1000000")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, metrics, 2)
+		assert.Equal(t, 2, pageSize)
+		assert.Contains(t, rec.Header().Get("Warning"), "clamped")
+	})
+}
+
+func TestShutdownFlush(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("VERTEX_ARTIFACT_DIR", t.TempDir())
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	flushes := core.NewFlushRegistry()
+	plugins, err := newServicePlugins(db, defaultServiceConfigs(), flushes, core.NewScheduler())
+	require.NoError(t, err)
+	require.NoError(t, migrateSchemas(db, plugins))
+
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer server.Close()
+
+	hubPlugin, err := findPlugin(plugins, "hub")
+	require.NoError(t, err)
+	hubService := serviceInstance(hubPlugin).(*hub.Service)
+	integration := &hub.Integration{Name: "Ops hook", UserID: "user1", Type: "webhook", Config: map[string]string{"url": server.URL}, DigestWindow: time.Hour}
+	require.NoError(t, hubService.CreateIntegration(ctx, integration))
+	require.NoError(t, hubService.Notify(ctx, "user1", integration.ID, &hub.Event{Type: "deploy", Title: "Deployed api"}))
+	assert.Zero(t, received, "the event is buffered into a digest")
+
+	flushBuffers(flushes)
+	assert.Equal(t, 1, received)
+	deliveries, err := hubService.ListDeliveries(ctx, "user1", integration.ID)
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 1, "the buffered event is persisted as a delivery")
+}
+
+func TestAlertIntegrationDispatch(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("VERTEX_ARTIFACT_DIR", t.TempDir())
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	plugins, err := newServicePlugins(db, defaultServiceConfigs(), core.NewFlushRegistry(), core.NewScheduler())
+	require.NoError(t, err)
+	require.NoError(t, migrateSchemas(db, plugins))
+	instances := serviceInstances(plugins)
+	hubService := instances["hub"].(*hub.Service)
+	monitorService := instances["monitor"].(*monitor.Service)
+
+	var payloads []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err == nil {
+			payloads = append(payloads, payload)
+		}
+	}))
+	defer server.Close()
+
+	integration := &hub.Integration{Name: "Ops channel", UserID: "user1", Type: "slack", Config: map[string]string{"url": server.URL}}
+	require.NoError(t, hubService.CreateIntegration(ctx, integration))
+	alert := &monitor.Alert{Name: "High CPU", UserID: "user1", Condition: "cpu_usage > 80", IntegrationID: integration.ID}
+	require.NoError(t, monitorService.CreateAlert(ctx, alert))
+	require.NoError(t, monitorService.CreateMetric(ctx, &monitor.Metric{ServiceName: "api", Name: "cpu_usage", Value: 95, Timestamp: time.Now()}))
+
+	require.NoError(t, monitorService.EvaluateAlerts(ctx))
+	require.NoError(t, monitorService.EvaluateAlerts(ctx))
+	require.Len(t, payloads, 1, "the alert is notified once while it stays firing")
+	assert.Contains(t, payloads[0], "blocks", "the slack integration receives a slack payload")
+
+	deliveries, err := hubService.ListDeliveries(ctx, "user1", integration.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "alert.firing", deliveries[0].EventType)
+}
+
+func TestReportQueryCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("VERTEX_ARTIFACT_DIR", t.TempDir())
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	plugins := testServicePlugins(t, db)
+	require.NoError(t, migrateSchemas(db, plugins))
+	instances := serviceInstances(plugins)
+	vaultService := instances["vault"].(*vault.Service)
+	insightService := instances["insight"].(*insight.Service)
+
+	report := &insight.Report{Name: "Secret activity", UserID: "user1", Type: "audit"}
+	require.NoError(t, insightService.CreateReport(ctx, report))
+	current := insight.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}
+	previous := insight.TimeRange{From: current.From.Add(-time.Hour), To: current.From}
+	compare := func() int64 {
+		comparison, err := insightService.CompareReport(ctx, "user1", report.ID, current, previous)
+		require.NoError(t, err)
+		return comparison.Total.Current
+	}
+
+	assert.Zero(t, compare())
+	assert.Zero(t, compare())
+	assert.Equal(t, int64(2), insightService.QueryCacheStats().Hits)
+
+	// A vault write announces its audit entry, dropping the cached results
+	require.NoError(t, vaultService.StoreSecret(ctx, "user1", &vault.Secret{Key: "db-password", Value: "hunter2"}))
+	assert.Equal(t, int64(1), compare())
+
+	router := gin.New()
+	addInsightRoutes(router.Group("/api/v1"), insightService)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/reports/cache/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		QueryCache insight.QueryCacheStats `json:"query_cache"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, insightService.QueryCacheStats(), body.QueryCache)
+}
+
+func TestWebhookReceiveEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&hub.Integration{}))
+	service := hub.NewService()
+	service.SetDB(db)
+	router := gin.New()
+	addHubRoutes(router.Group("/api/v1"), service)
+	integration := &hub.Integration{Name: "Inbound", UserID: "user1", Type: "github", Config: map[string]string{"secret": "gh"}}
+	require.NoError(t, service.CreateIntegration(context.Background(), integration))
+
+	body := `{"action":"opened"}`
+	mac := hmac.New(sha256.New, []byte("gh"))
+	mac.Write([]byte(body))
+	serve := func(signature, delivery string) int {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/integrations/%d/webhook", integration.ID), strings.NewReader(body))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		req.Header.Set("X-GitHub-Delivery", delivery)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	assert.Equal(t, http.StatusNoContent, serve(signature, "delivery-1"))
+	assert.Equal(t, http.StatusConflict, serve(signature, "delivery-2"), "a new delivery ID does not make a replay new")
+	assert.Equal(t, http.StatusUnauthorized, serve("sha256=00", "delivery-3"))
+}
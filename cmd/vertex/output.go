@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// streamOutput re-encodes a JSON document from r to w in the given format without
+// holding the whole document in memory. Arrays are written one element at a time,
+// so memory is bounded by the largest element rather than the response size.
+func streamOutput(r io.Reader, w io.Writer, format string) error {
+	dec := json.NewDecoder(r)
+	out := bufio.NewWriter(w)
+
+	var err error
+	if format == "yaml" {
+		err = streamYAML(dec, out)
+	} else {
+		dec.UseNumber()
+		err = streamJSON(dec, out)
+		if err == nil {
+			err = out.WriteByte('\n')
+		}
+	}
+	if err != nil {
+		out.Flush()
+		return err
+	}
+	return out.Flush()
+}
+
+// streamJSON copies one JSON value token by token, writing it compactly
+func streamJSON(dec *json.Decoder, w *bufio.Writer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return writeJSONScalar(w, tok)
+	}
+
+	w.WriteRune(rune(delim))
+	object := delim == '{'
+	for first := true; dec.More(); first = false {
+		if !first {
+			w.WriteByte(',')
+		}
+		if object {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := writeJSONScalar(w, key); err != nil {
+				return err
+			}
+			w.WriteByte(':')
+		}
+		if err := streamJSON(dec, w); err != nil {
+			return err
+		}
+	}
+
+	end, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteRune(rune(end.(json.Delim)))
+	return err
+}
+
+func writeJSONScalar(w *bufio.Writer, tok json.Token) error {
+	if number, ok := tok.(json.Number); ok {
+		_, err := w.WriteString(number.String())
+		return err
+	}
+	encoded, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// streamYAML writes a top-level JSON value as YAML. Objects are walked key by key
+// so list responses such as {"workflows": [...]} stream their items.
+func streamYAML(dec *json.Decoder, w *bufio.Writer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return writeYAML(w, tok, "")
+	}
+	if delim == '[' {
+		return streamYAMLArray(dec, w, "")
+	}
+	return streamYAMLObject(dec, w, "")
+}
+
+func streamYAMLObject(dec *json.Decoder, w *bufio.Writer, indent string) error {
+	empty := true
+	for dec.More() {
+		empty = false
+		keyTok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := keyTok.(string)
+
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, ok := tok.(json.Delim)
+		switch {
+		case !ok:
+			err = writeYAML(w, map[string]interface{}{key: tok}, indent)
+		case !dec.More():
+			// Empty containers are written inline, e.g. "items: []"
+			if _, err = dec.Token(); err == nil {
+				inline := map[string]interface{}{key: map[string]interface{}{}}
+				if delim == '[' {
+					inline[key] = []interface{}{}
+				}
+				err = writeYAML(w, inline, indent)
+			}
+		case delim == '[':
+			if err = writeYAMLKey(w, key, indent); err == nil {
+				err = streamYAMLArray(dec, w, indent)
+			}
+		default:
+			if err = writeYAMLKey(w, key, indent); err == nil {
+				err = streamYAMLObject(dec, w, indent+"  ")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if empty && indent == "" {
+		w.WriteString("{}\n")
+	}
+
+	_, err := dec.Token()
+	return err
+}
+
+func streamYAMLArray(dec *json.Decoder, w *bufio.Writer, indent string) error {
+	empty := true
+	for dec.More() {
+		empty = false
+		var item interface{}
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		if err := writeYAMLItem(w, item, indent); err != nil {
+			return err
+		}
+	}
+	if empty && indent == "" {
+		w.WriteString("[]\n")
+	}
+
+	_, err := dec.Token()
+	return err
+}
+
+// writeYAMLItem writes one element of a YAML sequence
+func writeYAMLItem(w *bufio.Writer, item interface{}, indent string) error {
+	encoded, err := yaml.Marshal(item)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n")
+	for i, line := range lines {
+		prefix := indent + "  "
+		if i == 0 {
+			prefix = indent + "- "
+		}
+		w.WriteString(prefix + line + "\n")
+	}
+	return nil
+}
+
+func writeYAMLKey(w *bufio.Writer, key, indent string) error {
+	encoded, err := yaml.Marshal(key)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteString(indent + strings.TrimSuffix(string(encoded), "\n") + ":\n")
+	return err
+}
+
+func writeYAML(w *bufio.Writer, value interface{}, indent string) error {
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.SplitAfter(string(encoded), "\n") {
+		if line != "" {
+			w.WriteString(indent + line)
+		}
+	}
+	return nil
+}
+
+// streamRequest performs a request and streams the response body to w in the given format
+func streamRequest(method, url, format string, w io.Writer) error {
+	resp, err := doRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := bufio.NewReader(resp.Body)
+	if _, err := body.Peek(1); errors.Is(err, io.EOF) {
+		return nil
+	}
+	return streamOutput(body, w, format)
+}
+
+// listPageSize is the page size list commands ask for; servers clamp it to
+// their own maximum
+const listPageSize = 1000
+
+// streamPages fetches every page of a paginated list, whose items each response
+// holds under key, and writes them to w in the given format as one list with
+// its total. Pages are written as they arrive, so memory is bounded by the
+// page size rather than the length of the list.
+func streamPages(listURL, key, format string, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	total := 0
+	for page := 1; ; page++ {
+		resp, err := makeRequest("GET", pageURL(listURL, page), nil)
+		if err != nil {
+			return err
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(resp), &body); err != nil {
+			return fmt.Errorf("failed to read page %d: %w", page, err)
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(body[key], &items); err != nil {
+			return fmt.Errorf("failed to read page %d: %w", page, err)
+		}
+		var listed int
+		json.Unmarshal(body["total"], &listed)
+
+		if page == 1 {
+			if err := writeListStart(out, key, format, len(items) == 0); err != nil {
+				return err
+			}
+		}
+		for _, item := range items {
+			if err := writeListItem(out, item, format, total == 0); err != nil {
+				return err
+			}
+			total++
+		}
+		if len(items) == 0 || total >= listed {
+			break
+		}
+	}
+	return writeListEnd(out, format, total)
+}
+
+// pageURL returns listURL asking for one page of listPageSize items
+func pageURL(listURL string, page int) string {
+	parsed, err := url.Parse(listURL)
+	if err != nil {
+		return listURL
+	}
+	query := parsed.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(listPageSize))
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+func writeListStart(w *bufio.Writer, key, format string, empty bool) error {
+	if format == "yaml" {
+		if empty {
+			return writeYAML(w, map[string]interface{}{key: []interface{}{}}, "")
+		}
+		return writeYAMLKey(w, key, "")
+	}
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteString("{" + string(encoded) + ":[")
+	return err
+}
+
+func writeListItem(w *bufio.Writer, item json.RawMessage, format string, first bool) error {
+	if format == "yaml" {
+		var value interface{}
+		if err := json.Unmarshal(item, &value); err != nil {
+			return err
+		}
+		return writeYAMLItem(w, value, "")
+	}
+	if !first {
+		w.WriteByte(',')
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, item); err != nil {
+		return err
+	}
+	_, err := w.Write(compact.Bytes())
+	return err
+}
+
+func writeListEnd(w *bufio.Writer, format string, total int) error {
+	if format == "yaml" {
+		return writeYAML(w, map[string]interface{}{"total": total}, "")
+	}
+	_, err := fmt.Fprintf(w, "],\"total\":%d}\n", total)
+	return err
+}
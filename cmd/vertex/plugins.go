@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ataiva-software/vertex/internal/api-gateway"
+	"github.com/ataiva-software/vertex/internal/flow"
+	"github.com/ataiva-software/vertex/internal/hub"
+	"github.com/ataiva-software/vertex/internal/insight"
+	"github.com/ataiva-software/vertex/internal/monitor"
+	syncservice "github.com/ataiva-software/vertex/internal/sync"
+	"github.com/ataiva-software/vertex/internal/task"
+	"github.com/ataiva-software/vertex/internal/vault"
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServicePlugin wires a service into the binary. Adding a service means adding a
+// plugin to newServicePlugins; migrations, routes and ports are driven from it.
+type ServicePlugin interface {
+	Name() string
+	Models() []interface{}
+	RegisterRoutes(v1 *gin.RouterGroup)
+	DefaultPort() int
+}
+
+// servicePlugin adapts an internal service to ServicePlugin
+type servicePlugin struct {
+	name     string
+	port     int
+	models   []interface{}
+	instance interface{}
+	routes   func(v1 *gin.RouterGroup)
+}
+
+func (p *servicePlugin) Name() string          { return p.name }
+func (p *servicePlugin) Models() []interface{} { return p.models }
+func (p *servicePlugin) DefaultPort() int      { return p.port }
+
+func (p *servicePlugin) RegisterRoutes(v1 *gin.RouterGroup) {
+	if p.routes != nil {
+		p.routes(v1)
+	}
+}
+
+// gatewayPlugin serves the gateway's own routes plus the routes of every mounted
+// plugin, so the web portal can reach all services through one port
+type gatewayPlugin struct {
+	servicePlugin
+	mounted []ServicePlugin
+}
+
+func (p *gatewayPlugin) mount(plugins []ServicePlugin) {
+	p.mounted = plugins
+}
+
+func (p *gatewayPlugin) RegisterRoutes(v1 *gin.RouterGroup) {
+	p.servicePlugin.RegisterRoutes(v1)
+	if len(p.mounted) == 0 {
+		return
+	}
+
+	for _, plugin := range p.mounted {
+		if plugin != ServicePlugin(p) {
+			plugin.RegisterRoutes(v1)
+		}
+	}
+	instances := serviceInstances(p.mounted)
+	addSearchRoutes(v1, instances)
+	addOverviewRoutes(v1, instances)
+	addBackupRoutes(v1, instances)
+}
+
+// newServicePlugins creates every service from its config and wires the
+// services to each other. Services buffering data in memory register their
+// flush hooks with flushes, and every service's periodic work, such as
+// reaping stale tasks and flushing alert notifications, runs on scheduler.
+func newServicePlugins(db *gorm.DB, configs serviceConfigs, flushes *core.FlushRegistry, scheduler *core.Scheduler) ([]ServicePlugin, error) {
+	// events carries status changes between services, e.g. to pause features
+	// that notify through a disabled integration, and announces writes to
+	// data reports are cached from
+	events := core.NewEventBus()
+	events.Subscribe(core.TopicIntegrationDisabled, func(ctx context.Context, event core.BusEvent) {
+		if payload, ok := event.Payload.(core.IntegrationStatusEvent); ok {
+			log.Printf("⏸️  Integration %d (%s) disabled; notifications through it are paused", payload.IntegrationID, payload.Name)
+		}
+	})
+
+	// Caps JSON columns such as workflow variables and task configs
+	if size, _ := strconv.Atoi(os.Getenv("VERTEX_MAX_JSON_SIZE")); size > 0 {
+		core.SetMaxJSONSize(size)
+	}
+
+	gatewayService, err := apigateway.NewServiceWithConfig(configs.Gateway)
+	if err != nil {
+		return nil, err
+	}
+	gatewayService.SetScheduler(scheduler)
+	serviceAuth, err := configs.Auth.NewServiceAuth()
+	if err != nil {
+		return nil, err
+	}
+	gatewayService.SetServiceAuth(serviceAuth)
+
+	vaultService, err := vault.NewServiceWithConfig(configs.Vault)
+	if err != nil {
+		return nil, err
+	}
+	vaultService.SetDB(db)
+	vaultService.SetScheduler(scheduler)
+	vaultService.SetEventBus(events)
+
+	flowService, err := flow.NewServiceWithConfig(configs.Flow)
+	if err != nil {
+		return nil, err
+	}
+	flowService.SetDB(db)
+	if store, err := newArtifactStore(); err != nil {
+		log.Printf("⚠️  Artifact storage disabled: %v", err)
+	} else {
+		flowService.SetArtifactStore(store)
+	}
+	flowService.SetSecretStore(&vaultSecretStore{service: vaultService})
+	flowService.SetStepRunner(flow.NewExecRunner())
+	flowService.SetScheduler(scheduler)
+
+	taskService, err := task.NewServiceWithConfig(configs.Task)
+	if err != nil {
+		return nil, err
+	}
+	taskService.SetDB(db)
+	taskService.SetScheduler(scheduler)
+
+	monitorService, err := monitor.NewServiceWithConfig(configs.Monitor)
+	if err != nil {
+		return nil, err
+	}
+	monitorService.SetDB(db)
+	monitorService.SetScheduler(scheduler)
+	monitorService.SetWorkflowTrigger(&flowWorkflowTrigger{service: flowService})
+	monitorService.SetFlushRegistry(flushes)
+
+	syncService, err := syncservice.NewServiceWithConfig(configs.Sync)
+	if err != nil {
+		return nil, err
+	}
+	syncService.SetDB(db)
+	syncService.SetSecretStore(&vaultSecretStore{service: vaultService})
+	syncService.SetScheduler(scheduler)
+
+	insightService, err := insight.NewServiceWithConfig(configs.Insight)
+	if err != nil {
+		return nil, err
+	}
+	insightService.SetDB(db)
+	insightService.SetEventBus(events)
+	insightService.SetScheduler(scheduler)
+
+	hubService, err := hub.NewServiceWithConfig(configs.Hub)
+	if err != nil {
+		return nil, err
+	}
+	hubService.SetDB(db)
+	hubService.SetEventBus(events)
+	hubService.SetFlushRegistry(flushes)
+	monitorService.SetIntegrationNotifier(&hubAlertNotifier{service: hubService})
+	monitorService.SetEventBus(events)
+
+	plugins := []ServicePlugin{
+		&gatewayPlugin{servicePlugin: servicePlugin{
+			name:     "api-gateway",
+			port:     8000,
+			models:   []interface{}{&apigateway.RouteRecord{}, &apigateway.InstanceRecord{}},
+			instance: gatewayService,
+			routes:   func(v1 *gin.RouterGroup) { addAPIGatewayRoutes(v1, gatewayService) },
+		}},
+		&servicePlugin{
+			name:     "vault",
+			port:     8080,
+			models:   []interface{}{&vault.Secret{}, &vault.SecretVersion{}, &vault.SecretGrant{}, &vault.AuditLog{}, &vault.KeySalt{}},
+			instance: vaultService,
+			routes:   func(v1 *gin.RouterGroup) { addVaultRoutes(v1, vaultService) },
+		},
+		&servicePlugin{
+			name:     "flow",
+			port:     8081,
+			models:   []interface{}{&flow.Workflow{}, &flow.WorkflowExecution{}, &flow.WorkflowStep{}, &flow.StepExecution{}, &flow.WorkflowTemplate{}, &flow.Artifact{}, &flow.Environment{}},
+			instance: flowService,
+			routes:   func(v1 *gin.RouterGroup) { addFlowRoutes(v1, flowService) },
+		},
+		&servicePlugin{
+			name:     "task",
+			port:     8082,
+			models:   []interface{}{&task.Task{}},
+			instance: taskService,
+			routes:   func(v1 *gin.RouterGroup) { addTaskRoutes(v1, taskService) },
+		},
+		&servicePlugin{
+			name:     "monitor",
+			port:     8083,
+			models:   []interface{}{&monitor.Metric{}, &monitor.Alert{}, &monitor.MetricRollup{}, &monitor.MetricRollupWatermark{}},
+			instance: monitorService,
+			routes:   func(v1 *gin.RouterGroup) { addMonitorRoutes(v1, monitorService) },
+		},
+		&servicePlugin{
+			name:     "sync",
+			port:     8084,
+			models:   []interface{}{&syncservice.SyncJob{}, &syncservice.SyncedObject{}},
+			instance: syncService,
+			routes:   func(v1 *gin.RouterGroup) { addSyncRoutes(v1, syncService) },
+		},
+		&servicePlugin{
+			name:     "insight",
+			port:     8085,
+			models:   []interface{}{&insight.Report{}},
+			instance: insightService,
+			routes:   func(v1 *gin.RouterGroup) { addInsightRoutes(v1, insightService) },
+		},
+		&servicePlugin{
+			name:     "hub",
+			port:     8086,
+			models:   []interface{}{&hub.Integration{}, &hub.WebhookDelivery{}},
+			instance: hubService,
+			routes:   func(v1 *gin.RouterGroup) { addHubRoutes(v1, hubService) },
+		},
+	}
+
+	// Workflow service steps reach the other services through the gateway's
+	// discovery and circuit breaking, at their default ports on this host
+	// unless VERTEX_SERVICE_HOST points elsewhere
+	host := getEnv("VERTEX_SERVICE_HOST", "localhost")
+	for _, plugin := range plugins {
+		if plugin.Name() == "api-gateway" {
+			continue
+		}
+		instance := &apigateway.ServiceInstance{ID: plugin.Name() + "-default", ServiceName: plugin.Name(), Address: host, Port: plugin.DefaultPort()}
+		if err := gatewayService.RegisterInstance(instance); err != nil {
+			log.Printf("⚠️  Failed to register %s with the gateway: %v", plugin.Name(), err)
+		}
+	}
+	flowService.SetServiceCaller(&gatewayServiceCaller{service: gatewayService})
+
+	// Persisting the registry lets routes and instances survive restarts and be
+	// shared by gateway replicas; the defaults above stay local to each process
+	if os.Getenv("VERTEX_GATEWAY_REGISTRY") == "database" {
+		gatewayService.SetDB(db)
+	}
+
+	return plugins, nil
+}
+
+func findPlugin(plugins []ServicePlugin, name string) (ServicePlugin, error) {
+	for _, plugin := range plugins {
+		if plugin.Name() == name {
+			return plugin, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown service '%s'", name)
+}
+
+func migrateSchemas(db *gorm.DB, plugins []ServicePlugin) error {
+	for _, plugin := range plugins {
+		models := plugin.Models()
+		if len(models) == 0 {
+			continue
+		}
+		if err := db.AutoMigrate(models...); err != nil {
+			return fmt.Errorf("%s migration failed: %w", plugin.Name(), err)
+		}
+		if migrator, ok := serviceInstance(plugin).(schemaMigrator); ok {
+			if err := migrator.MigrateSchema(db); err != nil {
+				return fmt.Errorf("%s migration failed: %w", plugin.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// schemaMigrator is implemented by services whose schema changes need more
+// than AutoMigrate, such as dropping a replaced index
+type schemaMigrator interface {
+	MigrateSchema(db *gorm.DB) error
+}
+
+// serviceInstance returns the service behind a plugin, or the plugin itself for
+// plugins that are their own service
+func serviceInstance(plugin ServicePlugin) interface{} {
+	switch p := plugin.(type) {
+	case *servicePlugin:
+		return p.instance
+	case *gatewayPlugin:
+		return p.instance
+	default:
+		return plugin
+	}
+}
+
+func serviceInstances(plugins []ServicePlugin) map[string]interface{} {
+	instances := make(map[string]interface{}, len(plugins))
+	for _, plugin := range plugins {
+		instances[plugin.Name()] = serviceInstance(plugin)
+	}
+	return instances
+}
@@ -0,0 +1,78 @@
+package apigateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserTokenAuth(t *testing.T) {
+	auth := NewUserTokenAuth("key")
+
+	token, err := auth.Mint("alice@example.com", time.Minute)
+	require.NoError(t, err)
+	userID, err := auth.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", userID, "user IDs may contain dots")
+
+	_, err = NewUserTokenAuth("other-key").Verify(token)
+	assert.ErrorIs(t, err, ErrUserToken)
+	expired, err := auth.Mint("alice", -time.Second)
+	require.NoError(t, err)
+	_, err = auth.Verify(expired)
+	assert.ErrorIs(t, err, ErrUserToken)
+	_, err = auth.Verify("not-a-token")
+	assert.ErrorIs(t, err, ErrUserToken)
+}
+
+func TestAuthHandler(t *testing.T) {
+	service := NewService()
+	auth := NewUserTokenAuth("key")
+	service.SetUserTokenAuth(auth)
+	require.NoError(t, service.SetRateLimitTier(RateLimitTier{Name: RateLimitTierFree, Limit: 1, Window: time.Minute}))
+	require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/api/v1/workflows", Target: "http://localhost:8082"}))
+
+	var seenUser string
+	handler := service.AuthHandler(service.RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenUser = r.Header.Get("X-User-ID")
+	})))
+	// Every request comes from the same address, as from users behind one NAT
+	serve := func(token, claimedUserID string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/workflows", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if claimedUserID != "" {
+			req.Header.Set("X-User-ID", claimedUserID)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	mint := func(userID string) string {
+		token, err := auth.Mint(userID, time.Minute)
+		require.NoError(t, err)
+		return token
+	}
+
+	t.Run("should rate limit each authenticated user separately", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(mint("alice"), "bob"))
+		assert.Equal(t, "alice", seenUser, "the verified user replaces the claimed one")
+		assert.Equal(t, http.StatusTooManyRequests, serve(mint("alice"), ""))
+		assert.Equal(t, http.StatusOK, serve(mint("bob"), ""))
+	})
+
+	t.Run("should rate limit requests without a token by IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("", "alice"))
+		assert.Empty(t, seenUser, "a claimed user is not passed on")
+		assert.Equal(t, http.StatusTooManyRequests, serve("", "carol"))
+	})
+
+	t.Run("should reject an invalid token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("forged.0.00", ""))
+	})
+}
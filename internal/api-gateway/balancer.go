@@ -0,0 +1,182 @@
+package apigateway
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Load balancing strategies SelectInstance can use
+const (
+	LoadBalancerRoundRobin       = "round_robin"
+	LoadBalancerLeastConnections = "least_connections"
+	LoadBalancerRandom           = "random"
+	// LoadBalancerLatencyWeighted picks instances at random, weighted by the
+	// inverse of their latency estimate, so faster instances get more requests
+	LoadBalancerLatencyWeighted = "latency_weighted"
+)
+
+const (
+	// latencySmoothing is the weight of a new sample in an instance's
+	// exponentially weighted moving average latency
+	latencySmoothing = 0.3
+	// latencyFloor bounds how much faster than others an instance can count as
+	latencyFloor = time.Millisecond
+)
+
+// validLoadBalancer reports whether strategy is a known load balancing strategy
+func validLoadBalancer(strategy string) bool {
+	switch strategy {
+	case LoadBalancerRoundRobin, LoadBalancerLeastConnections, LoadBalancerRandom, LoadBalancerLatencyWeighted:
+		return true
+	}
+	return false
+}
+
+// SetLoadBalancer sets the strategy SelectInstance picks instances with
+func (s *Service) SetLoadBalancer(strategy string) error {
+	if !validLoadBalancer(strategy) {
+		return fmt.Errorf("unknown load balancer '%s'", strategy)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.LoadBalancer = strategy
+	return nil
+}
+
+// IncrementConnections records a request started against an instance, so the
+// least_connections strategy sends new requests elsewhere until it ends
+func (s *Service) IncrementConnections(instanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connections[instanceID]++
+}
+
+// DecrementConnections records a request against an instance as finished
+func (s *Service) DecrementConnections(instanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connections[instanceID] <= 1 {
+		delete(s.connections, instanceID)
+		return
+	}
+	s.connections[instanceID]--
+}
+
+// ActiveConnections returns how many requests are in flight to an instance
+func (s *Service) ActiveConnections(instanceID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connections[instanceID]
+}
+
+// RecordLatency folds the duration of a request to an instance into its
+// latency estimate, an exponentially weighted moving average the
+// latency_weighted strategy selects by
+func (s *Service) RecordLatency(instanceID string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if estimate, ok := s.latencies[instanceID]; ok {
+		latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(estimate))
+	}
+	s.latencies[instanceID] = latency
+}
+
+// InstanceLatency returns an instance's latency estimate, or zero before any
+// request to it has been recorded
+func (s *Service) InstanceLatency(instanceID string) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latencies[instanceID]
+}
+
+// SelectInstance selects a healthy instance of a service using the configured
+// load balancing strategy. It returns nil if none is healthy or the service's
+// circuit is open.
+func (s *Service) SelectInstance(serviceName string) *ServiceInstance {
+	// The round-robin position is updated, so selection takes the write lock
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if breaker, ok := s.breakers[serviceName]; ok {
+		breaker.expire(time.Now())
+		if breaker.State == CircuitStateOpen {
+			return nil
+		}
+	}
+
+	healthy := make([]*ServiceInstance, 0, len(s.instances[serviceName]))
+	for _, instance := range s.instances[serviceName] {
+		if instance.Health == HealthStatusHealthy {
+			healthy = append(healthy, instance)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	switch s.config.LoadBalancer {
+	case LoadBalancerRandom:
+		return healthy[rand.IntN(len(healthy))]
+	case LoadBalancerLatencyWeighted:
+		return s.latencyWeighted(healthy)
+	case LoadBalancerLeastConnections:
+		// Scanning from the rotating position spreads ties between instances
+		start := s.nextIndex(serviceName, len(healthy))
+		selected := healthy[start]
+		for i := 1; i < len(healthy); i++ {
+			instance := healthy[(start+i)%len(healthy)]
+			if s.connections[instance.ID] < s.connections[selected.ID] {
+				selected = instance
+			}
+		}
+		return selected
+	default:
+		return healthy[s.nextIndex(serviceName, len(healthy))]
+	}
+}
+
+// latencyWeighted picks one of the healthy instances at random with a
+// probability inversely proportional to its latency estimate. Instances
+// without an estimate count as fast as the fastest, so they get requests to
+// measure; with no estimates at all the pick is uniform. Callers must hold
+// s.mu.
+func (s *Service) latencyWeighted(healthy []*ServiceInstance) *ServiceInstance {
+	var fastest time.Duration
+	for _, instance := range healthy {
+		if latency, ok := s.latencies[instance.ID]; ok && (fastest == 0 || latency < fastest) {
+			fastest = latency
+		}
+	}
+	if fastest == 0 {
+		return healthy[rand.IntN(len(healthy))]
+	}
+
+	weights := make([]float64, len(healthy))
+	var total float64
+	for i, instance := range healthy {
+		latency, ok := s.latencies[instance.ID]
+		if !ok {
+			latency = fastest
+		}
+		weights[i] = 1 / math.Max(latency.Seconds(), latencyFloor.Seconds())
+		total += weights[i]
+	}
+	pick := rand.Float64() * total
+	for i, weight := range weights {
+		if pick < weight {
+			return healthy[i]
+		}
+		pick -= weight
+	}
+	return healthy[len(healthy)-1]
+}
+
+// nextIndex returns the service's rotating position among n instances and
+// advances it. Callers must hold the write lock.
+func (s *Service) nextIndex(serviceName string, n int) int {
+	index := s.rrNext[serviceName] % n
+	s.rrNext[serviceName] = index + 1
+	return index
+}
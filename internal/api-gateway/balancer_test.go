@@ -0,0 +1,176 @@
+package apigateway
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBalancers(t *testing.T) {
+	setup := func(t *testing.T, strategy string) *Service {
+		service := NewService()
+		require.NoError(t, service.SetLoadBalancer(strategy))
+		for _, instance := range []*ServiceInstance{
+			{ID: "vault-1", ServiceName: "vault", Address: "10.0.0.1", Port: 8080, Health: HealthStatusHealthy},
+			{ID: "vault-2", ServiceName: "vault", Address: "10.0.0.2", Port: 8080, Health: HealthStatusUnhealthy},
+			{ID: "vault-3", ServiceName: "vault", Address: "10.0.0.3", Port: 8080, Health: HealthStatusHealthy},
+			{ID: "vault-4", ServiceName: "vault", Address: "10.0.0.4", Port: 8080, Health: HealthStatusHealthy},
+		} {
+			require.NoError(t, service.RegisterInstance(instance))
+		}
+		return service
+	}
+	selectIDs := func(service *Service, n int) []string {
+		ids := make([]string, n)
+		for i := range ids {
+			ids[i] = service.SelectInstance("vault").ID
+		}
+		return ids
+	}
+
+	t.Run("should rotate through healthy instances", func(t *testing.T) {
+		service := setup(t, LoadBalancerRoundRobin)
+		assert.Equal(t, []string{"vault-1", "vault-3", "vault-4", "vault-1", "vault-3", "vault-4"}, selectIDs(service, 6))
+		assert.Nil(t, service.SelectInstance("flow"))
+	})
+
+	t.Run("should pick the instance with the fewest connections", func(t *testing.T) {
+		service := setup(t, LoadBalancerLeastConnections)
+		service.IncrementConnections("vault-1")
+		service.IncrementConnections("vault-1")
+		service.IncrementConnections("vault-3")
+		assert.Equal(t, []string{"vault-4", "vault-4"}, selectIDs(service, 2))
+
+		service.IncrementConnections("vault-4")
+		service.IncrementConnections("vault-4")
+		assert.Equal(t, "vault-3", service.SelectInstance("vault").ID)
+
+		service.DecrementConnections("vault-1")
+		service.DecrementConnections("vault-1")
+		service.DecrementConnections("vault-1")
+		assert.Zero(t, service.ActiveConnections("vault-1"))
+		assert.Equal(t, "vault-1", service.SelectInstance("vault").ID)
+	})
+
+	t.Run("should spread ties between idle instances", func(t *testing.T) {
+		service := setup(t, LoadBalancerLeastConnections)
+		assert.ElementsMatch(t, []string{"vault-1", "vault-3", "vault-4"}, selectIDs(service, 3))
+	})
+
+	t.Run("should pick random healthy instances", func(t *testing.T) {
+		service := setup(t, LoadBalancerRandom)
+		seen := make(map[string]bool)
+		for _, id := range selectIDs(service, 200) {
+			seen[id] = true
+		}
+		assert.Equal(t, map[string]bool{"vault-1": true, "vault-3": true, "vault-4": true}, seen)
+	})
+
+	t.Run("should prefer instances with lower latency", func(t *testing.T) {
+		service := setup(t, LoadBalancerLatencyWeighted)
+		seen := make(map[string]bool)
+		for _, id := range selectIDs(service, 200) {
+			seen[id] = true
+		}
+		assert.Len(t, seen, 3, "without estimates every healthy instance is picked")
+
+		service.RecordLatency("vault-1", 10*time.Millisecond)
+		service.RecordLatency("vault-3", 10*time.Millisecond)
+		service.RecordLatency("vault-4", 100*time.Millisecond)
+		service.RecordLatency("vault-2", time.Microsecond)
+		counts := make(map[string]int)
+		for _, id := range selectIDs(service, 3000) {
+			counts[id]++
+		}
+		assert.Zero(t, counts["vault-2"], "unhealthy instances are never picked, however fast")
+		// vault-4 is ten times slower, so it should get about 1/21 of requests
+		assert.Less(t, counts["vault-4"], 300)
+		assert.Greater(t, counts["vault-1"], 1100)
+		assert.Greater(t, counts["vault-3"], 1100)
+	})
+
+	t.Run("should smooth latency samples", func(t *testing.T) {
+		service := NewService()
+		assert.Zero(t, service.InstanceLatency("vault-1"))
+		service.RecordLatency("vault-1", 100*time.Millisecond)
+		assert.Equal(t, 100*time.Millisecond, service.InstanceLatency("vault-1"))
+		service.RecordLatency("vault-1", 200*time.Millisecond)
+		assert.Equal(t, 130*time.Millisecond, service.InstanceLatency("vault-1"))
+	})
+
+	t.Run("should send fewer proxied calls to a slow instance over time", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.SetLoadBalancer(LoadBalancerLatencyWeighted))
+		var fast, slow atomic.Int32
+		registerFakeService(t, service, "flow", func(w http.ResponseWriter, r *http.Request) { fast.Add(1) })
+		registerFakeService(t, service, "flow", func(w http.ResponseWriter, r *http.Request) {
+			slow.Add(1)
+			time.Sleep(20 * time.Millisecond)
+		})
+		instances := service.GetInstances("flow")
+		for _, instance := range instances {
+			require.NoError(t, service.UpdateInstanceHealth(instance.ID, HealthStatusHealthy))
+		}
+
+		for i := 0; i < 100; i++ {
+			_, err := service.CallService(context.Background(), &ServiceCall{Service: "flow", Path: "/run"})
+			require.NoError(t, err)
+		}
+		assert.Greater(t, service.InstanceLatency(instances[1].ID), service.InstanceLatency(instances[0].ID))
+		assert.Less(t, slow.Load(), int32(25), "fast %d, slow %d", fast.Load(), slow.Load())
+	})
+
+	t.Run("should reject unknown strategies", func(t *testing.T) {
+		assert.ErrorContains(t, NewService().SetLoadBalancer("fastest"), "unknown load balancer 'fastest'")
+	})
+
+	t.Run("should select evenly from concurrent callers", func(t *testing.T) {
+		service := setup(t, LoadBalancerRoundRobin)
+		var mu sync.Mutex
+		counts := make(map[string]int)
+		var wg sync.WaitGroup
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				id := service.SelectInstance("vault").ID
+				service.IncrementConnections(id)
+				service.DecrementConnections(id)
+				mu.Lock()
+				counts[id]++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, map[string]int{"vault-1": 10, "vault-3": 10, "vault-4": 10}, counts)
+	})
+
+	t.Run("should count calls in flight to an instance", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.SetLoadBalancer(LoadBalancerLeastConnections))
+		started, release := make(chan struct{}), make(chan struct{})
+		registerFakeService(t, service, "flow", func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+		})
+		instanceID := service.GetInstances("flow")[0].ID
+		require.NoError(t, service.UpdateInstanceHealth(instanceID, HealthStatusHealthy))
+
+		done := make(chan error)
+		go func() {
+			_, err := service.CallService(context.Background(), &ServiceCall{Service: "flow", Path: "/run"})
+			done <- err
+		}()
+		<-started
+		assert.Equal(t, 1, service.ActiveConnections(instanceID))
+		close(release)
+		require.NoError(t, <-done)
+		assert.Zero(t, service.ActiveConnections(instanceID))
+	})
+}
@@ -0,0 +1,133 @@
+package apigateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestTimeoutHeader carries the remaining request budget across proxied hops.
+// Values are integer milliseconds or Go duration strings (e.g. "1500ms", "2s").
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// ErrBudgetExhausted is returned when a request has no remaining time budget
+var ErrBudgetExhausted = errors.New("request budget exhausted")
+
+// ParseRequestBudget parses the value of the X-Request-Timeout header
+func ParseRequestBudget(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("request budget is empty")
+	}
+
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+
+	budget, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid request budget '%s'", value)
+	}
+	return budget, nil
+}
+
+// WithRequestBudget applies the budget from the header value as the context deadline.
+// An earlier deadline already present on the context is kept.
+func WithRequestBudget(ctx context.Context, value string) (context.Context, context.CancelFunc, error) {
+	budget, err := ParseRequestBudget(value)
+	if err != nil {
+		return ctx, func() {}, err
+	}
+	if budget <= 0 {
+		return ctx, func() {}, ErrBudgetExhausted
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, budget)
+	return newCtx, cancel, nil
+}
+
+// RemainingBudget returns the time left before the context deadline
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// PropagateRequestBudget sets the X-Request-Timeout header on an outgoing request
+// from the remaining budget of its context, rounded up to whole milliseconds
+// so a budget under 1ms is not sent as an exhausted one
+func PropagateRequestBudget(req *http.Request) error {
+	remaining, ok := RemainingBudget(req.Context())
+	if !ok {
+		return nil
+	}
+	if remaining <= 0 {
+		return ErrBudgetExhausted
+	}
+
+	req.Header.Set(RequestTimeoutHeader, strconv.FormatInt(budgetMilliseconds(remaining), 10))
+	return nil
+}
+
+// budgetMilliseconds returns a budget in whole milliseconds, rounded up
+func budgetMilliseconds(budget time.Duration) int64 {
+	return int64((budget + time.Millisecond - 1) / time.Millisecond)
+}
+
+// RequestBudgetHandler reads the X-Request-Timeout header, sets it as the request
+// context deadline and responds with 504 when the budget is exhausted, before
+// the request is handled or when it runs out while the handler has not
+// responded yet
+func RequestBudgetHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(RequestTimeoutHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel, err := WithRequestBudget(r.Context(), value)
+		defer cancel()
+		if errors.Is(err, ErrBudgetExhausted) {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writer := &budgetResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(writer, r.WithContext(ctx))
+		if !writer.wroteHeader && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			http.Error(w, ErrBudgetExhausted.Error(), http.StatusGatewayTimeout)
+		}
+	})
+}
+
+// budgetResponseWriter records whether a handler has started its response
+type budgetResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *budgetResponseWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *budgetResponseWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *budgetResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
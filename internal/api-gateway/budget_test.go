@@ -0,0 +1,132 @@
+package apigateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequestBudget(t *testing.T) {
+	t.Run("should parse milliseconds", func(t *testing.T) {
+		budget, err := ParseRequestBudget("1500")
+		require.NoError(t, err)
+		assert.Equal(t, 1500*time.Millisecond, budget)
+	})
+
+	t.Run("should parse duration strings", func(t *testing.T) {
+		budget, err := ParseRequestBudget("2s")
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Second, budget)
+	})
+
+	t.Run("should reject invalid values", func(t *testing.T) {
+		_, err := ParseRequestBudget("soon")
+		assert.Error(t, err)
+	})
+}
+
+func TestRequestBudgetPropagation(t *testing.T) {
+	t.Run("should shrink the deadline across hops", func(t *testing.T) {
+		var backendBudget time.Duration
+		backend := httptest.NewServer(RequestBudgetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			budget, err := ParseRequestBudget(r.Header.Get(RequestTimeoutHeader))
+			require.NoError(t, err)
+			backendBudget = budget
+
+			remaining, ok := RemainingBudget(r.Context())
+			assert.True(t, ok)
+			assert.LessOrEqual(t, remaining, budget)
+			w.WriteHeader(http.StatusOK)
+		})))
+		defer backend.Close()
+
+		gateway := httptest.NewServer(RequestBudgetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Simulate work done by the gateway before proxying
+			time.Sleep(50 * time.Millisecond)
+
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, backend.URL, nil)
+			require.NoError(t, err)
+			require.NoError(t, PropagateRequestBudget(req))
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			w.WriteHeader(resp.StatusCode)
+		})))
+		defer gateway.Close()
+
+		req, err := http.NewRequest(http.MethodGet, gateway.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set(RequestTimeoutHeader, "1000")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Greater(t, backendBudget, time.Duration(0))
+		assert.LessOrEqual(t, backendBudget, 950*time.Millisecond)
+	})
+
+	t.Run("should return 504 when the budget is exhausted", func(t *testing.T) {
+		called := false
+		handler := RequestBudgetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestTimeoutHeader, "0")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+		assert.False(t, called)
+	})
+
+	t.Run("should refuse to propagate an expired deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		time.Sleep(time.Millisecond)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://backend", nil)
+		require.NoError(t, err)
+		assert.ErrorIs(t, PropagateRequestBudget(req), ErrBudgetExhausted)
+	})
+
+	t.Run("should round budgets up to whole milliseconds", func(t *testing.T) {
+		// A budget under 1ms is not sent as an exhausted one
+		assert.Equal(t, int64(1), budgetMilliseconds(500*time.Microsecond))
+		assert.Equal(t, int64(2), budgetMilliseconds(1500*time.Microsecond))
+		assert.Equal(t, int64(2), budgetMilliseconds(2*time.Millisecond))
+	})
+
+	t.Run("should return 504 when the budget runs out while handling", func(t *testing.T) {
+		handler := RequestBudgetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestTimeoutHeader, "10")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+		assert.Contains(t, rec.Body.String(), ErrBudgetExhausted.Error())
+	})
+
+	t.Run("should pass requests without a budget through unchanged", func(t *testing.T) {
+		handler := RequestBudgetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := RemainingBudget(r.Context())
+			assert.False(t, ok)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+}
@@ -0,0 +1,338 @@
+package apigateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+const (
+	// MaxServiceResponseBytes caps how much of a service response CallService reads
+	MaxServiceResponseBytes = 1 << 20
+	// DefaultFailureThreshold is how many consecutive failed calls open a service's circuit
+	DefaultFailureThreshold = 5
+	// DefaultCircuitTimeout is how long a circuit stays open before a call is let through again
+	DefaultCircuitTimeout = 30 * time.Second
+	// DefaultCircuitMaxTimeout caps how long a circuit that keeps opening stays open
+	DefaultCircuitMaxTimeout = 10 * time.Minute
+	// DefaultCircuitRecoverySuccesses is how many calls in a row must succeed
+	// before a circuit's backoff is reset
+	DefaultCircuitRecoverySuccesses = 3
+	// DefaultHalfOpenProbes is how many calls a half-open circuit lets through at once
+	DefaultHalfOpenProbes = 1
+	// DefaultProbeLifetime is how long a half-open probe holds its slot
+	DefaultProbeLifetime = 30 * time.Second
+)
+
+var (
+	// ErrServiceNotFound is returned when calling a service that has neither
+	// registered instances nor a route
+	ErrServiceNotFound = errors.New("service not registered")
+	// ErrNoHealthyInstance is returned when every instance of a service is unhealthy
+	ErrNoHealthyInstance = errors.New("no healthy instance")
+	// ErrCircuitOpen is returned without calling a service whose circuit breaker is open
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// ServiceCall is a request from one Vertex service to another
+type ServiceCall struct {
+	// Service is the name the target service is registered under
+	Service string
+	Method  string
+	// Path is the path on the service, e.g. /api/v1/secrets
+	Path   string
+	Body   []byte
+	Header http.Header
+	// UserID is the user the call is made for; it is sent as X-User-ID
+	UserID string
+}
+
+// ServiceCallResponse is the response to a ServiceCall
+type ServiceCallResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// SetHTTPClient sets the client used for service calls
+func (s *Service) SetHTTPClient(client *http.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.httpClient = client
+}
+
+// ServiceName is the name the gateway signs its service calls with
+const ServiceName = "api-gateway"
+
+// SetServiceAuth sets how service calls are signed, so backends requiring a
+// service token accept them. Calls are unsigned when auth is nil.
+func (s *Service) SetServiceAuth(auth *core.ServiceAuth) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serviceAuth = auth
+}
+
+// CallService sends a request to another service on behalf of a user. Calls
+// fail with ErrCircuitOpen while the service's circuit breaker is open.
+func (s *Service) CallService(ctx context.Context, call *ServiceCall) (*ServiceCallResponse, error) {
+	if strings.TrimSpace(call.Service) == "" {
+		return nil, errors.New("service is required")
+	}
+	if !strings.HasPrefix(call.Path, "/") {
+		return nil, fmt.Errorf("path '%s' must start with /", call.Path)
+	}
+	method := strings.ToUpper(call.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// Services without registered instances are called at a route's target
+	base, instanceID, err := s.resolveService(call.Service, call.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, base+call.Path, bytes.NewReader(call.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range call.Header {
+		req.Header[key] = values
+	}
+	if len(call.Body) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-User-ID", call.UserID)
+	if err := PropagateRequestBudget(req); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	auth := s.serviceAuth
+	s.mu.RUnlock()
+	if err := auth.Sign(req, ServiceName); err != nil {
+		return nil, err
+	}
+
+	// Network errors and 5xx responses count as failures. DefaultFailureThreshold
+	// in a row open the circuit until DefaultCircuitTimeout has passed, then a
+	// few probes decide whether it closes or opens again, for longer each time.
+	probe, err := s.allowCall(call.Service)
+	if err != nil {
+		return nil, err
+	}
+	if instanceID != "" {
+		s.IncrementConnections(instanceID)
+		defer s.DecrementConnections(instanceID)
+	}
+	start := time.Now()
+	resp, err := s.client().Do(req)
+	if instanceID != "" {
+		s.RecordLatency(instanceID, time.Since(start))
+	}
+	if err != nil {
+		s.recordCall(call.Service, false, probe)
+		return nil, fmt.Errorf("call to %s failed: %w", call.Service, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxServiceResponseBytes))
+	s.recordCall(call.Service, err == nil && resp.StatusCode < 500, probe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %w", call.Service, err)
+	}
+	return &ServiceCallResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// resolveService returns the base URL to call a service at, and the ID of the
+// instance it belongs to when the service has registered instances
+func (s *Service) resolveService(serviceName, path string) (string, string, error) {
+	if len(s.GetInstances(serviceName)) > 0 {
+		instance := s.SelectInstance(serviceName)
+		if instance == nil && s.CircuitBreakerState(serviceName) == CircuitStateOpen {
+			return "", "", fmt.Errorf("%w for service '%s'", ErrCircuitOpen, serviceName)
+		}
+		if instance == nil {
+			return "", "", fmt.Errorf("%w for service '%s'", ErrNoHealthyInstance, serviceName)
+		}
+		return "http://" + instance.Address + ":" + strconv.Itoa(instance.Port), instance.ID, nil
+	}
+
+	if route := s.MatchRoute(path); route != nil && route.ServiceName == serviceName {
+		return strings.TrimSuffix(route.Target, "/"), "", nil
+	}
+	for _, route := range s.GetRoutes() {
+		if route.ServiceName == serviceName {
+			return strings.TrimSuffix(route.Target, "/"), "", nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: '%s'", ErrServiceNotFound, serviceName)
+}
+
+// SetCircuitBackoff sets the longest a circuit stays open. Each time a
+// circuit opens again without having recovered, it stays open for twice as
+// long as the time before, up to maxTimeout.
+func (s *Service) SetCircuitBackoff(maxTimeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.circuitMaxTimeout = maxTimeout
+	for _, breaker := range s.breakers {
+		breaker.MaxTimeout = maxTimeout
+	}
+}
+
+// SetHalfOpenProbes sets how many calls a half-open circuit lets through at
+// once, and how long those probes hold their slots before more are let through
+func (s *Service) SetHalfOpenProbes(limit int, lifetime time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.halfOpenProbes = limit
+	s.probeLifetime = lifetime
+	for _, breaker := range s.breakers {
+		breaker.MaxProbes = limit
+		breaker.ProbeLifetime = lifetime
+	}
+}
+
+// cooldown is how long the circuit stays open after its latest trip: the
+// timeout, doubled for each consecutive trip before it, up to MaxTimeout
+func (b *CircuitBreaker) cooldown() time.Duration {
+	timeout := b.Timeout
+	for trip := 1; trip < b.Trips && timeout < b.MaxTimeout; trip++ {
+		timeout *= 2
+	}
+	if b.MaxTimeout > 0 && timeout > b.MaxTimeout {
+		timeout = b.MaxTimeout
+	}
+	return timeout
+}
+
+// expire moves an open circuit whose cooldown has passed to half-open
+func (b *CircuitBreaker) expire(now time.Time) {
+	if b.State == CircuitStateOpen && now.Sub(b.LastFailure) >= b.cooldown() {
+		b.State = CircuitStateHalfOpen
+		b.Probes = 0
+		b.HalfOpenSince = now
+	}
+}
+
+// allowCall returns ErrCircuitOpen while a service's circuit is open, or is
+// half-open with every probe slot taken. probe reports that the call is let
+// through as a half-open probe, and must be passed on to recordCall.
+func (s *Service) allowCall(serviceName string) (probe bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	breaker, ok := s.breakers[serviceName]
+	if !ok {
+		return false, nil
+	}
+	now := time.Now()
+	breaker.expire(now)
+
+	switch breaker.State {
+	case CircuitStateOpen:
+		return false, fmt.Errorf("%w for service '%s'", ErrCircuitOpen, serviceName)
+	case CircuitStateHalfOpen:
+		// Probes that never reported back give up their slots
+		if now.Sub(breaker.HalfOpenSince) >= breaker.ProbeLifetime {
+			breaker.Probes = 0
+			breaker.HalfOpenSince = now
+		}
+		if breaker.Probes >= breaker.MaxProbes {
+			return false, fmt.Errorf("%w for service '%s': waiting on probe calls", ErrCircuitOpen, serviceName)
+		}
+		breaker.Probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+// recordCall feeds the outcome of a call into the service's circuit breaker.
+// Only probes decide whether an open or half-open circuit recovers. Once
+// DefaultCircuitRecoverySuccesses calls in a row succeed, the circuit's
+// backoff is reset.
+func (s *Service) recordCall(serviceName string, success, probe bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	breaker, ok := s.breakers[serviceName]
+	if !ok {
+		breaker = &CircuitBreaker{
+			ServiceName:      serviceName,
+			FailureThreshold: DefaultFailureThreshold,
+			Timeout:          DefaultCircuitTimeout,
+			MaxTimeout:       s.circuitMaxTimeout,
+			MaxProbes:        s.halfOpenProbes,
+			ProbeLifetime:    s.probeLifetime,
+		}
+		s.breakers[serviceName] = breaker
+	}
+	if probe && breaker.Probes > 0 {
+		breaker.Probes--
+	}
+	// Calls let through before the circuit opened can finish after it, and
+	// probes can outlive their half-open window; neither says the service recovered
+	breaker.expire(time.Now())
+	if breaker.State == CircuitStateOpen || (breaker.State == CircuitStateHalfOpen && !probe) {
+		return
+	}
+
+	if success {
+		breaker.State = CircuitStateClosed
+		breaker.FailureCount = 0
+		breaker.Successes++
+		if breaker.Successes >= DefaultCircuitRecoverySuccesses {
+			breaker.Trips = 0
+		}
+		return
+	}
+	breaker.Successes = 0
+	breaker.FailureCount++
+	breaker.LastFailure = time.Now()
+	if breaker.State == CircuitStateHalfOpen || (breaker.State == CircuitStateClosed && breaker.FailureCount >= breaker.FailureThreshold) {
+		breaker.State = CircuitStateOpen
+		breaker.Trips++
+	}
+}
+
+// RecordSuccess records a successful call to a service. It resets the failure
+// count of a closed circuit, and leaves an open or half-open one to its probes.
+func (s *Service) RecordSuccess(serviceName string) {
+	s.recordCall(serviceName, true, false)
+}
+
+// RecordFailure records a failed call to a service. FailureThreshold failures
+// in a row open its circuit; an open or half-open one is left to its probes.
+func (s *Service) RecordFailure(serviceName string) {
+	s.recordCall(serviceName, false, false)
+}
+
+// CircuitBreakerState returns the state of a service's circuit. A circuit
+// whose cooldown has passed is half-open, letting probe calls through.
+func (s *Service) CircuitBreakerState(serviceName string) CircuitState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	breaker, ok := s.breakers[serviceName]
+	if !ok {
+		return CircuitStateClosed
+	}
+	breaker.expire(time.Now())
+	return breaker.State
+}
+
+func (s *Service) client() *http.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.httpClient != nil {
+		return s.httpClient
+	}
+	return &http.Client{Timeout: s.config.Timeout}
+}
@@ -0,0 +1,275 @@
+package apigateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerFakeService registers an httptest server as the only instance of a service
+func registerFakeService(t *testing.T, service *Service, name string, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	require.NoError(t, service.RegisterInstance(&ServiceInstance{ServiceName: name, Address: host, Port: portNumber}))
+}
+
+func TestCallService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should call a discovered instance as the user", func(t *testing.T) {
+		service := NewService()
+		var method, path, userID, body string
+		registerFakeService(t, service, "vault", func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			method, path, userID, body = r.Method, r.URL.Path, r.Header.Get("X-User-ID"), string(data)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"key":"db-password"}`))
+		})
+
+		response, err := service.CallService(ctx, &ServiceCall{
+			Service: "vault",
+			Method:  "post",
+			Path:    "/api/v1/secrets",
+			Body:    []byte(`{"key":"db-password","value":"hunter2"}`),
+			UserID:  "user1",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+		assert.JSONEq(t, `{"key":"db-password"}`, string(response.Body))
+		assert.Equal(t, http.MethodPost, method)
+		assert.Equal(t, "/api/v1/secrets", path)
+		assert.Equal(t, "user1", userID)
+		assert.JSONEq(t, `{"key":"db-password","value":"hunter2"}`, body)
+	})
+
+	t.Run("should sign calls for backends requiring a service token", func(t *testing.T) {
+		service := NewService()
+		auth := core.NewServiceAuth("shared-key", time.Minute)
+		registerFakeService(t, service, "vault", auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP)
+		call := &ServiceCall{Service: "vault", Path: "/api/v1/secrets", UserID: "user1"}
+
+		response, err := service.CallService(ctx, call)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+		service.SetServiceAuth(auth)
+		response, err = service.CallService(ctx, call)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	})
+
+	t.Run("should fall back to a route target without instances", func(t *testing.T) {
+		service := NewService()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "task", Path: "/api/v1/tasks", Target: server.URL}))
+
+		response, err := service.CallService(ctx, &ServiceCall{Service: "task", Path: "/api/v1/tasks", UserID: "user1"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	})
+
+	t.Run("should reject unknown and unhealthy services", func(t *testing.T) {
+		service := NewService()
+		_, err := service.CallService(ctx, &ServiceCall{Service: "vault", Path: "/api/v1/secrets"})
+		assert.True(t, errors.Is(err, ErrServiceNotFound))
+
+		instance := &ServiceInstance{ServiceName: "vault", Address: "127.0.0.1", Port: 1, Health: HealthStatusUnhealthy}
+		require.NoError(t, service.RegisterInstance(instance))
+		_, err = service.CallService(ctx, &ServiceCall{Service: "vault", Path: "/api/v1/secrets"})
+		assert.True(t, errors.Is(err, ErrNoHealthyInstance))
+	})
+
+	t.Run("should open the circuit after repeated failures", func(t *testing.T) {
+		service := NewService()
+		calls := 0
+		registerFakeService(t, service, "monitor", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+		call := &ServiceCall{Service: "monitor", Path: "/api/v1/metrics", UserID: "user1"}
+		for i := 0; i < DefaultFailureThreshold; i++ {
+			response, err := service.CallService(ctx, call)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+		}
+
+		_, err := service.CallService(ctx, call)
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+		assert.Equal(t, DefaultFailureThreshold, calls)
+	})
+}
+
+func TestCircuitBackoff(t *testing.T) {
+	// trip opens the circuit with failed calls and returns its cooldown
+	trip := func(service *Service, breaker **CircuitBreaker) time.Duration {
+		for i := 0; i < DefaultFailureThreshold; i++ {
+			service.recordCall("monitor", false, false)
+		}
+		*breaker = service.breakers["monitor"]
+		return (*breaker).cooldown()
+	}
+	// expire lets the open circuit's cooldown pass and sends a probe that fails
+	failProbe := func(t *testing.T, service *Service, breaker *CircuitBreaker) {
+		breaker.LastFailure = time.Now().Add(-breaker.cooldown())
+		probe, err := service.allowCall("monitor")
+		require.NoError(t, err)
+		require.True(t, probe)
+		service.recordCall("monitor", false, probe)
+		require.Equal(t, CircuitStateOpen, breaker.State)
+	}
+
+	t.Run("should double the cooldown with each consecutive trip up to the cap", func(t *testing.T) {
+		service := NewService()
+		service.SetCircuitBackoff(2 * time.Minute)
+		var breaker *CircuitBreaker
+		assert.Equal(t, DefaultCircuitTimeout, trip(service, &breaker))
+
+		var cooldowns []time.Duration
+		for i := 0; i < 4; i++ {
+			failProbe(t, service, breaker)
+			cooldowns = append(cooldowns, breaker.cooldown())
+		}
+		assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute}, cooldowns)
+		assert.Equal(t, 5, breaker.Trips)
+
+		_, err := service.allowCall("monitor")
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+	})
+
+	t.Run("should reset the backoff after sustained success", func(t *testing.T) {
+		service := NewService()
+		var breaker *CircuitBreaker
+		trip(service, &breaker)
+		failProbe(t, service, breaker)
+		require.Equal(t, 2*DefaultCircuitTimeout, breaker.cooldown())
+
+		breaker.LastFailure = time.Now().Add(-breaker.cooldown())
+		probe, err := service.allowCall("monitor")
+		require.NoError(t, err)
+		service.recordCall("monitor", true, probe)
+		assert.Equal(t, CircuitStateClosed, breaker.State)
+		assert.Equal(t, 2, breaker.Trips, "one success is not yet a recovery")
+
+		for i := 1; i < DefaultCircuitRecoverySuccesses; i++ {
+			service.recordCall("monitor", true, false)
+		}
+		assert.Zero(t, breaker.Trips)
+		assert.Equal(t, DefaultCircuitTimeout, trip(service, &breaker))
+	})
+
+	t.Run("should limit concurrent half-open probes", func(t *testing.T) {
+		service := NewService()
+		service.SetHalfOpenProbes(2, time.Minute)
+		var breaker *CircuitBreaker
+		trip(service, &breaker)
+		breaker.LastFailure = time.Now().Add(-breaker.cooldown())
+
+		for i := 0; i < 2; i++ {
+			probe, err := service.allowCall("monitor")
+			require.NoError(t, err)
+			assert.True(t, probe)
+		}
+		_, err := service.allowCall("monitor")
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+		// A probe that stays out past its lifetime gives up its slot
+		breaker.HalfOpenSince = time.Now().Add(-time.Minute)
+		probe, err := service.allowCall("monitor")
+		require.NoError(t, err)
+		assert.True(t, probe)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	setup := func(t *testing.T) *Service {
+		service := NewService()
+		require.NoError(t, service.RegisterInstance(&ServiceInstance{ID: "flow-1", ServiceName: "flow", Address: "10.0.0.1", Port: 8082, Health: HealthStatusHealthy}))
+		return service
+	}
+	open := func(service *Service) {
+		for i := 0; i < DefaultFailureThreshold; i++ {
+			service.RecordFailure("flow")
+		}
+	}
+
+	t.Run("should open after consecutive failures and reject selection", func(t *testing.T) {
+		service := setup(t)
+		assert.Equal(t, CircuitStateClosed, service.CircuitBreakerState("flow"))
+
+		for i := 1; i < DefaultFailureThreshold; i++ {
+			service.RecordFailure("flow")
+		}
+		service.RecordSuccess("flow")
+		service.RecordFailure("flow")
+		assert.Equal(t, CircuitStateClosed, service.CircuitBreakerState("flow"), "a success resets the failure count")
+		assert.NotNil(t, service.SelectInstance("flow"))
+
+		open(service)
+		assert.Equal(t, CircuitStateOpen, service.CircuitBreakerState("flow"))
+		assert.Nil(t, service.SelectInstance("flow"))
+		_, err := service.CallService(context.Background(), &ServiceCall{Service: "flow", Path: "/api/v1/workflows"})
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+	})
+
+	t.Run("should go half-open after the timeout and close on a successful probe", func(t *testing.T) {
+		service := setup(t)
+		open(service)
+		service.breakers["flow"].LastFailure = time.Now().Add(-DefaultCircuitTimeout)
+
+		assert.Equal(t, CircuitStateHalfOpen, service.CircuitBreakerState("flow"))
+		assert.NotNil(t, service.SelectInstance("flow"))
+		probe, err := service.allowCall("flow")
+		require.NoError(t, err)
+		require.True(t, probe)
+		service.recordCall("flow", true, probe)
+		assert.Equal(t, CircuitStateClosed, service.CircuitBreakerState("flow"))
+	})
+
+	t.Run("should not close on a late call that was not a probe", func(t *testing.T) {
+		service := setup(t)
+		open(service)
+
+		service.RecordSuccess("flow")
+		assert.Equal(t, CircuitStateOpen, service.CircuitBreakerState("flow"))
+
+		service.breakers["flow"].LastFailure = time.Now().Add(-DefaultCircuitTimeout)
+		require.Equal(t, CircuitStateHalfOpen, service.CircuitBreakerState("flow"))
+		service.RecordSuccess("flow")
+		service.RecordFailure("flow")
+		assert.Equal(t, CircuitStateHalfOpen, service.CircuitBreakerState("flow"))
+	})
+
+	t.Run("should open again when a probe fails", func(t *testing.T) {
+		service := setup(t)
+		open(service)
+		service.breakers["flow"].LastFailure = time.Now().Add(-DefaultCircuitTimeout)
+		require.Equal(t, CircuitStateHalfOpen, service.CircuitBreakerState("flow"))
+
+		probe, err := service.allowCall("flow")
+		require.NoError(t, err)
+		service.recordCall("flow", false, probe)
+		assert.Equal(t, CircuitStateOpen, service.CircuitBreakerState("flow"))
+		assert.Nil(t, service.SelectInstance("flow"))
+	})
+}
@@ -0,0 +1,114 @@
+package apigateway
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config configures a gateway Service
+type Config struct {
+	// DefaultRateLimitTier is the built-in tier of callers without an assignment
+	DefaultRateLimitTier string `json:"default_rate_limit_tier" yaml:"default_rate_limit_tier"`
+	// RegistrySyncInterval is how often a persistent registry is reloaded to
+	// pick up other replicas' changes
+	RegistrySyncInterval time.Duration `json:"registry_sync_interval" yaml:"registry_sync_interval"`
+	// HealthPushToken authenticates external health checkers pushing instance
+	// health; pushes are refused while it is empty
+	HealthPushToken string `json:"health_push_token" yaml:"health_push_token"`
+	// UserTokenKey signs the bearer tokens users authenticate with; while it
+	// is empty requests are unauthenticated and rate limited by client IP
+	UserTokenKey string `json:"user_token_key" yaml:"user_token_key"`
+	// InstanceTTL is how long an instance stays healthy without a heartbeat;
+	// zero disables the health reaper
+	InstanceTTL time.Duration `json:"instance_ttl" yaml:"instance_ttl"`
+	// ReapGracePeriod is how long an instance whose heartbeat expired stays
+	// registered, marked unhealthy
+	ReapGracePeriod time.Duration `json:"reap_grace_period" yaml:"reap_grace_period"`
+	// CircuitMaxTimeout caps how long a circuit that keeps opening stays open
+	CircuitMaxTimeout time.Duration `json:"circuit_max_timeout" yaml:"circuit_max_timeout"`
+	// HalfOpenProbes is how many calls a half-open circuit lets through at once
+	HalfOpenProbes int `json:"half_open_probes" yaml:"half_open_probes"`
+	// HalfOpenProbeLifetime is how long a half-open probe holds its slot
+	HalfOpenProbeLifetime time.Duration `json:"half_open_probe_lifetime" yaml:"half_open_probe_lifetime"`
+	// LoadBalancer is how instances of a service are chosen: round_robin,
+	// least_connections, random or latency_weighted
+	LoadBalancer string `json:"load_balancer" yaml:"load_balancer"`
+	// RateLimitAlgorithm is how callers' requests are counted unless selected
+	// per caller: fixed_window or token_bucket
+	RateLimitAlgorithm RateLimitAlgorithm `json:"rate_limit_algorithm" yaml:"rate_limit_algorithm"`
+}
+
+// DefaultConfig returns the settings NewService uses
+func DefaultConfig() Config {
+	return Config{
+		DefaultRateLimitTier:  RateLimitTierFree,
+		RegistrySyncInterval:  DefaultRegistrySyncInterval,
+		ReapGracePeriod:       DefaultReapGracePeriod,
+		CircuitMaxTimeout:     DefaultCircuitMaxTimeout,
+		HalfOpenProbes:        DefaultHalfOpenProbes,
+		HalfOpenProbeLifetime: DefaultProbeLifetime,
+		LoadBalancer:          LoadBalancerRoundRobin,
+		RateLimitAlgorithm:    RateLimitAlgorithmFixedWindow,
+	}
+}
+
+// Validate checks the rate limit tier, load balancer and rate limit algorithm
+// are known and the registry and circuit breaker timings are in range
+func (c Config) Validate() error {
+	if _, ok := DefaultRateLimitTiers()[c.DefaultRateLimitTier]; !ok {
+		return fmt.Errorf("unknown rate limit tier '%s'", c.DefaultRateLimitTier)
+	}
+	if c.RegistrySyncInterval <= 0 {
+		return errors.New("registry sync interval must be positive")
+	}
+	if c.InstanceTTL < 0 {
+		return errors.New("instance TTL must not be negative")
+	}
+	if c.ReapGracePeriod < 0 {
+		return errors.New("reap grace period must not be negative")
+	}
+	if c.CircuitMaxTimeout < DefaultCircuitTimeout {
+		return fmt.Errorf("circuit max timeout must be at least %s", DefaultCircuitTimeout)
+	}
+	if c.HalfOpenProbes < 1 {
+		return errors.New("half-open probes must be at least 1")
+	}
+	if c.HalfOpenProbeLifetime <= 0 {
+		return errors.New("half-open probe lifetime must be positive")
+	}
+	if !validLoadBalancer(c.LoadBalancer) {
+		return fmt.Errorf("unknown load balancer '%s'", c.LoadBalancer)
+	}
+	if !validRateLimitAlgorithm(c.RateLimitAlgorithm) {
+		return fmt.Errorf("unknown rate limit algorithm '%s'", c.RateLimitAlgorithm)
+	}
+	return nil
+}
+
+// NewServiceWithConfig validates cfg and creates a gateway service using it
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid gateway config: %w", err)
+	}
+	s := NewService()
+	if err := s.SetDefaultRateLimitTier(cfg.DefaultRateLimitTier); err != nil {
+		return nil, err
+	}
+	s.SetRegistrySyncInterval(cfg.RegistrySyncInterval)
+	s.SetHealthPushToken(cfg.HealthPushToken)
+	if cfg.UserTokenKey != "" {
+		s.SetUserTokenAuth(NewUserTokenAuth(cfg.UserTokenKey))
+	}
+	s.SetInstanceTTL(cfg.InstanceTTL)
+	s.SetReapGracePeriod(cfg.ReapGracePeriod)
+	s.SetCircuitBackoff(cfg.CircuitMaxTimeout)
+	s.SetHalfOpenProbes(cfg.HalfOpenProbes, cfg.HalfOpenProbeLifetime)
+	if err := s.SetLoadBalancer(cfg.LoadBalancer); err != nil {
+		return nil, err
+	}
+	if err := s.SetDefaultRateLimitAlgorithm(cfg.RateLimitAlgorithm); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
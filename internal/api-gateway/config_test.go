@@ -0,0 +1,57 @@
+package apigateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("should create a service from a config", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.DefaultRateLimitTier = RateLimitTierPro
+		cfg.RegistrySyncInterval = time.Minute
+		cfg.CircuitMaxTimeout = time.Hour
+		cfg.HalfOpenProbes = 2
+		cfg.InstanceTTL = time.Minute
+		cfg.LoadBalancer = LoadBalancerLeastConnections
+		cfg.RateLimitAlgorithm = RateLimitAlgorithmTokenBucket
+		service, err := NewServiceWithConfig(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, 1000, service.GetRateLimiter("stranger").Limit)
+		assert.Equal(t, time.Minute, service.syncInterval)
+		assert.Equal(t, time.Hour, service.circuitMaxTimeout)
+		assert.Equal(t, 2, service.halfOpenProbes)
+		assert.Equal(t, time.Minute, service.instanceTTL)
+		assert.Equal(t, DefaultReapGracePeriod, service.reapGrace)
+		assert.Equal(t, LoadBalancerLeastConnections, service.config.LoadBalancer)
+		assert.Equal(t, RateLimitAlgorithmTokenBucket, service.GetRateLimiter("stranger").Algorithm)
+
+		_, err = NewServiceWithConfig(DefaultConfig())
+		require.NoError(t, err)
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		for _, tc := range []struct {
+			config Config
+			err    string
+		}{
+			{Config{RegistrySyncInterval: time.Minute}, "unknown rate limit tier ''"},
+			{Config{DefaultRateLimitTier: "platinum", RegistrySyncInterval: time.Minute}, "unknown rate limit tier 'platinum'"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree}, "registry sync interval must be positive"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree, RegistrySyncInterval: time.Minute, InstanceTTL: -time.Second}, "instance TTL must not be negative"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree, RegistrySyncInterval: time.Minute, ReapGracePeriod: -time.Second}, "reap grace period must not be negative"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree, RegistrySyncInterval: time.Minute, CircuitMaxTimeout: time.Second}, "circuit max timeout must be at least 30s"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree, RegistrySyncInterval: time.Minute, CircuitMaxTimeout: time.Minute}, "half-open probes must be at least 1"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree, RegistrySyncInterval: time.Minute, CircuitMaxTimeout: time.Minute, HalfOpenProbes: 1}, "half-open probe lifetime must be positive"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree, RegistrySyncInterval: time.Minute, CircuitMaxTimeout: time.Minute, HalfOpenProbes: 1, HalfOpenProbeLifetime: time.Second, LoadBalancer: "fastest"}, "unknown load balancer 'fastest'"},
+			{Config{DefaultRateLimitTier: RateLimitTierFree, RegistrySyncInterval: time.Minute, CircuitMaxTimeout: time.Minute, HalfOpenProbes: 1, HalfOpenProbeLifetime: time.Second, LoadBalancer: LoadBalancerRandom, RateLimitAlgorithm: "leaky"}, "unknown rate limit algorithm 'leaky'"},
+		} {
+			assert.ErrorContains(t, tc.config.Validate(), tc.err)
+			_, err := NewServiceWithConfig(tc.config)
+			assert.ErrorContains(t, err, "invalid gateway config")
+		}
+	})
+}
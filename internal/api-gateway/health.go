@@ -0,0 +1,145 @@
+package apigateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// InstanceHealthUpdate is an instance's health as reported by an external
+// checker such as Kubernetes or Consul
+type InstanceHealthUpdate struct {
+	InstanceID string       `json:"instance_id"`
+	Health     HealthStatus `json:"health"`
+}
+
+// InstanceHealthResult reports whether one update of a batch was applied
+type InstanceHealthResult struct {
+	InstanceID string `json:"instance_id"`
+	Applied    bool   `json:"applied"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SetHealthPushToken sets the bearer token HealthPushHandler requires; the
+// handler rejects every request while it is empty
+func (s *Service) SetHealthPushToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthPushToken = token
+}
+
+// UpdateInstancesHealth applies a batch of health updates, returning a result
+// for each in order. Updates for unknown instances, with an invalid status or
+// repeating an instance earlier in the batch are rejected in their result;
+// the rest are applied together, so no caller sees part of the batch. Only
+// instances whose status changes are written to the store. The error is set,
+// and nothing applied, only if the registry store fails.
+func (s *Service) UpdateInstancesHealth(updates []InstanceHealthUpdate) ([]InstanceHealthResult, error) {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	now := time.Now()
+	results := make([]InstanceHealthResult, len(updates))
+	seen := make(map[string]bool, len(updates))
+	var applied, previous []*ServiceInstance
+	s.mu.RLock()
+	store := s.store
+	for i, update := range updates {
+		results[i].InstanceID = update.InstanceID
+		instance := s.findInstance(update.InstanceID)
+		switch {
+		case update.InstanceID == "":
+			results[i].Error = "instance ID is required"
+		case update.Health < HealthStatusHealthy || update.Health > HealthStatusUnknown:
+			results[i].Error = fmt.Sprintf("invalid health status %d", update.Health)
+		case seen[update.InstanceID]:
+			results[i].Error = "instance appears earlier in the batch"
+		case instance == nil:
+			results[i].Error = fmt.Sprintf("instance '%s' not found", update.InstanceID)
+		default:
+			updated := *instance
+			updated.Health = update.Health
+			updated.LastSeen = now
+			applied = append(applied, &updated)
+			previous = append(previous, instance)
+			results[i].Applied = true
+		}
+		seen[update.InstanceID] = true
+	}
+	s.mu.RUnlock()
+
+	var saved []*ServiceInstance
+	for i, instance := range applied {
+		if instance.Health == previous[i].Health {
+			continue
+		}
+		if err := store.SaveInstance(context.Background(), instance); err != nil {
+			// Put back the instances already saved so the store matches memory
+			for _, instance := range saved {
+				_ = store.SaveInstance(context.Background(), instance)
+			}
+			return nil, err
+		}
+		saved = append(saved, previous[i])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, instance := range applied {
+		s.stored[instance.ID] = true
+		s.putInstance(instance)
+	}
+	return results, nil
+}
+
+// HealthPushHandler accepts batches of health updates from external checkers,
+// as a JSON body of the form {"updates": [{"instance_id": "vault-1", "health": 1}]},
+// and responds with each update's result. Callers authenticate with the
+// health push token as a bearer token.
+func (s *Service) HealthPushHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !s.authorizeHealthPush(w, r) {
+			return
+		}
+
+		var body struct {
+			Updates []InstanceHealthUpdate `json:"updates"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		results, err := s.UpdateInstancesHealth(body.Updates)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	})
+}
+
+// authorizeHealthPush reports whether a request presents the health push
+// token, responding with 401 if it does not
+func (s *Service) authorizeHealthPush(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.RLock()
+	token := s.healthPushToken
+	s.mu.RUnlock()
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+		http.Error(w, "invalid or missing health push token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package apigateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore is a registry store whose saves fail after a number of successes
+type failingStore struct {
+	*MemoryRegistryStore
+	saves int
+}
+
+func (f *failingStore) SaveInstance(ctx context.Context, instance *ServiceInstance) error {
+	if f.saves == 0 {
+		return errors.New("store unavailable")
+	}
+	f.saves--
+	return f.MemoryRegistryStore.SaveInstance(ctx, instance)
+}
+
+func TestUpdateInstancesHealth(t *testing.T) {
+	setup := func(t *testing.T) *Service {
+		service := NewService()
+		for _, id := range []string{"vault-1", "vault-2", "flow-1"} {
+			name := strings.Split(id, "-")[0]
+			require.NoError(t, service.RegisterInstance(&ServiceInstance{ID: id, ServiceName: name, Address: name, Port: 8080, Health: HealthStatusHealthy}))
+		}
+		return service
+	}
+	health := func(service *Service, serviceName, id string) HealthStatus {
+		for _, instance := range service.GetInstances(serviceName) {
+			if instance.ID == id {
+				return instance.Health
+			}
+		}
+		return -1
+	}
+
+	t.Run("should apply known instances and reject the rest of a mixed batch", func(t *testing.T) {
+		service := setup(t)
+		results, err := service.UpdateInstancesHealth([]InstanceHealthUpdate{
+			{InstanceID: "vault-1", Health: HealthStatusUnhealthy},
+			{InstanceID: "ghost", Health: HealthStatusUnhealthy},
+			{InstanceID: "flow-1", Health: HealthStatusUnknown},
+			{InstanceID: "", Health: HealthStatusHealthy},
+			{InstanceID: "vault-2", Health: HealthStatus(7)},
+			{InstanceID: "vault-1", Health: HealthStatusHealthy},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, results, 6)
+		assert.Equal(t, InstanceHealthResult{InstanceID: "vault-1", Applied: true}, results[0])
+		assert.Equal(t, InstanceHealthResult{InstanceID: "ghost", Error: "instance 'ghost' not found"}, results[1])
+		assert.True(t, results[2].Applied)
+		assert.Equal(t, "instance ID is required", results[3].Error)
+		assert.Equal(t, "invalid health status 7", results[4].Error)
+		assert.Equal(t, "instance appears earlier in the batch", results[5].Error)
+
+		assert.Equal(t, HealthStatusUnhealthy, health(service, "vault", "vault-1"))
+		assert.Equal(t, HealthStatusHealthy, health(service, "vault", "vault-2"))
+		assert.Equal(t, HealthStatusUnknown, health(service, "flow", "flow-1"))
+		assert.Equal(t, "vault-2", service.SelectInstance("vault").ID)
+	})
+
+	t.Run("should apply nothing when the store fails part way", func(t *testing.T) {
+		service := setup(t)
+		store := &failingStore{MemoryRegistryStore: NewMemoryRegistryStore(), saves: 1}
+		service.store = store
+
+		_, err := service.UpdateInstancesHealth([]InstanceHealthUpdate{
+			{InstanceID: "vault-1", Health: HealthStatusUnhealthy},
+			{InstanceID: "flow-1", Health: HealthStatusUnhealthy},
+		})
+		require.Error(t, err)
+		assert.Equal(t, HealthStatusHealthy, health(service, "vault", "vault-1"))
+		assert.Equal(t, HealthStatusHealthy, health(service, "flow", "flow-1"))
+	})
+}
+
+func TestHealthPushHandler(t *testing.T) {
+	service := NewService()
+	require.NoError(t, service.RegisterInstance(&ServiceInstance{ID: "vault-1", ServiceName: "vault", Address: "vault", Port: 8080}))
+	handler := service.HealthPushHandler()
+
+	push := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/instances/health", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"updates": [{"instance_id": "vault-1", "health": 1}, {"instance_id": "ghost", "health": 1}]}`
+
+	t.Run("should refuse pushes while no token is configured", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, push("anything", body).Code)
+	})
+
+	service.SetHealthPushToken("push-token")
+
+	t.Run("should refuse a missing or wrong token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, push("", body).Code)
+		assert.Equal(t, http.StatusUnauthorized, push("wrong", body).Code)
+		assert.Equal(t, HealthStatusHealthy, service.GetInstances("vault")[0].Health)
+	})
+
+	t.Run("should reject a malformed body", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, push("push-token", "{").Code)
+	})
+
+	t.Run("should apply the batch and report each result", func(t *testing.T) {
+		rec := push("push-token", body)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Results []InstanceHealthResult `json:"results"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, []InstanceHealthResult{
+			{InstanceID: "vault-1", Applied: true},
+			{InstanceID: "ghost", Error: "instance 'ghost' not found"},
+		}, response.Results)
+		assert.Equal(t, HealthStatusUnhealthy, service.GetInstances("vault")[0].Health)
+	})
+}
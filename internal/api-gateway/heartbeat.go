@@ -0,0 +1,168 @@
+package apigateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+// DefaultReapGracePeriod is how long an instance stays registered, marked
+// unhealthy, after its heartbeat expires
+const DefaultReapGracePeriod = 5 * time.Minute
+
+const healthReaperJobName = "gateway.health-reaper"
+
+// ErrInstanceNotFound is returned for heartbeats of unregistered instances
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// Heartbeat records that an instance is alive, storing its new LastSeen and
+// marking it healthy again
+func (s *Service) Heartbeat(ctx context.Context, instanceID string) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	s.mu.RLock()
+	store := s.store
+	instance := s.findInstance(instanceID)
+	s.mu.RUnlock()
+	if instance == nil {
+		return fmt.Errorf("%w: '%s'", ErrInstanceNotFound, instanceID)
+	}
+
+	updated := *instance
+	updated.Health = HealthStatusHealthy
+	updated.LastSeen = time.Now()
+	if err := store.SaveInstance(ctx, &updated); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored[instanceID] = true
+	s.putInstance(&updated)
+	return nil
+}
+
+// HeartbeatHandler accepts heartbeats from instances, as a JSON body of the
+// form {"instance_id": "vault-1"}. Callers authenticate with the health push
+// token as a bearer token.
+func (s *Service) HeartbeatHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !s.authorizeHealthPush(w, r) {
+			return
+		}
+
+		var body struct {
+			InstanceID string `json:"instance_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if body.InstanceID == "" {
+			http.Error(w, "instance ID is required", http.StatusBadRequest)
+			return
+		}
+
+		err := s.Heartbeat(r.Context(), body.InstanceID)
+		if errors.Is(err, ErrInstanceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SetReapGracePeriod sets how long the health reaper keeps an instance whose
+// heartbeat expired before deregistering it
+func (s *Service) SetReapGracePeriod(grace time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reapGrace = grace
+}
+
+// SetInstanceTTL sets how long an instance is considered alive after its last
+// heartbeat. A started gateway with a positive TTL runs the health reaper
+// every half TTL; zero, the default, never reaps. Only set it where every
+// instance sends heartbeats.
+func (s *Service) SetInstanceTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instanceTTL = ttl
+}
+
+// startHealthReaper schedules the reaping of instances whose heartbeat is
+// older than ttl
+func (s *Service) startHealthReaper(ttl time.Duration) error {
+	return s.scheduler.Register(core.Job{
+		Name:     healthReaperJobName,
+		Schedule: core.Every(ttl / 2),
+		Run: func(ctx context.Context) error {
+			s.reapInstances(ctx, time.Now(), ttl)
+			return nil
+		},
+	})
+}
+
+// reapInstances marks instances last seen before now-ttl unhealthy and
+// deregisters those last seen before that by more than the grace period.
+// Store failures are logged and the instance is retried on the next check.
+func (s *Service) reapInstances(ctx context.Context, now time.Time, ttl time.Duration) {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	var stale, expired []*ServiceInstance
+	s.mu.RLock()
+	store := s.store
+	for _, instances := range s.instances {
+		for _, instance := range instances {
+			age := now.Sub(instance.LastSeen)
+			switch {
+			case age > ttl+s.reapGrace:
+				expired = append(expired, instance)
+			case age > ttl && instance.Health != HealthStatusUnhealthy:
+				updated := *instance
+				updated.Health = HealthStatusUnhealthy
+				stale = append(stale, &updated)
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, instance := range stale {
+		if err := store.SaveInstance(ctx, instance); err != nil {
+			log.Printf("⚠️  Failed to mark stale instance %s unhealthy: %v", instance.ID, err)
+			continue
+		}
+		s.mu.Lock()
+		s.stored[instance.ID] = true
+		s.putInstance(instance)
+		s.mu.Unlock()
+	}
+	for _, instance := range expired {
+		if err := store.DeleteInstance(ctx, instance.ID); err != nil {
+			log.Printf("⚠️  Failed to deregister stale instance %s: %v", instance.ID, err)
+			continue
+		}
+		s.mu.Lock()
+		s.removeInstance(instance.ID)
+		s.mu.Unlock()
+		log.Printf("🛑 Deregistered instance %s of %s, last seen %s ago", instance.ID, instance.ServiceName, now.Sub(instance.LastSeen).Round(time.Second))
+	}
+}
@@ -0,0 +1,120 @@
+package apigateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthReaper(t *testing.T) {
+	ctx := context.Background()
+	setup := func(t *testing.T) *Service {
+		service := NewService()
+		service.SetReapGracePeriod(time.Minute)
+		for _, id := range []string{"flow-1", "flow-2"} {
+			require.NoError(t, service.RegisterInstance(&ServiceInstance{ID: id, ServiceName: "flow", Address: id, Port: 8082}))
+		}
+		return service
+	}
+	health := func(service *Service) map[string]HealthStatus {
+		statuses := make(map[string]HealthStatus)
+		for _, instance := range service.GetInstances("flow") {
+			statuses[instance.ID] = instance.Health
+		}
+		return statuses
+	}
+
+	t.Run("should mark instances unhealthy once their heartbeat expires", func(t *testing.T) {
+		service := setup(t)
+		require.NoError(t, service.Heartbeat(ctx, "flow-2"))
+
+		service.reapInstances(ctx, time.Now().Add(30*time.Second), 10*time.Second)
+		assert.Equal(t, map[string]HealthStatus{"flow-1": HealthStatusUnhealthy, "flow-2": HealthStatusUnhealthy}, health(service))
+
+		require.NoError(t, service.Heartbeat(ctx, "flow-2"))
+		assert.Equal(t, HealthStatusHealthy, health(service)["flow-2"], "a heartbeat resets health")
+		assert.WithinDuration(t, time.Now(), service.GetInstances("flow")[1].LastSeen, time.Second)
+	})
+
+	t.Run("should deregister instances after the grace period", func(t *testing.T) {
+		service := setup(t)
+		service.reapInstances(ctx, time.Now().Add(30*time.Second), 10*time.Second)
+		require.NoError(t, service.Heartbeat(ctx, "flow-2"))
+
+		service.reapInstances(ctx, time.Now().Add(2*time.Minute), 10*time.Second)
+		assert.Empty(t, service.GetInstances("flow"))
+
+		stored, err := service.store.LoadInstances(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, stored)
+	})
+
+	t.Run("should keep instances that heartbeat", func(t *testing.T) {
+		service := setup(t)
+		service.reapInstances(ctx, time.Now().Add(5*time.Second), 10*time.Second)
+		assert.Equal(t, map[string]HealthStatus{"flow-1": HealthStatusHealthy, "flow-2": HealthStatusHealthy}, health(service))
+		assert.Error(t, service.Heartbeat(ctx, "missing"))
+	})
+
+	t.Run("should reap on the scheduler once started and stop on close", func(t *testing.T) {
+		service := setup(t)
+		service.SetReapGracePeriod(0)
+		service.SetInstanceTTL(20 * time.Millisecond)
+		scheduler := core.NewScheduler()
+		defer scheduler.Close(ctx)
+		service.SetScheduler(scheduler)
+		service.Start()
+
+		assert.Eventually(t, func() bool { return len(service.GetInstances("flow")) == 0 }, time.Second, 5*time.Millisecond)
+		require.NoError(t, service.Close(ctx))
+		assert.Empty(t, scheduler.Jobs())
+
+		require.NoError(t, service.RegisterInstance(&ServiceInstance{ID: "flow-3", ServiceName: "flow", Address: "flow-3", Port: 8082}))
+		time.Sleep(50 * time.Millisecond)
+		assert.Len(t, service.GetInstances("flow"), 1, "a stopped reaper removes nothing")
+	})
+
+	t.Run("should not reap without an instance TTL", func(t *testing.T) {
+		service := setup(t)
+		scheduler := core.NewScheduler()
+		defer scheduler.Close(ctx)
+		service.SetScheduler(scheduler)
+		service.Start()
+		defer service.Close(ctx)
+		for _, job := range scheduler.Jobs() {
+			assert.NotEqual(t, healthReaperJobName, job.Name)
+		}
+	})
+}
+
+func TestHeartbeatHandler(t *testing.T) {
+	service := NewService()
+	require.NoError(t, service.RegisterInstance(&ServiceInstance{ID: "vault-1", ServiceName: "vault", Address: "vault", Port: 8080}))
+	require.NoError(t, service.UpdateInstanceHealth("vault-1", HealthStatusUnhealthy))
+	service.SetHealthPushToken("push-token")
+	handler := service.HeartbeatHandler()
+
+	beat := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/instances/heartbeat", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, beat("wrong", `{"instance_id": "vault-1"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, beat("push-token", `{}`).Code)
+	assert.Equal(t, http.StatusNotFound, beat("push-token", `{"instance_id": "ghost"}`).Code)
+	assert.Equal(t, HealthStatusUnhealthy, service.GetInstances("vault")[0].Health)
+
+	assert.Equal(t, http.StatusNoContent, beat("push-token", `{"instance_id": "vault-1"}`).Code)
+	assert.Equal(t, HealthStatusHealthy, service.GetInstances("vault")[0].Health)
+}
@@ -2,6 +2,7 @@ package apigateway
 
 import (
 	"context"
+	"sync"
 	"time"
 )
 
@@ -16,6 +17,17 @@ type ServiceRoute struct {
 	Metadata    map[string]string `json:"metadata"`
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
+
+	// RateLimitMode selects how requests over the rate limit are handled
+	RateLimitMode RateLimitMode `json:"rate_limit_mode,omitempty"`
+	// MaxQueueWait bounds how long a queued request may wait for capacity
+	MaxQueueWait time.Duration `json:"max_queue_wait,omitempty"`
+	// Cost is the number of rate limit tokens a request consumes (0 counts as 1)
+	Cost int `json:"cost,omitempty"`
+	// RateLimit and RateLimitWindow, when set, replace the default tier's
+	// limit for callers of this route without a tier assignment or override
+	RateLimit       int           `json:"rate_limit,omitempty"`
+	RateLimitWindow time.Duration `json:"rate_limit_window,omitempty"`
 }
 
 // ServiceInstance represents a service instance in the registry
@@ -53,35 +65,72 @@ func (h HealthStatus) String() string {
 	}
 }
 
-// RateLimiter represents a rate limiter for a user or IP
+// RateLimiter represents a rate limiter for a user or IP. It is safe for
+// concurrent use: Limit and Window are fixed once it is handed out, and the
+// Requests and ResetAt of the current window should be read through Status.
 type RateLimiter struct {
 	ID       string    `json:"id"`
 	Limit    int       `json:"limit"`
 	Window   time.Duration `json:"window"`
 	Requests int       `json:"requests"`
 	ResetAt  time.Time `json:"reset_at"`
+	// Algorithm is how requests are counted. A token bucket limiter refills
+	// Limit tokens every Window and leaves Requests and ResetAt unused.
+	Algorithm RateLimitAlgorithm `json:"algorithm"`
+
+	// tier is the limit the limiter was created with
+	tier   RateLimitTier
+	bucket *TokenBucket
+	mu     sync.Mutex
 }
 
 // Allow checks if a request is allowed under the rate limit
 func (r *RateLimiter) Allow() bool {
-	now := time.Now()
-	
+	return r.AllowN(1)
+}
+
+// AllowN checks if a request costing n tokens is allowed under the rate limit.
+// Tokens are only consumed when all n are available.
+func (r *RateLimiter) AllowN(n int) bool {
+	if r.bucket != nil {
+		return r.bucket.AllowN(n)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.allow(time.Now(), n)
+}
+
+// allow consumes n requests from the current window; callers must hold r.mu
+func (r *RateLimiter) allow(now time.Time, n int) bool {
+	if n < 1 {
+		n = 1
+	}
+
 	// Reset if window has passed
-	if now.After(r.ResetAt) {
+	if !now.Before(r.ResetAt) {
 		r.Requests = 0
 		r.ResetAt = now.Add(r.Window)
 	}
 	
-	if r.Requests >= r.Limit {
+	if r.Requests+n > r.Limit {
 		return false
 	}
 	
-	r.Requests++
+	r.Requests += n
 	return true
 }
 
 // Status returns the current rate limit status
 func (r *RateLimiter) Status() *RateLimitStatus {
+	if r.bucket != nil {
+		return r.bucket.Status()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	remaining := r.Limit - r.Requests
 	if remaining < 0 {
 		remaining = 0
@@ -133,7 +182,7 @@ type ProxyConfig struct {
 	RetryAttempts   int           `json:"retry_attempts"`
 	RetryDelay      time.Duration `json:"retry_delay"`
 	CircuitBreaker  bool          `json:"circuit_breaker"`
-	LoadBalancer    string        `json:"load_balancer"` // round_robin, least_connections, etc.
+	LoadBalancer    string        `json:"load_balancer"` // round_robin, least_connections or random
 }
 
 // CircuitBreaker represents a circuit breaker for a service
@@ -144,6 +193,17 @@ type CircuitBreaker struct {
 	FailureThreshold int         `json:"failure_threshold"`
 	Timeout        time.Duration `json:"timeout"`
 	LastFailure    time.Time     `json:"last_failure"`
+	// MaxTimeout caps the open timeout as it doubles with consecutive trips
+	MaxTimeout time.Duration `json:"max_timeout"`
+	// Trips counts the times the circuit opened since calls last recovered
+	Trips int `json:"trips"`
+	// Successes counts the calls in a row that succeeded
+	Successes int `json:"successes"`
+	// MaxProbes limits the calls let through at once while half-open
+	MaxProbes     int           `json:"max_probes"`
+	ProbeLifetime time.Duration `json:"probe_lifetime"`
+	Probes        int           `json:"probes"`
+	HalfOpenSince time.Time     `json:"half_open_since"`
 }
 
 // CircuitState represents the state of a circuit breaker
@@ -0,0 +1,320 @@
+package apigateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/google/uuid"
+)
+
+// MaxProxyRequestBytes caps the body of a request the proxy forwards; bodies
+// are buffered so middleware can inspect them and retries can resend them
+const MaxProxyRequestBytes = 10 << 20
+
+// hopHeaders are meaningful only for a single connection and are not forwarded
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// idempotentMethods may be retried without repeating a side effect
+var idempotentMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodOptions: true,
+	http.MethodPut: true, http.MethodDelete: true,
+}
+
+// ProxyHandler forwards requests, after the registered middleware, to the
+// service of the route with the longest matching path prefix. It responds with
+// 404 when no route matches, 502 when the service cannot be reached, 503 while
+// its circuit is open and 504 when the proxy timeout expires.
+func (s *Service) ProxyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := s.MatchRoute(r.URL.Path)
+		if route == nil {
+			http.Error(w, fmt.Sprintf("no route for path '%s'", r.URL.Path), http.StatusNotFound)
+			return
+		}
+		if len(route.Methods) > 0 && !containsFold(route.Methods, r.Method) {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxProxyRequestBytes+1))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(body) > MaxProxyRequestBytes {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Only middleware may say who the user is; a client-supplied
+		// X-User-ID is dropped so it cannot impersonate another user
+		header := r.Header.Clone()
+		header.Del("X-User-ID")
+
+		// Middleware edits the request's copy, so changes show against headers
+		headers := singleHeaders(header)
+		req := &Request{
+			ID:       header.Get("X-Request-ID"),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Headers:  singleHeaders(header),
+			Body:     body,
+			ClientIP: clientIP(r),
+		}
+		if req.ID == "" {
+			req.ID = uuid.New().String()
+		}
+		// Registered middleware runs in priority order, or only the ones the
+		// route names in its Middleware
+		req, err = s.runMiddleware(r.Context(), route, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		for name := range headers {
+			if _, ok := req.Headers[name]; !ok {
+				header.Del(name)
+			}
+		}
+		for name, value := range req.Headers {
+			if headers[name] != value {
+				header.Set(name, value)
+			}
+		}
+		if req.UserID != "" {
+			header.Set("X-User-ID", req.UserID)
+		}
+		header.Set("X-Request-ID", req.ID)
+		if prior := header.Get("X-Forwarded-For"); prior != "" {
+			header.Set("X-Forwarded-For", prior+", "+req.ClientIP)
+		} else {
+			header.Set("X-Forwarded-For", req.ClientIP)
+		}
+		removeHopHeaders(header)
+
+		s.forward(w, r, route, req, header)
+	})
+}
+
+// runMiddleware passes req through the middleware that applies to route
+func (s *Service) runMiddleware(ctx context.Context, route *ServiceRoute, req *Request) (*Request, error) {
+	for _, middleware := range s.GetMiddlewares() {
+		if len(route.Middleware) > 0 && !containsFold(route.Middleware, middleware.Name) {
+			continue
+		}
+		next, err := middleware.Handler(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("rejected by middleware %s: %w", middleware.Name, err)
+		}
+		if next != nil {
+			req = next
+		}
+	}
+	return req, nil
+}
+
+// forward sends req to the route's service, retrying failed attempts, and
+// writes the final response or error to w
+func (s *Service) forward(w http.ResponseWriter, r *http.Request, route *ServiceRoute, req *Request, header http.Header) {
+	s.mu.RLock()
+	config := *s.config
+	s.mu.RUnlock()
+
+	attempts := 1
+	if idempotentMethods[req.Method] && config.RetryAttempts > 0 {
+		attempts += config.RetryAttempts
+	}
+
+	var (
+		resp  *http.Response
+		done  func()
+		retry bool
+	)
+	policy := core.RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   config.RetryDelay,
+		Multiplier:  1,
+		Retryable:   func(error) bool { return retry },
+	}
+	err := core.Retry(r.Context(), policy, func(attempt int) error {
+		var err error
+		resp, done, retry, err = s.proxyAttempt(r, route, req, header, config.Timeout)
+		if err != nil {
+			return err
+		}
+		// The last attempt's 5xx response is passed on to the client as is
+		if resp.StatusCode >= 500 && attempt < attempts {
+			done()
+			return fmt.Errorf("%s responded with status %d", route.ServiceName, resp.StatusCode)
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(r.Context().Err(), context.Canceled) {
+			writeProxyError(w, err)
+		}
+		return
+	}
+	copyResponse(w, resp)
+	done()
+}
+
+// proxyAttempt sends req once to an instance of the route's service. On
+// success, done must be called once the response has been read. retry reports
+// whether a failed attempt may be retried.
+func (s *Service) proxyAttempt(r *http.Request, route *ServiceRoute, req *Request, header http.Header, timeout time.Duration) (resp *http.Response, done func(), retry bool, err error) {
+	base, instanceID, err := s.resolveService(route.ServiceName, req.Path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	ctx, cancel := r.Context(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	target := base + req.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	out, err := http.NewRequestWithContext(ctx, req.Method, target, bytes.NewReader(req.Body))
+	if err != nil {
+		cancel()
+		return nil, nil, false, err
+	}
+	out.Header = header.Clone()
+	if err := PropagateRequestBudget(out); err != nil {
+		cancel()
+		return nil, nil, false, err
+	}
+	s.mu.RLock()
+	auth := s.serviceAuth
+	s.mu.RUnlock()
+	if err := auth.Sign(out, ServiceName); err != nil {
+		cancel()
+		return nil, nil, false, err
+	}
+
+	probe, err := s.allowCall(route.ServiceName)
+	if err != nil {
+		cancel()
+		return nil, nil, false, err
+	}
+	if instanceID != "" {
+		s.IncrementConnections(instanceID)
+	}
+	done = func() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if instanceID != "" {
+			s.DecrementConnections(instanceID)
+		}
+		cancel()
+	}
+
+	start := time.Now()
+	resp, err = s.client().Do(out)
+	// A client that went away says nothing about the service
+	clientGone := errors.Is(r.Context().Err(), context.Canceled)
+	if instanceID != "" && !clientGone {
+		s.RecordLatency(instanceID, time.Since(start))
+	}
+	if err != nil {
+		if !clientGone {
+			s.recordCall(route.ServiceName, false, probe)
+		}
+		done()
+		return nil, nil, true, fmt.Errorf("call to %s failed: %w", route.ServiceName, err)
+	}
+	s.recordCall(route.ServiceName, resp.StatusCode < 500, probe)
+	return resp, done, true, nil
+}
+
+// writeProxyError responds with the status describing why a request could not
+// be forwarded
+func writeProxyError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrBudgetExhausted):
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// copyResponse streams resp to w, flushing as data arrives so long-lived
+// responses such as event streams reach the client without delay
+func copyResponse(w http.ResponseWriter, resp *http.Response) {
+	header := w.Header()
+	for name, values := range resp.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	removeHopHeaders(header)
+	w.WriteHeader(resp.StatusCode)
+
+	controller := http.NewResponseController(w)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return
+			}
+			controller.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// singleHeaders returns the first value of each header
+func singleHeaders(header http.Header) map[string]string {
+	values := make(map[string]string, len(header))
+	for name := range header {
+		values[name] = header.Get(name)
+	}
+	return values
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, name := range header.Values("Connection") {
+		for _, field := range strings.Split(name, ",") {
+			header.Del(strings.TrimSpace(field))
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// clientIP returns the address of the connection a request arrived on
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package apigateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyHandler(t *testing.T) {
+	setup := func(t *testing.T, handler http.HandlerFunc) *Service {
+		service := NewService()
+		service.config.RetryDelay = time.Millisecond
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/api/v1/workflows", Target: "http://flow:8082"}))
+		registerFakeService(t, service, "flow", handler)
+		return service
+	}
+	proxy := func(service *Service, method, target string, body io.Reader) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("X-User-ID", "user1")
+		service.ProxyHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("should forward the request through the middleware chain", func(t *testing.T) {
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "/api/v1/workflows/7/run", r.URL.Path)
+			assert.Equal(t, "dry_run=true", r.URL.RawQuery)
+			assert.Equal(t, `{"inputs":{}}`, string(body))
+			assert.Equal(t, "logging,auth", r.Header.Get("X-Middleware"))
+			assert.Equal(t, "service-account", r.Header.Get("X-User-ID"))
+			assert.Equal(t, "192.0.2.1", r.Header.Get("X-Forwarded-For"))
+			assert.NotEmpty(t, r.Header.Get("X-Request-ID"))
+			w.Header().Set("X-Execution-ID", "42")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"status":"running"}`))
+		})
+		service.AddMiddleware(&Middleware{Name: "auth", Priority: 20, Handler: func(ctx context.Context, req *Request) (*Request, error) {
+			req.Headers["X-Middleware"] += ",auth"
+			req.UserID = "service-account"
+			return req, nil
+		}})
+		service.AddMiddleware(&Middleware{Name: "logging", Priority: 10, Handler: func(ctx context.Context, req *Request) (*Request, error) {
+			req.Headers["X-Middleware"] = "logging"
+			return req, nil
+		}})
+
+		rec := proxy(service, http.MethodPost, "/api/v1/workflows/7/run?dry_run=true", strings.NewReader(`{"inputs":{}}`))
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "42", rec.Header().Get("X-Execution-ID"))
+		assert.JSONEq(t, `{"status":"running"}`, rec.Body.String())
+	})
+
+	t.Run("should not forward a client-supplied user ID", func(t *testing.T) {
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, r.Header.Values("X-User-ID"))
+		})
+		var seen string
+		service.AddMiddleware(&Middleware{Name: "logging", Priority: 10, Handler: func(ctx context.Context, req *Request) (*Request, error) {
+			seen = req.UserID + req.Headers["X-User-Id"]
+			return req, nil
+		}})
+
+		rec := proxy(service, http.MethodGet, "/api/v1/workflows", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, seen)
+	})
+
+	t.Run("should only run the middleware a route names", func(t *testing.T) {
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/api/v1/workflows/public", Target: "http://flow:8082", Middleware: []string{"logging"}}))
+		service.AddMiddleware(&Middleware{Name: "auth", Priority: 20, Handler: func(ctx context.Context, req *Request) (*Request, error) {
+			return nil, errors.New("missing token")
+		}})
+		service.AddMiddleware(&Middleware{Name: "logging", Priority: 10, Handler: func(ctx context.Context, req *Request) (*Request, error) { return req, nil }})
+
+		rec := proxy(service, http.MethodGet, "/api/v1/workflows", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "rejected by middleware auth: missing token")
+
+		rec = proxy(service, http.MethodGet, "/api/v1/workflows/public", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("should reject unrouted paths and methods", func(t *testing.T) {
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {})
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "vault", Path: "/api/v1/secrets", Target: "http://vault:8080", Methods: []string{"GET"}}))
+
+		assert.Equal(t, http.StatusNotFound, proxy(service, http.MethodGet, "/api/v1/unknown", nil).Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, proxy(service, http.MethodDelete, "/api/v1/secrets/db", nil).Code)
+	})
+
+	t.Run("should respond 502 without a healthy instance", func(t *testing.T) {
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {})
+		for _, instance := range service.GetInstances("flow") {
+			require.NoError(t, service.UpdateInstanceHealth(instance.ID, HealthStatusUnhealthy))
+		}
+
+		rec := proxy(service, http.MethodGet, "/api/v1/workflows", nil)
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+		assert.Contains(t, rec.Body.String(), "no healthy instance")
+	})
+
+	t.Run("should respond 504 when the timeout expires", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		})
+		service.config.Timeout = 20 * time.Millisecond
+		service.config.RetryAttempts = 1
+
+		rec := proxy(service, http.MethodGet, "/api/v1/workflows", nil)
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	})
+
+	t.Run("should retry idempotent requests that fail", func(t *testing.T) {
+		var calls atomic.Int32
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+
+		rec := proxy(service, http.MethodGet, "/api/v1/workflows", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "ok", rec.Body.String())
+		assert.Equal(t, int32(3), calls.Load())
+
+		calls.Store(0)
+		rec = proxy(service, http.MethodPost, "/api/v1/workflows", strings.NewReader("{}"))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "a POST is not retried")
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("should open the circuit after repeated failures", func(t *testing.T) {
+		var calls atomic.Int32
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+		service.config.RetryAttempts = 0
+
+		for i := 0; i < DefaultFailureThreshold; i++ {
+			assert.Equal(t, http.StatusInternalServerError, proxy(service, http.MethodGet, "/api/v1/workflows", nil).Code)
+		}
+		assert.Equal(t, CircuitStateOpen, service.CircuitBreakerState("flow"))
+
+		rec := proxy(service, http.MethodGet, "/api/v1/workflows", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, rec.Body.String(), ErrCircuitOpen.Error())
+		assert.Equal(t, int32(DefaultFailureThreshold), calls.Load())
+	})
+
+	t.Run("should release the instance's connection once the response is sent", func(t *testing.T) {
+		service := setup(t, func(w http.ResponseWriter, r *http.Request) {})
+		instanceID := service.GetInstances("flow")[0].ID
+
+		assert.Equal(t, http.StatusOK, proxy(service, http.MethodGet, "/api/v1/workflows", nil).Code)
+		assert.Zero(t, service.ActiveConnections(instanceID))
+	})
+}
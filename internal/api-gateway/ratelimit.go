@@ -0,0 +1,198 @@
+package apigateway
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+// RateLimitMode selects how a route handles requests over its rate limit
+type RateLimitMode string
+
+const (
+	// RateLimitModeReject responds with 429 as soon as the limit is reached
+	RateLimitModeReject RateLimitMode = "reject"
+	// RateLimitModeQueue holds the request until capacity frees up or the max wait elapses
+	RateLimitModeQueue RateLimitMode = "queue"
+)
+
+// DefaultMaxQueueWait is used for queued routes without a MaxQueueWait
+const DefaultMaxQueueWait = 2 * time.Second
+
+// DefaultRateLimiterPruneInterval is how often a started gateway evicts the
+// limiters of idle callers
+const DefaultRateLimiterPruneInterval = time.Minute
+
+const rateLimiterPruneJobName = "gateway.rate-limiter-prune"
+
+// authenticatedUserKey is the context key of the user a request was
+// authenticated as
+type authenticatedUserKey struct{}
+
+// WithAuthenticatedUser returns a context recording the user AuthHandler
+// verified the request for. Rate limits key and tier requests by it; a
+// client's X-User-ID header is never trusted for this.
+func WithAuthenticatedUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, authenticatedUserKey{}, userID)
+}
+
+// ErrRateLimited is returned when a request cannot be admitted under the rate limit
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Wait blocks until the limiter admits a request. It fails with ErrRateLimited without
+// waiting when capacity would not free up within maxWait or the context deadline.
+func (r *RateLimiter) Wait(ctx context.Context, maxWait time.Duration) error {
+	return r.WaitN(ctx, 1, maxWait)
+}
+
+// WaitN blocks until the limiter admits a request costing n tokens. A request
+// costing more than the limit can never be admitted and fails immediately.
+func (r *RateLimiter) WaitN(ctx context.Context, n int, maxWait time.Duration) error {
+	deadline := time.Now().Add(maxWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	for {
+		wait, ok, possible := r.reserve(n)
+		if !possible {
+			return ErrRateLimited
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return ErrRateLimited
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve consumes n requests if they are available, otherwise it returns the time
+// until the current window resets, or the bucket refills enough, and whether n
+// can ever fit in a window
+func (r *RateLimiter) reserve(n int) (time.Duration, bool, bool) {
+	if r.bucket != nil {
+		return r.bucket.reserve(n)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.allow(now, n) {
+		return 0, true, true
+	}
+	return r.ResetAt.Sub(now), false, n <= r.Limit
+}
+
+// RateLimitHandler enforces per-client rate limits on requests matching a registered
+// route, rejecting or queueing excess requests according to the route's RateLimitMode.
+// Each request consumes the route's Cost in tokens from the route's RateLimit, or
+// the caller's tier. Responses carry the limit, the tokens remaining and the Unix
+// time the window resets in X-RateLimit-Limit, -Remaining and -Reset.
+func (s *Service) RateLimitHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := s.MatchRoute(r.URL.Path)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limiter := s.GetRateLimiter(route.ID + ":" + clientIdentifier(r))
+
+		var err error
+		if route.RateLimitMode == RateLimitModeQueue {
+			maxWait := route.MaxQueueWait
+			if maxWait == 0 {
+				maxWait = DefaultMaxQueueWait
+			}
+			err = limiter.WaitN(r.Context(), route.Cost, maxWait)
+		} else if !limiter.AllowN(route.Cost) {
+			err = ErrRateLimited
+		}
+
+		status := limiter.Status()
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(status.ResetAt.Unix(), 10))
+
+		switch {
+		case errors.Is(err, ErrRateLimited):
+			retryAfter := math.Ceil(time.Until(status.ResetAt).Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(retryAfter, 1))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			http.Error(w, ErrBudgetExhausted.Error(), http.StatusGatewayTimeout)
+			return
+		case err != nil:
+			// The client went away while queued
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIdentifier identifies the caller by the user it was authenticated as,
+// falling back to the remote IP
+func clientIdentifier(r *http.Request) string {
+	if userID, _ := r.Context().Value(authenticatedUserKey{}).(string); userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + clientIP(r)
+}
+
+// pruneRateLimiters evicts the limiters a new one would replace unchanged: a
+// fixed window that is unused or has ended, or a token bucket that has
+// refilled. Only callers that are being limited keep state. It returns how
+// many limiters were evicted.
+func (s *Service) pruneRateLimiters(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for identifier, limiter := range s.rateLimiters {
+		if limiter.idle(now) {
+			delete(s.rateLimiters, identifier)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// startRateLimiterPrune schedules the eviction of idle callers' limiters
+func (s *Service) startRateLimiterPrune() error {
+	return s.scheduler.Register(core.Job{
+		Name:     rateLimiterPruneJobName,
+		Schedule: core.Every(DefaultRateLimiterPruneInterval),
+		Run: func(ctx context.Context) error {
+			s.pruneRateLimiters(time.Now())
+			return nil
+		},
+	})
+}
+
+// idle reports whether the limiter holds no state a new one would not
+func (r *RateLimiter) idle(now time.Time) bool {
+	if r.bucket != nil {
+		return r.bucket.full(now)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Requests == 0 || !now.Before(r.ResetAt)
+}
@@ -0,0 +1,318 @@
+package apigateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRateLimitedGateway(t *testing.T, mode RateLimitMode, maxWait time.Duration, window time.Duration) http.Handler {
+	service := NewService()
+	service.SetRateLimit(1, window)
+	require.NoError(t, service.RegisterRoute(&ServiceRoute{
+		ServiceName:   "flow",
+		Path:          "/api/v1/workflows",
+		Target:        "http://localhost:8082",
+		RateLimitMode: mode,
+		MaxQueueWait:  maxWait,
+	}))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return service.RateLimitHandler(ok)
+}
+
+func serveWorkflows(handler http.Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/workflows", nil)
+	req.Header.Set("X-User-ID", "user1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	t.Run("should reject requests over the limit in reject mode", func(t *testing.T) {
+		handler := setupRateLimitedGateway(t, RateLimitModeReject, 0, time.Minute)
+
+		assert.Equal(t, http.StatusOK, serveWorkflows(handler).Code)
+		rec := serveWorkflows(handler)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("should queue requests until capacity frees up in queue mode", func(t *testing.T) {
+		window := 100 * time.Millisecond
+		handler := setupRateLimitedGateway(t, RateLimitModeQueue, time.Second, window)
+
+		assert.Equal(t, http.StatusOK, serveWorkflows(handler).Code)
+
+		start := time.Now()
+		rec := serveWorkflows(handler)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.GreaterOrEqual(t, time.Since(start), window/2)
+	})
+
+	t.Run("should admit concurrent queued requests one window at a time", func(t *testing.T) {
+		handler := setupRateLimitedGateway(t, RateLimitModeQueue, time.Second, 50*time.Millisecond)
+
+		var wg sync.WaitGroup
+		codes := make([]int, 3)
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = serveWorkflows(handler).Code
+			}(i)
+		}
+		wg.Wait()
+
+		for _, code := range codes {
+			assert.Equal(t, http.StatusOK, code)
+		}
+	})
+
+	t.Run("should still reject when the wait exceeds the max queue wait", func(t *testing.T) {
+		handler := setupRateLimitedGateway(t, RateLimitModeQueue, 10*time.Millisecond, time.Minute)
+
+		assert.Equal(t, http.StatusOK, serveWorkflows(handler).Code)
+
+		start := time.Now()
+		rec := serveWorkflows(handler)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("should report when the window resets", func(t *testing.T) {
+		handler := setupRateLimitedGateway(t, RateLimitModeReject, 0, time.Minute)
+
+		first := serveWorkflows(handler)
+		assert.Equal(t, "0", first.Header().Get("X-RateLimit-Remaining"))
+		reset, err := strconv.ParseInt(first.Header().Get("X-RateLimit-Reset"), 10, 64)
+		require.NoError(t, err)
+		assert.InDelta(t, time.Now().Add(time.Minute).Unix(), reset, 2)
+
+		rec := serveWorkflows(handler)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, first.Header().Get("X-RateLimit-Reset"), rec.Header().Get("X-RateLimit-Reset"))
+	})
+
+	t.Run("should not limit unregistered paths", func(t *testing.T) {
+		handler := setupRateLimitedGateway(t, RateLimitModeReject, 0, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	t.Run("should give up when the context deadline is sooner than the reset", func(t *testing.T) {
+		limiter := &RateLimiter{ID: "user1", Limit: 1, Window: time.Minute, ResetAt: time.Now().Add(time.Minute)}
+		require.True(t, limiter.Allow())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, limiter.Wait(ctx, time.Hour), ErrRateLimited)
+	})
+}
+
+func TestPruneRateLimiters(t *testing.T) {
+	service := NewService()
+	service.SetRateLimit(2, time.Minute)
+	require.NoError(t, service.SetRateLimitAlgorithm("bucket-user", RateLimitAlgorithmTokenBucket))
+
+	require.True(t, service.GetRateLimiter("busy").Allow())
+	service.GetRateLimiter("unused")
+	require.True(t, service.GetRateLimiter("bucket-user").Allow())
+
+	assert.Equal(t, 1, service.pruneRateLimiters(time.Now()), "only the unused limiter is idle")
+	assert.Len(t, service.rateLimiters, 2)
+
+	// Once the window ends and the bucket refills, nothing is left to keep
+	assert.Equal(t, 2, service.pruneRateLimiters(time.Now().Add(time.Minute)))
+	assert.Empty(t, service.rateLimiters)
+}
+
+// Run with -race: the limiter is shared by every request from the same client
+func TestRateLimiterConcurrency(t *testing.T) {
+	service := NewService()
+	service.SetRateLimit(100, time.Minute)
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			limiter := service.GetRateLimiter("user1")
+			cost := 1 + i%2
+			for j := 0; j < 20; j++ {
+				if limiter.AllowN(cost) {
+					allowed.Add(int64(cost))
+				}
+				status := limiter.Status()
+				assert.GreaterOrEqual(t, status.Remaining, 0)
+				assert.LessOrEqual(t, int(allowed.Load()), status.Limit)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every admitted token is accounted for, and no more than the limit were admitted
+	remaining := service.GetRateLimiter("user1").Status().Remaining
+	assert.Equal(t, 100, int(allowed.Load())+remaining)
+	assert.LessOrEqual(t, remaining, 1)
+}
+
+func TestRouteRateLimit(t *testing.T) {
+	t.Run("should admit exactly the route's limit of concurrent requests", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{
+			ServiceName:     "flow",
+			Path:            "/api/v1/workflows",
+			Target:          "http://localhost:8082",
+			RateLimit:       25,
+			RateLimitWindow: time.Minute,
+		}))
+		handler := service.RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		var (
+			wg       sync.WaitGroup
+			admitted atomic.Int64
+			rejected atomic.Int64
+		)
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				switch serveWorkflows(handler).Code {
+				case http.StatusOK:
+					admitted.Add(1)
+				case http.StatusTooManyRequests:
+					rejected.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int64(25), admitted.Load())
+		assert.Equal(t, int64(75), rejected.Load())
+	})
+
+	t.Run("should give way to the caller's tier", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{
+			ID:              "route-1",
+			ServiceName:     "flow",
+			Path:            "/api/v1/workflows",
+			Target:          "http://localhost:8082",
+			RateLimit:       5,
+			RateLimitWindow: time.Second,
+		}))
+		require.NoError(t, service.AssignRateLimitTier("alice", RateLimitTierPro))
+
+		assert.Equal(t, 5, service.GetRateLimiter("route-1:user:bob").Limit)
+		assert.Equal(t, time.Second, service.GetRateLimiter("route-1:user:bob").Window)
+		assert.Equal(t, 1000, service.GetRateLimiter("route-1:user:alice").Limit)
+		assert.Equal(t, 100, service.GetRateLimiter("route-2:user:bob").Limit)
+	})
+
+	t.Run("should reject incomplete limits", func(t *testing.T) {
+		service := NewService()
+		err := service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/a", Target: "http://localhost", RateLimit: 5})
+		assert.ErrorContains(t, err, "must be set together")
+		err = service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/b", Target: "http://localhost", RateLimit: -1, RateLimitWindow: time.Second})
+		assert.ErrorContains(t, err, "cannot be negative")
+	})
+}
+
+func TestRouteRateLimitMode(t *testing.T) {
+	service := NewService()
+	err := service.RegisterRoute(&ServiceRoute{
+		ServiceName:   "flow",
+		Path:          "/api/v1/workflows",
+		Target:        "http://localhost:8082",
+		RateLimitMode: "drop",
+	})
+	assert.ErrorContains(t, err, "invalid rate limit mode")
+}
+
+func TestWeightedRateLimiting(t *testing.T) {
+	newLimiter := func(limit int) *RateLimiter {
+		return &RateLimiter{ID: "user1", Limit: limit, Window: time.Minute, ResetAt: time.Now().Add(time.Minute)}
+	}
+
+	t.Run("should consume the requested number of tokens", func(t *testing.T) {
+		limiter := newLimiter(10)
+		assert.True(t, limiter.AllowN(4))
+		assert.Equal(t, 6, limiter.Status().Remaining)
+		assert.True(t, limiter.Allow())
+		assert.Equal(t, 5, limiter.Status().Remaining)
+	})
+
+	t.Run("should reject without consuming when too few tokens remain", func(t *testing.T) {
+		limiter := newLimiter(10)
+		require.True(t, limiter.AllowN(8))
+
+		assert.False(t, limiter.AllowN(3))
+		assert.Equal(t, 2, limiter.Status().Remaining)
+		assert.True(t, limiter.AllowN(2))
+	})
+
+	t.Run("should fail fast when the cost exceeds the limit", func(t *testing.T) {
+		limiter := newLimiter(5)
+		err := limiter.WaitN(context.Background(), 6, time.Hour)
+		assert.ErrorIs(t, err, ErrRateLimited)
+		assert.Equal(t, 5, limiter.Status().Remaining)
+	})
+
+	t.Run("should charge the route cost per request", func(t *testing.T) {
+		service := NewService()
+		service.SetRateLimit(10, time.Minute)
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{
+			ServiceName: "sync",
+			Path:        "/api/v1/imports",
+			Target:      "http://localhost:8084",
+			Cost:        4,
+		}))
+		handler := service.RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		serve := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/imports", nil)
+			req.Header.Set("X-User-ID", "user1")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return rec
+		}
+
+		first := serve()
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, "6", first.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, http.StatusOK, serve().Code)
+
+		// Two tokens remain, fewer than the import costs
+		third := serve()
+		assert.Equal(t, http.StatusTooManyRequests, third.Code)
+		assert.Equal(t, "2", third.Header().Get("X-RateLimit-Remaining"))
+	})
+
+	t.Run("should reject negative route costs", func(t *testing.T) {
+		service := NewService()
+		err := service.RegisterRoute(&ServiceRoute{ServiceName: "sync", Path: "/x", Target: "http://localhost", Cost: -1})
+		assert.Error(t, err)
+	})
+}
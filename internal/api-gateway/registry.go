@@ -0,0 +1,357 @@
+package apigateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultRegistrySyncInterval is how often a started gateway reloads its
+// registry store to pick up changes made by other replicas
+const DefaultRegistrySyncInterval = 30 * time.Second
+
+const registrySyncJobName = "gateway.registry-sync"
+
+// RegistryStore persists the gateway's routes and service instances. Rate
+// limiter state is not persisted: it only covers the current window.
+type RegistryStore interface {
+	LoadRoutes(ctx context.Context) ([]*ServiceRoute, error)
+	SaveRoute(ctx context.Context, route *ServiceRoute) error
+	LoadInstances(ctx context.Context) ([]*ServiceInstance, error)
+	SaveInstance(ctx context.Context, instance *ServiceInstance) error
+	DeleteInstance(ctx context.Context, id string) error
+}
+
+// MemoryRegistryStore keeps the registry in memory, so it is lost on restart.
+// It is the default store.
+type MemoryRegistryStore struct {
+	mu        sync.RWMutex
+	routes    map[string]ServiceRoute
+	instances map[string]ServiceInstance
+}
+
+// NewMemoryRegistryStore creates an empty in-memory registry store
+func NewMemoryRegistryStore() *MemoryRegistryStore {
+	return &MemoryRegistryStore{
+		routes:    make(map[string]ServiceRoute),
+		instances: make(map[string]ServiceInstance),
+	}
+}
+
+func (m *MemoryRegistryStore) LoadRoutes(ctx context.Context) ([]*ServiceRoute, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	routes := make([]*ServiceRoute, 0, len(m.routes))
+	for _, route := range m.routes {
+		route := route
+		routes = append(routes, &route)
+	}
+	return routes, nil
+}
+
+func (m *MemoryRegistryStore) SaveRoute(ctx context.Context, route *ServiceRoute) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes[route.ID] = *route
+	return nil
+}
+
+func (m *MemoryRegistryStore) LoadInstances(ctx context.Context) ([]*ServiceInstance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	instances := make([]*ServiceInstance, 0, len(m.instances))
+	for _, instance := range m.instances {
+		instance := instance
+		instances = append(instances, &instance)
+	}
+	return instances, nil
+}
+
+func (m *MemoryRegistryStore) SaveInstance(ctx context.Context, instance *ServiceInstance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[instance.ID] = *instance
+	return nil
+}
+
+func (m *MemoryRegistryStore) DeleteInstance(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.instances, id)
+	return nil
+}
+
+// RouteRecord is a ServiceRoute stored by a DBRegistryStore
+type RouteRecord struct {
+	ID        string `gorm:"primaryKey"`
+	Route     string `gorm:"type:text;not null"` // JSON-encoded ServiceRoute
+	UpdatedAt time.Time
+}
+
+// TableName returns the table name for the RouteRecord model
+func (RouteRecord) TableName() string {
+	return "gateway_routes"
+}
+
+// InstanceRecord is a ServiceInstance stored by a DBRegistryStore
+type InstanceRecord struct {
+	ID        string `gorm:"primaryKey"`
+	Instance  string `gorm:"type:text;not null"` // JSON-encoded ServiceInstance
+	UpdatedAt time.Time
+}
+
+// TableName returns the table name for the InstanceRecord model
+func (InstanceRecord) TableName() string {
+	return "gateway_instances"
+}
+
+// DBRegistryStore keeps the registry in the database, so it survives restarts
+// and is shared by every gateway replica using the same database. The
+// RouteRecord and InstanceRecord tables must have been migrated.
+type DBRegistryStore struct {
+	db *gorm.DB
+}
+
+// NewDBRegistryStore creates a registry store backed by db
+func NewDBRegistryStore(db *gorm.DB) *DBRegistryStore {
+	return &DBRegistryStore{db: db}
+}
+
+func (d *DBRegistryStore) LoadRoutes(ctx context.Context) ([]*ServiceRoute, error) {
+	var records []RouteRecord
+	if err := d.db.WithContext(ctx).Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load routes: %w", err)
+	}
+	routes := make([]*ServiceRoute, 0, len(records))
+	for _, record := range records {
+		var route ServiceRoute
+		if err := json.Unmarshal([]byte(record.Route), &route); err != nil {
+			return nil, fmt.Errorf("failed to decode route %s: %w", record.ID, err)
+		}
+		routes = append(routes, &route)
+	}
+	return routes, nil
+}
+
+func (d *DBRegistryStore) SaveRoute(ctx context.Context, route *ServiceRoute) error {
+	data, err := json.Marshal(route)
+	if err != nil {
+		return fmt.Errorf("failed to encode route: %w", err)
+	}
+	err = d.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&RouteRecord{ID: route.ID, Route: string(data)}).Error
+	if err != nil {
+		return fmt.Errorf("failed to save route: %w", err)
+	}
+	return nil
+}
+
+func (d *DBRegistryStore) LoadInstances(ctx context.Context) ([]*ServiceInstance, error) {
+	var records []InstanceRecord
+	if err := d.db.WithContext(ctx).Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load instances: %w", err)
+	}
+	instances := make([]*ServiceInstance, 0, len(records))
+	for _, record := range records {
+		var instance ServiceInstance
+		if err := json.Unmarshal([]byte(record.Instance), &instance); err != nil {
+			return nil, fmt.Errorf("failed to decode instance %s: %w", record.ID, err)
+		}
+		instances = append(instances, &instance)
+	}
+	return instances, nil
+}
+
+func (d *DBRegistryStore) SaveInstance(ctx context.Context, instance *ServiceInstance) error {
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return fmt.Errorf("failed to encode instance: %w", err)
+	}
+	err = d.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&InstanceRecord{ID: instance.ID, Instance: string(data)}).Error
+	if err != nil {
+		return fmt.Errorf("failed to save instance: %w", err)
+	}
+	return nil
+}
+
+func (d *DBRegistryStore) DeleteInstance(ctx context.Context, id string) error {
+	if err := d.db.WithContext(ctx).Delete(&InstanceRecord{ID: id}).Error; err != nil {
+		return fmt.Errorf("failed to delete instance: %w", err)
+	}
+	return nil
+}
+
+// SetRegistryStore sets where routes and instances are persisted. Entries
+// registered earlier stay in memory but are not saved to the new store; call
+// LoadRegistry, or Start, to load what the store already holds.
+func (s *Service) SetRegistryStore(store RegistryStore) {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+	s.stored = make(map[string]bool)
+}
+
+// SetDB persists routes and instances in db through a DBRegistryStore, so a
+// restarted gateway rediscovers its topology on Start. A nil db keeps the
+// registry in memory.
+func (s *Service) SetDB(db *gorm.DB) {
+	if db == nil {
+		s.SetRegistryStore(NewMemoryRegistryStore())
+		return
+	}
+	s.SetRegistryStore(NewDBRegistryStore(db))
+}
+
+// SetScheduler sets the scheduler the registry sync and health reaper run on,
+// which is shared with other services. Without one, neither runs.
+func (s *Service) SetScheduler(scheduler *core.Scheduler) {
+	s.scheduler = scheduler
+}
+
+// SetRegistrySyncInterval sets how often a started gateway reloads a
+// persistent registry store
+func (s *Service) SetRegistrySyncInterval(interval time.Duration) {
+	s.syncInterval = interval
+}
+
+// LoadRegistry loads the routes and instances held by the registry store.
+// Stored entries replace in-memory ones with the same ID, and entries that
+// were loaded from the store before but have since been removed from it, e.g.
+// by another replica, are dropped. Entries that were never stored are kept.
+func (s *Service) LoadRegistry(ctx context.Context) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	s.mu.RLock()
+	store := s.store
+	s.mu.RUnlock()
+
+	routes, err := store.LoadRoutes(ctx)
+	if err != nil {
+		return err
+	}
+	instances, err := store.LoadInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded := make(map[string]bool, len(routes)+len(instances))
+	for _, route := range routes {
+		loaded[route.ID] = true
+	}
+	for _, instance := range instances {
+		loaded[instance.ID] = true
+	}
+	for id, route := range s.routes {
+		if s.stored[id] && !loaded[id] {
+			delete(s.routes, route.ID)
+		}
+	}
+	for serviceName, existing := range s.instances {
+		kept := existing[:0]
+		for _, instance := range existing {
+			if !s.stored[instance.ID] || loaded[instance.ID] {
+				kept = append(kept, instance)
+			}
+		}
+		s.instances[serviceName] = kept
+	}
+
+	for _, route := range routes {
+		if existing, ok := s.routes[route.ID]; ok && (existing.RateLimit != route.RateLimit || existing.RateLimitWindow != route.RateLimitWindow) {
+			// Limiters cached for the route would keep its old limit
+			for identifier := range s.rateLimiters {
+				if strings.HasPrefix(identifier, route.ID+":") {
+					delete(s.rateLimiters, identifier)
+				}
+			}
+		}
+		s.routes[route.ID] = route
+	}
+	for _, instance := range instances {
+		s.putInstance(instance)
+	}
+	s.stored = loaded
+	return nil
+}
+
+// Start loads the registry store and, unless it is the in-memory default,
+// reloads it every registry sync interval to pick up other replicas' changes.
+// With an instance TTL set, it also starts the health reaper. Idle callers'
+// rate limiters are evicted every DefaultRateLimiterPruneInterval.
+func (s *Service) Start() {
+	if err := s.LoadRegistry(context.Background()); err != nil {
+		log.Printf("⚠️  Failed to load the gateway registry: %v", err)
+	}
+	if err := s.startRateLimiterPrune(); err != nil {
+		log.Printf("⚠️  Failed to schedule gateway rate limiter pruning: %v", err)
+	}
+	s.mu.RLock()
+	ttl := s.instanceTTL
+	s.mu.RUnlock()
+	if ttl > 0 {
+		if err := s.startHealthReaper(ttl); err != nil {
+			log.Printf("⚠️  Failed to schedule the gateway health reaper: %v", err)
+		}
+	}
+
+	s.mu.RLock()
+	_, inMemory := s.store.(*MemoryRegistryStore)
+	s.mu.RUnlock()
+	if inMemory {
+		return
+	}
+	err := s.scheduler.Register(core.Job{
+		Name:     registrySyncJobName,
+		Schedule: core.Every(s.syncInterval),
+		Run:      s.LoadRegistry,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule gateway registry sync: %v", err)
+	}
+}
+
+// Close stops the registry sync, the health reaper and rate limiter pruning
+func (s *Service) Close(ctx context.Context) error {
+	for _, name := range []string{registrySyncJobName, healthReaperJobName, rateLimiterPruneJobName} {
+		if err := s.scheduler.Unregister(ctx, name); err != nil && !errors.Is(err, core.ErrJobNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// putInstance adds an instance or replaces the one with the same ID; callers
+// must hold s.mu
+func (s *Service) putInstance(instance *ServiceInstance) {
+	for serviceName, instances := range s.instances {
+		for i, existing := range instances {
+			if existing.ID == instance.ID {
+				if serviceName == instance.ServiceName {
+					instances[i] = instance
+					return
+				}
+				s.instances[serviceName] = append(instances[:i], instances[i+1:]...)
+				break
+			}
+		}
+	}
+	s.instances[instance.ServiceName] = append(s.instances[instance.ServiceName], instance)
+}
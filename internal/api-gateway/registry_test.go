@@ -0,0 +1,190 @@
+package apigateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupRegistryDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Each connection to :memory: is a separate database; keep to one
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&RouteRecord{}, &InstanceRecord{}))
+	return db
+}
+
+func TestRegistryStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should keep the registry in memory by default", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "vault", Path: "/api/v1/secrets", Target: "http://vault:8080"}))
+		require.NoError(t, service.RegisterInstance(&ServiceInstance{ID: "vault-1", ServiceName: "vault", Address: "vault", Port: 8080}))
+		service.Start()
+		defer service.Close(ctx)
+
+		assert.Len(t, service.GetRoutes(), 1)
+		assert.NotNil(t, service.MatchRoute("/api/v1/secrets/db"))
+		require.Len(t, service.GetInstances("vault"), 1)
+		require.NoError(t, service.UpdateInstanceHealth("vault-1", HealthStatusHealthy))
+		assert.Equal(t, "vault-1", service.SelectInstance("vault").ID)
+
+		require.NoError(t, service.DeregisterInstance("vault-1"))
+		assert.Empty(t, service.GetInstances("vault"))
+		assert.Empty(t, NewService().GetRoutes())
+	})
+
+	t.Run("should restore routes and instances from the database", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		first := NewService()
+		first.SetRegistryStore(NewDBRegistryStore(db))
+		route := &ServiceRoute{
+			ServiceName: "vault",
+			Path:        "/api/v1/secrets",
+			Target:      "http://vault:8080",
+			Methods:     []string{"GET", "POST"},
+			Metadata:    map[string]string{"team": "platform"},
+		}
+		require.NoError(t, first.RegisterRoute(route))
+		require.NoError(t, first.RegisterInstance(&ServiceInstance{ID: "vault-1", ServiceName: "vault", Address: "vault", Port: 8080}))
+		require.NoError(t, first.UpdateInstanceHealth("vault-1", HealthStatusHealthy))
+
+		restarted := NewService()
+		restarted.SetRegistryStore(NewDBRegistryStore(db))
+		require.NoError(t, restarted.LoadRegistry(ctx))
+
+		routes := restarted.GetRoutes()
+		require.Len(t, routes, 1)
+		assert.Equal(t, route.ID, routes[0].ID)
+		assert.Equal(t, route.Methods, routes[0].Methods)
+		assert.Equal(t, route.Metadata, routes[0].Metadata)
+		assert.Equal(t, "http://vault:8080", restarted.MatchRoute("/api/v1/secrets/db").Target)
+		instances := restarted.GetInstances("vault")
+		require.Len(t, instances, 1)
+		assert.Equal(t, HealthStatusHealthy, instances[0].Health)
+		assert.Equal(t, 8080, restarted.SelectInstance("vault").Port)
+	})
+
+	t.Run("should rediscover the topology on start after SetDB", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		first := NewService()
+		first.SetDB(db)
+		require.NoError(t, first.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/api/v1/workflows", Target: "http://flow:8082"}))
+		require.NoError(t, first.RegisterInstance(&ServiceInstance{ID: "flow-1", ServiceName: "flow", Address: "flow", Port: 8082}))
+		require.NoError(t, first.RegisterInstance(&ServiceInstance{ID: "flow-2", ServiceName: "flow", Address: "flow-2", Port: 8082}))
+		require.NoError(t, first.UpdateInstanceHealth("flow-1", HealthStatusUnhealthy))
+		require.NoError(t, first.DeregisterInstance("flow-2"))
+
+		restarted := NewService()
+		restarted.SetDB(db)
+		restarted.Start()
+		defer restarted.Close(ctx)
+
+		assert.NotNil(t, restarted.MatchRoute("/api/v1/workflows/1"))
+		instances := restarted.GetInstances("flow")
+		require.Len(t, instances, 1)
+		assert.Equal(t, HealthStatusUnhealthy, instances[0].Health)
+
+		restarted.SetDB(nil)
+		require.NoError(t, restarted.RegisterRoute(&ServiceRoute{ServiceName: "vault", Path: "/api/v1/secrets", Target: "http://vault:8080"}))
+		var count int64
+		require.NoError(t, db.Model(&RouteRecord{}).Count(&count).Error)
+		assert.Equal(t, int64(1), count, "without a db the registry stays in memory")
+	})
+
+	t.Run("should share changes between replicas on reload", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		replica1 := NewService()
+		replica1.SetRegistryStore(NewDBRegistryStore(db))
+		replica2 := NewService()
+		replica2.SetRegistryStore(NewDBRegistryStore(db))
+
+		require.NoError(t, replica2.RegisterInstance(&ServiceInstance{ID: "local", ServiceName: "flow", Address: "localhost", Port: 8081}))
+		require.NoError(t, replica1.RegisterInstance(&ServiceInstance{ID: "flow-1", ServiceName: "flow", Address: "flow", Port: 8081}))
+		require.NoError(t, replica2.LoadRegistry(ctx))
+		assert.Len(t, replica2.GetInstances("flow"), 2)
+
+		require.NoError(t, replica1.DeregisterInstance("flow-1"))
+		require.NoError(t, replica2.LoadRegistry(ctx))
+		instances := replica2.GetInstances("flow")
+		require.Len(t, instances, 1)
+		assert.Equal(t, "local", instances[0].ID)
+	})
+
+	t.Run("should write to the store outside the lock and only on changes", func(t *testing.T) {
+		service := NewService()
+		store := &lockCheckingStore{MemoryRegistryStore: NewMemoryRegistryStore(), service: service}
+		service.SetRegistryStore(store)
+		instance := func() *ServiceInstance {
+			return &ServiceInstance{ID: "flow-1", ServiceName: "flow", Address: "flow", Port: 8081}
+		}
+
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/api/v1/workflows", Target: "http://flow:8081"}))
+		require.NoError(t, service.RegisterInstance(instance()))
+		require.NoError(t, service.RegisterInstance(instance()), "registering again unchanged")
+		require.NoError(t, service.UpdateInstanceHealth("flow-1", HealthStatusHealthy), "health unchanged")
+		assert.Equal(t, 2, store.writes)
+
+		require.NoError(t, service.UpdateInstanceHealth("flow-1", HealthStatusUnhealthy))
+		_, err := service.UpdateInstancesHealth([]InstanceHealthUpdate{{InstanceID: "flow-1", Health: HealthStatusUnhealthy}})
+		require.NoError(t, err)
+		require.NoError(t, service.Heartbeat(ctx, "flow-1"))
+		service.reapInstances(ctx, time.Now().Add(time.Hour), time.Second)
+		assert.Equal(t, 5, store.writes)
+		assert.Empty(t, store.locked, "the store was written while the registry lock was held")
+	})
+
+	t.Run("should leave the registry unchanged when the store fails", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		service := NewService()
+		service.SetRegistryStore(NewDBRegistryStore(db))
+		require.NoError(t, db.Migrator().DropTable(&RouteRecord{}))
+
+		err := service.RegisterRoute(&ServiceRoute{ServiceName: "vault", Path: "/api/v1/secrets", Target: "http://vault:8080"})
+		assert.Error(t, err)
+		assert.Empty(t, service.GetRoutes())
+		assert.Error(t, service.LoadRegistry(ctx))
+	})
+}
+
+// lockCheckingStore counts writes and records those made while the service's
+// lock was held
+type lockCheckingStore struct {
+	*MemoryRegistryStore
+	service *Service
+	writes  int
+	locked  []string
+}
+
+func (l *lockCheckingStore) check(id string) {
+	l.writes++
+	if !l.service.mu.TryLock() {
+		l.locked = append(l.locked, id)
+		return
+	}
+	l.service.mu.Unlock()
+}
+
+func (l *lockCheckingStore) SaveRoute(ctx context.Context, route *ServiceRoute) error {
+	l.check(route.ID)
+	return l.MemoryRegistryStore.SaveRoute(ctx, route)
+}
+
+func (l *lockCheckingStore) SaveInstance(ctx context.Context, instance *ServiceInstance) error {
+	l.check(instance.ID)
+	return l.MemoryRegistryStore.SaveInstance(ctx, instance)
+}
+
+func (l *lockCheckingStore) DeleteInstance(ctx context.Context, id string) error {
+	l.check(id)
+	return l.MemoryRegistryStore.DeleteInstance(ctx, id)
+}
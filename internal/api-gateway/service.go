@@ -1,58 +1,124 @@
 package apigateway
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"net/http"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/google/uuid"
 )
 
 // Service provides API gateway functionality
 type Service struct {
-	routes      map[string]*ServiceRoute
-	instances   map[string][]*ServiceInstance
-	rateLimiters map[string]*RateLimiter
-	middlewares []*Middleware
-	config      *ProxyConfig
-	mu          sync.RWMutex
+	routes          map[string]*ServiceRoute
+	instances       map[string][]*ServiceInstance
+	rateLimiters    map[string]*RateLimiter
+	middlewares     []*Middleware
+	config          *ProxyConfig
+	rateTiers       map[string]RateLimitTier
+	tierAssignments map[string]string
+	rateOverrides   map[string]RateLimitTier
+	defaultTier     string
+	// rateAlgorithms selects the algorithm of subjects not using defaultAlgorithm
+	rateAlgorithms   map[string]RateLimitAlgorithm
+	defaultAlgorithm RateLimitAlgorithm
+	breakers         map[string]*CircuitBreaker
+	// rrNext is each service's rotating position among its healthy
+	// instances, and connections the requests in flight to each instance
+	rrNext      map[string]int
+	connections map[string]int
+	// latencies is each instance's moving average request latency
+	latencies       map[string]time.Duration
+	httpClient      *http.Client
+	serviceAuth     *core.ServiceAuth
+	healthPushToken string
+	userAuth        *UserTokenAuth
+	// instanceTTL is how long instances stay healthy without a heartbeat, and
+	// reapGrace how long the health reaper keeps instances it marked stale
+	instanceTTL time.Duration
+	reapGrace   time.Duration
+	// Circuit breaker settings for breakers created from now on
+	circuitMaxTimeout time.Duration
+	halfOpenProbes    int
+	probeLifetime     time.Duration
+	// store persists routes and instances; stored holds the IDs of entries
+	// known to be in it, so entries removed from it elsewhere are dropped on
+	// the next LoadRegistry. registryMu serializes changes to the registry,
+	// so they can write to the store without holding mu.
+	registryMu   sync.Mutex
+	store        RegistryStore
+	stored       map[string]bool
+	scheduler    *core.Scheduler
+	syncInterval time.Duration
+	mu           sync.RWMutex
 }
 
 // NewService creates a new API gateway service
 func NewService() *Service {
 	return &Service{
-		routes:       make(map[string]*ServiceRoute),
-		instances:    make(map[string][]*ServiceInstance),
-		rateLimiters: make(map[string]*RateLimiter),
-		middlewares:  make([]*Middleware, 0),
+		routes:            make(map[string]*ServiceRoute),
+		instances:         make(map[string][]*ServiceInstance),
+		rateLimiters:      make(map[string]*RateLimiter),
+		middlewares:       make([]*Middleware, 0),
+		rateTiers:         DefaultRateLimitTiers(),
+		tierAssignments:   make(map[string]string),
+		rateOverrides:     make(map[string]RateLimitTier),
+		rateAlgorithms:    make(map[string]RateLimitAlgorithm),
+		defaultAlgorithm:  RateLimitAlgorithmFixedWindow,
+		breakers:          make(map[string]*CircuitBreaker),
+		rrNext:            make(map[string]int),
+		connections:       make(map[string]int),
+		latencies:         make(map[string]time.Duration),
+		circuitMaxTimeout: DefaultCircuitMaxTimeout,
+		halfOpenProbes:    DefaultHalfOpenProbes,
+		probeLifetime:     DefaultProbeLifetime,
+		store:             NewMemoryRegistryStore(),
+		stored:            make(map[string]bool),
+		syncInterval:      DefaultRegistrySyncInterval,
+		defaultTier:       RateLimitTierFree, // 100 requests per minute
+		reapGrace:         DefaultReapGracePeriod,
 		config: &ProxyConfig{
-			Timeout:         30 * time.Second,
-			RetryAttempts:   3,
-			RetryDelay:      1 * time.Second,
-			CircuitBreaker:  true,
-			LoadBalancer:    "round_robin",
+			Timeout:        30 * time.Second,
+			RetryAttempts:  3,
+			RetryDelay:     1 * time.Second,
+			CircuitBreaker: true,
+			LoadBalancer:   LoadBalancerRoundRobin,
 		},
 	}
 }
 
+// CheckHealth always reports healthy: the gateway serves requests from the
+// routing state it holds in memory, even while its registry store is down
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return core.NewHealthStatus(true, "No external dependencies")
+}
+
 // RegisterRoute registers a new service route
 func (s *Service) RegisterRoute(route *ServiceRoute) error {
 	if err := s.validateRoute(route); err != nil {
 		return err
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
 
 	// Check for duplicate routes
+	s.mu.RLock()
+	store := s.store
 	for _, existingRoute := range s.routes {
 		if existingRoute.Path == route.Path {
+			s.mu.RUnlock()
 			return fmt.Errorf("route with path '%s' already registered", route.Path)
 		}
 	}
+	s.mu.RUnlock()
 
 	// Generate ID if not provided
 	if route.ID == "" {
@@ -64,10 +130,34 @@ func (s *Service) RegisterRoute(route *ServiceRoute) error {
 	route.CreatedAt = now
 	route.UpdatedAt = now
 
+	if err := store.SaveRoute(context.Background(), route); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored[route.ID] = true
 	s.routes[route.ID] = route
 	return nil
 }
 
+// MatchRoute returns the registered route with the longest path prefix matching path
+func (s *Service) MatchRoute(path string) *ServiceRoute {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var match *ServiceRoute
+	for _, route := range s.routes {
+		if !strings.HasPrefix(path, route.Path) {
+			continue
+		}
+		if match == nil || len(route.Path) > len(match.Path) {
+			match = route
+		}
+	}
+	return match
+}
+
 // GetRoutes returns all registered routes
 func (s *Service) GetRoutes() []*ServiceRoute {
 	s.mu.RLock()
@@ -80,14 +170,16 @@ func (s *Service) GetRoutes() []*ServiceRoute {
 	return routes
 }
 
-// RegisterInstance registers a service instance
+// RegisterInstance registers a service instance. Registering a stored
+// instance again unchanged, e.g. on every start, only refreshes its LastSeen
+// in memory.
 func (s *Service) RegisterInstance(instance *ServiceInstance) error {
 	if err := s.validateInstance(instance); err != nil {
 		return err
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
 
 	// Generate ID if not provided
 	if instance.ID == "" {
@@ -99,23 +191,31 @@ func (s *Service) RegisterInstance(instance *ServiceInstance) error {
 	instance.RegisteredAt = now
 	instance.LastSeen = now
 
-	// Add to instances map
-	if s.instances[instance.ServiceName] == nil {
-		s.instances[instance.ServiceName] = make([]*ServiceInstance, 0)
-	}
-
-	// Check if instance already exists
-	for i, existing := range s.instances[instance.ServiceName] {
-		if existing.ID == instance.ID {
-			s.instances[instance.ServiceName][i] = instance
-			return nil
-		}
+	s.mu.RLock()
+	store := s.store
+	existing := s.findInstance(instance.ID)
+	unchanged := existing != nil && s.stored[instance.ID] && sameInstance(existing, instance)
+	s.mu.RUnlock()
+	if unchanged {
+		instance.RegisteredAt = existing.RegisteredAt
+	} else if err := store.SaveInstance(context.Background(), instance); err != nil {
+		return err
 	}
 
-	s.instances[instance.ServiceName] = append(s.instances[instance.ServiceName], instance)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored[instance.ID] = true
+	s.putInstance(instance)
 	return nil
 }
 
+// sameInstance reports whether two registrations of an instance differ only
+// in their timestamps
+func sameInstance(a, b *ServiceInstance) bool {
+	return a.ServiceName == b.ServiceName && a.Address == b.Address && a.Port == b.Port &&
+		a.Health == b.Health && maps.Equal(a.Metadata, b.Metadata)
+}
+
 // GetInstances returns all instances for a service
 func (s *Service) GetInstances(serviceName string) []*ServiceInstance {
 	s.mu.RLock()
@@ -132,82 +232,109 @@ func (s *Service) GetInstances(serviceName string) []*ServiceInstance {
 	return result
 }
 
-// UpdateInstanceHealth updates the health status of an instance
+// UpdateInstanceHealth updates the health status of an instance. The store is
+// only written when the status changes; LastSeen is refreshed in memory.
 func (s *Service) UpdateInstanceHealth(instanceID string, health HealthStatus) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
 
-	for serviceName, instances := range s.instances {
-		for i, instance := range instances {
-			if instance.ID == instanceID {
-				s.instances[serviceName][i].Health = health
-				s.instances[serviceName][i].LastSeen = time.Now()
-				return nil
-			}
+	s.mu.RLock()
+	store := s.store
+	instance := s.findInstance(instanceID)
+	s.mu.RUnlock()
+	if instance == nil {
+		return fmt.Errorf("instance '%s' not found", instanceID)
+	}
+
+	updated := *instance
+	updated.Health = health
+	updated.LastSeen = time.Now()
+	if health != instance.Health {
+		if err := store.SaveInstance(context.Background(), &updated); err != nil {
+			return err
 		}
 	}
 
-	return fmt.Errorf("instance '%s' not found", instanceID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored[instanceID] = true
+	s.putInstance(&updated)
+	return nil
 }
 
 // DeregisterInstance removes an instance from the registry
 func (s *Service) DeregisterInstance(instanceID string) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	s.mu.RLock()
+	store := s.store
+	known := s.findInstance(instanceID) != nil
+	s.mu.RUnlock()
+	if !known {
+		return fmt.Errorf("instance '%s' not found", instanceID)
+	}
+
+	if err := store.DeleteInstance(context.Background(), instanceID); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.removeInstance(instanceID)
+	return nil
+}
 
-	for serviceName, instances := range s.instances {
-		for i, instance := range instances {
-			if instance.ID == instanceID {
-				// Remove instance from slice
-				s.instances[serviceName] = append(instances[:i], instances[i+1:]...)
-				return nil
+// findInstance returns the registered instance with the given ID, or nil;
+// callers must hold s.mu
+func (s *Service) findInstance(id string) *ServiceInstance {
+	for _, instances := range s.instances {
+		for _, instance := range instances {
+			if instance.ID == id {
+				return instance
 			}
 		}
 	}
-
-	return fmt.Errorf("instance '%s' not found", instanceID)
+	return nil
 }
 
-// SelectInstance selects a healthy instance using load balancing
-func (s *Service) SelectInstance(serviceName string) *ServiceInstance {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	instances := s.instances[serviceName]
-	if len(instances) == 0 {
-		return nil
-	}
-
-	// Filter healthy instances
-	healthyInstances := make([]*ServiceInstance, 0)
-	for _, instance := range instances {
-		if instance.Health == HealthStatusHealthy {
-			healthyInstances = append(healthyInstances, instance)
+// removeInstance drops an instance and its balancing state; callers must hold
+// s.mu
+func (s *Service) removeInstance(id string) {
+	for serviceName, instances := range s.instances {
+		for i, instance := range instances {
+			if instance.ID == id {
+				s.instances[serviceName] = append(instances[:i], instances[i+1:]...)
+				break
+			}
 		}
 	}
-
-	if len(healthyInstances) == 0 {
-		return nil
-	}
-
-	// Simple round-robin selection (in a real implementation, this would be more sophisticated)
-	// For now, just return the first healthy instance
-	return healthyInstances[0]
+	delete(s.stored, id)
+	delete(s.connections, id)
+	delete(s.latencies, id)
 }
 
-// GetRateLimiter gets or creates a rate limiter for a user/IP
+// GetRateLimiter gets or creates a rate limiter for a user/IP, using the limit of
+// the caller's override or tier, or the default tier when the caller is unknown,
+// and the caller's rate limit algorithm
 func (s *Service) GetRateLimiter(identifier string) *RateLimiter {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	limiter, exists := s.rateLimiters[identifier]
 	if !exists {
+		tier := s.rateLimitFor(identifier)
 		limiter = &RateLimiter{
-			ID:       identifier,
-			Limit:    100,                // 100 requests
-			Window:   time.Minute,        // per minute
-			Requests: 0,
-			ResetAt:  time.Now().Add(time.Minute),
+			ID:        identifier,
+			Limit:     tier.Limit,
+			Window:    tier.Window,
+			Requests:  0,
+			ResetAt:   time.Now().Add(tier.Window),
+			Algorithm: s.rateLimitAlgorithmFor(identifier),
+			tier:      tier,
+		}
+		if limiter.Algorithm == RateLimitAlgorithmTokenBucket {
+			limiter.bucket = newTierBucket(tier)
 		}
 		s.rateLimiters[identifier] = limiter
 	}
@@ -215,6 +342,18 @@ func (s *Service) GetRateLimiter(identifier string) *RateLimiter {
 	return limiter
 }
 
+// SetRateLimit sets the limit and window of the default tier
+func (s *Service) SetRateLimit(limit int, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tier := s.rateTiers[s.defaultTier]
+	tier.Limit = limit
+	tier.Window = window
+	s.rateTiers[s.defaultTier] = tier
+	s.resetRateLimiters()
+}
+
 // AddMiddleware adds a middleware to the gateway
 func (s *Service) AddMiddleware(middleware *Middleware) {
 	s.mu.Lock()
@@ -250,6 +389,23 @@ func (s *Service) validateRoute(route *ServiceRoute) error {
 	if strings.TrimSpace(route.Target) == "" {
 		return errors.New("target is required")
 	}
+	switch route.RateLimitMode {
+	case "", RateLimitModeReject, RateLimitModeQueue:
+	default:
+		return fmt.Errorf("invalid rate limit mode '%s'", route.RateLimitMode)
+	}
+	if route.MaxQueueWait < 0 {
+		return errors.New("max queue wait cannot be negative")
+	}
+	if route.Cost < 0 {
+		return errors.New("cost cannot be negative")
+	}
+	if route.RateLimit < 0 || route.RateLimitWindow < 0 {
+		return errors.New("rate limit and window cannot be negative")
+	}
+	if (route.RateLimit == 0) != (route.RateLimitWindow == 0) {
+		return errors.New("rate limit and window must be set together")
+	}
 	return nil
 }
 
@@ -0,0 +1,178 @@
+package apigateway
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Built-in rate limit tiers
+const (
+	RateLimitTierFree       = "free"
+	RateLimitTierPro        = "pro"
+	RateLimitTierEnterprise = "enterprise"
+)
+
+// RateLimitTier is a named rate limit ceiling shared by every caller assigned to it
+type RateLimitTier struct {
+	Name   string        `json:"name"`
+	Limit  int           `json:"limit"`
+	Window time.Duration `json:"window"`
+	// Burst is how many tokens a token bucket limiter holds at most; zero
+	// means Limit
+	Burst int `json:"burst,omitempty"`
+}
+
+// DefaultRateLimitTiers returns the built-in tiers; free is the default tier
+func DefaultRateLimitTiers() map[string]RateLimitTier {
+	return map[string]RateLimitTier{
+		RateLimitTierFree:       {Name: RateLimitTierFree, Limit: 100, Window: time.Minute},
+		RateLimitTierPro:        {Name: RateLimitTierPro, Limit: 1000, Window: time.Minute},
+		RateLimitTierEnterprise: {Name: RateLimitTierEnterprise, Limit: 10000, Window: time.Minute},
+	}
+}
+
+// SetRateLimitTier defines or replaces a tier. Cached limiters of its callers
+// are reset so the new limits apply from the next request.
+func (s *Service) SetRateLimitTier(tier RateLimitTier) error {
+	if err := validateTier(tier); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateTiers[tier.Name] = tier
+	s.resetRateLimiters()
+	return nil
+}
+
+// SetDefaultRateLimitTier sets the tier used for callers without an assignment
+func (s *Service) SetDefaultRateLimitTier(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rateTiers[name]; !exists {
+		return fmt.Errorf("rate limit tier '%s' not found", name)
+	}
+	s.defaultTier = name
+	s.resetRateLimiters()
+	return nil
+}
+
+// AssignRateLimitTier places a subject (a user or org ID) on a tier
+func (s *Service) AssignRateLimitTier(subject, tier string) error {
+	if strings.TrimSpace(subject) == "" {
+		return errors.New("subject is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rateTiers[tier]; !exists {
+		return fmt.Errorf("rate limit tier '%s' not found", tier)
+	}
+	s.tierAssignments[subject] = tier
+	s.resetRateLimiters()
+	return nil
+}
+
+// SetRateLimitOverride gives a subject a custom limit that takes precedence over its tier
+func (s *Service) SetRateLimitOverride(subject string, limit int, window time.Duration) error {
+	if strings.TrimSpace(subject) == "" {
+		return errors.New("subject is required")
+	}
+	override := RateLimitTier{Name: "override", Limit: limit, Window: window}
+	if err := validateTier(override); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateOverrides[subject] = override
+	s.resetRateLimiters()
+	return nil
+}
+
+// ClearRateLimitOverride removes a subject's override so its tier applies again
+func (s *Service) ClearRateLimitOverride(subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.rateOverrides, subject)
+	s.resetRateLimiters()
+}
+
+// RateLimitFor returns the limit that applies to a rate limiter identifier
+func (s *Service) RateLimitFor(identifier string) RateLimitTier {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.rateLimitFor(identifier)
+}
+
+// rateLimitFor resolves an identifier to its limit. Identifiers may be scoped, e.g.
+// "route-1:user:alice", so the most specific suffix with an override or tier
+// assignment wins ("route-1:user:alice", then "user:alice", then "alice").
+// Without one, the limit of the route the identifier is scoped to applies,
+// if it has one, and otherwise the default tier. Callers must hold s.mu.
+func (s *Service) rateLimitFor(identifier string) RateLimitTier {
+	for _, subject := range subjectsOf(identifier) {
+		if override, exists := s.rateOverrides[subject]; exists {
+			return override
+		}
+		if name, exists := s.tierAssignments[subject]; exists {
+			if tier, exists := s.rateTiers[name]; exists {
+				return tier
+			}
+		}
+	}
+	if routeID, _, scoped := strings.Cut(identifier, ":"); scoped {
+		if route, exists := s.routes[routeID]; exists && route.RateLimit > 0 {
+			return RateLimitTier{Name: "route", Limit: route.RateLimit, Window: route.RateLimitWindow}
+		}
+	}
+	return s.rateTiers[s.defaultTier]
+}
+
+// resetRateLimiters drops the cached limiters whose limit or algorithm no
+// longer matches the caller's, so the new one applies on the next request.
+// Callers whose limit is unchanged keep their current window. Callers must
+// hold s.mu.
+func (s *Service) resetRateLimiters() {
+	for identifier, limiter := range s.rateLimiters {
+		if s.rateLimitFor(identifier) != limiter.tier || s.rateLimitAlgorithmFor(identifier) != limiter.Algorithm {
+			delete(s.rateLimiters, identifier)
+		}
+	}
+}
+
+// subjectsOf returns an identifier and each of its ':'-separated suffixes
+func subjectsOf(identifier string) []string {
+	subjects := []string{identifier}
+	for i := 0; i < len(identifier); i++ {
+		if identifier[i] == ':' && i+1 < len(identifier) {
+			subjects = append(subjects, identifier[i+1:])
+		}
+	}
+	return subjects
+}
+
+// validateTier validates a rate limit tier
+func validateTier(tier RateLimitTier) error {
+	if strings.TrimSpace(tier.Name) == "" {
+		return errors.New("tier name is required")
+	}
+	if tier.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if tier.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	if tier.Burst < 0 {
+		return errors.New("burst cannot be negative")
+	}
+	return nil
+}
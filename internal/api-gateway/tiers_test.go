@@ -0,0 +1,135 @@
+package apigateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitTiers(t *testing.T) {
+	t.Run("should give users on different tiers different limits", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.AssignRateLimitTier("alice", RateLimitTierPro))
+		require.NoError(t, service.AssignRateLimitTier("bob", RateLimitTierEnterprise))
+
+		assert.Equal(t, 1000, service.GetRateLimiter("alice").Limit)
+		assert.Equal(t, 10000, service.GetRateLimiter("bob").Limit)
+	})
+
+	t.Run("should apply the default tier to unknown callers", func(t *testing.T) {
+		service := NewService()
+		assert.Equal(t, 100, service.GetRateLimiter("stranger").Limit)
+
+		require.NoError(t, service.SetDefaultRateLimitTier(RateLimitTierPro))
+		assert.Equal(t, 1000, service.GetRateLimiter("stranger").Limit)
+	})
+
+	t.Run("should resolve tiers for route-scoped identifiers", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.AssignRateLimitTier("alice", RateLimitTierPro))
+
+		assert.Equal(t, 1000, service.GetRateLimiter("route-1:user:alice").Limit)
+		assert.Equal(t, 100, service.GetRateLimiter("route-1:user:malice").Limit)
+	})
+
+	t.Run("should let an admin override take precedence over the tier", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.AssignRateLimitTier("alice", RateLimitTierPro))
+		assert.Equal(t, 1000, service.GetRateLimiter("alice").Limit)
+
+		require.NoError(t, service.SetRateLimitOverride("alice", 5, time.Second))
+		limiter := service.GetRateLimiter("alice")
+		assert.Equal(t, 5, limiter.Limit)
+		assert.Equal(t, time.Second, limiter.Window)
+
+		service.ClearRateLimitOverride("alice")
+		assert.Equal(t, 1000, service.GetRateLimiter("alice").Limit)
+	})
+
+	t.Run("should support custom tiers", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.SetRateLimitTier(RateLimitTier{Name: "internal", Limit: 50000, Window: time.Minute}))
+		require.NoError(t, service.AssignRateLimitTier("ci", "internal"))
+
+		assert.Equal(t, 50000, service.RateLimitFor("ci").Limit)
+	})
+
+	t.Run("should only reset the windows of callers whose limit changed", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.AssignRateLimitTier("alice", RateLimitTierPro))
+		alice := service.GetRateLimiter("alice")
+		bob := service.GetRateLimiter("bob")
+		require.True(t, alice.Allow())
+		require.True(t, bob.Allow())
+
+		require.NoError(t, service.SetRateLimitTier(RateLimitTier{Name: RateLimitTierPro, Limit: 2000, Window: time.Minute}))
+		assert.Same(t, bob, service.GetRateLimiter("bob"), "free callers keep their window")
+		assert.NotSame(t, alice, service.GetRateLimiter("alice"))
+		assert.Equal(t, 2000, service.GetRateLimiter("alice").Limit)
+
+		require.NoError(t, service.AssignRateLimitTier("bob", RateLimitTierFree))
+		assert.Same(t, bob, service.GetRateLimiter("bob"), "an assignment to the same limit changes nothing")
+	})
+
+	t.Run("should reject invalid tiers and assignments", func(t *testing.T) {
+		service := NewService()
+		assert.Error(t, service.AssignRateLimitTier("alice", "platinum"))
+		assert.Error(t, service.AssignRateLimitTier("", RateLimitTierPro))
+		assert.Error(t, service.SetDefaultRateLimitTier("platinum"))
+		assert.Error(t, service.SetRateLimitTier(RateLimitTier{Name: "broken", Limit: 0, Window: time.Minute}))
+		assert.Error(t, service.SetRateLimitOverride("alice", 10, 0))
+	})
+
+	t.Run("should enforce tier limits in the handler", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.SetRateLimitTier(RateLimitTier{Name: RateLimitTierFree, Limit: 1, Window: time.Minute}))
+		require.NoError(t, service.SetRateLimitTier(RateLimitTier{Name: RateLimitTierPro, Limit: 3, Window: time.Minute}))
+		require.NoError(t, service.AssignRateLimitTier("pro-user", RateLimitTierPro))
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/api/v1/workflows", Target: "http://localhost:8082"}))
+
+		handler := service.RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		serve := func(userID string) int {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/workflows", nil)
+			req = req.WithContext(WithAuthenticatedUser(req.Context(), userID))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, serve("pro-user"))
+		}
+		assert.Equal(t, http.StatusTooManyRequests, serve("pro-user"))
+
+		assert.Equal(t, http.StatusOK, serve("free-user"))
+		assert.Equal(t, http.StatusTooManyRequests, serve("free-user"))
+	})
+
+	t.Run("should not trust a client's X-User-ID header", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.SetRateLimitTier(RateLimitTier{Name: RateLimitTierFree, Limit: 1, Window: time.Minute}))
+		require.NoError(t, service.AssignRateLimitTier("pro-user", RateLimitTierPro))
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{ServiceName: "flow", Path: "/api/v1/workflows", Target: "http://localhost:8082"}))
+
+		handler := service.RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		serve := func(claimedUserID string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/workflows", nil)
+			req.Header.Set("X-User-ID", claimedUserID)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// Claiming a pro user does not get the pro limit
+		first := serve("pro-user")
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, "1", first.Header().Get("X-RateLimit-Limit"))
+
+		// Nor does claiming a fresh user get a fresh limiter
+		assert.Equal(t, http.StatusTooManyRequests, serve("someone-else").Code)
+	})
+}
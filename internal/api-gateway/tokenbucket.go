@@ -0,0 +1,194 @@
+package apigateway
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm selects how a rate limiter counts requests
+type RateLimitAlgorithm string
+
+const (
+	// RateLimitAlgorithmFixedWindow admits Limit requests per Window. Bursts
+	// at a window boundary may admit up to twice the limit in a short span.
+	RateLimitAlgorithmFixedWindow RateLimitAlgorithm = "fixed_window"
+	// RateLimitAlgorithmTokenBucket refills Limit tokens per Window evenly,
+	// holding at most the tier's Burst, which smooths traffic to backends
+	// that cannot absorb bursts
+	RateLimitAlgorithmTokenBucket RateLimitAlgorithm = "token_bucket"
+)
+
+// Limiter is implemented by both rate limiting algorithms
+type Limiter interface {
+	Allow() bool
+	AllowN(n int) bool
+	Status() *RateLimitStatus
+}
+
+var (
+	_ Limiter = (*RateLimiter)(nil)
+	_ Limiter = (*TokenBucket)(nil)
+)
+
+// TokenBucket admits requests while it holds tokens. It holds up to Capacity
+// tokens, starts full, and is refilled continuously at Rate tokens per second.
+// It is safe for concurrent use.
+type TokenBucket struct {
+	Capacity int     `json:"capacity"`
+	Rate     float64 `json:"rate"`
+
+	tokens  float64
+	updated time.Time
+	mu      sync.Mutex
+}
+
+// NewTokenBucket creates a full bucket of capacity tokens refilled at rate
+// tokens per second
+func NewTokenBucket(capacity int, rate float64) *TokenBucket {
+	return &TokenBucket{Capacity: capacity, Rate: rate, tokens: float64(capacity), updated: time.Now()}
+}
+
+// newTierBucket creates a bucket refilling a tier's Limit every Window, with
+// its Burst as capacity or, without one, its Limit
+func newTierBucket(tier RateLimitTier) *TokenBucket {
+	capacity := tier.Burst
+	if capacity == 0 {
+		capacity = tier.Limit
+	}
+	return NewTokenBucket(capacity, float64(tier.Limit)/tier.Window.Seconds())
+}
+
+// Allow checks if a request is allowed, taking a token if it is
+func (b *TokenBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+// AllowN checks if a request costing n tokens is allowed. Tokens are only
+// taken when all n are available.
+func (b *TokenBucket) AllowN(n int) bool {
+	_, ok, _ := b.reserve(n)
+	return ok
+}
+
+// Status returns the whole tokens available; ResetAt is when the next token
+// is added, or now when the bucket is full
+func (b *TokenBucket) Status() *RateLimitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refill(now)
+	remaining := math.Floor(b.tokens)
+	resetAt := now
+	if int(remaining) < b.Capacity {
+		resetAt = now.Add(b.until(remaining + 1))
+	}
+	return &RateLimitStatus{Limit: b.Capacity, Remaining: int(remaining), ResetAt: resetAt}
+}
+
+// reserve takes n tokens if they are available, otherwise it returns the time
+// until they will be and whether n can ever fit in the bucket
+func (b *TokenBucket) reserve(n int) (time.Duration, bool, bool) {
+	if n < 1 {
+		n = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if n > b.Capacity {
+		return 0, false, false
+	}
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		return 0, true, true
+	}
+	return b.until(float64(n)), false, true
+}
+
+// refill adds the tokens accrued since the last update; callers must hold b.mu
+func (b *TokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(b.Capacity), b.tokens+elapsed.Seconds()*b.Rate)
+		b.updated = now
+	}
+}
+
+// full reports whether the bucket has refilled to capacity by now
+func (b *TokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.updated).Seconds()*b.Rate >= float64(b.Capacity)
+}
+
+// until returns how long until the bucket holds n tokens; callers must hold b.mu
+func (b *TokenBucket) until(n float64) time.Duration {
+	missing := n - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(missing / b.Rate * float64(time.Second)))
+}
+
+// SetDefaultRateLimitAlgorithm sets the algorithm limiting callers without one
+// of their own. Cached limiters are reset so it applies from the next request.
+func (s *Service) SetDefaultRateLimitAlgorithm(algorithm RateLimitAlgorithm) error {
+	if !validRateLimitAlgorithm(algorithm) {
+		return fmt.Errorf("unknown rate limit algorithm '%s'", algorithm)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.defaultAlgorithm = algorithm
+	s.resetRateLimiters()
+	return nil
+}
+
+// SetRateLimitAlgorithm selects the algorithm limiting a subject (a user or org
+// ID, or a scoped identifier such as "route-1:user:alice")
+func (s *Service) SetRateLimitAlgorithm(subject string, algorithm RateLimitAlgorithm) error {
+	if strings.TrimSpace(subject) == "" {
+		return errors.New("subject is required")
+	}
+	if !validRateLimitAlgorithm(algorithm) {
+		return fmt.Errorf("unknown rate limit algorithm '%s'", algorithm)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateAlgorithms[subject] = algorithm
+	s.resetRateLimiters()
+	return nil
+}
+
+// ClearRateLimitAlgorithm returns a subject to the default algorithm
+func (s *Service) ClearRateLimitAlgorithm(subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.rateAlgorithms, subject)
+	s.resetRateLimiters()
+}
+
+// rateLimitAlgorithmFor resolves an identifier to its algorithm, the most
+// specific suffix with one selected winning as in rateLimitFor. Callers must
+// hold s.mu.
+func (s *Service) rateLimitAlgorithmFor(identifier string) RateLimitAlgorithm {
+	for _, subject := range subjectsOf(identifier) {
+		if algorithm, exists := s.rateAlgorithms[subject]; exists {
+			return algorithm
+		}
+	}
+	return s.defaultAlgorithm
+}
+
+func validRateLimitAlgorithm(algorithm RateLimitAlgorithm) bool {
+	return algorithm == RateLimitAlgorithmFixedWindow || algorithm == RateLimitAlgorithmTokenBucket
+}
@@ -0,0 +1,164 @@
+package apigateway
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("should admit a burst up to its capacity", func(t *testing.T) {
+		bucket := NewTokenBucket(3, 0.001)
+
+		for i := 0; i < 3; i++ {
+			assert.True(t, bucket.Allow())
+		}
+		assert.False(t, bucket.Allow())
+
+		status := bucket.Status()
+		assert.Equal(t, 3, status.Limit)
+		assert.Equal(t, 0, status.Remaining)
+		assert.True(t, status.ResetAt.After(time.Now()))
+	})
+
+	t.Run("should refill at its rate without exceeding its capacity", func(t *testing.T) {
+		bucket := NewTokenBucket(2, 100)
+		assert.True(t, bucket.AllowN(2))
+		assert.False(t, bucket.Allow())
+
+		time.Sleep(30 * time.Millisecond)
+		assert.Equal(t, 2, bucket.Status().Remaining, "a full bucket stops refilling")
+		assert.True(t, bucket.AllowN(2))
+	})
+
+	t.Run("should only take tokens when all are available", func(t *testing.T) {
+		bucket := NewTokenBucket(5, 0.001)
+		assert.True(t, bucket.AllowN(4))
+		assert.False(t, bucket.AllowN(2))
+		assert.Equal(t, 1, bucket.Status().Remaining)
+
+		_, ok, possible := bucket.reserve(6)
+		assert.False(t, ok)
+		assert.False(t, possible, "a request costing more than the capacity never fits")
+	})
+
+	t.Run("should not admit twice the limit across a window boundary", func(t *testing.T) {
+		window := 100 * time.Millisecond
+		fixed := &RateLimiter{ID: "fixed", Limit: 10, Window: window, ResetAt: time.Now().Add(20 * time.Millisecond)}
+		bucket := newTierBucket(RateLimitTier{Limit: 10, Window: window})
+
+		admitted := func(limiter Limiter) int {
+			count := 0
+			for limiter.Allow() {
+				count++
+			}
+			return count
+		}
+		fixedBefore, bucketBefore := admitted(fixed), admitted(bucket)
+		time.Sleep(30 * time.Millisecond)
+		fixedAfter, bucketAfter := admitted(fixed), admitted(bucket)
+
+		assert.Equal(t, 20, fixedBefore+fixedAfter)
+		assert.Equal(t, 10, bucketBefore)
+		assert.LessOrEqual(t, bucketAfter, 4, "only the tokens refilled in the meantime")
+	})
+}
+
+func TestRateLimitAlgorithms(t *testing.T) {
+	t.Run("should use fixed windows by default", func(t *testing.T) {
+		service := NewService()
+		limiter := service.GetRateLimiter("user:alice")
+		assert.Equal(t, RateLimitAlgorithmFixedWindow, limiter.Algorithm)
+		assert.Nil(t, limiter.bucket)
+	})
+
+	t.Run("should select the algorithm per identifier", func(t *testing.T) {
+		service := NewService()
+		require.NoError(t, service.SetRateLimitTier(RateLimitTier{Name: RateLimitTierFree, Limit: 60, Window: time.Minute, Burst: 5}))
+		require.NoError(t, service.SetRateLimitAlgorithm("alice", RateLimitAlgorithmTokenBucket))
+
+		limiter := service.GetRateLimiter("route-1:user:alice")
+		assert.Equal(t, RateLimitAlgorithmTokenBucket, limiter.Algorithm)
+		for i := 0; i < 5; i++ {
+			assert.True(t, limiter.Allow())
+		}
+		assert.False(t, limiter.Allow(), "the burst caps the bucket below the tier's limit")
+		assert.Equal(t, 5, limiter.Status().Limit)
+
+		assert.Equal(t, RateLimitAlgorithmFixedWindow, service.GetRateLimiter("route-1:user:bob").Algorithm)
+
+		service.ClearRateLimitAlgorithm("alice")
+		assert.Equal(t, RateLimitAlgorithmFixedWindow, service.GetRateLimiter("route-1:user:alice").Algorithm)
+	})
+
+	t.Run("should change the default algorithm", func(t *testing.T) {
+		service := NewService()
+		before := service.GetRateLimiter("user:bob")
+		require.NoError(t, service.SetDefaultRateLimitAlgorithm(RateLimitAlgorithmTokenBucket))
+
+		after := service.GetRateLimiter("user:bob")
+		assert.NotSame(t, before, after, "cached limiters are replaced")
+		assert.Equal(t, RateLimitAlgorithmTokenBucket, after.Algorithm)
+	})
+
+	t.Run("should queue token bucket requests until tokens refill", func(t *testing.T) {
+		service := NewService()
+		service.SetRateLimit(1, 50*time.Millisecond)
+		require.NoError(t, service.SetDefaultRateLimitAlgorithm(RateLimitAlgorithmTokenBucket))
+		require.NoError(t, service.RegisterRoute(&ServiceRoute{
+			ServiceName:   "flow",
+			Path:          "/api/v1/workflows",
+			Target:        "http://localhost:8082",
+			RateLimitMode: RateLimitModeQueue,
+			MaxQueueWait:  time.Second,
+		}))
+		handler := service.RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		assert.Equal(t, http.StatusOK, serveWorkflows(handler).Code)
+		start := time.Now()
+		assert.Equal(t, http.StatusOK, serveWorkflows(handler).Code)
+		assert.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+	})
+
+	t.Run("should reject unknown algorithms and negative bursts", func(t *testing.T) {
+		service := NewService()
+		assert.ErrorContains(t, service.SetDefaultRateLimitAlgorithm("leaky"), "unknown rate limit algorithm 'leaky'")
+		assert.Error(t, service.SetRateLimitAlgorithm("alice", "leaky"))
+		assert.Error(t, service.SetRateLimitAlgorithm("", RateLimitAlgorithmTokenBucket))
+		assert.ErrorContains(t, service.SetRateLimitTier(RateLimitTier{Name: "spiky", Limit: 1, Window: time.Second, Burst: -1}), "burst cannot be negative")
+
+		limiter := &RateLimiter{ID: "user1", Limit: 1, Window: time.Minute, bucket: NewTokenBucket(1, 0.001)}
+		assert.True(t, limiter.Allow())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, limiter.Wait(ctx, time.Hour), ErrRateLimited, "a refill beyond the deadline is not waited for")
+	})
+}
+
+func benchmarkRateLimiter(b *testing.B, algorithm RateLimitAlgorithm) {
+	service := NewService()
+	service.SetRateLimit(1_000_000, time.Second)
+	if err := service.SetDefaultRateLimitAlgorithm(algorithm); err != nil {
+		b.Fatal(err)
+	}
+	limiter := service.GetRateLimiter("user1")
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limiter.Allow()
+		}
+	})
+}
+
+func BenchmarkRateLimiterFixedWindow(b *testing.B) {
+	benchmarkRateLimiter(b, RateLimitAlgorithmFixedWindow)
+}
+
+func BenchmarkRateLimiterTokenBucket(b *testing.B) {
+	benchmarkRateLimiter(b, RateLimitAlgorithmTokenBucket)
+}
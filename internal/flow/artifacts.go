@@ -0,0 +1,276 @@
+package flow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"gorm.io/gorm"
+)
+
+// ErrArtifactNotFound is returned by an ArtifactStore when a key does not exist
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// ArtifactObject describes an object held by an ArtifactStore
+type ArtifactObject struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// ArtifactStore persists artifact content by key
+type ArtifactStore interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	List(ctx context.Context, prefix string) ([]ArtifactObject, error)
+}
+
+// SetArtifactStore sets the store used to persist step artifacts
+func (s *Service) SetArtifactStore(store ArtifactStore) {
+	s.artifacts = store
+}
+
+// SaveArtifact stores content produced by a step execution and records its metadata
+func (s *Service) SaveArtifact(ctx context.Context, execution *WorkflowExecution, stepExecution *StepExecution, name string, r io.Reader) (*Artifact, error) {
+	if s.artifacts == nil {
+		return nil, errors.New("no artifact store configured")
+	}
+	if err := validateArtifactName(name); err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("executions/%d/steps/%d/%s", execution.ID, stepExecution.ID, name)
+	hash := sha256.New()
+	size, err := s.artifacts.Put(ctx, key, io.TeeReader(r, hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store artifact '%s': %w", name, err)
+	}
+
+	artifact := &Artifact{
+		ExecutionID:     execution.ID,
+		StepExecutionID: stepExecution.ID,
+		UserID:          execution.UserID,
+		Name:            name,
+		Key:             key,
+		Size:            size,
+		Checksum:        hex.EncodeToString(hash.Sum(nil)),
+	}
+	if err := s.db.WithContext(ctx).Create(artifact).Error; err != nil {
+		return nil, fmt.Errorf("failed to record artifact: %w", err)
+	}
+
+	return artifact, nil
+}
+
+// ListArtifacts returns the artifacts recorded for an execution
+func (s *Service) ListArtifacts(ctx context.Context, userID string, executionID uint) ([]*Artifact, error) {
+	var artifacts []*Artifact
+	err := s.db.WithContext(ctx).
+		Where("execution_id = ? AND user_id = ?", executionID, userID).
+		Order("id").
+		Find(&artifacts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	return artifacts, nil
+}
+
+// ListArtifactsPage returns one page of the artifacts of an execution, reading
+// only that page from the store
+func (s *Service) ListArtifactsPage(ctx context.Context, userID string, executionID uint, request core.PageRequest) (*core.Page[*Artifact], error) {
+	query := s.db.WithContext(ctx).Model(&Artifact{}).Where("execution_id = ? AND user_id = ?", executionID, userID).Order("id")
+	page, err := database.Paginate[*Artifact](query, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	return page, nil
+}
+
+// OpenArtifact returns the latest artifact with the given name in an execution along
+// with its content. Later steps use it to consume artifacts of earlier ones.
+func (s *Service) OpenArtifact(ctx context.Context, userID string, executionID uint, name string) (*Artifact, io.ReadCloser, error) {
+	if s.artifacts == nil {
+		return nil, nil, errors.New("no artifact store configured")
+	}
+
+	var artifact Artifact
+	err := s.db.WithContext(ctx).
+		Where("execution_id = ? AND user_id = ? AND name = ?", executionID, userID, name).
+		Order("id DESC").
+		First(&artifact).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, fmt.Errorf("artifact '%s' not found", name)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve artifact: %w", err)
+	}
+
+	content, err := s.artifacts.Get(ctx, artifact.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read artifact '%s': %w", name, err)
+	}
+
+	return &artifact, content, nil
+}
+
+// persistStepArtifacts saves the files a step declares in its Artifacts
+func (s *Service) persistStepArtifacts(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, stepExecution *StepExecution) error {
+	for _, spec := range step.Artifacts {
+		file, err := os.Open(spec.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open artifact '%s': %w", spec.Name, err)
+		}
+		_, err = s.SaveArtifact(ctx, execution, stepExecution, spec.Name, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyCachedArtifacts links the artifacts of a cached step execution to the one reusing it
+func (s *Service) copyCachedArtifacts(ctx context.Context, execution *WorkflowExecution, cached, stepExecution *StepExecution) error {
+	var artifacts []*Artifact
+	if err := s.db.WithContext(ctx).Where("step_execution_id = ?", cached.ID).Find(&artifacts).Error; err != nil {
+		return fmt.Errorf("failed to load cached artifacts: %w", err)
+	}
+
+	for _, artifact := range artifacts {
+		copied := *artifact
+		copied.ID = 0
+		copied.ExecutionID = execution.ID
+		copied.StepExecutionID = stepExecution.ID
+		copied.UserID = execution.UserID
+		if err := s.db.WithContext(ctx).Create(&copied).Error; err != nil {
+			return fmt.Errorf("failed to record artifact: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateArtifactName validates an artifact name
+func validateArtifactName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("artifact name is required")
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid artifact name '%s'", name)
+	}
+	return nil
+}
+
+// LocalArtifactStore stores artifacts as files under a root directory
+type LocalArtifactStore struct {
+	root string
+}
+
+// NewLocalArtifactStore creates a local artifact store rooted at dir
+func NewLocalArtifactStore(dir string) (*LocalArtifactStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	return &LocalArtifactStore{root: dir}, nil
+}
+
+// Put writes the artifact atomically, replacing any existing content for key
+func (l *LocalArtifactStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return 0, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".artifact-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create artifact file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return 0, fmt.Errorf("failed to write artifact: %w", err)
+	}
+
+	return size, nil
+}
+
+// Get opens the artifact stored under key
+func (l *LocalArtifactStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact: %w", err)
+	}
+	return file, nil
+}
+
+// List returns the artifacts whose keys start with prefix, ordered by key
+func (l *LocalArtifactStore) List(ctx context.Context, prefix string) ([]ArtifactObject, error) {
+	objects := make([]ArtifactObject, 0)
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".artifact-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ArtifactObject{Key: key, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// path maps a key to a file below the root, rejecting keys that escape it
+func (l *LocalArtifactStore) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned != "/"+key {
+		return "", fmt.Errorf("invalid artifact key '%s'", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(cleaned)), nil
+}
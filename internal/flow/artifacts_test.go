@@ -0,0 +1,225 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalArtifactStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalArtifactStore(t.TempDir())
+	require.NoError(t, err)
+
+	t.Run("should round-trip artifact content", func(t *testing.T) {
+		size, err := store.Put(ctx, "executions/1/steps/1/report.txt", strings.NewReader("all tests passed"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(16), size)
+
+		content, err := store.Get(ctx, "executions/1/steps/1/report.txt")
+		require.NoError(t, err)
+		defer content.Close()
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, "all tests passed", string(data))
+	})
+
+	t.Run("should overwrite existing content", func(t *testing.T) {
+		_, err := store.Put(ctx, "executions/1/steps/2/out.bin", strings.NewReader("first"))
+		require.NoError(t, err)
+		_, err = store.Put(ctx, "executions/1/steps/2/out.bin", strings.NewReader("second"))
+		require.NoError(t, err)
+
+		content, err := store.Get(ctx, "executions/1/steps/2/out.bin")
+		require.NoError(t, err)
+		defer content.Close()
+		data, _ := io.ReadAll(content)
+		assert.Equal(t, "second", string(data))
+	})
+
+	t.Run("should list artifacts by prefix", func(t *testing.T) {
+		_, err := store.Put(ctx, "executions/2/steps/5/build.tar", strings.NewReader("tar"))
+		require.NoError(t, err)
+
+		objects, err := store.List(ctx, "executions/1/")
+		require.NoError(t, err)
+		assert.Equal(t, []ArtifactObject{
+			{Key: "executions/1/steps/1/report.txt", Size: 16},
+			{Key: "executions/1/steps/2/out.bin", Size: 6},
+		}, objects)
+	})
+
+	t.Run("should return ErrArtifactNotFound for missing keys", func(t *testing.T) {
+		_, err := store.Get(ctx, "executions/9/steps/9/missing")
+		assert.ErrorIs(t, err, ErrArtifactNotFound)
+	})
+
+	t.Run("should reject keys escaping the root", func(t *testing.T) {
+		_, err := store.Put(ctx, "../escape", strings.NewReader("x"))
+		assert.Error(t, err)
+		_, err = store.Get(ctx, "executions/../../etc/passwd")
+		assert.Error(t, err)
+	})
+}
+
+func TestStepArtifacts(t *testing.T) {
+	ctx := context.Background()
+	service, runner, workflow := setupStepCache(t)
+	store, err := NewLocalArtifactStore(t.TempDir())
+	require.NoError(t, err)
+	service.SetArtifactStore(store)
+
+	reportPath := filepath.Join(t.TempDir(), "report.txt")
+	require.NoError(t, os.WriteFile(reportPath, []byte("coverage: 81%"), 0o600))
+	step := &workflow.Steps[0]
+	step.Artifacts = []ArtifactSpec{{Name: "report.txt", Path: reportPath}}
+
+	first := &WorkflowExecution{ID: 1, UserID: "user1"}
+	second := &WorkflowExecution{ID: 2, UserID: "user1"}
+
+	t.Run("should persist declared artifacts after a step succeeds", func(t *testing.T) {
+		stepExecution, err := service.RunStep(ctx, first, step, nil)
+		require.NoError(t, err)
+
+		artifacts, err := service.ListArtifacts(ctx, "user1", first.ID)
+		require.NoError(t, err)
+		require.Len(t, artifacts, 1)
+		assert.Equal(t, stepExecution.ID, artifacts[0].StepExecutionID)
+		assert.Equal(t, int64(13), artifacts[0].Size)
+		assert.Len(t, artifacts[0].Checksum, 64)
+	})
+
+	t.Run("should let later steps open artifacts by name", func(t *testing.T) {
+		artifact, content, err := service.OpenArtifact(ctx, "user1", first.ID, "report.txt")
+		require.NoError(t, err)
+		defer content.Close()
+		data, _ := io.ReadAll(content)
+		assert.Equal(t, "coverage: 81%", string(data))
+		assert.Equal(t, "report.txt", artifact.Name)
+	})
+
+	t.Run("should link artifacts when a step is served from cache", func(t *testing.T) {
+		stepExecution, err := service.RunStep(ctx, second, step, nil)
+		require.NoError(t, err)
+		assert.True(t, stepExecution.Cached)
+		assert.Equal(t, 1, runner.calls)
+
+		_, content, err := service.OpenArtifact(ctx, "user1", second.ID, "report.txt")
+		require.NoError(t, err)
+		content.Close()
+	})
+
+	t.Run("should not expose artifacts to other users", func(t *testing.T) {
+		artifacts, err := service.ListArtifacts(ctx, "user2", first.ID)
+		require.NoError(t, err)
+		assert.Empty(t, artifacts)
+
+		_, _, err = service.OpenArtifact(ctx, "user2", first.ID, "report.txt")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("should fail the step when a declared artifact is missing", func(t *testing.T) {
+		missing := &workflow.Steps[1]
+		missing.Artifacts = []ArtifactSpec{{Name: "missing.txt", Path: filepath.Join(t.TempDir(), "missing.txt")}}
+
+		stepExecution, err := service.RunStep(ctx, first, missing, nil)
+		require.Error(t, err)
+		assert.Equal(t, ExecutionStatusFailed, stepExecution.Status)
+	})
+
+	t.Run("should reject invalid artifact names", func(t *testing.T) {
+		_, err := service.SaveArtifact(ctx, first, &StepExecution{ID: 1}, "../report", strings.NewReader("x"))
+		assert.Error(t, err)
+	})
+}
+
+// fakeS3 is a minimal in-memory S3 endpoint for path-style object requests
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/artifacts/")
+	switch {
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case r.Method == http.MethodGet && r.URL.Path == "/artifacts":
+		prefix := r.URL.Query().Get("prefix")
+		fmt.Fprint(w, "<ListBucketResult>")
+		for k, v := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", k, len(v))
+			}
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}
+}
+
+func TestS3ArtifactStore(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	defer server.Close()
+
+	store, err := NewS3ArtifactStore(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "artifacts",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(t, err)
+	store.client.Now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	t.Run("should round-trip artifact content", func(t *testing.T) {
+		size, err := store.Put(ctx, "executions/1/steps/1/report.txt", strings.NewReader("ok"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), size)
+
+		content, err := store.Get(ctx, "executions/1/steps/1/report.txt")
+		require.NoError(t, err)
+		defer content.Close()
+		data, _ := io.ReadAll(content)
+		assert.Equal(t, "ok", string(data))
+
+		objects, err := store.List(ctx, "executions/1/")
+		require.NoError(t, err)
+		assert.Equal(t, []ArtifactObject{{Key: "executions/1/steps/1/report.txt", Size: 2}}, objects)
+	})
+
+	t.Run("should return ErrArtifactNotFound for missing keys", func(t *testing.T) {
+		_, err := store.Get(ctx, "executions/9/missing")
+		assert.ErrorIs(t, err, ErrArtifactNotFound)
+	})
+
+	t.Run("should require bucket and credentials", func(t *testing.T) {
+		_, err := NewS3ArtifactStore(S3Config{Endpoint: server.URL})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,100 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ImportWorkflows recreates exported workflows for the user. Workflow and step IDs
+// are reassigned, so step dependencies are rewritten to the new step IDs. It
+// returns a map from each exported workflow ID to its new ID.
+func (s *Service) ImportWorkflows(ctx context.Context, userID string, workflows []*Workflow) (map[uint]uint, error) {
+	imported := make([]*Workflow, len(workflows))
+	for i, workflow := range workflows {
+		copied := workflow.clone()
+		copied.ID = 0
+		copied.UserID = userID
+		if err := s.validateWorkflow(copied); err != nil {
+			return nil, fmt.Errorf("workflow '%s': %w", workflow.Name, err)
+		}
+		if copied.Variables == nil {
+			copied.Variables = make(JSONMap)
+		}
+		imported[i] = copied
+	}
+
+	ids := make(map[uint]uint, len(workflows))
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, workflow := range imported {
+			for j := range workflow.Steps {
+				step := &workflow.Steps[j]
+				step.WorkflowID = 0
+				if step.Config == nil {
+					step.Config = make(JSONMap)
+				}
+			}
+
+			oldStepIDs := takeLocalStepIDs(workflow.Steps)
+			if err := tx.Create(workflow).Error; err != nil {
+				return fmt.Errorf("failed to create workflow: %w", err)
+			}
+			ids[workflows[i].ID] = workflow.ID
+
+			if err := remapLocalStepIDs(tx, workflow.Steps, oldStepIDs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// remapStepIDs rewrites the step IDs a step refers to, in DependsOn and in a
+// condition step's skip list, to their new IDs. It reports whether the step
+// refers to any.
+func remapStepIDs(step *WorkflowStep, stepIDs map[uint]uint) (bool, error) {
+	remapped := false
+	if len(step.DependsOn) > 0 {
+		dependsOn := make([]uint, len(step.DependsOn))
+		for k, dependency := range step.DependsOn {
+			newID, ok := stepIDs[dependency]
+			if !ok {
+				return false, fmt.Errorf("step '%s' depends on unknown step %d", step.Name, dependency)
+			}
+			dependsOn[k] = newID
+		}
+		step.DependsOn = dependsOn
+		remapped = true
+	}
+
+	if step.Type == StepTypeCondition {
+		skips, err := conditionSkips(step.Config)
+		if err != nil {
+			return false, err
+		}
+		if len(skips) > 0 {
+			skip := make([]interface{}, len(skips))
+			for k, id := range skips {
+				newID, ok := stepIDs[id]
+				if !ok {
+					return false, fmt.Errorf("condition step '%s' skips unknown step %d", step.Name, id)
+				}
+				skip[k] = newID
+			}
+			config := make(JSONMap, len(step.Config))
+			for key, value := range step.Config {
+				config[key] = value
+			}
+			config[ConditionConfigSkip] = skip
+			step.Config = config
+			remapped = true
+		}
+	}
+	return remapped, nil
+}
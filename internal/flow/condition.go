@@ -0,0 +1,444 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Config keys of a StepTypeCondition step
+const (
+	// ConditionConfigExpression is the expression to evaluate, e.g.
+	// "input.env == 'prod' && steps.test.output.exit_code == 0"
+	ConditionConfigExpression = "expression"
+	// ConditionConfigSkip lists the IDs of the steps to skip when the
+	// expression is false. Each must depend on the condition step.
+	ConditionConfigSkip = "skip"
+)
+
+// validateConditionStep checks the config of a condition step
+func validateConditionStep(config JSONMap) error {
+	expression, _ := config[ConditionConfigExpression].(string)
+	if _, err := parseCondition(expression); err != nil {
+		return err
+	}
+	_, err := conditionSkips(config)
+	return err
+}
+
+// conditionSkips reads the IDs of the steps a condition step skips
+func conditionSkips(config JSONMap) ([]uint, error) {
+	raw, ok := config[ConditionConfigSkip]
+	if !ok {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, errors.New("condition step skip must be a list of step IDs")
+	}
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		var id uint
+		switch v := item.(type) {
+		case float64:
+			if v < 1 || v != float64(uint(v)) {
+				return nil, fmt.Errorf("condition step skip has invalid step ID %v", v)
+			}
+			id = uint(v)
+		case int:
+			if v < 1 {
+				return nil, fmt.Errorf("condition step skip has invalid step ID %d", v)
+			}
+			id = uint(v)
+		case uint:
+			id = v
+		default:
+			return nil, errors.New("condition step skip must be a list of step IDs")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// validateConditionSkips checks that every step a condition step skips is in
+// the workflow and depends on the condition step, so it cannot have run
+// before the condition is evaluated
+func validateConditionSkips(graph *stepGraph) error {
+	byID := make(map[uint]int, len(graph.steps))
+	for i, step := range graph.steps {
+		if step.ID != 0 {
+			byID[step.ID] = i
+		}
+	}
+	for i, step := range graph.steps {
+		if step.Type != StepTypeCondition {
+			continue
+		}
+		ids, err := conditionSkips(step.Config)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			j, ok := byID[id]
+			if !ok {
+				return fmt.Errorf("condition step '%s' skips unknown step %d", step.Name, id)
+			}
+			if !graph.dependsOn(j, i) {
+				return fmt.Errorf("condition step '%s' skips step '%s', which does not depend on it", step.Name, graph.steps[j].Name)
+			}
+		}
+	}
+	return nil
+}
+
+// runConditionStep evaluates a condition step's expression against the
+// execution context. The result, "true" or "false", is the step's stdout.
+func (s *Service) runConditionStep(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep) (*StepResult, error) {
+	expression, _ := step.Config[ConditionConfigExpression].(string)
+	condition, err := parseCondition(expression)
+	if err != nil {
+		return nil, err
+	}
+	execCtx, err := s.ExecutionContext(ctx, execution)
+	if err != nil {
+		return nil, err
+	}
+	result, err := evalBool(condition, execCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", expression, err)
+	}
+	return &StepResult{Stdout: strconv.FormatBool(result)}, nil
+}
+
+// condExpr is a parsed condition expression
+type condExpr interface {
+	eval(c *ExecutionContext) (interface{}, error)
+}
+
+type (
+	condLiteral struct{ value interface{} }
+	condPath    struct{ path string }
+	condNot     struct{ operand condExpr }
+	condBinary  struct {
+		op          string
+		left, right condExpr
+	}
+)
+
+func (e condLiteral) eval(*ExecutionContext) (interface{}, error) {
+	return e.value, nil
+}
+
+// eval looks the path up like a ${...} placeholder, e.g. input.env
+func (e condPath) eval(c *ExecutionContext) (interface{}, error) {
+	value, ok := c.lookupPlaceholder(e.path)
+	if !ok {
+		return nil, fmt.Errorf("unknown value %s", e.path)
+	}
+	return value, nil
+}
+
+func (e condNot) eval(c *ExecutionContext) (interface{}, error) {
+	value, err := evalBool(e.operand, c)
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+func (e condBinary) eval(c *ExecutionContext) (interface{}, error) {
+	switch e.op {
+	case "&&", "||":
+		left, err := evalBool(e.left, c)
+		if err != nil {
+			return nil, err
+		}
+		// Short-circuit, so the right side may reference values that only
+		// exist when the left side allows
+		if (e.op == "&&") != left {
+			return left, nil
+		}
+		return evalBool(e.right, c)
+	}
+
+	left, err := e.left.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	leftNumber, leftIsNumber := conditionNumber(left)
+	rightNumber, rightIsNumber := conditionNumber(right)
+	numeric := leftIsNumber && rightIsNumber
+
+	switch e.op {
+	case "==", "!=":
+		equal := placeholderString(left) == placeholderString(right)
+		if numeric {
+			equal = leftNumber == rightNumber
+		}
+		return equal == (e.op == "=="), nil
+	default:
+		if !numeric {
+			return nil, fmt.Errorf("cannot compare %s %s %s: both sides must be numbers", placeholderString(left), e.op, placeholderString(right))
+		}
+		switch e.op {
+		case "<":
+			return leftNumber < rightNumber, nil
+		case "<=":
+			return leftNumber <= rightNumber, nil
+		case ">":
+			return leftNumber > rightNumber, nil
+		default:
+			return leftNumber >= rightNumber, nil
+		}
+	}
+}
+
+// evalBool evaluates an expression that must be a boolean
+func evalBool(expr condExpr, c *ExecutionContext) (bool, error) {
+	value, err := expr.eval(c)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s is not a boolean", placeholderString(value))
+	}
+	return b, nil
+}
+
+// conditionNumber converts a number, or a string holding one, to a float64
+func conditionNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// parseCondition parses a condition expression. Operands are 'string' or
+// "string" literals, numbers, true, false and paths such as input.env,
+// var.region or steps.build.output.exit_code. Operands are compared with ==,
+// !=, <, <=, > and >=, and the results combined with !, && and ||, where &&
+// binds tighter than ||. Parentheses group.
+func parseCondition(expression string) (condExpr, error) {
+	tokens, err := tokenizeCondition(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition expression: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("condition step requires an expression")
+	}
+	p := &conditionParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition expression %q: %w", expression, err)
+	}
+	return expr, nil
+}
+
+type condTokenKind int
+
+const (
+	condTokenOperator condTokenKind = iota
+	condTokenString
+	condTokenNumber
+	condTokenIdent
+)
+
+type condToken struct {
+	kind condTokenKind
+	text string
+}
+
+// condOperators are the operator tokens, two-character ones first so they
+// are matched before their prefixes
+var condOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func tokenizeCondition(expression string) ([]condToken, error) {
+	var tokens []condToken
+	for i := 0; i < len(expression); {
+		ch := rune(expression[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '\'' || ch == '"':
+			end := strings.IndexRune(expression[i+1:], ch)
+			if end < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, condToken{condTokenString, expression[i+1 : i+1+end]})
+			i += end + 2
+		case unicode.IsDigit(ch) || ch == '-' && i+1 < len(expression) && unicode.IsDigit(rune(expression[i+1])):
+			start := i
+			i++
+			for i < len(expression) && (unicode.IsDigit(rune(expression[i])) || expression[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, condToken{condTokenNumber, expression[start:i]})
+		case ch == '_' || unicode.IsLetter(ch):
+			start := i
+			for ; i < len(expression); i++ {
+				c := rune(expression[i])
+				if c != '_' && c != '.' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+					break
+				}
+			}
+			tokens = append(tokens, condToken{condTokenIdent, expression[start:i]})
+		default:
+			matched := false
+			for _, op := range condOperators {
+				if strings.HasPrefix(expression[i:], op) {
+					tokens = append(tokens, condToken{condTokenOperator, op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q", ch)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// conditionParser is a recursive descent parser over condition tokens
+type conditionParser struct {
+	tokens []condToken
+	pos    int
+}
+
+// accept consumes the next token if it is one of the given operators
+func (p *conditionParser) accept(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != condTokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *conditionParser) parseOr() (condExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = condBinary{op: "||", left: left, right: right}
+	}
+}
+
+func (p *conditionParser) parseAnd() (condExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = condBinary{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *conditionParser) parseUnary() (condExpr, error) {
+	if _, ok := p.accept("!"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return condNot{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *conditionParser) parseComparison() (condExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return condBinary{op: op, left: left, right: right}, nil
+}
+
+func (p *conditionParser) parseOperand() (condExpr, error) {
+	if _, ok := p.accept("("); ok {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, errors.New("missing )")
+		}
+		return expr, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case condTokenString:
+		return condLiteral{token.text}, nil
+	case condTokenNumber:
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", token.text)
+		}
+		return condLiteral{number}, nil
+	case condTokenIdent:
+		switch token.text {
+		case "true":
+			return condLiteral{true}, nil
+		case "false":
+			return condLiteral{false}, nil
+		}
+		if !strings.Contains(token.text, ".") {
+			return nil, fmt.Errorf("unknown name %s, expected e.g. input.%s", token.text, token.text)
+		}
+		return condPath{token.text}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s", token.text)
+	}
+}
@@ -0,0 +1,145 @@
+package flow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionExpressions(t *testing.T) {
+	execCtx := &ExecutionContext{
+		Input: JSONMap{"env": "prod", "replicas": float64(3), "canary": true},
+		Vars:  JSONMap{"region": "eu-west-1"},
+		Steps: map[string]StepState{"test": {Status: ExecutionStatusCompleted, Output: JSONMap{OutputKeyExitCode: float64(0), OutputKeyStdout: "42\n"}}},
+	}
+
+	t.Run("should evaluate expressions", func(t *testing.T) {
+		for expression, want := range map[string]bool{
+			"input.env == 'prod'":                              true,
+			`input.env != "prod"`:                              false,
+			"input.replicas > 2 && input.replicas < 5":         true,
+			"input.replicas >= 4 || var.region == 'eu-west-1'": true,
+			"!(input.env == 'prod') || false":                  false,
+			"steps.test.output.exit_code == 0":                 true,
+			"steps.test.output.stdout > 40":                    true,
+			"input.canary && input.replicas == 3.0":            true,
+			"input.env == 'dev' && input.missing == 'x'":       false,
+			"input.env == 'prod' || input.env == 'staging'":    true,
+			"input.replicas > -1 && !input.canary == false":    true,
+		} {
+			condition, err := parseCondition(expression)
+			require.NoError(t, err, expression)
+			got, err := evalBool(condition, execCtx)
+			require.NoError(t, err, expression)
+			assert.Equal(t, want, got, expression)
+		}
+	})
+
+	t.Run("should reject expressions that cannot be parsed", func(t *testing.T) {
+		for expression, want := range map[string]string{
+			"":                       "requires an expression",
+			"input.env == 'prod":     "unterminated string",
+			"input.env ==":           "unexpected end of expression",
+			"(input.env == 'prod'":   "missing )",
+			"input.env = 'prod'":     "unexpected character",
+			"env == 'prod'":          "unknown name env",
+			"input.env == 'a' 'b'":   "unexpected b",
+			"input.env == 'a' && ||": "unexpected ||",
+		} {
+			_, err := parseCondition(expression)
+			assert.ErrorContains(t, err, want, expression)
+		}
+	})
+
+	t.Run("should fail to evaluate unknown values and mismatched types", func(t *testing.T) {
+		for expression, want := range map[string]string{
+			"input.missing == 'x'":   "unknown value input.missing",
+			"input.env > 2":          "both sides must be numbers",
+			"input.env":              "prod is not a boolean",
+			"input.replicas && true": "3 is not a boolean",
+		} {
+			condition, err := parseCondition(expression)
+			require.NoError(t, err, expression)
+			_, err = evalBool(condition, execCtx)
+			assert.ErrorContains(t, err, want, expression)
+		}
+	})
+}
+
+func TestConditionStep(t *testing.T) {
+	ctx := context.Background()
+
+	branching := func() *Workflow {
+		return &Workflow{Name: "Release", UserID: "user1", Steps: []WorkflowStep{
+			{ID: 1, Name: "is-prod", Type: StepTypeCondition, Order: 1,
+				Config: JSONMap{"expression": "input.env == 'prod'", "skip": []interface{}{2}}},
+			{ID: 2, Name: "deploy", Type: StepTypeCommand, Order: 2, DependsOn: []uint{1}, Config: JSONMap{"command": "true"}},
+			{ID: 3, Name: "announce", Type: StepTypeCommand, Order: 3, DependsOn: []uint{2}, Config: JSONMap{"command": "true"}},
+			{ID: 4, Name: "report", Type: StepTypeCommand, Order: 2, DependsOn: []uint{1}, Config: JSONMap{"command": "true"}},
+		}}
+	}
+
+	run := func(t *testing.T, env string) map[string]StepExecution {
+		service := setupExecutor(t)
+		workflow := branching()
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, map[string]interface{}{"env": env})
+		require.NoError(t, err)
+		execution = waitForExecution(t, service, execution.ID)
+		assert.Equal(t, ExecutionStatusCompleted, execution.Status, execution.Error)
+
+		names := make(map[uint]string, len(workflow.Steps))
+		for _, step := range workflow.Steps {
+			names[step.ID] = step.Name
+		}
+		steps := make(map[string]StepExecution, len(execution.Steps))
+		for _, step := range execution.Steps {
+			steps[names[step.StepID]] = step
+		}
+		return steps
+	}
+
+	t.Run("should run the branch when the condition is true", func(t *testing.T) {
+		steps := run(t, "prod")
+		assert.Equal(t, "true", steps["is-prod"].Output[OutputKeyStdout])
+		for _, name := range []string{"deploy", "announce", "report"} {
+			assert.Equal(t, ExecutionStatusCompleted, steps[name].Status, name)
+		}
+	})
+
+	t.Run("should cancel skipped steps when the condition is false", func(t *testing.T) {
+		steps := run(t, "dev")
+		assert.Equal(t, ExecutionStatusCompleted, steps["is-prod"].Status)
+		assert.Equal(t, "false", steps["is-prod"].Output[OutputKeyStdout])
+		assert.Equal(t, ExecutionStatusCancelled, steps["deploy"].Status)
+		assert.Equal(t, "cancelled: condition 'is-prod' was false", steps["deploy"].Error)
+		// Steps after a skipped step are cancelled with it
+		assert.Equal(t, ExecutionStatusCancelled, steps["announce"].Status)
+		assert.Equal(t, ExecutionStatusCompleted, steps["report"].Status)
+	})
+
+	t.Run("should reject invalid conditions at create time", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+
+		workflow := branching()
+		workflow.Steps[0].Config["expression"] = "input.env =="
+		assert.ErrorContains(t, service.CreateWorkflow(ctx, workflow), "invalid condition expression")
+
+		workflow = branching()
+		workflow.Steps[0].Config["skip"] = []interface{}{9}
+		assert.ErrorContains(t, service.CreateWorkflow(ctx, workflow), "skips unknown step 9")
+
+		workflow = branching()
+		workflow.Steps[3].DependsOn = nil
+		workflow.Steps[3].Order = 1
+		workflow.Steps[0].Config["skip"] = []interface{}{4}
+		assert.ErrorContains(t, service.CreateWorkflow(ctx, workflow), "skips step 'report', which does not depend on it")
+
+		workflow = branching()
+		workflow.Steps[0].Config["skip"] = "deploy"
+		assert.ErrorContains(t, service.CreateWorkflow(ctx, workflow), "skip must be a list of step IDs")
+	})
+}
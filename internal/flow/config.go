@@ -0,0 +1,69 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Config configures a flow Service
+type Config struct {
+	// RetryDelay is the backoff before a failed step's first retry
+	RetryDelay time.Duration `json:"retry_delay" yaml:"retry_delay"`
+	// StepCacheTTL enables step caching for this long when positive, see EnableStepCache
+	StepCacheTTL time.Duration `json:"step_cache_ttl" yaml:"step_cache_ttl"`
+	// MaxConcurrentExecutions queues executions beyond this many when positive
+	MaxConcurrentExecutions int `json:"max_concurrent_executions" yaml:"max_concurrent_executions"`
+	// PriorityAging is how long a queued execution waits for its priority to rise by one
+	PriorityAging time.Duration `json:"priority_aging" yaml:"priority_aging"`
+	// RedactionPatterns are regular expressions whose matches are masked in
+	// recorded step output, in addition to the environment's secret values
+	RedactionPatterns []string `json:"redaction_patterns" yaml:"redaction_patterns"`
+}
+
+// DefaultConfig returns the settings NewService uses
+func DefaultConfig() Config {
+	return Config{RetryDelay: DefaultRetryDelay, PriorityAging: DefaultPriorityAging}
+}
+
+// Validate checks the retry delay is within MaxRetryDelay, the durations and
+// limits are in range and every redaction pattern compiles
+func (c Config) Validate() error {
+	if c.RetryDelay <= 0 || c.RetryDelay > MaxRetryDelay {
+		return fmt.Errorf("retry delay must be between 0 and %s", MaxRetryDelay)
+	}
+	if c.StepCacheTTL < 0 {
+		return errors.New("step cache TTL must not be negative")
+	}
+	if c.MaxConcurrentExecutions < 0 {
+		return errors.New("max concurrent executions must not be negative")
+	}
+	if c.PriorityAging <= 0 {
+		return errors.New("priority aging must be positive")
+	}
+	for _, pattern := range c.RedactionPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid redaction pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// NewServiceWithConfig validates cfg and creates a flow service using it
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid flow config: %w", err)
+	}
+	s := NewService()
+	s.SetRetryDelay(cfg.RetryDelay)
+	s.EnableStepCache(cfg.StepCacheTTL)
+	s.SetMaxConcurrentExecutions(cfg.MaxConcurrentExecutions)
+	s.SetPriorityAging(cfg.PriorityAging)
+	patterns := make([]*regexp.Regexp, len(cfg.RedactionPatterns))
+	for i, pattern := range cfg.RedactionPatterns {
+		patterns[i] = regexp.MustCompile(pattern)
+	}
+	s.SetRedactionPatterns(patterns)
+	return s, nil
+}
@@ -0,0 +1,44 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("should create a service from a config", func(t *testing.T) {
+		service, err := NewServiceWithConfig(Config{RetryDelay: 5 * time.Second, StepCacheTTL: time.Hour, MaxConcurrentExecutions: 4, PriorityAging: time.Second, RedactionPatterns: []string{`token=\w+`}})
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Second, service.retryDelay)
+		assert.Equal(t, time.Hour, service.stepCacheTTL)
+		assert.Equal(t, 4, service.maxRuns)
+		assert.Equal(t, time.Second, service.aging)
+		require.Len(t, service.redactPatterns, 1)
+		assert.Equal(t, "***", service.newRedactor(nil).text("token=abc"))
+
+		service, err = NewServiceWithConfig(DefaultConfig())
+		require.NoError(t, err)
+		assert.Equal(t, NewService().retryDelay, service.retryDelay)
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		for _, tc := range []struct {
+			config Config
+			err    string
+		}{
+			{Config{}, "retry delay must be between"},
+			{Config{RetryDelay: time.Hour}, "retry delay must be between"},
+			{Config{RetryDelay: time.Second, StepCacheTTL: -time.Second}, "step cache TTL must not be negative"},
+			{Config{RetryDelay: time.Second, MaxConcurrentExecutions: -1, PriorityAging: time.Minute}, "max concurrent executions must not be negative"},
+			{Config{RetryDelay: time.Second}, "priority aging must be positive"},
+			{Config{RetryDelay: time.Second, PriorityAging: time.Minute, RedactionPatterns: []string{"("}}, "invalid redaction pattern '('"},
+		} {
+			assert.ErrorContains(t, tc.config.Validate(), tc.err)
+			_, err := NewServiceWithConfig(tc.config)
+			assert.ErrorContains(t, err, "invalid flow config")
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package flow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// stepGraph is the dependency graph of a workflow's steps. A step depends on
+// the steps listed in its DependsOn; a step that lists none depends on every
+// step with a lower Order, so workflows without dependencies still run their
+// steps one Order at a time and steps sharing an Order run concurrently.
+type stepGraph struct {
+	// steps are in topological order: every step comes after its dependencies
+	steps []*WorkflowStep
+	// deps holds the indexes in steps of each step's dependencies
+	deps [][]int
+}
+
+// newStepGraph builds and topologically sorts the dependency graph of steps.
+// It fails if a step depends on a step that is not in the workflow or if the
+// dependencies form a cycle, naming the steps in the cycle.
+func newStepGraph(steps []WorkflowStep) (*stepGraph, error) {
+	nodes := make([]*WorkflowStep, len(steps))
+	for i := range steps {
+		nodes[i] = &steps[i]
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Order < nodes[j].Order })
+
+	byID := make(map[uint]int, len(nodes))
+	for i, step := range nodes {
+		if step.ID == 0 {
+			continue
+		}
+		if j, ok := byID[step.ID]; ok {
+			return nil, fmt.Errorf("steps '%s' and '%s' have the same ID %d", nodes[j].Name, step.Name, step.ID)
+		}
+		byID[step.ID] = i
+	}
+	deps := make([][]int, len(nodes))
+	for i, step := range nodes {
+		if len(step.DependsOn) == 0 {
+			for j, other := range nodes {
+				if other.Order < step.Order {
+					deps[i] = append(deps[i], j)
+				}
+			}
+			continue
+		}
+		seen := make(map[int]bool, len(step.DependsOn))
+		for _, id := range step.DependsOn {
+			j, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("step '%s' depends on unknown step %d", step.Name, id)
+			}
+			if !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(nodes))
+	order := make([]int, 0, len(nodes))
+	var path []int
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			// Reaching a step still on the path closes a cycle through it
+			start := len(path) - 1
+			for path[start] != i {
+				start--
+			}
+			names := make([]string, 0, len(path)-start+1)
+			for _, j := range path[start:] {
+				names = append(names, "'"+nodes[j].Name+"'")
+			}
+			names = append(names, "'"+nodes[i].Name+"'")
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(names, " depends on "))
+		}
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		order = append(order, i)
+		return nil
+	}
+	for i := range nodes {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	position := make([]int, len(nodes))
+	for p, i := range order {
+		position[i] = p
+	}
+	graph := &stepGraph{steps: make([]*WorkflowStep, len(order)), deps: make([][]int, len(order))}
+	for p, i := range order {
+		graph.steps[p] = nodes[i]
+		for _, j := range deps[i] {
+			graph.deps[p] = append(graph.deps[p], position[j])
+		}
+	}
+	return graph, nil
+}
+
+// dependsOn reports whether step i depends on step j, directly or through
+// other steps
+func (g *stepGraph) dependsOn(i, j int) bool {
+	seen := make([]bool, len(g.steps))
+	pending := append([]int(nil), g.deps[i]...)
+	for len(pending) > 0 {
+		k := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if k == j {
+			return true
+		}
+		if !seen[k] {
+			seen[k] = true
+			pending = append(pending, g.deps[k]...)
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RunCondition decides whether a step runs based on the outcome of the steps it depends on
+type RunCondition string
+
+const (
+	// RunIfAllSucceeded runs the step only when every dependency completed
+	RunIfAllSucceeded RunCondition = "allSucceeded"
+	// RunIfAnyFailed runs the step only when at least one dependency failed,
+	// e.g. for cleanup or notification steps
+	RunIfAnyFailed RunCondition = "anyFailed"
+	// RunIfAlways runs the step whatever its dependencies' outcome
+	RunIfAlways RunCondition = "always"
+)
+
+// valid reports whether the condition is a known value or empty (meaning allSucceeded)
+func (c RunCondition) valid() bool {
+	switch c {
+	case "", RunIfAllSucceeded, RunIfAnyFailed, RunIfAlways:
+		return true
+	default:
+		return false
+	}
+}
+
+// StepState is the outcome of a step as seen by the steps after it
+type StepState struct {
+	Status ExecutionStatus
+	Output JSONMap
+	Error  string
+}
+
+// ExecutionContext is what a step can see of its execution: the execution's
+// input, the workflow's variables and environment and the state of every step
+// in the workflow, keyed by step name
+type ExecutionContext struct {
+	Input JSONMap
+	Vars  JSONMap
+	Env   JSONMap
+	Steps map[string]StepState
+	byID  map[uint]StepState
+	// skippedBy names the condition step that skips each step, by step ID
+	skippedBy map[uint]string
+	// redactor masks the environment's secrets in what the steps record
+	redactor *redactor
+}
+
+// Data returns the context as template data, so step configs can reference
+// {{ .input.branch }}, {{ .var.region }}, {{ .env.REGION }} or
+// {{ .steps.build.status }}. Steps that have not run yet have status "pending".
+func (c *ExecutionContext) Data() map[string]interface{} {
+	steps := make(map[string]interface{}, len(c.Steps))
+	for name, state := range c.Steps {
+		steps[name] = map[string]interface{}{
+			"status": state.Status.String(),
+			"output": map[string]interface{}(state.Output),
+			"error":  state.Error,
+		}
+	}
+	return map[string]interface{}{
+		"input": map[string]interface{}(c.Input),
+		"var":   map[string]interface{}(c.Vars),
+		"env":   map[string]interface{}(c.Env),
+		"steps": steps,
+	}
+}
+
+// ShouldRun reports whether the step's RunIf condition holds for the current
+// state of its dependencies, and if not, why
+func (c *ExecutionContext) ShouldRun(step *WorkflowStep) (bool, string) {
+	if len(step.DependsOn) == 0 || step.RunIf == RunIfAlways {
+		return true, ""
+	}
+
+	succeeded, failed := 0, 0
+	for _, id := range step.DependsOn {
+		switch c.byID[id].Status {
+		case ExecutionStatusCompleted:
+			succeeded++
+		case ExecutionStatusFailed, ExecutionStatusCancelled:
+			failed++
+		}
+	}
+
+	switch step.RunIf {
+	case RunIfAnyFailed:
+		if failed == 0 {
+			return false, "no dependency failed"
+		}
+	default:
+		if succeeded < len(step.DependsOn) {
+			return false, "not all dependencies succeeded"
+		}
+	}
+	return true, ""
+}
+
+// Interpolate renders a Go template against the context. Referencing an
+// unknown key is an error rather than an empty string.
+func (c *ExecutionContext) Interpolate(text string) (string, error) {
+	return c.render(text, nil)
+}
+
+// render executes text as a template against the context, with funcs available
+// to its actions
+func (c *ExecutionContext) render(text string, funcs template.FuncMap) (string, error) {
+	tmpl, err := template.New("step").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, c.Data()); err != nil {
+		return "", fmt.Errorf("failed to interpolate: %w", err)
+	}
+	return b.String(), nil
+}
+
+// resolveConfig interpolates every template and ${...} placeholder in a step
+// config, including those nested in maps and lists. Placeholders that cannot
+// be resolved are reported together in one error.
+func (c *ExecutionContext) resolveConfig(config JSONMap) (JSONMap, error) {
+	var missing []string
+	resolved, err := c.resolveValue(map[string]interface{}(config), &missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("unresolved placeholders: %s", strings.Join(missing, ", "))
+	}
+	if resolved == nil {
+		return nil, nil
+	}
+	return JSONMap(resolved.(map[string]interface{})), nil
+}
+
+func (c *ExecutionContext) resolveValue(value interface{}, missing *[]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		resolved, err := c.resolveString(v, missing)
+		if err != nil {
+			return nil, err
+		}
+		return resolved, nil
+	case map[string]interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			r, err := c.resolveValue(item, missing)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			resolved[key] = r
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := c.resolveValue(item, missing)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			resolved[i] = r
+		}
+		return resolved, nil
+	default:
+		return v, nil
+	}
+}
+
+// ExecutionContext loads the state of every step of an execution's workflow.
+// When a step ran more than once in the execution the latest run wins.
+func (s *Service) ExecutionContext(ctx context.Context, execution *WorkflowExecution) (*ExecutionContext, error) {
+	var steps []WorkflowStep
+	if err := s.db.WithContext(ctx).Where("workflow_id = ?", execution.WorkflowID).Find(&steps).Error; err != nil {
+		return nil, fmt.Errorf("failed to load workflow steps: %w", err)
+	}
+
+	var stepExecutions []StepExecution
+	if err := s.db.WithContext(ctx).Where("execution_id = ?", execution.ID).Order("id").Find(&stepExecutions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load step executions: %w", err)
+	}
+
+	var workflow Workflow
+	err := s.db.WithContext(ctx).Select("id, variables").Where("id = ?", execution.WorkflowID).First(&workflow).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to find workflow: %w", err)
+	}
+
+	env, err := s.executionEnvironment(ctx, execution)
+	if err != nil {
+		return nil, err
+	}
+
+	execCtx := &ExecutionContext{
+		Input:    execution.Input,
+		Vars:     workflow.Variables,
+		Env:      env.vars,
+		Steps:    make(map[string]StepState, len(steps)),
+		byID:     make(map[uint]StepState, len(steps)),
+		redactor: s.newRedactor(env.secrets),
+	}
+	for _, stepExecution := range stepExecutions {
+		execCtx.byID[stepExecution.StepID] = StepState{
+			Status: stepExecution.Status,
+			Output: stepExecution.Output,
+			Error:  stepExecution.Error,
+		}
+	}
+	for _, step := range steps {
+		// Steps without a run yet keep the zero state, which is pending
+		state := execCtx.byID[step.ID]
+		execCtx.Steps[step.Name] = state
+		if step.Type == StepTypeCondition && state.Status == ExecutionStatusCompleted && state.Output[OutputKeyStdout] == "false" {
+			skips, _ := conditionSkips(step.Config)
+			for _, id := range skips {
+				if execCtx.skippedBy == nil {
+					execCtx.skippedBy = make(map[uint]string)
+				}
+				execCtx.skippedBy[id] = step.Name
+			}
+		}
+	}
+	return execCtx, nil
+}
+
+// skipStep records a step that was not run because its RunIf condition did not hold
+func (s *Service) skipStep(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, input JSONMap, reason string) (*StepExecution, error) {
+	return s.recordUnrunStep(ctx, execution, step, input, ExecutionStatusSkipped, "skipped: "+reason)
+}
+
+// failUnresolvedStep records a step that was not run because its config could not be resolved
+func (s *Service) failUnresolvedStep(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, input JSONMap, resolveErr error) (*StepExecution, error) {
+	stepExecution, err := s.recordUnrunStep(ctx, execution, step, input, ExecutionStatusFailed, resolveErr.Error())
+	if err != nil {
+		return nil, err
+	}
+	return stepExecution, fmt.Errorf("step '%s' failed: %w", step.Name, resolveErr)
+}
+
+// cancelStep records a step that was not started because a step it depends on failed
+func (s *Service) cancelStep(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, input JSONMap, reason string) (*StepExecution, error) {
+	return s.recordUnrunStep(ctx, execution, step, input, ExecutionStatusCancelled, "cancelled: "+reason)
+}
+
+func (s *Service) recordUnrunStep(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, input JSONMap, status ExecutionStatus, message string) (*StepExecution, error) {
+	now := time.Now()
+	stepExecution := &StepExecution{
+		ExecutionID: execution.ID,
+		StepID:      step.ID,
+		Status:      status,
+		Input:       input,
+		Output:      make(JSONMap),
+		Error:       message,
+		StartedAt:   now,
+		CompletedAt: &now,
+	}
+	if err := s.db.WithContext(ctx).Create(stepExecution).Error; err != nil {
+		return nil, fmt.Errorf("failed to record step execution: %w", err)
+	}
+	return stepExecution, nil
+}
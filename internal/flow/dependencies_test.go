@@ -0,0 +1,223 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedRunner fails the steps named in fail and records the config each step ran with
+type scriptedRunner struct {
+	fail    map[string]bool
+	configs map[string]JSONMap
+}
+
+func (r *scriptedRunner) RunStep(ctx context.Context, step *WorkflowStep, input JSONMap) (*StepResult, error) {
+	r.configs[step.Name] = step.Config
+	if r.fail[step.Name] {
+		return &StepResult{ExitCode: 1, Stderr: "boom"}, errors.New("exit status 1")
+	}
+	return &StepResult{Stdout: step.Name + " ok"}, nil
+}
+
+func setupDependencies(t *testing.T, fail ...string) (*Service, *scriptedRunner, *WorkflowExecution, map[string]*WorkflowStep) {
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+	runner := &scriptedRunner{fail: make(map[string]bool), configs: make(map[string]JSONMap)}
+	for _, name := range fail {
+		runner.fail[name] = true
+	}
+	service.SetStepRunner(runner)
+
+	workflow := &Workflow{
+		Name:   "Release",
+		UserID: "user1",
+		Steps: []WorkflowStep{
+			{Name: "build", Type: StepTypeCommand, Config: JSONMap{"command": "make"}, Order: 1},
+		},
+	}
+	require.NoError(t, service.CreateWorkflow(ctx, workflow))
+	buildID := workflow.Steps[0].ID
+
+	workflow.Steps = append(workflow.Steps,
+		WorkflowStep{Name: "deploy", Type: StepTypeCommand, Config: JSONMap{"command": "make deploy"}, Order: 2, DependsOn: []uint{buildID}},
+		WorkflowStep{Name: "rollback", Type: StepTypeCommand, Order: 3, DependsOn: []uint{buildID}, RunIf: RunIfAnyFailed,
+			Config: JSONMap{"command": "notify build={{ .steps.build.status }} branch={{ .input.branch }}"}},
+		WorkflowStep{Name: "report", Type: StepTypeCommand, Config: JSONMap{"command": "report"}, Order: 4, DependsOn: []uint{buildID}, RunIf: RunIfAlways},
+	)
+	require.NoError(t, service.UpdateWorkflow(ctx, "user1", workflow))
+
+	steps := make(map[string]*WorkflowStep, len(workflow.Steps))
+	for i := range workflow.Steps {
+		steps[workflow.Steps[i].Name] = &workflow.Steps[i]
+	}
+
+	execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, map[string]interface{}{"branch": "main"})
+	require.NoError(t, err)
+	return service, runner, execution, steps
+}
+
+func TestStepDependencies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should run a step only when a dependency failed", func(t *testing.T) {
+		service, runner, execution, steps := setupDependencies(t, "build")
+
+		_, err := service.RunStep(ctx, execution, steps["build"], nil)
+		require.Error(t, err)
+
+		deploy, err := service.RunStep(ctx, execution, steps["deploy"], nil)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusSkipped, deploy.Status)
+		assert.Contains(t, deploy.Error, "not all dependencies succeeded")
+
+		rollback, err := service.RunStep(ctx, execution, steps["rollback"], nil)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusCompleted, rollback.Status)
+		assert.Equal(t, "notify build=failed branch=main", runner.configs["rollback"]["command"])
+
+		report, err := service.RunStep(ctx, execution, steps["report"], nil)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusCompleted, report.Status)
+		assert.NotContains(t, runner.configs, "deploy")
+	})
+
+	t.Run("should skip failure handlers when dependencies succeed", func(t *testing.T) {
+		service, runner, execution, steps := setupDependencies(t)
+
+		_, err := service.RunStep(ctx, execution, steps["build"], nil)
+		require.NoError(t, err)
+
+		deploy, err := service.RunStep(ctx, execution, steps["deploy"], nil)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusCompleted, deploy.Status)
+
+		rollback, err := service.RunStep(ctx, execution, steps["rollback"], nil)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusSkipped, rollback.Status)
+		assert.NotContains(t, runner.configs, "rollback")
+	})
+
+	t.Run("should expose every step's status to templates", func(t *testing.T) {
+		service, _, execution, steps := setupDependencies(t, "build")
+		_, _ = service.RunStep(ctx, execution, steps["build"], nil)
+		_, err := service.RunStep(ctx, execution, steps["deploy"], nil)
+		require.NoError(t, err)
+
+		execCtx, err := service.ExecutionContext(ctx, execution)
+		require.NoError(t, err)
+
+		rendered, err := execCtx.Interpolate("{{ .steps.build.status }}/{{ .steps.deploy.status }}/{{ .steps.report.status }} {{ .steps.build.error }}")
+		require.NoError(t, err)
+		assert.Equal(t, "failed/skipped/pending exit status 1", rendered)
+
+		_, err = execCtx.Interpolate("{{ .steps.missing.status }}")
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject unknown run conditions", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		err := service.CreateWorkflow(ctx, &Workflow{
+			Name:   "Bad",
+			UserID: "user1",
+			Steps:  []WorkflowStep{{Name: "step", Type: StepTypeCommand, Order: 1, RunIf: "sometimes"}},
+		})
+		assert.ErrorContains(t, err, "invalid run_if")
+	})
+
+	t.Run("should reject dependency cycles", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		err := service.CreateWorkflow(ctx, &Workflow{
+			Name:   "Cyclic",
+			UserID: "user1",
+			Steps: []WorkflowStep{
+				{ID: 1, Name: "lint", Type: StepTypeCommand, Order: 1},
+				{ID: 2, Name: "build", Type: StepTypeCommand, Order: 2, DependsOn: []uint{4}},
+				{ID: 3, Name: "test", Type: StepTypeCommand, Order: 3, DependsOn: []uint{2}},
+				{ID: 4, Name: "deploy", Type: StepTypeCommand, Order: 4, DependsOn: []uint{1, 3}},
+			},
+		})
+		require.ErrorContains(t, err, "dependency cycle detected")
+		assert.Contains(t, err.Error(), "'build'")
+		assert.Contains(t, err.Error(), "'test'")
+		assert.Contains(t, err.Error(), "'deploy'")
+		assert.NotContains(t, err.Error(), "'lint'")
+
+		err = service.CreateWorkflow(ctx, &Workflow{
+			Name:   "Self",
+			UserID: "user1",
+			Steps:  []WorkflowStep{{ID: 1, Name: "build", Type: StepTypeCommand, Order: 1, DependsOn: []uint{1}}},
+		})
+		assert.ErrorContains(t, err, "dependency cycle detected: 'build' depends on 'build'")
+
+		err = service.CreateWorkflow(ctx, &Workflow{
+			Name:   "Dangling",
+			UserID: "user1",
+			Steps:  []WorkflowStep{{ID: 1, Name: "build", Type: StepTypeCommand, Order: 1, DependsOn: []uint{7}}},
+		})
+		assert.ErrorContains(t, err, "depends on unknown step 7")
+	})
+
+	t.Run("should resolve step IDs local to the workflow", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		local := func() []WorkflowStep {
+			return []WorkflowStep{
+				{ID: 1, Name: "build", Type: StepTypeCommand, Order: 1},
+				{ID: 2, Name: "test", Type: StepTypeCommand, Order: 2, DependsOn: []uint{1}},
+				{ID: 3, Name: "deploy", Type: StepTypeCommand, Order: 3, DependsOn: []uint{1, 2}},
+			}
+		}
+		first := &Workflow{Name: "First", UserID: "user1", Steps: local()}
+		require.NoError(t, service.CreateWorkflow(ctx, first))
+		second := &Workflow{Name: "Second", UserID: "user1", Steps: local()}
+		require.NoError(t, service.CreateWorkflow(ctx, second))
+
+		stored, err := service.GetWorkflow(ctx, "user1", second.ID)
+		require.NoError(t, err)
+		require.Len(t, stored.Steps, 3)
+		ids := make(map[string]uint, len(stored.Steps))
+		for _, step := range stored.Steps {
+			ids[step.Name] = step.ID
+		}
+		assert.NotEqual(t, uint(1), ids["build"], "steps are stored under new IDs")
+		for _, step := range stored.Steps {
+			switch step.Name {
+			case "test":
+				assert.Equal(t, []uint{ids["build"]}, []uint(step.DependsOn))
+			case "deploy":
+				assert.Equal(t, []uint{ids["build"], ids["test"]}, []uint(step.DependsOn))
+			}
+		}
+	})
+
+	t.Run("should reject duplicate step names and IDs", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		err := service.CreateWorkflow(ctx, &Workflow{
+			Name:   "Names",
+			UserID: "user1",
+			Steps: []WorkflowStep{
+				{Name: "build", Type: StepTypeCommand, Order: 1},
+				{Name: "build", Type: StepTypeCommand, Order: 2},
+			},
+		})
+		assert.ErrorContains(t, err, "step 2: step name 'build' is used by more than one step")
+
+		err = service.CreateWorkflow(ctx, &Workflow{
+			Name:   "IDs",
+			UserID: "user1",
+			Steps: []WorkflowStep{
+				{ID: 1, Name: "build", Type: StepTypeCommand, Order: 1},
+				{ID: 1, Name: "test", Type: StepTypeCommand, Order: 2},
+			},
+		})
+		assert.ErrorContains(t, err, "steps 'build' and 'test' have the same ID 1")
+	})
+}
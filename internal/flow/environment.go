@@ -0,0 +1,183 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"gorm.io/gorm"
+)
+
+// SecretStore fetches secret values on behalf of a user. Implementations must
+// only return secrets the user is allowed to read.
+type SecretStore interface {
+	GetSecret(ctx context.Context, userID, key string) (string, error)
+}
+
+// Environment is a named set of variables and vault secret references shared
+// by every step of the workflows that use it
+type Environment struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	UserID    string  `json:"user_id" gorm:"uniqueIndex:idx_environments_user_name;not null"`
+	Name      string  `json:"name" gorm:"uniqueIndex:idx_environments_user_name;not null"`
+	Variables JSONMap `json:"variables" gorm:"type:text"`
+	// Secrets maps variable names to the keys of vault secrets supplying their values
+	Secrets   map[string]string `json:"secrets,omitempty" gorm:"serializer:json"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// TableName returns the table name for the Environment model
+func (Environment) TableName() string {
+	return "workflow_environments"
+}
+
+// Resolved environments are kept in memory for this many recent executions, for
+// up to this long; an evicted environment is resolved again when next needed
+const (
+	environmentCacheSize = 1000
+	environmentCacheTTL  = time.Hour
+)
+
+const (
+	// cachePruneJobName is the scheduler job dropping expired cache entries
+	cachePruneJobName = "flow.cache-prune"
+	// cachePruneInterval is how often it runs, bounding how long a resolved
+	// environment's secret values stay in memory past its TTL
+	cachePruneInterval = 5 * time.Minute
+)
+
+// SetScheduler sets the scheduler periodic work such as cache pruning runs on,
+// which is shared with other services. Without one, expired cache entries are
+// only dropped when looked up or evicted.
+func (s *Service) SetScheduler(scheduler *core.Scheduler) {
+	s.scheduler = scheduler
+}
+
+// pruneCaches drops expired resolved environments and cached workflows
+func (s *Service) pruneCaches() {
+	s.environments.Prune()
+	if s.cache != nil {
+		s.cache.Prune()
+	}
+}
+
+// SetSecretStore sets the store used to resolve environment secrets
+func (s *Service) SetSecretStore(store SecretStore) {
+	s.secrets = store
+}
+
+// CreateEnvironment creates a named environment for a user
+func (s *Service) CreateEnvironment(ctx context.Context, env *Environment) error {
+	if strings.TrimSpace(env.Name) == "" {
+		return errors.New("name is required")
+	}
+	if strings.TrimSpace(env.UserID) == "" {
+		return errors.New("user ID is required")
+	}
+	for name := range env.Variables {
+		if _, ok := env.Secrets[name]; ok {
+			return fmt.Errorf("variable '%s' is defined as both a value and a secret", name)
+		}
+	}
+	if err := core.ValidateJSONSize("variables", env.Variables); err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Create(env).Error; err != nil {
+		return fmt.Errorf("failed to create environment: %w", err)
+	}
+	return nil
+}
+
+// GetEnvironment retrieves a user's environment by name
+func (s *Service) GetEnvironment(ctx context.Context, userID, name string) (*Environment, error) {
+	var env Environment
+	err := s.db.WithContext(ctx).Where("user_id = ? AND name = ?", userID, name).First(&env).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("environment '%s' not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve environment: %w", err)
+	}
+	return &env, nil
+}
+
+// ListEnvironments returns all environments for a user
+func (s *Service) ListEnvironments(ctx context.Context, userID string) ([]*Environment, error) {
+	var envs []*Environment
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("name").Find(&envs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	return envs, nil
+}
+
+// ListEnvironmentsPage returns one page of the user's environments by name,
+// reading only that page from the store
+func (s *Service) ListEnvironmentsPage(ctx context.Context, userID string, request core.PageRequest) (*core.Page[*Environment], error) {
+	page, err := database.Paginate[*Environment](s.db.WithContext(ctx).Model(&Environment{}).Where("user_id = ?", userID).Order("name, id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	return page, nil
+}
+
+// resolvedEnvironment is an environment's variables with its secrets fetched
+type resolvedEnvironment struct {
+	vars JSONMap
+	// secrets holds the fetched secret values, so they can be redacted
+	secrets []string
+}
+
+// resolveEnvironment loads a user's environment and fetches its secrets
+func (s *Service) resolveEnvironment(ctx context.Context, userID, name string) (*resolvedEnvironment, error) {
+	env, err := s.GetEnvironment(ctx, userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Secrets) > 0 && s.secrets == nil {
+		return nil, fmt.Errorf("environment '%s' references secrets but no secret store is configured", name)
+	}
+
+	resolved := &resolvedEnvironment{vars: make(JSONMap, len(env.Variables)+len(env.Secrets))}
+	for key, value := range env.Variables {
+		resolved.vars[key] = value
+	}
+	for variable, key := range env.Secrets {
+		value, err := s.secrets.GetSecret(ctx, userID, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret for %s in environment '%s': %w", variable, name, err)
+		}
+		resolved.vars[variable] = value
+		resolved.secrets = append(resolved.secrets, value)
+	}
+	return resolved, nil
+}
+
+// executionEnvironment returns the resolved environment of an execution. It is
+// resolved once and kept in memory, never persisted, so secrets are decrypted
+// once per execution rather than once per step.
+func (s *Service) executionEnvironment(ctx context.Context, execution *WorkflowExecution) (*resolvedEnvironment, error) {
+	if env, ok := s.environments.Get(execution.ID); ok {
+		return env, nil
+	}
+
+	// Not resolved by this process, e.g. after a restart
+	var workflow Workflow
+	err := s.db.WithContext(ctx).Select("id, environment").Where("id = ?", execution.WorkflowID).First(&workflow).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to find workflow: %w", err)
+	}
+	env := &resolvedEnvironment{vars: JSONMap{}}
+	if workflow.Environment != "" {
+		if env, err = s.resolveEnvironment(ctx, execution.UserID, workflow.Environment); err != nil {
+			return nil, err
+		}
+	}
+	s.environments.Set(execution.ID, env)
+	return env, nil
+}
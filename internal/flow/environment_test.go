@@ -0,0 +1,145 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSecretStore serves fixed secrets per user and counts lookups
+type countingSecretStore struct {
+	secrets map[string]map[string]string
+	calls   int
+}
+
+func (s *countingSecretStore) GetSecret(ctx context.Context, userID, key string) (string, error) {
+	s.calls++
+	value, ok := s.secrets[userID][key]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' not found", key)
+	}
+	return value, nil
+}
+
+func TestWorkflowEnvironment(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*Service, *scriptedRunner, *countingSecretStore) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		runner := &scriptedRunner{fail: make(map[string]bool), configs: make(map[string]JSONMap)}
+		service.SetStepRunner(runner)
+		store := &countingSecretStore{secrets: map[string]map[string]string{
+			"user1": {"prod/db-password": "hunter2"},
+			"user2": {"other": "theirs"},
+		}}
+		service.SetSecretStore(store)
+
+		require.NoError(t, service.CreateEnvironment(ctx, &Environment{
+			UserID:    "user1",
+			Name:      "production",
+			Variables: JSONMap{"REGION": "eu-west-1"},
+			Secrets:   map[string]string{"DB_PASSWORD": "prod/db-password"},
+		}))
+		return service, runner, store
+	}
+
+	t.Run("should give every step the environment and fetch secrets once", func(t *testing.T) {
+		service, runner, store := setup(t)
+		workflow := &Workflow{
+			Name:        "Deploy",
+			UserID:      "user1",
+			Environment: "production",
+			Steps: []WorkflowStep{
+				{Name: "migrate", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "migrate --region {{ .env.REGION }} --password {{ .env.DB_PASSWORD }}"}},
+				{Name: "deploy", Type: StepTypeCommand, Order: 2, Config: JSONMap{"command": "deploy --region {{ .env.REGION }}", "env": map[string]interface{}{"PGPASSWORD": "{{ .env.DB_PASSWORD }}"}}},
+			},
+		}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+		for i := range workflow.Steps {
+			_, err := service.RunStep(ctx, execution, &workflow.Steps[i], nil)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, "migrate --region eu-west-1 --password hunter2", runner.configs["migrate"]["command"])
+		assert.Equal(t, "deploy --region eu-west-1", runner.configs["deploy"]["command"])
+		assert.Equal(t, "hunter2", runner.configs["deploy"]["env"].(map[string]interface{})["PGPASSWORD"])
+		assert.Equal(t, 1, store.calls)
+	})
+
+	t.Run("should resolve the environment again after a restart", func(t *testing.T) {
+		service, runner, store := setup(t)
+		workflow := &Workflow{Name: "Deploy", UserID: "user1", Environment: "production",
+			Steps: []WorkflowStep{{Name: "deploy", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "deploy {{ .env.REGION }}"}}}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+
+		// A fresh service shares the database but not the in-memory environments
+		restarted := NewService()
+		restarted.SetDB(service.db)
+		restarted.SetStepRunner(runner)
+		restarted.SetSecretStore(store)
+		_, err = restarted.RunStep(ctx, execution, &workflow.Steps[0], nil)
+		require.NoError(t, err)
+		assert.Equal(t, "deploy eu-west-1", runner.configs["deploy"]["command"])
+		assert.Equal(t, 2, store.calls)
+	})
+
+	steps := func() []WorkflowStep {
+		return []WorkflowStep{{Name: "deploy", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "deploy"}}}
+	}
+
+	t.Run("should fail to start with an unknown environment", func(t *testing.T) {
+		service, _, _ := setup(t)
+		workflow := &Workflow{Name: "Deploy", UserID: "user1", Environment: "staging", Steps: steps()}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		_, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		assert.ErrorContains(t, err, "environment 'staging' not found")
+		executions, err := service.ListExecutions(ctx, "user1", workflow.ID)
+		require.NoError(t, err)
+		assert.Empty(t, executions)
+	})
+
+	t.Run("should fail to start when a secret cannot be read", func(t *testing.T) {
+		service, _, _ := setup(t)
+		require.NoError(t, service.CreateEnvironment(ctx, &Environment{
+			UserID: "user1", Name: "borrowed", Secrets: map[string]string{"TOKEN": "other"},
+		}))
+		workflow := &Workflow{Name: "Deploy", UserID: "user1", Environment: "borrowed", Steps: steps()}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		_, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		assert.ErrorContains(t, err, "secret 'other' not found")
+	})
+
+	t.Run("should reject a variable that is also a secret", func(t *testing.T) {
+		service, _, _ := setup(t)
+		err := service.CreateEnvironment(ctx, &Environment{
+			UserID: "user1", Name: "dup", Variables: JSONMap{"TOKEN": "x"}, Secrets: map[string]string{"TOKEN": "y"},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("should prune resolved environments on the scheduler while started", func(t *testing.T) {
+		service, _, _ := setup(t)
+		scheduler := core.NewScheduler()
+		defer scheduler.Close(ctx)
+		service.SetScheduler(scheduler)
+		service.Start()
+
+		jobs := scheduler.Jobs()
+		require.Len(t, jobs, 1)
+		assert.Equal(t, cachePruneJobName, jobs[0].Name)
+		require.NoError(t, service.Close(ctx))
+		assert.Empty(t, scheduler.Jobs())
+	})
+}
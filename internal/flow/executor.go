@@ -0,0 +1,268 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+// Start makes ExecuteWorkflow run executions in the background, and schedules
+// the pruning of expired cache entries. Without it executions are only
+// recorded, and their steps are run by calling RunStep.
+func (s *Service) Start() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.runCtx != nil {
+		return
+	}
+	s.runCtx, s.stopRuns = context.WithCancel(context.Background())
+
+	err := s.scheduler.Register(core.Job{
+		Name:     cachePruneJobName,
+		Schedule: core.Every(cachePruneInterval),
+		Run: func(ctx context.Context) error {
+			s.pruneCaches()
+			return nil
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule workflow cache pruning: %v", err)
+	}
+}
+
+// Close cancels running executions and waits for them to record their
+// outcome or for ctx to be done
+func (s *Service) Close(ctx context.Context) error {
+	if err := s.scheduler.Unregister(ctx, cachePruneJobName); err != nil && !errors.Is(err, core.ErrJobNotFound) {
+		log.Printf("⚠️  Failed to stop workflow cache pruning: %v", err)
+	}
+
+	s.runMu.Lock()
+	if s.stopRuns != nil {
+		s.stopRuns()
+	}
+	queued := s.queue.drain()
+	s.runMu.Unlock()
+	s.failQueued(queued)
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startExecution runs an execution in the background if Start was called.
+// When the concurrency limit is reached the execution is queued as Pending
+// instead; see SetMaxConcurrentExecutions.
+func (s *Service) startExecution(workflow *Workflow, execution *WorkflowExecution) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.runCtx == nil || s.runCtx.Err() != nil {
+		return
+	}
+	if s.maxRuns > 0 && len(s.running) >= s.maxRuns {
+		s.queueExecution(workflow, execution)
+		return
+	}
+	s.launchExecution(workflow, execution, false)
+}
+
+// launchExecution runs an execution in the background, marking it Running
+// first if it was queued. When it finishes the next queued execution is
+// admitted. It must be called with runMu held.
+func (s *Service) launchExecution(workflow *Workflow, execution *WorkflowExecution, queued bool) {
+	// The caller keeps the execution it was given, so run on a copy
+	run := *execution
+	execution = &run
+	ctx, cancel := context.WithCancel(s.runCtx)
+	s.running[execution.ID] = cancel
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		defer func() {
+			s.runMu.Lock()
+			delete(s.running, execution.ID)
+			s.admitQueued()
+			s.runMu.Unlock()
+			cancel()
+		}()
+		if queued && !s.admitExecution(ctx, execution) {
+			return
+		}
+		s.runExecution(ctx, workflow, execution)
+	}()
+}
+
+// stopExecution cancels an execution running in the background or drops it
+// from the queue, if any
+func (s *Service) stopExecution(executionID uint) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if cancel, ok := s.running[executionID]; ok {
+		cancel()
+	}
+	s.queue.remove(executionID)
+}
+
+// runExecution runs a workflow's steps as a dependency graph, see stepGraph,
+// and records the outcome of the execution. Each step starts once all its
+// dependencies are done, so independent steps run concurrently, and RunStep
+// bounds and retries its attempts. A step whose RunIf condition does not hold
+// is recorded as Cancelled if a dependency failed or was cancelled, or as
+// Skipped otherwise. The execution fails with the error of the first step to
+// fail.
+func (s *Service) runExecution(ctx context.Context, workflow *Workflow, execution *WorkflowExecution) {
+	graph, err := newStepGraph(workflow.Steps)
+	if err != nil {
+		s.finishExecution(execution, make(JSONMap), err)
+		return
+	}
+
+	var (
+		mu     sync.Mutex
+		output = make(JSONMap, len(graph.steps))
+		runErr error
+		wg     sync.WaitGroup
+	)
+	// A step's status is written before its done channel is closed, and read
+	// by its dependents only after
+	statuses := make([]ExecutionStatus, len(graph.steps))
+	done := make([]chan struct{}, len(graph.steps))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	for i, step := range graph.steps {
+		wg.Add(1)
+		go func(i int, step *WorkflowStep) {
+			defer wg.Done()
+			defer close(done[i])
+			statuses[i] = ExecutionStatusCancelled
+			for _, dep := range graph.deps[i] {
+				select {
+				case <-done[dep]:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			status, reason := dependencyOutcome(step, graph, statuses, i)
+			if status != ExecutionStatusRunning {
+				record := s.skipStep
+				if status == ExecutionStatusCancelled {
+					record = s.cancelStep
+				}
+				if _, err := record(ctx, execution, step, execution.Input, reason); err != nil {
+					log.Printf("⚠️  Execution %d: %v", execution.ID, err)
+				}
+				statuses[i] = status
+				return
+			}
+
+			stepExecution, err := s.RunStep(ctx, execution, step, execution.Input)
+			switch {
+			case err != nil:
+				statuses[i] = ExecutionStatusFailed
+			case stepExecution.Status == ExecutionStatusSkipped, stepExecution.Status == ExecutionStatusCancelled:
+				statuses[i] = stepExecution.Status
+			default:
+				statuses[i] = ExecutionStatusCompleted
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if stepExecution != nil {
+				output[step.Name] = stepExecution.Output
+			}
+			if err != nil && runErr == nil {
+				runErr = err
+			}
+		}(i, step)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil && runErr == nil {
+		runErr = errors.New("execution was interrupted")
+	}
+	s.finishExecution(execution, output, runErr)
+}
+
+// dependencyOutcome decides from the statuses of its dependencies whether the
+// step at index i of graph runs, returning Running if so, or the status to
+// record it with instead and why
+func dependencyOutcome(step *WorkflowStep, graph *stepGraph, statuses []ExecutionStatus, i int) (ExecutionStatus, string) {
+	if step.RunIf == RunIfAlways {
+		return ExecutionStatusRunning, ""
+	}
+
+	succeeded := 0
+	var failed []string
+	for _, dep := range graph.deps[i] {
+		switch statuses[dep] {
+		case ExecutionStatusCompleted:
+			succeeded++
+		case ExecutionStatusFailed, ExecutionStatusCancelled:
+			failed = append(failed, "'"+graph.steps[dep].Name+"'")
+		}
+	}
+
+	switch step.RunIf {
+	case RunIfAnyFailed:
+		if len(failed) == 0 {
+			return ExecutionStatusSkipped, "no dependency failed"
+		}
+	default:
+		if len(failed) > 0 {
+			return ExecutionStatusCancelled, "a dependency did not succeed: " + strings.Join(failed, ", ")
+		}
+		if succeeded < len(graph.deps[i]) {
+			return ExecutionStatusSkipped, "not all dependencies succeeded"
+		}
+	}
+	return ExecutionStatusRunning, ""
+}
+
+// finishExecution records the outcome of an execution, unless it was
+// cancelled in the meantime
+func (s *Service) finishExecution(execution *WorkflowExecution, output JSONMap, runErr error) {
+	// An output too large to store fails the execution rather than its record
+	if err := core.ValidateJSONSize("execution output", output); err != nil {
+		output = make(JSONMap)
+		if runErr == nil {
+			runErr = err
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       ExecutionStatusCompleted,
+		"output":       output,
+		"completed_at": &now,
+	}
+	if runErr != nil {
+		updates["status"] = ExecutionStatusFailed
+		updates["error"] = runErr.Error()
+	}
+
+	// The run has finished, so record it even though its context is done
+	err := s.db.Model(&WorkflowExecution{}).
+		Where("id = ? AND status = ?", execution.ID, ExecutionStatusRunning).
+		Updates(updates).Error
+	if err != nil {
+		log.Printf("⚠️  Failed to record the outcome of execution %d: %v", execution.ID, err)
+	}
+	s.environments.Delete(execution.ID)
+}
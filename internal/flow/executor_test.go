@@ -0,0 +1,242 @@
+package flow
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupExecutor(t *testing.T) *Service {
+	db := setupTestDB(t)
+	// Executions run in the background; one connection keeps them on the same in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	service := NewService()
+	service.SetDB(db)
+	service.SetStepRunner(NewExecRunner())
+	service.Start()
+	t.Cleanup(func() { require.NoError(t, service.Close(context.Background())) })
+	return service
+}
+
+// waitForExecution polls an execution until it is no longer queued or running
+func waitForExecution(t *testing.T, service *Service, executionID uint) *WorkflowExecution {
+	var execution *WorkflowExecution
+	require.Eventually(t, func() bool {
+		var err error
+		execution, err = service.GetExecutionStatus(context.Background(), "user1", executionID)
+		require.NoError(t, err)
+		return execution.Status != ExecutionStatusRunning && execution.Status != ExecutionStatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+	return execution
+}
+
+func TestWorkflowExecutor(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should run command and http steps in order", func(t *testing.T) {
+		service := setupExecutor(t)
+		var method, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			method, body = r.Method, string(data)
+			_, _ = w.Write([]byte("deployed"))
+		}))
+		defer server.Close()
+
+		workflow := &Workflow{Name: "Deploy", UserID: "user1", Steps: []WorkflowStep{
+			{Name: "notify", Type: StepTypeHTTP, Order: 2, Config: JSONMap{"method": "post", "url": server.URL, "body": map[string]interface{}{"version": "{{ .input.version }}"}}},
+			{Name: "build", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "echo building $VERSION; echo warning >&2", "env": map[string]interface{}{"VERSION": "{{ .input.version }}"}}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, map[string]interface{}{"version": "1.2.3"})
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusRunning, execution.Status)
+
+		execution = waitForExecution(t, service, execution.ID)
+		assert.Equal(t, ExecutionStatusCompleted, execution.Status, execution.Error)
+		assert.NotNil(t, execution.CompletedAt)
+		require.Len(t, execution.Steps, 2)
+
+		build, err := execution.Steps[0].Result()
+		require.NoError(t, err)
+		assert.Equal(t, "building 1.2.3\n", build.Stdout)
+		assert.Equal(t, "warning\n", build.Stderr)
+		notify, err := execution.Steps[1].Result()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, notify.HTTPStatus)
+		assert.Equal(t, "deployed", notify.ResponseBody)
+		assert.Equal(t, http.MethodPost, method)
+		assert.JSONEq(t, `{"version":"1.2.3"}`, body)
+		assert.Contains(t, execution.Output, "build")
+	})
+
+	t.Run("should fail the execution and cancel later steps when a step fails", func(t *testing.T) {
+		service := setupExecutor(t)
+		workflow := &Workflow{Name: "Deploy", UserID: "user1", Steps: []WorkflowStep{
+			{Name: "test", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "echo failing >&2; exit 3"}},
+			{Name: "deploy", Type: StepTypeCommand, Order: 2, Config: JSONMap{"command": "echo deploying"}},
+			{Name: "cleanup", Type: StepTypeCommand, Order: 3, RunIf: RunIfAlways, Config: JSONMap{"command": "echo cleaning"}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+		execution = waitForExecution(t, service, execution.ID)
+
+		assert.Equal(t, ExecutionStatusFailed, execution.Status)
+		assert.Contains(t, execution.Error, "exit status 3")
+		require.Len(t, execution.Steps, 3)
+		assert.Equal(t, ExecutionStatusFailed, execution.Steps[0].Status)
+		assert.Contains(t, execution.Steps[0].Error, "exit status 3")
+		result, err := execution.Steps[0].Result()
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.ExitCode)
+		assert.Equal(t, "failing\n", result.Stderr)
+		assert.Equal(t, ExecutionStatusCancelled, execution.Steps[1].Status)
+		assert.Contains(t, execution.Steps[1].Error, "'test'")
+		assert.Equal(t, ExecutionStatusCompleted, execution.Steps[2].Status)
+	})
+
+	t.Run("should stop a step at its timeout", func(t *testing.T) {
+		service := setupExecutor(t)
+		workflow := &Workflow{Name: "Slow", UserID: "user1", Steps: []WorkflowStep{
+			{Name: "hang", Type: StepTypeCommand, Order: 1, Timeout: 1, Config: JSONMap{"command": "sleep 30"}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		start := time.Now()
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+		execution = waitForExecution(t, service, execution.ID)
+
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.Equal(t, ExecutionStatusFailed, execution.Status)
+		assert.Contains(t, execution.Steps[0].Error, "timed out")
+	})
+
+	t.Run("should report progress while steps run", func(t *testing.T) {
+		service := setupExecutor(t)
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		workflow := &Workflow{Name: "Deploy", UserID: "user1", Steps: []WorkflowStep{
+			{Name: "build", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "true"}},
+			{Name: "wait", Type: StepTypeHTTP, Order: 2, Config: JSONMap{"url": server.URL}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			status, err := service.GetExecutionStatus(ctx, "user1", execution.ID)
+			require.NoError(t, err)
+			return len(status.Steps) == 2 && status.Steps[1].Status == ExecutionStatusRunning
+		}, 5*time.Second, 10*time.Millisecond)
+
+		status, err := service.GetExecutionStatus(ctx, "user1", execution.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusRunning, status.Status)
+		assert.Equal(t, ExecutionStatusCompleted, status.Steps[0].Status)
+	})
+
+	t.Run("should stop running steps when cancelled", func(t *testing.T) {
+		service := setupExecutor(t)
+		workflow := &Workflow{Name: "Slow", UserID: "user1", Steps: []WorkflowStep{
+			{Name: "hang", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "sleep 30"}},
+			{Name: "after", Type: StepTypeCommand, Order: 2, Config: JSONMap{"command": "true"}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			status, err := service.GetExecutionStatus(ctx, "user1", execution.ID)
+			require.NoError(t, err)
+			return len(status.Steps) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, service.CancelExecution(ctx, "user1", execution.ID))
+		closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		require.NoError(t, service.Close(closeCtx))
+
+		status, err := service.GetExecutionStatus(ctx, "user1", execution.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusCancelled, status.Status)
+		require.Len(t, status.Steps, 1)
+		assert.Equal(t, ExecutionStatusFailed, status.Steps[0].Status)
+	})
+
+	t.Run("should run independent steps concurrently and wait for dependencies", func(t *testing.T) {
+		service := setupExecutor(t)
+		dir := t.TempDir()
+		// left and right each wait for the other, so they only finish if they run at once
+		workflow := &Workflow{Name: "Build", UserID: "user1", Steps: []WorkflowStep{
+			{ID: 10, Name: "prepare", Type: StepTypeCommand, Order: 1, Config: JSONMap{"dir": dir, "command": "touch prepared"}},
+			{ID: 20, Name: "left", Type: StepTypeCommand, Order: 2, Timeout: 5, DependsOn: []uint{10}, Config: JSONMap{"dir": dir, "command": "test -f prepared && touch left && until [ -f right ]; do sleep 0.01; done"}},
+			{ID: 30, Name: "right", Type: StepTypeCommand, Order: 3, Timeout: 5, DependsOn: []uint{10}, Config: JSONMap{"dir": dir, "command": "test -f prepared && touch right && until [ -f left ]; do sleep 0.01; done"}},
+			{ID: 40, Name: "merge", Type: StepTypeCommand, Order: 4, DependsOn: []uint{20, 30}, Config: JSONMap{"dir": dir, "command": "test -f left && test -f right && echo merged"}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+		execution = waitForExecution(t, service, execution.ID)
+
+		assert.Equal(t, ExecutionStatusCompleted, execution.Status, execution.Error)
+		require.Len(t, execution.Steps, 4)
+		assert.Equal(t, workflow.Steps[0].ID, execution.Steps[0].StepID)
+		assert.Equal(t, workflow.Steps[3].ID, execution.Steps[3].StepID)
+		merge, err := execution.Steps[3].Result()
+		require.NoError(t, err)
+		assert.Equal(t, "merged\n", merge.Stdout)
+	})
+
+	t.Run("should cancel steps whose dependencies failed", func(t *testing.T) {
+		service := setupExecutor(t)
+		workflow := &Workflow{Name: "Release", UserID: "user1", Steps: []WorkflowStep{
+			{ID: 10, Name: "build", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "exit 1"}},
+			{ID: 20, Name: "lint", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "true"}},
+			{ID: 30, Name: "test", Type: StepTypeCommand, Order: 2, DependsOn: []uint{10}, Config: JSONMap{"command": "true"}},
+			{ID: 40, Name: "deploy", Type: StepTypeCommand, Order: 3, DependsOn: []uint{30}, Config: JSONMap{"command": "true"}},
+			{ID: 50, Name: "rollback", Type: StepTypeCommand, Order: 4, DependsOn: []uint{40}, RunIf: RunIfAnyFailed, Config: JSONMap{"command": "true"}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+		execution = waitForExecution(t, service, execution.ID)
+
+		assert.Equal(t, ExecutionStatusFailed, execution.Status)
+		assert.Contains(t, execution.Error, "exit status 1")
+		names := make(map[uint]string, len(workflow.Steps))
+		for _, step := range workflow.Steps {
+			names[step.ID] = step.Name
+		}
+		statuses := make(map[string]StepExecution, len(execution.Steps))
+		for _, step := range execution.Steps {
+			statuses[names[step.StepID]] = step
+		}
+		require.Len(t, statuses, 5)
+		assert.Equal(t, ExecutionStatusFailed, statuses["build"].Status)
+		assert.Equal(t, ExecutionStatusCompleted, statuses["lint"].Status)
+		assert.Equal(t, ExecutionStatusCancelled, statuses["test"].Status)
+		assert.Contains(t, statuses["test"].Error, "'build'")
+		assert.Equal(t, ExecutionStatusCancelled, statuses["deploy"].Status)
+		assert.Contains(t, statuses["deploy"].Error, "'test'")
+		assert.Equal(t, ExecutionStatusCompleted, statuses["rollback"].Status)
+	})
+}
@@ -0,0 +1,135 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Formats ExportWorkflowGraph renders
+const (
+	GraphFormatDOT     = "dot"
+	GraphFormatMermaid = "mermaid"
+)
+
+// graphEdge is a dependency of step To on step From, both indexes into a
+// stepGraph's steps
+type graphEdge struct {
+	From, To int
+}
+
+// ExportWorkflowGraph renders the dependency graph of a workflow's steps as
+// Graphviz DOT or a Mermaid flowchart. Each step is a node labelled with its
+// name and type, and edges point from a step to the steps depending on it,
+// labelled with their run condition unless it is the default. Steps without
+// DependsOn are drawn depending on the steps of the Order before them, which
+// is how they run. It fails if the dependencies form a cycle.
+func (s *Service) ExportWorkflowGraph(ctx context.Context, userID string, workflowID uint, format string) ([]byte, error) {
+	if format != GraphFormatDOT && format != GraphFormatMermaid {
+		return nil, fmt.Errorf("unsupported graph format '%s'", format)
+	}
+	workflow, err := s.GetWorkflow(ctx, userID, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := newStepGraph(workflow.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := graph.edges()
+	if format == GraphFormatMermaid {
+		return graph.mermaid(edges), nil
+	}
+	return graph.dot(workflow.Name, edges), nil
+}
+
+// edges returns the graph's dependencies in topological order. Steps without
+// DependsOn depend on every step of a lower Order; of those, only the ones
+// not already reached through another dependency are kept, so a chain of
+// Orders draws as a chain.
+func (g *stepGraph) edges() []graphEdge {
+	var edges []graphEdge
+	for i, step := range g.steps {
+		for _, j := range g.deps[i] {
+			if len(step.DependsOn) == 0 && g.reachedThroughOther(i, j) {
+				continue
+			}
+			edges = append(edges, graphEdge{From: j, To: i})
+		}
+	}
+	return edges
+}
+
+// reachedThroughOther reports whether step i depends on step j through one
+// of its other dependencies
+func (g *stepGraph) reachedThroughOther(i, j int) bool {
+	for _, k := range g.deps[i] {
+		if k != j && g.dependsOn(k, j) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *stepGraph) dot(name string, edges []graphEdge) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph %s {\n", dotQuote(name))
+	buf.WriteString("  rankdir=LR;\n  node [shape=box];\n")
+	for _, step := range g.steps {
+		fmt.Fprintf(&buf, "  %s [label=%s];\n", graphNodeID(step), dotQuote(step.Name+"\n("+step.Type.String()+")"))
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&buf, "  %s -> %s", graphNodeID(g.steps[edge.From]), graphNodeID(g.steps[edge.To]))
+		if condition := edgeCondition(g.steps[edge.To]); condition != "" {
+			fmt.Fprintf(&buf, " [label=%s]", dotQuote(condition))
+		}
+		buf.WriteString(";\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func (g *stepGraph) mermaid(edges []graphEdge) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("flowchart LR\n")
+	for _, step := range g.steps {
+		fmt.Fprintf(&buf, "  %s[%s]\n", graphNodeID(step), mermaidQuote(step.Name+"<br/>("+step.Type.String()+")"))
+	}
+	for _, edge := range edges {
+		arrow := "-->"
+		if condition := edgeCondition(g.steps[edge.To]); condition != "" {
+			arrow = "-->|" + mermaidQuote(condition) + "|"
+		}
+		fmt.Fprintf(&buf, "  %s %s %s\n", graphNodeID(g.steps[edge.From]), arrow, graphNodeID(g.steps[edge.To]))
+	}
+	return buf.Bytes()
+}
+
+// graphNodeID identifies a step in a rendered graph
+func graphNodeID(step *WorkflowStep) string {
+	return fmt.Sprintf("step%d", step.ID)
+}
+
+// edgeCondition is the label of the edges into a step: its run condition,
+// unless it runs only when its dependencies succeed
+func edgeCondition(step *WorkflowStep) string {
+	if step.RunIf == "" || step.RunIf == RunIfAllSucceeded {
+		return ""
+	}
+	return string(step.RunIf)
+}
+
+// dotQuote quotes s as a DOT string, keeping newlines as line breaks
+func dotQuote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// mermaidQuote quotes s as Mermaid text, escaping characters with meaning in
+// the flowchart syntax
+func mermaidQuote(s string) string {
+	replacer := strings.NewReplacer(`"`, "#quot;", "|", "#124;")
+	return `"` + replacer.Replace(s) + `"`
+}
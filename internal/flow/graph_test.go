@@ -0,0 +1,80 @@
+package flow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportWorkflowGraph(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	db := setupTestDB(t)
+	service.SetDB(db)
+
+	workflow := &Workflow{
+		Name:   `Release "main"`,
+		UserID: "user1",
+		Steps: []WorkflowStep{
+			{ID: 1, Name: "checkout", Type: StepTypeCommand, Order: 1},
+			{ID: 2, Name: "lint", Type: StepTypeScript, Order: 2},
+			{ID: 3, Name: "test", Type: StepTypeCommand, Order: 2},
+			{ID: 4, Name: "build", Type: StepTypeCommand, Order: 3, DependsOn: []uint{2, 3}},
+			{ID: 5, Name: "deploy", Type: StepTypeScript, Order: 4},
+			{ID: 6, Name: "notify", Type: StepTypeCommand, Order: 5, DependsOn: []uint{4}, RunIf: RunIfAnyFailed},
+		},
+	}
+	require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+	t.Run("should render the step DAG as DOT", func(t *testing.T) {
+		graph, err := service.ExportWorkflowGraph(ctx, "user1", workflow.ID, GraphFormatDOT)
+		require.NoError(t, err)
+		dot := string(graph)
+
+		assert.Contains(t, dot, `digraph "Release \"main\"" {`)
+		for _, node := range []string{
+			`step1 [label="checkout\n(command)"];`,
+			`step2 [label="lint\n(script)"];`,
+			`step5 [label="deploy\n(script)"];`,
+			`step6 [label="notify\n(command)"];`,
+		} {
+			assert.Contains(t, dot, node)
+		}
+		for _, edge := range []string{
+			"step1 -> step2;", "step1 -> step3;", "step2 -> step4;", "step3 -> step4;",
+			"step4 -> step5;", `step4 -> step6 [label="anyFailed"];`,
+		} {
+			assert.Contains(t, dot, edge)
+		}
+		assert.NotContains(t, dot, "step1 -> step5", "implicit dependencies reached through others are not drawn")
+		assert.NotContains(t, dot, "step3 -> step2", "steps sharing an Order do not depend on each other")
+	})
+
+	t.Run("should render the step DAG as Mermaid", func(t *testing.T) {
+		graph, err := service.ExportWorkflowGraph(ctx, "user1", workflow.ID, GraphFormatMermaid)
+		require.NoError(t, err)
+		mermaid := string(graph)
+
+		assert.Contains(t, mermaid, "flowchart LR\n")
+		assert.Contains(t, mermaid, `step4["build<br/>(command)"]`)
+		assert.Contains(t, mermaid, "step2 --> step4\n")
+		assert.Contains(t, mermaid, `step4 -->|"anyFailed"| step6`)
+	})
+
+	t.Run("should reject unknown formats and workflows", func(t *testing.T) {
+		_, err := service.ExportWorkflowGraph(ctx, "user1", workflow.ID, "svg")
+		assert.ErrorContains(t, err, "unsupported graph format 'svg'")
+
+		_, err = service.ExportWorkflowGraph(ctx, "user2", workflow.ID, GraphFormatDOT)
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("should refuse to export a cyclic graph", func(t *testing.T) {
+		require.NoError(t, db.Model(&WorkflowStep{}).Where("id = ?", 2).Update("depends_on", "[6]").Error)
+
+		_, err := service.ExportWorkflowGraph(ctx, "user1", workflow.ID, GraphFormatDOT)
+		assert.ErrorContains(t, err, "dependency cycle detected")
+	})
+}
@@ -0,0 +1,151 @@
+package flow
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// junitTimestamp is the timestamp layout JUnit consumers expect: ISO 8601 without a zone
+const junitTimestamp = "2006-01-02T15:04:05"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	ID        int             `xml:"id,attr"`
+	Package   string          `xml:"package,attr"`
+	Hostname  string          `xml:"hostname,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// ExportExecutionJUnit renders a finished execution as a JUnit XML report with
+// one test case per workflow step, so CI systems can display workflow runs.
+// Failed steps are reported as failures; skipped, cancelled and never-run
+// steps as skipped. When a step ran more than once its latest run is reported.
+func (s *Service) ExportExecutionJUnit(ctx context.Context, userID string, executionID uint) ([]byte, error) {
+	execution, err := s.GetExecutionStatus(ctx, userID, executionID)
+	if err != nil {
+		return nil, err
+	}
+	switch execution.Status {
+	case ExecutionStatusCompleted, ExecutionStatusFailed, ExecutionStatusCancelled:
+	default:
+		return nil, fmt.Errorf("execution %d has not finished", executionID)
+	}
+
+	var workflow Workflow
+	if err := s.db.WithContext(ctx).Unscoped().Preload("Steps").First(&workflow, execution.WorkflowID).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve workflow: %w", err)
+	}
+	sort.SliceStable(workflow.Steps, func(i, j int) bool { return workflow.Steps[i].Order < workflow.Steps[j].Order })
+
+	latest := make(map[uint]*StepExecution, len(execution.Steps))
+	for i := range execution.Steps {
+		run := &execution.Steps[i]
+		if previous, ok := latest[run.StepID]; !ok || run.ID > previous.ID {
+			latest[run.StepID] = run
+		}
+	}
+
+	suite := junitTestSuite{
+		Name:      workflow.Name,
+		Package:   workflow.Name,
+		Hostname:  "vertex",
+		Time:      junitSeconds(execution.StartedAt, execution.CompletedAt),
+		Timestamp: execution.StartedAt.UTC().Format(junitTimestamp),
+	}
+	for _, step := range workflow.Steps {
+		testCase := junitTestCase{Name: step.Name, ClassName: workflow.Name, Time: "0.000"}
+		run, ok := latest[step.ID]
+		result := &StepResult{}
+		if ok {
+			// A malformed output should not hide the step's status from the report
+			if parsed, err := run.Result(); err == nil {
+				result = parsed
+			}
+		}
+		switch {
+		case !ok:
+			testCase.Skipped = &junitMessage{Message: "step did not run"}
+		case run.Status == ExecutionStatusFailed:
+			testCase.Failure = &junitMessage{Message: run.Error, Type: "StepFailed", Text: result.Stderr}
+		case run.Status != ExecutionStatusCompleted:
+			message := run.Error
+			if message == "" {
+				message = "step " + run.Status.String()
+			}
+			testCase.Skipped = &junitMessage{Message: message}
+		}
+		if ok {
+			testCase.Time = junitSeconds(run.StartedAt, run.CompletedAt)
+			testCase.SystemOut = result.Stdout
+			testCase.SystemErr = result.Stderr
+		}
+
+		suite.Tests++
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+		if testCase.Skipped != nil {
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	report := junitTestSuites{
+		Name:     fmt.Sprintf("%s #%d", workflow.Name, execution.ID),
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	body, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to render JUnit report: %w", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// junitSeconds formats the time between start and end in seconds, or zero if
+// either is unknown
+func junitSeconds(start time.Time, end *time.Time) string {
+	if start.IsZero() || end == nil || end.Before(start) {
+		return "0.000"
+	}
+	return fmt.Sprintf("%.3f", end.Sub(start).Seconds())
+}
@@ -0,0 +1,77 @@
+package flow
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportExecutionJUnit(t *testing.T) {
+	ctx := context.Background()
+	service, _, execution, steps := setupDependencies(t, "build")
+
+	t.Run("should refuse an execution that has not finished", func(t *testing.T) {
+		_, err := service.ExportExecutionJUnit(ctx, "user1", execution.ID)
+		assert.ErrorContains(t, err, "has not finished")
+	})
+
+	// build fails, so deploy is skipped, rollback runs and report is never run
+	_, err := service.RunStep(ctx, execution, steps["build"], nil)
+	require.Error(t, err)
+	for _, name := range []string{"deploy", "rollback"} {
+		_, err := service.RunStep(ctx, execution, steps[name], nil)
+		require.NoError(t, err)
+	}
+	require.NoError(t, service.db.Model(execution).Updates(map[string]interface{}{"status": ExecutionStatusFailed, "completed_at": execution.StartedAt}).Error)
+
+	report, err := service.ExportExecutionJUnit(ctx, "user1", execution.ID)
+	require.NoError(t, err)
+
+	t.Run("should validate against the JUnit schema", func(t *testing.T) {
+		xmllint, err := exec.LookPath("xmllint")
+		if err != nil {
+			t.Skip("xmllint not installed")
+		}
+		path := filepath.Join(t.TempDir(), "report.xml")
+		require.NoError(t, os.WriteFile(path, report, 0o600))
+		out, err := exec.Command(xmllint, "--noout", "--schema", "testdata/junit.xsd", path).CombinedOutput()
+		assert.NoError(t, err, string(out))
+	})
+
+	t.Run("should map step statuses to JUnit states", func(t *testing.T) {
+		var suites junitTestSuites
+		require.NoError(t, xml.Unmarshal(report, &suites))
+		require.Len(t, suites.Suites, 1)
+		suite := suites.Suites[0]
+		assert.Equal(t, "Release", suite.Name)
+		assert.Equal(t, 4, suite.Tests)
+		assert.Equal(t, 1, suite.Failures)
+		assert.Equal(t, 2, suite.Skipped)
+
+		cases := make(map[string]junitTestCase, len(suite.Cases))
+		for _, c := range suite.Cases {
+			cases[c.Name] = c
+		}
+		require.NotNil(t, cases["build"].Failure)
+		assert.Equal(t, "exit status 1", cases["build"].Failure.Message)
+		assert.Equal(t, "boom", cases["build"].Failure.Text)
+		require.NotNil(t, cases["deploy"].Skipped)
+		assert.Contains(t, cases["deploy"].Skipped.Message, "not all dependencies succeeded")
+		assert.Nil(t, cases["rollback"].Failure)
+		assert.Nil(t, cases["rollback"].Skipped)
+		assert.Equal(t, "rollback ok", cases["rollback"].SystemOut)
+		require.NotNil(t, cases["report"].Skipped)
+		assert.Equal(t, "step did not run", cases["report"].Skipped.Message)
+	})
+
+	t.Run("should not export another user's execution", func(t *testing.T) {
+		_, err := service.ExportExecutionJUnit(ctx, "user2", execution.ID)
+		assert.ErrorContains(t, err, "not found")
+	})
+}
@@ -4,8 +4,10 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"gorm.io/gorm"
 )
 
@@ -34,7 +36,16 @@ func (j JSONMap) Value() (driver.Value, error) {
 	if len(j) == 0 {
 		return "{}", nil
 	}
-	return json.Marshal(j)
+	data, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	// Oversized values are rejected here as a last resort; services validate
+	// user input before it gets this far
+	if err := core.CheckJSONSize(data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 // Workflow represents a workflow definition
@@ -46,6 +57,7 @@ type Workflow struct {
 	Status      WorkflowStatus `json:"status" gorm:"default:0"`
 	Steps       []WorkflowStep `json:"steps" gorm:"foreignKey:WorkflowID;constraint:OnDelete:CASCADE"`
 	Variables   JSONMap        `json:"variables" gorm:"type:text"`
+	Environment string         `json:"environment,omitempty"` // name of an Environment shared by every step
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -56,6 +68,13 @@ func (Workflow) TableName() string {
 	return "workflows"
 }
 
+// clone returns a copy of the workflow that does not share its steps slice
+func (w *Workflow) clone() *Workflow {
+	copied := *w
+	copied.Steps = append([]WorkflowStep(nil), w.Steps...)
+	return &copied
+}
+
 // WorkflowStatus represents the status of a workflow
 type WorkflowStatus int
 
@@ -87,9 +106,12 @@ type WorkflowStep struct {
 	Type       StepType `json:"type" gorm:"not null"`
 	Config     JSONMap  `json:"config" gorm:"type:text"`
 	Order      int      `json:"order" gorm:"not null"`
-	DependsOn  []uint   `json:"depends_on" gorm:"serializer:json"`
+	DependsOn  []uint   `json:"depends_on" gorm:"serializer:json"` // IDs of steps of the same workflow, local to a create or update request
+	RunIf      RunCondition `json:"run_if,omitempty"` // when to run given the outcome of DependsOn; defaults to allSucceeded
 	Timeout    int      `json:"timeout" gorm:"default:300"` // seconds
 	Retries    int      `json:"retries" gorm:"default:0"`
+	NoCache    bool     `json:"no_cache" gorm:"default:false"` // never reuse cached output for this step
+	Artifacts  []ArtifactSpec `json:"artifacts,omitempty" gorm:"serializer:json"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
@@ -106,9 +128,12 @@ const (
 	StepTypeCommand StepType = iota
 	StepTypeHTTP
 	StepTypeScript
+	// StepTypeCondition evaluates an expression and skips steps when it is false; see runConditionStep
 	StepTypeCondition
 	StepTypeLoop
 	StepTypeParallel
+	// StepTypeService calls another Vertex service; see runServiceStep
+	StepTypeService
 )
 
 // String returns the string representation of StepType
@@ -126,6 +151,8 @@ func (s StepType) String() string {
 		return "loop"
 	case StepTypeParallel:
 		return "parallel"
+	case StepTypeService:
+		return "service"
 	default:
 		return "unknown"
 	}
@@ -140,6 +167,7 @@ type WorkflowExecution struct {
 	Input       JSONMap         `json:"input" gorm:"type:text"`
 	Output      JSONMap         `json:"output" gorm:"type:text"`
 	Error       string          `json:"error"`
+	Priority    int             `json:"priority" gorm:"default:0"` // higher is admitted first when queued
 	StartedAt   time.Time       `json:"started_at"`
 	CompletedAt *time.Time      `json:"completed_at"`
 	Steps       []StepExecution `json:"steps" gorm:"foreignKey:ExecutionID;constraint:OnDelete:CASCADE"`
@@ -159,6 +187,7 @@ const (
 	ExecutionStatusCompleted
 	ExecutionStatusFailed
 	ExecutionStatusCancelled
+	ExecutionStatusSkipped // step not run because its dependencies did not allow it
 )
 
 // String returns the string representation of ExecutionStatus
@@ -174,6 +203,8 @@ func (e ExecutionStatus) String() string {
 		return "failed"
 	case ExecutionStatusCancelled:
 		return "cancelled"
+	case ExecutionStatusSkipped:
+		return "skipped"
 	default:
 		return "unknown"
 	}
@@ -191,6 +222,8 @@ type StepExecution struct {
 	StartedAt   time.Time       `json:"started_at"`
 	CompletedAt *time.Time      `json:"completed_at"`
 	Attempt     int             `json:"attempt" gorm:"default:1"`
+	CacheKey    string          `json:"cache_key,omitempty" gorm:"index"`
+	Cached      bool            `json:"cached" gorm:"default:false"` // output reused from an earlier execution
 }
 
 // TableName returns the table name for the StepExecution model
@@ -198,6 +231,136 @@ func (StepExecution) TableName() string {
 	return "step_executions"
 }
 
+// Keys used when a StepResult is serialized into StepExecution.Output
+const (
+	OutputKeyExitCode     = "exit_code"
+	OutputKeyStdout       = "stdout"
+	OutputKeyStderr       = "stderr"
+	OutputKeyDurationMs   = "duration_ms"
+	OutputKeyHTTPStatus   = "http_status"
+	OutputKeyResponseBody = "response_body"
+)
+
+// StepResult represents the typed output of a step execution
+type StepResult struct {
+	ExitCode     int           `json:"exit_code"`
+	Stdout       string        `json:"stdout"`
+	Stderr       string        `json:"stderr"`
+	Duration     time.Duration `json:"duration_ms"`
+	HTTPStatus   int           `json:"http_status"`
+	ResponseBody string        `json:"response_body"`
+}
+
+// ToOutput serializes the result into a JSONMap with a stable schema
+func (r *StepResult) ToOutput() JSONMap {
+	return JSONMap{
+		OutputKeyExitCode:     r.ExitCode,
+		OutputKeyStdout:       r.Stdout,
+		OutputKeyStderr:       r.Stderr,
+		OutputKeyDurationMs:   r.Duration.Milliseconds(),
+		OutputKeyHTTPStatus:   r.HTTPStatus,
+		OutputKeyResponseBody: r.ResponseBody,
+	}
+}
+
+// MarshalJSON encodes the result in the ToOutput schema, so a result reads the
+// same whether it is marshalled directly or stored as step output
+func (r StepResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.ToOutput())
+}
+
+// UnmarshalJSON decodes a result encoded in the ToOutput schema
+func (r *StepResult) UnmarshalJSON(data []byte) error {
+	var output JSONMap
+	if err := json.Unmarshal(data, &output); err != nil {
+		return err
+	}
+	result, err := StepResultFromOutput(output)
+	if err != nil {
+		return err
+	}
+	*r = *result
+	return nil
+}
+
+// StepResultFromOutput reads a StepResult back from a step output map
+func StepResultFromOutput(output JSONMap) (*StepResult, error) {
+	if output == nil {
+		return nil, errors.New("step output is empty")
+	}
+
+	exitCode, err := outputInt(output, OutputKeyExitCode)
+	if err != nil {
+		return nil, err
+	}
+	durationMs, err := outputInt(output, OutputKeyDurationMs)
+	if err != nil {
+		return nil, err
+	}
+	httpStatus, err := outputInt(output, OutputKeyHTTPStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StepResult{
+		ExitCode:   int(exitCode),
+		Duration:   time.Duration(durationMs) * time.Millisecond,
+		HTTPStatus: int(httpStatus),
+	}
+	if result.Stdout, err = outputString(output, OutputKeyStdout); err != nil {
+		return nil, err
+	}
+	if result.Stderr, err = outputString(output, OutputKeyStderr); err != nil {
+		return nil, err
+	}
+	if result.ResponseBody, err = outputString(output, OutputKeyResponseBody); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SetResult stores a typed result in the step execution output
+func (s *StepExecution) SetResult(result *StepResult) {
+	s.Output = result.ToOutput()
+}
+
+// Result returns the typed result stored in the step execution output
+func (s *StepExecution) Result() (*StepResult, error) {
+	return StepResultFromOutput(s.Output)
+}
+
+// outputInt reads an integer value from a step output map.
+// Values decoded from the database arrive as float64.
+func outputInt(output JSONMap, key string) (int64, error) {
+	switch v := output[key].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case json.Number:
+		return v.Int64()
+	default:
+		return 0, fmt.Errorf("step output field '%s' is not a number", key)
+	}
+}
+
+// outputString reads a string value from a step output map
+func outputString(output JSONMap, key string) (string, error) {
+	switch v := output[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("step output field '%s' is not a string", key)
+	}
+}
+
 // WorkflowTemplate represents a reusable workflow template
 type WorkflowTemplate struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
@@ -215,3 +378,27 @@ type WorkflowTemplate struct {
 func (WorkflowTemplate) TableName() string {
 	return "workflow_templates"
 }
+
+// ArtifactSpec declares a file produced by a step that is persisted after it succeeds
+type ArtifactSpec struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Artifact represents a persisted output of a step execution
+type Artifact struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	ExecutionID     uint      `json:"execution_id" gorm:"index;not null"`
+	StepExecutionID uint      `json:"step_execution_id" gorm:"index;not null"`
+	UserID          string    `json:"user_id" gorm:"index"`
+	Name            string    `json:"name" gorm:"not null"`
+	Key             string    `json:"key" gorm:"not null"`
+	Size            int64     `json:"size"`
+	Checksum        string    `json:"checksum"` // hex-encoded SHA-256
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the Artifact model
+func (Artifact) TableName() string {
+	return "artifacts"
+}
@@ -0,0 +1,117 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// placeholderPattern matches ${...} placeholders in step configs
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// substitutionPattern matches template actions and ${...} placeholders, so a
+// config string can be scanned for both in one pass
+var substitutionPattern = regexp.MustCompile(`(?s)\{\{.*?\}\}|\$\{[^}]*\}`)
+
+// expandPlaceholders substitutes the ${...} placeholders in text:
+//
+//	${var.name}                   the execution's input, else the workflow's variable
+//	${input.name}                 the execution's input
+//	${steps.build.output.stdout}  an output of a prior step
+//
+// Placeholders that cannot be resolved are left as they are and appended to
+// missing, once each.
+func (c *ExecutionContext) expandPlaceholders(text string, missing *[]string) string {
+	if !strings.Contains(text, "${") {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		return c.expandPlaceholder(placeholder, missing)
+	})
+}
+
+// resolveString interpolates the templates and ${...} placeholders in text
+// together. Placeholders outside template actions become calls of the
+// template's placeholder function, so neither syntax is applied to what the
+// other substituted.
+func (c *ExecutionContext) resolveString(text string, missing *[]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return c.expandPlaceholders(text, missing), nil
+	}
+	source := substitutionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if strings.HasPrefix(match, "{{") {
+			return match
+		}
+		return "{{ placeholder " + strconv.Quote(match) + " }}"
+	})
+	return c.render(source, template.FuncMap{
+		"placeholder": func(placeholder string) string { return c.expandPlaceholder(placeholder, missing) },
+	})
+}
+
+// expandPlaceholder returns the value of a single ${...} placeholder, or the
+// placeholder itself, recorded in missing, when it cannot be resolved
+func (c *ExecutionContext) expandPlaceholder(placeholder string, missing *[]string) string {
+	value, ok := c.lookupPlaceholder(strings.TrimSpace(placeholder[2 : len(placeholder)-1]))
+	if !ok {
+		for _, m := range *missing {
+			if m == placeholder {
+				return placeholder
+			}
+		}
+		*missing = append(*missing, placeholder)
+		return placeholder
+	}
+	return placeholderString(value)
+}
+
+// lookupPlaceholder resolves a placeholder's path, e.g. "input.branch"
+func (c *ExecutionContext) lookupPlaceholder(path string) (interface{}, bool) {
+	scope, name, _ := strings.Cut(path, ".")
+	if name == "" {
+		return nil, false
+	}
+
+	switch scope {
+	case "var":
+		// Input takes precedence, so an execution can override a variable
+		if value, ok := c.Input[name]; ok {
+			return value, true
+		}
+		value, ok := c.Vars[name]
+		return value, ok
+	case "input":
+		value, ok := c.Input[name]
+		return value, ok
+	case "steps":
+		stepName, rest, _ := strings.Cut(name, ".")
+		key, ok := strings.CutPrefix(rest, "output.")
+		if !ok || key == "" {
+			return nil, false
+		}
+		state, ok := c.Steps[stepName]
+		if !ok {
+			return nil, false
+		}
+		value, ok := state.Output[key]
+		return value, ok
+	default:
+		return nil, false
+	}
+}
+
+// placeholderString formats a substituted value: strings as they are and
+// anything else as JSON, e.g. 3 or ["a","b"]
+func placeholderString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,81 @@
+package flow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceholders(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, deployConfig JSONMap) (*Service, *scriptedRunner, *WorkflowExecution, []WorkflowStep) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		runner := &scriptedRunner{fail: make(map[string]bool), configs: make(map[string]JSONMap)}
+		service.SetStepRunner(runner)
+
+		workflow := &Workflow{
+			Name:      "Release",
+			UserID:    "user1",
+			Variables: JSONMap{"region": "eu-west-1", "tag": "latest"},
+			Steps: []WorkflowStep{
+				{Name: "build", Type: StepTypeCommand, Config: JSONMap{"command": "make"}, Order: 1},
+				{Name: "deploy", Type: StepTypeCommand, Config: deployConfig, Order: 2},
+			},
+		}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, map[string]interface{}{"tag": "v1.2", "replicas": 3})
+		require.NoError(t, err)
+		return service, runner, execution, workflow.Steps
+	}
+
+	t.Run("should substitute variables, input and step outputs", func(t *testing.T) {
+		service, runner, execution, steps := setup(t, JSONMap{
+			"command": "deploy --region ${var.region} --tag ${var.tag} --replicas ${input.replicas} --after '${steps.build.output.stdout}'",
+			"env":     []interface{}{"TAG=${input.tag}"},
+		})
+
+		_, err := service.RunStep(ctx, execution, &steps[0], execution.Input)
+		require.NoError(t, err)
+		deploy, err := service.RunStep(ctx, execution, &steps[1], execution.Input)
+		require.NoError(t, err)
+
+		assert.Equal(t, ExecutionStatusCompleted, deploy.Status)
+		// Input takes precedence over the workflow's variable of the same name
+		assert.Equal(t, "deploy --region eu-west-1 --tag v1.2 --replicas 3 --after 'build ok'", runner.configs["deploy"]["command"])
+		assert.Equal(t, []interface{}{"TAG=v1.2"}, runner.configs["deploy"]["env"])
+	})
+
+	t.Run("should resolve templates and placeholders in one pass", func(t *testing.T) {
+		service, runner, execution, steps := setup(t, JSONMap{
+			"command": "deploy {{ .input.note }} ${input.template} --region ${var.region}{{ if .input.replicas }} --scale{{ end }}",
+		})
+		execution.Input["note"] = "${var.region}"
+		execution.Input["template"] = "{{ .var.tag }}"
+
+		deploy, err := service.RunStep(ctx, execution, &steps[1], execution.Input)
+		require.NoError(t, err)
+
+		assert.Equal(t, ExecutionStatusCompleted, deploy.Status)
+		// Substituted values are not themselves interpolated again
+		assert.Equal(t, "deploy ${var.region} {{ .var.tag }} --region eu-west-1 --scale", runner.configs["deploy"]["command"])
+	})
+
+	t.Run("should fail the step listing unresolved placeholders", func(t *testing.T) {
+		service, runner, execution, steps := setup(t, JSONMap{
+			"command": "deploy ${var.zone} ${input.branch} ${var.zone} ${steps.test.output.stdout}",
+		})
+
+		deploy, err := service.RunStep(ctx, execution, &steps[1], execution.Input)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unresolved placeholders: ${var.zone}, ${input.branch}, ${steps.test.output.stdout}")
+
+		require.NotNil(t, deploy)
+		assert.Equal(t, ExecutionStatusFailed, deploy.Status)
+		assert.Contains(t, deploy.Error, "${var.zone}")
+		assert.NotContains(t, runner.configs, "deploy")
+	})
+}
@@ -0,0 +1,158 @@
+package flow
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultPriorityAging is how long a queued execution waits for its priority
+// to rise by one
+const DefaultPriorityAging = time.Minute
+
+// SetMaxConcurrentExecutions limits how many executions run in the background
+// at once. Executions started beyond the limit are queued as Pending and
+// admitted by priority as running ones finish. Zero, the default, runs every
+// execution as soon as it is started.
+func (s *Service) SetMaxConcurrentExecutions(limit int) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	s.maxRuns = limit
+	s.admitQueued()
+}
+
+// SetPriorityAging sets how long a queued execution waits for its priority to
+// rise by one, so low-priority executions are not starved by a steady stream
+// of higher-priority ones
+func (s *Service) SetPriorityAging(interval time.Duration) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	s.aging = interval
+}
+
+// queuedExecution is an execution waiting for a run slot
+type queuedExecution struct {
+	workflow  *Workflow
+	execution *WorkflowExecution
+	queuedAt  time.Time
+}
+
+// effectivePriority is the execution's priority raised by one for every aging
+// interval it has waited
+func (q queuedExecution) effectivePriority(now time.Time, aging time.Duration) int {
+	priority := q.execution.Priority
+	if aging > 0 {
+		priority += int(now.Sub(q.queuedAt) / aging)
+	}
+	return priority
+}
+
+// executionQueue holds the executions waiting for a run slot. The one with
+// the highest effective priority is admitted first, and executions of equal
+// priority are admitted in the order they were queued.
+type executionQueue struct {
+	items []queuedExecution
+}
+
+func (q *executionQueue) push(item queuedExecution) {
+	q.items = append(q.items, item)
+}
+
+// pop removes and returns the next execution to admit
+func (q *executionQueue) pop(now time.Time, aging time.Duration) (queuedExecution, bool) {
+	if len(q.items) == 0 {
+		return queuedExecution{}, false
+	}
+	next := 0
+	for i := 1; i < len(q.items); i++ {
+		if q.items[i].effectivePriority(now, aging) > q.items[next].effectivePriority(now, aging) {
+			next = i
+		}
+	}
+	item := q.items[next]
+	q.items = append(q.items[:next], q.items[next+1:]...)
+	return item, true
+}
+
+// remove drops a queued execution, if any
+func (q *executionQueue) remove(executionID uint) {
+	for i, item := range q.items {
+		if item.execution.ID == executionID {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// drain removes and returns every queued execution
+func (q *executionQueue) drain() []queuedExecution {
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// queueExecution records an execution as Pending and queues it. It must be
+// called with runMu held.
+func (s *Service) queueExecution(workflow *Workflow, execution *WorkflowExecution) {
+	err := s.db.Model(&WorkflowExecution{}).
+		Where("id = ? AND status = ?", execution.ID, ExecutionStatusRunning).
+		Update("status", ExecutionStatusPending).Error
+	if err != nil {
+		// Run it rather than leave it recorded as running while it waits
+		s.launchExecution(workflow, execution, false)
+		return
+	}
+	execution.Status = ExecutionStatusPending
+
+	// The caller keeps the execution it was given, so queue a copy
+	queued := *execution
+	s.queue.push(queuedExecution{workflow: workflow, execution: &queued, queuedAt: time.Now()})
+}
+
+// admitQueued starts queued executions while there are free run slots. It
+// must be called with runMu held.
+func (s *Service) admitQueued() {
+	for s.runCtx != nil && s.runCtx.Err() == nil && (s.maxRuns <= 0 || len(s.running) < s.maxRuns) {
+		item, ok := s.queue.pop(time.Now(), s.aging)
+		if !ok {
+			return
+		}
+		s.launchExecution(item.workflow, item.execution, true)
+	}
+}
+
+// admitExecution marks a queued execution as Running, reporting false if it
+// was cancelled while it waited
+func (s *Service) admitExecution(ctx context.Context, execution *WorkflowExecution) bool {
+	result := s.db.WithContext(ctx).Model(&WorkflowExecution{}).
+		Where("id = ? AND status = ?", execution.ID, ExecutionStatusPending).
+		Update("status", ExecutionStatusRunning)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	execution.Status = ExecutionStatusRunning
+	return true
+}
+
+// failQueued records executions that never left the queue as failed
+func (s *Service) failQueued(items []queuedExecution) {
+	if len(items) == 0 {
+		return
+	}
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.execution.ID
+		s.environments.Delete(item.execution.ID)
+	}
+	now := time.Now()
+	err := s.db.Model(&WorkflowExecution{}).
+		Where("id IN ? AND status = ?", ids, ExecutionStatusPending).
+		Updates(map[string]interface{}{
+			"status":       ExecutionStatusFailed,
+			"error":        "execution was interrupted before it started",
+			"completed_at": &now,
+		}).Error
+	if err != nil {
+		log.Printf("⚠️  Failed to record the outcome of %d queued executions: %v", len(ids), err)
+	}
+}
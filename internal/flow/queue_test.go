@@ -0,0 +1,154 @@
+package flow
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedRunner records which execution each step ran for, by its "run" input,
+// and blocks every step until release is closed
+type gatedRunner struct {
+	mu      sync.Mutex
+	started []string
+	release chan struct{}
+}
+
+func (r *gatedRunner) RunStep(ctx context.Context, step *WorkflowStep, input JSONMap) (*StepResult, error) {
+	r.mu.Lock()
+	r.started = append(r.started, input["run"].(string))
+	r.mu.Unlock()
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &StepResult{}, nil
+}
+
+func (r *gatedRunner) runs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.started...)
+}
+
+func TestExecutionPriority(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*Service, *gatedRunner, *Workflow) {
+		service := setupExecutor(t)
+		runner := &gatedRunner{release: make(chan struct{})}
+		service.SetStepRunner(runner)
+		service.SetMaxConcurrentExecutions(1)
+
+		workflow := &Workflow{Name: "Deploy", UserID: "user1", Steps: []WorkflowStep{
+			{Name: "deploy", Type: StepTypeCommand, Order: 1, Config: JSONMap{"command": "true"}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		return service, runner, workflow
+	}
+
+	execute := func(t *testing.T, service *Service, workflow *Workflow, run string, priority int) *WorkflowExecution {
+		execution, err := service.ExecuteWorkflowWithPriority(ctx, "user1", workflow.ID, map[string]interface{}{"run": run}, priority)
+		require.NoError(t, err)
+		return execution
+	}
+
+	t.Run("should admit higher-priority executions first", func(t *testing.T) {
+		service, runner, workflow := setup(t)
+
+		first := execute(t, service, workflow, "first", 0)
+		require.Eventually(t, func() bool { return len(runner.runs()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		low := execute(t, service, workflow, "low", 0)
+		routine := execute(t, service, workflow, "routine", 1)
+		critical := execute(t, service, workflow, "critical", 10)
+		assert.Equal(t, ExecutionStatusRunning, first.Status)
+		assert.Equal(t, ExecutionStatusPending, low.Status)
+		status, err := service.GetExecutionStatus(ctx, "user1", critical.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusPending, status.Status)
+		assert.Equal(t, 10, status.Priority)
+
+		close(runner.release)
+		for _, execution := range []*WorkflowExecution{first, low, routine, critical} {
+			assert.Equal(t, ExecutionStatusCompleted, waitForExecution(t, service, execution.ID).Status)
+		}
+		assert.Equal(t, []string{"first", "critical", "routine", "low"}, runner.runs())
+	})
+
+	t.Run("should not run an execution cancelled while queued", func(t *testing.T) {
+		service, runner, workflow := setup(t)
+
+		first := execute(t, service, workflow, "first", 0)
+		queued := execute(t, service, workflow, "queued", 0)
+		require.NoError(t, service.CancelExecution(ctx, "user1", queued.ID))
+
+		close(runner.release)
+		assert.Equal(t, ExecutionStatusCompleted, waitForExecution(t, service, first.ID).Status)
+		assert.Equal(t, ExecutionStatusCancelled, waitForExecution(t, service, queued.ID).Status)
+		assert.Equal(t, []string{"first"}, runner.runs())
+	})
+
+	t.Run("should fail executions still queued when closed", func(t *testing.T) {
+		service, runner, workflow := setup(t)
+
+		execute(t, service, workflow, "first", 0)
+		queued := execute(t, service, workflow, "queued", 0)
+		require.Eventually(t, func() bool { return len(runner.runs()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		require.NoError(t, service.Close(ctx))
+
+		status := waitForExecution(t, service, queued.ID)
+		assert.Equal(t, ExecutionStatusFailed, status.Status)
+		assert.Contains(t, status.Error, "interrupted before it started")
+		assert.Equal(t, []string{"first"}, runner.runs())
+	})
+}
+
+func TestExecutionQueue(t *testing.T) {
+	queuedAt := time.Now()
+	item := func(id uint, priority int, waited time.Duration) queuedExecution {
+		return queuedExecution{execution: &WorkflowExecution{ID: id, Priority: priority}, queuedAt: queuedAt.Add(-waited)}
+	}
+	order := func(q *executionQueue, aging time.Duration) []uint {
+		var ids []uint
+		for {
+			next, ok := q.pop(queuedAt, aging)
+			if !ok {
+				return ids
+			}
+			ids = append(ids, next.execution.ID)
+		}
+	}
+
+	t.Run("should admit by priority, then in queue order", func(t *testing.T) {
+		q := &executionQueue{}
+		q.push(item(1, 0, 0))
+		q.push(item(2, 5, 0))
+		q.push(item(3, 0, 0))
+		q.push(item(4, 5, 0))
+		assert.Equal(t, []uint{2, 4, 1, 3}, order(q, time.Minute))
+	})
+
+	t.Run("should eventually admit a low-priority execution", func(t *testing.T) {
+		q := &executionQueue{}
+		// Waiting ten minutes raises the low-priority execution above a fresh priority 5
+		q.push(item(1, 0, 10*time.Minute))
+		q.push(item(2, 5, 0))
+		q.push(item(3, 20, 0))
+		assert.Equal(t, []uint{3, 1, 2}, order(q, time.Minute))
+	})
+
+	t.Run("should remove a queued execution", func(t *testing.T) {
+		q := &executionQueue{}
+		q.push(item(1, 0, 0))
+		q.push(item(2, 0, 0))
+		q.remove(1)
+		q.remove(9)
+		assert.Equal(t, []uint{2}, order(q, time.Minute))
+	})
+}
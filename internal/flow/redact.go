@@ -0,0 +1,104 @@
+package flow
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values in stored step output and errors
+const RedactedValue = "***"
+
+// redactor masks the secret values injected into an execution, and anything
+// matching the service's redaction patterns, in what its steps record
+type redactor struct {
+	values   []string
+	patterns []*regexp.Regexp
+}
+
+// SetRedactionPatterns sets patterns whose matches are masked in every step's
+// recorded output and error, in addition to the execution's secret values
+func (s *Service) SetRedactionPatterns(patterns []*regexp.Regexp) {
+	s.redactPatterns = patterns
+}
+
+// newRedactor returns a redactor masking the given secret values and the
+// service's redaction patterns
+func (s *Service) newRedactor(secrets []string) *redactor {
+	values := make([]string, 0, len(secrets))
+	for _, value := range secrets {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	// Longer values first, so a secret containing another is masked whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return &redactor{values: values, patterns: s.redactPatterns}
+}
+
+// text masks the sensitive values in s
+func (r *redactor) text(s string) string {
+	for _, value := range r.values {
+		s = strings.ReplaceAll(s, value, RedactedValue)
+	}
+	for _, pattern := range r.patterns {
+		s = pattern.ReplaceAllLiteralString(s, RedactedValue)
+	}
+	return s
+}
+
+// value masks the sensitive values in every string within v
+func (r *redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.text(v)
+	case JSONMap:
+		return r.output(v)
+	case map[string]interface{}:
+		return map[string]interface{}(r.output(v))
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.value(item)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+// output returns a copy of a step output with its sensitive values masked
+func (r *redactor) output(output JSONMap) JSONMap {
+	if output == nil {
+		return nil
+	}
+	redacted := make(JSONMap, len(output))
+	for key, value := range output {
+		redacted[key] = r.value(value)
+	}
+	return redacted
+}
+
+// step masks the sensitive values in a step execution's output and error
+func (r *redactor) step(stepExecution *StepExecution) {
+	stepExecution.Output = r.output(stepExecution.Output)
+	stepExecution.Error = r.text(stepExecution.Error)
+}
+
+// redactedError is an error whose message has been redacted. It still
+// unwraps to the original, so callers can match it with errors.Is.
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string { return e.message }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// error masks the sensitive values in err's message
+func (r *redactor) error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{message: r.text(err.Error()), err: err}
+}
@@ -0,0 +1,103 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepOutputRedaction(t *testing.T) {
+	ctx := context.Background()
+	service := setupExecutor(t)
+	service.SetRetryDelay(time.Millisecond)
+	service.SetRedactionPatterns([]*regexp.Regexp{regexp.MustCompile(`token=\w+`)})
+	service.SetSecretStore(&countingSecretStore{secrets: map[string]map[string]string{
+		"user1": {"prod/db-password": "hunter2"},
+	}})
+	require.NoError(t, service.CreateEnvironment(ctx, &Environment{
+		UserID:  "user1",
+		Name:    "production",
+		Secrets: map[string]string{"DB_PASSWORD": "prod/db-password"},
+	}))
+
+	workflow := &Workflow{Name: "Deploy", UserID: "user1", Environment: "production", Steps: []WorkflowStep{
+		{Name: "migrate", Type: StepTypeCommand, Order: 1, Retries: 1, Config: JSONMap{
+			"command": "echo connecting with $PGPASSWORD; echo token=abc123 >&2; echo failed for {{ .env.DB_PASSWORD }} >&2; exit 1",
+			"env":     map[string]interface{}{"PGPASSWORD": "{{ .env.DB_PASSWORD }}"},
+		}},
+	}}
+	require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+	execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+	require.NoError(t, err)
+	execution = waitForExecution(t, service, execution.ID)
+	require.Equal(t, ExecutionStatusFailed, execution.Status)
+	require.Len(t, execution.Steps, 1)
+
+	t.Run("should mask injected secrets and configured patterns in step output", func(t *testing.T) {
+		step := execution.Steps[0]
+		assert.Equal(t, 2, step.Attempt)
+		result, err := step.Result()
+		require.NoError(t, err)
+		assert.Equal(t, "connecting with ***\n", result.Stdout)
+		assert.Equal(t, "***\nfailed for ***\n", result.Stderr)
+	})
+
+	t.Run("should never persist an injected secret", func(t *testing.T) {
+		var stored []StepExecution
+		require.NoError(t, service.db.Where("execution_id = ?", execution.ID).Find(&stored).Error)
+		require.NotEmpty(t, stored)
+		for _, step := range stored {
+			data, err := json.Marshal(step)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "hunter2")
+			assert.NotContains(t, string(data), "abc123")
+		}
+
+		data, err := json.Marshal(execution)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "hunter2")
+	})
+
+	t.Run("should mask secrets in step errors", func(t *testing.T) {
+		failing := &Workflow{Name: "Broken", UserID: "user1", Environment: "production", Steps: []WorkflowStep{
+			{Name: "call", Type: StepTypeHTTP, Order: 1, Config: JSONMap{"method": "get", "url": "http://127.0.0.1:1/?password={{ .env.DB_PASSWORD }}"}},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, failing))
+
+		execution, err := service.ExecuteWorkflow(ctx, "user1", failing.ID, nil)
+		require.NoError(t, err)
+		execution = waitForExecution(t, service, execution.ID)
+		require.Len(t, execution.Steps, 1)
+		assert.Contains(t, execution.Steps[0].Error, "password=***")
+		assert.NotContains(t, execution.Steps[0].Error, "hunter2")
+		assert.NotContains(t, execution.Error, "hunter2")
+	})
+}
+
+func TestRedactor(t *testing.T) {
+	service := NewService()
+	redactor := service.newRedactor([]string{"", "abc", "abcdef"})
+
+	t.Run("should mask longer secrets whole", func(t *testing.T) {
+		assert.Equal(t, "*** and ***", redactor.text("abcdef and abc"))
+		assert.Equal(t, "nothing here", redactor.text("nothing here"))
+	})
+
+	t.Run("should mask nested output values", func(t *testing.T) {
+		output := JSONMap{
+			"body":  map[string]interface{}{"items": []interface{}{"abc", 42}},
+			"count": 3,
+		}
+		assert.Equal(t, JSONMap{
+			"body":  map[string]interface{}{"items": []interface{}{"***", 42}},
+			"count": 3,
+		}, redactor.output(output))
+		assert.Equal(t, "abc", output["body"].(map[string]interface{})["items"].([]interface{})[0], "the original output must not be changed")
+	})
+}
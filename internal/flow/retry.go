@@ -0,0 +1,111 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+const (
+	// DefaultRetryDelay is the backoff before a failed step's first retry
+	DefaultRetryDelay = time.Second
+	// MaxRetryDelay caps the backoff between retries of a step
+	MaxRetryDelay = 30 * time.Second
+)
+
+// SetRetryDelay sets the backoff before a failed step's first retry. The
+// backoff doubles for each later retry, up to MaxRetryDelay.
+func (s *Service) SetRetryDelay(delay time.Duration) {
+	s.retryDelay = delay
+}
+
+// stepRetryable reports whether a failed step may be run again. Service steps
+// are not retried since a failed call may still have changed state.
+func stepRetryable(step *WorkflowStep) bool {
+	return step.Type == StepTypeCommand || step.Type == StepTypeHTTP
+}
+
+// retryPolicy returns how a step's attempts are retried: up to its Retries
+// times if it is retryable, with a backoff starting at the retry delay and
+// doubling up to MaxRetryDelay
+func (s *Service) retryPolicy(step *WorkflowStep) core.RetryPolicy {
+	attempts := 1
+	if stepRetryable(step) {
+		attempts += step.Retries
+	}
+	return core.RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   s.retryDelay,
+		Multiplier:  2,
+		MaxDelay:    MaxRetryDelay,
+	}
+}
+
+// runStepAttempts runs a step, bounding each attempt by the step's Timeout and
+// retrying it following retryPolicy. After each failed attempt the
+// StepExecution is saved with that attempt's output, and its Attempt is
+// incremented before the next one, so the number of tries is visible while the
+// step is still running. The caller records the final error. Retrying stops
+// early when ctx is done. Recorded attempts are masked by redactor.
+func (s *Service) runStepAttempts(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, input JSONMap, stepExecution *StepExecution, redactor *redactor) (*StepResult, error) {
+	var (
+		result  *StepResult
+		stepErr error
+		// backoff is set while core.Retry waits to run the step again, so
+		// it is still set if ctx is done during the wait
+		backoff bool
+	)
+	policy := s.retryPolicy(step)
+	policy.Retryable = func(error) bool { return backoff }
+
+	err := core.Retry(ctx, policy, func(attempt int) error {
+		backoff = false
+		if attempt > 1 {
+			stepExecution.Attempt++
+			if err := s.db.WithContext(ctx).Model(stepExecution).Update("attempt", stepExecution.Attempt).Error; err != nil {
+				result = nil
+				return fmt.Errorf("failed to record attempt %d: %w", stepExecution.Attempt, err)
+			}
+		}
+
+		result, stepErr = s.runStepAttempt(ctx, execution, step, input)
+		if stepErr == nil || attempt == policy.MaxAttempts || ctx.Err() != nil {
+			return stepErr
+		}
+
+		if result != nil {
+			stepExecution.SetResult(result)
+			if core.ValidateJSONSize("step output", stepExecution.Output) != nil {
+				stepExecution.Output = make(JSONMap)
+			}
+			redactor.step(stepExecution)
+		}
+		if saveErr := s.db.WithContext(ctx).Save(stepExecution).Error; saveErr != nil {
+			return fmt.Errorf("%w (failed to record attempt %d: %v)", stepErr, stepExecution.Attempt, saveErr)
+		}
+		backoff = true
+		return stepErr
+	})
+	if backoff {
+		return result, fmt.Errorf("%w (retry cancelled after attempt %d)", stepErr, stepExecution.Attempt)
+	}
+	return result, err
+}
+
+// runStepAttempt runs a step once, bounded by its Timeout
+func (s *Service) runStepAttempt(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, input JSONMap) (*StepResult, error) {
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(step.Timeout)*time.Second)
+		defer cancel()
+	}
+	switch step.Type {
+	case StepTypeService:
+		return s.runServiceStep(ctx, execution, step)
+	case StepTypeCondition:
+		return s.runConditionStep(ctx, execution, step)
+	}
+	return s.stepRunner.RunStep(ctx, step, input)
+}
@@ -0,0 +1,132 @@
+package flow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCommand fails until it has been run succeedOn times, counting runs in dir
+func countingCommand(dir string, succeedOn int) JSONMap {
+	return JSONMap{
+		"dir":     dir,
+		"command": "n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; echo attempt $n >&2; [ $n -ge " + strconv.Itoa(succeedOn) + " ]",
+	}
+}
+
+func runCount(t *testing.T, dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "count"))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestStepRetries(t *testing.T) {
+	ctx := context.Background()
+
+	run := func(t *testing.T, service *Service, step WorkflowStep) *WorkflowExecution {
+		workflow := &Workflow{Name: "Flaky", UserID: "user1", Steps: []WorkflowStep{step}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+		return waitForExecution(t, service, execution.ID)
+	}
+
+	t.Run("should retry a failed step until it succeeds", func(t *testing.T) {
+		service := setupExecutor(t)
+		service.SetRetryDelay(time.Millisecond)
+		dir := t.TempDir()
+
+		execution := run(t, service, WorkflowStep{Name: "flaky", Type: StepTypeCommand, Order: 1, Retries: 3, Config: countingCommand(dir, 3)})
+
+		assert.Equal(t, ExecutionStatusCompleted, execution.Status, execution.Error)
+		require.Len(t, execution.Steps, 1)
+		assert.Equal(t, 3, execution.Steps[0].Attempt)
+		assert.Empty(t, execution.Steps[0].Error)
+		assert.Equal(t, "3\n", runCount(t, dir))
+	})
+
+	t.Run("should record the last error once retries are exhausted", func(t *testing.T) {
+		service := setupExecutor(t)
+		service.SetRetryDelay(time.Millisecond)
+		dir := t.TempDir()
+
+		execution := run(t, service, WorkflowStep{Name: "broken", Type: StepTypeCommand, Order: 1, Retries: 2, Config: countingCommand(dir, 9)})
+
+		assert.Equal(t, ExecutionStatusFailed, execution.Status)
+		require.Len(t, execution.Steps, 1)
+		assert.Equal(t, 3, execution.Steps[0].Attempt)
+		assert.Contains(t, execution.Steps[0].Error, "exit status 1")
+		result, err := execution.Steps[0].Result()
+		require.NoError(t, err)
+		assert.Equal(t, "attempt 3\n", result.Stderr)
+		assert.Equal(t, "3\n", runCount(t, dir))
+	})
+
+	t.Run("should not retry a step without retries", func(t *testing.T) {
+		service := setupExecutor(t)
+		service.SetRetryDelay(time.Millisecond)
+		dir := t.TempDir()
+
+		execution := run(t, service, WorkflowStep{Name: "once", Type: StepTypeCommand, Order: 1, Config: countingCommand(dir, 2)})
+
+		assert.Equal(t, ExecutionStatusFailed, execution.Status)
+		require.Len(t, execution.Steps, 1)
+		assert.Equal(t, 1, execution.Steps[0].Attempt)
+		assert.Equal(t, "1\n", runCount(t, dir))
+	})
+
+	t.Run("should stop retrying when cancelled during the backoff", func(t *testing.T) {
+		service := setupExecutor(t)
+		service.SetRetryDelay(time.Minute)
+		dir := t.TempDir()
+		workflow := &Workflow{Name: "Flaky", UserID: "user1", Steps: []WorkflowStep{
+			{Name: "flaky", Type: StepTypeCommand, Order: 1, Retries: 3, Config: countingCommand(dir, 3)},
+		}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, nil)
+		require.NoError(t, err)
+
+		// The first attempt's output is saved before the backoff starts
+		require.Eventually(t, func() bool {
+			status, err := service.GetExecutionStatus(ctx, "user1", execution.ID)
+			require.NoError(t, err)
+			return len(status.Steps) == 1 && status.Steps[0].Output[OutputKeyStderr] == "attempt 1\n"
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, service.CancelExecution(ctx, "user1", execution.ID))
+		closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		require.NoError(t, service.Close(closeCtx))
+
+		status, err := service.GetExecutionStatus(ctx, "user1", execution.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ExecutionStatusCancelled, status.Status)
+		require.Len(t, status.Steps, 1)
+		assert.Equal(t, ExecutionStatusFailed, status.Steps[0].Status)
+		assert.Equal(t, 1, status.Steps[0].Attempt)
+		assert.Contains(t, status.Steps[0].Error, "retry cancelled")
+		assert.Equal(t, "1\n", runCount(t, dir))
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	service := NewService()
+	policy := service.retryPolicy(&WorkflowStep{Type: StepTypeCommand, Retries: 3})
+	assert.Equal(t, 4, policy.MaxAttempts)
+	assert.Equal(t, DefaultRetryDelay, policy.Delay(1))
+	assert.Equal(t, 2*DefaultRetryDelay, policy.Delay(2))
+	assert.Equal(t, 8*DefaultRetryDelay, policy.Delay(4))
+	assert.Equal(t, MaxRetryDelay, policy.Delay(10))
+	assert.Equal(t, MaxRetryDelay, policy.Delay(1000))
+
+	assert.Equal(t, 1, service.retryPolicy(&WorkflowStep{Type: StepTypeService, Retries: 3}).MaxAttempts, "service steps are not retried")
+
+	service.SetRetryDelay(time.Minute)
+	assert.Equal(t, MaxRetryDelay, service.retryPolicy(&WorkflowStep{Type: StepTypeHTTP}).Delay(1))
+}
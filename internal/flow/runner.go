@@ -0,0 +1,165 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxHTTPResponseBytes caps how much of an HTTP step's response body is kept
+const MaxHTTPResponseBytes = 1 << 20
+
+// commandWaitDelay is how long a cancelled command's output is still read
+const commandWaitDelay = time.Second
+
+// ExecRunner runs command steps with os/exec and HTTP steps with net/http on
+// the local host. It is the StepRunner used when Vertex executes workflows
+// itself.
+type ExecRunner struct {
+	// Client sends HTTP steps; http.DefaultClient is used when it is nil
+	Client *http.Client
+}
+
+// NewExecRunner creates a runner for command and HTTP steps
+func NewExecRunner() *ExecRunner {
+	return &ExecRunner{}
+}
+
+// RunStep runs a command or HTTP step. Command steps run config "command"
+// with sh -c, with the variables in config "env" added to the environment and
+// in config "dir" if set. HTTP steps send config "method" (GET by default) to
+// config "url" with config "headers" and config "body", encoding a non-string
+// body as JSON; a response status of 400 or above fails the step.
+func (r *ExecRunner) RunStep(ctx context.Context, step *WorkflowStep, input JSONMap) (*StepResult, error) {
+	var (
+		result *StepResult
+		err    error
+	)
+	switch step.Type {
+	case StepTypeCommand:
+		result, err = r.runCommand(ctx, step.Config)
+	case StepTypeHTTP:
+		result, err = r.runHTTP(ctx, step.Config)
+	default:
+		return nil, fmt.Errorf("unsupported step type '%s'", step.Type)
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out: %w", ctx.Err())
+	}
+	return result, err
+}
+
+func (r *ExecRunner) runCommand(ctx context.Context, config JSONMap) (*StepResult, error) {
+	command, _ := config["command"].(string)
+	if strings.TrimSpace(command) == "" {
+		return nil, errors.New("command step has no command")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children of the shell can hold its output open after it is killed
+	// at the step's timeout; stop waiting for them shortly after
+	cmd.WaitDelay = commandWaitDelay
+	if dir, _ := config["dir"].(string); dir != "" {
+		cmd.Dir = dir
+	}
+	if env, ok := config["env"].(map[string]interface{}); ok {
+		cmd.Env = os.Environ()
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", name, env[name]))
+		}
+	}
+
+	started := time.Now()
+	err := cmd.Run()
+	result := &StepResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(started),
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	}
+	return result, err
+}
+
+func (r *ExecRunner) runHTTP(ctx context.Context, config JSONMap) (*StepResult, error) {
+	url, _ := config["url"].(string)
+	if strings.TrimSpace(url) == "" {
+		return nil, errors.New("http step has no url")
+	}
+	method := http.MethodGet
+	if value, _ := config["method"].(string); value != "" {
+		method = strings.ToUpper(value)
+	}
+
+	var body io.Reader
+	isJSON := false
+	switch value := config["body"].(type) {
+	case nil:
+	case string:
+		body = strings.NewReader(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode body: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+		isJSON = true
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if isJSON {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if headers, ok := config["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			req.Header.Set(name, fmt.Sprint(value))
+		}
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxHTTPResponseBytes))
+	result := &StepResult{
+		Duration:     time.Since(started),
+		HTTPStatus:   resp.StatusCode,
+		ResponseBody: string(data),
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return result, fmt.Errorf("%s %s returned status %d", method, url, resp.StatusCode)
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package flow
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/ataiva-software/vertex/pkg/s3"
+)
+
+// S3Config configures an S3-compatible artifact store
+type S3Config = s3.Config
+
+// S3ArtifactStore stores artifacts in an S3-compatible bucket using path-style
+// requests signed with AWS Signature Version 4
+type S3ArtifactStore struct {
+	client *s3.Client
+}
+
+// NewS3ArtifactStore creates an S3-compatible artifact store
+func NewS3ArtifactStore(config S3Config) (*S3ArtifactStore, error) {
+	client, err := s3.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3ArtifactStore{client: client}, nil
+}
+
+// Put uploads the artifact. The content is buffered so the payload can be signed.
+func (s *S3ArtifactStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read artifact: %w", err)
+	}
+
+	resp, err := s.client.Do(ctx, http.MethodPut, key, nil, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return 0, s3.Error(resp)
+	}
+	return int64(len(body)), nil
+}
+
+// Get downloads the artifact stored under key
+func (s *S3ArtifactStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.Do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, key)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s3.Error(resp)
+	}
+	return resp.Body, nil
+}
+
+// List returns the objects whose keys start with prefix, following continuation tokens
+func (s *S3ArtifactStore) List(ctx context.Context, prefix string) ([]ArtifactObject, error) {
+	objects := make([]ArtifactObject, 0)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.client.Do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if resp.StatusCode/100 != 2 {
+			err = s3.Error(resp)
+		} else if decodeErr := xml.NewDecoder(resp.Body).Decode(&result); decodeErr != nil {
+			err = fmt.Errorf("failed to decode S3 listing: %w", decodeErr)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, ArtifactObject{Key: object.Key, Size: object.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
@@ -4,20 +4,63 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 )
 
 // Service provides workflow management functionality
 type Service struct {
-	db *gorm.DB
+	db           *gorm.DB
+	cache        *core.Cache[workflowCacheKey, *Workflow]
+	stepRunner   StepRunner
+	stepCacheTTL time.Duration
+	artifacts    ArtifactStore
+	reads        singleflight.Group
+	secrets      SecretStore
+	environments *core.Cache[uint, *resolvedEnvironment] // resolved environments by execution ID
+	services     ServiceCaller
+	scheduler    *core.Scheduler
+
+	// Backoff before a failed step's first retry; see SetRetryDelay
+	retryDelay time.Duration
+
+	// Masked in recorded step output; see SetRedactionPatterns
+	redactPatterns []*regexp.Regexp
+
+	// Executions running in the background once Start is called
+	runMu    sync.Mutex
+	runCtx   context.Context
+	stopRuns context.CancelFunc
+	running  map[uint]context.CancelFunc
+	runs     sync.WaitGroup
+
+	// Executions waiting for a run slot; see SetMaxConcurrentExecutions
+	maxRuns int
+	queue   executionQueue
+	aging   time.Duration
+}
+
+// workflowCacheKey identifies a cached workflow
+type workflowCacheKey struct {
+	userID     string
+	workflowID uint
 }
 
 // NewService creates a new flow service
 func NewService() *Service {
-	return &Service{}
+	return &Service{
+		environments: core.NewCache[uint, *resolvedEnvironment](environmentCacheSize, environmentCacheTTL),
+		running:      make(map[uint]context.CancelFunc),
+		retryDelay:   DefaultRetryDelay,
+		aging:        DefaultPriorityAging,
+	}
 }
 
 // SetDB sets the database connection
@@ -25,6 +68,16 @@ func (s *Service) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+// CheckHealth reports whether the workflow database is reachable
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return database.CheckConnection(ctx, s.db)
+}
+
+// EnableCache caches GetWorkflow reads for up to capacity workflows for ttl each
+func (s *Service) EnableCache(capacity int, ttl time.Duration) {
+	s.cache = core.NewCache[workflowCacheKey, *Workflow](capacity, ttl)
+}
+
 // CreateWorkflow creates a new workflow
 func (s *Service) CreateWorkflow(ctx context.Context, workflow *Workflow) error {
 	if err := s.validateWorkflow(workflow); err != nil {
@@ -51,25 +104,82 @@ func (s *Service) CreateWorkflow(ctx context.Context, workflow *Workflow) error
 		}
 	}
 
-	if err := s.db.Create(workflow).Error; err != nil {
-		return fmt.Errorf("failed to create workflow: %w", err)
-	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		localIDs := takeLocalStepIDs(workflow.Steps)
+		if err := tx.Create(workflow).Error; err != nil {
+			return fmt.Errorf("failed to create workflow: %w", err)
+		}
+		return remapLocalStepIDs(tx, workflow.Steps, localIDs)
+	})
+}
 
+// takeLocalStepIDs clears the IDs of steps about to be inserted and returns
+// them. The step IDs of a workflow being created or replaced are local to it:
+// they only name the steps DependsOn and condition skips refer to, so clients
+// never need to know the IDs the store assigns.
+func takeLocalStepIDs(steps []WorkflowStep) []uint {
+	localIDs := make([]uint, len(steps))
+	for i := range steps {
+		localIDs[i] = steps[i].ID
+		steps[i].ID = 0
+	}
+	return localIDs
+}
+
+// remapLocalStepIDs rewrites the references between inserted steps from their
+// local IDs to the IDs they were inserted with, saving the steps that have any
+func remapLocalStepIDs(tx *gorm.DB, steps []WorkflowStep, localIDs []uint) error {
+	stepIDs := make(map[uint]uint, len(localIDs))
+	for i, localID := range localIDs {
+		if localID != 0 {
+			stepIDs[localID] = steps[i].ID
+		}
+	}
+	for i := range steps {
+		remapped, err := remapStepIDs(&steps[i], stepIDs)
+		if err != nil {
+			return err
+		}
+		if !remapped {
+			continue
+		}
+		if err := tx.Save(&steps[i]).Error; err != nil {
+			return fmt.Errorf("failed to update step dependencies: %w", err)
+		}
+	}
 	return nil
 }
 
 // GetWorkflow retrieves a workflow by ID
 func (s *Service) GetWorkflow(ctx context.Context, userID string, workflowID uint) (*Workflow, error) {
-	var workflow Workflow
-	err := s.db.Preload("Steps").Where("id = ? AND user_id = ?", workflowID, userID).First(&workflow).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("workflow %d not found", workflowID)
+	key := workflowCacheKey{userID: userID, workflowID: workflowID}
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(key); ok {
+			return cached.clone(), nil
+		}
 	}
+
+	// Concurrent misses for the same workflow share one query
+	shared, err, _ := s.reads.Do(fmt.Sprintf("%q %d", userID, workflowID), func() (interface{}, error) {
+		var workflow Workflow
+		err := s.db.Preload("Steps").Where("id = ? AND user_id = ?", workflowID, userID).First(&workflow).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("workflow %d not found", workflowID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve workflow: %w", err)
+		}
+
+		if s.cache != nil {
+			s.cache.Set(key, workflow.clone())
+		}
+		return &workflow, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve workflow: %w", err)
+		return nil, err
 	}
 
-	return &workflow, nil
+	return shared.(*Workflow).clone(), nil
 }
 
 // ListWorkflows returns all workflows for a user
@@ -83,6 +193,22 @@ func (s *Service) ListWorkflows(ctx context.Context, userID string) ([]*Workflow
 	return workflows, nil
 }
 
+// ListWorkflowsPage returns one page of the user's workflows with their steps,
+// reading only that page from the store
+func (s *Service) ListWorkflowsPage(ctx context.Context, userID string, request core.PageRequest) (*core.Page[*Workflow], error) {
+	page, err := database.Paginate[*Workflow](s.db.WithContext(ctx).Model(&Workflow{}).Preload("Steps").Where("user_id = ?", userID).Order("id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workflows: %w", err)
+	}
+	return page, nil
+}
+
+// Count returns how many workflows a user has, optionally broken down by status
+func (s *Service) Count(ctx context.Context, userID string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	query := s.db.WithContext(ctx).Model(&Workflow{}).Where("user_id = ?", userID)
+	return database.CountByStatus[WorkflowStatus](query, core.ResourceTypeWorkflow, filters...)
+}
+
 // UpdateWorkflow updates an existing workflow
 func (s *Service) UpdateWorkflow(ctx context.Context, userID string, workflow *Workflow) error {
 	if err := s.validateWorkflow(workflow); err != nil {
@@ -100,6 +226,7 @@ func (s *Service) UpdateWorkflow(ctx context.Context, userID string, workflow *W
 	}
 
 	// Update workflow in transaction
+	defer s.invalidateWorkflow(userID, workflow.ID)
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		// Delete existing steps
 		if err := tx.Where("workflow_id = ?", workflow.ID).Delete(&WorkflowStep{}).Error; err != nil {
@@ -117,37 +244,63 @@ func (s *Service) UpdateWorkflow(ctx context.Context, userID string, workflow *W
 			}
 		}
 
-		// Update workflow
+		// Update workflow, inserting its steps anew
+		localIDs := takeLocalStepIDs(workflow.Steps)
 		if err := tx.Save(workflow).Error; err != nil {
 			return fmt.Errorf("failed to update workflow: %w", err)
 		}
 
-		return nil
+		return remapLocalStepIDs(tx, workflow.Steps, localIDs)
 	})
 }
 
+// Exists reports whether a workflow exists and belongs to the user, without
+// loading it. Deleted workflows do not exist.
+func (s *Service) Exists(ctx context.Context, userID string, workflowID uint) (bool, error) {
+	exists, err := database.Exists(s.db.WithContext(ctx).Model(&Workflow{}).Where("id = ? AND user_id = ?", workflowID, userID))
+	if err != nil {
+		return false, fmt.Errorf("failed to find workflow: %w", err)
+	}
+	return exists, nil
+}
+
 // DeleteWorkflow deletes a workflow
 func (s *Service) DeleteWorkflow(ctx context.Context, userID string, workflowID uint) error {
 	// Check if workflow exists and belongs to user
-	var workflow Workflow
-	err := s.db.Where("id = ? AND user_id = ?", workflowID, userID).First(&workflow).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("workflow %d not found", workflowID)
-	}
+	exists, err := s.Exists(ctx, userID, workflowID)
 	if err != nil {
-		return fmt.Errorf("failed to find workflow: %w", err)
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("workflow %d not found", workflowID)
 	}
 
 	// Delete workflow (soft delete)
-	if err := s.db.Delete(&workflow).Error; err != nil {
+	if err := s.db.Delete(&Workflow{}, workflowID).Error; err != nil {
 		return fmt.Errorf("failed to delete workflow: %w", err)
 	}
 
+	s.invalidateWorkflow(userID, workflowID)
+
 	return nil
 }
 
-// ExecuteWorkflow starts a new workflow execution
+// ExecuteWorkflow starts a new workflow execution. Once Start has been called
+// the steps run in the background and the execution is returned while still
+// Running, or Pending if it is queued behind the concurrency limit;
+// GetExecutionStatus reports progress as each step finishes.
 func (s *Service) ExecuteWorkflow(ctx context.Context, userID string, workflowID uint, input map[string]interface{}) (*WorkflowExecution, error) {
+	return s.ExecuteWorkflowWithPriority(ctx, userID, workflowID, input, 0)
+}
+
+// ExecuteWorkflowWithPriority starts a new workflow execution like
+// ExecuteWorkflow. When executions are queued, those with a higher priority
+// are admitted first.
+func (s *Service) ExecuteWorkflowWithPriority(ctx context.Context, userID string, workflowID uint, input map[string]interface{}, priority int) (*WorkflowExecution, error) {
+	if err := core.ValidateJSONSize("input", input); err != nil {
+		return nil, err
+	}
+
 	// Check if workflow exists and belongs to user
 	var workflow Workflow
 	err := s.db.Preload("Steps").Where("id = ? AND user_id = ?", workflowID, userID).First(&workflow).Error
@@ -158,6 +311,14 @@ func (s *Service) ExecuteWorkflow(ctx context.Context, userID string, workflowID
 		return nil, fmt.Errorf("failed to find workflow: %w", err)
 	}
 
+	// Resolve the shared environment, including its secrets, once for the whole execution
+	var env *resolvedEnvironment
+	if workflow.Environment != "" {
+		if env, err = s.resolveEnvironment(ctx, userID, workflow.Environment); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create execution record
 	execution := &WorkflowExecution{
 		WorkflowID: workflowID,
@@ -165,15 +326,18 @@ func (s *Service) ExecuteWorkflow(ctx context.Context, userID string, workflowID
 		Status:     ExecutionStatusRunning,
 		Input:      JSONMap(input),
 		Output:     make(JSONMap),
+		Priority:   priority,
 		StartedAt:  time.Now(),
 	}
 
 	if err := s.db.Create(execution).Error; err != nil {
 		return nil, fmt.Errorf("failed to create execution: %w", err)
 	}
-
-	// In a real implementation, this would start the actual workflow execution
-	// For now, we'll just create the execution record
+	if env == nil {
+		env = &resolvedEnvironment{vars: JSONMap{}}
+	}
+	s.environments.Set(execution.ID, env)
+	s.startExecution(&workflow, execution)
 
 	return execution, nil
 }
@@ -225,10 +389,50 @@ func (s *Service) CancelExecution(ctx context.Context, userID string, executionI
 	if err := s.db.Save(&execution).Error; err != nil {
 		return fmt.Errorf("failed to cancel execution: %w", err)
 	}
+	s.stopExecution(execution.ID)
+	s.environments.Delete(execution.ID)
 
 	return nil
 }
 
+// Search returns the user's workflows whose name or description match the query
+func (s *Service) Search(ctx context.Context, userID, query string, limit int) ([]*core.SearchHit, error) {
+	pattern := core.LikePattern(query)
+	var workflows []*Workflow
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Where(`LOWER(name) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\'`, pattern, pattern).
+		Limit(limit).
+		Find(&workflows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search workflows: %w", err)
+	}
+
+	hits := make([]*core.SearchHit, 0, len(workflows))
+	for _, workflow := range workflows {
+		score := core.MatchScore(query, workflow.Name)
+		if descriptionScore := 0.6 * core.MatchScore(query, workflow.Description); descriptionScore > score {
+			score = descriptionScore
+		}
+		hits = append(hits, &core.SearchHit{
+			ResourceType: core.ResourceTypeWorkflow,
+			ID:           fmt.Sprintf("%d", workflow.ID),
+			Title:        workflow.Name,
+			Description:  workflow.Description,
+			Score:        score,
+		})
+	}
+
+	return hits, nil
+}
+
+// invalidateWorkflow drops a workflow from the read cache
+func (s *Service) invalidateWorkflow(userID string, workflowID uint) {
+	if s.cache != nil {
+		s.cache.Delete(workflowCacheKey{userID: userID, workflowID: workflowID})
+	}
+}
+
 // validateWorkflow validates a workflow before creating/updating
 func (s *Service) validateWorkflow(workflow *Workflow) error {
 	if strings.TrimSpace(workflow.Name) == "" {
@@ -240,13 +444,27 @@ func (s *Service) validateWorkflow(workflow *Workflow) error {
 	if len(workflow.Steps) == 0 {
 		return errors.New("at least one step is required")
 	}
+	if err := core.ValidateJSONSize("variables", workflow.Variables); err != nil {
+		return err
+	}
 
-	// Validate steps
+	// Validate steps. Step outputs are keyed by name, so names must be unique.
+	names := make(map[string]bool, len(workflow.Steps))
 	for i, step := range workflow.Steps {
 		if err := s.validateStep(&workflow.Steps[i]); err != nil {
 			return fmt.Errorf("step %d: %w", i+1, err)
 		}
-		_ = step // Use step to avoid unused variable warning
+		if names[step.Name] {
+			return fmt.Errorf("step %d: step name '%s' is used by more than one step", i+1, step.Name)
+		}
+		names[step.Name] = true
+	}
+	graph, err := newStepGraph(workflow.Steps)
+	if err != nil {
+		return err
+	}
+	if err := validateConditionSkips(graph); err != nil {
+		return err
 	}
 
 	return nil
@@ -266,6 +484,18 @@ func (s *Service) validateStep(step *WorkflowStep) error {
 	if step.Retries < 0 {
 		step.Retries = 0
 	}
+	if !step.RunIf.valid() {
+		return fmt.Errorf("invalid run_if %q", step.RunIf)
+	}
+	if err := core.ValidateJSONSize("config", step.Config); err != nil {
+		return err
+	}
+	switch step.Type {
+	case StepTypeService:
+		return validateServiceStep(step.Config)
+	case StepTypeCondition:
+		return validateConditionStep(step.Config)
+	}
 
 	return nil
 }
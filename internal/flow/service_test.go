@@ -2,9 +2,16 @@ package flow
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -16,7 +23,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	require.NoError(t, err)
 
 	// Auto-migrate the schema
-	err = db.AutoMigrate(&Workflow{}, &WorkflowExecution{}, &WorkflowStep{}, &StepExecution{})
+	err = db.AutoMigrate(&Workflow{}, &WorkflowExecution{}, &WorkflowStep{}, &StepExecution{}, &WorkflowTemplate{}, &Artifact{}, &Environment{})
 	require.NoError(t, err)
 
 	return db
@@ -102,6 +109,13 @@ func TestWorkflowOperations(t *testing.T) {
 		list, err := service.ListWorkflows(ctx, "user2")
 		require.NoError(t, err)
 		assert.Len(t, list, 2)
+
+		page, err := service.ListWorkflowsPage(ctx, "user2", core.PageRequest{Page: 2, PageSize: 1})
+		require.NoError(t, err)
+		assert.Equal(t, 2, page.Total)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "Workflow 2", page.Items[0].Name)
+		assert.Len(t, page.Items[0].Steps, 1, "steps are loaded with the page")
 	})
 
 	t.Run("should update workflow", func(t *testing.T) {
@@ -145,12 +159,25 @@ func TestWorkflowOperations(t *testing.T) {
 		err := service.CreateWorkflow(ctx, workflow)
 		require.NoError(t, err)
 
+		exists, err := service.Exists(ctx, "user4", workflow.ID)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = service.Exists(ctx, "user1", workflow.ID)
+		require.NoError(t, err)
+		assert.False(t, exists, "another user's workflow should not exist")
+
 		err = service.DeleteWorkflow(ctx, "user4", workflow.ID)
 		require.NoError(t, err)
 
 		_, err = service.GetWorkflow(ctx, "user4", workflow.ID)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
+
+		// The workflow is soft-deleted, so it no longer exists
+		exists, err = service.Exists(ctx, "user4", workflow.ID)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.ErrorContains(t, service.DeleteWorkflow(ctx, "user4", workflow.ID), "not found")
 	})
 
 	t.Run("should isolate workflows between users", func(t *testing.T) {
@@ -284,4 +311,289 @@ func TestWorkflowValidation(t *testing.T) {
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "step name is required")
 	})
+	t.Run("should reject JSON larger than the configured limit", func(t *testing.T) {
+		core.SetMaxJSONSize(64)
+		t.Cleanup(func() { core.SetMaxJSONSize(0) })
+		large := JSONMap{"payload": strings.Repeat("x", 100)}
+
+		workflow := &Workflow{Name: "Big", UserID: "user1", Variables: large, Steps: []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1}}}
+		err := service.CreateWorkflow(ctx, workflow)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, core.ErrJSONTooLarge))
+		assert.Contains(t, err.Error(), "variables")
+		assert.NotContains(t, err.Error(), "failed to create workflow")
+
+		workflow = &Workflow{Name: "Big", UserID: "user1", Steps: []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1, Config: large}}}
+		err = service.CreateWorkflow(ctx, workflow)
+		assert.True(t, errors.Is(err, core.ErrJSONTooLarge))
+
+		workflow = &Workflow{Name: "Small", UserID: "user1", Steps: []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1}}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		_, err = service.ExecuteWorkflow(ctx, "user1", workflow.ID, large)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, core.ErrJSONTooLarge))
+		assert.Contains(t, err.Error(), "input")
+
+		// Values that bypass validation are still refused when serialized
+		_, err = large.Value()
+		assert.True(t, errors.Is(err, core.ErrJSONTooLarge))
+	})
+}
+
+func TestStepResult(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("should serialize command step result with stable schema", func(t *testing.T) {
+		result := &StepResult{
+			ExitCode: 2,
+			Stdout:   "building...",
+			Stderr:   "warning: deprecated flag",
+			Duration: 1500 * time.Millisecond,
+		}
+
+		output := result.ToOutput()
+		assert.Equal(t, 2, output[OutputKeyExitCode])
+		assert.Equal(t, "building...", output[OutputKeyStdout])
+		assert.Equal(t, "warning: deprecated flag", output[OutputKeyStderr])
+		assert.Equal(t, int64(1500), output[OutputKeyDurationMs])
+		assert.Equal(t, 0, output[OutputKeyHTTPStatus])
+		assert.Equal(t, "", output[OutputKeyResponseBody])
+	})
+
+	t.Run("should marshal directly in the output schema", func(t *testing.T) {
+		result := &StepResult{ExitCode: 1, Stderr: "boom", Duration: 1500 * time.Millisecond}
+
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &fields))
+		assert.Equal(t, float64(1500), fields[OutputKeyDurationMs])
+		assert.NotContains(t, fields, "duration")
+		assert.Len(t, fields, len(result.ToOutput()))
+
+		var decoded StepResult
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, *result, decoded)
+	})
+
+	t.Run("should round-trip HTTP step result through the database", func(t *testing.T) {
+		stepExecution := &StepExecution{ExecutionID: 1, StepID: 1, StartedAt: time.Now()}
+		stepExecution.SetResult(&StepResult{
+			HTTPStatus:   201,
+			ResponseBody: `{"deployed":true}`,
+			Duration:     250 * time.Millisecond,
+		})
+		require.NoError(t, db.Create(stepExecution).Error)
+
+		var stored StepExecution
+		require.NoError(t, db.First(&stored, stepExecution.ID).Error)
+
+		result, err := stored.Result()
+		require.NoError(t, err)
+		assert.Equal(t, 201, result.HTTPStatus)
+		assert.Equal(t, `{"deployed":true}`, result.ResponseBody)
+		assert.Equal(t, 250*time.Millisecond, result.Duration)
+		assert.Equal(t, 0, result.ExitCode)
+	})
+
+	t.Run("should reject output with mistyped fields", func(t *testing.T) {
+		_, err := StepResultFromOutput(JSONMap{OutputKeyExitCode: "zero"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exit_code")
+	})
+}
+
+// countQueries registers a callback that counts SELECT queries issued through db
+func countQueries(t testing.TB, db *gorm.DB) *int {
+	count := 0
+	err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		count++
+	})
+	require.NoError(t, err)
+	return &count
+}
+
+func TestWorkflowCache(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	service.EnableCache(10, time.Minute)
+	ctx := context.Background()
+	queries := countQueries(t, db)
+
+	workflow := &Workflow{
+		Name:   "Cached Workflow",
+		UserID: "user1",
+		Steps:  []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1}},
+	}
+	require.NoError(t, service.CreateWorkflow(ctx, workflow))
+
+	t.Run("should serve repeated reads from the cache", func(t *testing.T) {
+		*queries = 0
+		first, err := service.GetWorkflow(ctx, "user1", workflow.ID)
+		require.NoError(t, err)
+		afterMiss := *queries
+
+		second, err := service.GetWorkflow(ctx, "user1", workflow.ID)
+		require.NoError(t, err)
+		assert.Equal(t, afterMiss, *queries)
+		assert.Equal(t, first.Name, second.Name)
+	})
+
+	t.Run("should not share cached state with callers", func(t *testing.T) {
+		retrieved, err := service.GetWorkflow(ctx, "user1", workflow.ID)
+		require.NoError(t, err)
+		retrieved.Name = "Mutated"
+
+		again, err := service.GetWorkflow(ctx, "user1", workflow.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Cached Workflow", again.Name)
+	})
+
+	t.Run("should invalidate on update", func(t *testing.T) {
+		updated := &Workflow{
+			ID:     workflow.ID,
+			Name:   "Renamed Workflow",
+			UserID: "user1",
+			Steps:  []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1}},
+		}
+		require.NoError(t, service.UpdateWorkflow(ctx, "user1", updated))
+
+		retrieved, err := service.GetWorkflow(ctx, "user1", workflow.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed Workflow", retrieved.Name)
+	})
+
+	t.Run("should invalidate on delete", func(t *testing.T) {
+		require.NoError(t, service.DeleteWorkflow(ctx, "user1", workflow.ID))
+
+		_, err := service.GetWorkflow(ctx, "user1", workflow.ID)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+}
+
+// slowQueries counts queries against table and delays each one so concurrent
+// callers overlap
+func slowQueries(t testing.TB, db *gorm.DB, table string, delay time.Duration) *atomic.Int32 {
+	var count atomic.Int32
+	err := db.Callback().Query().Before("gorm:query").Register("test:slow_queries", func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			count.Add(1)
+			time.Sleep(delay)
+		}
+	})
+	require.NoError(t, err)
+	return &count
+}
+
+func TestConcurrentGetWorkflow(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	service := NewService()
+	service.SetDB(db)
+	ctx := context.Background()
+
+	workflow := &Workflow{
+		Name:   "Shared Workflow",
+		UserID: "user1",
+		Steps:  []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1}},
+	}
+	require.NoError(t, service.CreateWorkflow(ctx, workflow))
+	queries := slowQueries(t, db, "workflows", 50*time.Millisecond)
+
+	const readers = 20
+	read := func(userID string) ([]*Workflow, []error) {
+		results := make([]*Workflow, readers)
+		errs := make([]error, readers)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < readers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				results[i], errs[i] = service.GetWorkflow(ctx, userID, workflow.ID)
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		return results, errs
+	}
+
+	t.Run("should query once for concurrent identical reads", func(t *testing.T) {
+		queries.Store(0)
+		results, errs := read("user1")
+
+		assert.Equal(t, int32(1), queries.Load())
+		for i := range results {
+			require.NoError(t, errs[i])
+			assert.Equal(t, "Shared Workflow", results[i].Name)
+		}
+		results[0].Steps[0].Name = "Mutated"
+		assert.Equal(t, "Step 1", results[1].Steps[0].Name)
+	})
+
+	t.Run("should not share reads across users", func(t *testing.T) {
+		_, errs := read("user2")
+		for _, err := range errs {
+			assert.ErrorContains(t, err, "not found")
+		}
+	})
+}
+
+func BenchmarkGetWorkflow(b *testing.B) {
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cached=%t", cached), func(b *testing.B) {
+			db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			require.NoError(b, err)
+			require.NoError(b, db.AutoMigrate(&Workflow{}, &WorkflowStep{}))
+
+			service := NewService()
+			service.SetDB(db)
+			if cached {
+				service.EnableCache(100, time.Minute)
+			}
+			ctx := context.Background()
+
+			workflow := &Workflow{
+				Name:   "Bench",
+				UserID: "user1",
+				Steps:  []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1}},
+			}
+			require.NoError(b, service.CreateWorkflow(ctx, workflow))
+			queries := countQueries(b, db)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := service.GetWorkflow(ctx, "user1", workflow.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(*queries)/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+
+	create := func(name string, status WorkflowStatus) *Workflow {
+		workflow := &Workflow{UserID: "user1", Name: name, Status: status, Steps: []WorkflowStep{{Name: "Step 1", Type: StepTypeCommand, Order: 1}}}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		return workflow
+	}
+	create("build", WorkflowStatusActive)
+	create("deploy", WorkflowStatusDraft)
+	retired := create("cleanup", WorkflowStatusInactive)
+	require.NoError(t, service.DeleteWorkflow(ctx, "user1", retired.ID))
+
+	count, err := service.Count(ctx, "user1", core.CountFilter{GroupByStatus: true})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceTypeWorkflow, count.ResourceType)
+	assert.Equal(t, map[string]int64{"active": 1, "draft": 1}, count.ByStatus, "deleted workflows are not counted")
 }
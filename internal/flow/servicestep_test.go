@@ -0,0 +1,110 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingServiceCaller records calls and answers them with a fixed response
+type recordingServiceCaller struct {
+	calls    []*ServiceCall
+	response *ServiceCallResult
+	err      error
+}
+
+func (c *recordingServiceCaller) CallService(ctx context.Context, call *ServiceCall) (*ServiceCallResult, error) {
+	c.calls = append(c.calls, call)
+	return c.response, c.err
+}
+
+func TestServiceStep(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, steps ...WorkflowStep) (*Service, *recordingServiceCaller, *Workflow, *WorkflowExecution) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		caller := &recordingServiceCaller{response: &ServiceCallResult{StatusCode: http.StatusOK, Body: []byte(`{"status":"ok"}`)}}
+		service.SetServiceCaller(caller)
+
+		workflow := &Workflow{Name: "Orchestrate", UserID: "user1", Steps: steps}
+		require.NoError(t, service.CreateWorkflow(ctx, workflow))
+		execution, err := service.ExecuteWorkflow(ctx, "user1", workflow.ID, map[string]interface{}{"key": "db-password"})
+		require.NoError(t, err)
+		return service, caller, workflow, execution
+	}
+
+	t.Run("should call the service as the execution's user without a step runner", func(t *testing.T) {
+		service, caller, workflow, execution := setup(t, WorkflowStep{
+			Name: "store", Type: StepTypeService, Order: 1,
+			Config: JSONMap{"service": "vault", "method": "post", "path": "/api/v1/secrets",
+				"body": map[string]interface{}{"key": "{{ .input.key }}", "value": "hunter2"}},
+		})
+
+		stepExecution, err := service.RunStep(ctx, execution, &workflow.Steps[0], nil)
+		require.NoError(t, err)
+
+		require.Len(t, caller.calls, 1)
+		call := caller.calls[0]
+		assert.Equal(t, "vault", call.Service)
+		assert.Equal(t, http.MethodPost, call.Method)
+		assert.Equal(t, "/api/v1/secrets", call.Path)
+		assert.Equal(t, "user1", call.UserID)
+		assert.JSONEq(t, `{"key":"db-password","value":"hunter2"}`, string(call.Body))
+
+		assert.Equal(t, ExecutionStatusCompleted, stepExecution.Status)
+		result, err := stepExecution.Result()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, result.HTTPStatus)
+		assert.Equal(t, `{"status":"ok"}`, result.ResponseBody)
+	})
+
+	t.Run("should fail the step on an error status", func(t *testing.T) {
+		service, caller, workflow, execution := setup(t, WorkflowStep{
+			Name: "read", Type: StepTypeService, Order: 1,
+			Config: JSONMap{"service": "vault", "path": "/api/v1/secrets/missing"},
+		})
+		caller.response = &ServiceCallResult{StatusCode: http.StatusNotFound, Body: []byte(`{"error":"not found"}`)}
+
+		stepExecution, err := service.RunStep(ctx, execution, &workflow.Steps[0], nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "returned status 404")
+		assert.Equal(t, http.MethodGet, caller.calls[0].Method)
+		assert.Equal(t, ExecutionStatusFailed, stepExecution.Status)
+		result, err := stepExecution.Result()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, result.HTTPStatus)
+	})
+
+	t.Run("should fail the step when the service cannot be called", func(t *testing.T) {
+		service, caller, workflow, execution := setup(t, WorkflowStep{
+			Name: "read", Type: StepTypeService, Order: 1,
+			Config: JSONMap{"service": "vault", "path": "/api/v1/secrets"},
+		})
+		caller.err = errors.New("circuit breaker is open")
+
+		stepExecution, err := service.RunStep(ctx, execution, &workflow.Steps[0], nil)
+		require.Error(t, err)
+		assert.Equal(t, ExecutionStatusFailed, stepExecution.Status)
+		assert.Contains(t, stepExecution.Error, "circuit breaker is open")
+	})
+
+	t.Run("should reject service steps without a service or path", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+
+		for _, config := range []JSONMap{
+			{"path": "/api/v1/secrets"},
+			{"service": "vault"},
+			{"service": "vault", "path": "api/v1/secrets"},
+		} {
+			err := service.CreateWorkflow(ctx, &Workflow{Name: "Invalid", UserID: "user1",
+				Steps: []WorkflowStep{{Name: "call", Type: StepTypeService, Order: 1, Config: config}}})
+			assert.Error(t, err, "config %v", config)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package flow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+)
+
+// StepRunner runs a single workflow step with its resolved input
+type StepRunner interface {
+	RunStep(ctx context.Context, step *WorkflowStep, input JSONMap) (*StepResult, error)
+}
+
+// SetStepRunner sets the runner used to execute workflow steps
+func (s *Service) SetStepRunner(runner StepRunner) {
+	s.stepRunner = runner
+}
+
+// EnableStepCache reuses the output of a successful step execution with the same
+// config and input for up to ttl. Steps with NoCache set are always executed.
+func (s *Service) EnableStepCache(ttl time.Duration) {
+	s.stepCacheTTL = ttl
+}
+
+// RunStep executes a step as part of an execution and records its
+// StepExecution. Steps that should not run are recorded as Skipped or
+// Cancelled, and with step caching enabled a prior successful result is
+// reused and marked as Cached.
+func (s *Service) RunStep(ctx context.Context, execution *WorkflowExecution, step *WorkflowStep, input JSONMap) (*StepExecution, error) {
+	// Service and condition steps are run by the flow service itself
+	if s.stepRunner == nil && step.Type != StepTypeService && step.Type != StepTypeCondition {
+		return nil, errors.New("no step runner configured")
+	}
+
+	execCtx, err := s.ExecutionContext(ctx, execution)
+	if err != nil {
+		return nil, err
+	}
+	// A condition step whose expression was false cancels the steps it guards;
+	// a RunIf that does not hold for the dependencies skips the step
+	if condition, ok := execCtx.skippedBy[step.ID]; ok {
+		return s.cancelStep(ctx, execution, step, input, fmt.Sprintf("condition '%s' was false", condition))
+	}
+	if run, reason := execCtx.ShouldRun(step); !run {
+		return s.skipStep(ctx, execution, step, input, reason)
+	}
+	// Templates and ${...} placeholders are resolved against the execution
+	// context; a config that cannot be resolved fails the step unrun
+	config, err := execCtx.resolveConfig(step.Config)
+	if err != nil {
+		return s.failUnresolvedStep(ctx, execution, step, input, execCtx.redactor.error(err))
+	}
+	resolved := *step
+	resolved.Config = config
+	step = &resolved
+
+	cacheKey, err := StepCacheKey(step, input)
+	if err != nil {
+		return nil, err
+	}
+
+	stepExecution := &StepExecution{
+		ExecutionID: execution.ID,
+		StepID:      step.ID,
+		Status:      ExecutionStatusRunning,
+		Input:       input,
+		Output:      make(JSONMap),
+		StartedAt:   time.Now(),
+		Attempt:     1,
+		CacheKey:    cacheKey,
+	}
+
+	if s.stepCacheEnabled(step) {
+		cached, err := s.findCachedStep(ctx, step.ID, cacheKey)
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil {
+			now := time.Now()
+			stepExecution.Status = ExecutionStatusCompleted
+			stepExecution.Output = cached.Output
+			stepExecution.Cached = true
+			stepExecution.CompletedAt = &now
+			if err := s.db.WithContext(ctx).Create(stepExecution).Error; err != nil {
+				return nil, fmt.Errorf("failed to record step execution: %w", err)
+			}
+			if err := s.copyCachedArtifacts(ctx, execution, cached, stepExecution); err != nil {
+				return stepExecution, err
+			}
+			return stepExecution, nil
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Create(stepExecution).Error; err != nil {
+		return nil, fmt.Errorf("failed to record step execution: %w", err)
+	}
+
+	// Service steps call another service through the ServiceCaller and the
+	// rest run on the StepRunner, each attempt bounded by the step's Timeout
+	// and failed command and HTTP steps retried; see runStepAttempts
+	result, runErr := s.runStepAttempts(ctx, execution, step, input, stepExecution, execCtx.redactor)
+	if runErr == nil {
+		runErr = s.persistStepArtifacts(ctx, execution, step, stepExecution)
+	}
+	now := time.Now()
+	stepExecution.CompletedAt = &now
+	if result != nil {
+		stepExecution.SetResult(result)
+		// An output too large to store fails the step rather than its record
+		if err := core.ValidateJSONSize("step output", stepExecution.Output); err != nil {
+			stepExecution.Output = make(JSONMap)
+			if runErr == nil {
+				runErr = err
+			}
+		}
+	}
+	// Secrets injected into the step and values matching the redaction
+	// patterns must not be stored with what it printed
+	runErr = execCtx.redactor.error(runErr)
+	execCtx.redactor.step(stepExecution)
+	if runErr != nil {
+		stepExecution.Status = ExecutionStatusFailed
+		stepExecution.Error = runErr.Error()
+	} else {
+		stepExecution.Status = ExecutionStatusCompleted
+	}
+
+	// The step has already run, so record the outcome even if ctx is done
+	if err := s.db.Save(stepExecution).Error; err != nil {
+		return stepExecution, fmt.Errorf("failed to update step execution: %w", err)
+	}
+	if runErr != nil {
+		return stepExecution, fmt.Errorf("step '%s' failed: %w", step.Name, runErr)
+	}
+
+	return stepExecution, nil
+}
+
+// StepCacheKey hashes a step's type, config and input into a stable cache key
+func StepCacheKey(step *WorkflowStep, input JSONMap) (string, error) {
+	// encoding/json sorts map keys, so equal configs and inputs hash identically
+	payload, err := json.Marshal(struct {
+		Type   StepType `json:"type"`
+		Config JSONMap  `json:"config"`
+		Input  JSONMap  `json:"input"`
+	}{step.Type, step.Config, input})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash step: %w", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// stepCacheEnabled reports whether cached output may be used for a step.
+// Service steps other than GETs change state, so they always run.
+func (s *Service) stepCacheEnabled(step *WorkflowStep) bool {
+	if step.Type == StepTypeService {
+		if method, _ := step.Config[ServiceConfigMethod].(string); method != "" && !strings.EqualFold(method, http.MethodGet) {
+			return false
+		}
+	}
+	return s.stepCacheTTL > 0 && !step.NoCache
+}
+
+// findCachedStep returns the latest successful, non-cached execution of a step with
+// the same cache key that completed within the cache TTL
+func (s *Service) findCachedStep(ctx context.Context, stepID uint, cacheKey string) (*StepExecution, error) {
+	var cached StepExecution
+	err := s.db.WithContext(ctx).
+		Where("step_id = ? AND cache_key = ? AND status = ? AND cached = ? AND completed_at >= ?",
+			stepID, cacheKey, ExecutionStatusCompleted, false, time.Now().Add(-s.stepCacheTTL)).
+		Order("completed_at DESC").
+		First(&cached).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up cached step: %w", err)
+	}
+
+	return &cached, nil
+}
@@ -0,0 +1,154 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingRunner struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (r *countingRunner) RunStep(ctx context.Context, step *WorkflowStep, input JSONMap) (*StepResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	return &StepResult{Stdout: "built", Duration: time.Millisecond}, r.err
+}
+
+func setupStepCache(t *testing.T) (*Service, *countingRunner, *Workflow) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	runner := &countingRunner{}
+	service.SetStepRunner(runner)
+	service.EnableStepCache(time.Hour)
+
+	workflow := &Workflow{
+		Name:   "Build",
+		UserID: "user1",
+		Steps: []WorkflowStep{
+			{Name: "compile", Type: StepTypeCommand, Config: JSONMap{"command": "make"}, Order: 1},
+			{Name: "publish", Type: StepTypeCommand, Config: JSONMap{"command": "make publish"}, Order: 2, NoCache: true},
+		},
+	}
+	require.NoError(t, service.CreateWorkflow(context.Background(), workflow))
+	return service, runner, workflow
+}
+
+func TestStepCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should reuse output of an identical step instead of re-running it", func(t *testing.T) {
+		service, runner, workflow := setupStepCache(t)
+		step := &workflow.Steps[0]
+		input := JSONMap{"branch": "main"}
+
+		first, err := service.RunStep(ctx, &WorkflowExecution{ID: 1}, step, input)
+		require.NoError(t, err)
+		assert.False(t, first.Cached)
+
+		second, err := service.RunStep(ctx, &WorkflowExecution{ID: 2}, step, input)
+		require.NoError(t, err)
+		assert.True(t, second.Cached)
+		assert.Equal(t, ExecutionStatusCompleted, second.Status)
+		assert.Equal(t, first.CacheKey, second.CacheKey)
+
+		result, err := second.Result()
+		require.NoError(t, err)
+		assert.Equal(t, "built", result.Stdout)
+		assert.Equal(t, 1, runner.calls)
+	})
+
+	t.Run("should re-run the step when inputs change", func(t *testing.T) {
+		service, runner, workflow := setupStepCache(t)
+		step := &workflow.Steps[0]
+
+		_, err := service.RunStep(ctx, &WorkflowExecution{ID: 1}, step, JSONMap{"branch": "main"})
+		require.NoError(t, err)
+		changed, err := service.RunStep(ctx, &WorkflowExecution{ID: 2}, step, JSONMap{"branch": "dev"})
+		require.NoError(t, err)
+
+		assert.False(t, changed.Cached)
+		assert.Equal(t, 2, runner.calls)
+	})
+
+	t.Run("should always run steps marked NoCache", func(t *testing.T) {
+		service, runner, workflow := setupStepCache(t)
+		step := &workflow.Steps[1]
+
+		for i := uint(1); i <= 2; i++ {
+			stepExecution, err := service.RunStep(ctx, &WorkflowExecution{ID: i}, step, nil)
+			require.NoError(t, err)
+			assert.False(t, stepExecution.Cached)
+		}
+		assert.Equal(t, 2, runner.calls)
+	})
+
+	t.Run("should not cache failed steps", func(t *testing.T) {
+		service, runner, workflow := setupStepCache(t)
+		runner.err = errors.New("exit status 2")
+		step := &workflow.Steps[0]
+
+		failed, err := service.RunStep(ctx, &WorkflowExecution{ID: 1}, step, nil)
+		require.Error(t, err)
+		assert.Equal(t, ExecutionStatusFailed, failed.Status)
+		assert.Equal(t, "exit status 2", failed.Error)
+
+		runner.err = nil
+		retried, err := service.RunStep(ctx, &WorkflowExecution{ID: 2}, step, nil)
+		require.NoError(t, err)
+		assert.False(t, retried.Cached)
+		assert.Equal(t, 2, runner.calls)
+	})
+
+	t.Run("should ignore cached output older than the TTL", func(t *testing.T) {
+		service, runner, workflow := setupStepCache(t)
+		service.EnableStepCache(time.Minute)
+		step := &workflow.Steps[0]
+
+		first, err := service.RunStep(ctx, &WorkflowExecution{ID: 1}, step, nil)
+		require.NoError(t, err)
+		stale := time.Now().Add(-2 * time.Minute)
+		require.NoError(t, service.db.Model(first).Update("completed_at", stale).Error)
+
+		second, err := service.RunStep(ctx, &WorkflowExecution{ID: 2}, step, nil)
+		require.NoError(t, err)
+		assert.False(t, second.Cached)
+		assert.Equal(t, 2, runner.calls)
+	})
+
+	t.Run("should not cache when step caching is disabled", func(t *testing.T) {
+		service, runner, workflow := setupStepCache(t)
+		service.EnableStepCache(0)
+		step := &workflow.Steps[0]
+
+		for i := uint(1); i <= 2; i++ {
+			_, err := service.RunStep(ctx, &WorkflowExecution{ID: i}, step, nil)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, runner.calls)
+	})
+}
+
+func TestStepCacheKey(t *testing.T) {
+	step := &WorkflowStep{Type: StepTypeHTTP, Config: JSONMap{"url": "https://example.com", "method": "GET"}}
+
+	a, err := StepCacheKey(step, JSONMap{"a": 1, "b": 2})
+	require.NoError(t, err)
+	b, err := StepCacheKey(step, JSONMap{"b": 2, "a": 1})
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	changed, err := StepCacheKey(&WorkflowStep{Type: StepTypeHTTP, Config: JSONMap{"url": "https://example.org", "method": "GET"}}, JSONMap{"a": 1, "b": 2})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, changed)
+}
@@ -0,0 +1,199 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+)
+
+// ErrTemplateReadOnly is returned when a user changes a public template they did not create
+var ErrTemplateReadOnly = errors.New("template can only be changed by its creator")
+
+// templateWorkflow is the layout of WorkflowTemplate.Template, e.g.
+//
+//	{"description": "Build and deploy",
+//	 "variables": {"region": "eu-west-1"},
+//	 "steps": [{"id": 1, "name": "build", "type": 0, "order": 1, "config": {"command": "make"}},
+//	           {"id": 2, "name": "deploy", "type": 0, "order": 2, "depends_on": [1]}]}
+//
+// Step IDs only identify steps within the template, for depends_on; every
+// instance gets new ones.
+type templateWorkflow struct {
+	Description string         `json:"description"`
+	Variables   JSONMap        `json:"variables"`
+	Environment string         `json:"environment"`
+	Steps       []WorkflowStep `json:"steps"`
+}
+
+// TemplateOverrides customizes a workflow instantiated from a template
+type TemplateOverrides struct {
+	// Name of the workflow; defaults to the template's name
+	Name string `json:"name"`
+	// Variables are merged over the template's variables
+	Variables JSONMap `json:"variables"`
+}
+
+// decodeTemplate reads the workflow a template describes and validates it,
+// named and owned as given. Unknown keys are rejected so typos are not
+// silently dropped.
+func (s *Service) decodeTemplate(template *WorkflowTemplate, name, userID string) (*Workflow, error) {
+	data, err := json.Marshal(template.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode template: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var decoded templateWorkflow
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	workflow := &Workflow{
+		Name:        name,
+		Description: decoded.Description,
+		UserID:      userID,
+		Variables:   decoded.Variables,
+		Environment: decoded.Environment,
+		Steps:       decoded.Steps,
+	}
+	if err := s.validateWorkflow(workflow); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return workflow, nil
+}
+
+// validateTemplate checks a template's fields and that it describes a valid workflow
+func (s *Service) validateTemplate(template *WorkflowTemplate) error {
+	if strings.TrimSpace(template.Name) == "" {
+		return errors.New("name is required")
+	}
+	if err := core.ValidateJSONSize("template", template.Template); err != nil {
+		return err
+	}
+	_, err := s.decodeTemplate(template, template.Name, template.CreatedBy)
+	return err
+}
+
+// CreateTemplate creates a workflow template owned by the user
+func (s *Service) CreateTemplate(ctx context.Context, userID string, template *WorkflowTemplate) error {
+	template.CreatedBy = userID
+	if err := s.validateTemplate(template); err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Create(template).Error; err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	return nil
+}
+
+// GetTemplate retrieves a template the user created or that is public
+func (s *Service) GetTemplate(ctx context.Context, userID string, templateID uint) (*WorkflowTemplate, error) {
+	var template WorkflowTemplate
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND (public = ? OR created_by = ?)", templateID, true, userID).
+		First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("template %d not found", templateID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve template: %w", err)
+	}
+	return &template, nil
+}
+
+// ListTemplates returns the public templates and the user's own, by name
+func (s *Service) ListTemplates(ctx context.Context, userID string) ([]*WorkflowTemplate, error) {
+	var templates []*WorkflowTemplate
+	err := s.db.WithContext(ctx).
+		Where("public = ? OR created_by = ?", true, userID).
+		Order("name, id").
+		Find(&templates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return templates, nil
+}
+
+// ownTemplate retrieves a template the user may change
+func (s *Service) ownTemplate(ctx context.Context, userID string, templateID uint) (*WorkflowTemplate, error) {
+	template, err := s.GetTemplate(ctx, userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if template.CreatedBy != userID {
+		return nil, fmt.Errorf("template %d: %w", templateID, ErrTemplateReadOnly)
+	}
+	return template, nil
+}
+
+// UpdateTemplate updates a template the user created
+func (s *Service) UpdateTemplate(ctx context.Context, userID string, template *WorkflowTemplate) error {
+	existing, err := s.ownTemplate(ctx, userID, template.ID)
+	if err != nil {
+		return err
+	}
+	template.CreatedBy = existing.CreatedBy
+	template.CreatedAt = existing.CreatedAt
+	if err := s.validateTemplate(template); err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Save(template).Error; err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+	return nil
+}
+
+// DeleteTemplate deletes a template the user created. Workflows already
+// instantiated from it are kept.
+func (s *Service) DeleteTemplate(ctx context.Context, userID string, templateID uint) error {
+	if _, err := s.ownTemplate(ctx, userID, templateID); err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Delete(&WorkflowTemplate{}, templateID).Error; err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	return nil
+}
+
+// InstantiateTemplate creates a workflow for the user from a template they
+// created or that is public. The template is validated again first, since it
+// may predate changes to what a valid workflow is.
+func (s *Service) InstantiateTemplate(ctx context.Context, userID string, templateID uint, overrides TemplateOverrides) (*Workflow, error) {
+	template, err := s.GetTemplate(ctx, userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := template.Name
+	if strings.TrimSpace(overrides.Name) != "" {
+		name = overrides.Name
+	}
+	workflow, err := s.decodeTemplate(template, name, userID)
+	if err != nil {
+		return nil, fmt.Errorf("template %d: %w", templateID, err)
+	}
+	if len(overrides.Variables) > 0 {
+		variables := make(JSONMap, len(workflow.Variables)+len(overrides.Variables))
+		for key, value := range workflow.Variables {
+			variables[key] = value
+		}
+		for key, value := range overrides.Variables {
+			variables[key] = value
+		}
+		workflow.Variables = variables
+	}
+
+	ids, err := s.ImportWorkflows(ctx, userID, []*Workflow{workflow})
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate template %d: %w", templateID, err)
+	}
+	return s.GetWorkflow(ctx, userID, ids[workflow.ID])
+}
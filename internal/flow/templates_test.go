@@ -0,0 +1,158 @@
+package flow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func releaseTemplate(public bool) *WorkflowTemplate {
+	return &WorkflowTemplate{
+		Name:     "Release",
+		Category: "deploy",
+		Public:   public,
+		Template: JSONMap{
+			"description": "Build and deploy",
+			"variables":   map[string]interface{}{"region": "eu-west-1", "replicas": 2},
+			"steps": []interface{}{
+				map[string]interface{}{"id": 1, "name": "build", "type": 0, "order": 1, "config": map[string]interface{}{"command": "make"}},
+				map[string]interface{}{"id": 2, "name": "is-prod", "type": int(StepTypeCondition), "order": 2, "depends_on": []uint{1},
+					"config": map[string]interface{}{"expression": "input.env == 'prod'", "skip": []interface{}{3}}},
+				map[string]interface{}{"id": 3, "name": "deploy", "type": 0, "order": 3, "depends_on": []uint{2},
+					"config": map[string]interface{}{"command": "deploy ${var.region}"}},
+			},
+		},
+	}
+}
+
+func TestWorkflowTemplates(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *Service {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		return service
+	}
+
+	t.Run("should instantiate a template with overrides", func(t *testing.T) {
+		service := setup(t)
+		template := releaseTemplate(false)
+		require.NoError(t, service.CreateTemplate(ctx, "user1", template))
+		assert.Equal(t, "user1", template.CreatedBy)
+
+		workflow, err := service.InstantiateTemplate(ctx, "user1", template.ID, TemplateOverrides{
+			Name:      "Release api",
+			Variables: JSONMap{"region": "us-east-1"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Release api", workflow.Name)
+		assert.Equal(t, "user1", workflow.UserID)
+		assert.Equal(t, "Build and deploy", workflow.Description)
+		assert.Equal(t, JSONMap{"region": "us-east-1", "replicas": float64(2)}, workflow.Variables)
+		require.Len(t, workflow.Steps, 3)
+
+		// Step references are rewritten to the new step IDs
+		ids := make(map[string]uint, len(workflow.Steps))
+		for _, step := range workflow.Steps {
+			ids[step.Name] = step.ID
+		}
+		for _, step := range workflow.Steps {
+			switch step.Name {
+			case "is-prod":
+				assert.Equal(t, []uint{ids["build"]}, step.DependsOn)
+				assert.Equal(t, []interface{}{float64(ids["deploy"])}, step.Config[ConditionConfigSkip])
+			case "deploy":
+				assert.Equal(t, []uint{ids["is-prod"]}, step.DependsOn)
+			}
+		}
+
+		// A second instance gets its own steps and the template's name
+		second, err := service.InstantiateTemplate(ctx, "user1", template.ID, TemplateOverrides{})
+		require.NoError(t, err)
+		assert.Equal(t, "Release", second.Name)
+		assert.NotEqual(t, workflow.ID, second.ID)
+		assert.NotEqual(t, workflow.Steps[0].ID, second.Steps[0].ID)
+	})
+
+	t.Run("should share public templates but only let their creator change them", func(t *testing.T) {
+		service := setup(t)
+		public := releaseTemplate(true)
+		require.NoError(t, service.CreateTemplate(ctx, "user1", public))
+		private := releaseTemplate(false)
+		private.Name = "Private"
+		require.NoError(t, service.CreateTemplate(ctx, "user1", private))
+		own := releaseTemplate(false)
+		own.Name = "Own"
+		require.NoError(t, service.CreateTemplate(ctx, "user2", own))
+
+		templates, err := service.ListTemplates(ctx, "user2")
+		require.NoError(t, err)
+		require.Len(t, templates, 2)
+		assert.Equal(t, "Own", templates[0].Name)
+		assert.Equal(t, "Release", templates[1].Name)
+
+		workflow, err := service.InstantiateTemplate(ctx, "user2", public.ID, TemplateOverrides{})
+		require.NoError(t, err)
+		assert.Equal(t, "user2", workflow.UserID)
+
+		_, err = service.InstantiateTemplate(ctx, "user2", private.ID, TemplateOverrides{})
+		assert.ErrorContains(t, err, "not found")
+
+		public.Name = "Hijacked"
+		assert.ErrorIs(t, service.UpdateTemplate(ctx, "user2", public), ErrTemplateReadOnly)
+		assert.ErrorIs(t, service.DeleteTemplate(ctx, "user2", public.ID), ErrTemplateReadOnly)
+		assert.ErrorContains(t, service.DeleteTemplate(ctx, "user2", private.ID), "not found")
+
+		public.Name = "Release v2"
+		require.NoError(t, service.UpdateTemplate(ctx, "user1", public))
+		updated, err := service.GetTemplate(ctx, "user2", public.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Release v2", updated.Name)
+		assert.Equal(t, "user1", updated.CreatedBy)
+
+		require.NoError(t, service.DeleteTemplate(ctx, "user1", public.ID))
+		_, err = service.GetTemplate(ctx, "user1", public.ID)
+		assert.ErrorContains(t, err, "not found")
+		// Workflows instantiated from it are kept
+		_, err = service.GetWorkflow(ctx, "user2", workflow.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject templates that do not describe a valid workflow", func(t *testing.T) {
+		service := setup(t)
+		for name, tc := range map[string]struct {
+			template JSONMap
+			err      string
+		}{
+			"no steps":        {JSONMap{"description": "empty"}, "at least one step is required"},
+			"unknown key":     {JSONMap{"stepz": []interface{}{}}, `unknown field "stepz"`},
+			"malformed steps": {JSONMap{"steps": "build"}, "invalid template"},
+			"invalid step": {JSONMap{"steps": []interface{}{
+				map[string]interface{}{"name": "build", "order": 0},
+			}}, "step order must be positive"},
+			"unknown dependency": {JSONMap{"steps": []interface{}{
+				map[string]interface{}{"id": 1, "name": "build", "order": 1, "depends_on": []uint{7}},
+			}}, "depends on unknown step 7"},
+		} {
+			err := service.CreateTemplate(ctx, "user1", &WorkflowTemplate{Name: "Bad", Template: tc.template})
+			assert.ErrorContains(t, err, tc.err, name)
+		}
+		assert.ErrorContains(t, service.CreateTemplate(ctx, "user1", &WorkflowTemplate{Name: " ", Template: releaseTemplate(false).Template}), "name is required")
+	})
+
+	t.Run("should validate a stored template before instantiating it", func(t *testing.T) {
+		service := setup(t)
+		template := releaseTemplate(false)
+		require.NoError(t, service.CreateTemplate(ctx, "user1", template))
+		// Stored before validation, e.g. by an older version
+		require.NoError(t, service.db.Model(template).Update("template", JSONMap{"steps": []interface{}{}}).Error)
+
+		_, err := service.InstantiateTemplate(ctx, "user1", template.ID, TemplateOverrides{})
+		assert.ErrorContains(t, err, "at least one step is required")
+		workflows, err := service.ListWorkflows(ctx, "user1")
+		require.NoError(t, err)
+		assert.Empty(t, workflows)
+	})
+}
@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultDeliveryTimeout bounds each webhook delivery request
+const DefaultDeliveryTimeout = 10 * time.Second
+
+// Config configures a hub Service
+type Config struct {
+	// DispatchAttempts is how many times a webhook delivery is tried
+	DispatchAttempts int `json:"dispatch_attempts" yaml:"dispatch_attempts"`
+	// DispatchBackoff is the wait before the first retry; it doubles after each
+	DispatchBackoff time.Duration `json:"dispatch_backoff" yaml:"dispatch_backoff"`
+	// DeliveryTimeout bounds each delivery request
+	DeliveryTimeout time.Duration `json:"delivery_timeout" yaml:"delivery_timeout"`
+	// WebhookMaxSkew is how far a received webhook's timestamp may be from now
+	WebhookMaxSkew time.Duration `json:"webhook_max_skew" yaml:"webhook_max_skew"`
+}
+
+// DefaultConfig returns the settings NewService uses
+func DefaultConfig() Config {
+	return Config{
+		DispatchAttempts: DefaultDispatchAttempts,
+		DispatchBackoff:  DefaultDispatchBackoff,
+		DeliveryTimeout:  DefaultDeliveryTimeout,
+		WebhookMaxSkew:   DefaultWebhookMaxSkew,
+	}
+}
+
+// Validate checks deliveries are tried at least once with a non-negative
+// backoff, and the delivery timeout and webhook skew are positive
+func (c Config) Validate() error {
+	if c.DispatchAttempts < 1 {
+		return errors.New("dispatch attempts must be at least 1")
+	}
+	if c.DispatchBackoff < 0 {
+		return errors.New("dispatch backoff must not be negative")
+	}
+	if c.DeliveryTimeout <= 0 {
+		return errors.New("delivery timeout must be positive")
+	}
+	if c.WebhookMaxSkew <= 0 {
+		return errors.New("webhook max skew must be positive")
+	}
+	return nil
+}
+
+// NewServiceWithConfig validates cfg and creates a hub service using it
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid hub config: %w", err)
+	}
+	s := NewService()
+	s.SetDispatchRetry(cfg.DispatchAttempts, cfg.DispatchBackoff)
+	s.SetHTTPClient(&http.Client{Timeout: cfg.DeliveryTimeout})
+	s.SetWebhookMaxSkew(cfg.WebhookMaxSkew)
+	return s, nil
+}
@@ -0,0 +1,38 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("should create a service from a config", func(t *testing.T) {
+		service, err := NewServiceWithConfig(Config{DispatchAttempts: 5, DispatchBackoff: time.Millisecond, DeliveryTimeout: time.Second, WebhookMaxSkew: time.Minute})
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, service.webhookMaxSkew)
+		assert.Equal(t, 5, service.dispatchAttempts)
+		assert.Equal(t, time.Millisecond, service.dispatchBackoff)
+		assert.Equal(t, time.Second, service.httpClient.Timeout)
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		for _, tc := range []struct {
+			modify func(c *Config)
+			err    string
+		}{
+			{func(c *Config) { c.DispatchAttempts = 0 }, "dispatch attempts must be at least 1"},
+			{func(c *Config) { c.DispatchBackoff = -time.Second }, "dispatch backoff must not be negative"},
+			{func(c *Config) { c.DeliveryTimeout = 0 }, "delivery timeout must be positive"},
+			{func(c *Config) { c.WebhookMaxSkew = 0 }, "webhook max skew must be positive"},
+		} {
+			config := DefaultConfig()
+			tc.modify(&config)
+			assert.ErrorContains(t, config.Validate(), tc.err)
+			_, err := NewServiceWithConfig(config)
+			assert.ErrorContains(t, err, "invalid hub config")
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+// MaxDigestEvents caps how many events a digest keeps buffered while its
+// deliveries fail. The oldest events are dropped beyond it.
+const MaxDigestEvents = 1000
+
+type digestBuffer struct {
+	userID string
+	window time.Duration
+	events []*Event
+	timer  *time.Timer
+}
+
+type digestBatcher struct {
+	mu      sync.Mutex
+	buffers map[uint]*digestBuffer
+	closed  bool
+}
+
+func newDigestBatcher() *digestBatcher {
+	return &digestBatcher{buffers: make(map[uint]*digestBuffer)}
+}
+
+// take removes and returns the buffer of an integration, stopping its flush
+// timer, or returns nil if it has none
+func (b *digestBatcher) take(integrationID uint) *digestBuffer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	buffer, ok := b.buffers[integrationID]
+	if !ok {
+		return nil
+	}
+	delete(b.buffers, integrationID)
+	if buffer.timer != nil {
+		buffer.timer.Stop()
+	}
+	return buffer
+}
+
+// discard drops the events buffered for an integration and returns how many
+// there were
+func (b *digestBatcher) discard(integrationID uint) int {
+	if buffer := b.take(integrationID); buffer != nil {
+		return len(buffer.events)
+	}
+	return 0
+}
+
+// Notify dispatches an event immediately, or buffers it into a digest when the
+// integration has a digest window or event threshold configured
+func (s *Service) Notify(ctx context.Context, userID string, integrationID uint, event *Event) error {
+	integration, err := s.GetIntegration(ctx, userID, integrationID)
+	if err != nil {
+		return err
+	}
+	if err := checkEnabled(integration); err != nil {
+		return err
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	if integration.DigestWindow <= 0 && integration.DigestMaxEvents <= 0 {
+		_, err := s.Dispatch(ctx, userID, integrationID, event)
+		return err
+	}
+
+	batcher := s.digests
+	batcher.mu.Lock()
+	if batcher.closed {
+		batcher.mu.Unlock()
+		_, err := s.Dispatch(ctx, userID, integrationID, event)
+		return err
+	}
+
+	buffer, ok := batcher.buffers[integrationID]
+	if !ok {
+		buffer = &digestBuffer{userID: userID, window: integration.DigestWindow}
+		batcher.buffers[integrationID] = buffer
+		s.scheduleDigest(integrationID, buffer)
+	}
+	buffer.events = append(buffer.events, event)
+	full := integration.DigestMaxEvents > 0 && len(buffer.events) >= integration.DigestMaxEvents
+	batcher.mu.Unlock()
+
+	if full {
+		return s.flushDigest(ctx, integrationID)
+	}
+	return nil
+}
+
+// FlushDigests dispatches every buffered digest now, without waiting for
+// their windows to elapse
+func (s *Service) FlushDigests(ctx context.Context) error {
+	s.digests.mu.Lock()
+	ids := make([]uint, 0, len(s.digests.buffers))
+	for id := range s.digests.buffers {
+		ids = append(ids, id)
+	}
+	s.digests.mu.Unlock()
+
+	var errs []error
+	for _, id := range ids {
+		if err := s.flushDigest(ctx, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetFlushRegistry registers a hook dispatching buffered digests, so a
+// coordinated shutdown flush delivers them
+func (s *Service) SetFlushRegistry(registry *core.FlushRegistry) {
+	registry.Register("hub digests", s.FlushDigests)
+}
+
+// Close flushes buffered digests so no events are lost on shutdown. Events
+// notified after Close are dispatched immediately.
+func (s *Service) Close(ctx context.Context) error {
+	s.digests.mu.Lock()
+	s.digests.closed = true
+	s.digests.mu.Unlock()
+
+	return s.FlushDigests(ctx)
+}
+
+// scheduleDigest arms the timer flushing a buffer once its window elapses.
+// The caller must hold the batcher lock.
+func (s *Service) scheduleDigest(integrationID uint, buffer *digestBuffer) {
+	if buffer.window <= 0 {
+		return
+	}
+	buffer.timer = time.AfterFunc(buffer.window, func() {
+		if err := s.flushDigest(context.Background(), integrationID); err != nil {
+			log.Printf("⚠️  Failed to flush digest for integration %d: %v", integrationID, err)
+		}
+	})
+}
+
+func (s *Service) flushDigest(ctx context.Context, integrationID uint) error {
+	buffer := s.digests.take(integrationID)
+	if buffer == nil || len(buffer.events) == 0 {
+		return nil
+	}
+
+	_, err := s.Dispatch(ctx, buffer.userID, integrationID, digestEvent(buffer.events))
+	if errors.Is(err, errRetryableDelivery) {
+		// Only network errors, 429s and 5xx may succeed on a later flush.
+		// Other failures would fail again, or the digest was delivered and
+		// only recording it failed.
+		s.requeueDigest(integrationID, buffer)
+	}
+	return err
+}
+
+// requeueDigest puts the events of a failed flush back ahead of any buffered
+// since, re-arming the window timer when the integration has no buffer left.
+// After Close nothing would flush them again, so they are dropped.
+func (s *Service) requeueDigest(integrationID uint, buffer *digestBuffer) {
+	batcher := s.digests
+	batcher.mu.Lock()
+	defer batcher.mu.Unlock()
+
+	if batcher.closed {
+		log.Printf("⚠️  Dropped %d digest event(s) for integration %d: delivery failed during shutdown", len(buffer.events), integrationID)
+		return
+	}
+
+	if pending, ok := batcher.buffers[integrationID]; ok {
+		pending.events = append(buffer.events, pending.events...)
+		buffer = pending
+	} else {
+		batcher.buffers[integrationID] = buffer
+		s.scheduleDigest(integrationID, buffer)
+	}
+	if dropped := len(buffer.events) - MaxDigestEvents; dropped > 0 {
+		buffer.events = buffer.events[dropped:]
+		log.Printf("⚠️  Dropped %d digest event(s) for integration %d after failed deliveries", dropped, integrationID)
+	}
+}
+
+func digestEvent(events []*Event) *Event {
+	severity := EventSeverityInfo
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		if severityRank(event.Severity) > severityRank(severity) {
+			severity = event.Severity
+		}
+		line := fmt.Sprintf("• [%s] %s", event.Timestamp.UTC().Format(time.RFC3339), event.Title)
+		if event.Severity != "" {
+			line += fmt.Sprintf(" (%s)", event.Severity)
+		}
+		lines = append(lines, line)
+	}
+
+	return &Event{
+		Type:      "digest",
+		Title:     fmt.Sprintf("Digest: %d event(s)", len(events)),
+		Message:   strings.Join(lines, "\n"),
+		Severity:  severity,
+		Source:    "vertex",
+		Fields:    map[string]string{"events": fmt.Sprintf("%d", len(events))},
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+func severityRank(severity EventSeverity) int {
+	switch severity {
+	case EventSeverityCritical:
+		return 3
+	case EventSeverityError:
+		return 2
+	case EventSeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
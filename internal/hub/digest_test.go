@@ -0,0 +1,182 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type digestRecorder struct {
+	mu       sync.Mutex
+	payloads []map[string]interface{}
+}
+
+func (d *digestRecorder) handle(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&payload)
+	d.mu.Lock()
+	d.payloads = append(d.payloads, payload)
+	d.mu.Unlock()
+}
+
+func (d *digestRecorder) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.payloads)
+}
+
+func setupDigest(t *testing.T, window time.Duration, maxEvents int) (*Service, *Integration, *digestRecorder) {
+	recorder := &digestRecorder{}
+	service, integration := setupDispatch(t, recorder.handle)
+	integration.DigestWindow = window
+	integration.DigestMaxEvents = maxEvents
+	require.NoError(t, service.db.Save(integration).Error)
+	return service, integration, recorder
+}
+
+// setupFailingDigest is setupDigest with a receiver responding with status
+// until it is cleared
+func setupFailingDigest(t *testing.T, status int) (*Service, *Integration, *digestRecorder, *atomic.Int32) {
+	recorder := &digestRecorder{}
+	failing := &atomic.Int32{}
+	failing.Store(int32(status))
+	service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {
+		if status := failing.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+		recorder.handle(w, r)
+	})
+	integration.DigestWindow = time.Hour
+	require.NoError(t, service.db.Save(integration).Error)
+	return service, integration, recorder, failing
+}
+
+func TestDigestBatching(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should flush once the event threshold is reached", func(t *testing.T) {
+		service, integration, recorder := setupDigest(t, time.Hour, 3)
+
+		for i := 0; i < 2; i++ {
+			require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "build.failed", Title: "Build failed"}))
+		}
+		assert.Equal(t, 0, recorder.count())
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "build.failed", Title: "Build failed", Severity: EventSeverityError}))
+		require.Equal(t, 1, recorder.count())
+		assert.Equal(t, "digest", recorder.payloads[0]["type"])
+		assert.Equal(t, "error", recorder.payloads[0]["severity"])
+
+		deliveries, err := service.ListDeliveries(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		assert.Len(t, deliveries, 1)
+	})
+
+	t.Run("should flush when the window elapses", func(t *testing.T) {
+		service, integration, recorder := setupDigest(t, 50*time.Millisecond, 0)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed web"}))
+		assert.Equal(t, 0, recorder.count())
+
+		assert.Eventually(t, func() bool { return recorder.count() == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should flush pending digests through the flush registry", func(t *testing.T) {
+		service, integration, recorder := setupDigest(t, time.Hour, 0)
+		flushes := core.NewFlushRegistry()
+		service.SetFlushRegistry(flushes)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed web"}))
+		assert.Equal(t, 0, recorder.count())
+
+		require.NoError(t, flushes.Flush(ctx))
+		require.Equal(t, 1, recorder.count())
+		assert.Equal(t, "Digest: 2 event(s)", recorder.payloads[0]["title"])
+		deliveries, err := service.ListDeliveries(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		assert.Len(t, deliveries, 1, "the delivery is persisted")
+	})
+
+	t.Run("should flush pending digests on close", func(t *testing.T) {
+		service, integration, recorder := setupDigest(t, time.Hour, 0)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed web"}))
+		require.NoError(t, service.Close(ctx))
+		assert.Equal(t, 1, recorder.count())
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed worker"}))
+		assert.Equal(t, 2, recorder.count())
+	})
+
+	t.Run("should keep events buffered when a flush fails with a retryable error", func(t *testing.T) {
+		service, integration, recorder, failing := setupFailingDigest(t, http.StatusServiceUnavailable)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed web"}))
+		assert.Error(t, service.FlushDigests(ctx))
+
+		failing.Store(0)
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed worker"}))
+		require.NoError(t, service.FlushDigests(ctx))
+		require.Equal(t, 1, recorder.count())
+		assert.Equal(t, "Digest: 3 event(s)", recorder.payloads[0]["title"])
+		assert.Contains(t, recorder.payloads[0]["message"], "Deployed api")
+	})
+
+	t.Run("should not requeue events whose flush fails on close", func(t *testing.T) {
+		service, integration, _, _ := setupFailingDigest(t, http.StatusServiceUnavailable)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		assert.Error(t, service.Close(ctx))
+
+		service.digests.mu.Lock()
+		defer service.digests.mu.Unlock()
+		assert.Empty(t, service.digests.buffers, "nothing would flush them, nor stop their timer")
+	})
+
+	t.Run("should drop events the receiver rejects", func(t *testing.T) {
+		service, integration, recorder, failing := setupFailingDigest(t, http.StatusBadRequest)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		assert.Error(t, service.FlushDigests(ctx))
+
+		failing.Store(0)
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed web"}))
+		require.NoError(t, service.FlushDigests(ctx))
+		require.Equal(t, 1, recorder.count())
+		assert.Equal(t, "Digest: 1 event(s)", recorder.payloads[0]["title"])
+	})
+
+	t.Run("should not resend a digest whose delivery failed to be recorded", func(t *testing.T) {
+		service, integration, recorder := setupDigest(t, time.Hour, 0)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		require.NoError(t, service.db.Migrator().DropTable(&WebhookDelivery{}))
+		assert.ErrorContains(t, service.FlushDigests(ctx), "failed to record delivery")
+		assert.Equal(t, 1, recorder.count())
+
+		require.NoError(t, service.db.AutoMigrate(&WebhookDelivery{}))
+		require.NoError(t, service.FlushDigests(ctx))
+		assert.Equal(t, 1, recorder.count())
+	})
+
+	t.Run("should dispatch immediately without a digest configured", func(t *testing.T) {
+		service, integration, recorder := setupDigest(t, 0, 0)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed api"}))
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, &Event{Type: "deploy", Title: "Deployed web"}))
+		assert.Equal(t, 2, recorder.count())
+	})
+}
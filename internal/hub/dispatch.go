@@ -0,0 +1,245 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultDispatchAttempts is how many times a delivery is tried
+	DefaultDispatchAttempts = 3
+	// DefaultDispatchBackoff is the wait before the first retry; it doubles after each
+	DefaultDispatchBackoff = time.Second
+	// MaxDeliveryResponseBytes is how much of a response body a delivery records
+	MaxDeliveryResponseBytes = 1024
+)
+
+// errRetryableDelivery and errFailedDelivery tell the dispatch retry loop whether a
+// failed delivery is worth another attempt. Dispatch errors wrap the last one.
+var (
+	errRetryableDelivery = errors.New("retryable delivery failure")
+	errFailedDelivery    = errors.New("delivery failure")
+)
+
+var defaultIntegrationURLs = map[string]string{
+	"pagerduty": "https://events.pagerduty.com/v2/enqueue",
+}
+
+// WebhookDelivery records one attempt to deliver an event to an integration.
+// The attempts of one Dispatch share a DispatchID.
+type WebhookDelivery struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	DispatchID    string    `json:"dispatch_id" gorm:"index;not null"`
+	IntegrationID uint      `json:"integration_id" gorm:"index;not null"`
+	UserID        string    `json:"user_id" gorm:"index;not null"`
+	EventType     string    `json:"event_type"`
+	Attempt       int       `json:"attempt"`
+	StatusCode    int       `json:"status_code"`
+	ResponseBody  string    `json:"response_body"`
+	Error         string    `json:"error,omitempty"`
+	Success       bool      `json:"success"`
+	DurationMs    int64     `json:"duration_ms"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// SetHTTPClient sets the client deliveries are sent with
+func (s *Service) SetHTTPClient(client *http.Client) {
+	s.httpClient = client
+}
+
+// SetDispatchRetry sets how many times a delivery is tried and the wait before
+// the first retry, which doubles after each
+func (s *Service) SetDispatchRetry(attempts int, backoff time.Duration) {
+	s.dispatchAttempts = attempts
+	s.dispatchBackoff = backoff
+}
+
+// GetIntegration returns one of the user's integrations
+func (s *Service) GetIntegration(ctx context.Context, userID string, integrationID uint) (*Integration, error) {
+	var integration Integration
+	err := s.db.Where("id = ? AND user_id = ?", integrationID, userID).First(&integration).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("integration %d not found", integrationID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get integration: %w", err)
+	}
+
+	return &integration, nil
+}
+
+// Exists reports whether an integration exists and belongs to the user, without loading it
+func (s *Service) Exists(ctx context.Context, userID string, integrationID uint) (bool, error) {
+	exists, err := database.Exists(s.db.WithContext(ctx).Model(&Integration{}).Where("id = ? AND user_id = ?", integrationID, userID))
+	if err != nil {
+		return false, fmt.Errorf("failed to get integration: %w", err)
+	}
+	return exists, nil
+}
+
+// Dispatch delivers an event to an integration, retrying network errors, 429s and
+// 5xx responses with exponential backoff. Every attempt is recorded as a WebhookDelivery.
+// A disabled integration fails with ErrIntegrationDisabled without any attempt.
+func (s *Service) Dispatch(ctx context.Context, userID string, integrationID uint, event *Event) (*WebhookDelivery, error) {
+	integration, err := s.GetIntegration(ctx, userID, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEnabled(integration); err != nil {
+		return nil, err
+	}
+
+	url := integration.Config["url"]
+	if url == "" {
+		url = defaultIntegrationURLs[integration.Type]
+	}
+	if url == "" {
+		return nil, fmt.Errorf("integration %d has no url configured", integrationID)
+	}
+
+	payload, err := s.FormatPayload(integration, event)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatchID := uuid.New().String()
+	policy := core.RetryPolicy{
+		MaxAttempts: s.dispatchAttempts,
+		BaseDelay:   s.dispatchBackoff,
+		Multiplier:  2,
+		Retryable:   func(err error) bool { return errors.Is(err, errRetryableDelivery) },
+	}
+
+	var delivery *WebhookDelivery
+	err = core.Retry(ctx, policy, func(attempt int) error {
+		var retryable bool
+		delivery, retryable = s.deliver(ctx, integration, url, payload)
+		delivery.DispatchID = dispatchID
+		delivery.EventType = event.Type
+		delivery.Attempt = attempt
+		if err := s.db.Create(delivery).Error; err != nil {
+			return fmt.Errorf("failed to record delivery: %w", err)
+		}
+
+		switch {
+		case delivery.Success:
+			return nil
+		case retryable:
+			return errRetryableDelivery
+		default:
+			return errFailedDelivery
+		}
+	})
+	switch {
+	case err == nil:
+		return delivery, nil
+	case errors.Is(err, errRetryableDelivery), errors.Is(err, errFailedDelivery):
+		return delivery, fmt.Errorf("dispatch to integration %d failed after %d attempt(s): %s: %w", integrationID, delivery.Attempt, delivery.Error, err)
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		return delivery, fmt.Errorf("dispatch cancelled: %w", err)
+	default:
+		return delivery, err
+	}
+}
+
+func (s *Service) deliver(ctx context.Context, integration *Integration, url string, payload []byte) (*WebhookDelivery, bool) {
+	delivery := &WebhookDelivery{
+		IntegrationID: integration.ID,
+		UserID:        integration.UserID,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vertex-hub")
+	if token := integration.Config["token"]; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := s.client().Do(req)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, ctx.Err() == nil
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxDeliveryResponseBytes))
+	delivery.StatusCode = resp.StatusCode
+	delivery.ResponseBody = string(body)
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return delivery, retryable
+}
+
+// ListDeliveries returns every delivery attempt to one of the user's
+// integrations, newest first
+func (s *Service) ListDeliveries(ctx context.Context, userID string, integrationID uint) ([]*WebhookDelivery, error) {
+	exists, err := s.Exists(ctx, userID, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("integration %d not found", integrationID)
+	}
+
+	var deliveries []*WebhookDelivery
+	err = s.db.Where("integration_id = ? AND user_id = ?", integrationID, userID).
+		Order("created_at DESC, id DESC").
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// ListDeliveriesPage returns one page of an integration's deliveries, newest
+// first, reading only that page from the store
+func (s *Service) ListDeliveriesPage(ctx context.Context, userID string, integrationID uint, request core.PageRequest) (*core.Page[*WebhookDelivery], error) {
+	exists, err := s.Exists(ctx, userID, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("integration %d not found", integrationID)
+	}
+
+	query := s.db.WithContext(ctx).Model(&WebhookDelivery{}).
+		Where("integration_id = ? AND user_id = ?", integrationID, userID).
+		Order("created_at DESC, id DESC")
+	page, err := database.Paginate[*WebhookDelivery](query, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	return page, nil
+}
+
+func (s *Service) client() *http.Client {
+	if s.httpClient != nil {
+		return s.httpClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDispatch(t *testing.T, handler http.HandlerFunc) (*Service, *Integration) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+	service.SetDispatchRetry(3, time.Millisecond)
+
+	integration := &Integration{Name: "Ops hook", UserID: "user1", Type: "webhook", Config: map[string]string{"url": server.URL}}
+	require.NoError(t, service.CreateIntegration(context.Background(), integration))
+	return service, integration
+}
+
+func TestWebhookDispatch(t *testing.T) {
+	ctx := context.Background()
+	event := &Event{Type: "deploy.finished", Title: "Deployed api"}
+
+	t.Run("should record a successful delivery", func(t *testing.T) {
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			w.Write([]byte(`{"ok":true}`))
+		})
+
+		delivery, err := service.Dispatch(ctx, "user1", integration.ID, event)
+		require.NoError(t, err)
+		assert.True(t, delivery.Success)
+
+		deliveries, err := service.ListDeliveries(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+		assert.Equal(t, `{"ok":true}`, deliveries[0].ResponseBody)
+		assert.Equal(t, 1, deliveries[0].Attempt)
+		assert.Equal(t, "deploy.finished", deliveries[0].EventType)
+	})
+
+	t.Run("should record every attempt when retries are exhausted", func(t *testing.T) {
+		var calls int32
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(strings.Repeat("e", 4096)))
+		})
+
+		_, err := service.Dispatch(ctx, "user1", integration.ID, event)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "after 3 attempt(s)")
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+		deliveries, err := service.ListDeliveries(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 3)
+		attempts := []int{deliveries[0].Attempt, deliveries[1].Attempt, deliveries[2].Attempt}
+		assert.ElementsMatch(t, []int{1, 2, 3}, attempts)
+		for _, delivery := range deliveries {
+			assert.False(t, delivery.Success)
+			assert.Equal(t, http.StatusBadGateway, delivery.StatusCode)
+			assert.Len(t, delivery.ResponseBody, MaxDeliveryResponseBytes)
+			assert.Equal(t, deliveries[0].DispatchID, delivery.DispatchID)
+		}
+	})
+
+	t.Run("should succeed after a transient failure", func(t *testing.T) {
+		var calls int32
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		delivery, err := service.Dispatch(ctx, "user1", integration.ID, event)
+		require.NoError(t, err)
+		assert.Equal(t, 2, delivery.Attempt)
+	})
+
+	t.Run("should not retry client errors", func(t *testing.T) {
+		var calls int32
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadRequest)
+		})
+
+		_, err := service.Dispatch(ctx, "user1", integration.ID, event)
+		require.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("should not list another user's deliveries", func(t *testing.T) {
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {})
+
+		_, err := service.ListDeliveries(ctx, "user2", integration.ID)
+		assert.ErrorContains(t, err, "not found")
+	})
+}
@@ -0,0 +1,282 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventSeverity string
+
+const (
+	EventSeverityInfo     EventSeverity = "info"
+	EventSeverityWarning  EventSeverity = "warning"
+	EventSeverityError    EventSeverity = "error"
+	EventSeverityCritical EventSeverity = "critical"
+)
+
+// Event is the provider-neutral notification that formatters translate
+type Event struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	Severity  EventSeverity     `json:"severity"`
+	Source    string            `json:"source"`
+	URL       string            `json:"url,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// PayloadFormatter renders an event as the request body an integration type expects
+type PayloadFormatter interface {
+	Format(integration *Integration, event *Event) ([]byte, error)
+}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]PayloadFormatter{
+		"slack":     SlackFormatter{},
+		"pagerduty": PagerDutyFormatter{},
+		"github":    GitHubFormatter{},
+		"webhook":   WebhookFormatter{},
+	}
+)
+
+// RegisterFormatter sets the formatter for an integration type, replacing any
+// built-in one; types are matched case-insensitively
+func RegisterFormatter(integrationType string, formatter PayloadFormatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+
+	formatters[strings.ToLower(integrationType)] = formatter
+}
+
+// FormatterFor falls back to the generic webhook formatter for unknown types
+func FormatterFor(integrationType string) PayloadFormatter {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	if formatter, ok := formatters[strings.ToLower(integrationType)]; ok {
+		return formatter
+	}
+	return WebhookFormatter{}
+}
+
+// FormatPayload renders event for integration with the formatter for its type,
+// defaulting the event's timestamp to now and its severity to info
+func (s *Service) FormatPayload(integration *Integration, event *Event) ([]byte, error) {
+	if event == nil {
+		return nil, errors.New("event is required")
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.Severity == "" {
+		event.Severity = EventSeverityInfo
+	}
+
+	payload, err := FormatterFor(integration.Type).Format(integration, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format %s payload: %w", integration.Type, err)
+	}
+	return payload, nil
+}
+
+// WebhookFormatter sends the event itself as JSON
+type WebhookFormatter struct{}
+
+// Format returns the event as JSON
+func (WebhookFormatter) Format(integration *Integration, event *Event) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// SlackFormatter builds a Block Kit message
+type SlackFormatter struct{}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+// Slack allows at most 10 fields per section block
+const slackMaxFields = 10
+
+// Format returns a message with the title as header, then the message, the
+// fields and a severity and source footer
+func (SlackFormatter) Format(integration *Integration, event *Event) ([]byte, error) {
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: event.Title}},
+	}
+	if event.Message != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: event.Message}})
+	}
+
+	keys := sortedKeys(event.Fields)
+	for start := 0; start < len(keys); start += slackMaxFields {
+		end := start + slackMaxFields
+		if end > len(keys) {
+			end = len(keys)
+		}
+		fields := make([]slackText, 0, end-start)
+		for _, key := range keys[start:end] {
+			fields = append(fields, slackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", key, event.Fields[key])})
+		}
+		blocks = append(blocks, slackBlock{Type: "section", Fields: fields})
+	}
+
+	footer := fmt.Sprintf("%s %s", slackSeverityEmoji(event.Severity), event.Severity)
+	if event.Source != "" {
+		footer += " | " + event.Source
+	}
+	if event.URL != "" {
+		footer += fmt.Sprintf(" | <%s|View details>", event.URL)
+	}
+	blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: footer}}})
+
+	payload := map[string]interface{}{
+		// text is the notification fallback when blocks cannot be rendered
+		"text":   fmt.Sprintf("[%s] %s", strings.ToUpper(string(event.Severity)), event.Title),
+		"blocks": blocks,
+	}
+	if channel := integration.Config["channel"]; channel != "" {
+		payload["channel"] = channel
+	}
+	return json.Marshal(payload)
+}
+
+func slackSeverityEmoji(severity EventSeverity) string {
+	switch severity {
+	case EventSeverityCritical:
+		return ":rotating_light:"
+	case EventSeverityError:
+		return ":red_circle:"
+	case EventSeverityWarning:
+		return ":warning:"
+	default:
+		return ":information_source:"
+	}
+}
+
+// PagerDutyFormatter targets the Events API v2 enqueue endpoint
+type PagerDutyFormatter struct{}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key,omitempty"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links,omitempty"`
+}
+
+// Format returns a trigger event for the routing_key in the integration config,
+// deduplicated by the event's dedup_key field
+func (PagerDutyFormatter) Format(integration *Integration, event *Event) ([]byte, error) {
+	routingKey := integration.Config["routing_key"]
+	if routingKey == "" {
+		return nil, errors.New("routing_key is required in the integration config")
+	}
+
+	source := event.Source
+	if source == "" {
+		source = "vertex"
+	}
+	// The summary is limited to 1024 characters by the Events API
+	summary := event.Title
+	if event.Message != "" {
+		summary += ": " + event.Message
+	}
+	if len(summary) > 1024 {
+		summary = summary[:1024]
+	}
+
+	pdEvent := pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    event.Fields["dedup_key"],
+		Payload: pagerDutyPayload{
+			Summary:       summary,
+			Source:        source,
+			Severity:      string(event.Severity),
+			Timestamp:     event.Timestamp.UTC().Format(time.RFC3339),
+			Class:         event.Type,
+			CustomDetails: event.Fields,
+		},
+	}
+	if event.URL != "" {
+		pdEvent.Links = []pagerDutyLink{{Href: event.URL, Text: "View in Vertex"}}
+	}
+	return json.Marshal(pdEvent)
+}
+
+// GitHubFormatter builds a create-issue request body
+type GitHubFormatter struct{}
+
+// Format returns an issue with the fields as a table, labelled with the
+// severity and the comma-separated labels in the integration config
+func (GitHubFormatter) Format(integration *Integration, event *Event) ([]byte, error) {
+	var body strings.Builder
+	if event.Message != "" {
+		body.WriteString(event.Message + "\n\n")
+	}
+	if len(event.Fields) > 0 {
+		body.WriteString("| Field | Value |\n| --- | --- |\n")
+		for _, key := range sortedKeys(event.Fields) {
+			fmt.Fprintf(&body, "| %s | %s |\n", key, strings.ReplaceAll(event.Fields[key], "|", "\\|"))
+		}
+		body.WriteString("\n")
+	}
+	fmt.Fprintf(&body, "Severity: **%s**", event.Severity)
+	if event.Source != "" {
+		fmt.Fprintf(&body, " · Source: %s", event.Source)
+	}
+	if event.URL != "" {
+		fmt.Fprintf(&body, "\n\n[View details](%s)", event.URL)
+	}
+
+	labels := []string{"severity:" + string(event.Severity)}
+	for _, label := range strings.Split(integration.Config["labels"], ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"title":  event.Title,
+		"body":   body.String(),
+		"labels": labels,
+	})
+}
+
+func sortedKeys(fields map[string]string) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
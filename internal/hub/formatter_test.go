@@ -0,0 +1,127 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent() *Event {
+	return &Event{
+		Type:      "alert.triggered",
+		Title:     "High CPU on api",
+		Message:   "CPU above 90% for 5 minutes",
+		Severity:  EventSeverityCritical,
+		Source:    "monitor",
+		URL:       "https://vertex.example.com/alerts/7",
+		Fields:    map[string]string{"service": "api", "value": "93.5"},
+		Timestamp: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func formatAs(t *testing.T, integration *Integration, event *Event) map[string]interface{} {
+	payload, err := NewService().FormatPayload(integration, event)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &decoded))
+	return decoded
+}
+
+func TestSlackFormatter(t *testing.T) {
+	payload := formatAs(t, &Integration{Type: "slack", Config: map[string]string{"channel": "#ops"}}, testEvent())
+
+	assert.Equal(t, "[CRITICAL] High CPU on api", payload["text"])
+	assert.Equal(t, "#ops", payload["channel"])
+
+	blocks := payload["blocks"].([]interface{})
+	require.Len(t, blocks, 4)
+	header := blocks[0].(map[string]interface{})
+	assert.Equal(t, "header", header["type"])
+	assert.Equal(t, "plain_text", header["text"].(map[string]interface{})["type"])
+	assert.Equal(t, "High CPU on api", header["text"].(map[string]interface{})["text"])
+
+	fields := blocks[2].(map[string]interface{})["fields"].([]interface{})
+	require.Len(t, fields, 2)
+	assert.Equal(t, "*service*\napi", fields[0].(map[string]interface{})["text"])
+
+	footer := blocks[3].(map[string]interface{})
+	assert.Equal(t, "context", footer["type"])
+	assert.Contains(t, footer["elements"].([]interface{})[0].(map[string]interface{})["text"], "<https://vertex.example.com/alerts/7|View details>")
+
+	t.Run("should split more than ten fields across sections", func(t *testing.T) {
+		event := testEvent()
+		event.Fields = map[string]string{}
+		for i := 0; i < 12; i++ {
+			event.Fields[fmt.Sprintf("field%02d", i)] = "x"
+		}
+		payload := formatAs(t, &Integration{Type: "slack"}, event)
+		blocks := payload["blocks"].([]interface{})
+		assert.Len(t, blocks[2].(map[string]interface{})["fields"], 10)
+		assert.Len(t, blocks[3].(map[string]interface{})["fields"], 2)
+	})
+}
+
+func TestPagerDutyFormatter(t *testing.T) {
+	integration := &Integration{Type: "pagerduty", Config: map[string]string{"routing_key": "R0UT1NG"}}
+	payload := formatAs(t, integration, testEvent())
+
+	assert.Equal(t, "R0UT1NG", payload["routing_key"])
+	assert.Equal(t, "trigger", payload["event_action"])
+
+	body := payload["payload"].(map[string]interface{})
+	assert.Equal(t, "High CPU on api: CPU above 90% for 5 minutes", body["summary"])
+	assert.Equal(t, "monitor", body["source"])
+	assert.Equal(t, "critical", body["severity"])
+	assert.Equal(t, "2024-03-01T12:00:00Z", body["timestamp"])
+	assert.Equal(t, "alert.triggered", body["class"])
+	assert.Equal(t, "api", body["custom_details"].(map[string]interface{})["service"])
+
+	links := payload["links"].([]interface{})
+	assert.Equal(t, "https://vertex.example.com/alerts/7", links[0].(map[string]interface{})["href"])
+
+	t.Run("should require a routing key", func(t *testing.T) {
+		_, err := NewService().FormatPayload(&Integration{Type: "pagerduty"}, testEvent())
+		assert.ErrorContains(t, err, "routing_key")
+	})
+}
+
+func TestGitHubFormatter(t *testing.T) {
+	integration := &Integration{Type: "github", Config: map[string]string{"labels": "ops, incident"}}
+	payload := formatAs(t, integration, testEvent())
+
+	assert.Equal(t, "High CPU on api", payload["title"])
+	assert.Equal(t, []interface{}{"severity:critical", "ops", "incident"}, payload["labels"])
+	body := payload["body"].(string)
+	assert.Contains(t, body, "CPU above 90% for 5 minutes")
+	assert.Contains(t, body, "| service | api |")
+	assert.Contains(t, body, "[View details](https://vertex.example.com/alerts/7)")
+}
+
+func TestFormatterRegistry(t *testing.T) {
+	t.Run("should fall back to the generic webhook formatter", func(t *testing.T) {
+		payload := formatAs(t, &Integration{Type: "jira"}, testEvent())
+		assert.Equal(t, "alert.triggered", payload["type"])
+		assert.Equal(t, "High CPU on api", payload["title"])
+	})
+
+	t.Run("should default severity and timestamp", func(t *testing.T) {
+		payload := formatAs(t, &Integration{Type: "webhook"}, &Event{Title: "Deployed"})
+		assert.Equal(t, "info", payload["severity"])
+		assert.NotEqual(t, "0001-01-01T00:00:00Z", payload["timestamp"])
+	})
+
+	t.Run("should use registered formatters", func(t *testing.T) {
+		RegisterFormatter("Custom", WebhookFormatter{})
+		defer func() {
+			formattersMu.Lock()
+			delete(formatters, "custom")
+			formattersMu.Unlock()
+		}()
+		assert.Equal(t, WebhookFormatter{}, FormatterFor("custom"))
+	})
+}
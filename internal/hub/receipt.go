@@ -0,0 +1,196 @@
+package hub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+)
+
+// DefaultWebhookMaxSkew is how far a received webhook's timestamp may be from now
+const DefaultWebhookMaxSkew = 5 * time.Minute
+
+// MaxWebhookBodyBytes caps the body of a received webhook
+const MaxWebhookBodyBytes = 1 << 20
+
+// Errors returned by VerifyWebhook for webhooks that must not be acted on
+var (
+	// ErrWebhookSignature is returned for a missing or wrong signature
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+	// ErrWebhookStale is returned for a timestamp too far from now
+	ErrWebhookStale = errors.New("webhook timestamp outside the allowed skew")
+	// ErrWebhookReplayed is returned for a delivery received before
+	ErrWebhookReplayed = errors.New("webhook delivery already received")
+)
+
+// webhookScheme describes how a provider signs the webhooks it sends
+type webhookScheme struct {
+	signatureHeader string
+	signaturePrefix string
+	// timestampHeader holds the unix time the webhook was sent, if the provider sends one
+	timestampHeader string
+	// signed returns the bytes the signature is an HMAC-SHA256 of
+	signed func(timestamp string, body []byte) []byte
+}
+
+var webhookSchemes = map[string]webhookScheme{
+	"github": {
+		signatureHeader: "X-Hub-Signature-256",
+		signaturePrefix: "sha256=",
+		signed:          func(_ string, body []byte) []byte { return body },
+	},
+	"slack": {
+		signatureHeader: "X-Slack-Signature",
+		signaturePrefix: "v0=",
+		timestampHeader: "X-Slack-Request-Timestamp",
+		signed: func(timestamp string, body []byte) []byte {
+			return append([]byte("v0:"+timestamp+":"), body...)
+		},
+	},
+}
+
+// defaultWebhookScheme is used for integration types without a scheme of their own
+var defaultWebhookScheme = webhookScheme{
+	signatureHeader: "X-Vertex-Signature",
+	signaturePrefix: "sha256=",
+	timestampHeader: "X-Vertex-Timestamp",
+	signed: func(timestamp string, body []byte) []byte {
+		return append([]byte(timestamp+"."), body...)
+	},
+}
+
+// SetWebhookMaxSkew sets how far a received webhook's timestamp may be from now
+func (s *Service) SetWebhookMaxSkew(skew time.Duration) {
+	s.webhookMu.Lock()
+	defer s.webhookMu.Unlock()
+	s.receipts.setTTL(2 * skew)
+	s.webhookMaxSkew = skew
+}
+
+// ReceiveWebhook verifies a webhook received for an integration and announces
+// it on the event bus. The signature authenticates the sender, so no user is
+// needed; a disabled integration fails with ErrIntegrationDisabled.
+func (s *Service) ReceiveWebhook(ctx context.Context, integrationID uint, header http.Header, body []byte) (*Integration, error) {
+	var integration Integration
+	err := s.db.WithContext(ctx).First(&integration, integrationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("integration %d not found", integrationID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get integration: %w", err)
+	}
+	if integration.Status == IntegrationStatusInactive {
+		return nil, fmt.Errorf("cannot receive for integration %d: %w", integration.ID, ErrIntegrationDisabled)
+	}
+	if err := s.VerifyWebhook(&integration, header, body); err != nil {
+		return nil, err
+	}
+
+	if s.events != nil {
+		s.events.Publish(ctx, core.BusEvent{
+			Topic:  core.TopicWebhookReceived,
+			UserID: integration.UserID,
+			Payload: core.WebhookReceivedEvent{
+				IntegrationID: integration.ID,
+				Type:          integration.Type,
+				Body:          body,
+			},
+		})
+	}
+	return &integration, nil
+}
+
+// VerifyWebhook checks a webhook received for an integration before it is
+// acted on. The signature must be an HMAC-SHA256 of the request with the
+// integration's "secret" config, in the provider's format. The timestamp, when
+// the provider sends one, must be within the allowed skew of now. A delivery
+// must not have been received before: it is identified by its signature, which
+// covers the timestamp, and remembered for twice the skew. Providers signing
+// no timestamp, such as GitHub, are only protected from replays that long.
+func (s *Service) VerifyWebhook(integration *Integration, header http.Header, body []byte) error {
+	secret := integration.Config["secret"]
+	if secret == "" {
+		return fmt.Errorf("integration %d has no webhook secret configured", integration.ID)
+	}
+	scheme, ok := webhookSchemes[integration.Type]
+	if !ok {
+		scheme = defaultWebhookScheme
+	}
+
+	signature := header.Get(scheme.signatureHeader)
+	timestamp := header.Get(scheme.timestampHeader)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(scheme.signed(timestamp, body))
+	expected := scheme.signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+	if signature == "" || !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return ErrWebhookSignature
+	}
+
+	s.webhookMu.RLock()
+	maxSkew := s.webhookMaxSkew
+	s.webhookMu.RUnlock()
+	now := time.Now()
+	if scheme.timestampHeader != "" {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: missing or invalid %s", ErrWebhookStale, scheme.timestampHeader)
+		}
+		skew := now.Sub(time.Unix(seconds, 0))
+		if skew > maxSkew || skew < -maxSkew {
+			return fmt.Errorf("%w: sent at %s", ErrWebhookStale, time.Unix(seconds, 0).UTC().Format(time.RFC3339))
+		}
+	}
+
+	// Delivery ID headers are not signed, so only the signature identifies a
+	// delivery that cannot be replayed under a new ID
+	if !s.receipts.add(fmt.Sprintf("%d:%s", integration.ID, strings.ToLower(signature)), now) {
+		return ErrWebhookReplayed
+	}
+	return nil
+}
+
+// nonceCache remembers the deliveries received until they expire. Entries
+// share one TTL, so they expire in the order they were added.
+type nonceCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	seen  map[string]time.Time
+	order []string
+}
+
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{ttl: ttl, seen: make(map[string]time.Time)}
+}
+
+func (c *nonceCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// add records a nonce, reporting false if it was already recorded and has not expired
+func (c *nonceCache) add(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.order) > 0 && !now.Before(c.seen[c.order[0]]) {
+		delete(c.seen, c.order[0])
+		c.order = c.order[1:]
+	}
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	c.seen[nonce] = now.Add(c.ttl)
+	c.order = append(c.order, nonce)
+	return true
+}
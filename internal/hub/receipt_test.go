@@ -0,0 +1,150 @@
+package hub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedWebhook returns the headers of a webhook signed like Vertex's default scheme
+func signedWebhook(secret, delivery string, sentAt time.Time, body []byte) http.Header {
+	timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+	header := http.Header{}
+	header.Set("X-Vertex-Timestamp", timestamp)
+	header.Set("X-Vertex-Delivery", delivery)
+	header.Set("X-Vertex-Signature", "sha256="+sign(secret, append([]byte(timestamp+"."), body...)))
+	return header
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"event":"push"}`)
+	integration := &Integration{ID: 1, Type: "webhook", Config: map[string]string{"secret": "s3cret"}}
+
+	t.Run("should accept a valid webhook once", func(t *testing.T) {
+		service := NewService()
+		header := signedWebhook("s3cret", "delivery-1", time.Now(), body)
+
+		require.NoError(t, service.VerifyWebhook(integration, header, body))
+		assert.ErrorIs(t, service.VerifyWebhook(integration, header, body), ErrWebhookReplayed)
+
+		// The same delivery is only a replay for the same integration
+		other := &Integration{ID: 2, Type: "webhook", Config: integration.Config}
+		assert.NoError(t, service.VerifyWebhook(other, header, body))
+		assert.NoError(t, service.VerifyWebhook(integration, signedWebhook("s3cret", "delivery-2", time.Now().Add(time.Second), body), body))
+	})
+
+	t.Run("should not accept a replay under a new delivery ID", func(t *testing.T) {
+		service := NewService()
+		header := signedWebhook("s3cret", "delivery-1", time.Now(), body)
+		require.NoError(t, service.VerifyWebhook(integration, header, body))
+
+		// The delivery header is not signed, so changing it does not make a new delivery
+		header.Set("X-Vertex-Delivery", "delivery-2")
+		assert.ErrorIs(t, service.VerifyWebhook(integration, header, body), ErrWebhookReplayed)
+	})
+
+	t.Run("should reject stale or future timestamps", func(t *testing.T) {
+		service := NewService()
+		service.SetWebhookMaxSkew(time.Minute)
+
+		stale := signedWebhook("s3cret", "delivery-1", time.Now().Add(-2*time.Minute), body)
+		assert.ErrorIs(t, service.VerifyWebhook(integration, stale, body), ErrWebhookStale)
+		future := signedWebhook("s3cret", "delivery-2", time.Now().Add(2*time.Minute), body)
+		assert.ErrorIs(t, service.VerifyWebhook(integration, future, body), ErrWebhookStale)
+
+		missing := signedWebhook("s3cret", "delivery-3", time.Now(), body)
+		missing.Del("X-Vertex-Timestamp")
+		assert.Error(t, service.VerifyWebhook(integration, missing, body))
+	})
+
+	t.Run("should reject invalid signatures", func(t *testing.T) {
+		service := NewService()
+		header := signedWebhook("wrong", "delivery-1", time.Now(), body)
+		assert.ErrorIs(t, service.VerifyWebhook(integration, header, body), ErrWebhookSignature)
+
+		header = signedWebhook("s3cret", "delivery-1", time.Now(), body)
+		assert.ErrorIs(t, service.VerifyWebhook(integration, header, []byte(`{"event":"tampered"}`)), ErrWebhookSignature)
+		// A rejected request does not use up its delivery ID
+		assert.NoError(t, service.VerifyWebhook(integration, header, body))
+
+		assert.ErrorContains(t, service.VerifyWebhook(&Integration{ID: 3, Type: "webhook"}, header, body), "no webhook secret")
+	})
+
+	t.Run("should use the provider's headers", func(t *testing.T) {
+		service := NewService()
+
+		github := &Integration{ID: 4, Type: "github", Config: map[string]string{"secret": "gh"}}
+		header := http.Header{}
+		header.Set("X-GitHub-Delivery", "72d3162e")
+		header.Set("X-Hub-Signature-256", "sha256="+sign("gh", body))
+		require.NoError(t, service.VerifyWebhook(github, header, body))
+		header.Set("X-GitHub-Delivery", "0b989ba4")
+		assert.ErrorIs(t, service.VerifyWebhook(github, header, body), ErrWebhookReplayed)
+
+		slack := &Integration{ID: 5, Type: "slack", Config: map[string]string{"secret": "sl"}}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		header = http.Header{}
+		header.Set("X-Slack-Request-Timestamp", timestamp)
+		header.Set("X-Slack-Signature", "v0="+sign("sl", append([]byte("v0:"+timestamp+":"), body...)))
+		require.NoError(t, service.VerifyWebhook(slack, header, body))
+		assert.ErrorIs(t, service.VerifyWebhook(slack, header, body), ErrWebhookReplayed)
+	})
+}
+
+func TestNonceCache(t *testing.T) {
+	cache := newNonceCache(time.Minute)
+	now := time.Now()
+
+	assert.True(t, cache.add("a", now))
+	assert.True(t, cache.add("b", now.Add(30*time.Second)))
+	assert.False(t, cache.add("a", now.Add(59*time.Second)))
+
+	// Expired nonces are forgotten
+	assert.True(t, cache.add("a", now.Add(time.Minute)))
+	assert.False(t, cache.add("b", now.Add(time.Minute)))
+	assert.Len(t, cache.seen, 2)
+}
+
+func TestReceiveWebhook(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"event":"push"}`)
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+	integration := &Integration{UserID: "user1", Name: "Inbound", Type: "webhook", Config: map[string]string{"secret": "s3cret"}}
+	require.NoError(t, service.CreateIntegration(ctx, integration))
+	bus := core.NewEventBus()
+	service.SetEventBus(bus)
+	var received []core.BusEvent
+	bus.Subscribe(core.TopicWebhookReceived, func(ctx context.Context, event core.BusEvent) { received = append(received, event) })
+
+	header := signedWebhook("s3cret", "delivery-1", time.Now(), body)
+	_, err := service.ReceiveWebhook(ctx, integration.ID, header, body)
+	require.NoError(t, err)
+	_, err = service.ReceiveWebhook(ctx, integration.ID, header, body)
+	assert.ErrorIs(t, err, ErrWebhookReplayed)
+	require.Len(t, received, 1)
+	assert.Equal(t, "user1", received[0].UserID)
+	assert.Equal(t, core.WebhookReceivedEvent{IntegrationID: integration.ID, Type: "webhook", Body: body}, received[0].Payload)
+
+	_, err = service.ReceiveWebhook(ctx, integration.ID+1, header, body)
+	assert.ErrorContains(t, err, "not found")
+	_, err = service.DisableIntegration(ctx, "user1", integration.ID)
+	require.NoError(t, err)
+	_, err = service.ReceiveWebhook(ctx, integration.ID, signedWebhook("s3cret", "delivery-2", time.Now().Add(time.Second), body), body)
+	assert.ErrorIs(t, err, ErrIntegrationDisabled)
+}
@@ -4,24 +4,52 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	db *gorm.DB
+	db               *gorm.DB
+	cache            *core.Cache[string, []*Integration]
+	httpClient       *http.Client
+	dispatchAttempts int
+	dispatchBackoff  time.Duration
+	digests          *digestBatcher
+	events           *core.EventBus
+	webhookMu        sync.RWMutex
+	webhookMaxSkew   time.Duration
+	receipts         *nonceCache
 }
 
 func NewService() *Service {
-	return &Service{}
+	return &Service{
+		httpClient:       &http.Client{Timeout: DefaultDeliveryTimeout},
+		dispatchAttempts: DefaultDispatchAttempts,
+		dispatchBackoff:  DefaultDispatchBackoff,
+		digests:          newDigestBatcher(),
+		webhookMaxSkew:   DefaultWebhookMaxSkew,
+		receipts:         newNonceCache(2 * DefaultWebhookMaxSkew),
+	}
 }
 
 func (s *Service) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return database.CheckConnection(ctx, s.db)
+}
+
+func (s *Service) EnableCache(capacity int, ttl time.Duration) {
+	s.cache = core.NewCache[string, []*Integration](capacity, ttl)
+}
+
 func (s *Service) CreateIntegration(ctx context.Context, integration *Integration) error {
 	if err := s.validateIntegration(integration); err != nil {
 		return err
@@ -35,19 +63,95 @@ func (s *Service) CreateIntegration(ctx context.Context, integration *Integratio
 		return fmt.Errorf("failed to create integration: %w", err)
 	}
 
+	s.invalidateIntegrations(integration.UserID)
+
 	return nil
 }
 
 func (s *Service) GetIntegrations(ctx context.Context, userID string) ([]*Integration, error) {
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(userID); ok {
+			return cloneIntegrations(cached), nil
+		}
+	}
+
 	var integrations []*Integration
 	err := s.db.Where("user_id = ?", userID).Find(&integrations).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to get integrations: %w", err)
 	}
 
+	if s.cache != nil {
+		s.cache.Set(userID, cloneIntegrations(integrations))
+	}
+
 	return integrations, nil
 }
 
+// GetIntegrationsPage returns one page of the user's integrations, reading only
+// that page from the store rather than the cached full list
+func (s *Service) GetIntegrationsPage(ctx context.Context, userID string, request core.PageRequest) (*core.Page[*Integration], error) {
+	page, err := database.Paginate[*Integration](s.db.WithContext(ctx).Model(&Integration{}).Where("user_id = ?", userID).Order("id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get integrations: %w", err)
+	}
+	return page, nil
+}
+
+// Count returns how many integrations a user has, optionally broken down by status
+func (s *Service) Count(ctx context.Context, userID string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	query := s.db.WithContext(ctx).Model(&Integration{}).Where("user_id = ?", userID)
+	return database.CountByStatus[IntegrationStatus](query, core.ResourceTypeIntegration, filters...)
+}
+
+func (s *Service) Search(ctx context.Context, userID, query string, limit int) ([]*core.SearchHit, error) {
+	pattern := core.LikePattern(query)
+	var integrations []*Integration
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Where(`LOWER(name) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\' OR LOWER(type) LIKE ? ESCAPE '\'`, pattern, pattern, pattern).
+		Limit(limit).
+		Find(&integrations).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search integrations: %w", err)
+	}
+
+	hits := make([]*core.SearchHit, 0, len(integrations))
+	for _, integration := range integrations {
+		score := core.MatchScore(query, integration.Name)
+		if descriptionScore := 0.6 * core.MatchScore(query, integration.Description); descriptionScore > score {
+			score = descriptionScore
+		}
+		if typeScore := 0.4 * core.MatchScore(query, integration.Type); typeScore > score {
+			score = typeScore
+		}
+		hits = append(hits, &core.SearchHit{
+			ResourceType: core.ResourceTypeIntegration,
+			ID:           fmt.Sprintf("%d", integration.ID),
+			Title:        integration.Name,
+			Description:  integration.Description,
+			Score:        score,
+		})
+	}
+
+	return hits, nil
+}
+
+func (s *Service) invalidateIntegrations(userID string) {
+	if s.cache != nil {
+		s.cache.Delete(userID)
+	}
+}
+
+func cloneIntegrations(integrations []*Integration) []*Integration {
+	result := make([]*Integration, len(integrations))
+	for i, integration := range integrations {
+		copied := *integration
+		result[i] = &copied
+	}
+	return result
+}
+
 func (s *Service) validateIntegration(integration *Integration) error {
 	if strings.TrimSpace(integration.Name) == "" {
 		return errors.New("name is required")
@@ -62,15 +166,20 @@ func (s *Service) validateIntegration(integration *Integration) error {
 }
 
 type Integration struct {
-	ID          uint               `json:"id" gorm:"primaryKey"`
-	Name        string             `json:"name" gorm:"not null"`
-	Description string             `json:"description"`
-	UserID      string             `json:"user_id" gorm:"index;not null"`
-	Type        string             `json:"type" gorm:"not null"`
-	Status      IntegrationStatus  `json:"status" gorm:"default:0"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt     `json:"-" gorm:"index"`
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	Name        string            `json:"name" gorm:"not null"`
+	Description string            `json:"description"`
+	UserID      string            `json:"user_id" gorm:"index;not null"`
+	Type        string            `json:"type" gorm:"not null"`
+	Status      IntegrationStatus `json:"status" gorm:"default:0"`
+	Config      map[string]string `json:"config,omitempty" gorm:"serializer:json"`
+	// DigestWindow and DigestMaxEvents batch notifications into a single digest
+	// flushed after the window elapses or once the count is reached
+	DigestWindow    time.Duration  `json:"digest_window,omitempty" gorm:"default:0"`
+	DigestMaxEvents int            `json:"digest_max_events,omitempty" gorm:"default:0"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (Integration) TableName() string {
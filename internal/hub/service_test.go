@@ -3,7 +3,9 @@ package hub
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -14,7 +16,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
-	err = db.AutoMigrate(&Integration{})
+	err = db.AutoMigrate(&Integration{}, &WebhookDelivery{})
 	require.NoError(t, err)
 
 	return db
@@ -63,3 +65,53 @@ func TestIntegrationOperations(t *testing.T) {
 		assert.Len(t, retrieved, 2)
 	})
 }
+
+func TestIntegrationCache(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	service.EnableCache(10, time.Minute)
+	ctx := context.Background()
+
+	queries := 0
+	err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries++
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, service.CreateIntegration(ctx, &Integration{Name: "Slack", UserID: "user1", Type: "slack"}))
+
+	t.Run("should serve repeated reads from the cache", func(t *testing.T) {
+		_, err := service.GetIntegrations(ctx, "user1")
+		require.NoError(t, err)
+		afterMiss := queries
+
+		retrieved, err := service.GetIntegrations(ctx, "user1")
+		require.NoError(t, err)
+		assert.Len(t, retrieved, 1)
+		assert.Equal(t, afterMiss, queries)
+	})
+
+	t.Run("should invalidate when an integration is created", func(t *testing.T) {
+		require.NoError(t, service.CreateIntegration(ctx, &Integration{Name: "JIRA", UserID: "user1", Type: "jira"}))
+
+		retrieved, err := service.GetIntegrations(ctx, "user1")
+		require.NoError(t, err)
+		assert.Len(t, retrieved, 2)
+	})
+}
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+
+	require.NoError(t, service.CreateIntegration(ctx, &Integration{UserID: "user1", Name: "alerts", Type: "slack"}))
+	require.NoError(t, service.CreateIntegration(ctx, &Integration{UserID: "user1", Name: "pager", Type: "webhook", Status: IntegrationStatusError}))
+	require.NoError(t, service.CreateIntegration(ctx, &Integration{UserID: "user2", Name: "alerts", Type: "slack"}))
+
+	count, err := service.Count(ctx, "user1", core.CountFilter{GroupByStatus: true})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceTypeIntegration, count.ResourceType)
+	assert.Equal(t, map[string]int64{"active": 1, "error": 1}, count.ByStatus, "new integrations are active")
+}
@@ -0,0 +1,76 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+)
+
+// ErrIntegrationDisabled is returned when dispatching to a disabled
+// integration. Retrying will not help until the integration is enabled again.
+var ErrIntegrationDisabled = errors.New("integration is disabled")
+
+// SetEventBus sets the bus integration status changes are published on
+func (s *Service) SetEventBus(bus *core.EventBus) {
+	s.events = bus
+}
+
+// DisableIntegration stops an integration from receiving events. Buffered
+// digest events are discarded and dependents are told through the event bus
+// so they can pause or fall back instead of failing at dispatch time.
+func (s *Service) DisableIntegration(ctx context.Context, userID string, integrationID uint) (*Integration, error) {
+	return s.setIntegrationStatus(ctx, userID, integrationID, IntegrationStatusInactive)
+}
+
+// EnableIntegration lets a disabled integration receive events again
+func (s *Service) EnableIntegration(ctx context.Context, userID string, integrationID uint) (*Integration, error) {
+	return s.setIntegrationStatus(ctx, userID, integrationID, IntegrationStatusActive)
+}
+
+func (s *Service) setIntegrationStatus(ctx context.Context, userID string, integrationID uint, status IntegrationStatus) (*Integration, error) {
+	integration, err := s.GetIntegration(ctx, userID, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := database.UpdateChanged(s.db.WithContext(ctx), integration, map[string]interface{}{"status": status})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update integration status: %w", err)
+	}
+	if !changed {
+		return integration, nil
+	}
+	s.invalidateIntegrations(userID)
+
+	topic := core.TopicIntegrationEnabled
+	if status == IntegrationStatusInactive {
+		topic = core.TopicIntegrationDisabled
+		if dropped := s.digests.discard(integrationID); dropped > 0 {
+			log.Printf("⚠️  Discarded %d buffered event(s) for disabled integration %d", dropped, integrationID)
+		}
+	}
+	if s.events != nil {
+		s.events.Publish(ctx, core.BusEvent{
+			Topic:  topic,
+			UserID: userID,
+			Payload: core.IntegrationStatusEvent{
+				IntegrationID: integration.ID,
+				Name:          integration.Name,
+				Type:          integration.Type,
+			},
+		})
+	}
+
+	return integration, nil
+}
+
+// checkEnabled returns ErrIntegrationDisabled for a disabled integration
+func checkEnabled(integration *Integration) error {
+	if integration.Status == IntegrationStatusInactive {
+		return fmt.Errorf("cannot dispatch to integration %d: %w", integration.ID, ErrIntegrationDisabled)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisableIntegration(t *testing.T) {
+	ctx := context.Background()
+	event := &Event{Type: "deploy.finished", Title: "Deployed api"}
+
+	t.Run("should refuse to dispatch without attempting delivery", func(t *testing.T) {
+		var calls int32
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+		})
+
+		disabled, err := service.DisableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		assert.Equal(t, IntegrationStatusInactive, disabled.Status)
+
+		delivery, err := service.Dispatch(ctx, "user1", integration.ID, event)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrIntegrationDisabled))
+		assert.Nil(t, delivery)
+		assert.Zero(t, atomic.LoadInt32(&calls))
+
+		err = service.Notify(ctx, "user1", integration.ID, event)
+		assert.True(t, errors.Is(err, ErrIntegrationDisabled))
+
+		deliveries, err := service.ListDeliveries(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("should dispatch again once re-enabled", func(t *testing.T) {
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {})
+
+		_, err := service.DisableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		enabled, err := service.EnableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		assert.Equal(t, IntegrationStatusActive, enabled.Status)
+
+		delivery, err := service.Dispatch(ctx, "user1", integration.ID, event)
+		require.NoError(t, err)
+		assert.True(t, delivery.Success)
+	})
+
+	t.Run("should only bump UpdatedAt when the status changes", func(t *testing.T) {
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {})
+		stamp := time.Now().Add(-time.Hour).Round(time.Second)
+		require.NoError(t, service.db.Model(&Integration{}).Where("id = ?", integration.ID).UpdateColumn("updated_at", stamp).Error)
+		updatedAt := func() time.Time {
+			var stored Integration
+			require.NoError(t, service.db.First(&stored, integration.ID).Error)
+			return stored.UpdatedAt
+		}
+
+		_, err := service.EnableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		assert.True(t, stamp.Equal(updatedAt()), "enabling an active integration changes nothing")
+
+		disabled, err := service.DisableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		assert.True(t, updatedAt().After(stamp))
+		assert.True(t, disabled.UpdatedAt.Equal(updatedAt()))
+	})
+
+	t.Run("should discard buffered digest events", func(t *testing.T) {
+		service, integration, recorder := setupDigest(t, time.Hour, 0)
+
+		require.NoError(t, service.Notify(ctx, "user1", integration.ID, event))
+		_, err := service.DisableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, service.Close(ctx))
+		assert.Equal(t, 0, recorder.count())
+	})
+
+	t.Run("should publish status changes to dependents", func(t *testing.T) {
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {})
+		bus := core.NewEventBus()
+		service.SetEventBus(bus)
+
+		var received []core.BusEvent
+		record := func(ctx context.Context, event core.BusEvent) { received = append(received, event) }
+		bus.Subscribe(core.TopicIntegrationDisabled, record)
+		bus.Subscribe(core.TopicIntegrationEnabled, record)
+
+		_, err := service.DisableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		// Disabling twice is a no-op
+		_, err = service.DisableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+		_, err = service.EnableIntegration(ctx, "user1", integration.ID)
+		require.NoError(t, err)
+
+		require.Len(t, received, 2)
+		assert.Equal(t, core.TopicIntegrationDisabled, received[0].Topic)
+		assert.Equal(t, "user1", received[0].UserID)
+		assert.Equal(t, core.IntegrationStatusEvent{IntegrationID: integration.ID, Name: "Ops hook", Type: "webhook"}, received[0].Payload)
+		assert.Equal(t, core.TopicIntegrationEnabled, received[1].Topic)
+	})
+
+	t.Run("should not change another user's integration", func(t *testing.T) {
+		service, integration := setupDispatch(t, func(w http.ResponseWriter, r *http.Request) {})
+
+		_, err := service.DisableIntegration(ctx, "user2", integration.ID)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+}
@@ -0,0 +1,124 @@
+package insight
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TimeRange is the half-open interval (From, To]
+type TimeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+func (r TimeRange) validate() error {
+	if !r.To.After(r.From) {
+		return fmt.Errorf("invalid range: to must be after from")
+	}
+	return nil
+}
+
+type ComparisonValue struct {
+	Name          string   `json:"name"`
+	Current       int64    `json:"current"`
+	Previous      int64    `json:"previous"`
+	Delta         int64    `json:"delta"`
+	PercentChange *float64 `json:"percent_change"`
+}
+
+type ReportComparison struct {
+	ReportID uint              `json:"report_id"`
+	Current  TimeRange         `json:"current"`
+	Previous TimeRange         `json:"previous"`
+	Total    ComparisonValue   `json:"total"`
+	Values   []ComparisonValue `json:"values"`
+}
+
+// PeriodRanges returns the calendar period containing now (up to now) and the
+// whole period before it, e.g. this month so far vs last month
+func PeriodRanges(period string, now time.Time) (TimeRange, TimeRange, error) {
+	now = now.UTC()
+	var start, previousStart time.Time
+	switch period {
+	case "day":
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		previousStart = start.AddDate(0, 0, -1)
+	case "week":
+		weekday := (int(now.Weekday()) + 6) % 7
+		start = time.Date(now.Year(), now.Month(), now.Day()-weekday, 0, 0, 0, 0, time.UTC)
+		previousStart = start.AddDate(0, 0, -7)
+	case "month":
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		previousStart = start.AddDate(0, -1, 0)
+	default:
+		return TimeRange{}, TimeRange{}, fmt.Errorf("unsupported period '%s'", period)
+	}
+
+	return TimeRange{From: start, To: now}, TimeRange{From: previousStart, To: start}, nil
+}
+
+func (s *Service) CompareReport(ctx context.Context, userID string, reportID uint, current, previous TimeRange) (*ReportComparison, error) {
+	if err := current.validate(); err != nil {
+		return nil, err
+	}
+	if err := previous.validate(); err != nil {
+		return nil, err
+	}
+
+	report, source, err := s.reportSource(ctx, userID, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentCounts, err := s.runSource(ctx, report, source, current.From, current.To, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate report: %w", err)
+	}
+	previousCounts, err := s.runSource(ctx, report, source, previous.From, previous.To, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate report: %w", err)
+	}
+
+	return compareCounts(report.ID, current, previous, currentCounts, previousCounts), nil
+}
+
+func compareCounts(reportID uint, current, previous TimeRange, currentCounts, previousCounts map[string]int64) *ReportComparison {
+	names := make([]string, 0, len(currentCounts)+len(previousCounts))
+	for name := range currentCounts {
+		names = append(names, name)
+	}
+	for name := range previousCounts {
+		if _, ok := currentCounts[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	comparison := &ReportComparison{
+		ReportID: reportID,
+		Current:  current,
+		Previous: previous,
+		Values:   make([]ComparisonValue, 0, len(names)),
+	}
+	var currentTotal, previousTotal int64
+	for _, name := range names {
+		comparison.Values = append(comparison.Values, compareValue(name, currentCounts[name], previousCounts[name]))
+		currentTotal += currentCounts[name]
+		previousTotal += previousCounts[name]
+	}
+	comparison.Total = compareValue("total", currentTotal, previousTotal)
+
+	return comparison
+}
+
+// compareValue leaves PercentChange nil when there is no previous value to compare against
+func compareValue(name string, current, previous int64) ComparisonValue {
+	value := ComparisonValue{Name: name, Current: current, Previous: previous, Delta: current - previous}
+	if previous != 0 {
+		percent := float64(value.Delta) / float64(previous) * 100
+		value.PercentChange = &percent
+	}
+	return value
+}
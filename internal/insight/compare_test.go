@@ -0,0 +1,91 @@
+package insight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareReport(t *testing.T) {
+	ctx := context.Background()
+	service, db, report, clock := setupReportGeneration(t)
+
+	current, previous, err := PeriodRanges("month", *clock)
+	require.NoError(t, err)
+
+	// February: 4 reads, 2 deletes. March so far: 6 reads, 1 create.
+	for i := 0; i < 4; i++ {
+		addAuditEntry(t, db, "user1", "READ", previous.From.Add(time.Duration(i+1)*time.Hour))
+	}
+	addAuditEntry(t, db, "user1", "DELETE", previous.From.Add(time.Hour))
+	addAuditEntry(t, db, "user1", "DELETE", previous.To)
+	for i := 0; i < 6; i++ {
+		addAuditEntry(t, db, "user1", "READ", current.From.Add(time.Duration(i+1)*time.Minute))
+	}
+	addAuditEntry(t, db, "user1", "CREATE", current.To)
+	addAuditEntry(t, db, "user2", "READ", current.From.Add(time.Minute))
+
+	comparison, err := service.CompareReport(ctx, "user1", report.ID, current, previous)
+	require.NoError(t, err)
+
+	t.Run("should compute totals with delta and percentage change", func(t *testing.T) {
+		assert.Equal(t, int64(7), comparison.Total.Current)
+		assert.Equal(t, int64(6), comparison.Total.Previous)
+		assert.Equal(t, int64(1), comparison.Total.Delta)
+		require.NotNil(t, comparison.Total.PercentChange)
+		assert.InDelta(t, 16.667, *comparison.Total.PercentChange, 0.001)
+	})
+
+	t.Run("should compare each value side by side", func(t *testing.T) {
+		require.Len(t, comparison.Values, 3)
+
+		create := comparison.Values[0]
+		assert.Equal(t, "CREATE", create.Name)
+		assert.Equal(t, int64(1), create.Delta)
+		assert.Nil(t, create.PercentChange)
+
+		remove := comparison.Values[1]
+		assert.Equal(t, "DELETE", remove.Name)
+		assert.Equal(t, int64(-2), remove.Delta)
+		require.NotNil(t, remove.PercentChange)
+		assert.Equal(t, -100.0, *remove.PercentChange)
+
+		read := comparison.Values[2]
+		assert.Equal(t, "READ", read.Name)
+		assert.Equal(t, int64(6), read.Current)
+		assert.Equal(t, int64(4), read.Previous)
+		require.NotNil(t, read.PercentChange)
+		assert.Equal(t, 50.0, *read.PercentChange)
+	})
+
+	t.Run("should reject empty ranges", func(t *testing.T) {
+		_, err := service.CompareReport(ctx, "user1", report.ID, TimeRange{From: *clock, To: *clock}, previous)
+		assert.Error(t, err)
+	})
+}
+
+func TestPeriodRanges(t *testing.T) {
+	now := time.Date(2024, 3, 13, 15, 30, 0, 0, time.UTC) // a Wednesday
+
+	t.Run("should compare this month with last month", func(t *testing.T) {
+		current, previous, err := PeriodRanges("month", now)
+		require.NoError(t, err)
+		assert.Equal(t, TimeRange{From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), To: now}, current)
+		assert.Equal(t, TimeRange{From: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}, previous)
+	})
+
+	t.Run("should start weeks on Monday", func(t *testing.T) {
+		current, previous, err := PeriodRanges("week", now)
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), current.From)
+		assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), previous.From)
+	})
+
+	t.Run("should reject unknown periods", func(t *testing.T) {
+		_, _, err := PeriodRanges("fortnight", now)
+		assert.Error(t, err)
+	})
+}
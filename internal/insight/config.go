@@ -0,0 +1,43 @@
+package insight
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config configures an insight Service
+type Config struct {
+	// ReportCacheTTL is how long generated report data is served from cache
+	ReportCacheTTL time.Duration `json:"report_cache_ttl" yaml:"report_cache_ttl"`
+	// QueryCacheTTL is how long report query results are reused until the
+	// data they count changes; zero disables the query cache
+	QueryCacheTTL time.Duration `json:"query_cache_ttl" yaml:"query_cache_ttl"`
+}
+
+// DefaultConfig returns the settings NewService uses
+func DefaultConfig() Config {
+	return Config{ReportCacheTTL: DefaultReportCacheTTL, QueryCacheTTL: DefaultQueryCacheTTL}
+}
+
+// Validate checks neither cache TTL is negative
+func (c Config) Validate() error {
+	if c.ReportCacheTTL < 0 {
+		return errors.New("report cache TTL must not be negative")
+	}
+	if c.QueryCacheTTL < 0 {
+		return errors.New("query cache TTL must not be negative")
+	}
+	return nil
+}
+
+// NewServiceWithConfig validates cfg and creates an insight service using it
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid insight config: %w", err)
+	}
+	s := NewService()
+	s.SetReportCacheTTL(cfg.ReportCacheTTL)
+	s.SetQueryCacheTTL(cfg.QueryCacheTTL)
+	return s, nil
+}
@@ -0,0 +1,28 @@
+package insight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	service, err := NewServiceWithConfig(Config{ReportCacheTTL: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, service.cacheTTL)
+	assert.Nil(t, service.queries, "a zero query cache TTL disables the query cache")
+
+	service, err = NewServiceWithConfig(DefaultConfig())
+	require.NoError(t, err)
+	assert.NotNil(t, service.queries)
+
+	config := Config{ReportCacheTTL: -time.Minute}
+	assert.ErrorContains(t, config.Validate(), "report cache TTL must not be negative")
+	_, err = NewServiceWithConfig(config)
+	assert.ErrorContains(t, err, "invalid insight config")
+
+	config = Config{QueryCacheTTL: -time.Minute}
+	assert.ErrorContains(t, config.Validate(), "query cache TTL must not be negative")
+}
@@ -0,0 +1,233 @@
+package insight
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/database"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultReportCacheTTL = 5 * time.Minute
+	// DefaultReportCacheSize is how many reports' generated data is kept
+	DefaultReportCacheSize = 1000
+)
+
+// ReportData holds the counts a report produced over (From, To]
+type ReportData struct {
+	ReportID    uint             `json:"report_id"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Total       int64            `json:"total"`
+	Counts      map[string]int64 `json:"counts"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Cached      bool             `json:"cached"`
+	Incremental bool             `json:"incremental"`
+}
+
+// reportSource counts the rows for a report type in (from, to]. Counts must be
+// additive so consecutive ranges can be merged for incremental refreshes.
+type reportSource func(ctx context.Context, db *gorm.DB, userID string, params map[string]string, from, to time.Time) (map[string]int64, error)
+
+var reportSources = map[string]reportSource{
+	"audit": auditReportSource,
+}
+
+type auditEntry struct {
+	ID        uint
+	UserID    string
+	SecretKey string
+	Action    string
+	CreatedAt time.Time
+}
+
+func (auditEntry) TableName() string {
+	return "audit_logs"
+}
+
+var auditGroupColumns = map[string]string{
+	"":           "action",
+	"action":     "action",
+	"secret_key": "secret_key",
+}
+
+func auditReportSource(ctx context.Context, db *gorm.DB, userID string, params map[string]string, from, to time.Time) (map[string]int64, error) {
+	column, ok := auditGroupColumns[params["group_by"]]
+	if !ok {
+		return nil, fmt.Errorf("unsupported group_by '%s'", params["group_by"])
+	}
+
+	var rows []struct {
+		Name  string
+		Count int64
+	}
+	err := db.WithContext(ctx).Model(&auditEntry{}).
+		Select(column+" AS name, COUNT(*) AS count").
+		Where("user_id = ? AND created_at > ? AND created_at <= ?", userID, from, to).
+		Group(column).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Name] = row.Count
+	}
+	return counts, nil
+}
+
+func (d *ReportData) clone() *ReportData {
+	copied := *d
+	copied.Counts = make(map[string]int64, len(d.Counts))
+	for name, count := range d.Counts {
+		copied.Counts[name] = count
+	}
+	return &copied
+}
+
+func (s *Service) SetReportCacheTTL(ttl time.Duration) {
+	s.cacheTTL = ttl
+}
+
+// GenerateReport returns cached data while it is within the cache TTL. Stale data
+// is refreshed incrementally from where the previous generation stopped, and force
+// recomputes the whole range from the database.
+func (s *Service) GenerateReport(ctx context.Context, userID string, reportID uint, force bool) (*ReportData, error) {
+	report, source, err := s.reportSource(ctx, userID, reportID)
+	if err != nil {
+		return nil, err
+	}
+	from, err := reportStart(report.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := reportDataKey(report)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	var cached *ReportData
+	if !force {
+		if entry, ok := s.cache.Get(key); ok {
+			cached = entry.clone()
+		}
+	}
+	if cached != nil && now.Sub(cached.GeneratedAt) < s.cacheTTL {
+		cached.Cached = true
+		return cached, nil
+	}
+
+	data := &ReportData{ReportID: report.ID, From: from, Counts: make(map[string]int64)}
+	rangeStart := from
+	if cached != nil {
+		data.Counts = cached.Counts
+		data.Total = cached.Total
+		data.Incremental = true
+		rangeStart = cached.To
+	}
+
+	// Points newer than the last whole QueryRangeStep are left to the next
+	// generation, which resumes from data.To
+	to := now.Truncate(QueryRangeStep)
+	if to.Before(rangeStart) {
+		to = rangeStart
+	}
+	s.setReportStatus(ctx, report, ReportStatusGenerating, nil)
+	counts, err := s.runSource(ctx, report, source, rangeStart, to, force)
+	if err != nil {
+		s.setReportStatus(ctx, report, ReportStatusFailed, nil)
+		return nil, fmt.Errorf("failed to generate report: %w", err)
+	}
+	for name, count := range counts {
+		data.Counts[name] += count
+		data.Total += count
+	}
+	data.To = to
+	data.GeneratedAt = now
+	s.cache.Set(key, data.clone())
+
+	s.setReportStatus(ctx, report, ReportStatusCompleted, &now)
+
+	return data, nil
+}
+
+func (s *Service) reportSource(ctx context.Context, userID string, reportID uint) (*Report, reportSource, error) {
+	report, err := s.GetReport(ctx, userID, reportID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	source, ok := reportSources[report.Type]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported report type '%s'", report.Type)
+	}
+	return report, source, nil
+}
+
+// setReportStatus records a report's status, and when it last ran if lastRun
+// is set. A failure to record it does not fail the report.
+func (s *Service) setReportStatus(ctx context.Context, report *Report, status ReportStatus, lastRun *time.Time) {
+	updates := map[string]interface{}{"status": status}
+	if lastRun != nil {
+		updates["last_run"] = lastRun
+	}
+	if _, err := database.UpdateChanged(s.db.WithContext(ctx), report, updates); err != nil {
+		log.Printf("⚠️  Failed to record the status of report %d: %v", report.ID, err)
+		report.Status = status
+		if lastRun != nil {
+			report.LastRun = lastRun
+		}
+	}
+}
+
+func reportStart(params map[string]string) (time.Time, error) {
+	value := params["from"]
+	if value == "" {
+		return time.Time{}, nil
+	}
+	from, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid from parameter: %w", err)
+	}
+	return from.UTC(), nil
+}
+
+// reportDataKey identifies a report's generated data. It includes the
+// parameters so that updating them starts a new generation.
+func reportDataKey(report *Report) (string, error) {
+	params, err := reportCacheKey(report)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d|%s", report.ID, params), nil
+}
+
+func reportCacheKey(report *Report) (string, error) {
+	params := make([]string, 0, len(report.Parameters))
+	for name, value := range report.Parameters {
+		params = append(params, name+"="+value)
+	}
+	sort.Strings(params)
+
+	payload, err := json.Marshal(struct {
+		UserID string   `json:"user_id"`
+		Type   string   `json:"type"`
+		Params []string `json:"params"`
+	}{report.UserID, report.Type, params})
+	if err != nil {
+		return "", fmt.Errorf("failed to build cache key: %w", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,134 @@
+package insight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupReportGeneration(t *testing.T) (*Service, *gorm.DB, *Report, *time.Time) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&auditEntry{}))
+
+	clock := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := NewService()
+	service.SetDB(db)
+	service.now = func() time.Time { return clock }
+
+	report := &Report{Name: "Secret activity", UserID: "user1", Type: "audit"}
+	require.NoError(t, service.CreateReport(context.Background(), report))
+	return service, db, report, &clock
+}
+
+func addAuditEntry(t *testing.T, db *gorm.DB, userID, action string, at time.Time) {
+	require.NoError(t, db.Create(&auditEntry{UserID: userID, SecretKey: "db-password", Action: action, CreatedAt: at}).Error)
+}
+
+func TestReportCache(t *testing.T) {
+	ctx := context.Background()
+	service, db, report, clock := setupReportGeneration(t)
+	addAuditEntry(t, db, "user1", "READ", clock.Add(-time.Hour))
+	addAuditEntry(t, db, "user2", "READ", clock.Add(-time.Hour))
+
+	t.Run("should compute the report on a cache miss", func(t *testing.T) {
+		data, err := service.GenerateReport(ctx, "user1", report.ID, false)
+		require.NoError(t, err)
+		assert.False(t, data.Cached)
+		assert.Equal(t, int64(1), data.Total)
+
+		stored, err := service.GetReport(ctx, "user1", report.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ReportStatusCompleted, stored.Status)
+		require.NotNil(t, stored.LastRun)
+	})
+
+	t.Run("should serve cached data within the TTL", func(t *testing.T) {
+		addAuditEntry(t, db, "user1", "UPDATE", clock.Add(-time.Minute))
+
+		data, err := service.GenerateReport(ctx, "user1", report.ID, false)
+		require.NoError(t, err)
+		assert.True(t, data.Cached)
+		assert.Equal(t, int64(1), data.Total)
+	})
+
+	t.Run("should bypass the cache when forced", func(t *testing.T) {
+		data, err := service.GenerateReport(ctx, "user1", report.ID, true)
+		require.NoError(t, err)
+		assert.False(t, data.Cached)
+		assert.False(t, data.Incremental)
+		assert.Equal(t, map[string]int64{"READ": 1, "UPDATE": 1}, data.Counts)
+	})
+
+	t.Run("should not share cached data between parameter sets", func(t *testing.T) {
+		byKey := &Report{Name: "By secret", UserID: "user1", Type: "audit", Parameters: map[string]string{"group_by": "secret_key"}}
+		require.NoError(t, service.CreateReport(ctx, byKey))
+
+		data, err := service.GenerateReport(ctx, "user1", byKey.ID, false)
+		require.NoError(t, err)
+		assert.False(t, data.Cached)
+		assert.Equal(t, map[string]int64{"db-password": 2}, data.Counts)
+	})
+
+	t.Run("should not share cached data between reports", func(t *testing.T) {
+		twin := &Report{Name: "Secret activity (copy)", UserID: "user1", Type: "audit"}
+		require.NoError(t, service.CreateReport(ctx, twin))
+
+		data, err := service.GenerateReport(ctx, "user1", twin.ID, false)
+		require.NoError(t, err)
+		assert.False(t, data.Cached)
+		assert.Equal(t, twin.ID, data.ReportID)
+	})
+
+	t.Run("should reject unknown report types", func(t *testing.T) {
+		unknown := &Report{Name: "Unknown", UserID: "user1", Type: "analytics"}
+		require.NoError(t, service.CreateReport(ctx, unknown))
+
+		_, err := service.GenerateReport(ctx, "user1", unknown.ID, false)
+		assert.ErrorContains(t, err, "unsupported report type")
+	})
+
+	t.Run("should return not found for other users' reports", func(t *testing.T) {
+		_, err := service.GenerateReport(ctx, "user2", report.ID, false)
+		assert.ErrorContains(t, err, "not found")
+	})
+}
+
+func TestIncrementalReportRefresh(t *testing.T) {
+	ctx := context.Background()
+	service, db, report, clock := setupReportGeneration(t)
+	service.SetReportCacheTTL(time.Minute)
+	addAuditEntry(t, db, "user1", "READ", clock.Add(-2*time.Hour))
+	addAuditEntry(t, db, "user1", "CREATE", clock.Add(-time.Hour))
+	addAuditEntry(t, db, "user1", "READ", *clock)
+
+	first, err := service.GenerateReport(ctx, "user1", report.ID, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), first.Total)
+
+	// The entry at the previous cut-off must not be counted twice
+	*clock = clock.Add(10 * time.Minute)
+	addAuditEntry(t, db, "user1", "READ", clock.Add(-5*time.Minute))
+	addAuditEntry(t, db, "user1", "DELETE", clock.Add(-time.Minute))
+
+	t.Run("should only add entries since the last generation", func(t *testing.T) {
+		data, err := service.GenerateReport(ctx, "user1", report.ID, false)
+		require.NoError(t, err)
+		assert.True(t, data.Incremental)
+		assert.Equal(t, map[string]int64{"READ": 3, "CREATE": 1, "DELETE": 1}, data.Counts)
+		assert.Equal(t, int64(5), data.Total)
+	})
+
+	t.Run("should match a full recomputation", func(t *testing.T) {
+		incremental, err := service.GenerateReport(ctx, "user1", report.ID, false)
+		require.NoError(t, err)
+		full, err := service.GenerateReport(ctx, "user1", report.ID, true)
+		require.NoError(t, err)
+
+		assert.Equal(t, full.Counts, incremental.Counts)
+		assert.Equal(t, full.Total, incremental.Total)
+	})
+}
@@ -0,0 +1,170 @@
+package insight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+const (
+	// DefaultQueryCacheTTL bounds how long a query result is reused, so writes
+	// made by other replicas, which are not announced locally, are picked up
+	DefaultQueryCacheTTL = 10 * time.Minute
+	// DefaultQueryCacheSize is how many query results are kept
+	DefaultQueryCacheSize = 1000
+	// QueryRangeStep is what generated reports round the end of their range
+	// down to, so generations within the same step run the same queries
+	QueryRangeStep = time.Minute
+	// queryCachePruneInterval is how often expired query results are dropped
+	queryCachePruneInterval = 5 * time.Minute
+)
+
+// queryCachePruneJobName is the scheduler job dropping expired query results
+const queryCachePruneJobName = "insight.query-cache-prune"
+
+// reportSourceTopics names the event announcing writes to the data each
+// report type counts, which invalidates its cached query results
+var reportSourceTopics = map[string]string{
+	"audit": core.TopicAuditLogged,
+}
+
+// QueryCacheStats reports how often report queries were answered from cache
+type QueryCacheStats struct {
+	core.CacheStats
+	Entries int     `json:"entries"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// SetQueryCacheTTL sets how long query results are reused; zero disables the
+// query cache
+func (s *Service) SetQueryCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		s.queries = nil
+		return
+	}
+	s.queries = core.NewCache[string, map[string]int64](DefaultQueryCacheSize, ttl)
+}
+
+// SetEventBus subscribes the query cache to writes to the data reports count,
+// so a user's cached results are dropped once their data changes
+func (s *Service) SetEventBus(bus *core.EventBus) {
+	for reportType, topic := range reportSourceTopics {
+		bus.Subscribe(topic, func(ctx context.Context, event core.BusEvent) {
+			s.invalidateQueries(reportType, event.UserID)
+		})
+	}
+}
+
+// SetScheduler sets the scheduler expired query results are pruned on, which
+// is shared with other services. Without one, they are only dropped when
+// looked up or evicted.
+func (s *Service) SetScheduler(scheduler *core.Scheduler) {
+	s.scheduler = scheduler
+}
+
+// Start prunes expired query results every few minutes, if the query cache is
+// enabled
+func (s *Service) Start() {
+	if s.queries == nil {
+		return
+	}
+	queries := s.queries
+	err := s.scheduler.Register(core.Job{
+		Name:     queryCachePruneJobName,
+		Schedule: core.Every(queryCachePruneInterval),
+		Run: func(ctx context.Context) error {
+			queries.Prune()
+			return nil
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule query cache pruning: %v", err)
+	}
+}
+
+// Close stops pruning the query cache
+func (s *Service) Close(ctx context.Context) error {
+	if err := s.scheduler.Unregister(ctx, queryCachePruneJobName); err != nil && !errors.Is(err, core.ErrJobNotFound) {
+		return err
+	}
+	return nil
+}
+
+// QueryCacheStats returns the query cache's counters and hit rate
+func (s *Service) QueryCacheStats() QueryCacheStats {
+	if s.queries == nil {
+		return QueryCacheStats{}
+	}
+	stats := QueryCacheStats{CacheStats: s.queries.Stats(), Entries: s.queries.Len()}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// runSource counts a report's rows in (from, to]. Results are shared by every
+// report generation running the same query until its data changes; fresh
+// skips the cached result but still stores the new one.
+func (s *Service) runSource(ctx context.Context, report *Report, source reportSource, from, to time.Time, fresh bool) (map[string]int64, error) {
+	if s.queries == nil {
+		return source(ctx, s.db, report.UserID, report.Parameters, from, to)
+	}
+	key, err := queryCacheKey(report, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		if counts, ok := s.queries.Get(key); ok {
+			return copyCounts(counts), nil
+		}
+	}
+
+	// A result read while its data was invalidated may be stale, so it is
+	// only stored if no invalidation happened meanwhile
+	generation := s.queryGeneration.Load()
+	counts, err := source(ctx, s.db, report.UserID, report.Parameters, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if s.queryGeneration.Load() == generation {
+		s.queries.Set(key, copyCounts(counts))
+	}
+	return counts, nil
+}
+
+// invalidateQueries drops the cached results of a report type for a user, or
+// for every user when userID is empty
+func (s *Service) invalidateQueries(reportType, userID string) {
+	if s.queries == nil {
+		return
+	}
+	s.queryGeneration.Add(1)
+	prefix := reportType + "|"
+	if userID != "" {
+		prefix += userID + "|"
+	}
+	s.queries.DeleteFunc(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// queryCacheKey identifies a report query by its type, user, parameters and
+// range, leading with the type and user so they can be invalidated together
+func queryCacheKey(report *Report, from, to time.Time) (string, error) {
+	params, err := reportCacheKey(report)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%s", report.Type, report.UserID, params, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano)), nil
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(counts))
+	for name, count := range counts {
+		copied[name] = count
+	}
+	return copied
+}
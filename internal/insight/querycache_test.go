@@ -0,0 +1,95 @@
+package insight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCache(t *testing.T) {
+	ctx := context.Background()
+	service, db, report, clock := setupReportGeneration(t)
+	events := core.NewEventBus()
+	service.SetEventBus(events)
+	addAuditEntry(t, db, "user1", "READ", clock.Add(-36*time.Hour))
+	addAuditEntry(t, db, "user1", "READ", clock.Add(-time.Hour))
+
+	current := TimeRange{From: clock.Add(-24 * time.Hour), To: *clock}
+	previous := TimeRange{From: clock.Add(-48 * time.Hour), To: current.From}
+
+	t.Run("should reuse query results across report generations", func(t *testing.T) {
+		first, err := service.CompareReport(ctx, "user1", report.ID, current, previous)
+		require.NoError(t, err)
+		assert.Equal(t, QueryCacheStats{CacheStats: core.CacheStats{Misses: 2}, Entries: 2}, service.QueryCacheStats())
+
+		second, err := service.CompareReport(ctx, "user1", report.ID, current, previous)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		stats := service.QueryCacheStats()
+		assert.Equal(t, int64(2), stats.Hits)
+		assert.Equal(t, 0.5, stats.HitRate)
+	})
+
+	t.Run("should invalidate a user's results after an underlying write", func(t *testing.T) {
+		addAuditEntry(t, db, "user1", "UPDATE", clock.Add(-30*time.Hour))
+		events.Publish(ctx, core.BusEvent{Topic: core.TopicAuditLogged, UserID: "user2"})
+		stale, err := service.CompareReport(ctx, "user1", report.ID, current, previous)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stale.Total.Previous, "another user's write keeps the results")
+
+		events.Publish(ctx, core.BusEvent{Topic: core.TopicAuditLogged, UserID: "user1"})
+		assert.Zero(t, service.QueryCacheStats().Entries)
+		fresh, err := service.CompareReport(ctx, "user1", report.ID, current, previous)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), fresh.Total.Previous)
+		assert.Equal(t, int64(1), fresh.Total.Current)
+	})
+
+	t.Run("should share a generated range within the same step", func(t *testing.T) {
+		start := *clock
+		defer func() { *clock = start }()
+
+		*clock = start.Add(10 * time.Second)
+		first, err := service.GenerateReport(ctx, "user1", report.ID, true)
+		require.NoError(t, err)
+		assert.Equal(t, start, first.To, "the range ends at the last whole step")
+		hits := service.QueryCacheStats().Hits
+
+		service.cache.Clear()
+		*clock = start.Add(40 * time.Second)
+		second, err := service.GenerateReport(ctx, "user1", report.ID, false)
+		require.NoError(t, err)
+		assert.Equal(t, first.Total, second.Total)
+		assert.Equal(t, hits+1, service.QueryCacheStats().Hits)
+	})
+
+	t.Run("should run every query when disabled", func(t *testing.T) {
+		service.SetQueryCacheTTL(0)
+		_, err := service.CompareReport(ctx, "user1", report.ID, current, previous)
+		require.NoError(t, err)
+		assert.Equal(t, QueryCacheStats{}, service.QueryCacheStats())
+	})
+}
+
+func TestQueryCachePruning(t *testing.T) {
+	ctx := context.Background()
+	scheduler := core.NewScheduler()
+	defer scheduler.Close(ctx)
+
+	service := NewService()
+	service.SetScheduler(scheduler)
+	service.Start()
+	jobs := scheduler.Jobs()
+	require.Len(t, jobs, 1)
+	assert.Equal(t, queryCachePruneJobName, jobs[0].Name)
+	require.NoError(t, service.Close(ctx))
+	assert.Empty(t, scheduler.Jobs())
+
+	service.SetQueryCacheTTL(0)
+	service.Start()
+	assert.Empty(t, scheduler.Jobs(), "nothing is pruned without a query cache")
+}
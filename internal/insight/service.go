@@ -5,23 +5,45 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
 	"gorm.io/gorm"
 )
 
 type Service struct {
 	db *gorm.DB
+	// cache keeps each report's last generated data, which stale generations
+	// resume from, so entries are evicted by size rather than by age
+	cache    *core.Cache[string, *ReportData]
+	cacheTTL time.Duration
+	// queries caches the results of report queries, and queryGeneration
+	// counts their invalidations
+	queries         *core.Cache[string, map[string]int64]
+	queryGeneration atomic.Uint64
+	scheduler       *core.Scheduler
+	now             func() time.Time
 }
 
 func NewService() *Service {
-	return &Service{}
+	return &Service{
+		cache:    core.NewCache[string, *ReportData](DefaultReportCacheSize, 0),
+		cacheTTL: DefaultReportCacheTTL,
+		queries:  core.NewCache[string, map[string]int64](DefaultQueryCacheSize, DefaultQueryCacheTTL),
+		now:      func() time.Time { return time.Now().UTC() },
+	}
 }
 
 func (s *Service) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return database.CheckConnection(ctx, s.db)
+}
+
 func (s *Service) CreateReport(ctx context.Context, report *Report) error {
 	if err := s.validateReport(report); err != nil {
 		return err
@@ -48,6 +70,34 @@ func (s *Service) GetReports(ctx context.Context, userID string) ([]*Report, err
 	return reports, nil
 }
 
+// GetReportsPage returns one page of the user's reports, reading only that page
+// from the store
+func (s *Service) GetReportsPage(ctx context.Context, userID string, request core.PageRequest) (*core.Page[*Report], error) {
+	page, err := database.Paginate[*Report](s.db.WithContext(ctx).Model(&Report{}).Where("user_id = ?", userID).Order("id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+	return page, nil
+}
+
+func (s *Service) Count(ctx context.Context, userID string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	query := s.db.WithContext(ctx).Model(&Report{}).Where("user_id = ?", userID)
+	return database.CountByStatus[ReportStatus](query, core.ResourceTypeReport, filters...)
+}
+
+func (s *Service) GetReport(ctx context.Context, userID string, reportID uint) (*Report, error) {
+	var report Report
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", reportID, userID).First(&report).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("report %d not found", reportID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report: %w", err)
+	}
+
+	return &report, nil
+}
+
 func (s *Service) validateReport(report *Report) error {
 	if strings.TrimSpace(report.Name) == "" {
 		return errors.New("name is required")
@@ -59,15 +109,17 @@ func (s *Service) validateReport(report *Report) error {
 }
 
 type Report struct {
-	ID          uint         `json:"id" gorm:"primaryKey"`
-	Name        string       `json:"name" gorm:"not null"`
-	Description string       `json:"description"`
-	UserID      string       `json:"user_id" gorm:"index;not null"`
-	Type        string       `json:"type" gorm:"not null"`
-	Status      ReportStatus `json:"status" gorm:"default:0"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	Name        string            `json:"name" gorm:"not null"`
+	Description string            `json:"description"`
+	UserID      string            `json:"user_id" gorm:"index;not null"`
+	Type        string            `json:"type" gorm:"not null"`
+	Status      ReportStatus      `json:"status" gorm:"default:0"`
+	Parameters  map[string]string `json:"parameters,omitempty" gorm:"serializer:json"`
+	LastRun     *time.Time        `json:"last_run,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt    `json:"-" gorm:"index"`
 }
 
 func (Report) TableName() string {
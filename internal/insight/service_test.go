@@ -3,7 +3,9 @@ package insight
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -63,3 +65,23 @@ func TestReportOperations(t *testing.T) {
 		assert.Len(t, retrieved, 2)
 	})
 }
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+
+	require.NoError(t, service.CreateReport(ctx, &Report{UserID: "user1", Name: "Usage", Type: "usage"}))
+	lastQuarter := time.Now().AddDate(0, -3, 0)
+	require.NoError(t, db.Create(&Report{UserID: "user1", Name: "Last quarter", Type: "usage", Status: ReportStatusCompleted, CreatedAt: lastQuarter}).Error)
+
+	count, err := service.Count(ctx, "user1", core.CountFilter{GroupByStatus: true})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceTypeReport, count.ResourceType)
+	assert.Equal(t, map[string]int64{"pending": 1, "completed": 1}, count.ByStatus)
+
+	count, err = service.Count(ctx, "user1", core.CountFilter{CreatedAfter: time.Now().AddDate(0, -1, 0)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count.Total)
+}
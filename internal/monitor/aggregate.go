@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// AggregateFunc combines the points of a metric that fall in one bucket
+type AggregateFunc string
+
+const (
+	AggregateAvg   AggregateFunc = "avg"
+	AggregateMin   AggregateFunc = "min"
+	AggregateMax   AggregateFunc = "max"
+	AggregateSum   AggregateFunc = "sum"
+	AggregateCount AggregateFunc = "count"
+)
+
+// MaxAggregateBuckets caps how many buckets an aggregation may span, so a
+// tiny bucket over a long range cannot exhaust memory
+const MaxAggregateBuckets = 10000
+
+// MetricPoint is one bucket of an aggregated time series
+type MetricPoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Value       float64   `json:"value"`
+	Count       int64     `json:"count"`
+}
+
+// ParseAggregateFunc returns the aggregate function called name
+func ParseAggregateFunc(name string) (AggregateFunc, error) {
+	fn := AggregateFunc(strings.ToLower(strings.TrimSpace(name)))
+	switch fn {
+	case AggregateAvg, AggregateMin, AggregateMax, AggregateSum, AggregateCount:
+		return fn, nil
+	default:
+		return "", fmt.Errorf("unsupported aggregate function '%s'", name)
+	}
+}
+
+// AggregateMetrics combines the points of a metric in [from, to) with fn into
+// buckets of the given width, oldest first. From is rounded down to a bucket
+// boundary, and buckets without points are left out. Only the value and
+// timestamp of points in range are read, walking the series' timestamp index,
+// and each bucket is reduced as rows arrive rather than loading the points.
+func (s *Service) AggregateMetrics(ctx context.Context, serviceName, metricName string, fn AggregateFunc, from, to time.Time, bucket time.Duration) ([]*MetricPoint, error) {
+	fn, err := ParseAggregateFunc(string(fn))
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(serviceName) == "" || strings.TrimSpace(metricName) == "" {
+		return nil, errors.New("service name and metric name are required")
+	}
+	if bucket <= 0 {
+		return nil, errors.New("bucket must be positive")
+	}
+	if from.IsZero() || to.IsZero() {
+		return nil, errors.New("from and to are required")
+	}
+	from = from.UTC().Truncate(bucket)
+	to = to.UTC()
+	if !from.Before(to) {
+		return nil, errors.New("from must be before to")
+	}
+	if spans := (to.Sub(from) + bucket - 1) / bucket; spans > MaxAggregateBuckets {
+		return nil, fmt.Errorf("range spans %d buckets (max %d)", spans, MaxAggregateBuckets)
+	}
+
+	rows, err := s.db.WithContext(ctx).Model(&Metric{}).
+		Select("value, timestamp").
+		Where("service_name = ? AND name = ?", serviceName, metricName).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Order("timestamp").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate metrics: %w", err)
+	}
+	defer rows.Close()
+
+	// Rows arrive in timestamp order, so each bucket is complete once a row
+	// past its end is read
+	points := make([]*MetricPoint, 0)
+	var current *MetricPoint
+	for rows.Next() {
+		var metric Metric
+		if err := s.db.ScanRows(rows, &metric); err != nil {
+			return nil, fmt.Errorf("failed to aggregate metrics: %w", err)
+		}
+		start := metric.Timestamp.UTC().Truncate(bucket)
+		if current == nil || !current.BucketStart.Equal(start) {
+			current = &MetricPoint{BucketStart: start}
+			points = append(points, current)
+		}
+		current.add(fn, metric.Value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate metrics: %w", err)
+	}
+
+	if fn == AggregateAvg {
+		for _, point := range points {
+			point.Value /= float64(point.Count)
+		}
+	}
+	return points, nil
+}
+
+// add folds value into the point; for avg the value is a running sum until
+// every point has been added
+func (p *MetricPoint) add(fn AggregateFunc, value float64) {
+	p.Count++
+	switch fn {
+	case AggregateMin:
+		if p.Count == 1 {
+			p.Value = value
+		}
+		p.Value = math.Min(p.Value, value)
+	case AggregateMax:
+		if p.Count == 1 {
+			p.Value = value
+		}
+		p.Value = math.Max(p.Value, value)
+	case AggregateCount:
+		p.Value = float64(p.Count)
+	default:
+		p.Value += value
+	}
+}
@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMetrics(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	db := setupTestDB(t)
+	service.SetDB(db)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	seed := func(serviceName string, value float64, offset time.Duration) {
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: serviceName, Name: "latency", Value: value, Timestamp: base.Add(offset)}))
+	}
+	seed("api", 10, 10*time.Second)
+	seed("api", 30, 4*time.Minute)
+	seed("api", 20, 6*time.Minute)
+	seed("api", 40, 17*time.Minute)
+	seed("api", 99, time.Hour)
+	seed("web", 1000, time.Minute)
+
+	values := func(points []*MetricPoint) []float64 {
+		result := make([]float64, len(points))
+		for i, point := range points {
+			result[i] = point.Value
+		}
+		return result
+	}
+
+	t.Run("should bucket each function in bucket order", func(t *testing.T) {
+		for fn, want := range map[AggregateFunc][]float64{
+			AggregateAvg:   {20, 20, 40},
+			AggregateMin:   {10, 20, 40},
+			AggregateMax:   {30, 20, 40},
+			AggregateSum:   {40, 20, 40},
+			AggregateCount: {2, 1, 1},
+		} {
+			points, err := service.AggregateMetrics(ctx, "api", "latency", fn, base, base.Add(time.Hour), 5*time.Minute)
+			require.NoError(t, err, fn)
+			assert.Equal(t, want, values(points), fn)
+			require.Len(t, points, 3)
+			assert.True(t, base.Equal(points[0].BucketStart))
+			assert.True(t, base.Add(5*time.Minute).Equal(points[1].BucketStart))
+			assert.True(t, base.Add(15*time.Minute).Equal(points[2].BucketStart), "empty buckets are left out")
+		}
+	})
+
+	t.Run("should round from down to a bucket boundary", func(t *testing.T) {
+		points, err := service.AggregateMetrics(ctx, "api", "latency", AggregateCount, base.Add(30*time.Minute), base.Add(2*time.Hour), time.Hour)
+		require.NoError(t, err)
+		require.Len(t, points, 2)
+		assert.Equal(t, []float64{4, 1}, values(points))
+		assert.True(t, base.Equal(points[0].BucketStart))
+	})
+
+	t.Run("should return no points for an empty range", func(t *testing.T) {
+		points, err := service.AggregateMetrics(ctx, "api", "latency", AggregateAvg, base.Add(-time.Hour), base, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, points)
+	})
+
+	t.Run("should reject invalid aggregations", func(t *testing.T) {
+		_, err := service.AggregateMetrics(ctx, "api", "latency", "median", base, base.Add(time.Hour), time.Minute)
+		assert.ErrorContains(t, err, "unsupported aggregate function 'median'")
+		_, err = service.AggregateMetrics(ctx, "api", "latency", AggregateAvg, base, base.Add(time.Hour), 0)
+		assert.ErrorContains(t, err, "bucket must be positive")
+		_, err = service.AggregateMetrics(ctx, "api", "latency", AggregateAvg, base.Add(time.Hour), base, time.Minute)
+		assert.ErrorContains(t, err, "from must be before to")
+		_, err = service.AggregateMetrics(ctx, "", "latency", AggregateAvg, base, base.Add(time.Hour), time.Minute)
+		assert.Error(t, err)
+		_, err = service.AggregateMetrics(ctx, "api", "latency", AggregateAvg, base, base.Add(30*24*time.Hour), time.Second)
+		assert.ErrorContains(t, err, "buckets (max 10000)")
+	})
+
+	t.Run("should index series by timestamp", func(t *testing.T) {
+		assert.True(t, db.Migrator().HasIndex(&Metric{}, "idx_metrics_series_time"))
+	})
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	DefaultAnomalySigma    = 3.0
+	DefaultAnomalyBaseline = 20
+	minAnomalyBaseline     = 5
+)
+
+type Anomaly struct {
+	Metric *Metric `json:"metric"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+	ZScore float64 `json:"z_score"`
+}
+
+// SetAnomalyThreshold sets how many standard deviations from its baseline a
+// point must be to be anomalous, and how many preceding points the baseline has
+func (s *Service) SetAnomalyThreshold(sigma float64, baseline int) {
+	s.anomalySigma = sigma
+	s.anomalyBaseline = baseline
+}
+
+// DetectAnomalies returns the metric's points within window whose z-score
+// against the points just before them exceeds the anomaly threshold
+func (s *Service) DetectAnomalies(ctx context.Context, serviceName, metricName string, window time.Duration) ([]*Anomaly, error) {
+	var metrics []*Metric
+	err := s.db.WithContext(ctx).
+		Where("service_name = ? AND name = ? AND timestamp >= ?", serviceName, metricName, time.Now().Add(-window)).
+		Order("timestamp ASC").
+		Find(&metrics).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
+	}
+
+	baselineSize := s.anomalyBaseline
+	if baselineSize < minAnomalyBaseline {
+		baselineSize = minAnomalyBaseline
+	}
+
+	anomalies := make([]*Anomaly, 0)
+	for i, metric := range metrics {
+		// Too few predecessors make too noisy a baseline to flag anything
+		if i < minAnomalyBaseline {
+			continue
+		}
+
+		start := i - baselineSize
+		if start < 0 {
+			start = 0
+		}
+		mean, stdDev := meanStdDev(metrics[start:i])
+
+		deviation := metric.Value - mean
+		// Any deviation from a perfectly flat baseline is anomalous, with no z-score
+		if stdDev == 0 {
+			if deviation != 0 {
+				anomalies = append(anomalies, &Anomaly{Metric: metric, Mean: mean})
+			}
+			continue
+		}
+
+		zScore := deviation / stdDev
+		if math.Abs(zScore) > s.anomalySigma {
+			anomalies = append(anomalies, &Anomaly{Metric: metric, Mean: mean, StdDev: stdDev, ZScore: zScore})
+		}
+	}
+
+	return anomalies, nil
+}
+
+// DetectAndAlertAnomalies runs DetectAnomalies and, when any are found,
+// creates a triggered alert for userID describing the latest
+func (s *Service) DetectAndAlertAnomalies(ctx context.Context, userID, serviceName, metricName string, window time.Duration) ([]*Anomaly, *Alert, error) {
+	anomalies, err := s.DetectAnomalies(ctx, serviceName, metricName, window)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(anomalies) == 0 {
+		return anomalies, nil, nil
+	}
+
+	latest := anomalies[len(anomalies)-1]
+	alert := &Alert{
+		Name:   fmt.Sprintf("Anomaly in %s/%s", serviceName, metricName),
+		UserID: userID,
+		Description: fmt.Sprintf("%d anomalous point(s) in the last %s; latest value %.4g (mean %.4g, z-score %.2f)",
+			len(anomalies), window, latest.Metric.Value, latest.Mean, latest.ZScore),
+		Condition: fmt.Sprintf("anomaly(%s, %s) > %.1f sigma", serviceName, metricName, s.anomalySigma),
+		Status:    AlertStatusTriggered,
+	}
+	if err := s.CreateAlert(ctx, alert); err != nil {
+		return nil, nil, err
+	}
+
+	return anomalies, alert, nil
+}
+
+func meanStdDev(metrics []*Metric) (float64, float64) {
+	if len(metrics) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, metric := range metrics {
+		sum += metric.Value
+	}
+	mean := sum / float64(len(metrics))
+
+	var squares float64
+	for _, metric := range metrics {
+		diff := metric.Value - mean
+		squares += diff * diff
+	}
+
+	return mean, math.Sqrt(squares / float64(len(metrics)))
+}
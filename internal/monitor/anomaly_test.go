@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	ctx := context.Background()
+
+	// A noisy but stable series with a single injected spike
+	values := []float64{50, 52, 49, 51, 50, 48, 53, 50, 51, 49, 250, 50, 52, 49, 51}
+	start := time.Now().Add(-time.Duration(len(values)) * time.Minute)
+	for i, value := range values {
+		metric := &Metric{
+			ServiceName: "api",
+			Name:        "latency_ms",
+			Value:       value,
+			Timestamp:   start.Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, service.CreateMetric(ctx, metric))
+	}
+
+	t.Run("should flag the injected spike", func(t *testing.T) {
+		anomalies, err := service.DetectAnomalies(ctx, "api", "latency_ms", time.Hour)
+		require.NoError(t, err)
+		require.Len(t, anomalies, 1)
+
+		assert.Equal(t, 250.0, anomalies[0].Metric.Value)
+		assert.InDelta(t, 50.3, anomalies[0].Mean, 0.5)
+		assert.Greater(t, anomalies[0].ZScore, DefaultAnomalySigma)
+	})
+
+	t.Run("should ignore points outside the window", func(t *testing.T) {
+		anomalies, err := service.DetectAnomalies(ctx, "api", "latency_ms", 3*time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, anomalies)
+	})
+
+	t.Run("should create a triggered alert for anomalies", func(t *testing.T) {
+		anomalies, alert, err := service.DetectAndAlertAnomalies(ctx, "user1", "api", "latency_ms", time.Hour)
+		require.NoError(t, err)
+		assert.Len(t, anomalies, 1)
+		require.NotNil(t, alert)
+		assert.Equal(t, AlertStatusTriggered, alert.Status)
+
+		alerts, err := service.GetAlerts(ctx, "user1")
+		require.NoError(t, err)
+		assert.Len(t, alerts, 1)
+	})
+
+	t.Run("should flag deviations from a flat baseline", func(t *testing.T) {
+		for i, value := range []float64{1, 1, 1, 1, 1, 1, 2} {
+			metric := &Metric{ServiceName: "api", Name: "flat", Value: value, Timestamp: start.Add(time.Duration(i) * time.Minute)}
+			require.NoError(t, service.CreateMetric(ctx, metric))
+		}
+
+		anomalies, err := service.DetectAnomalies(ctx, "api", "flat", time.Hour)
+		require.NoError(t, err)
+		require.Len(t, anomalies, 1)
+		assert.Equal(t, 2.0, anomalies[0].Metric.Value)
+	})
+}
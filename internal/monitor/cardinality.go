@@ -0,0 +1,181 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxSeriesPerMetric is how many distinct tag combinations a metric
+// may have by default
+const DefaultMaxSeriesPerMetric = 10000
+
+// ErrCardinalityExceeded is returned for points that would start a new series
+// of a metric already at its series limit
+var ErrCardinalityExceeded = errors.New("metric cardinality limit exceeded")
+
+// CardinalityMode is what happens to points beyond a metric's series limit
+type CardinalityMode string
+
+const (
+	// CardinalityReject fails such points with ErrCardinalityExceeded
+	CardinalityReject CardinalityMode = "reject"
+	// CardinalityDrop discards such points, counting them in DroppedMetrics
+	CardinalityDrop CardinalityMode = "drop"
+)
+
+// cardinalityGuard tracks the distinct tag combinations, or series, of each
+// metric. A metric's series are loaded from the store the first time it is
+// seen, so limits hold across restarts.
+type cardinalityGuard struct {
+	limit int
+	mode  CardinalityMode
+
+	mu     sync.Mutex
+	series map[seriesMetric]*seriesSet
+}
+
+// seriesSet is the series of one metric: those with a stored point, and new
+// ones admitted for points whose insert has not finished, with the number of
+// such points
+type seriesSet struct {
+	stored  map[string]bool
+	pending map[string]int
+}
+
+type seriesMetric struct {
+	serviceName string
+	name        string
+}
+
+func newCardinalityGuard(limit int, mode CardinalityMode) *cardinalityGuard {
+	return &cardinalityGuard{limit: limit, mode: mode, series: make(map[seriesMetric]*seriesSet)}
+}
+
+// SetCardinalityLimit sets how many distinct tag combinations each metric may
+// have, and what happens to points that would exceed it. A limit of zero
+// disables the guard. Series tracked so far are forgotten and reloaded from
+// the store.
+func (s *Service) SetCardinalityLimit(limit int, mode CardinalityMode) error {
+	if limit < 0 {
+		return errors.New("series limit must not be negative")
+	}
+	if mode != CardinalityReject && mode != CardinalityDrop {
+		return fmt.Errorf("unknown cardinality mode '%s'", mode)
+	}
+	s.cardinality = newCardinalityGuard(limit, mode)
+	return nil
+}
+
+// DroppedMetrics returns how many points have been dropped for exceeding
+// their metric's series limit
+func (s *Service) DroppedMetrics() int64 {
+	return s.droppedMetrics.Load()
+}
+
+// admit reports whether a point may be stored. A point that may not is either
+// counted as dropped, returning a nil settle and no error, or rejected with
+// ErrCardinalityExceeded. An admitted point's settle must be called once its
+// insert has finished: a new series counts towards the limit while the insert
+// is pending, but is only recorded if the point was stored.
+func (g *cardinalityGuard) admit(ctx context.Context, s *Service, metric *Metric) (settle func(stored bool), err error) {
+	if g.limit == 0 {
+		return settleNothing, nil
+	}
+	key := seriesMetric{serviceName: metric.ServiceName, name: metric.Name}
+	tags := seriesTags(metric.Tags)
+
+	set, err := g.seriesOf(ctx, s, key)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if set.stored[tags] {
+		return settleNothing, nil
+	}
+	if set.pending[tags] == 0 && len(set.stored)+len(set.pending) >= g.limit {
+		if g.mode == CardinalityDrop {
+			s.droppedMetrics.Add(1)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: %s/%s already has %d tag combinations", ErrCardinalityExceeded, metric.ServiceName, metric.Name, len(set.stored)+len(set.pending))
+	}
+
+	set.pending[tags]++
+	return func(stored bool) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if stored {
+			set.stored[tags] = true
+		}
+		if set.pending[tags]--; set.pending[tags] == 0 {
+			delete(set.pending, tags)
+		}
+	}, nil
+}
+
+func settleNothing(bool) {}
+
+// seriesOf returns the series of a metric, loading them from the store the
+// first time. The store is read without holding the guard's lock, so points
+// of other metrics are admitted meanwhile.
+func (g *cardinalityGuard) seriesOf(ctx context.Context, s *Service, key seriesMetric) (*seriesSet, error) {
+	g.mu.Lock()
+	set, ok := g.series[key]
+	g.mu.Unlock()
+	if ok {
+		return set, nil
+	}
+
+	stored, err := s.loadSeries(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// Another point of the metric may have loaded it first
+	if set, ok := g.series[key]; ok {
+		return set, nil
+	}
+	set = &seriesSet{stored: stored, pending: make(map[string]int)}
+	g.series[key] = set
+	return set, nil
+}
+
+// loadSeries reads the distinct tag combinations a metric has been stored with
+func (s *Service) loadSeries(ctx context.Context, key seriesMetric) (map[string]bool, error) {
+	var stored []string
+	err := s.db.WithContext(ctx).Model(&Metric{}).
+		Where("service_name = ? AND name = ?", key.serviceName, key.name).
+		Distinct().
+		Pluck("tags", &stored).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metric series: %w", err)
+	}
+	known := make(map[string]bool, len(stored))
+	for _, tags := range stored {
+		known[seriesTags(tags)] = true
+	}
+	return known, nil
+}
+
+// seriesTags identifies the series of a point by its comma-separated tags,
+// ignoring their order and surrounding space, so "env=prod,host=a" and
+// "host=a, env=prod" are the same series
+func seriesTags(tags string) string {
+	if !strings.Contains(tags, ",") {
+		return strings.TrimSpace(tags)
+	}
+	parts := strings.Split(tags, ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestCardinalityLimit(t *testing.T) {
+	ctx := context.Background()
+	point := func(tags string) *Metric {
+		return &Metric{ServiceName: "api", Name: "requests", Value: 1, Tags: tags}
+	}
+
+	t.Run("should accept series within the limit and reject new ones beyond it", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		require.NoError(t, service.SetCardinalityLimit(2, CardinalityReject))
+
+		require.NoError(t, service.CreateMetric(ctx, point("env=prod,host=a")))
+		require.NoError(t, service.CreateMetric(ctx, point("env=prod,host=b")))
+		require.NoError(t, service.CreateMetric(ctx, point("host=a, env=prod")), "tag order does not make a new series")
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "latency", Value: 1, Tags: "request_id=1"}), "limits are per metric")
+
+		err := service.CreateMetric(ctx, point("env=prod,host=c"))
+		assert.ErrorIs(t, err, ErrCardinalityExceeded)
+		assert.ErrorContains(t, err, "api/requests already has 2 tag combinations")
+
+		results, err := service.IngestBatch(ctx, []*Metric{point("env=prod,host=b"), point("env=prod,host=d")})
+		require.NoError(t, err)
+		assert.True(t, results[0].Accepted)
+		assert.False(t, results[1].Accepted)
+		assert.Contains(t, results[1].Error, ErrCardinalityExceeded.Error())
+		assert.Zero(t, service.DroppedMetrics())
+	})
+
+	t.Run("should drop and count points beyond the limit", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		require.NoError(t, service.SetCardinalityLimit(1, CardinalityDrop))
+
+		batch := make([]*Metric, 0, 5)
+		for i := 0; i < 5; i++ {
+			batch = append(batch, point(fmt.Sprintf("request_id=%d", i)))
+		}
+		results, err := service.IngestBatch(ctx, batch)
+		require.NoError(t, err)
+		assert.True(t, results[0].Accepted)
+		for _, result := range results[1:] {
+			assert.False(t, result.Accepted)
+			assert.True(t, result.Dropped)
+			assert.Empty(t, result.Error)
+		}
+		require.NoError(t, service.CreateMetric(ctx, point("request_id=9")))
+		assert.Equal(t, int64(5), service.DroppedMetrics())
+
+		metrics, err := service.GetMetrics(ctx, "api")
+		require.NoError(t, err)
+		assert.Len(t, metrics, 1)
+	})
+
+	t.Run("should count series already stored", func(t *testing.T) {
+		db := setupTestDB(t)
+		before := NewService()
+		before.SetDB(db)
+		require.NoError(t, before.CreateMetric(ctx, point("host=a")))
+		require.NoError(t, before.CreateMetric(ctx, point("host=b")))
+
+		service := NewService()
+		service.SetDB(db)
+		require.NoError(t, service.SetCardinalityLimit(2, CardinalityReject))
+		assert.NoError(t, service.CreateMetric(ctx, point("host=a")))
+		assert.ErrorIs(t, service.CreateMetric(ctx, point("host=c")), ErrCardinalityExceeded)
+	})
+
+	t.Run("should not count series whose points failed to store", func(t *testing.T) {
+		db := setupTestDB(t)
+		failing := true
+		require.NoError(t, db.Callback().Create().Before("gorm:create").Register("test:fail", func(tx *gorm.DB) {
+			if failing {
+				tx.AddError(errors.New("disk full"))
+			}
+		}))
+		service := NewService()
+		service.SetDB(db)
+		require.NoError(t, service.SetCardinalityLimit(1, CardinalityReject))
+
+		assert.ErrorContains(t, service.CreateMetric(ctx, point("host=a")), "disk full")
+		_, err := service.IngestBatch(ctx, []*Metric{point("host=b")})
+		assert.ErrorContains(t, err, "disk full")
+
+		failing = false
+		require.NoError(t, service.CreateMetric(ctx, point("host=c")))
+		assert.ErrorIs(t, service.CreateMetric(ctx, point("host=a")), ErrCardinalityExceeded)
+	})
+
+	t.Run("should allow any number of series without a limit", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		require.NoError(t, service.SetCardinalityLimit(0, CardinalityReject))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, service.CreateMetric(ctx, point(fmt.Sprintf("request_id=%d", i))))
+		}
+	})
+
+	t.Run("should reject invalid limits", func(t *testing.T) {
+		service := NewService()
+		assert.ErrorContains(t, service.SetCardinalityLimit(-1, CardinalityReject), "series limit must not be negative")
+		assert.ErrorContains(t, service.SetCardinalityLimit(10, "sample"), "unknown cardinality mode 'sample'")
+	})
+}
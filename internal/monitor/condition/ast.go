@@ -0,0 +1,234 @@
+package condition
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metrics maps metric references to their current values. Plain metrics are keyed
+// by name and function references by their canonical form, e.g. "anomaly(api, latency)".
+type Metrics map[string]float64
+
+// Units maps metric references, keyed as in Metrics, to the unit their values
+// are recorded in
+type Units map[string]string
+
+// Node is an expression in a parsed condition
+type Node interface {
+	Evaluate(metrics Metrics) (bool, error)
+	String() string
+}
+
+// Operand is one side of a comparison
+type Operand interface {
+	Value(metrics Metrics) (float64, error)
+	String() string
+}
+
+// Operator is a comparison operator
+type Operator string
+
+const (
+	OpGreater      Operator = ">"
+	OpGreaterEqual Operator = ">="
+	OpLess         Operator = "<"
+	OpLessEqual    Operator = "<="
+	OpEqual        Operator = "=="
+	OpNotEqual     Operator = "!="
+)
+
+func (o Operator) compare(left, right float64) bool {
+	switch o {
+	case OpGreater:
+		return left > right
+	case OpGreaterEqual:
+		return left >= right
+	case OpLess:
+		return left < right
+	case OpLessEqual:
+		return left <= right
+	case OpEqual:
+		return left == right
+	case OpNotEqual:
+		return left != right
+	default:
+		return false
+	}
+}
+
+// Logical combines two expressions with AND or OR
+type Logical struct {
+	And   bool
+	Left  Node
+	Right Node
+}
+
+// Evaluate short-circuits, so the right side is only evaluated when needed
+func (l *Logical) Evaluate(metrics Metrics) (bool, error) {
+	left, err := l.Left.Evaluate(metrics)
+	if err != nil {
+		return false, err
+	}
+	if left != l.And {
+		return left, nil
+	}
+	return l.Right.Evaluate(metrics)
+}
+
+func (l *Logical) String() string {
+	op := "OR"
+	if l.And {
+		op = "AND"
+	}
+	return fmt.Sprintf("(%s %s %s)", l.Left, op, l.Right)
+}
+
+// Not negates an expression
+type Not struct {
+	Expr Node
+}
+
+// Evaluate returns the negation of the wrapped expression
+func (n *Not) Evaluate(metrics Metrics) (bool, error) {
+	value, err := n.Expr.Evaluate(metrics)
+	return !value, err
+}
+
+func (n *Not) String() string {
+	return fmt.Sprintf("NOT %s", n.Expr)
+}
+
+// Comparison compares two operands
+type Comparison struct {
+	Left  Operand
+	Op    Operator
+	Right Operand
+}
+
+// Evaluate resolves both operands and compares them
+func (c *Comparison) Evaluate(metrics Metrics) (bool, error) {
+	left, err := c.Left.Value(metrics)
+	if err != nil {
+		return false, err
+	}
+	right, err := c.Right.Value(metrics)
+	if err != nil {
+		return false, err
+	}
+	return c.Op.compare(left, right), nil
+}
+
+func (c *Comparison) String() string {
+	return fmt.Sprintf("%s %s %s", c.Left, c.Op, c.Right)
+}
+
+// Number is a numeric literal with an optional unit, e.g. 1GB, 250ms or 3 sigma
+type Number struct {
+	Literal float64
+	Unit    string
+
+	// in is the unit of the metric the literal is compared with, if known
+	in string
+}
+
+// Value returns the literal in the unit of the metric it is compared with.
+// Without a known metric unit of the same kind, a literal with a unit is
+// scaled to the base unit (seconds, bytes).
+func (n *Number) Value(Metrics) (float64, error) {
+	if n.Unit == "" {
+		return n.Literal, nil
+	}
+	in, ok := lookupUnit(n.in)
+	switch {
+	case ok && in == n.Unit:
+		return n.Literal, nil
+	// A metric recorded in "m" may be in meters, so it is only compared with
+	// m literals as they are rather than converted from other time units
+	case ok && in != "m" && unitKinds[in] != "" && unitKinds[in] == unitKinds[n.Unit]:
+		return n.Literal * unitScale(n.Unit) / unitScale(in), nil
+	default:
+		return n.Literal * unitScale(n.Unit), nil
+	}
+}
+
+func (n *Number) String() string {
+	literal := strconv.FormatFloat(n.Literal, 'g', -1, 64)
+	switch {
+	case n.Unit == "":
+		return literal
+	case len(n.Unit) > 2 && n.Unit != "ms":
+		return literal + " " + n.Unit
+	default:
+		return literal + n.Unit
+	}
+}
+
+// MetricRef references a metric value, optionally through a function such as
+// anomaly(service, metric)
+type MetricRef struct {
+	Name string
+	Args []string
+	call bool
+}
+
+// Key is the name the metric is looked up by in Metrics
+func (m *MetricRef) Key() string {
+	if !m.call {
+		return m.Name
+	}
+	return fmt.Sprintf("%s(%s)", m.Name, strings.Join(m.Args, ", "))
+}
+
+// Value looks up the metric; a missing metric is an error rather than zero
+func (m *MetricRef) Value(metrics Metrics) (float64, error) {
+	value, ok := metrics[m.Key()]
+	if !ok {
+		return 0, fmt.Errorf("metric '%s' has no value", m.Key())
+	}
+	return value, nil
+}
+
+func (m *MetricRef) String() string {
+	return m.Key()
+}
+
+var units = map[string]float64{
+	"%":     1,
+	"sigma": 1,
+	"B":     1,
+	"KB":    1 << 10,
+	"MB":    1 << 20,
+	"GB":    1 << 30,
+	"TB":    1 << 40,
+	"ms":    0.001,
+	"s":     1,
+	"m":     60,
+	"h":     3600,
+}
+
+// unitKinds groups the units that convert into each other
+var unitKinds = map[string]string{
+	"B": "bytes", "KB": "bytes", "MB": "bytes", "GB": "bytes", "TB": "bytes",
+	"ms": "time", "s": "time", "m": "time", "h": "time",
+}
+
+func lookupUnit(unit string) (string, bool) {
+	if _, ok := units[unit]; ok {
+		return unit, true
+	}
+	// Byte units are accepted in any case (1gb, 1Gb)
+	if upper := strings.ToUpper(unit); strings.HasSuffix(upper, "B") {
+		if _, ok := units[upper]; ok {
+			return upper, true
+		}
+	}
+	return "", false
+}
+
+func unitScale(unit string) float64 {
+	if scale, ok := units[unit]; ok {
+		return scale
+	}
+	return 1
+}
@@ -0,0 +1,158 @@
+// Package condition parses and evaluates alert conditions such as
+//
+//	cpu_usage > 80 AND (memory >= 1GB OR anomaly(api, latency) > 3 sigma)
+//
+// A condition is one or more comparisons between metric references and numeric
+// literals combined with AND, OR, NOT and parentheses.
+package condition
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of condition"
+	case tokenIdent:
+		return "identifier"
+	case tokenNumber:
+		return "number"
+	case tokenOperator:
+		return "operator"
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	case tokenComma:
+		return "','"
+	default:
+		return "unknown"
+	}
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// SyntaxError reports an invalid condition and the byte offset it was found at
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid condition at position %d: %s", e.Pos, e.Msg)
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case c == '%':
+			tokens = append(tokens, token{kind: tokenIdent, text: "%", pos: i})
+			i++
+		case strings.ContainsRune("<>=!&|", c):
+			text, err := lexOperator(input, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokenOperator
+			switch text {
+			case "&&":
+				kind = tokenAnd
+			case "||":
+				kind = tokenOr
+			case "!":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: i})
+			i += len(text)
+		case isDigit(c) || c == '.' || (c == '-' && i+1 < len(input) && (isDigit(rune(input[i+1])) || input[i+1] == '.')):
+			start := i
+			i++
+			for i < len(input) && (isDigit(rune(input[i])) || input[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: input[start:i], pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(input) && isIdentPart(rune(input[i])) {
+				i++
+			}
+			text := input[start:i]
+			kind := tokenIdent
+			switch strings.ToUpper(text) {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: start})
+		default:
+			return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
+
+func lexOperator(input string, i int) (string, error) {
+	for _, op := range []string{">=", "<=", "==", "!=", "&&", "||", ">", "<", "!"} {
+		if strings.HasPrefix(input[i:], op) {
+			return op, nil
+		}
+	}
+	return "", &SyntaxError{Pos: i, Msg: fmt.Sprintf("unknown operator %q", input[i])}
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.' || c == '-' || c == ':' || c == '/'
+}
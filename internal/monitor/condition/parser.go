@@ -0,0 +1,279 @@
+package condition
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Condition is a parsed alert condition
+type Condition struct {
+	Source string
+	Expr   Node
+}
+
+// Parse parses a condition into an AST. Errors are returned as *SyntaxError.
+func Parse(input string) (*Condition, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, &SyntaxError{Pos: 0, Msg: "condition is empty"}
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, p.unexpected(next)
+	}
+
+	return &Condition{Source: input, Expr: expr}, nil
+}
+
+// Validate reports whether a condition is well formed, for create-time checks
+func Validate(input string) error {
+	_, err := Parse(input)
+	return err
+}
+
+// Evaluate evaluates the condition against current metric values
+func (c *Condition) Evaluate(metrics Metrics) (bool, error) {
+	return c.Expr.Evaluate(metrics)
+}
+
+// References returns the keys of every metric the condition reads, in order of appearance
+func (c *Condition) References() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	addOperand := func(operand Operand) {
+		if ref, ok := operand.(*MetricRef); ok && !seen[ref.Key()] {
+			seen[ref.Key()] = true
+			keys = append(keys, ref.Key())
+		}
+	}
+	walkComparisons(c.Expr, func(comparison *Comparison) {
+		addOperand(comparison.Left)
+		addOperand(comparison.Right)
+	})
+	return keys
+}
+
+// SetUnits sets the units metric values are recorded in, so literals with a
+// unit are compared in the unit of the metric: 1s against a metric in ms is
+// 1000. Literals without a unit are compared with metric values as they are.
+func (c *Condition) SetUnits(units Units) {
+	walkComparisons(c.Expr, func(comparison *Comparison) {
+		if ref, ok := comparison.Left.(*MetricRef); ok {
+			if number, ok := comparison.Right.(*Number); ok {
+				number.in = units[ref.Key()]
+			}
+		}
+		if ref, ok := comparison.Right.(*MetricRef); ok {
+			if number, ok := comparison.Left.(*Number); ok {
+				number.in = units[ref.Key()]
+			}
+		}
+	})
+}
+
+// walkComparisons calls fn with every comparison in node, in order of appearance
+func walkComparisons(node Node, fn func(*Comparison)) {
+	switch n := node.(type) {
+	case *Logical:
+		walkComparisons(n.Left, fn)
+		walkComparisons(n.Right, fn)
+	case *Not:
+		walkComparisons(n.Expr, fn)
+	case *Comparison:
+		fn(n)
+	}
+}
+
+func (c *Condition) String() string {
+	return c.Expr.String()
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) unexpected(tok token) error {
+	if tok.kind == tokenEOF {
+		return &SyntaxError{Pos: tok.pos, Msg: "unexpected end of condition"}
+	}
+	return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s %q", tok.kind, tok.text)}
+}
+
+// parseOr handles OR, which binds looser than AND
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{And: true, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	switch p.peek().kind {
+	case tokenNot:
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	case tokenLParen:
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokenRParen {
+			return nil, p.unexpected(tok)
+		}
+		return expr, nil
+	default:
+		return p.parseComparison()
+	}
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	start := p.peek()
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.next()
+	if tok.kind != tokenOperator {
+		return nil, p.unexpected(tok)
+	}
+	op := Operator(tok.text)
+	if !op.valid() {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unknown operator %q", tok.text)}
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	_, leftIsMetric := left.(*MetricRef)
+	_, rightIsMetric := right.(*MetricRef)
+	if !leftIsMetric && !rightIsMetric {
+		return nil, &SyntaxError{Pos: start.pos, Msg: "comparison must reference a metric"}
+	}
+
+	return &Comparison{Left: left, Op: op, Right: right}, nil
+}
+
+func (p *parser) parseOperand() (Operand, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		number := &Number{Literal: value}
+		if next := p.peek(); next.kind == tokenIdent {
+			unit, ok := lookupUnit(next.text)
+			if !ok {
+				return nil, &SyntaxError{Pos: next.pos, Msg: fmt.Sprintf("unknown unit %q", next.text)}
+			}
+			p.next()
+			number.Unit = unit
+		}
+		return number, nil
+	case tokenIdent:
+		if tok.text == "%" {
+			return nil, p.unexpected(tok)
+		}
+		ref := &MetricRef{Name: tok.text}
+		if p.peek().kind == tokenLParen {
+			p.next()
+			ref.call = true
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			ref.Args = args
+		}
+		return ref, nil
+	default:
+		return nil, p.unexpected(tok)
+	}
+}
+
+func (p *parser) parseArgs() ([]string, error) {
+	var args []string
+	if p.peek().kind == tokenRParen {
+		p.next()
+		return args, nil
+	}
+	for {
+		tok := p.next()
+		if tok.kind != tokenIdent && tok.kind != tokenNumber {
+			return nil, p.unexpected(tok)
+		}
+		args = append(args, tok.text)
+
+		switch sep := p.next(); sep.kind {
+		case tokenComma:
+			continue
+		case tokenRParen:
+			return args, nil
+		default:
+			return nil, p.unexpected(sep)
+		}
+	}
+}
+
+func (o Operator) valid() bool {
+	switch o {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,159 @@
+package condition
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"simple comparison", "cpu_usage > 80", "cpu_usage > 80"},
+		{"all operators", "a >= 1 AND b <= 2 AND c < 3 AND d == 4 AND e != 5", "((((a >= 1 AND b <= 2) AND c < 3) AND d == 4) AND e != 5)"},
+		{"AND binds tighter than OR", "a > 1 OR b > 2 AND c > 3", "(a > 1 OR (b > 2 AND c > 3))"},
+		{"parentheses override precedence", "(a > 1 OR b > 2) AND c > 3", "((a > 1 OR b > 2) AND c > 3)"},
+		{"symbolic operators", "a > 1 && !(b > 2) || c > 3", "((a > 1 AND NOT b > 2) OR c > 3)"},
+		{"lowercase keywords", "a > 1 and not b > 2", "(a > 1 AND NOT b > 2)"},
+		{"units", "memory > 1GB AND latency < 250ms", "(memory > 1GB AND latency < 250ms)"},
+		{"function references", "anomaly(api, latency) > 3.0 sigma", "anomaly(api, latency) > 3 sigma"},
+		{"literal on the left", "90 < cpu", "90 < cpu"},
+		{"negative numbers", "temperature > -5", "temperature > -5"},
+		{"dotted names", "api.error-rate >= 0.5%", "api.error-rate >= 0.5%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, parsed.String())
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		pos   int
+	}{
+		{"empty", "   ", 0},
+		{"missing operator", "cpu 80", 4},
+		{"missing right operand", "cpu >", 5},
+		{"single equals", "cpu = 80", 4},
+		{"unknown character", "cpu > 80 ; drop", 9},
+		{"unbalanced parenthesis", "(cpu > 80", 9},
+		{"trailing tokens", "cpu > 80)", 8},
+		{"dangling AND", "cpu > 80 AND", 12},
+		{"unknown unit", "memory > 1 parsecs", 11},
+		{"no metric", "5 > 3", 0},
+		{"unterminated call", "anomaly(api, latency > 3", 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			require.Error(t, err)
+
+			var syntaxErr *SyntaxError
+			require.True(t, errors.As(err, &syntaxErr), err.Error())
+			assert.Equal(t, tt.pos, syntaxErr.Pos)
+			assert.Error(t, Validate(tt.input))
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	metrics := Metrics{
+		"cpu":                   85,
+		"memory":                2 << 30,
+		"latency":               0.3,
+		"anomaly(api, latency)": 4.2,
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"cpu > 80", true},
+		{"cpu <= 80", false},
+		{"cpu == 85 AND cpu != 86", true},
+		{"memory > 1GB", true},
+		{"memory > 3GB", false},
+		{"latency < 250ms", false},
+		{"latency < 1s", true},
+		{"cpu > 90 OR memory > 1GB", true},
+		{"cpu > 90 OR (memory > 1GB AND latency > 1s)", false},
+		{"NOT cpu > 90", true},
+		{"anomaly(api, latency) > 3 sigma", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			parsed, err := Parse(tt.input)
+			require.NoError(t, err)
+			result, err := parsed.Evaluate(metrics)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	t.Run("should fail on missing metrics", func(t *testing.T) {
+		parsed, err := Parse("disk > 10GB")
+		require.NoError(t, err)
+		_, err = parsed.Evaluate(metrics)
+		assert.ErrorContains(t, err, "metric 'disk' has no value")
+	})
+
+	t.Run("should short-circuit before missing metrics", func(t *testing.T) {
+		parsed, err := Parse("cpu > 80 OR disk > 10GB")
+		require.NoError(t, err)
+		result, err := parsed.Evaluate(metrics)
+		require.NoError(t, err)
+		assert.True(t, result)
+	})
+
+	t.Run("should list referenced metrics", func(t *testing.T) {
+		parsed, err := Parse("cpu > 80 AND (anomaly(api, latency) > 3 sigma OR cpu > 95)")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cpu", "anomaly(api, latency)"}, parsed.References())
+	})
+}
+
+func TestSetUnits(t *testing.T) {
+	evaluate := func(input string, value float64, unit string) bool {
+		parsed, err := Parse(input)
+		require.NoError(t, err)
+		parsed.SetUnits(Units{"latency": unit})
+		fired, err := parsed.Evaluate(Metrics{"latency": value})
+		require.NoError(t, err)
+		return fired
+	}
+
+	t.Run("should compare bare literals with the recorded value", func(t *testing.T) {
+		assert.True(t, evaluate("latency > 250", 300, "ms"))
+		assert.False(t, evaluate("latency > 250", 200, "ms"))
+	})
+
+	t.Run("should convert unit literals into the metric's unit", func(t *testing.T) {
+		assert.True(t, evaluate("latency > 250ms AND latency < 1s", 300, "ms"))
+		assert.True(t, evaluate("latency < 2m", 90, "s"))
+		assert.True(t, evaluate("1s < latency", 1200, "ms"), "literals convert on either side")
+		assert.True(t, evaluate("latency >= 1gb", 1024, "MB"))
+	})
+
+	t.Run("should compare m literals with metrics recorded in m as they are", func(t *testing.T) {
+		assert.True(t, evaluate("latency > 5m", 6, "m"))
+		assert.False(t, evaluate("latency > 60s", 6, "m"), "m may be meters")
+	})
+
+	t.Run("should scale unit literals to base units without a known metric unit", func(t *testing.T) {
+		assert.True(t, evaluate("latency > 250ms", 0.3, ""))
+		assert.True(t, evaluate("latency > 1KB", 2000, "requests"))
+	})
+}
@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config configures a monitor Service
+type Config struct {
+	// MaxBatchSize is the most metrics accepted in one ingest request
+	MaxBatchSize int `json:"max_batch_size" yaml:"max_batch_size"`
+	// MaxConcurrentBatches is how many ingest batches are written at once
+	MaxConcurrentBatches int `json:"max_concurrent_batches" yaml:"max_concurrent_batches"`
+	// MetricQueryTimeout bounds each service's query when fetching several
+	MetricQueryTimeout time.Duration `json:"metric_query_timeout" yaml:"metric_query_timeout"`
+	// RollupDelay is how long after a bucket ends it is rolled up
+	RollupDelay time.Duration `json:"rollup_delay" yaml:"rollup_delay"`
+	// MetricRetention is how long raw points are kept; zero keeps them all.
+	// It must outlast the rollups of the points' hour.
+	MetricRetention time.Duration `json:"metric_retention" yaml:"metric_retention"`
+	// AlertEvaluationInterval is how often alert conditions are evaluated
+	AlertEvaluationInterval time.Duration `json:"alert_evaluation_interval" yaml:"alert_evaluation_interval"`
+	// MaxSeriesPerMetric is how many distinct tag combinations each metric
+	// may have; zero means unlimited
+	MaxSeriesPerMetric int `json:"max_series_per_metric" yaml:"max_series_per_metric"`
+	// CardinalityMode is whether points beyond the series limit are rejected
+	// or dropped
+	CardinalityMode CardinalityMode `json:"cardinality_mode" yaml:"cardinality_mode"`
+	// Notifications configures how alert transitions are grouped into
+	// notifications, which are logged through LogNotifier
+	Notifications NotificationConfig `json:"notifications" yaml:"notifications"`
+}
+
+// DefaultConfig returns the settings NewService uses, plus the default
+// notification grouping
+func DefaultConfig() Config {
+	return Config{
+		MaxBatchSize:            DefaultMaxBatchSize,
+		MaxConcurrentBatches:    DefaultMaxConcurrentBatch,
+		MetricQueryTimeout:      DefaultMetricQueryTimeout,
+		RollupDelay:             DefaultRollupDelay,
+		AlertEvaluationInterval: DefaultAlertEvaluationInterval,
+		MaxSeriesPerMetric:      DefaultMaxSeriesPerMetric,
+		CardinalityMode:         CardinalityReject,
+		Notifications:           DefaultNotificationConfig(),
+	}
+}
+
+// Validate checks the batch, query, retention and cardinality settings,
+// including that metrics are kept long enough to be rolled up, and the
+// notification grouping
+func (c Config) Validate() error {
+	if c.MaxBatchSize < 1 {
+		return errors.New("max batch size must be positive")
+	}
+	if c.MaxConcurrentBatches < 1 {
+		return errors.New("max concurrent batches must be positive")
+	}
+	if c.MetricQueryTimeout <= 0 {
+		return errors.New("metric query timeout must be positive")
+	}
+	if c.RollupDelay < 0 {
+		return errors.New("rollup delay must not be negative")
+	}
+	if c.MetricRetention < 0 {
+		return errors.New("metric retention must not be negative")
+	}
+	if minimum := minMetricRetention(c.RollupDelay); c.MetricRetention > 0 && c.MetricRetention < minimum {
+		return fmt.Errorf("metric retention must be at least %s, so points are rolled up before they are deleted", minimum)
+	}
+	if c.AlertEvaluationInterval <= 0 {
+		return errors.New("alert evaluation interval must be positive")
+	}
+	if c.MaxSeriesPerMetric < 0 {
+		return errors.New("max series per metric must not be negative")
+	}
+	if c.CardinalityMode != CardinalityReject && c.CardinalityMode != CardinalityDrop {
+		return fmt.Errorf("unknown cardinality mode '%s'", c.CardinalityMode)
+	}
+	if err := c.Notifications.Validate(); err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+	return nil
+}
+
+// NewServiceWithConfig validates cfg and creates a monitor service using it.
+// Alert notifications go through LogNotifier until SetNotificationPipeline
+// replaces the pipeline.
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid monitor config: %w", err)
+	}
+	pipeline, err := NewNotificationPipeline(cfg.Notifications, LogNotifier{})
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewService()
+	s.SetMaxBatchSize(cfg.MaxBatchSize)
+	s.SetMaxConcurrentBatches(cfg.MaxConcurrentBatches)
+	s.SetMetricQueryTimeout(cfg.MetricQueryTimeout)
+	s.SetRollupDelay(cfg.RollupDelay)
+	s.SetMetricRetention(cfg.MetricRetention)
+	s.SetAlertEvaluationInterval(cfg.AlertEvaluationInterval)
+	if err := s.SetCardinalityLimit(cfg.MaxSeriesPerMetric, cfg.CardinalityMode); err != nil {
+		return nil, err
+	}
+	s.SetNotificationPipeline(pipeline)
+	return s, nil
+}
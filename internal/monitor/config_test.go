@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("should create a service from a config", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxBatchSize = 10
+		config.MetricQueryTimeout = time.Second
+		service, err := NewServiceWithConfig(config)
+		require.NoError(t, err)
+		assert.Equal(t, 10, service.MaxBatchSize())
+		assert.Equal(t, time.Second, service.metricQueryTimeout)
+		assert.NotNil(t, service.notifications)
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		for _, tc := range []struct {
+			modify func(c *Config)
+			err    string
+		}{
+			{func(c *Config) { c.MaxBatchSize = 0 }, "max batch size must be positive"},
+			{func(c *Config) { c.MaxConcurrentBatches = -1 }, "max concurrent batches must be positive"},
+			{func(c *Config) { c.MetricQueryTimeout = 0 }, "metric query timeout must be positive"},
+			{func(c *Config) { c.RollupDelay = -time.Second }, "rollup delay must not be negative"},
+			{func(c *Config) { c.MetricRetention = -time.Hour }, "metric retention must not be negative"},
+			{func(c *Config) { c.MetricRetention = time.Hour }, "metric retention must be at least 1h1m0s"},
+			{func(c *Config) { c.AlertEvaluationInterval = 0 }, "alert evaluation interval must be positive"},
+			{func(c *Config) { c.MaxSeriesPerMetric = -1 }, "max series per metric must not be negative"},
+			{func(c *Config) { c.CardinalityMode = "sample" }, "unknown cardinality mode 'sample'"},
+			{func(c *Config) { c.Notifications.GroupBy = []string{"severity"} }, "notifications: unknown group by field 'severity'"},
+			{func(c *Config) { c.Notifications.FlushInterval = 0 }, "notifications: flush interval must be positive"},
+		} {
+			config := DefaultConfig()
+			tc.modify(&config)
+			assert.ErrorContains(t, config.Validate(), tc.err)
+			_, err := NewServiceWithConfig(config)
+			assert.ErrorContains(t, err, "invalid monitor config")
+		}
+	})
+}
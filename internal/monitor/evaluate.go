@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/internal/monitor/condition"
+)
+
+// DefaultAlertEvaluationInterval is how often alert conditions are evaluated
+const DefaultAlertEvaluationInterval = 30 * time.Second
+
+const alertEvaluationJobName = "monitor.alert-evaluation"
+
+// SetAlertEvaluationInterval sets how often Start evaluates alert conditions
+func (s *Service) SetAlertEvaluationInterval(interval time.Duration) {
+	s.alertEvaluationInterval = interval
+}
+
+// EvaluateAlerts evaluates the condition of every active or triggered alert
+// against the latest stored metrics, moving an alert to AlertStatusTriggered
+// when its condition holds and back to AlertStatusActive when it clears
+func (s *Service) EvaluateAlerts(ctx context.Context) error {
+	var alerts []*Alert
+	err := s.db.WithContext(ctx).
+		Where("status IN ?", []AlertStatus{AlertStatusActive, AlertStatusTriggered}).
+		Order("id").
+		Find(&alerts).Error
+	if err != nil {
+		return fmt.Errorf("failed to get alerts: %w", err)
+	}
+
+	// Alerts often share metrics, so each is looked up once per evaluation
+	values := make(map[string]*metricReading)
+	var errs []error
+	for _, alert := range alerts {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		// A failing alert does not stop the others; errors are returned together
+		if err := s.evaluateAlert(ctx, alert, values); err != nil {
+			errs = append(errs, fmt.Errorf("alert %d: %w", alert.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) evaluateAlert(ctx context.Context, alert *Alert, values map[string]*metricReading) error {
+	parsed, err := condition.Parse(alert.Condition)
+	if err != nil {
+		return err
+	}
+	metrics, missing, err := s.resolveMetrics(ctx, parsed, values)
+	// An alert reading a metric with no points keeps its status
+	if err != nil || missing != "" {
+		return err
+	}
+
+	holds, err := parsed.Evaluate(metrics)
+	if err != nil {
+		return err
+	}
+	status := AlertStatusActive
+	if holds {
+		status = AlertStatusTriggered
+	}
+	return s.SetAlertStatus(ctx, alert.ID, status)
+}
+
+// EvaluateCondition previews an alert condition against the latest stored
+// metrics, as EvaluateAlerts would, without creating an alert. detail
+// lists the value of each metric the condition reads, such as
+// "cpu_usage = 95, api/errors = 3", or names the first metric without points,
+// in which case the condition does not fire. Malformed conditions return a
+// *condition.SyntaxError.
+func (s *Service) EvaluateCondition(ctx context.Context, input string) (bool, string, error) {
+	parsed, err := condition.Parse(input)
+	if err != nil {
+		return false, "", err
+	}
+	metrics, missing, err := s.resolveMetrics(ctx, parsed, make(map[string]*metricReading))
+	if err != nil {
+		return false, "", err
+	}
+	if missing != "" {
+		return false, fmt.Sprintf("metric '%s' has no value", missing), nil
+	}
+
+	fired, err := parsed.Evaluate(metrics)
+	if err != nil {
+		return false, "", err
+	}
+	references := parsed.References()
+	matched := make([]string, 0, len(references))
+	for _, key := range references {
+		matched = append(matched, fmt.Sprintf("%s = %g", key, metrics[key]))
+	}
+	return fired, strings.Join(matched, ", "), nil
+}
+
+// metricReading is the current value of a metric and the unit it is recorded in
+type metricReading struct {
+	value float64
+	unit  string
+}
+
+// resolveMetrics looks up every metric a condition reads, caching readings by
+// key, and sets their units on the condition so unit literals are compared in
+// them. If one has no points its key is returned as missing.
+func (s *Service) resolveMetrics(ctx context.Context, parsed *condition.Condition, values map[string]*metricReading) (condition.Metrics, string, error) {
+	metrics := make(condition.Metrics)
+	units := make(condition.Units)
+	for _, key := range parsed.References() {
+		reading, cached := values[key]
+		if !cached {
+			var err error
+			if reading, err = s.metricValue(ctx, key); err != nil {
+				return nil, "", err
+			}
+			values[key] = reading
+		}
+		if reading == nil {
+			return nil, key, nil
+		}
+		metrics[key] = reading.value
+		units[key] = reading.unit
+	}
+	parsed.SetUnits(units)
+	return metrics, "", nil
+}
+
+// metricValue resolves a metric reference of a condition to its current
+// value, or nil if it has none. References are resolved as:
+//
+//	cpu_usage                 the latest point named cpu_usage, of any service
+//	api/cpu_usage             the latest point named cpu_usage of service api
+//	anomaly(api, latency)     the z-score of the latest latency point of api
+//	                          against the points before it, as in DetectAnomalies
+func (s *Service) metricValue(ctx context.Context, key string) (*metricReading, error) {
+	if name, args, ok := strings.Cut(key, "("); ok {
+		if name != "anomaly" {
+			return nil, fmt.Errorf("unsupported function '%s'", name)
+		}
+		parts := strings.Split(strings.TrimSuffix(args, ")"), ",")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("anomaly takes a service and a metric, got '%s'", key)
+		}
+		score, err := s.anomalyScore(ctx, strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		if score == nil || err != nil {
+			return nil, err
+		}
+		return &metricReading{value: *score}, nil
+	}
+
+	query := s.db.WithContext(ctx).Where("name = ?", key)
+	if serviceName, metricName, ok := strings.Cut(key, "/"); ok {
+		query = s.db.WithContext(ctx).Where("service_name = ? AND name = ?", serviceName, metricName)
+	}
+	var latest []Metric
+	if err := query.Order("timestamp DESC, id DESC").Limit(1).Find(&latest).Error; err != nil {
+		return nil, fmt.Errorf("failed to get metric '%s': %w", key, err)
+	}
+	if len(latest) == 0 {
+		return nil, nil
+	}
+	return &metricReading{value: latest[0].Value, unit: latest[0].Unit}, nil
+}
+
+// anomalyScore returns how many standard deviations the latest point of a
+// metric lies from the points before it, or nil with too little history. A
+// deviation from a perfectly flat baseline scores +Inf.
+func (s *Service) anomalyScore(ctx context.Context, serviceName, metricName string) (*float64, error) {
+	baselineSize := s.anomalyBaseline
+	if baselineSize < minAnomalyBaseline {
+		baselineSize = minAnomalyBaseline
+	}
+
+	var recent []*Metric
+	err := s.db.WithContext(ctx).
+		Where("service_name = ? AND name = ?", serviceName, metricName).
+		Order("timestamp DESC, id DESC").
+		Limit(baselineSize + 1).
+		Find(&recent).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
+	}
+	if len(recent) <= minAnomalyBaseline {
+		return nil, nil
+	}
+
+	mean, stdDev := meanStdDev(recent[1:])
+	deviation := math.Abs(recent[0].Value - mean)
+	score := 0.0
+	switch {
+	case stdDev > 0:
+		score = deviation / stdDev
+	case deviation > 0:
+		score = math.Inf(1)
+	}
+	return &score, nil
+}
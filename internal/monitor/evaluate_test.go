@@ -0,0 +1,188 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/internal/monitor/condition"
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateAlerts(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	trigger := &fakeWorkflowTrigger{}
+	service.SetWorkflowTrigger(trigger)
+
+	base := time.Now().Add(-time.Hour)
+	seed := func(serviceName, name string, value float64, offset time.Duration) {
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: serviceName, Name: name, Value: value, Timestamp: base.Add(offset)}))
+	}
+	create := func(condition string, status AlertStatus) *Alert {
+		alert := &Alert{Name: condition, UserID: "user1", Condition: condition, Status: status, OnTriggerWorkflowID: 7}
+		require.NoError(t, service.CreateAlert(ctx, alert))
+		return alert
+	}
+	status := func(alert *Alert) *Alert {
+		var stored Alert
+		require.NoError(t, db.First(&stored, alert.ID).Error)
+		return &stored
+	}
+
+	seed("api", "cpu_usage", 95, 0)
+	seed("web", "cpu_usage", 50, time.Minute)
+	seed("api", "errors", 3, 0)
+
+	t.Run("should trigger alerts whose condition holds and record when", func(t *testing.T) {
+		high := create("cpu_usage > 40", AlertStatusActive)
+		scoped := create("api/cpu_usage >= 95", AlertStatusActive)
+		quiet := create("errors == 0", AlertStatusActive)
+		both := create("cpu_usage < 60 AND api/errors <= 3", AlertStatusActive)
+
+		before := time.Now()
+		require.NoError(t, service.EvaluateAlerts(ctx))
+
+		for _, alert := range []*Alert{high, scoped, both} {
+			stored := status(alert)
+			assert.Equal(t, AlertStatusTriggered, stored.Status, alert.Condition)
+			require.NotNil(t, stored.StatusChangedAt, alert.Condition)
+			assert.False(t, stored.StatusChangedAt.Before(before.Truncate(time.Second)))
+			require.NotNil(t, stored.LastTriggeredAt)
+		}
+		assert.Equal(t, AlertStatusActive, status(quiet).Status)
+		assert.Nil(t, status(quiet).StatusChangedAt)
+		assert.Len(t, trigger.calls, 3)
+
+		require.NoError(t, db.Delete(&Alert{}, []uint{high.ID, scoped.ID, quiet.ID, both.ID}).Error)
+	})
+
+	t.Run("should return triggered alerts to active when the condition clears", func(t *testing.T) {
+		alert := create("web/cpu_usage > 80", AlertStatusTriggered)
+		seed("web", "cpu_usage", 90, 2*time.Minute)
+		require.NoError(t, service.EvaluateAlerts(ctx))
+		assert.Equal(t, AlertStatusTriggered, status(alert).Status)
+
+		seed("web", "cpu_usage", 10, 3*time.Minute)
+		require.NoError(t, service.EvaluateAlerts(ctx))
+		stored := status(alert)
+		assert.Equal(t, AlertStatusActive, stored.Status)
+		assert.NotNil(t, stored.StatusChangedAt)
+
+		require.NoError(t, db.Delete(alert).Error)
+	})
+
+	t.Run("should skip inactive alerts and alerts without data", func(t *testing.T) {
+		inactive := create("cpu_usage > 0", AlertStatusInactive)
+		missing := create("memory > 0", AlertStatusActive)
+		require.NoError(t, service.EvaluateAlerts(ctx))
+		assert.Equal(t, AlertStatusInactive, status(inactive).Status)
+		assert.Equal(t, AlertStatusActive, status(missing).Status)
+
+		require.NoError(t, db.Delete(&Alert{}, []uint{inactive.ID, missing.ID}).Error)
+	})
+
+	t.Run("should score anomalies against recent history", func(t *testing.T) {
+		for i, value := range []float64{10, 11, 10, 9, 10, 11, 10, 500} {
+			seed("api", "latency", value, time.Duration(i)*time.Second)
+		}
+		alert := create("anomaly(api, latency) > 3 sigma", AlertStatusActive)
+		require.NoError(t, service.EvaluateAlerts(ctx))
+		assert.Equal(t, AlertStatusTriggered, status(alert).Status)
+
+		require.NoError(t, db.Delete(alert).Error)
+	})
+
+	t.Run("should keep evaluating after an alert fails", func(t *testing.T) {
+		broken := create("cpu_usage > 1", AlertStatusActive)
+		require.NoError(t, db.Model(broken).Update("condition", "cpu_usage >").Error)
+		unknown := create("median(api, latency) > 1", AlertStatusActive)
+		working := create("cpu_usage > 1", AlertStatusActive)
+
+		err := service.EvaluateAlerts(ctx)
+		assert.ErrorContains(t, err, "alert ")
+		assert.ErrorContains(t, err, "unsupported function 'median'")
+		assert.Equal(t, AlertStatusTriggered, status(working).Status)
+		assert.Equal(t, AlertStatusActive, status(unknown).Status)
+	})
+
+	t.Run("should schedule evaluation on start", func(t *testing.T) {
+		scheduler := core.NewScheduler()
+		service.SetScheduler(scheduler)
+		service.Start()
+
+		names := make([]string, 0)
+		for _, job := range scheduler.Jobs() {
+			names = append(names, job.Name)
+		}
+		assert.Contains(t, names, alertEvaluationJobName)
+
+		require.NoError(t, service.Close(ctx))
+		assert.Empty(t, scheduler.Jobs())
+	})
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+
+	now := time.Now()
+	require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "cpu_usage", Value: 95, Timestamp: now}))
+	require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "errors", Value: 3, Timestamp: now}))
+
+	t.Run("should report a firing condition with its metric values", func(t *testing.T) {
+		fired, detail, err := service.EvaluateCondition(ctx, "cpu_usage > 80 AND api/errors >= 3")
+		require.NoError(t, err)
+		assert.True(t, fired)
+		assert.Equal(t, "cpu_usage = 95, api/errors = 3", detail)
+	})
+
+	t.Run("should report a condition that does not fire", func(t *testing.T) {
+		fired, detail, err := service.EvaluateCondition(ctx, "cpu_usage < 50")
+		require.NoError(t, err)
+		assert.False(t, fired)
+		assert.Equal(t, "cpu_usage = 95", detail)
+
+		fired, detail, err = service.EvaluateCondition(ctx, "memory > 0")
+		require.NoError(t, err)
+		assert.False(t, fired)
+		assert.Equal(t, "metric 'memory' has no value", detail)
+	})
+
+	t.Run("should compare metrics and literals in the same units", func(t *testing.T) {
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "latency", Value: 300, Unit: "ms", Timestamp: now}))
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "heap", Value: 512, Unit: "MB", Timestamp: now}))
+
+		fired, detail, err := service.EvaluateCondition(ctx, "latency > 250ms AND latency < 1s")
+		require.NoError(t, err)
+		assert.True(t, fired)
+		assert.Equal(t, "latency = 300", detail)
+
+		// Bare literals are in the metric's own unit
+		fired, _, err = service.EvaluateCondition(ctx, "latency > 250")
+		require.NoError(t, err)
+		assert.True(t, fired)
+
+		fired, _, err = service.EvaluateCondition(ctx, "heap > 1GB")
+		require.NoError(t, err)
+		assert.False(t, fired)
+	})
+
+	t.Run("should return parse errors", func(t *testing.T) {
+		_, _, err := service.EvaluateCondition(ctx, "cpu_usage >")
+		var syntaxErr *condition.SyntaxError
+		assert.ErrorAs(t, err, &syntaxErr)
+	})
+
+	t.Run("should not create an alert", func(t *testing.T) {
+		var count int64
+		require.NoError(t, db.Model(&Alert{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+}
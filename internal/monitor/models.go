@@ -8,12 +8,12 @@ import (
 
 type Metric struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
-	ServiceName string    `json:"service_name" gorm:"index;not null"`
-	Name        string    `json:"name" gorm:"not null"`
-	Value       float64   `json:"value"`
+	ServiceName string    `json:"service_name" gorm:"index;index:idx_metrics_series_value,priority:1;index:idx_metrics_series_time,priority:1;not null"`
+	Name        string    `json:"name" gorm:"index:idx_metrics_series_value,priority:2;index:idx_metrics_series_time,priority:2;not null"`
+	Value       float64   `json:"value" gorm:"index:idx_metrics_series_value,priority:3"`
 	Unit        string    `json:"unit"`
 	Tags        string    `json:"tags"`
-	Timestamp   time.Time `json:"timestamp"`
+	Timestamp   time.Time `json:"timestamp" gorm:"index:idx_metrics_series_time,priority:3"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -28,9 +28,17 @@ type Alert struct {
 	UserID      string      `json:"user_id" gorm:"index;not null"`
 	Condition   string      `json:"condition" gorm:"not null"`
 	Status      AlertStatus `json:"status" gorm:"default:0"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	// OnTriggerWorkflowID is the workflow executed when the alert fires (0 = none)
+	OnTriggerWorkflowID uint           `json:"on_trigger_workflow_id"`
+	// IntegrationID is the hub integration notified when the alert fires or
+	// resolves (0 = none)
+	IntegrationID       uint           `json:"integration_id"`
+	LastTriggeredAt     *time.Time     `json:"last_triggered_at"`
+	// StatusChangedAt is when the alert last moved to its current status
+	StatusChangedAt     *time.Time     `json:"status_changed_at"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (Alert) TableName() string {
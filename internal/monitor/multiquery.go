@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMetricQueryTimeout bounds each service's query in GetMetricsForServices
+	DefaultMetricQueryTimeout = 5 * time.Second
+	// MaxMetricQueryServices caps how many services GetMetricsForServices queries at once
+	MaxMetricQueryServices = 50
+	// MaxConcurrentMetricQueries caps how many of those queries run at a time
+	MaxConcurrentMetricQueries = 8
+	// MaxMetricsPerService caps how many of each service's most recent
+	// metrics GetMetricsForServices returns
+	MaxMetricsPerService = 1000
+)
+
+// ServiceMetricsError reports why the metrics of one service could not be fetched
+type ServiceMetricsError struct {
+	Service  string `json:"service"`
+	Error    string `json:"error"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+}
+
+// MultiServiceMetrics holds the metrics of every service that could be
+// queried, and an error for each that could not
+type MultiServiceMetrics struct {
+	Metrics map[string][]*Metric  `json:"metrics"`
+	Errors  []ServiceMetricsError `json:"errors,omitempty"`
+	// Truncated lists the services with more than MaxMetricsPerService metrics
+	Truncated []string `json:"truncated,omitempty"`
+	// Partial is set when some, but not all, services failed
+	Partial bool `json:"partial"`
+}
+
+// Failed reports whether no service could be queried
+func (m *MultiServiceMetrics) Failed() bool {
+	return len(m.Metrics) == 0 && len(m.Errors) > 0
+}
+
+// SetMetricQueryTimeout sets how long each service's query in
+// GetMetricsForServices may take. A non-positive timeout restores
+// DefaultMetricQueryTimeout.
+func (s *Service) SetMetricQueryTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultMetricQueryTimeout
+	}
+	s.metricQueryTimeout = timeout
+}
+
+// GetMetricsForServices queries the most recent metrics of several services,
+// up to MaxConcurrentMetricQueries at a time and each bounded by the metric
+// query timeout. A service whose query fails or times out is reported in
+// Errors rather than failing the whole fetch, so a dashboard can still show
+// the others. Duplicate and blank names are ignored.
+func (s *Service) GetMetricsForServices(ctx context.Context, serviceNames []string) (*MultiServiceMetrics, error) {
+	names := make([]string, 0, len(serviceNames))
+	seen := make(map[string]bool, len(serviceNames))
+	for _, name := range serviceNames {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: at least one service is required", ErrInvalidQuery)
+	}
+	if len(names) > MaxMetricQueryServices {
+		return nil, fmt.Errorf("%w: too many services in one query", ErrInvalidQuery)
+	}
+
+	type outcome struct {
+		metrics []*Metric
+		err     error
+	}
+	outcomes := make([]outcome, len(names))
+	slots := make(chan struct{}, MaxConcurrentMetricQueries)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				outcomes[i] = outcome{err: ctx.Err()}
+				return
+			}
+
+			// The timeout starts once the query may run
+			queryCtx, cancel := context.WithTimeout(ctx, s.metricQueryTimeout)
+			defer cancel()
+			metrics, err := s.queryServiceMetrics(queryCtx, name)
+			if err == nil && queryCtx.Err() != nil {
+				err = queryCtx.Err()
+			}
+			outcomes[i] = outcome{metrics: metrics, err: err}
+		}(i, name)
+	}
+	wg.Wait()
+
+	result := &MultiServiceMetrics{Metrics: make(map[string][]*Metric)}
+	for i, name := range names {
+		if err := outcomes[i].err; err != nil {
+			result.Errors = append(result.Errors, ServiceMetricsError{
+				Service:  name,
+				Error:    err.Error(),
+				TimedOut: errors.Is(err, context.DeadlineExceeded),
+			})
+			continue
+		}
+		metrics := outcomes[i].metrics
+		if len(metrics) > MaxMetricsPerService {
+			metrics = metrics[:MaxMetricsPerService]
+			result.Truncated = append(result.Truncated, name)
+		}
+		result.Metrics[name] = metrics
+	}
+	result.Partial = len(result.Errors) > 0 && len(result.Metrics) > 0
+	return result, nil
+}
+
+// recentMetrics returns a service's most recent metrics, newest first, one
+// more than MaxMetricsPerService so truncation can be detected
+func (s *Service) recentMetrics(ctx context.Context, serviceName string) ([]*Metric, error) {
+	var metrics []*Metric
+	err := s.db.WithContext(ctx).
+		Where("service_name = ?", serviceName).
+		Order("timestamp DESC, id DESC").
+		Limit(MaxMetricsPerService + 1).
+		Find(&metrics).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
+	}
+	return metrics, nil
+}
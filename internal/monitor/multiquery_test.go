@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMetricsForServices(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *Service {
+		db := setupTestDB(t)
+		// Queries run concurrently and each in-memory connection is a separate database
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		sqlDB.SetMaxOpenConns(1)
+
+		service := NewService()
+		service.SetDB(db)
+		for _, name := range []string{"vault", "flow", "task"} {
+			require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: name, Name: "requests", Value: 1, Timestamp: time.Now()}))
+		}
+		return service
+	}
+
+	t.Run("should return every service's metrics", func(t *testing.T) {
+		service := setup(t)
+
+		result, err := service.GetMetricsForServices(ctx, []string{"vault", "flow", "vault", " "})
+		require.NoError(t, err)
+		assert.Len(t, result.Metrics, 2)
+		assert.Len(t, result.Metrics["vault"], 1)
+		assert.Len(t, result.Metrics["flow"], 1)
+		assert.Empty(t, result.Errors)
+		assert.False(t, result.Partial)
+	})
+
+	t.Run("should return the other services when one query fails", func(t *testing.T) {
+		service := setup(t)
+		service.queryServiceMetrics = func(ctx context.Context, serviceName string) ([]*Metric, error) {
+			if serviceName == "flow" {
+				return nil, errors.New("database unavailable")
+			}
+			return service.GetMetrics(ctx, serviceName)
+		}
+
+		result, err := service.GetMetricsForServices(ctx, []string{"vault", "flow", "task"})
+		require.NoError(t, err)
+		assert.True(t, result.Partial)
+		assert.False(t, result.Failed())
+		assert.Len(t, result.Metrics["vault"], 1)
+		assert.Len(t, result.Metrics["task"], 1)
+		assert.NotContains(t, result.Metrics, "flow")
+		assert.Equal(t, []ServiceMetricsError{{Service: "flow", Error: "database unavailable"}}, result.Errors)
+	})
+
+	t.Run("should time out a slow query without waiting for it", func(t *testing.T) {
+		service := setup(t)
+		service.SetMetricQueryTimeout(50 * time.Millisecond)
+		service.queryServiceMetrics = func(ctx context.Context, serviceName string) ([]*Metric, error) {
+			if serviceName == "task" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return service.GetMetrics(ctx, serviceName)
+		}
+
+		start := time.Now()
+		result, err := service.GetMetricsForServices(ctx, []string{"vault", "task"})
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.True(t, result.Partial)
+		assert.Len(t, result.Metrics["vault"], 1)
+		require.Len(t, result.Errors, 1)
+		assert.Equal(t, "task", result.Errors[0].Service)
+		assert.True(t, result.Errors[0].TimedOut)
+	})
+
+	t.Run("should report when every query fails", func(t *testing.T) {
+		service := setup(t)
+		service.queryServiceMetrics = func(ctx context.Context, serviceName string) ([]*Metric, error) {
+			return nil, errors.New("database unavailable")
+		}
+
+		result, err := service.GetMetricsForServices(ctx, []string{"vault", "flow"})
+		require.NoError(t, err)
+		assert.True(t, result.Failed())
+		assert.False(t, result.Partial)
+		assert.Len(t, result.Errors, 2)
+	})
+
+	t.Run("should run a limited number of queries at a time", func(t *testing.T) {
+		service := setup(t)
+		var running, peak int32
+		service.queryServiceMetrics = func(ctx context.Context, serviceName string) ([]*Metric, error) {
+			now := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				seen := atomic.LoadInt32(&peak)
+				if now <= seen || atomic.CompareAndSwapInt32(&peak, seen, now) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return nil, nil
+		}
+
+		names := make([]string, MaxMetricQueryServices)
+		for i := range names {
+			names[i] = fmt.Sprintf("service-%d", i)
+		}
+		result, err := service.GetMetricsForServices(ctx, names)
+		require.NoError(t, err)
+		assert.Len(t, result.Metrics, MaxMetricQueryServices)
+		assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(MaxConcurrentMetricQueries))
+	})
+
+	t.Run("should cap the metrics returned per service", func(t *testing.T) {
+		service := setup(t)
+		metrics := make([]*Metric, MaxMetricsPerService+1)
+		for i := range metrics {
+			metrics[i] = &Metric{ServiceName: "vault", Name: "requests", Value: float64(i), Timestamp: time.Now().Add(time.Duration(i) * time.Second)}
+		}
+		require.NoError(t, service.db.CreateInBatches(metrics, 500).Error)
+
+		result, err := service.GetMetricsForServices(ctx, []string{"vault", "flow"})
+		require.NoError(t, err)
+		require.Len(t, result.Metrics["vault"], MaxMetricsPerService)
+		assert.Equal(t, float64(MaxMetricsPerService), result.Metrics["vault"][0].Value, "newest first")
+		assert.Len(t, result.Metrics["flow"], 1)
+		assert.Equal(t, []string{"vault"}, result.Truncated)
+	})
+
+	t.Run("should require a service", func(t *testing.T) {
+		_, err := setup(t).GetMetricsForServices(ctx, nil)
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	})
+}
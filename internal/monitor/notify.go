@@ -0,0 +1,305 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+// NotificationState is whether a notification announces alerts firing or resolved
+type NotificationState string
+
+const (
+	NotificationFiring   NotificationState = "firing"
+	NotificationResolved NotificationState = "resolved"
+)
+
+// Notification reports the alerts of one group. For a firing notification
+// Alerts are those currently firing; for a resolved one, those that were last
+// notified as firing.
+type Notification struct {
+	GroupKey string            `json:"group_key"`
+	State    NotificationState `json:"state"`
+	UserID   string            `json:"user_id"`
+	Alerts   []*Alert          `json:"alerts"`
+	SentAt   time.Time         `json:"sent_at"`
+}
+
+// Notifier delivers alert notifications
+type Notifier interface {
+	Notify(ctx context.Context, notification *Notification) error
+}
+
+// LogNotifier writes notifications to the standard logger
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, notification *Notification) error {
+	names := make([]string, 0, len(notification.Alerts))
+	for _, alert := range notification.Alerts {
+		names = append(names, alert.Name)
+	}
+	log.Printf("🔔 [%s] %s: %s", notification.State, notification.GroupKey, strings.Join(names, ", "))
+	return nil
+}
+
+// Alert fields notifications can be grouped by
+const (
+	GroupByAlertID = "alert_id"
+	GroupByName    = "name"
+	GroupByUserID  = "user_id"
+)
+
+// NotificationConfig controls how alert notifications are grouped and paced.
+// The timings mirror Alertmanager's group_wait, group_interval and
+// repeat_interval.
+type NotificationConfig struct {
+	// GroupBy lists the alert fields whose values form a group's key. Alerts
+	// of different users are never grouped together.
+	GroupBy []string `json:"group_by" yaml:"group_by"`
+	// GroupWait is how long a new group waits before its first notification,
+	// so alerts that flap or fire together are reported once
+	GroupWait time.Duration `json:"group_wait" yaml:"group_wait"`
+	// GroupInterval is the minimum time between notifications for a group
+	GroupInterval time.Duration `json:"group_interval" yaml:"group_interval"`
+	// RepeatInterval is how often a group that stays firing is notified again
+	RepeatInterval time.Duration `json:"repeat_interval" yaml:"repeat_interval"`
+	// FlushInterval is how often the pipeline checks for due notifications
+	FlushInterval time.Duration `json:"flush_interval" yaml:"flush_interval"`
+}
+
+// DefaultNotificationConfig groups by alert and uses Alertmanager's default timings
+func DefaultNotificationConfig() NotificationConfig {
+	return NotificationConfig{
+		GroupBy:        []string{GroupByAlertID},
+		GroupWait:      30 * time.Second,
+		GroupInterval:  5 * time.Minute,
+		RepeatInterval: 4 * time.Hour,
+		FlushInterval:  time.Second,
+	}
+}
+
+// Validate reports whether the config can be used by a pipeline
+func (c NotificationConfig) Validate() error {
+	for _, field := range c.GroupBy {
+		switch field {
+		case GroupByAlertID, GroupByName, GroupByUserID:
+		default:
+			return fmt.Errorf("unknown group by field '%s'", field)
+		}
+	}
+	if c.GroupWait < 0 || c.GroupInterval < 0 || c.RepeatInterval < 0 {
+		return errors.New("notification intervals must not be negative")
+	}
+	if c.FlushInterval <= 0 {
+		return errors.New("flush interval must be positive")
+	}
+	return nil
+}
+
+// notificationGroup is the state of one group of alerts
+type notificationGroup struct {
+	key      string
+	userID   string
+	firing   map[uint]*Alert
+	since    time.Time // when the group last went from no alerts to firing
+	notified NotificationState
+	sentIDs  map[uint]bool // alerts in the last firing notification
+	sentAll  []*Alert
+	lastSent time.Time
+}
+
+// NotificationPipeline turns alert transitions into as few notifications as
+// possible. Alerts are grouped by key; a group sends one firing notification
+// after GroupWait, is rate limited to one notification per GroupInterval,
+// repeats while firing every RepeatInterval, and sends a single resolved
+// notification once all its alerts clear. An alert that flaps between
+// notifications causes none.
+type NotificationPipeline struct {
+	config   NotificationConfig
+	notifier Notifier
+	now      func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*notificationGroup
+
+	flushMu sync.Mutex
+}
+
+// NewNotificationPipeline creates a pipeline delivering through notifier
+func NewNotificationPipeline(config NotificationConfig, notifier Notifier) (*NotificationPipeline, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if len(config.GroupBy) == 0 {
+		config.GroupBy = []string{GroupByAlertID}
+	}
+	return &NotificationPipeline{
+		config:   config,
+		notifier: notifier,
+		now:      time.Now,
+		groups:   make(map[string]*notificationGroup),
+	}, nil
+}
+
+// Observe records that an alert started or stopped firing
+func (p *NotificationPipeline) Observe(alert *Alert, firing bool) {
+	key := p.groupKey(alert)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	group, ok := p.groups[key]
+	if !ok {
+		if !firing {
+			return
+		}
+		group = &notificationGroup{key: key, userID: alert.UserID, firing: make(map[uint]*Alert)}
+		p.groups[key] = group
+	}
+
+	if firing {
+		if len(group.firing) == 0 && group.notified != NotificationFiring {
+			group.since = p.now()
+		}
+		copied := *alert
+		group.firing[alert.ID] = &copied
+	} else {
+		delete(group.firing, alert.ID)
+	}
+}
+
+// Flush sends every notification that is due. A notification that fails to
+// send is retried on the next flush.
+func (p *NotificationPipeline) Flush(ctx context.Context) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	now := p.now()
+	var due []*Notification
+	p.mu.Lock()
+	for key, group := range p.groups {
+		notification := p.due(group, now)
+		if notification == nil && len(group.firing) == 0 && group.notified != NotificationFiring {
+			// Cleared before anything was sent, or already resolved
+			delete(p.groups, key)
+			continue
+		}
+		if notification != nil {
+			due = append(due, notification)
+		}
+	}
+	p.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].GroupKey < due[j].GroupKey })
+	var errs []error
+	for _, notification := range due {
+		if err := p.notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send %s notification for %s: %w", notification.State, notification.GroupKey, err))
+			continue
+		}
+		p.sent(notification)
+	}
+	return errors.Join(errs...)
+}
+
+// due returns the notification a group should send now, if any
+func (p *NotificationPipeline) due(group *notificationGroup, now time.Time) *Notification {
+	rateLimited := !group.lastSent.IsZero() && now.Sub(group.lastSent) < p.config.GroupInterval
+
+	if len(group.firing) == 0 {
+		if group.notified != NotificationFiring || rateLimited {
+			return nil
+		}
+		return &Notification{GroupKey: group.key, State: NotificationResolved, UserID: group.userID, Alerts: group.sentAll, SentAt: now}
+	}
+
+	switch {
+	case group.notified != NotificationFiring:
+		if now.Sub(group.since) < p.config.GroupWait || rateLimited {
+			return nil
+		}
+	case !sameAlerts(group.firing, group.sentIDs):
+		if rateLimited {
+			return nil
+		}
+	default:
+		if now.Sub(group.lastSent) < p.config.RepeatInterval {
+			return nil
+		}
+	}
+
+	alerts := make([]*Alert, 0, len(group.firing))
+	for _, alert := range group.firing {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].ID < alerts[j].ID })
+	return &Notification{GroupKey: group.key, State: NotificationFiring, UserID: group.userID, Alerts: alerts, SentAt: now}
+}
+
+// sent records a delivered notification against its group
+func (p *NotificationPipeline) sent(notification *Notification) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	group, ok := p.groups[notification.GroupKey]
+	if !ok {
+		return
+	}
+	group.notified = notification.State
+	group.lastSent = notification.SentAt
+	group.sentIDs = make(map[uint]bool, len(notification.Alerts))
+	if notification.State == NotificationFiring {
+		for _, alert := range notification.Alerts {
+			group.sentIDs[alert.ID] = true
+		}
+		group.sentAll = notification.Alerts
+	}
+}
+
+// groupKey builds the key of the group an alert belongs to
+func (p *NotificationPipeline) groupKey(alert *Alert) string {
+	parts := []string{"user_id=" + alert.UserID}
+	for _, field := range p.config.GroupBy {
+		switch field {
+		case GroupByAlertID:
+			parts = append(parts, fmt.Sprintf("alert_id=%d", alert.ID))
+		case GroupByName:
+			parts = append(parts, "name="+alert.Name)
+		}
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func sameAlerts(firing map[uint]*Alert, sent map[uint]bool) bool {
+	if len(firing) != len(sent) {
+		return false
+	}
+	for id := range firing {
+		if !sent[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetNotificationPipeline sets the pipeline alert transitions are sent
+// through, flushed on the scheduler by Start. Without one, alerts notify no one.
+func (s *Service) SetNotificationPipeline(pipeline *NotificationPipeline) {
+	s.notifications = pipeline
+}
+
+// SetFlushRegistry registers a hook sending the alert notifications that are
+// due, so those falling due since the last scheduled flush are sent at shutdown
+func (s *Service) SetFlushRegistry(registry *core.FlushRegistry) {
+	registry.Register("monitor alert notifications", func(ctx context.Context) error {
+		if s.notifications == nil {
+			return nil
+		}
+		return s.notifications.Flush(ctx)
+	})
+}
@@ -0,0 +1,220 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	sent []*Notification
+	err  error
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, notification *Notification) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, notification)
+	return nil
+}
+
+func (r *recordingNotifier) states() []NotificationState {
+	states := make([]NotificationState, 0, len(r.sent))
+	for _, notification := range r.sent {
+		states = append(states, notification.State)
+	}
+	return states
+}
+
+func setupNotifications(t *testing.T, config NotificationConfig) (*Service, *NotificationPipeline, *recordingNotifier, *time.Time) {
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+	notifier := &recordingNotifier{}
+	pipeline, err := NewNotificationPipeline(config, notifier)
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pipeline.now = func() time.Time { return now }
+	service.SetNotificationPipeline(pipeline)
+	return service, pipeline, notifier, &now
+}
+
+func TestNotificationPipeline(t *testing.T) {
+	ctx := context.Background()
+	config := NotificationConfig{
+		GroupBy:        []string{GroupByAlertID},
+		GroupWait:      30 * time.Second,
+		GroupInterval:  5 * time.Minute,
+		RepeatInterval: time.Hour,
+		FlushInterval:  time.Second,
+	}
+	newAlert := func(t *testing.T, service *Service, name string) *Alert {
+		alert := &Alert{Name: name, UserID: "user1", Condition: "error_rate > 5"}
+		require.NoError(t, service.CreateAlert(ctx, alert))
+		return alert
+	}
+
+	t.Run("should notify a flapping alert once firing and once resolved", func(t *testing.T) {
+		service, pipeline, notifier, now := setupNotifications(t, config)
+		alert := newAlert(t, service, "High error rate")
+		fire := func() { require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered)) }
+		clear := func() { require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusActive)) }
+		tick := func(d time.Duration) {
+			*now = now.Add(d)
+			require.NoError(t, pipeline.Flush(ctx))
+		}
+
+		fire()
+		tick(10 * time.Second)
+		assert.Empty(t, notifier.sent, "group wait has not passed")
+		tick(30 * time.Second)
+		require.Equal(t, []NotificationState{NotificationFiring}, notifier.states())
+
+		// Flapping within the group interval sends nothing
+		for i := 0; i < 5; i++ {
+			clear()
+			tick(10 * time.Second)
+			fire()
+			tick(10 * time.Second)
+		}
+		tick(10 * time.Minute)
+		assert.Len(t, notifier.sent, 1)
+
+		clear()
+		tick(10 * time.Second)
+		assert.Len(t, notifier.sent, 2, "the resolved notification is not rate limited once the interval has passed")
+		tick(10 * time.Minute)
+
+		assert.Equal(t, []NotificationState{NotificationFiring, NotificationResolved}, notifier.states())
+		resolved := notifier.sent[1]
+		require.Len(t, resolved.Alerts, 1)
+		assert.Equal(t, alert.ID, resolved.Alerts[0].ID)
+		assert.Equal(t, "user1", resolved.UserID)
+	})
+
+	t.Run("should send nothing for an alert that clears within the group wait", func(t *testing.T) {
+		service, pipeline, notifier, now := setupNotifications(t, config)
+		alert := newAlert(t, service, "Disk full")
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		*now = now.Add(10 * time.Second)
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusActive))
+		*now = now.Add(time.Minute)
+		require.NoError(t, pipeline.Flush(ctx))
+		assert.Empty(t, notifier.sent)
+	})
+
+	t.Run("should rate limit a resolve that follows the firing notification closely", func(t *testing.T) {
+		service, pipeline, notifier, now := setupNotifications(t, config)
+		alert := newAlert(t, service, "Latency")
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		*now = now.Add(time.Minute)
+		require.NoError(t, pipeline.Flush(ctx))
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusActive))
+		require.NoError(t, pipeline.Flush(ctx))
+		assert.Equal(t, []NotificationState{NotificationFiring}, notifier.states())
+
+		*now = now.Add(5 * time.Minute)
+		require.NoError(t, pipeline.Flush(ctx))
+		assert.Equal(t, []NotificationState{NotificationFiring, NotificationResolved}, notifier.states())
+	})
+
+	t.Run("should send due notifications through the flush registry", func(t *testing.T) {
+		service, _, notifier, now := setupNotifications(t, config)
+		flushes := core.NewFlushRegistry()
+		service.SetFlushRegistry(flushes)
+		alert := newAlert(t, service, "Error budget")
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		*now = now.Add(time.Minute)
+
+		require.NoError(t, flushes.Flush(ctx))
+		assert.Equal(t, []NotificationState{NotificationFiring}, notifier.states())
+
+		// A service without a pipeline has nothing to flush
+		idle := core.NewFlushRegistry()
+		NewService().SetFlushRegistry(idle)
+		require.NoError(t, idle.Flush(ctx))
+	})
+
+	t.Run("should repeat a notification for an alert that stays firing", func(t *testing.T) {
+		service, pipeline, notifier, now := setupNotifications(t, config)
+		alert := newAlert(t, service, "Queue backlog")
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		for i := 0; i < 6; i++ {
+			*now = now.Add(30 * time.Minute)
+			require.NoError(t, pipeline.Flush(ctx))
+		}
+		assert.Equal(t, []NotificationState{NotificationFiring, NotificationFiring, NotificationFiring}, notifier.states())
+	})
+
+	t.Run("should group alerts by the configured keys", func(t *testing.T) {
+		byName := config
+		byName.GroupBy = []string{GroupByName}
+		service, pipeline, notifier, now := setupNotifications(t, byName)
+		first := newAlert(t, service, "Instance down")
+		second := newAlert(t, service, "Instance down")
+		other := newAlert(t, service, "Disk full")
+		for _, alert := range []*Alert{first, second, other} {
+			require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		}
+		*now = now.Add(time.Minute)
+		require.NoError(t, pipeline.Flush(ctx))
+
+		require.Len(t, notifier.sent, 2)
+		assert.Equal(t, "{user_id=user1,name=Disk full}", notifier.sent[0].GroupKey)
+		assert.Len(t, notifier.sent[0].Alerts, 1)
+		assert.Equal(t, "{user_id=user1,name=Instance down}", notifier.sent[1].GroupKey)
+		assert.Len(t, notifier.sent[1].Alerts, 2)
+
+		// The group resolves only when all of its alerts have cleared
+		*now = now.Add(10 * time.Minute)
+		require.NoError(t, service.SetAlertStatus(ctx, first.ID, AlertStatusActive))
+		require.NoError(t, pipeline.Flush(ctx))
+		assert.Len(t, notifier.sent, 3, "a group whose alerts change is notified again")
+		assert.Equal(t, NotificationFiring, notifier.sent[2].State)
+		*now = now.Add(10 * time.Minute)
+		require.NoError(t, service.SetAlertStatus(ctx, second.ID, AlertStatusActive))
+		require.NoError(t, pipeline.Flush(ctx))
+		assert.Equal(t, NotificationResolved, notifier.sent[3].State)
+	})
+
+	t.Run("should retry a notification that failed to send", func(t *testing.T) {
+		service, pipeline, notifier, now := setupNotifications(t, config)
+		alert := newAlert(t, service, "Flaky")
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		*now = now.Add(time.Minute)
+		notifier.err = errors.New("slack down")
+		assert.ErrorContains(t, pipeline.Flush(ctx), "slack down")
+
+		notifier.err = nil
+		require.NoError(t, pipeline.Flush(ctx))
+		assert.Equal(t, []NotificationState{NotificationFiring}, notifier.states())
+	})
+
+	t.Run("should flush on the scheduler between start and close", func(t *testing.T) {
+		service, _, _, _ := setupNotifications(t, config)
+		scheduler := core.NewScheduler()
+		service.SetScheduler(scheduler)
+
+		service.Start()
+		names := make([]string, 0)
+		for _, job := range scheduler.Jobs() {
+			names = append(names, job.Name)
+		}
+		assert.Contains(t, names, notificationsJobName)
+
+		require.NoError(t, service.Close(ctx))
+		assert.Empty(t, scheduler.Jobs())
+	})
+
+	t.Run("should reject unknown group by fields", func(t *testing.T) {
+		bad := config
+		bad.GroupBy = []string{"severity"}
+		_, err := NewNotificationPipeline(bad, &recordingNotifier{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/internal/monitor/condition"
+)
+
+// MaxMetricQueryLimit caps how many metrics a value query returns
+const MaxMetricQueryLimit = 1000
+
+// ErrInvalidQuery is returned for metric queries with invalid parameters
+var ErrInvalidQuery = errors.New("invalid metric query")
+
+// sqlOperators maps the comparison operators of alert conditions, and their
+// URL-friendly names, to SQL
+var sqlOperators = map[string]string{
+	string(condition.OpGreater):      ">",
+	string(condition.OpGreaterEqual): ">=",
+	string(condition.OpLess):         "<",
+	string(condition.OpLessEqual):    "<=",
+	string(condition.OpEqual):        "=",
+	string(condition.OpNotEqual):     "<>",
+	"gt":                             ">",
+	"gte":                            ">=",
+	"lt":                             "<",
+	"lte":                            "<=",
+	"eq":                             "=",
+	"ne":                             "<>",
+}
+
+// TimeRange bounds a metric query by timestamp. A zero From or To leaves that
+// side open.
+type TimeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// QueryMetricsByValue returns the most recent points of a metric whose value
+// compares to threshold with op, newest first. The comparison, the optional
+// time range and the limit are all applied in SQL, so only matching points
+// are loaded. op is a condition operator (">", ">=", "<", "<=", "==", "!=")
+// or its name ("gt", "gte", "lt", "lte", "eq", "ne"). A limit of zero or
+// more than MaxMetricQueryLimit returns at most MaxMetricQueryLimit points.
+func (s *Service) QueryMetricsByValue(ctx context.Context, serviceName, metricName string, op string, threshold float64, limit int, window ...TimeRange) ([]*Metric, error) {
+	sqlOp, ok := sqlOperators[strings.TrimSpace(op)]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported operator '%s'", ErrInvalidQuery, op)
+	}
+	if strings.TrimSpace(serviceName) == "" || strings.TrimSpace(metricName) == "" {
+		return nil, fmt.Errorf("%w: service name and metric name are required", ErrInvalidQuery)
+	}
+	if limit <= 0 || limit > MaxMetricQueryLimit {
+		limit = MaxMetricQueryLimit
+	}
+
+	query := s.db.WithContext(ctx).
+		Where("service_name = ? AND name = ?", serviceName, metricName).
+		Where("value "+sqlOp+" ?", threshold)
+	for _, r := range window {
+		if !r.From.IsZero() {
+			query = query.Where("timestamp >= ?", r.From)
+		}
+		if !r.To.IsZero() {
+			query = query.Where("timestamp < ?", r.To)
+		}
+	}
+
+	var metrics []*Metric
+	if err := query.Order("timestamp DESC, id DESC").Limit(limit).Find(&metrics).Error; err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %w", err)
+	}
+	return metrics, nil
+}
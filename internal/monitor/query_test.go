@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryMetricsByValue(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, value := range []float64{10, 20, 30, 40, 50} {
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "latency", Value: value, Timestamp: start.Add(time.Duration(i) * time.Minute)}))
+	}
+	// Other series must never match
+	require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "errors", Value: 30, Timestamp: start}))
+	require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "vault", Name: "latency", Value: 30, Timestamp: start}))
+
+	values := func(metrics []*Metric) []float64 {
+		result := make([]float64, 0, len(metrics))
+		for _, metric := range metrics {
+			result = append(result, metric.Value)
+		}
+		return result
+	}
+
+	tests := []struct {
+		op   string
+		want []float64
+	}{
+		{">", []float64{50, 40}},
+		{">=", []float64{50, 40, 30}},
+		{"<", []float64{20, 10}},
+		{"<=", []float64{30, 20, 10}},
+		{"==", []float64{30}},
+		{"!=", []float64{50, 40, 20, 10}},
+		{"gt", []float64{50, 40}},
+		{"gte", []float64{50, 40, 30}},
+		{"lt", []float64{20, 10}},
+		{"lte", []float64{30, 20, 10}},
+		{"eq", []float64{30}},
+		{"ne", []float64{50, 40, 20, 10}},
+	}
+	for _, tt := range tests {
+		t.Run("should filter with "+tt.op, func(t *testing.T) {
+			metrics, err := service.QueryMetricsByValue(ctx, "api", "latency", tt.op, 30, 0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, values(metrics))
+		})
+	}
+
+	t.Run("should apply the limit to the newest points", func(t *testing.T) {
+		metrics, err := service.QueryMetricsByValue(ctx, "api", "latency", ">", 0, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{50, 40}, values(metrics))
+	})
+
+	t.Run("should combine with a time range", func(t *testing.T) {
+		window := TimeRange{From: start.Add(time.Minute), To: start.Add(4 * time.Minute)}
+		metrics, err := service.QueryMetricsByValue(ctx, "api", "latency", ">=", 20, 0, window)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{40, 30, 20}, values(metrics))
+
+		metrics, err = service.QueryMetricsByValue(ctx, "api", "latency", ">", 0, 0, TimeRange{From: start.Add(3 * time.Minute)})
+		require.NoError(t, err)
+		assert.Equal(t, []float64{50, 40}, values(metrics))
+	})
+
+	t.Run("should reject an unknown operator", func(t *testing.T) {
+		_, err := service.QueryMetricsByValue(ctx, "api", "latency", "; DROP TABLE metrics", 0, 0)
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+		assert.ErrorContains(t, err, "unsupported operator")
+	})
+}
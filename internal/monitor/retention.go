@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// retentionJobName is the scheduler job deleting raw points past retention
+	retentionJobName = "monitor.metric-retention"
+	// retentionInterval is how often it runs
+	retentionInterval = time.Hour
+	// retentionBatchSize is how many points each delete removes, so a large
+	// backlog does not hold one long write
+	retentionBatchSize = 10000
+)
+
+// SetMetricRetention sets how long raw points are kept. Rollups are kept
+// regardless, so summaries of older buckets stay available. Zero, the
+// default, keeps every point.
+func (s *Service) SetMetricRetention(retention time.Duration) {
+	s.metricRetention = retention
+}
+
+// minMetricRetention is the shortest retention that keeps points until the
+// rollups of their hour are computed
+func minMetricRetention(rollupDelay time.Duration) time.Duration {
+	return RollupHour.Duration() + rollupDelay
+}
+
+// PurgeMetrics deletes raw points older than the metric retention and returns
+// how many it deleted
+func (s *Service) PurgeMetrics(ctx context.Context, now time.Time) (int64, error) {
+	if s.metricRetention <= 0 {
+		return 0, nil
+	}
+
+	cutoff := now.Add(-s.metricRetention)
+	var purged int64
+	for {
+		result := s.db.WithContext(ctx).
+			Where("id IN (?)", s.db.Model(&Metric{}).Select("id").Where("timestamp < ?", cutoff).Limit(retentionBatchSize)).
+			Delete(&Metric{})
+		if result.Error != nil {
+			return purged, fmt.Errorf("failed to purge metrics: %w", result.Error)
+		}
+		purged += result.RowsAffected
+		if result.RowsAffected < retentionBatchSize {
+			return purged, nil
+		}
+	}
+}
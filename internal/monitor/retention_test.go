@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	setup := func(t *testing.T) *Service {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour} {
+			require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "latency", Value: 1, Timestamp: now.Add(-age)}))
+		}
+		return service
+	}
+
+	t.Run("should delete points older than the retention", func(t *testing.T) {
+		service := setup(t)
+		service.SetMetricRetention(24 * time.Hour)
+
+		purged, err := service.PurgeMetrics(ctx, now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), purged)
+
+		metrics, err := service.GetMetrics(ctx, "api")
+		require.NoError(t, err)
+		require.Len(t, metrics, 1)
+		assert.True(t, metrics[0].Timestamp.Equal(now.Add(-time.Hour)))
+	})
+
+	t.Run("should keep every point without a retention", func(t *testing.T) {
+		service := setup(t)
+		purged, err := service.PurgeMetrics(ctx, now)
+		require.NoError(t, err)
+		assert.Zero(t, purged)
+	})
+
+	t.Run("should schedule the purge only with a retention", func(t *testing.T) {
+		jobs := func(service *Service) []string {
+			scheduler := core.NewScheduler()
+			defer scheduler.Close(ctx)
+			service.SetScheduler(scheduler)
+			service.Start()
+			defer service.Close(ctx)
+
+			names := make([]string, 0)
+			for _, job := range scheduler.Jobs() {
+				names = append(names, job.Name)
+			}
+			return names
+		}
+
+		service := NewService()
+		assert.NotContains(t, jobs(service), retentionJobName)
+		service.SetMetricRetention(24 * time.Hour)
+		assert.Contains(t, jobs(service), retentionJobName)
+	})
+}
@@ -0,0 +1,514 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RollupResolution is the width of the buckets a rollup summarizes
+type RollupResolution string
+
+const (
+	RollupMinute RollupResolution = "minute"
+	RollupHour   RollupResolution = "hour"
+)
+
+// Duration returns the width of a bucket, or zero for an unknown resolution
+func (r RollupResolution) Duration() time.Duration {
+	switch r {
+	case RollupMinute:
+		return time.Minute
+	case RollupHour:
+		return time.Hour
+	default:
+		return 0
+	}
+}
+
+const (
+	// DefaultRollupInterval is how often completed buckets are rolled up
+	DefaultRollupInterval = time.Minute
+	// DefaultRollupDelay is how long after a bucket ends it is rolled up, so
+	// points that arrive a little late are still included
+	DefaultRollupDelay = time.Minute
+)
+
+const (
+	// rollupBatchBuckets is how many buckets of a series are aggregated and
+	// stored at a time
+	rollupBatchBuckets = 60
+	// rollupSeriesPageSize is how many series watermarks are listed at a time
+	rollupSeriesPageSize = 1000
+)
+
+// rollupResolutions are rolled up in order, each from the one before
+var rollupResolutions = []RollupResolution{RollupMinute, RollupHour}
+
+// Where a MetricSummary was computed from
+const (
+	SummarySourceRollup = "rollup"
+	SummarySourceRaw    = "raw"
+)
+
+// MetricRollup pre-aggregates the points of a metric in one bucket
+type MetricRollup struct {
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	ServiceName string           `json:"service_name" gorm:"uniqueIndex:idx_metric_rollups_bucket,priority:1;not null"`
+	Name        string           `json:"name" gorm:"uniqueIndex:idx_metric_rollups_bucket,priority:2;not null"`
+	Resolution  RollupResolution `json:"resolution" gorm:"uniqueIndex:idx_metric_rollups_bucket,priority:3;not null"`
+	BucketStart time.Time        `json:"bucket_start" gorm:"uniqueIndex:idx_metric_rollups_bucket,priority:4;not null"`
+	Count       int64            `json:"count"`
+	Sum         float64          `json:"sum"`
+	Min         float64          `json:"min"`
+	Max         float64          `json:"max"`
+}
+
+func (MetricRollup) TableName() string {
+	return "metric_rollups"
+}
+
+// MetricRollupWatermark is how far one series has been rolled up at one
+// resolution: every bucket before RolledUpUntil
+type MetricRollupWatermark struct {
+	ID            uint             `json:"id" gorm:"primaryKey"`
+	ServiceName   string           `json:"service_name" gorm:"uniqueIndex:idx_metric_rollup_watermarks_series,priority:1;not null"`
+	Name          string           `json:"name" gorm:"uniqueIndex:idx_metric_rollup_watermarks_series,priority:2;not null"`
+	Resolution    RollupResolution `json:"resolution" gorm:"uniqueIndex:idx_metric_rollup_watermarks_series,priority:3;not null"`
+	RolledUpUntil time.Time        `json:"rolled_up_until" gorm:"not null"`
+}
+
+func (MetricRollupWatermark) TableName() string {
+	return "metric_rollup_watermarks"
+}
+
+// MigrateSchema starts the watermarks of series stored before watermarks were
+// tracked: from their latest rollup, or else their oldest point. It runs after
+// AutoMigrate and does nothing once any watermark exists.
+func (s *Service) MigrateSchema(db *gorm.DB) error {
+	var watermarks int64
+	if err := db.Model(&MetricRollupWatermark{}).Count(&watermarks).Error; err != nil {
+		return fmt.Errorf("failed to count metric rollup watermarks: %w", err)
+	}
+	if watermarks > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// The latest bucket is rolled up again, in case it missed points
+		err := tx.Exec(`INSERT INTO metric_rollup_watermarks (service_name, name, resolution, rolled_up_until)
+			SELECT service_name, name, resolution, MAX(bucket_start) FROM metric_rollups GROUP BY service_name, name, resolution`).Error
+		if err != nil {
+			return fmt.Errorf("failed to start metric rollup watermarks: %w", err)
+		}
+		for _, resolution := range rollupResolutions {
+			err := tx.Exec(`INSERT INTO metric_rollup_watermarks (service_name, name, resolution, rolled_up_until)
+				SELECT service_name, name, ?, MIN(timestamp) FROM metrics GROUP BY service_name, name
+				ON CONFLICT (service_name, name, resolution) DO NOTHING`, resolution).Error
+			if err != nil {
+				return fmt.Errorf("failed to start metric rollup watermarks: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// MetricSummary aggregates the points of a metric in one bucket
+type MetricSummary struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Count       int64     `json:"count"`
+	Sum         float64   `json:"sum"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	Avg         float64   `json:"avg"`
+	// Source is SummarySourceRollup or SummarySourceRaw
+	Source string `json:"source"`
+}
+
+type rollupKey struct {
+	serviceName string
+	name        string
+	bucketStart time.Time
+}
+
+// RollupMetrics rolls up every bucket that ended by until and has not been
+// rolled up yet: raw points into minute rollups, then minute rollups into hour
+// rollups. Each series is rolled up from its own watermark, rollupBatchBuckets
+// buckets at a time. Points that arrive after their bucket was rolled up move
+// the watermark of their series back, so their buckets are rolled up again.
+func (s *Service) RollupMetrics(ctx context.Context, until time.Time) error {
+	for _, resolution := range rollupResolutions {
+		end := until.UTC().Truncate(resolution.Duration())
+		var lastID uint
+		for {
+			var watermarks []*MetricRollupWatermark
+			err := s.db.WithContext(ctx).
+				Where("resolution = ? AND rolled_up_until < ? AND id > ?", resolution, end, lastID).
+				Order("id").
+				Limit(rollupSeriesPageSize).
+				Find(&watermarks).Error
+			if err != nil {
+				return fmt.Errorf("failed to list metric rollup watermarks: %w", err)
+			}
+			for _, watermark := range watermarks {
+				if err := s.rollupSeries(ctx, watermark.ServiceName, watermark.Name, resolution, end); err != nil {
+					return err
+				}
+			}
+			if len(watermarks) < rollupSeriesPageSize {
+				break
+			}
+			lastID = watermarks[len(watermarks)-1].ID
+		}
+	}
+	return nil
+}
+
+// rollupSeries rolls up the buckets of one series from its watermark to end.
+// Each batch reads and advances the watermark in one transaction, holding its
+// row lock, so a late point moving it back is never overwritten.
+func (s *Service) rollupSeries(ctx context.Context, serviceName, metricName string, resolution RollupResolution, end time.Time) error {
+	width := resolution.Duration()
+	for {
+		done := true
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var watermark MetricRollupWatermark
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("service_name = ? AND name = ? AND resolution = ?", serviceName, metricName, resolution).
+				First(&watermark).Error
+			if err != nil {
+				return fmt.Errorf("failed to read metric rollup watermark: %w", err)
+			}
+
+			limit := end
+			if resolution == RollupHour {
+				// Hours are rolled up from minutes, so only as far as those are
+				minutes, err := rolledUpUntil(tx, serviceName, metricName, RollupMinute)
+				if err != nil {
+					return err
+				}
+				if minutes = minutes.Truncate(width); minutes.Before(limit) {
+					limit = minutes
+				}
+			}
+			start := watermark.RolledUpUntil.UTC().Truncate(width)
+			if !start.Before(limit) {
+				return nil
+			}
+
+			// Skip buckets without data rather than reading them one batch at a time
+			first, err := firstBucketWithData(tx, serviceName, metricName, resolution, start, limit)
+			if err != nil {
+				return err
+			}
+			batchEnd := limit
+			if !first.IsZero() {
+				start = first
+				if next := start.Add(rollupBatchBuckets * width); next.Before(limit) {
+					batchEnd, done = next, false
+				}
+
+				var rollups map[rollupKey]*MetricRollup
+				if resolution == RollupMinute {
+					rollups, err = aggregateRaw(tx, serviceName, metricName, start, batchEnd, resolution)
+				} else {
+					rollups, err = aggregateRollups(tx, serviceName, metricName, start, batchEnd, RollupMinute, resolution)
+				}
+				if err != nil {
+					return err
+				}
+				if err := s.saveRollups(tx, rollups); err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Model(&watermark).Update("rolled_up_until", batchEnd).Error; err != nil {
+				return fmt.Errorf("failed to update metric rollup watermark: %w", err)
+			}
+			return nil
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// trackRollups records the series of stored points for RollupMetrics. A point
+// in a bucket that may already have been rolled up moves the watermarks of its
+// series back to that bucket, or starts them there for a new series.
+func (s *Service) trackRollups(ctx context.Context, metrics []*Metric) error {
+	now := time.Now()
+	// No run has rolled up a bucket after this one yet
+	recent := now.Add(-s.rollupDelay).UTC().Truncate(time.Minute)
+	// Points this close to the retention are purged before a run could roll
+	// their buckets up again, possibly along with the rest of those buckets
+	var expiring time.Time
+	if s.metricRetention > 0 {
+		expiring = now.Add(-s.metricRetention + RollupHour.Duration())
+	}
+
+	earliest := make(map[seriesMetric]time.Time)
+	for _, metric := range metrics {
+		key := seriesMetric{serviceName: metric.ServiceName, name: metric.Name}
+		timestamp := metric.Timestamp.UTC()
+		if timestamp.Before(expiring) {
+			continue
+		}
+		if _, tracked := s.trackedSeries.Load(key); tracked && !timestamp.Before(recent) {
+			continue
+		}
+		if first, ok := earliest[key]; !ok || timestamp.Before(first) {
+			earliest[key] = timestamp
+		}
+	}
+	if len(earliest) == 0 {
+		return nil
+	}
+
+	// Sorted so concurrent batches lock watermarks in the same order
+	keys := make([]seriesMetric, 0, len(earliest))
+	for key := range earliest {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].serviceName != keys[j].serviceName {
+			return keys[i].serviceName < keys[j].serviceName
+		}
+		return keys[i].name < keys[j].name
+	})
+	watermarks := make([]*MetricRollupWatermark, 0, len(keys)*len(rollupResolutions))
+	for _, key := range keys {
+		for _, resolution := range rollupResolutions {
+			watermarks = append(watermarks, &MetricRollupWatermark{
+				ServiceName:   key.serviceName,
+				Name:          key.name,
+				Resolution:    resolution,
+				RolledUpUntil: earliest[key].Truncate(resolution.Duration()),
+			})
+		}
+	}
+
+	// Keep the earlier of the stored and the new watermark
+	err := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "service_name"}, {Name: "name"}, {Name: "resolution"}},
+			DoUpdates: clause.Set{{
+				Column: clause.Column{Name: "rolled_up_until"},
+				Value:  gorm.Expr("CASE WHEN excluded.rolled_up_until < metric_rollup_watermarks.rolled_up_until THEN excluded.rolled_up_until ELSE metric_rollup_watermarks.rolled_up_until END"),
+			}},
+		}).
+		CreateInBatches(watermarks, s.insertBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("failed to store metric rollup watermarks: %w", err)
+	}
+	for _, key := range keys {
+		s.trackedSeries.Store(key, true)
+	}
+	return nil
+}
+
+// SummarizeMetrics aggregates a metric into buckets of the given resolution
+// over window, oldest first. Buckets that have been rolled up are read from
+// MetricRollup; the recent remainder is aggregated from raw points. From is
+// rounded down to a bucket boundary and a zero To means now.
+func (s *Service) SummarizeMetrics(ctx context.Context, serviceName, metricName string, resolution RollupResolution, window TimeRange) ([]*MetricSummary, error) {
+	width := resolution.Duration()
+	if width == 0 {
+		return nil, fmt.Errorf("%w: unsupported resolution '%s'", ErrInvalidQuery, resolution)
+	}
+	if window.From.IsZero() {
+		return nil, fmt.Errorf("%w: from is required", ErrInvalidQuery)
+	}
+	from := window.From.UTC().Truncate(width)
+	to := window.To.UTC()
+	if window.To.IsZero() {
+		to = time.Now().UTC()
+	}
+
+	// Everything of this series before split has been rolled up
+	db := s.db.WithContext(ctx)
+	split, err := rolledUpUntil(db, serviceName, metricName, resolution)
+	if err != nil {
+		return nil, err
+	}
+	if split.Before(from) {
+		split = from
+	}
+	if split.After(to) {
+		split = to
+	}
+
+	summaries := make([]*MetricSummary, 0)
+	if from.Before(split) {
+		var rollups []*MetricRollup
+		err := db.
+			Where("service_name = ? AND name = ? AND resolution = ?", serviceName, metricName, resolution).
+			Where("bucket_start >= ? AND bucket_start < ?", from, split).
+			Order("bucket_start").
+			Find(&rollups).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to query metric rollups: %w", err)
+		}
+		for _, rollup := range rollups {
+			summaries = append(summaries, rollup.summary(SummarySourceRollup))
+		}
+	}
+	if split.Before(to) {
+		recent, err := aggregateRaw(db, serviceName, metricName, split, to, resolution)
+		if err != nil {
+			return nil, err
+		}
+		raw := make([]*MetricSummary, 0, len(recent))
+		for _, rollup := range recent {
+			raw = append(raw, rollup.summary(SummarySourceRaw))
+		}
+		sort.Slice(raw, func(i, j int) bool { return raw[i].BucketStart.Before(raw[j].BucketStart) })
+		summaries = append(summaries, raw...)
+	}
+	return summaries, nil
+}
+
+// rolledUpUntil returns the watermark of a series at a resolution, or the zero
+// time if nothing of it has been rolled up
+func rolledUpUntil(db *gorm.DB, serviceName, metricName string, resolution RollupResolution) (time.Time, error) {
+	// Find rather than First, as no watermark yet is expected rather than an error
+	var watermarks []MetricRollupWatermark
+	err := db.Where("service_name = ? AND name = ? AND resolution = ?", serviceName, metricName, resolution).Limit(1).Find(&watermarks).Error
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read metric rollup watermark: %w", err)
+	}
+	if len(watermarks) == 0 {
+		return time.Time{}, nil
+	}
+	return watermarks[0].RolledUpUntil.UTC(), nil
+}
+
+// firstBucketWithData returns the first bucket in [from, to) of a series with
+// points, for minutes, or with minute rollups, for hours. It returns the zero
+// time if there is none.
+func firstBucketWithData(db *gorm.DB, serviceName, metricName string, resolution RollupResolution, from, to time.Time) (time.Time, error) {
+	var first []time.Time
+	var err error
+	if resolution == RollupMinute {
+		err = db.Model(&Metric{}).
+			Where("service_name = ? AND name = ? AND timestamp >= ? AND timestamp < ?", serviceName, metricName, from, to).
+			Order("timestamp").Limit(1).Pluck("timestamp", &first).Error
+	} else {
+		err = db.Model(&MetricRollup{}).
+			Where("service_name = ? AND name = ? AND resolution = ?", serviceName, metricName, RollupMinute).
+			Where("bucket_start >= ? AND bucket_start < ?", from, to).
+			Order("bucket_start").Limit(1).Pluck("bucket_start", &first).Error
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to find metrics to roll up: %w", err)
+	}
+	if len(first) == 0 {
+		return time.Time{}, nil
+	}
+	return first[0].UTC().Truncate(resolution.Duration()), nil
+}
+
+// aggregateRaw rolls up the raw points of a series in [from, to) without
+// storing the result
+func aggregateRaw(db *gorm.DB, serviceName, metricName string, from, to time.Time, resolution RollupResolution) (map[rollupKey]*MetricRollup, error) {
+	rows, err := db.Model(&Metric{}).
+		Select("value, timestamp").
+		Where("service_name = ? AND name = ?", serviceName, metricName).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	defer rows.Close()
+
+	rollups := make(map[rollupKey]*MetricRollup)
+	for rows.Next() {
+		var metric Metric
+		if err := db.ScanRows(rows, &metric); err != nil {
+			return nil, fmt.Errorf("failed to read metrics: %w", err)
+		}
+		key := rollupKey{serviceName: serviceName, name: metricName, bucketStart: metric.Timestamp.UTC().Truncate(resolution.Duration())}
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &MetricRollup{ServiceName: key.serviceName, Name: key.name, Resolution: resolution, BucketStart: key.bucketStart, Min: math.Inf(1), Max: math.Inf(-1)}
+			rollups[key] = rollup
+		}
+		rollup.Count++
+		rollup.Sum += metric.Value
+		rollup.Min = math.Min(rollup.Min, metric.Value)
+		rollup.Max = math.Max(rollup.Max, metric.Value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	return rollups, nil
+}
+
+// aggregateRollups combines the rollups of a series at a finer resolution in
+// [from, to) into rollups of a coarser one
+func aggregateRollups(db *gorm.DB, serviceName, metricName string, from, to time.Time, source, resolution RollupResolution) (map[rollupKey]*MetricRollup, error) {
+	var fine []*MetricRollup
+	err := db.
+		Where("service_name = ? AND name = ? AND resolution = ?", serviceName, metricName, source).
+		Where("bucket_start >= ? AND bucket_start < ?", from, to).
+		Find(&fine).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metric rollups: %w", err)
+	}
+
+	rollups := make(map[rollupKey]*MetricRollup)
+	for _, f := range fine {
+		key := rollupKey{serviceName: f.ServiceName, name: f.Name, bucketStart: f.BucketStart.UTC().Truncate(resolution.Duration())}
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &MetricRollup{ServiceName: key.serviceName, Name: key.name, Resolution: resolution, BucketStart: key.bucketStart, Min: f.Min, Max: f.Max}
+			rollups[key] = rollup
+		}
+		rollup.Count += f.Count
+		rollup.Sum += f.Sum
+		rollup.Min = math.Min(rollup.Min, f.Min)
+		rollup.Max = math.Max(rollup.Max, f.Max)
+	}
+	return rollups, nil
+}
+
+// saveRollups stores rollups, replacing any already stored for their buckets
+func (s *Service) saveRollups(db *gorm.DB, rollups map[rollupKey]*MetricRollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	batch := make([]*MetricRollup, 0, len(rollups))
+	for _, rollup := range rollups {
+		batch = append(batch, rollup)
+	}
+	err := db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "service_name"}, {Name: "name"}, {Name: "resolution"}, {Name: "bucket_start"}},
+			DoUpdates: clause.AssignmentColumns([]string{"count", "sum", "min", "max"}),
+		}).
+		CreateInBatches(batch, s.insertBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("failed to store metric rollups: %w", err)
+	}
+	return nil
+}
+
+func (r *MetricRollup) summary(source string) *MetricSummary {
+	summary := &MetricSummary{
+		BucketStart: r.BucketStart.UTC(),
+		Count:       r.Count,
+		Sum:         r.Sum,
+		Min:         r.Min,
+		Max:         r.Max,
+		Source:      source,
+	}
+	if r.Count > 0 {
+		summary.Avg = r.Sum / float64(r.Count)
+	}
+	return summary
+}
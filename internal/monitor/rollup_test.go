@@ -0,0 +1,194 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricRollups(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	db := setupTestDB(t)
+	service.SetDB(db)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	seed := func(name string, value float64, offset time.Duration) {
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: name, Value: value, Timestamp: base.Add(offset)}))
+	}
+	seed("latency", 10, 10*time.Second)
+	seed("latency", 20, 40*time.Second)
+	seed("latency", 30, 90*time.Second)
+	seed("latency", 50, 65*time.Minute)
+	seed("errors", 1, 20*time.Second)
+
+	rollups := func(resolution RollupResolution, name string) []MetricRollup {
+		var result []MetricRollup
+		require.NoError(t, db.Where("resolution = ? AND name = ?", resolution, name).Order("bucket_start").Find(&result).Error)
+		return result
+	}
+
+	t.Run("should roll up completed buckets by minute and hour", func(t *testing.T) {
+		require.NoError(t, service.RollupMetrics(ctx, base.Add(2*time.Hour)))
+
+		minutes := rollups(RollupMinute, "latency")
+		require.Len(t, minutes, 3)
+		assert.True(t, base.Equal(minutes[0].BucketStart))
+		assert.Equal(t, int64(2), minutes[0].Count)
+		assert.Equal(t, 30.0, minutes[0].Sum)
+		assert.Equal(t, 10.0, minutes[0].Min)
+		assert.Equal(t, 20.0, minutes[0].Max)
+		assert.True(t, base.Add(time.Minute).Equal(minutes[1].BucketStart))
+		assert.True(t, base.Add(65*time.Minute).Equal(minutes[2].BucketStart))
+
+		hours := rollups(RollupHour, "latency")
+		require.Len(t, hours, 2)
+		assert.Equal(t, int64(3), hours[0].Count)
+		assert.Equal(t, 60.0, hours[0].Sum)
+		assert.Equal(t, 10.0, hours[0].Min)
+		assert.Equal(t, 30.0, hours[0].Max)
+		assert.Equal(t, int64(1), hours[1].Count)
+		assert.Equal(t, 50.0, hours[1].Max)
+
+		errors := rollups(RollupMinute, "errors")
+		require.Len(t, errors, 1)
+		assert.Equal(t, int64(1), errors[0].Count)
+	})
+
+	t.Run("should only roll up new buckets on later runs", func(t *testing.T) {
+		require.NoError(t, service.RollupMetrics(ctx, base.Add(2*time.Hour)))
+		assert.Len(t, rollups(RollupMinute, "latency"), 3)
+
+		// Not complete until 14:11
+		seed("latency", 70, 130*time.Minute)
+		require.NoError(t, service.RollupMetrics(ctx, base.Add(130*time.Minute+30*time.Second)))
+		assert.Len(t, rollups(RollupMinute, "latency"), 3)
+	})
+
+	t.Run("should serve older buckets from rollups and recent ones from raw points", func(t *testing.T) {
+		// Raw points already rolled up are no longer needed
+		require.NoError(t, db.Where("timestamp < ?", base.Add(2*time.Hour)).Delete(&Metric{}).Error)
+
+		window := TimeRange{From: base.Add(30 * time.Second), To: base.Add(150 * time.Minute)}
+		summaries, err := service.SummarizeMetrics(ctx, "api", "latency", RollupMinute, window)
+		require.NoError(t, err)
+		require.Len(t, summaries, 4)
+		for _, summary := range summaries[:3] {
+			assert.Equal(t, SummarySourceRollup, summary.Source)
+		}
+		assert.True(t, base.Equal(summaries[0].BucketStart), "from is rounded down to a bucket")
+		assert.Equal(t, 15.0, summaries[0].Avg)
+		assert.Equal(t, SummarySourceRaw, summaries[3].Source)
+		assert.True(t, base.Add(130*time.Minute).Equal(summaries[3].BucketStart))
+		assert.Equal(t, 70.0, summaries[3].Sum)
+
+		hourly, err := service.SummarizeMetrics(ctx, "api", "latency", RollupHour, window)
+		require.NoError(t, err)
+		require.Len(t, hourly, 3)
+		assert.Equal(t, []string{SummarySourceRollup, SummarySourceRollup, SummarySourceRaw}, []string{hourly[0].Source, hourly[1].Source, hourly[2].Source})
+		assert.Equal(t, int64(3), hourly[0].Count)
+		assert.Equal(t, int64(1), hourly[2].Count)
+	})
+
+	t.Run("should reject unknown resolutions and missing ranges", func(t *testing.T) {
+		_, err := service.SummarizeMetrics(ctx, "api", "latency", "day", TimeRange{From: base})
+		assert.Error(t, err)
+		_, err = service.SummarizeMetrics(ctx, "api", "latency", RollupMinute, TimeRange{})
+		assert.Error(t, err)
+	})
+}
+
+func TestMetricRollupWatermarks(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	db := setupTestDB(t)
+	service.SetDB(db)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	seed := func(name string, value float64, offset time.Duration) {
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: name, Value: value, Timestamp: base.Add(offset)}))
+	}
+	rollup := func(resolution RollupResolution, name string, bucket time.Duration) MetricRollup {
+		var result MetricRollup
+		require.NoError(t, db.Where("resolution = ? AND name = ? AND bucket_start = ?", resolution, name, base.Add(bucket)).First(&result).Error)
+		return result
+	}
+	seed("latency", 10, 10*time.Second)
+	seed("latency", 20, 30*time.Minute)
+	require.NoError(t, service.RollupMetrics(ctx, base.Add(2*time.Hour)))
+
+	t.Run("should roll up series first seen after others were rolled up", func(t *testing.T) {
+		seed("queue", 5, 30*time.Minute)
+		require.NoError(t, service.RollupMetrics(ctx, base.Add(2*time.Hour)))
+
+		assert.Equal(t, int64(1), rollup(RollupMinute, "queue", 30*time.Minute).Count)
+		assert.Equal(t, int64(1), rollup(RollupHour, "queue", 0).Count)
+	})
+
+	t.Run("should roll up points that arrive after their bucket", func(t *testing.T) {
+		seed("latency", 30, 50*time.Second)
+		_, err := service.IngestBatch(ctx, []*Metric{{ServiceName: "api", Name: "latency", Value: 40, Timestamp: base.Add(30*time.Minute + time.Second)}})
+		require.NoError(t, err)
+		require.NoError(t, service.RollupMetrics(ctx, base.Add(2*time.Hour)))
+
+		minute := rollup(RollupMinute, "latency", 0)
+		assert.Equal(t, int64(2), minute.Count)
+		assert.Equal(t, 40.0, minute.Sum)
+		assert.Equal(t, int64(2), rollup(RollupMinute, "latency", 30*time.Minute).Count)
+		hour := rollup(RollupHour, "latency", 0)
+		assert.Equal(t, int64(4), hour.Count)
+		assert.Equal(t, 40.0, hour.Max)
+		assert.Equal(t, int64(1), rollup(RollupHour, "queue", 0).Count, "other series are not rolled up again")
+	})
+
+	t.Run("should summarize each series up to its own watermark", func(t *testing.T) {
+		require.NoError(t, service.RollupMetrics(ctx, base.Add(3*time.Hour)))
+		seed("queue", 7, 150*time.Minute)
+
+		summaries, err := service.SummarizeMetrics(ctx, "api", "queue", RollupMinute, TimeRange{From: base, To: base.Add(3 * time.Hour)})
+		require.NoError(t, err)
+		require.Len(t, summaries, 2)
+		assert.Equal(t, SummarySourceRollup, summaries[0].Source)
+		assert.Equal(t, SummarySourceRaw, summaries[1].Source)
+		assert.Equal(t, 7.0, summaries[1].Sum)
+	})
+}
+
+func TestMigrateRollupWatermarks(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	db := setupTestDB(t)
+	service.SetDB(db)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, db.Create(&MetricRollup{ServiceName: "api", Name: "latency", Resolution: RollupMinute, BucketStart: base, Count: 1, Sum: 10, Min: 10, Max: 10}).Error)
+	require.NoError(t, db.Create(&[]*Metric{
+		{ServiceName: "api", Name: "latency", Value: 10, Timestamp: base.Add(10 * time.Second)},
+		{ServiceName: "api", Name: "latency", Value: 20, Timestamp: base.Add(90 * time.Second)},
+		{ServiceName: "api", Name: "errors", Value: 1, Timestamp: base.Add(time.Hour)},
+	}).Error)
+
+	require.NoError(t, service.MigrateSchema(db))
+	require.NoError(t, service.RollupMetrics(ctx, base.Add(3*time.Hour)))
+
+	var rollups []MetricRollup
+	require.NoError(t, db.Where("resolution = ?", RollupMinute).Order("name, bucket_start").Find(&rollups).Error)
+	require.Len(t, rollups, 3)
+	assert.Equal(t, "errors", rollups[0].Name)
+	assert.Equal(t, int64(1), rollups[1].Count)
+	assert.True(t, base.Add(time.Minute).Equal(rollups[2].BucketStart))
+
+	var hours int64
+	require.NoError(t, db.Model(&MetricRollup{}).Where("resolution = ?", RollupHour).Count(&hours).Error)
+	assert.Equal(t, int64(2), hours)
+
+	// Tracked watermarks are left alone
+	require.NoError(t, db.Where("name = ?", "errors").Delete(&MetricRollupWatermark{}).Error)
+	require.NoError(t, service.MigrateSchema(db))
+	var watermarks int64
+	require.NoError(t, db.Model(&MetricRollupWatermark{}).Count(&watermarks).Error)
+	assert.Equal(t, int64(2), watermarks)
+}
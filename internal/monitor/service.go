@@ -4,38 +4,206 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ataiva-software/vertex/internal/monitor/condition"
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
 	"gorm.io/gorm"
 )
 
+const (
+	DefaultMaxBatchSize       = 1000
+	DefaultInsertBatchSize    = 100
+	DefaultMaxConcurrentBatch = 4
+	// MaxMetricBytes bounds the encoded size of one metric in an ingest request
+	MaxMetricBytes = 4096
+)
+
+var (
+	ErrBatchTooLarge = errors.New("metric batch exceeds maximum size")
+	ErrIngestBusy    = errors.New("too many concurrent metric batches")
+)
+
 type Service struct {
-	db *gorm.DB
+	db                  *gorm.DB
+	maxBatchSize        int
+	insertBatchSize     int
+	ingestSlots         chan struct{}
+	cardinality         *cardinalityGuard
+	droppedMetrics      atomic.Int64
+	anomalySigma        float64
+	anomalyBaseline     int
+	workflowTrigger     WorkflowTrigger
+	integrationNotifier IntegrationNotifier
+	notifications       *NotificationPipeline
+	scheduler           *core.Scheduler
+	rollupDelay         time.Duration
+	// trackedSeries holds the series whose rollup watermarks this process
+	// has recorded
+	trackedSeries sync.Map
+	// metricRetention is how long raw points are kept; zero keeps them all
+	metricRetention time.Duration
+	// pausedIntegrations holds the IDs of integrations disabled in the hub
+	pausedIntegrations sync.Map
+	// alertEvaluationInterval is how often Start evaluates alert conditions
+	alertEvaluationInterval time.Duration
+	// metricQueryTimeout bounds each service's query in GetMetricsForServices
+	metricQueryTimeout time.Duration
+	// queryServiceMetrics fetches one service's metrics; tests replace it
+	queryServiceMetrics func(ctx context.Context, serviceName string) ([]*Metric, error)
 }
 
 func NewService() *Service {
-	return &Service{}
+	s := &Service{
+		maxBatchSize:            DefaultMaxBatchSize,
+		insertBatchSize:         DefaultInsertBatchSize,
+		ingestSlots:             make(chan struct{}, DefaultMaxConcurrentBatch),
+		cardinality:             newCardinalityGuard(DefaultMaxSeriesPerMetric, CardinalityReject),
+		anomalySigma:            DefaultAnomalySigma,
+		anomalyBaseline:         DefaultAnomalyBaseline,
+		rollupDelay:             DefaultRollupDelay,
+		alertEvaluationInterval: DefaultAlertEvaluationInterval,
+		metricQueryTimeout:      DefaultMetricQueryTimeout,
+	}
+	s.queryServiceMetrics = s.recentMetrics
+	return s
 }
 
 func (s *Service) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return database.CheckConnection(ctx, s.db)
+}
+
+// CreateMetric stores a point. A point beyond its metric's series limit is
+// rejected with ErrCardinalityExceeded or, in CardinalityDrop mode, dropped.
 func (s *Service) CreateMetric(ctx context.Context, metric *Metric) error {
 	if err := s.validateMetric(metric); err != nil {
 		return err
 	}
+	settle, err := s.cardinality.admit(ctx, s, metric)
+	if settle == nil {
+		return err
+	}
 
-	if err := s.db.Create(metric).Error; err != nil {
+	err = s.db.Create(metric).Error
+	settle(err == nil)
+	if err != nil {
 		return fmt.Errorf("failed to create metric: %w", err)
 	}
 
+	// The point is stored either way; failing would only have it sent again
+	if err := s.trackRollups(ctx, []*Metric{metric}); err != nil {
+		log.Printf("⚠️  Failed to track metric rollups: %v", err)
+	}
 	return nil
 }
 
+// SetMaxBatchSize sets the most points IngestBatch accepts in one call
+func (s *Service) SetMaxBatchSize(size int) {
+	s.maxBatchSize = size
+}
+
+// MaxBatchSize returns the most points IngestBatch accepts in one call
+func (s *Service) MaxBatchSize() int {
+	return s.maxBatchSize
+}
+
+// MaxBatchBytes is the largest ingest request body read before decoding
+func (s *Service) MaxBatchBytes() int64 {
+	return int64(s.maxBatchSize) * MaxMetricBytes
+}
+
+// SetMaxConcurrentBatches sets how many batches are ingested at once before
+// IngestBatch fails with ErrIngestBusy
+func (s *Service) SetMaxConcurrentBatches(n int) {
+	s.ingestSlots = make(chan struct{}, n)
+}
+
+type IngestResult struct {
+	Index    int    `json:"index"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+	// Dropped is set for points discarded by the series limit in CardinalityDrop mode
+	Dropped bool `json:"dropped,omitempty"`
+}
+
+// IngestBatch validates and stores a batch of metric points, reporting the
+// outcome of each by its index in the batch
+func (s *Service) IngestBatch(ctx context.Context, metrics []*Metric) ([]*IngestResult, error) {
+	if s.maxBatchSize > 0 && len(metrics) > s.maxBatchSize {
+		return nil, fmt.Errorf("%w: %d > %d", ErrBatchTooLarge, len(metrics), s.maxBatchSize)
+	}
+
+	// Shed load instead of queueing when producers outpace the database
+	select {
+	case s.ingestSlots <- struct{}{}:
+		defer func() { <-s.ingestSlots }()
+	default:
+		return nil, ErrIngestBusy
+	}
+
+	results := make([]*IngestResult, len(metrics))
+	valid := make([]*Metric, 0, len(metrics))
+	validIndexes := make([]int, 0, len(metrics))
+	settles := make([]func(stored bool), 0, len(metrics))
+	for i, metric := range metrics {
+		results[i] = &IngestResult{Index: i}
+		if metric == nil {
+			results[i].Error = "metric is required"
+			continue
+		}
+		if err := s.validateMetric(metric); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if metric.Timestamp.IsZero() {
+			metric.Timestamp = time.Now()
+		}
+		settle, err := s.cardinality.admit(ctx, s, metric)
+		if settle == nil {
+			if err != nil {
+				results[i].Error = err.Error()
+			} else {
+				results[i].Dropped = true
+			}
+			continue
+		}
+		valid = append(valid, metric)
+		validIndexes = append(validIndexes, i)
+		settles = append(settles, settle)
+	}
+
+	if len(valid) > 0 {
+		err := s.db.WithContext(ctx).CreateInBatches(valid, s.insertBatchSize).Error
+		for _, settle := range settles {
+			settle(err == nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to ingest metrics: %w", err)
+		}
+		if err := s.trackRollups(ctx, valid); err != nil {
+			log.Printf("⚠️  Failed to track metric rollups: %v", err)
+		}
+	}
+
+	for _, i := range validIndexes {
+		results[i].Accepted = true
+	}
+
+	return results, nil
+}
+
 func (s *Service) GetMetrics(ctx context.Context, serviceName string) ([]*Metric, error) {
 	var metrics []*Metric
-	err := s.db.Where("service_name = ?", serviceName).Find(&metrics).Error
+	err := s.db.WithContext(ctx).Where("service_name = ?", serviceName).Find(&metrics).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to get metrics: %w", err)
 	}
@@ -43,6 +211,16 @@ func (s *Service) GetMetrics(ctx context.Context, serviceName string) ([]*Metric
 	return metrics, nil
 }
 
+// GetMetricsPage returns one page of a service's metrics, reading only that
+// page from the store
+func (s *Service) GetMetricsPage(ctx context.Context, serviceName string, request core.PageRequest) (*core.Page[*Metric], error) {
+	page, err := database.Paginate[*Metric](s.db.WithContext(ctx).Model(&Metric{}).Where("service_name = ?", serviceName).Order("id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
+	}
+	return page, nil
+}
+
 func (s *Service) CreateAlert(ctx context.Context, alert *Alert) error {
 	if err := s.validateAlert(alert); err != nil {
 		return err
@@ -69,6 +247,11 @@ func (s *Service) GetAlerts(ctx context.Context, userID string) ([]*Alert, error
 	return alerts, nil
 }
 
+func (s *Service) Count(ctx context.Context, userID string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	query := s.db.WithContext(ctx).Model(&Alert{}).Where("user_id = ?", userID)
+	return database.CountByStatus[AlertStatus](query, core.ResourceTypeAlert, filters...)
+}
+
 func (s *Service) validateMetric(metric *Metric) error {
 	if strings.TrimSpace(metric.ServiceName) == "" {
 		return errors.New("service name is required")
@@ -86,5 +269,87 @@ func (s *Service) validateAlert(alert *Alert) error {
 	if strings.TrimSpace(alert.UserID) == "" {
 		return errors.New("user ID is required")
 	}
+	if err := condition.Validate(alert.Condition); err != nil {
+		return err
+	}
 	return nil
 }
+
+// Background jobs run on the scheduler
+const (
+	notificationsJobName = "monitor.alert-notifications"
+	rollupJobName        = "monitor.metric-rollups"
+)
+
+// SetScheduler sets the scheduler background jobs run on, which is shared with
+// other services. Without one, Start schedules nothing.
+func (s *Service) SetScheduler(scheduler *core.Scheduler) {
+	s.scheduler = scheduler
+}
+
+// SetRollupDelay sets how long after a bucket ends it is rolled up
+func (s *Service) SetRollupDelay(delay time.Duration) {
+	s.rollupDelay = delay
+}
+
+// Start schedules metric rollups and alert evaluation, purges raw points past
+// the metric retention if one is set, and, if a notification pipeline is set,
+// flushes it every FlushInterval
+func (s *Service) Start() {
+	err := s.scheduler.Register(core.Job{
+		Name:     rollupJobName,
+		Schedule: core.Every(DefaultRollupInterval),
+		Run: func(ctx context.Context) error {
+			return s.RollupMetrics(ctx, time.Now().Add(-s.rollupDelay))
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule metric rollups: %v", err)
+	}
+
+	if s.metricRetention > 0 {
+		err = s.scheduler.Register(core.Job{
+			Name:     retentionJobName,
+			Schedule: core.Every(retentionInterval),
+			Run: func(ctx context.Context) error {
+				_, err := s.PurgeMetrics(ctx, time.Now())
+				return err
+			},
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to schedule metric retention: %v", err)
+		}
+	}
+
+	err = s.scheduler.Register(core.Job{
+		Name:     alertEvaluationJobName,
+		Schedule: core.Every(s.alertEvaluationInterval),
+		Run:      s.EvaluateAlerts,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule alert evaluation: %v", err)
+	}
+
+	if s.notifications == nil {
+		return
+	}
+	err = s.scheduler.Register(core.Job{
+		Name:     notificationsJobName,
+		Schedule: core.Every(s.notifications.config.FlushInterval),
+		Run:      s.notifications.Flush,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule alert notifications: %v", err)
+	}
+}
+
+// Close stops the background jobs and waits for in-flight runs to finish
+func (s *Service) Close(ctx context.Context) error {
+	var errs []error
+	for _, name := range []string{rollupJobName, retentionJobName, alertEvaluationJobName, notificationsJobName} {
+		if err := s.scheduler.Unregister(ctx, name); err != nil && !errors.Is(err, core.ErrJobNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -15,7 +16,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
-	err = db.AutoMigrate(&Metric{}, &Alert{})
+	err = db.AutoMigrate(&Metric{}, &Alert{}, &MetricRollup{}, &MetricRollupWatermark{})
 	require.NoError(t, err)
 
 	return db
@@ -100,4 +101,88 @@ func TestAlertOperations(t *testing.T) {
 		require.NoError(t, err)
 		assert.Len(t, retrieved, 2)
 	})
+
+	t.Run("should reject malformed conditions", func(t *testing.T) {
+		alert := &Alert{Name: "Broken", UserID: "user1", Condition: "cpu_usage >> 80"}
+
+		err := service.CreateAlert(ctx, alert)
+		assert.ErrorContains(t, err, "invalid condition")
+		assert.Zero(t, alert.ID)
+	})
+}
+
+func TestIngestBatch(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	ctx := context.Background()
+
+	t.Run("should accept valid metrics and reject invalid ones", func(t *testing.T) {
+		metrics := []*Metric{
+			{ServiceName: "api", Name: "requests", Value: 10, Timestamp: time.Now()},
+			{ServiceName: "", Name: "requests", Value: 11},
+			{ServiceName: "api", Name: "latency", Value: 0.25},
+			{ServiceName: "api", Name: ""},
+			nil,
+		}
+
+		results, err := service.IngestBatch(ctx, metrics)
+		require.NoError(t, err)
+		require.Len(t, results, 5)
+
+		assert.True(t, results[0].Accepted)
+		assert.False(t, results[1].Accepted)
+		assert.Contains(t, results[1].Error, "service name is required")
+		assert.True(t, results[2].Accepted)
+		assert.False(t, results[3].Accepted)
+		assert.Contains(t, results[3].Error, "metric name is required")
+		assert.False(t, results[4].Accepted)
+		for i, result := range results {
+			assert.Equal(t, i, result.Index)
+		}
+
+		stored, err := service.GetMetrics(ctx, "api")
+		require.NoError(t, err)
+		assert.Len(t, stored, 2)
+		assert.False(t, metrics[2].Timestamp.IsZero())
+	})
+
+	t.Run("should reject batches over the maximum size", func(t *testing.T) {
+		service.SetMaxBatchSize(2)
+		defer service.SetMaxBatchSize(DefaultMaxBatchSize)
+
+		metrics := []*Metric{
+			{ServiceName: "api", Name: "a"},
+			{ServiceName: "api", Name: "b"},
+			{ServiceName: "api", Name: "c"},
+		}
+		_, err := service.IngestBatch(ctx, metrics)
+		assert.ErrorIs(t, err, ErrBatchTooLarge)
+	})
+
+	t.Run("should shed load when too many batches are in flight", func(t *testing.T) {
+		service.SetMaxConcurrentBatches(1)
+		defer service.SetMaxConcurrentBatches(DefaultMaxConcurrentBatch)
+
+		service.ingestSlots <- struct{}{}
+		_, err := service.IngestBatch(ctx, []*Metric{{ServiceName: "api", Name: "a"}})
+		<-service.ingestSlots
+		assert.ErrorIs(t, err, ErrIngestBusy)
+	})
+}
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+
+	cpu := &Alert{UserID: "user1", Name: "cpu", Condition: "cpu > 90"}
+	require.NoError(t, service.CreateAlert(ctx, cpu))
+	require.NoError(t, service.CreateAlert(ctx, &Alert{UserID: "user1", Name: "disk", Condition: "disk > 90", Status: AlertStatusInactive}))
+	require.NoError(t, service.SetAlertStatus(ctx, cpu.ID, AlertStatusTriggered))
+
+	count, err := service.Count(ctx, "user1", core.CountFilter{GroupByStatus: true})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceTypeAlert, count.ResourceType)
+	assert.Equal(t, map[string]int64{"triggered": 1, "inactive": 1}, count.ByStatus)
 }
@@ -0,0 +1,138 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"gorm.io/gorm"
+)
+
+// WorkflowTrigger starts a remediation workflow on behalf of a user
+type WorkflowTrigger interface {
+	TriggerWorkflow(ctx context.Context, userID string, workflowID uint, input map[string]interface{}) error
+}
+
+// SetWorkflowTrigger sets what starts an alert's OnTriggerWorkflowID when the
+// alert triggers; without one no workflows are started
+func (s *Service) SetWorkflowTrigger(trigger WorkflowTrigger) {
+	s.workflowTrigger = trigger
+}
+
+// IntegrationNotifier delivers an alert that started or stopped firing through
+// one of its owner's hub integrations, such as Slack or a generic webhook
+type IntegrationNotifier interface {
+	NotifyIntegration(ctx context.Context, integrationID uint, alert *Alert, firing bool) error
+}
+
+// ErrIntegrationPaused is returned by an IntegrationNotifier for an
+// integration that is disabled
+var ErrIntegrationPaused = errors.New("integration is paused")
+
+// SetIntegrationNotifier sets how alerts with an IntegrationID are delivered
+func (s *Service) SetIntegrationNotifier(notifier IntegrationNotifier) {
+	s.integrationNotifier = notifier
+}
+
+// SetEventBus subscribes to integration status changes. While an integration
+// is disabled, alerts are not sent to it and are only reported through the
+// notification pipeline; they are sent to it again once it is enabled.
+func (s *Service) SetEventBus(bus *core.EventBus) {
+	bus.Subscribe(core.TopicIntegrationDisabled, func(ctx context.Context, event core.BusEvent) {
+		if payload, ok := event.Payload.(core.IntegrationStatusEvent); ok {
+			s.pausedIntegrations.Store(payload.IntegrationID, true)
+		}
+	})
+	bus.Subscribe(core.TopicIntegrationEnabled, func(ctx context.Context, event core.BusEvent) {
+		if payload, ok := event.Payload.(core.IntegrationStatusEvent); ok {
+			s.pausedIntegrations.Delete(payload.IntegrationID)
+		}
+	})
+}
+
+// notifyIntegration sends an alert that started or stopped firing to its
+// integration, unless the integration is paused
+func (s *Service) notifyIntegration(ctx context.Context, alert *Alert, firing bool) {
+	if _, paused := s.pausedIntegrations.Load(alert.IntegrationID); paused {
+		return
+	}
+	err := s.integrationNotifier.NotifyIntegration(ctx, alert.IntegrationID, alert, firing)
+	if errors.Is(err, ErrIntegrationPaused) {
+		log.Printf("⏸️  Integration %d is paused; alert %d was not sent to it", alert.IntegrationID, alert.ID)
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to notify integration %d of alert %d: %v", alert.IntegrationID, alert.ID, err)
+	}
+}
+
+// SetAlertStatus moves an alert to a new status. Entering or leaving
+// AlertStatusTriggered notifies, and entering it runs the OnTrigger workflow.
+func (s *Service) SetAlertStatus(ctx context.Context, alertID uint, status AlertStatus) error {
+	var alert Alert
+	err := s.db.WithContext(ctx).First(&alert, alertID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("alert %d not found", alertID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find alert: %w", err)
+	}
+
+	if alert.Status == status {
+		return nil
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": status, "status_changed_at": now}
+	if status == AlertStatusTriggered {
+		updates["last_triggered_at"] = now
+	}
+
+	// Conditional update so concurrent evaluators fire the transition only once
+	previous := alert
+	changed, err := database.UpdateChanged(s.db.WithContext(ctx).Where("status = ?", alert.Status), &alert, updates)
+	if err != nil {
+		return fmt.Errorf("failed to update alert status: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	// Both the pipeline and the integration hear of the alert firing and
+	// clearing. Integration failures are only logged, as the transition is
+	// already stored.
+	if status == AlertStatusTriggered || previous.Status == AlertStatusTriggered {
+		if s.notifications != nil {
+			observed := alert
+			s.notifications.Observe(&observed, status == AlertStatusTriggered)
+		}
+		if alert.IntegrationID != 0 && s.integrationNotifier != nil {
+			notified := alert
+			s.notifyIntegration(ctx, &notified, status == AlertStatusTriggered)
+		}
+	}
+
+	// Only the transition into triggered runs the workflow, so an alert that
+	// stays fired across evaluations does not re-trigger it
+	if status != AlertStatusTriggered || alert.OnTriggerWorkflowID == 0 || s.workflowTrigger == nil {
+		return nil
+	}
+
+	input := map[string]interface{}{
+		"alert_id":          alert.ID,
+		"alert_name":        alert.Name,
+		"alert_description": alert.Description,
+		"condition":         alert.Condition,
+		"previous_status":   previous.Status.String(),
+		"triggered_at":      now.Format(time.RFC3339),
+	}
+	if err := s.workflowTrigger.TriggerWorkflow(ctx, alert.UserID, alert.OnTriggerWorkflowID, input); err != nil {
+		return fmt.Errorf("failed to trigger workflow %d for alert %d: %w", alert.OnTriggerWorkflowID, alert.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWorkflowTrigger struct {
+	calls []fakeTriggerCall
+}
+
+type fakeTriggerCall struct {
+	userID     string
+	workflowID uint
+	input      map[string]interface{}
+}
+
+func (f *fakeWorkflowTrigger) TriggerWorkflow(ctx context.Context, userID string, workflowID uint, input map[string]interface{}) error {
+	f.calls = append(f.calls, fakeTriggerCall{userID: userID, workflowID: workflowID, input: input})
+	return nil
+}
+
+func TestAlertWorkflowTrigger(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	trigger := &fakeWorkflowTrigger{}
+	service.SetWorkflowTrigger(trigger)
+	ctx := context.Background()
+
+	alert := &Alert{
+		Name:                "High error rate",
+		UserID:              "user1",
+		Condition:           "error_rate > 5",
+		OnTriggerWorkflowID: 42,
+	}
+	require.NoError(t, service.CreateAlert(ctx, alert))
+
+	t.Run("should run the workflow when the alert fires", func(t *testing.T) {
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+
+		require.Len(t, trigger.calls, 1)
+		assert.Equal(t, "user1", trigger.calls[0].userID)
+		assert.Equal(t, uint(42), trigger.calls[0].workflowID)
+		assert.Equal(t, alert.ID, trigger.calls[0].input["alert_id"])
+		assert.Equal(t, "High error rate", trigger.calls[0].input["alert_name"])
+		assert.Equal(t, "error_rate > 5", trigger.calls[0].input["condition"])
+	})
+
+	t.Run("should not re-trigger while the alert stays fired", func(t *testing.T) {
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		assert.Len(t, trigger.calls, 1)
+	})
+
+	t.Run("should trigger again after the alert resolves and fires", func(t *testing.T) {
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusActive))
+		assert.Len(t, trigger.calls, 1)
+
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		assert.Len(t, trigger.calls, 2)
+
+		var stored Alert
+		require.NoError(t, db.First(&stored, alert.ID).Error)
+		assert.Equal(t, AlertStatusTriggered, stored.Status)
+		assert.NotNil(t, stored.LastTriggeredAt)
+	})
+
+	t.Run("should only bump UpdatedAt when the status changes", func(t *testing.T) {
+		stamp := time.Now().Add(-time.Hour).Round(time.Second)
+		require.NoError(t, db.Model(&Alert{}).Where("id = ?", alert.ID).UpdateColumn("updated_at", stamp).Error)
+		updatedAt := func() time.Time {
+			var stored Alert
+			require.NoError(t, db.First(&stored, alert.ID).Error)
+			return stored.UpdatedAt
+		}
+
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		assert.True(t, stamp.Equal(updatedAt()))
+
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusActive))
+		assert.True(t, updatedAt().After(stamp))
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+	})
+
+	t.Run("should skip alerts without a workflow", func(t *testing.T) {
+		plain := &Alert{Name: "Plain", UserID: "user1", Condition: "cpu > 90"}
+		require.NoError(t, service.CreateAlert(ctx, plain))
+		require.NoError(t, service.SetAlertStatus(ctx, plain.ID, AlertStatusTriggered))
+		assert.Len(t, trigger.calls, 3)
+	})
+}
+
+type fakeIntegrationNotifier struct {
+	calls []fakeNotifyCall
+	err   error
+}
+
+type fakeNotifyCall struct {
+	integrationID uint
+	alertID       uint
+	firing        bool
+}
+
+func (f *fakeIntegrationNotifier) NotifyIntegration(ctx context.Context, integrationID uint, alert *Alert, firing bool) error {
+	f.calls = append(f.calls, fakeNotifyCall{integrationID: integrationID, alertID: alert.ID, firing: firing})
+	return f.err
+}
+
+func TestAlertIntegrationNotifications(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	notifier := &fakeIntegrationNotifier{}
+	service.SetIntegrationNotifier(notifier)
+	ctx := context.Background()
+
+	alert := &Alert{Name: "High CPU", UserID: "user1", Condition: "cpu_usage > 80", IntegrationID: 9}
+	require.NoError(t, service.CreateAlert(ctx, alert))
+	require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "cpu_usage", Value: 95, Timestamp: time.Now()}))
+
+	t.Run("should notify once when the alert fires", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			require.NoError(t, service.EvaluateAlerts(ctx))
+		}
+		require.Len(t, notifier.calls, 1, "a still-firing alert is not re-notified")
+		assert.Equal(t, fakeNotifyCall{integrationID: 9, alertID: alert.ID, firing: true}, notifier.calls[0])
+	})
+
+	t.Run("should notify when the alert resolves", func(t *testing.T) {
+		require.NoError(t, service.CreateMetric(ctx, &Metric{ServiceName: "api", Name: "cpu_usage", Value: 10, Timestamp: time.Now().Add(time.Second)}))
+		require.NoError(t, service.EvaluateAlerts(ctx))
+		require.NoError(t, service.EvaluateAlerts(ctx))
+		require.Len(t, notifier.calls, 2)
+		assert.False(t, notifier.calls[1].firing)
+	})
+
+	t.Run("should log notification failures without failing the transition", func(t *testing.T) {
+		notifier.err = errors.New("integration 9 not found")
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		assert.Len(t, notifier.calls, 3)
+
+		var stored Alert
+		require.NoError(t, db.First(&stored, alert.ID).Error)
+		assert.Equal(t, AlertStatusTriggered, stored.Status)
+	})
+
+	t.Run("should skip alerts without an integration", func(t *testing.T) {
+		plain := &Alert{Name: "Plain", UserID: "user1", Condition: "cpu > 90"}
+		require.NoError(t, service.CreateAlert(ctx, plain))
+		require.NoError(t, service.SetAlertStatus(ctx, plain.ID, AlertStatusTriggered))
+		assert.Len(t, notifier.calls, 3)
+	})
+
+	t.Run("should pause notifications while the integration is disabled", func(t *testing.T) {
+		notifier.err = nil
+		events := core.NewEventBus()
+		service.SetEventBus(events)
+
+		events.Publish(ctx, core.BusEvent{Topic: core.TopicIntegrationDisabled, Payload: core.IntegrationStatusEvent{IntegrationID: 9}})
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusActive))
+		assert.Len(t, notifier.calls, 3, "a disabled integration is not notified")
+
+		events.Publish(ctx, core.BusEvent{Topic: core.TopicIntegrationEnabled, Payload: core.IntegrationStatusEvent{IntegrationID: 9}})
+		require.NoError(t, service.SetAlertStatus(ctx, alert.ID, AlertStatusTriggered))
+		assert.Len(t, notifier.calls, 4)
+	})
+}
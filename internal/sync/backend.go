@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrObjectNotFound is returned by StorageBackend.Stat when a key does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes an object held by a StorageBackend
+type ObjectInfo struct {
+	Key  string
+	Size int64
+}
+
+// StorageBackend is where a sync job reads or writes objects. Keys are
+// slash-separated and relative to the location the backend was opened at.
+type StorageBackend interface {
+	// List returns every object, sorted by key
+	List(ctx context.Context) ([]ObjectInfo, error)
+	Read(ctx context.Context, key string) (io.ReadCloser, error)
+	// Write stores r under key and returns the number of bytes written
+	Write(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// Stat describes key, or returns ErrObjectNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// BackendFactory opens the backend for a sync URI such as gcs://bucket/prefix.
+// credentials are those the job references for that side, or nil if none.
+type BackendFactory func(uri *url.URL, credentials *Credentials) (StorageBackend, error)
+
+// RegisterBackend makes sync jobs resolve URIs with the given scheme through
+// factory, replacing any backend already registered for it. file:// (also
+// used for plain paths) and s3:// are registered by NewService.
+func (s *Service) RegisterBackend(scheme string, factory BackendFactory) {
+	s.backendsMu.Lock()
+	defer s.backendsMu.Unlock()
+
+	s.backends[strings.ToLower(scheme)] = factory
+}
+
+// registerBuiltinBackends registers the file:// and s3:// backends
+func (s *Service) registerBuiltinBackends() {
+	s.RegisterBackend("file", func(uri *url.URL, _ *Credentials) (StorageBackend, error) {
+		if uri.Path == "" {
+			return nil, fmt.Errorf("empty path in '%s'", uri)
+		}
+		return &localStorage{root: uri.Path}, nil
+	})
+	s.RegisterBackend("s3", func(uri *url.URL, credentials *Credentials) (StorageBackend, error) {
+		config := s.s3Config
+		config.Bucket = uri.Host
+		if credentials != nil {
+			aws, err := credentials.AWS()
+			if err != nil {
+				return nil, err
+			}
+			config.AccessKeyID = aws.AccessKeyID
+			config.SecretAccessKey = aws.SecretAccessKey
+			if aws.Region != "" {
+				config.Region = aws.Region
+			}
+		}
+		storage, err := newS3Storage(config, strings.TrimPrefix(uri.Path, "/"))
+		if err != nil {
+			return nil, err
+		}
+		return storage, nil
+	})
+}
+
+// openBackend resolves a sync URI through the backend registered for its
+// scheme. A URI without a scheme is a local path.
+func (s *Service) openBackend(uri string, credentials *Credentials) (StorageBackend, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "" {
+		parsed = &url.URL{Scheme: "file", Path: uri}
+	}
+
+	s.backendsMu.RLock()
+	factory, ok := s.backends[strings.ToLower(parsed.Scheme)]
+	s.backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage scheme '%s'", parsed.Scheme)
+	}
+	return factory(parsed, credentials)
+}
+
+// localStorage syncs files under a directory
+type localStorage struct {
+	root string
+}
+
+func (l *localStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	objects := make([]ObjectInfo, 0)
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (l *localStorage) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(target)
+}
+
+func (l *localStorage) Write(ctx context.Context, key string, r io.Reader) (int64, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".sync-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return written, err
+	}
+	return written, os.Rename(tmp.Name(), target)
+}
+
+func (l *localStorage) Delete(ctx context.Context, key string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *localStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	target, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, fmt.Errorf("%w: '%s'", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: info.Size()}, nil
+}
+
+func (l *localStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned != "/"+key || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid object key '%s'", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(cleaned)), nil
+}
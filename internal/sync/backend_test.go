@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerMemoryBackends serves mem://<name> URIs from the given backends
+func registerMemoryBackends(service *Service, backends map[string]StorageBackend) {
+	service.RegisterBackend("mem", func(uri *url.URL, _ *Credentials) (StorageBackend, error) {
+		backend, ok := backends[uri.Host]
+		if !ok {
+			return nil, errors.New("no such memory backend")
+		}
+		return backend, nil
+	})
+}
+
+func TestStorageBackendRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should run a job between registered backends", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		source := newMemoryStorage(0)
+		source.objects["a.txt"] = []byte("hello")
+		source.objects["nested/b.txt"] = []byte("world!")
+		destination := newMemoryStorage(0)
+		destination.objects["stale.txt"] = []byte("old")
+
+		var opened []string
+		service.RegisterBackend("MEM", func(uri *url.URL, _ *Credentials) (StorageBackend, error) {
+			opened = append(opened, uri.String())
+			if uri.Host == "source" {
+				return source, nil
+			}
+			return destination, nil
+		})
+
+		job := &SyncJob{Name: "Memory", UserID: "user1", Source: "mem://source/data", Destination: "mem://destination", Mode: SyncModeMirror}
+		require.NoError(t, service.CreateSyncJob(ctx, job))
+		result, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"mem://source/data", "mem://destination"}, opened)
+		assert.Equal(t, 2, result.ObjectsTransferred)
+		assert.Equal(t, 1, result.ObjectsDeleted)
+		info, err := destination.Stat(ctx, "nested/b.txt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), info.Size)
+		_, err = destination.Stat(ctx, "stale.txt")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+	})
+
+	t.Run("should report a backend that fails to open", func(t *testing.T) {
+		service := NewService()
+		registerMemoryBackends(service, nil)
+		_, err := service.openBackend("mem://missing", nil)
+		assert.ErrorContains(t, err, "no such memory backend")
+	})
+
+	t.Run("should reject unregistered schemes", func(t *testing.T) {
+		_, err := NewService().openBackend("gcs://bucket/prefix", nil)
+		assert.ErrorContains(t, err, "unsupported storage scheme 'gcs'")
+	})
+
+	t.Run("should open plain paths and file URIs locally", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o600))
+
+		for _, uri := range []string{dir, "file://" + dir} {
+			backend, err := NewService().openBackend(uri, nil)
+			require.NoError(t, err)
+			info, err := backend.Stat(ctx, "a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, ObjectInfo{Key: "a.txt", Size: 5}, info)
+			_, err = backend.Stat(ctx, "missing.txt")
+			assert.ErrorIs(t, err, ErrObjectNotFound)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/s3"
+)
+
+// Config configures a sync Service
+type Config struct {
+	// S3 holds the endpoint and credentials for s3:// URIs; the bucket comes
+	// from each job's URI
+	S3 s3.Config `json:"s3" yaml:"s3"`
+	// BandwidthLimit caps the bytes per second of all jobs together; zero
+	// means unlimited
+	BandwidthLimit int64 `json:"bandwidth_limit" yaml:"bandwidth_limit"`
+	// MaxConcurrentJobs is how many sync jobs run at once; further runs
+	// queue for a slot
+	MaxConcurrentJobs int `json:"max_concurrent_jobs" yaml:"max_concurrent_jobs"`
+	// MaxJobDuration stops a run holding a slot longer than this; zero means
+	// unbounded
+	MaxJobDuration time.Duration `json:"max_job_duration" yaml:"max_job_duration"`
+}
+
+// DefaultConfig uses AWS S3 without credentials and no bandwidth limit
+func DefaultConfig() Config {
+	return Config{
+		S3:                s3.Config{Endpoint: "https://s3.amazonaws.com"},
+		MaxConcurrentJobs: DefaultMaxConcurrentJobs,
+		MaxJobDuration:    DefaultMaxJobDuration,
+	}
+}
+
+// Validate checks the S3 endpoint is an http(s) URL, S3 credentials are set as
+// a pair and the bandwidth, concurrency and duration limits are in range
+func (c Config) Validate() error {
+	if c.S3.Endpoint != "" {
+		endpoint, err := url.Parse(c.S3.Endpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("invalid S3 endpoint '%s'", c.S3.Endpoint)
+		}
+	}
+	if (c.S3.AccessKeyID == "") != (c.S3.SecretAccessKey == "") {
+		return errors.New("S3 access key ID and secret access key must be set together")
+	}
+	if c.BandwidthLimit < 0 {
+		return errors.New("bandwidth limit must not be negative")
+	}
+	if c.MaxConcurrentJobs < 1 {
+		return errors.New("max concurrent jobs must be at least 1")
+	}
+	if c.MaxJobDuration < 0 {
+		return errors.New("max job duration must not be negative")
+	}
+	return nil
+}
+
+// NewServiceWithConfig validates cfg and creates a sync service using it
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sync config: %w", err)
+	}
+	s := NewService()
+	s.SetS3Config(cfg.S3)
+	s.SetGlobalBandwidthLimit(cfg.BandwidthLimit)
+	s.SetMaxConcurrentJobs(cfg.MaxConcurrentJobs)
+	s.SetMaxJobDuration(cfg.MaxJobDuration)
+	return s, nil
+}
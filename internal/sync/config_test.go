@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("should create a service from a config", func(t *testing.T) {
+		config := Config{
+			S3:                s3.Config{Endpoint: "http://minio:9000", AccessKeyID: "key", SecretAccessKey: "secret"},
+			BandwidthLimit:    1 << 20,
+			MaxConcurrentJobs: 2,
+			MaxJobDuration:    time.Hour,
+		}
+		service, err := NewServiceWithConfig(config)
+		require.NoError(t, err)
+		assert.Equal(t, config.S3, service.s3Config)
+		assert.NotNil(t, service.globalBandwidth)
+		assert.Equal(t, 2, cap(service.jobSlots))
+		assert.Equal(t, time.Hour, service.maxJobDuration)
+
+		_, err = NewServiceWithConfig(DefaultConfig())
+		require.NoError(t, err)
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		for _, tc := range []struct {
+			config Config
+			err    string
+		}{
+			{Config{S3: s3.Config{Endpoint: "minio:9000"}}, "invalid S3 endpoint"},
+			{Config{S3: s3.Config{Endpoint: "ftp://minio"}}, "invalid S3 endpoint"},
+			{Config{S3: s3.Config{AccessKeyID: "key"}}, "must be set together"},
+			{Config{BandwidthLimit: -1}, "bandwidth limit must not be negative"},
+			{Config{}, "max concurrent jobs must be at least 1"},
+			{Config{MaxConcurrentJobs: 1, MaxJobDuration: -time.Second}, "max job duration must not be negative"},
+		} {
+			assert.ErrorContains(t, tc.config.Validate(), tc.err)
+			_, err := NewServiceWithConfig(tc.config)
+			assert.ErrorContains(t, err, "invalid sync config")
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SecretStore fetches secret values on behalf of a user. Implementations must
+// only return secrets the user is allowed to read.
+type SecretStore interface {
+	GetSecret(ctx context.Context, userID, key string) (string, error)
+}
+
+// SetSecretStore sets the store sync job credentials are read from
+func (s *Service) SetSecretStore(store SecretStore) {
+	s.secrets = store
+}
+
+// Credentials hold the secret a backend authenticates with. They are read
+// from the vault when a job runs and only kept in memory for that run; each
+// backend decodes the shape it expects.
+type Credentials struct {
+	secret string
+}
+
+// AWSCredentials are an access key pair stored as
+// {"access_key_id": "...", "secret_access_key": "...", "region": "..."}
+type AWSCredentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	// Region optionally overrides the configured region
+	Region string `json:"region,omitempty"`
+}
+
+// GCPServiceAccount is the JSON key file of a Google Cloud service account
+type GCPServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// AWS decodes the credentials as an AWS access key pair
+func (c *Credentials) AWS() (*AWSCredentials, error) {
+	var aws AWSCredentials
+	// The secret is never included in errors
+	if err := json.Unmarshal([]byte(c.secret), &aws); err != nil {
+		return nil, errors.New("AWS credentials must be a JSON object")
+	}
+	if aws.AccessKeyID == "" || aws.SecretAccessKey == "" {
+		return nil, errors.New("AWS credentials require access_key_id and secret_access_key")
+	}
+	return &aws, nil
+}
+
+// GCPServiceAccount decodes the credentials as a service account key file
+func (c *Credentials) GCPServiceAccount() (*GCPServiceAccount, error) {
+	var account GCPServiceAccount
+	if err := json.Unmarshal([]byte(c.secret), &account); err != nil {
+		return nil, errors.New("GCP credentials must be a service account JSON key")
+	}
+	if account.Type != "service_account" {
+		return nil, errors.New("GCP credentials must be a service account JSON key")
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("GCP service account key requires client_email and private_key")
+	}
+	return &account, nil
+}
+
+// resolveCredentials reads the credentials a job references by vault key, or
+// returns nil when key is empty
+func (s *Service) resolveCredentials(ctx context.Context, userID, key string) (*Credentials, error) {
+	if key == "" {
+		return nil, nil
+	}
+	if s.secrets == nil {
+		return nil, errors.New("job references credentials but no secret store is configured")
+	}
+	secret, err := s.secrets.GetSecret(ctx, userID, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials '%s': %w", key, err)
+	}
+	return &Credentials{secret: secret}, nil
+}
@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// SyncPlanAction is what a run would do with one object
+type SyncPlanAction string
+
+const (
+	// SyncPlanCreate copies an object the destination does not have
+	SyncPlanCreate SyncPlanAction = "create"
+	// SyncPlanUpdate copies an object over an existing destination object
+	SyncPlanUpdate SyncPlanAction = "update"
+	// SyncPlanSkip leaves an object already copied by the interrupted run being resumed
+	SyncPlanSkip SyncPlanAction = "skip"
+	// SyncPlanDelete removes a destination object missing from the source (mirror mode only)
+	SyncPlanDelete SyncPlanAction = "delete"
+)
+
+type SyncPlanItem struct {
+	Key    string         `json:"key"`
+	Size   int64          `json:"size"`
+	Action SyncPlanAction `json:"action"`
+}
+
+// SyncPlan is what running a sync job would change, computed without transferring anything
+type SyncPlan struct {
+	JobID           uint           `json:"job_id"`
+	Mode            SyncMode       `json:"mode"`
+	Resuming        bool           `json:"resuming"`
+	Items           []SyncPlanItem `json:"items"`
+	ObjectsToCopy   int            `json:"objects_to_copy"`
+	BytesToCopy     int64          `json:"bytes_to_copy"`
+	ObjectsToSkip   int            `json:"objects_to_skip"`
+	ObjectsToDelete int            `json:"objects_to_delete"`
+}
+
+// PlanSyncJob lists the source and destination and reports which objects the
+// next run would copy, skip or delete. Nothing is transferred and the job and
+// its checkpoint are left unchanged.
+func (s *Service) PlanSyncJob(ctx context.Context, userID string, jobID uint) (*SyncPlan, error) {
+	job, err := s.getSyncJob(ctx, userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	source, destination, err := s.openJobStorage(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	resuming := s.resuming(job)
+	synced := map[string]int64{}
+	if resuming {
+		if synced, err = s.loadCheckpoint(ctx, job); err != nil {
+			return nil, err
+		}
+	}
+
+	items, err := planTransfer(ctx, job, source, destination, synced, true)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{JobID: job.ID, Mode: job.Mode, Resuming: resuming, Items: items}
+	for _, item := range items {
+		switch item.Action {
+		case SyncPlanCreate, SyncPlanUpdate:
+			plan.ObjectsToCopy++
+			plan.BytesToCopy += item.Size
+		case SyncPlanSkip:
+			plan.ObjectsToSkip++
+		case SyncPlanDelete:
+			plan.ObjectsToDelete++
+		}
+	}
+	return plan, nil
+}
+
+// planTransfer classifies every object a run would touch, sorted by key. The
+// destination is only listed when listDestination is set; otherwise every copy
+// is planned as a create and nothing is deleted.
+func planTransfer(ctx context.Context, job *SyncJob, source, destination StorageBackend, synced map[string]int64, listDestination bool) ([]SyncPlanItem, error) {
+	objects, err := source.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source: %w", err)
+	}
+
+	existing := map[string]int64{}
+	if listDestination {
+		destinationObjects, err := destination.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list destination: %w", err)
+		}
+		for _, object := range destinationObjects {
+			existing[object.Key] = object.Size
+		}
+	}
+
+	items := make([]SyncPlanItem, 0, len(objects))
+	inSource := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		inSource[object.Key] = true
+		action := SyncPlanCreate
+		if size, ok := synced[object.Key]; ok && size == object.Size {
+			action = SyncPlanSkip
+		} else if _, ok := existing[object.Key]; ok {
+			action = SyncPlanUpdate
+		}
+		items = append(items, SyncPlanItem{Key: object.Key, Size: object.Size, Action: action})
+	}
+
+	if job.Mode == SyncModeMirror {
+		for key, size := range existing {
+			if !inSource[key] {
+				items = append(items, SyncPlanItem{Key: key, Size: size, Action: SyncPlanDelete})
+			}
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanSyncJob(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, mode SyncMode) (*Service, *SyncJob, *memoryStorage, *memoryStorage) {
+		db := setupTestDB(t)
+		service := NewService()
+		service.SetDB(db)
+
+		source := newMemoryStorage(0)
+		source.objects["new.txt"] = []byte("new")
+		source.objects["changed.txt"] = []byte("changed content")
+		source.objects["same.txt"] = []byte("same")
+		destination := newMemoryStorage(0)
+		destination.objects["changed.txt"] = []byte("old")
+		destination.objects["same.txt"] = []byte("same")
+		destination.objects["extra.txt"] = []byte("extra")
+		registerMemoryBackends(service, map[string]StorageBackend{"source": source, "destination": destination})
+
+		job := &SyncJob{Name: "Planned", UserID: "user1", Source: "mem://source", Destination: "mem://destination", Mode: mode}
+		require.NoError(t, service.CreateSyncJob(ctx, job))
+		return service, job, source, destination
+	}
+
+	actions := func(plan *SyncPlan) map[string]SyncPlanAction {
+		result := make(map[string]SyncPlanAction, len(plan.Items))
+		for _, item := range plan.Items {
+			result[item.Key] = item.Action
+		}
+		return result
+	}
+
+	t.Run("should classify objects for a mirror job without transferring", func(t *testing.T) {
+		service, job, _, destination := setup(t, SyncModeMirror)
+
+		plan, err := service.PlanSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]SyncPlanAction{
+			"changed.txt": SyncPlanUpdate,
+			"extra.txt":   SyncPlanDelete,
+			"new.txt":     SyncPlanCreate,
+			"same.txt":    SyncPlanUpdate,
+		}, actions(plan))
+		assert.Equal(t, 3, plan.ObjectsToCopy)
+		assert.Equal(t, int64(22), plan.BytesToCopy)
+		assert.Equal(t, 1, plan.ObjectsToDelete)
+
+		assert.Equal(t, "old", string(destination.objects["changed.txt"]))
+		assert.Contains(t, destination.objects, "extra.txt")
+		assert.NotContains(t, destination.objects, "new.txt")
+
+		unchanged, err := service.getSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusPending, unchanged.Status)
+		assert.Nil(t, unchanged.LastRunAt)
+	})
+
+	t.Run("should match what the run then does", func(t *testing.T) {
+		service, job, _, destination := setup(t, SyncModeMirror)
+
+		plan, err := service.PlanSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+
+		result, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, plan.ObjectsToCopy, result.ObjectsTransferred)
+		assert.Equal(t, plan.BytesToCopy, result.BytesTransferred)
+		assert.Equal(t, plan.ObjectsToDelete, result.ObjectsDeleted)
+		assert.NotContains(t, destination.objects, "extra.txt")
+		assert.Equal(t, "changed content", string(destination.objects["changed.txt"]))
+	})
+
+	t.Run("should not delete anything in copy mode", func(t *testing.T) {
+		service, job, _, destination := setup(t, SyncModeCopy)
+
+		plan, err := service.PlanSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.NotContains(t, actions(plan), "extra.txt")
+		assert.Equal(t, 0, plan.ObjectsToDelete)
+
+		_, err = service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Contains(t, destination.objects, "extra.txt")
+	})
+
+	t.Run("should skip objects checkpointed by an interrupted run", func(t *testing.T) {
+		service, job, _, _ := setup(t, SyncModeMirror)
+		job.Resume = true
+		job.Status = SyncStatusFailed
+		require.NoError(t, service.db.Save(job).Error)
+		require.NoError(t, service.recordSynced(job, ObjectInfo{Key: "new.txt", Size: 3}, 3))
+
+		plan, err := service.PlanSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.True(t, plan.Resuming)
+		assert.Equal(t, SyncPlanSkip, actions(plan)["new.txt"])
+		assert.Equal(t, 1, plan.ObjectsToSkip)
+		assert.Equal(t, 2, plan.ObjectsToCopy)
+
+		checkpoint, err := service.loadCheckpoint(ctx, job)
+		require.NoError(t, err)
+		assert.Len(t, checkpoint, 1)
+	})
+
+	t.Run("should not plan another user's job", func(t *testing.T) {
+		service, job, _, _ := setup(t, SyncModeCopy)
+
+		_, err := service.PlanSyncJob(ctx, "user2", job.ID)
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("should reject an unknown mode", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(setupTestDB(t))
+		job := &SyncJob{Name: "Bad", UserID: "user1", Source: "file:///a", Destination: "file:///b", Mode: "move"}
+		assert.Error(t, service.CreateSyncJob(ctx, job))
+	})
+}
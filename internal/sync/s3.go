@@ -0,0 +1,348 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/s3"
+)
+
+// DefaultPartSize is the multipart part size for S3 uploads. Objects larger
+// than one part are uploaded in parts; S3 requires every part but the last to
+// be at least 5 MiB.
+const DefaultPartSize = 8 << 20
+
+// s3Storage syncs objects under a key prefix of an S3-compatible bucket
+type s3Storage struct {
+	client   *s3.Client
+	prefix   string
+	partSize int
+	retry    core.RetryPolicy
+}
+
+func newS3Storage(config s3.Config, prefix string) (*s3Storage, error) {
+	client, err := s3.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	retry := core.DefaultRetryPolicy()
+	retry.Retryable = retryableS3Error
+	return &s3Storage{client: client, prefix: prefix, partSize: DefaultPartSize, retry: retry}, nil
+}
+
+// retryableS3Error retries transport failures, throttling, server errors and
+// uploads corrupted on the way, which S3 rejects as BadDigest, but not other
+// requests S3 rejected
+func retryableS3Error(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var responseErr *s3.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.Temporary() || strings.Contains(responseErr.Message, "BadDigest")
+	}
+	return true
+}
+
+func (st *s3Storage) List(ctx context.Context) ([]ObjectInfo, error) {
+	objects := make([]ObjectInfo, 0)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {st.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := st.do(ctx, http.MethodGet, "", query, nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			if key := strings.TrimPrefix(object.Key, st.prefix); key != "" && !strings.HasSuffix(key, "/") {
+				objects = append(objects, ObjectInfo{Key: key, Size: object.Size})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (st *s3Storage) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := st.client.Do(ctx, http.MethodGet, st.prefix+key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s3.Error(resp)
+	}
+	return resp.Body, nil
+}
+
+func (st *s3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := st.client.Do(ctx, http.MethodDelete, st.prefix+key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3.Error(resp)
+	}
+	return nil
+}
+
+func (st *s3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := st.client.Do(ctx, http.MethodHead, st.prefix+key, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ObjectInfo{}, fmt.Errorf("%w: '%s'", ErrObjectNotFound, key)
+	}
+	if resp.StatusCode/100 != 2 {
+		return ObjectInfo{}, s3.Error(resp)
+	}
+	return ObjectInfo{Key: key, Size: resp.ContentLength}, nil
+}
+
+// Write uploads an object, in parts when it is larger than one part. Each PUT
+// is retried on its own and carries the MD5 of the bytes read from r as
+// Content-MD5, so S3 rejects bytes corrupted on the way.
+func (st *s3Storage) Write(ctx context.Context, key string, r io.Reader) (int64, error) {
+	objectKey := st.prefix + key
+
+	first := make([]byte, st.partSize)
+	n, err := io.ReadFull(r, first)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		body := first[:n]
+		err := core.Retry(ctx, st.retry, func(int) error {
+			_, err := st.put(ctx, objectKey, nil, body)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		return int64(n), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return st.writeMultipart(ctx, objectKey, first, r)
+}
+
+// put uploads an object or part and returns the ETag S3 reports for it. S3
+// checks the body against its Content-MD5; the ETag itself is only the MD5 of
+// the body for unencrypted or SSE-S3 objects, so it is not compared.
+func (st *s3Storage) put(ctx context.Context, objectKey string, query url.Values, body []byte) (string, error) {
+	sum := md5.Sum(body)
+	header := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}}
+	resp, err := st.client.DoWithHeader(ctx, http.MethodPut, objectKey, query, header, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", s3.Error(resp)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// writeMultipart uploads r in parts, starting with first. An upload left
+// unfinished by a failed run is resumed: parts S3 already holds with the same
+// content, judged by their ETag, are not sent again. Where ETags are not MD5s,
+// as with SSE-KMS, every part is sent again. Unfinished uploads are not aborted so a later
+// run can resume them; a bucket lifecycle rule should clean up abandoned ones.
+func (st *s3Storage) writeMultipart(ctx context.Context, objectKey string, first []byte, r io.Reader) (int64, error) {
+	uploadID, uploaded, err := st.findUpload(ctx, objectKey)
+	if err != nil {
+		return 0, err
+	}
+	if uploadID == "" {
+		if uploadID, err = st.createUpload(ctx, objectKey); err != nil {
+			return 0, err
+		}
+	}
+
+	var (
+		parts   []completedPart
+		written int64
+		buffer  = make([]byte, st.partSize)
+	)
+	part := first
+	for number := 1; len(part) > 0; number++ {
+		sum := md5.Sum(part)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+		if uploaded[number] != etag {
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+			err := core.Retry(ctx, st.retry, func(int) error {
+				var err error
+				etag, err = st.put(ctx, objectKey, query, part)
+				return err
+			})
+			if err != nil {
+				return written, fmt.Errorf("failed to upload part %d: %w", number, err)
+			}
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+		written += int64(len(part))
+
+		n, err := io.ReadFull(r, buffer)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return written, err
+		}
+		part = buffer[:n]
+	}
+
+	if err := st.completeUpload(ctx, objectKey, uploadID, parts); err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// findUpload returns an unfinished upload of the object and the ETags of its parts by number
+func (st *s3Storage) findUpload(ctx context.Context, objectKey string) (string, map[int]string, error) {
+	var uploads struct {
+		Uploads []struct {
+			Key      string `xml:"Key"`
+			UploadID string `xml:"UploadId"`
+		} `xml:"Upload"`
+	}
+	query := url.Values{"uploads": {""}, "prefix": {objectKey}}
+	if err := st.do(ctx, http.MethodGet, "", query, nil, &uploads); err != nil {
+		return "", nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+	}
+
+	uploadID := ""
+	for _, upload := range uploads.Uploads {
+		if upload.Key == objectKey {
+			uploadID = upload.UploadID
+		}
+	}
+	if uploadID == "" {
+		return "", nil, nil
+	}
+
+	uploaded := make(map[int]string)
+	marker := ""
+	for {
+		query := url.Values{"uploadId": {uploadID}}
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		var result struct {
+			Parts []struct {
+				PartNumber int    `xml:"PartNumber"`
+				ETag       string `xml:"ETag"`
+			} `xml:"Part"`
+			IsTruncated          bool   `xml:"IsTruncated"`
+			NextPartNumberMarker string `xml:"NextPartNumberMarker"`
+		}
+		if err := st.do(ctx, http.MethodGet, objectKey, query, nil, &result); err != nil {
+			return "", nil, fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+		for _, part := range result.Parts {
+			uploaded[part.PartNumber] = part.ETag
+		}
+		if !result.IsTruncated || result.NextPartNumberMarker == "" {
+			return uploadID, uploaded, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (st *s3Storage) createUpload(ctx context.Context, objectKey string) (string, error) {
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err := core.Retry(ctx, st.retry, func(int) error {
+		return st.do(ctx, http.MethodPost, objectKey, url.Values{"uploads": {""}}, nil, &result)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	if result.UploadID == "" {
+		return "", errors.New("failed to start multipart upload: no upload ID returned")
+	}
+	return result.UploadID, nil
+}
+
+// completeUpload assembles the parts into the object
+func (st *s3Storage) completeUpload(ctx context.Context, objectKey, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("failed to encode multipart completion: %w", err)
+	}
+
+	// S3 can report a failed completion in the body of a 200 response
+	var result struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	err = core.Retry(ctx, st.retry, func(int) error {
+		result.Code, result.Message = "", ""
+		if err := st.do(ctx, http.MethodPost, objectKey, url.Values{"uploadId": {uploadID}}, body, &result); err != nil {
+			return err
+		}
+		if result.Code != "" {
+			return &s3.ResponseError{StatusCode: http.StatusInternalServerError, Message: result.Code + ": " + result.Message}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// do sends a request and decodes the XML response into result
+func (st *s3Storage) do(ctx context.Context, method, objectKey string, query url.Values, body []byte, result interface{}) error {
+	resp, err := st.client.Do(ctx, method, objectKey, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return s3.Error(resp)
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode S3 response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a minimal in-memory S3 bucket supporting object and multipart requests
+type fakeS3 struct {
+	mu       stdsync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte // upload ID -> part number -> data
+	keys     map[string]string         // upload ID -> object key
+	nextID   int
+	puts     map[int]int // part number -> PUT attempts
+	failPart func(number, attempt int) int
+	// kms makes ETags other than the MD5 of the data, as SSE-KMS does
+	kms bool
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+		keys:    make(map[string]string),
+		puts:    make(map[int]int),
+	}
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *fakeS3) etag(data []byte) string {
+	if f.kms {
+		return `"` + md5Hex(append([]byte("kms:"), data...)) + `"`
+	}
+	return `"` + md5Hex(data) + `"`
+}
+
+// readBody reads a PUT body, responding BadDigest when it does not match its Content-MD5
+func (f *fakeS3) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, _ := io.ReadAll(r.Body)
+	sum := md5.Sum(data)
+	if digest := r.Header.Get("Content-MD5"); digest != "" && digest != base64.StdEncoding.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "<Error><Code>BadDigest</Code></Error>")
+		return nil, false
+	}
+	return data, true
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	_, hasUploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/bucket" && hasUploads:
+		fmt.Fprint(w, "<ListMultipartUploadsResult>")
+		for id, uploadKey := range f.keys {
+			if strings.HasPrefix(uploadKey, query.Get("prefix")) {
+				fmt.Fprintf(w, "<Upload><Key>%s</Key><UploadId>%s</UploadId></Upload>", uploadKey, id)
+			}
+		}
+		fmt.Fprint(w, "</ListMultipartUploadsResult>")
+	case r.Method == http.MethodGet && r.URL.Path == "/bucket":
+		keys := make([]string, 0, len(f.objects))
+		for k := range f.objects {
+			if strings.HasPrefix(k, query.Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprint(w, "<ListBucketResult>")
+		for _, k := range keys {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", k, len(f.objects[k]))
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+	case r.Method == http.MethodPost && hasUploads:
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		f.keys[id] = key
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodGet && uploadID != "":
+		numbers := make([]int, 0, len(f.uploads[uploadID]))
+		for number := range f.uploads[uploadID] {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		fmt.Fprint(w, "<ListPartsResult>")
+		for _, number := range numbers {
+			fmt.Fprintf(w, `<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>`, number, html.EscapeString(f.etag(f.uploads[uploadID][number])))
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListPartsResult>")
+	case r.Method == http.MethodPut && uploadID != "":
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.puts[number]++
+		if f.failPart != nil {
+			if status := f.failPart(number, f.puts[number]); status != 0 {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		data, ok := f.readBody(w, r)
+		if !ok {
+			return
+		}
+		f.uploads[uploadID][number] = data
+		w.Header().Set("ETag", f.etag(data))
+	case r.Method == http.MethodPost && uploadID != "":
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var object []byte
+		for _, part := range complete.Parts {
+			data, ok := f.uploads[uploadID][part.PartNumber]
+			if !ok || part.ETag != f.etag(data) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code></Error>")
+				return
+			}
+			object = append(object, data...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, uploadID)
+		delete(f.keys, uploadID)
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"0123-4"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodPut:
+		data, ok := f.readBody(w, r)
+		if !ok {
+			return
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", f.etag(data))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newTestS3Storage(t *testing.T, fake http.Handler, prefix string) *s3Storage {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	storage, err := newS3Storage(s3.Config{
+		Endpoint:        server.URL,
+		Bucket:          "bucket",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	}, prefix)
+	require.NoError(t, err)
+	storage.partSize = 1024
+	storage.retry.BaseDelay = time.Millisecond
+	return storage
+}
+
+func TestS3Storage(t *testing.T) {
+	ctx := context.Background()
+	large := bytes.Repeat([]byte("0123456789abcdef"), 200) // 3200 bytes, 4 parts
+
+	t.Run("should round-trip small objects under the prefix", func(t *testing.T) {
+		fake := newFakeS3()
+		storage := newTestS3Storage(t, fake, "backups")
+
+		written, err := storage.Write(ctx, "a.txt", strings.NewReader("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), written)
+		assert.Equal(t, "hello", string(fake.objects["backups/a.txt"]))
+
+		objects, err := storage.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []ObjectInfo{{Key: "a.txt", Size: 5}}, objects)
+
+		info, err := storage.Stat(ctx, "a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, ObjectInfo{Key: "a.txt", Size: 5}, info)
+		_, err = storage.Stat(ctx, "missing.txt")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+
+		reader, err := storage.Read(ctx, "a.txt")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		assert.Equal(t, "hello", string(data))
+
+		require.NoError(t, storage.Delete(ctx, "a.txt"))
+		assert.Empty(t, fake.objects)
+	})
+
+	t.Run("should upload large objects in parts and retry a failed part", func(t *testing.T) {
+		fake := newFakeS3()
+		fake.failPart = func(number, attempt int) int {
+			if number == 2 && attempt == 1 {
+				return http.StatusServiceUnavailable
+			}
+			return 0
+		}
+		storage := newTestS3Storage(t, fake, "")
+
+		written, err := storage.Write(ctx, "large.bin", bytes.NewReader(large))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(large)), written)
+		assert.Equal(t, large, fake.objects["large.bin"])
+		assert.Equal(t, map[int]int{1: 1, 2: 2, 3: 1, 4: 1}, fake.puts)
+		assert.Empty(t, fake.uploads)
+	})
+
+	t.Run("should resume an unfinished upload without resending stored parts", func(t *testing.T) {
+		fake := newFakeS3()
+		fake.failPart = func(number, attempt int) int {
+			if number == 3 {
+				return http.StatusForbidden
+			}
+			return 0
+		}
+		storage := newTestS3Storage(t, fake, "")
+
+		_, err := storage.Write(ctx, "large.bin", bytes.NewReader(large))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "part 3")
+		assert.Equal(t, 1, fake.puts[3], "rejected parts should not be retried")
+		assert.Len(t, fake.uploads, 1)
+
+		fake.failPart = nil
+		fake.puts = make(map[int]int)
+		_, err = storage.Write(ctx, "large.bin", bytes.NewReader(large))
+		require.NoError(t, err)
+		assert.Equal(t, large, fake.objects["large.bin"])
+		assert.Equal(t, map[int]int{3: 1, 4: 1}, fake.puts)
+	})
+
+	t.Run("should retry parts corrupted on the way", func(t *testing.T) {
+		fake := newFakeS3()
+		corrupted := false
+		corrupting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && r.URL.Query().Get("partNumber") == "2" && !corrupted {
+				corrupted = true
+				data, _ := io.ReadAll(r.Body)
+				data[0] ^= 0xff
+				r.Body = io.NopCloser(bytes.NewReader(data))
+			}
+			fake.ServeHTTP(w, r)
+		})
+		storage := newTestS3Storage(t, corrupting, "")
+
+		_, err := storage.Write(ctx, "large.bin", bytes.NewReader(large))
+		require.NoError(t, err)
+		assert.Equal(t, large, fake.objects["large.bin"])
+		assert.Equal(t, 2, fake.puts[2])
+	})
+
+	t.Run("should upload to buckets whose ETags are not MD5s", func(t *testing.T) {
+		fake := newFakeS3()
+		fake.kms = true
+		storage := newTestS3Storage(t, fake, "")
+
+		_, err := storage.Write(ctx, "small.txt", strings.NewReader("hello"))
+		require.NoError(t, err)
+		_, err = storage.Write(ctx, "large.bin", bytes.NewReader(large))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(fake.objects["small.txt"]))
+		assert.Equal(t, large, fake.objects["large.bin"])
+	})
+
+	t.Run("should be used for s3 URIs", func(t *testing.T) {
+		service := NewService()
+		service.SetS3Config(s3.Config{Endpoint: "http://minio:9000", AccessKeyID: "AKID", SecretAccessKey: "secret"})
+
+		opened, err := service.openBackend("s3://bucket/nightly", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "nightly/", opened.(*s3Storage).prefix)
+	})
+}
@@ -5,23 +5,58 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	stdsync "sync"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"github.com/ataiva-software/vertex/pkg/s3"
 	"gorm.io/gorm"
 )
 
+const MaxSyncConcurrency = 64
+
 type Service struct {
-	db *gorm.DB
+	db              *gorm.DB
+	bandwidthMu     stdsync.RWMutex
+	globalBandwidth *bandwidthLimiter
+	s3Config        s3.Config
+	backendsMu      stdsync.RWMutex
+	backends        map[string]BackendFactory
+	secrets         SecretStore
+	jobSlots        chan struct{}
+	maxJobDuration  time.Duration
+	scheduler       *core.Scheduler
+	// active counts the runs of each job in progress in this service
+	activeMu stdsync.Mutex
+	active   map[uint]int
 }
 
 func NewService() *Service {
-	return &Service{}
+	s := &Service{
+		backends:       make(map[string]BackendFactory),
+		jobSlots:       make(chan struct{}, DefaultMaxConcurrentJobs),
+		maxJobDuration: DefaultMaxJobDuration,
+		active:         make(map[uint]int),
+	}
+	s.registerBuiltinBackends()
+	return s
 }
 
 func (s *Service) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+// SetS3Config sets the endpoint and credentials for s3:// sources and
+// destinations; the bucket comes from each job's URI
+func (s *Service) SetS3Config(config s3.Config) {
+	s.s3Config = config
+}
+
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return database.CheckConnection(ctx, s.db)
+}
+
 func (s *Service) CreateSyncJob(ctx context.Context, job *SyncJob) error {
 	if err := s.validateSyncJob(job); err != nil {
 		return err
@@ -30,6 +65,9 @@ func (s *Service) CreateSyncJob(ctx context.Context, job *SyncJob) error {
 	if job.Status == 0 {
 		job.Status = SyncStatusPending
 	}
+	if job.Mode == "" {
+		job.Mode = SyncModeCopy
+	}
 
 	if err := s.db.Create(job).Error; err != nil {
 		return fmt.Errorf("failed to create sync job: %w", err)
@@ -48,6 +86,21 @@ func (s *Service) GetSyncJobs(ctx context.Context, userID string) ([]*SyncJob, e
 	return jobs, nil
 }
 
+// GetSyncJobsPage returns one page of the user's sync jobs, reading only that
+// page from the store
+func (s *Service) GetSyncJobsPage(ctx context.Context, userID string, request core.PageRequest) (*core.Page[*SyncJob], error) {
+	page, err := database.Paginate[*SyncJob](s.db.WithContext(ctx).Model(&SyncJob{}).Where("user_id = ?", userID).Order("id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync jobs: %w", err)
+	}
+	return page, nil
+}
+
+func (s *Service) Count(ctx context.Context, userID string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	query := s.db.WithContext(ctx).Model(&SyncJob{}).Where("user_id = ?", userID)
+	return database.CountByStatus[SyncStatus](query, core.ResourceTypeSyncJob, filters...)
+}
+
 func (s *Service) validateSyncJob(job *SyncJob) error {
 	if strings.TrimSpace(job.Name) == "" {
 		return errors.New("name is required")
@@ -61,6 +114,17 @@ func (s *Service) validateSyncJob(job *SyncJob) error {
 	if strings.TrimSpace(job.Destination) == "" {
 		return errors.New("destination is required")
 	}
+	if job.BandwidthLimit < 0 {
+		return errors.New("bandwidth limit cannot be negative")
+	}
+	if job.Concurrency < 0 || job.Concurrency > MaxSyncConcurrency {
+		return fmt.Errorf("concurrency must be between 0 and %d", MaxSyncConcurrency)
+	}
+	switch job.Mode {
+	case "", SyncModeCopy, SyncModeMirror:
+	default:
+		return fmt.Errorf("invalid sync mode '%s'", job.Mode)
+	}
 	return nil
 }
 
@@ -71,15 +135,55 @@ type SyncJob struct {
 	Source      string     `json:"source" gorm:"not null"`
 	Destination string     `json:"destination" gorm:"not null"`
 	Status      SyncStatus `json:"status" gorm:"default:0"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	Mode        SyncMode   `json:"mode" gorm:"default:copy"`
+	// BandwidthLimit caps the transfer rate in bytes per second; 0 means unlimited
+	BandwidthLimit int64 `json:"bandwidth_limit" gorm:"default:0"`
+	// Concurrency is the number of objects transferred in parallel; 0 or 1 copies serially
+	Concurrency int `json:"concurrency" gorm:"default:1"`
+	// SourceCredentials is the vault key of the secret the source authenticates
+	// with; empty uses the service's defaults
+	SourceCredentials string `json:"source_credentials,omitempty"`
+	// DestinationCredentials is the same for the destination
+	DestinationCredentials string `json:"destination_credentials,omitempty"`
+	// Resume skips objects already synced by a previous failed run
+	Resume             bool           `json:"resume" gorm:"default:false"`
+	ObjectsTransferred int            `json:"objects_transferred" gorm:"default:0"`
+	BytesTransferred   int64          `json:"bytes_transferred" gorm:"default:0"`
+	ObjectsSkipped     int            `json:"objects_skipped" gorm:"default:0"`
+	ObjectsDeleted     int            `json:"objects_deleted" gorm:"default:0"`
+	Error              string         `json:"error,omitempty"`
+	LastRunAt          *time.Time     `json:"last_run_at"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (SyncJob) TableName() string {
 	return "sync_jobs"
 }
 
+type SyncedObject struct {
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	JobID    uint      `json:"job_id" gorm:"uniqueIndex:idx_synced_objects_job_key;not null"`
+	Key      string    `json:"key" gorm:"uniqueIndex:idx_synced_objects_job_key;not null"`
+	Size     int64     `json:"size"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+func (SyncedObject) TableName() string {
+	return "synced_objects"
+}
+
+// SyncMode controls what a sync job does with destination objects that are not in the source
+type SyncMode string
+
+const (
+	// SyncModeCopy copies source objects and leaves other destination objects alone
+	SyncModeCopy SyncMode = "copy"
+	// SyncModeMirror also deletes destination objects that are not in the source
+	SyncModeMirror SyncMode = "mirror"
+)
+
 type SyncStatus int
 
 const (
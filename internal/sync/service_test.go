@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -14,9 +15,14 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
-	err = db.AutoMigrate(&SyncJob{})
+	err = db.AutoMigrate(&SyncJob{}, &SyncedObject{})
 	require.NoError(t, err)
 
+	// Each connection to :memory: is a separate database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
 	return db
 }
 
@@ -63,3 +69,20 @@ func TestSyncJobOperations(t *testing.T) {
 		assert.Len(t, retrieved, 2)
 	})
 }
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+
+	for _, status := range []SyncStatus{SyncStatusPending, SyncStatusRunning, SyncStatusCompleted, SyncStatusFailed} {
+		require.NoError(t, db.Create(&SyncJob{UserID: "user1", Name: status.String(), Source: "/src", Destination: "/dst", Status: status}).Error)
+	}
+
+	count, err := service.Count(ctx, "user1", core.CountFilter{GroupByStatus: true})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceTypeSyncJob, count.ResourceType)
+	assert.Equal(t, int64(4), count.Total)
+	assert.Equal(t, map[string]int64{"pending": 1, "running": 1, "completed": 1, "failed": 1}, count.ByStatus)
+}
@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+const (
+	// DefaultMaxConcurrentJobs is how many sync jobs run at once unless configured
+	DefaultMaxConcurrentJobs = 4
+	// DefaultMaxJobDuration bounds how long a job holds its slot unless configured
+	DefaultMaxJobDuration = 6 * time.Hour
+	// staleJobGrace is how long past the max job duration a run may take to
+	// record its outcome before it is considered stopped
+	staleJobGrace = 5 * time.Minute
+	// staleJobCheckInterval is how often stale runs are looked for
+	staleJobCheckInterval = 10 * time.Minute
+)
+
+// staleJobsJobName is the scheduler job failing runs that stopped unrecorded
+const staleJobsJobName = "sync.stale-jobs"
+
+// SetMaxConcurrentJobs limits how many sync jobs run at once across all users.
+// Runs beyond the limit wait for a slot and are admitted in the order they
+// arrived.
+func (s *Service) SetMaxConcurrentJobs(n int) {
+	s.jobSlots = make(chan struct{}, n)
+}
+
+// SetMaxJobDuration bounds how long a run may hold its slot, so a job that
+// never finishes cannot keep queued jobs waiting forever. A run stopped by it
+// fails and, with Resume set, continues from its checkpoint next time. Zero
+// means unbounded.
+func (s *Service) SetMaxJobDuration(d time.Duration) {
+	s.maxJobDuration = d
+}
+
+// acquireJobSlot waits for a free slot, returning a func releasing it and the
+// context the run should use, bounded by the max job duration
+func (s *Service) acquireJobSlot(ctx context.Context, jobID uint) (context.Context, func(), error) {
+	slots := s.jobSlots
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("sync job %d gave up waiting for a slot: %w", jobID, ctx.Err())
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if s.maxJobDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.maxJobDuration)
+	}
+	return ctx, func() {
+		cancel()
+		<-slots
+	}, nil
+}
+
+// SetScheduler sets the scheduler stale runs are reaped on, which is shared
+// with other services. Without one, a run whose process stopped stays Running
+// until the job is run again.
+func (s *Service) SetScheduler(scheduler *core.Scheduler) {
+	s.scheduler = scheduler
+}
+
+// Start reaps stale runs periodically, if runs are bounded by a max job
+// duration; see ReapStaleJobs
+func (s *Service) Start() {
+	if s.maxJobDuration <= 0 {
+		return
+	}
+	err := s.scheduler.Register(core.Job{
+		Name:     staleJobsJobName,
+		Schedule: core.Every(staleJobCheckInterval),
+		Run: func(ctx context.Context) error {
+			_, err := s.ReapStaleJobs(ctx, time.Now())
+			return err
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule stale sync job reaping: %v", err)
+	}
+}
+
+// Close stops reaping stale runs
+func (s *Service) Close(ctx context.Context) error {
+	if err := s.scheduler.Unregister(ctx, staleJobsJobName); err != nil && !errors.Is(err, core.ErrJobNotFound) {
+		return err
+	}
+	return nil
+}
+
+// ReapStaleJobs marks jobs Failed that are still Running although their run
+// started longer than the max job duration ago, which means the process
+// running them stopped before recording the outcome. Such jobs can then be
+// run again, resuming from their checkpoint if Resume is set. It returns how
+// many jobs it failed.
+func (s *Service) ReapStaleJobs(ctx context.Context, now time.Time) (int64, error) {
+	if s.maxJobDuration <= 0 {
+		return 0, nil
+	}
+
+	query := s.db.WithContext(ctx).Model(&SyncJob{}).
+		Where("status = ? AND last_run_at < ?", SyncStatusRunning, now.Add(-s.maxJobDuration-staleJobGrace))
+	if active := s.activeJobs(); len(active) > 0 {
+		query = query.Where("id NOT IN ?", active)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status": SyncStatusFailed,
+		"error":  "sync job stopped without recording its outcome",
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to reap stale sync jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
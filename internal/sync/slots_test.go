@@ -0,0 +1,185 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingStorage is a source whose listing holds the run until released
+type blockingStorage struct {
+	*memoryStorage
+	started chan string
+	release chan struct{}
+	name    string
+}
+
+func (b *blockingStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	b.started <- b.name
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return b.memoryStorage.List(ctx)
+}
+
+func TestSyncJobSlots(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	setup := func(t *testing.T, slots, jobs int) (*Service, []*SyncJob, map[string]chan struct{}, chan string) {
+		service := NewService()
+		service.SetDB(db)
+		service.SetMaxConcurrentJobs(slots)
+
+		started := make(chan string, jobs)
+		releases := make(map[string]chan struct{}, jobs)
+		service.RegisterBackend("blocking", func(uri *url.URL, _ *Credentials) (StorageBackend, error) {
+			return &blockingStorage{memoryStorage: newMemoryStorage(0), started: started, release: releases[uri.Host], name: uri.Host}, nil
+		})
+
+		created := make([]*SyncJob, jobs)
+		for i := range created {
+			name := fmt.Sprintf("job%d", i)
+			releases[name] = make(chan struct{})
+			created[i] = &SyncJob{Name: name, UserID: "user1", Source: "blocking://" + name, Destination: "file://" + t.TempDir()}
+			require.NoError(t, service.CreateSyncJob(ctx, created[i]))
+		}
+		return service, created, releases, started
+	}
+	run := func(service *Service, ctx context.Context, job *SyncJob) chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := service.RunSyncJob(ctx, "user1", job.ID)
+			done <- err
+		}()
+		return done
+	}
+
+	t.Run("should queue the job after the limit until a slot frees", func(t *testing.T) {
+		service, jobs, releases, started := setup(t, 2, 3)
+
+		first := run(service, ctx, jobs[0])
+		assert.Equal(t, "job0", <-started)
+		second := run(service, ctx, jobs[1])
+		assert.Equal(t, "job1", <-started)
+		third := run(service, ctx, jobs[2])
+
+		select {
+		case name := <-started:
+			t.Fatalf("%s started while both slots were taken", name)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(releases["job1"])
+		require.NoError(t, <-second)
+		assert.Equal(t, "job2", <-started)
+
+		close(releases["job0"])
+		close(releases["job2"])
+		require.NoError(t, <-first)
+		require.NoError(t, <-third)
+	})
+
+	t.Run("should admit queued jobs in the order they arrived", func(t *testing.T) {
+		service, jobs, releases, started := setup(t, 1, 4)
+
+		var done []chan error
+		done = append(done, run(service, ctx, jobs[0]))
+		assert.Equal(t, "job0", <-started)
+		for _, job := range jobs[1:] {
+			done = append(done, run(service, ctx, job))
+			// Give each run time to queue before the next arrives
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		for i := range jobs {
+			name := fmt.Sprintf("job%d", i)
+			if i > 0 {
+				assert.Equal(t, name, <-started)
+			}
+			close(releases[name])
+			require.NoError(t, <-done[i])
+		}
+	})
+
+	t.Run("should stop a run that holds its slot too long", func(t *testing.T) {
+		service, jobs, releases, started := setup(t, 1, 2)
+		service.SetMaxJobDuration(50 * time.Millisecond)
+		defer close(releases["job1"])
+
+		first := run(service, ctx, jobs[0])
+		<-started
+		second := run(service, ctx, jobs[1])
+
+		err := <-first
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, "job1", <-started, "the queued job runs once the slot is freed")
+
+		job, err := service.getSyncJob(ctx, "user1", jobs[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusFailed, job.Status)
+		assert.ErrorIs(t, <-second, context.DeadlineExceeded)
+	})
+
+	t.Run("should give up waiting when the context ends", func(t *testing.T) {
+		service, jobs, releases, started := setup(t, 1, 2)
+		defer close(releases["job0"])
+
+		run(service, ctx, jobs[0])
+		<-started
+
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err := service.RunSyncJob(waitCtx, "user1", jobs[1].ID)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "waiting for a slot")
+
+		job, err := service.getSyncJob(ctx, "user1", jobs[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusPending, job.Status, "a job that never ran is untouched")
+	})
+}
+
+func TestReapStaleJobs(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(db)
+	service.SetMaxJobDuration(time.Hour)
+
+	now := time.Now()
+	started := func(name string, at time.Time) *SyncJob {
+		job := &SyncJob{Name: name, UserID: "user1", Source: "file:///a", Destination: "file:///b", Resume: true}
+		require.NoError(t, service.CreateSyncJob(ctx, job))
+		require.NoError(t, db.Model(job).Updates(map[string]interface{}{"status": SyncStatusRunning, "last_run_at": at}).Error)
+		return job
+	}
+	stale := started("stale", now.Add(-2*time.Hour))
+	recent := started("recent", now.Add(-30*time.Minute))
+	local := started("local", now.Add(-2*time.Hour))
+	defer service.markActive(local.ID)()
+
+	reaped, err := service.ReapStaleJobs(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), reaped)
+
+	status := func(job *SyncJob) SyncStatus {
+		var stored SyncJob
+		require.NoError(t, db.First(&stored, job.ID).Error)
+		return stored.Status
+	}
+	assert.Equal(t, SyncStatusFailed, status(stale))
+	assert.Equal(t, SyncStatusRunning, status(recent), "the run may still be going")
+	assert.Equal(t, SyncStatusRunning, status(local), "runs of this service are never reaped")
+
+	var stored SyncJob
+	require.NoError(t, db.First(&stored, stale.ID).Error)
+	assert.True(t, service.resuming(&stored), "a reaped run resumes from its checkpoint")
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"context"
+	"io"
+	stdsync "sync"
+	"time"
+)
+
+// bandwidthLimiter is a token bucket measured in bytes. Tokens may go negative so
+// concurrent readers queue behind each other instead of all waking at once.
+type bandwidthLimiter struct {
+	mu     stdsync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		rate:  float64(bytesPerSecond),
+		burst: float64(bytesPerSecond),
+		last:  time.Now(),
+	}
+}
+
+func (b *bandwidthLimiter) chunkSize() int {
+	return int(b.burst)
+}
+
+func (b *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(deficit / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*bandwidthLimiter
+	chunk    int
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, limiters ...*bandwidthLimiter) *throttledReader {
+	chunk := 32 * 1024
+	for _, limiter := range limiters {
+		if size := limiter.chunkSize(); size > 0 && size < chunk {
+			chunk = size
+		}
+	}
+	return &throttledReader{ctx: ctx, r: r, limiters: limiters, chunk: chunk}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.chunk {
+		p = p[:t.chunk]
+	}
+
+	n, err := t.r.Read(p)
+	if n > 0 {
+		for _, limiter := range t.limiters {
+			if waitErr := limiter.wait(t.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}
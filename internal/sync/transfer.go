@@ -0,0 +1,332 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdsync "sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SetGlobalBandwidthLimit caps the combined transfer rate of all sync jobs
+// started from now on; zero or less removes the cap
+func (s *Service) SetGlobalBandwidthLimit(bytesPerSecond int64) {
+	var limiter *bandwidthLimiter
+	if bytesPerSecond > 0 {
+		limiter = newBandwidthLimiter(bytesPerSecond)
+	}
+	s.bandwidthMu.Lock()
+	defer s.bandwidthMu.Unlock()
+	s.globalBandwidth = limiter
+}
+
+// RunSyncJob transfers a job's objects once it gets one of the service's job
+// slots, waiting while the max concurrent jobs are running
+func (s *Service) RunSyncJob(ctx context.Context, userID string, jobID uint) (*SyncJob, error) {
+	ctx, release, err := s.acquireJobSlot(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Loaded once admitted, as a queued run may follow another that changed it
+	found, err := s.getSyncJob(ctx, userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	job := *found
+
+	resuming := s.resuming(&job)
+	defer s.markActive(job.ID)()
+
+	now := time.Now()
+	job.Status = SyncStatusRunning
+	job.ObjectsTransferred = 0
+	job.BytesTransferred = 0
+	job.ObjectsSkipped = 0
+	job.ObjectsDeleted = 0
+	job.Error = ""
+	job.LastRunAt = &now
+	if err := s.db.Save(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to update sync job: %w", err)
+	}
+
+	runErr := s.transfer(ctx, &job, resuming)
+	if runErr != nil {
+		job.Status = SyncStatusFailed
+		job.Error = runErr.Error()
+	} else {
+		job.Status = SyncStatusCompleted
+	}
+
+	// Record the outcome even when ctx was cancelled mid-transfer
+	if err := s.db.Save(&job).Error; err != nil {
+		return &job, fmt.Errorf("failed to update sync job: %w", err)
+	}
+	if runErr != nil {
+		return &job, fmt.Errorf("sync job %d failed: %w", job.ID, runErr)
+	}
+
+	return &job, nil
+}
+
+func (s *Service) getSyncJob(ctx context.Context, userID string, jobID uint) (*SyncJob, error) {
+	var job SyncJob
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", jobID, userID).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("sync job %d not found", jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sync job: %w", err)
+	}
+	return &job, nil
+}
+
+// resuming reports whether the next run of a job continues from the previous
+// run's checkpoint: the previous run failed, or it is still marked running
+// although this service is not running it, e.g. because the process stopped
+// mid-transfer
+func (s *Service) resuming(job *SyncJob) bool {
+	if !job.Resume {
+		return false
+	}
+	return job.Status == SyncStatusFailed || (job.Status == SyncStatusRunning && !s.isActive(job.ID))
+}
+
+// markActive records that this service is running a job, returning a func
+// to call once the run is over
+func (s *Service) markActive(jobID uint) func() {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	s.active[jobID]++
+	return func() {
+		s.activeMu.Lock()
+		defer s.activeMu.Unlock()
+		if s.active[jobID]--; s.active[jobID] == 0 {
+			delete(s.active, jobID)
+		}
+	}
+}
+
+func (s *Service) isActive(jobID uint) bool {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	return s.active[jobID] > 0
+}
+
+// activeJobs returns the IDs of the jobs this service is running
+func (s *Service) activeJobs() []uint {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	ids := make([]uint, 0, len(s.active))
+	for id := range s.active {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// openJobStorage opens a job's backends with the credentials it references,
+// read from the vault as the job's owner
+func (s *Service) openJobStorage(ctx context.Context, job *SyncJob) (source, destination StorageBackend, err error) {
+	credentials, err := s.resolveCredentials(ctx, job.UserID, job.SourceCredentials)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid source: %w", err)
+	}
+	source, err = s.openBackend(job.Source, credentials)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid source: %w", err)
+	}
+
+	credentials, err = s.resolveCredentials(ctx, job.UserID, job.DestinationCredentials)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	destination, err = s.openBackend(job.Destination, credentials)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	return source, destination, nil
+}
+
+func (s *Service) transfer(ctx context.Context, job *SyncJob, resuming bool) error {
+	source, destination, err := s.openJobStorage(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	synced, err := s.checkpoint(ctx, job, resuming)
+	if err != nil {
+		return err
+	}
+	// Only mirror runs need the destination listing
+	items, err := planTransfer(ctx, job, source, destination, synced, job.Mode == SyncModeMirror)
+	if err != nil {
+		return err
+	}
+
+	var pending, extra []ObjectInfo
+	for _, item := range items {
+		switch item.Action {
+		case SyncPlanSkip:
+			job.ObjectsSkipped++
+		case SyncPlanDelete:
+			extra = append(extra, ObjectInfo{Key: item.Key, Size: item.Size})
+		default:
+			pending = append(pending, ObjectInfo{Key: item.Key, Size: item.Size})
+		}
+	}
+
+	if err := s.copyObjects(ctx, job, source, destination, pending); err != nil {
+		return err
+	}
+	// Deleting only after every copy succeeded keeps a failed mirror run from
+	// removing objects it has not replaced
+	return deleteObjects(ctx, job, destination, extra)
+}
+
+// checkpoint returns the objects synced by the previous run when resuming,
+// otherwise it clears the job's checkpoint so every object is copied again
+func (s *Service) checkpoint(ctx context.Context, job *SyncJob, resuming bool) (map[string]int64, error) {
+	if !resuming {
+		if err := s.db.WithContext(ctx).Where("job_id = ?", job.ID).Delete(&SyncedObject{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to reset checkpoint: %w", err)
+		}
+		return map[string]int64{}, nil
+	}
+
+	return s.loadCheckpoint(ctx, job)
+}
+
+func (s *Service) loadCheckpoint(ctx context.Context, job *SyncJob) (map[string]int64, error) {
+	var objects []SyncedObject
+	if err := s.db.WithContext(ctx).Where("job_id = ?", job.ID).Find(&objects).Error; err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	synced := make(map[string]int64, len(objects))
+	for _, object := range objects {
+		synced[object.Key] = object.Size
+	}
+	return synced, nil
+}
+
+func (s *Service) recordSynced(job *SyncJob, object ObjectInfo, size int64) error {
+	if s.db == nil {
+		return nil
+	}
+
+	// Written without the job context so a cancelled run still keeps its progress
+	synced := &SyncedObject{JobID: job.ID, Key: object.Key, Size: size, SyncedAt: time.Now()}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"size", "synced_at"}),
+	}).Create(synced).Error
+	if err != nil {
+		return fmt.Errorf("failed to record checkpoint for '%s': %w", object.Key, err)
+	}
+	return nil
+}
+
+func (s *Service) copyObjects(ctx context.Context, job *SyncJob, source, destination StorageBackend, objects []ObjectInfo) error {
+	workers := job.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(objects) {
+		workers = len(objects)
+	}
+
+	limiters := s.bandwidthLimiters(job)
+	queue := make(chan ObjectInfo)
+	var (
+		mu   stdsync.Mutex
+		errs []error
+		wg   stdsync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range queue {
+				written, err := s.copyObject(ctx, source, destination, object.Key, limiters)
+				if err != nil {
+					err = fmt.Errorf("failed to copy '%s': %w", object.Key, err)
+				} else {
+					err = s.recordSynced(job, object, written)
+				}
+
+				mu.Lock()
+				job.BytesTransferred += written
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					job.ObjectsTransferred++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for _, object := range objects {
+		select {
+		case queue <- object:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+func deleteObjects(ctx context.Context, job *SyncJob, destination StorageBackend, objects []ObjectInfo) error {
+	var errs []error
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := destination.Delete(ctx, object.Key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete '%s': %w", object.Key, err))
+			continue
+		}
+		job.ObjectsDeleted++
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) copyObject(ctx context.Context, source, destination StorageBackend, key string, limiters []*bandwidthLimiter) (int64, error) {
+	reader, err := source.Read(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var r io.Reader = reader
+	if len(limiters) > 0 {
+		r = newThrottledReader(ctx, reader, limiters...)
+	}
+	return destination.Write(ctx, key, r)
+}
+
+func (s *Service) bandwidthLimiters(job *SyncJob) []*bandwidthLimiter {
+	limiters := make([]*bandwidthLimiter, 0, 2)
+	if job.BandwidthLimit > 0 {
+		limiters = append(limiters, newBandwidthLimiter(job.BandwidthLimit))
+	}
+	s.bandwidthMu.RLock()
+	global := s.globalBandwidth
+	s.bandwidthMu.RUnlock()
+	if global != nil {
+		limiters = append(limiters, global)
+	}
+	return limiters
+}
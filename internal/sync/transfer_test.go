@@ -0,0 +1,439 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSourceFiles(t *testing.T, files map[string][]byte) string {
+	dir := t.TempDir()
+	for name, data := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0o750))
+		require.NoError(t, os.WriteFile(target, data, 0o600))
+	}
+	return dir
+}
+
+func createLocalJob(t *testing.T, service *Service, source string, bandwidth int64) (*SyncJob, string) {
+	destination := t.TempDir()
+	job := &SyncJob{
+		Name:           "Local copy",
+		UserID:         "user1",
+		Source:         "file://" + source,
+		Destination:    "file://" + destination,
+		BandwidthLimit: bandwidth,
+	}
+	require.NoError(t, service.CreateSyncJob(context.Background(), job))
+	return job, destination
+}
+
+func TestRunSyncJob(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewService()
+	service.SetDB(db)
+	ctx := context.Background()
+
+	t.Run("should copy all objects and record progress", func(t *testing.T) {
+		source := writeSourceFiles(t, map[string][]byte{
+			"a.txt":        []byte("hello"),
+			"nested/b.txt": []byte("world!"),
+		})
+		job, destination := createLocalJob(t, service, source, 0)
+
+		result, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusCompleted, result.Status)
+		assert.Equal(t, 2, result.ObjectsTransferred)
+		assert.Equal(t, int64(11), result.BytesTransferred)
+		assert.NotNil(t, result.LastRunAt)
+
+		data, err := os.ReadFile(filepath.Join(destination, "nested", "b.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "world!", string(data))
+	})
+
+	t.Run("should fail for unsupported schemes", func(t *testing.T) {
+		job := &SyncJob{Name: "Remote", UserID: "user1", Source: "ftp://host/data", Destination: "file:///tmp/x"}
+		require.NoError(t, service.CreateSyncJob(ctx, job))
+
+		result, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.Error(t, err)
+		assert.Equal(t, SyncStatusFailed, result.Status)
+		assert.Contains(t, result.Error, "unsupported storage scheme")
+	})
+
+	t.Run("should not run another user's job", func(t *testing.T) {
+		source := writeSourceFiles(t, map[string][]byte{"a.txt": []byte("x")})
+		job, _ := createLocalJob(t, service, source, 0)
+
+		_, err := service.RunSyncJob(ctx, "user2", job.ID)
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("should reject a negative bandwidth limit", func(t *testing.T) {
+		job := &SyncJob{Name: "Bad", UserID: "user1", Source: "file:///a", Destination: "file:///b", BandwidthLimit: -1}
+		assert.Error(t, service.CreateSyncJob(ctx, job))
+	})
+}
+
+func TestSyncBandwidthLimit(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	payload := bytes.Repeat([]byte("x"), 20*1024)
+
+	t.Run("should throttle a job to its bandwidth limit", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(db)
+		source := writeSourceFiles(t, map[string][]byte{"blob.bin": payload})
+		job, destination := createLocalJob(t, service, source, 40*1024)
+
+		start := time.Now()
+		_, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+
+		// 20 KiB at 40 KiB/s takes at least 500ms
+		assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+		data, err := os.ReadFile(filepath.Join(destination, "blob.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, payload, data)
+	})
+
+	t.Run("should share the global limit across concurrent jobs", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(db)
+		service.SetGlobalBandwidthLimit(40 * 1024)
+
+		jobs := make([]*SyncJob, 2)
+		for i := range jobs {
+			source := writeSourceFiles(t, map[string][]byte{"blob.bin": payload[:10*1024]})
+			jobs[i], _ = createLocalJob(t, service, source, 0)
+		}
+
+		start := time.Now()
+		var wg stdsync.WaitGroup
+		errs := make([]error, len(jobs))
+		for i, job := range jobs {
+			wg.Add(1)
+			go func(i int, jobID uint) {
+				defer wg.Done()
+				_, errs[i] = service.RunSyncJob(ctx, "user1", jobID)
+			}(i, job.ID)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		// 2 x 10 KiB through a shared 40 KiB/s budget takes at least 500ms
+		assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+	})
+
+	t.Run("should stop throttled transfers on cancellation", func(t *testing.T) {
+		service := NewService()
+		service.SetDB(db)
+		source := writeSourceFiles(t, map[string][]byte{"blob.bin": payload})
+		job, _ := createLocalJob(t, service, source, 1024)
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		result, err := service.RunSyncJob(cancelCtx, "user1", job.ID)
+		require.Error(t, err)
+		assert.Equal(t, SyncStatusFailed, result.Status)
+	})
+}
+
+// memoryStorage is an in-memory storage whose reads take a fixed latency
+type memoryStorage struct {
+	mu      stdsync.Mutex
+	objects map[string][]byte
+	latency time.Duration
+	fail    map[string]bool
+}
+
+func newMemoryStorage(latency time.Duration) *memoryStorage {
+	return &memoryStorage{objects: make(map[string][]byte), latency: latency, fail: make(map[string]bool)}
+}
+
+func (m *memoryStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objects := make([]ObjectInfo, 0, len(m.objects))
+	for key, data := range m.objects {
+		objects = append(objects, ObjectInfo{Key: key, Size: int64(len(data))})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (m *memoryStorage) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	select {
+	case <-time.After(m.latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail[key] {
+		return nil, errors.New("read failed")
+	}
+	return io.NopCloser(bytes.NewReader(m.objects[key])), nil
+}
+
+func (m *memoryStorage) Write(ctx context.Context, key string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return int64(len(data)), nil
+}
+
+func (m *memoryStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return ObjectInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func smallObjects(n int, latency time.Duration) (*memoryStorage, []ObjectInfo) {
+	source := newMemoryStorage(latency)
+	for i := 0; i < n; i++ {
+		source.objects[fmt.Sprintf("objects/%04d", i)] = []byte("0123456789")
+	}
+	objects, _ := source.List(context.Background())
+	return source, objects
+}
+
+func TestParallelSync(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+
+	t.Run("should copy objects in parallel faster than serially", func(t *testing.T) {
+		source, objects := smallObjects(40, 10*time.Millisecond)
+
+		serialJob := &SyncJob{Concurrency: 1}
+		start := time.Now()
+		require.NoError(t, service.copyObjects(ctx, serialJob, source, newMemoryStorage(0), objects))
+		serial := time.Since(start)
+
+		parallelJob := &SyncJob{Concurrency: 8}
+		destination := newMemoryStorage(0)
+		start = time.Now()
+		require.NoError(t, service.copyObjects(ctx, parallelJob, source, destination, objects))
+		parallel := time.Since(start)
+
+		assert.Less(t, parallel, serial/2)
+		assert.Equal(t, 40, parallelJob.ObjectsTransferred)
+		assert.Equal(t, int64(400), parallelJob.BytesTransferred)
+		assert.Len(t, destination.objects, 40)
+	})
+
+	t.Run("should aggregate errors and keep copying other objects", func(t *testing.T) {
+		source, objects := smallObjects(10, 0)
+		source.fail["objects/0003"] = true
+		source.fail["objects/0007"] = true
+
+		job := &SyncJob{Concurrency: 4}
+		err := service.copyObjects(ctx, job, source, newMemoryStorage(0), objects)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "objects/0003")
+		assert.Contains(t, err.Error(), "objects/0007")
+		assert.Equal(t, 8, job.ObjectsTransferred)
+	})
+
+	t.Run("should stop dispatching on cancellation", func(t *testing.T) {
+		source, objects := smallObjects(100, 20*time.Millisecond)
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		job := &SyncJob{Concurrency: 4}
+		err := service.copyObjects(cancelCtx, job, source, newMemoryStorage(0), objects)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, job.ObjectsTransferred, 100)
+	})
+
+	t.Run("should respect the bandwidth cap across workers", func(t *testing.T) {
+		source := newMemoryStorage(0)
+		for i := 0; i < 4; i++ {
+			source.objects[fmt.Sprintf("blob-%d", i)] = bytes.Repeat([]byte("x"), 5*1024)
+		}
+		objects, _ := source.List(ctx)
+
+		job := &SyncJob{Concurrency: 4, BandwidthLimit: 40 * 1024}
+		start := time.Now()
+		require.NoError(t, service.copyObjects(ctx, job, source, newMemoryStorage(0), objects))
+
+		// 20 KiB at 40 KiB/s takes at least 500ms regardless of concurrency
+		assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+		assert.Equal(t, int64(20*1024), job.BytesTransferred)
+	})
+
+	t.Run("should validate concurrency", func(t *testing.T) {
+		db := setupTestDB(t)
+		service := NewService()
+		service.SetDB(db)
+		job := &SyncJob{Name: "Bad", UserID: "user1", Source: "file:///a", Destination: "file:///b", Concurrency: MaxSyncConcurrency + 1}
+		assert.Error(t, service.CreateSyncJob(ctx, job))
+	})
+}
+
+func BenchmarkSyncTransfer(b *testing.B) {
+	service := NewService()
+	source, objects := smallObjects(200, time.Millisecond)
+
+	for _, concurrency := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				job := &SyncJob{Concurrency: concurrency}
+				if err := service.copyObjects(context.Background(), job, source, newMemoryStorage(0), objects); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// countingStorage wraps a memoryStorage, counting reads and failing once a limit is hit
+type countingStorage struct {
+	*memoryStorage
+	mu        stdsync.Mutex
+	reads     []string
+	failAfter int
+}
+
+func (c *countingStorage) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failAfter > 0 && len(c.reads) >= c.failAfter {
+		return nil, errors.New("connection reset")
+	}
+	c.reads = append(c.reads, key)
+	return c.memoryStorage.Read(ctx, key)
+}
+
+func TestResumableSync(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, resume bool) (*Service, *SyncJob, *countingStorage, *memoryStorage) {
+		db := setupTestDB(t)
+		service := NewService()
+		service.SetDB(db)
+
+		memory, _ := smallObjects(10, 0)
+		source := &countingStorage{memoryStorage: memory, failAfter: 4}
+		destination := newMemoryStorage(0)
+		registerMemoryBackends(service, map[string]StorageBackend{"source": source, "destination": destination})
+
+		job := &SyncJob{Name: "Resumable", UserID: "user1", Source: "mem://source", Destination: "mem://destination", Resume: resume}
+		require.NoError(t, service.CreateSyncJob(ctx, job))
+		return service, job, source, destination
+	}
+
+	t.Run("should only transfer the remainder after an interruption", func(t *testing.T) {
+		service, job, source, destination := setup(t, true)
+
+		interrupted, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.Error(t, err)
+		assert.Equal(t, SyncStatusFailed, interrupted.Status)
+		assert.Equal(t, 4, interrupted.ObjectsTransferred)
+
+		source.failAfter = 0
+		source.reads = nil
+		resumed, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStatusCompleted, resumed.Status)
+		assert.Equal(t, 4, resumed.ObjectsSkipped)
+		assert.Equal(t, 6, resumed.ObjectsTransferred)
+		assert.Len(t, source.reads, 6)
+		assert.NotContains(t, source.reads, "objects/0000")
+		assert.Len(t, destination.objects, 10)
+	})
+
+	t.Run("should resume a run left running by a stopped process", func(t *testing.T) {
+		service, job, source, _ := setup(t, true)
+
+		_, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.Error(t, err)
+		require.NoError(t, service.db.Model(&SyncJob{}).Where("id = ?", job.ID).Update("status", SyncStatusRunning).Error)
+
+		source.failAfter = 0
+		source.reads = nil
+		resumed, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 4, resumed.ObjectsSkipped)
+		assert.Len(t, source.reads, 6)
+
+		running := *resumed
+		running.Status = SyncStatusRunning
+		defer service.markActive(job.ID)()
+		assert.False(t, service.resuming(&running), "a run in progress here is not stale")
+	})
+
+	t.Run("should start from scratch when Resume is off", func(t *testing.T) {
+		service, job, source, _ := setup(t, false)
+
+		_, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.Error(t, err)
+
+		source.failAfter = 0
+		source.reads = nil
+		rerun, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 0, rerun.ObjectsSkipped)
+		assert.Len(t, source.reads, 10)
+	})
+
+	t.Run("should not skip objects after a successful run", func(t *testing.T) {
+		service, job, source, _ := setup(t, true)
+		source.failAfter = 0
+
+		_, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+
+		source.reads = nil
+		rerun, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 0, rerun.ObjectsSkipped)
+		assert.Len(t, source.reads, 10)
+	})
+
+	t.Run("should re-copy objects whose size changed since the checkpoint", func(t *testing.T) {
+		service, job, source, _ := setup(t, true)
+
+		_, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.Error(t, err)
+
+		source.objects["objects/0000"] = []byte("changed content")
+		source.failAfter = 0
+		source.reads = nil
+		resumed, err := service.RunSyncJob(ctx, "user1", job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, resumed.ObjectsSkipped)
+		assert.Contains(t, source.reads, "objects/0000")
+	})
+}
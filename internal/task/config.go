@@ -0,0 +1,49 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config configures a task Service
+type Config struct {
+	// Workers is how many tasks run at once with a ShellRunner; zero runs
+	// none, leaving tasks for other instances
+	Workers int `json:"workers" yaml:"workers"`
+	// StaleAfter is how long a running task may go without a heartbeat
+	// before it is reaped, see WorkerPool
+	StaleAfter time.Duration `json:"stale_after" yaml:"stale_after"`
+}
+
+// DefaultConfig runs no workers
+func DefaultConfig() Config {
+	return Config{StaleAfter: DefaultStaleAfter}
+}
+
+// Validate checks the worker count and that workers go stale only after
+// missing a heartbeat
+func (c Config) Validate() error {
+	if c.Workers < 0 {
+		return errors.New("workers must not be negative")
+	}
+	if c.StaleAfter <= DefaultHeartbeatInterval {
+		return fmt.Errorf("stale after must be longer than the %s heartbeat interval", DefaultHeartbeatInterval)
+	}
+	return nil
+}
+
+// NewServiceWithConfig validates cfg and creates a task service, with a pool
+// of shell workers if cfg has any
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid task config: %w", err)
+	}
+	s := NewService()
+	if cfg.Workers > 0 {
+		pool := NewWorkerPool(s, ShellRunner{}, cfg.Workers)
+		pool.StaleAfter = cfg.StaleAfter
+		s.SetWorkerPool(pool)
+	}
+	return s, nil
+}
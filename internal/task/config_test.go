@@ -0,0 +1,40 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("should run no workers by default", func(t *testing.T) {
+		service, err := NewServiceWithConfig(DefaultConfig())
+		require.NoError(t, err)
+		assert.Nil(t, service.workers)
+	})
+
+	t.Run("should create a worker pool", func(t *testing.T) {
+		service, err := NewServiceWithConfig(Config{Workers: 3, StaleAfter: 2 * time.Minute})
+		require.NoError(t, err)
+		require.NotNil(t, service.workers)
+		assert.Equal(t, 3, service.workers.workers)
+		assert.Equal(t, 2*time.Minute, service.workers.StaleAfter)
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		for _, tc := range []struct {
+			config Config
+			err    string
+		}{
+			{Config{Workers: -1, StaleAfter: time.Minute}, "workers must not be negative"},
+			{Config{Workers: 1}, "stale after must be longer than"},
+			{Config{Workers: 1, StaleAfter: DefaultHeartbeatInterval}, "stale after must be longer than"},
+		} {
+			assert.ErrorContains(t, tc.config.Validate(), tc.err)
+			_, err := NewServiceWithConfig(tc.config)
+			assert.ErrorContains(t, err, "invalid task config")
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"gorm.io/gorm"
 )
 
@@ -34,7 +35,16 @@ func (j JSONMap) Value() (driver.Value, error) {
 	if len(j) == 0 {
 		return "{}", nil
 	}
-	return json.Marshal(j)
+	data, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	// Oversized values are rejected here as a last resort; services validate
+	// user input before it gets this far
+	if err := core.CheckJSONSize(data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 // Task represents a task in the system
@@ -51,6 +61,9 @@ type Task struct {
 	Error       string      `json:"error"`
 	ScheduledAt *time.Time  `json:"scheduled_at"`
 	StartedAt   *time.Time  `json:"started_at"`
+	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"` // refreshed by the worker running the task
+	Requeues    int         `json:"requeues" gorm:"default:0"`  // times reset to pending after its worker stopped heartbeating
+	ClaimID     string      `json:"-" gorm:"index"`            // set by each claim; heartbeats and results of earlier claims are discarded
 	CompletedAt *time.Time  `json:"completed_at"`
 	CreatedAt   time.Time   `json:"created_at"`
 	UpdatedAt   time.Time   `json:"updated_at"`
@@ -7,17 +7,28 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
 	"gorm.io/gorm"
 )
 
 // Service provides task orchestration functionality
 type Service struct {
-	db *gorm.DB
+	db        *gorm.DB
+	workers   *WorkerPool
+	scheduler *core.Scheduler
+	now       func() time.Time
 }
 
 // NewService creates a new task service
 func NewService() *Service {
-	return &Service{}
+	return &Service{now: time.Now}
+}
+
+// SetScheduler sets the scheduler periodic work such as reaping runs on, which
+// is shared with other services. Without one, stale tasks are not reaped.
+func (s *Service) SetScheduler(scheduler *core.Scheduler) {
+	s.scheduler = scheduler
 }
 
 // SetDB sets the database connection
@@ -25,6 +36,11 @@ func (s *Service) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+// CheckHealth reports whether the task database is reachable
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return database.CheckConnection(ctx, s.db)
+}
+
 // CreateTask creates a new task
 func (s *Service) CreateTask(ctx context.Context, task *Task) error {
 	if err := s.validateTask(task); err != nil {
@@ -67,6 +83,22 @@ func (s *Service) ListTasks(ctx context.Context, userID string) ([]*Task, error)
 	return tasks, nil
 }
 
+// ListTasksPage returns one page of the user's tasks, reading only that page
+// from the store
+func (s *Service) ListTasksPage(ctx context.Context, userID string, request core.PageRequest) (*core.Page[*Task], error) {
+	page, err := database.Paginate[*Task](s.db.WithContext(ctx).Model(&Task{}).Where("user_id = ?", userID).Order("id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	return page, nil
+}
+
+// Count returns how many tasks a user has, optionally broken down by status
+func (s *Service) Count(ctx context.Context, userID string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	query := s.db.WithContext(ctx).Model(&Task{}).Where("user_id = ?", userID)
+	return database.CountByStatus[TaskStatus](query, core.ResourceTypeTask, filters...)
+}
+
 // UpdateTaskStatus updates the status of a task
 func (s *Service) UpdateTaskStatus(ctx context.Context, userID string, taskID uint, status TaskStatus) error {
 	var task Task
@@ -78,37 +110,82 @@ func (s *Service) UpdateTaskStatus(ctx context.Context, userID string, taskID ui
 		return fmt.Errorf("failed to find task: %w", err)
 	}
 
-	task.Status = status
+	if task.Status == status {
+		return nil
+	}
+	updates := map[string]interface{}{"status": status}
 	if status == TaskStatusCompleted || status == TaskStatusFailed {
-		now := time.Now()
-		task.CompletedAt = &now
+		updates["completed_at"] = time.Now()
 	}
 
-	if err := s.db.Save(&task).Error; err != nil {
+	if _, err := database.UpdateChanged(s.db.WithContext(ctx), &task, updates); err != nil {
 		return fmt.Errorf("failed to update task status: %w", err)
 	}
 
 	return nil
 }
 
+// Exists reports whether a task exists and belongs to the user, without
+// loading it. Deleted tasks do not exist.
+func (s *Service) Exists(ctx context.Context, userID string, taskID uint) (bool, error) {
+	exists, err := database.Exists(s.db.WithContext(ctx).Model(&Task{}).Where("id = ? AND user_id = ?", taskID, userID))
+	if err != nil {
+		return false, fmt.Errorf("failed to find task: %w", err)
+	}
+	return exists, nil
+}
+
 // DeleteTask deletes a task
 func (s *Service) DeleteTask(ctx context.Context, userID string, taskID uint) error {
-	var task Task
-	err := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("task %d not found", taskID)
-	}
+	exists, err := s.Exists(ctx, userID, taskID)
 	if err != nil {
-		return fmt.Errorf("failed to find task: %w", err)
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("task %d not found", taskID)
 	}
 
-	if err := s.db.Delete(&task).Error; err != nil {
+	if err := s.db.Delete(&Task{}, taskID).Error; err != nil {
 		return fmt.Errorf("failed to delete task: %w", err)
 	}
 
 	return nil
 }
 
+// Search returns the user's tasks whose name, description or type match the query
+func (s *Service) Search(ctx context.Context, userID, query string, limit int) ([]*core.SearchHit, error) {
+	pattern := core.LikePattern(query)
+	var tasks []*Task
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Where(`LOWER(name) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\' OR LOWER(type) LIKE ? ESCAPE '\'`, pattern, pattern, pattern).
+		Limit(limit).
+		Find(&tasks).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search tasks: %w", err)
+	}
+
+	hits := make([]*core.SearchHit, 0, len(tasks))
+	for _, task := range tasks {
+		score := core.MatchScore(query, task.Name)
+		if descriptionScore := 0.6 * core.MatchScore(query, task.Description); descriptionScore > score {
+			score = descriptionScore
+		}
+		if typeScore := 0.4 * core.MatchScore(query, task.Type); typeScore > score {
+			score = typeScore
+		}
+		hits = append(hits, &core.SearchHit{
+			ResourceType: core.ResourceTypeTask,
+			ID:           fmt.Sprintf("%d", task.ID),
+			Title:        task.Name,
+			Description:  task.Description,
+			Score:        score,
+		})
+	}
+
+	return hits, nil
+}
+
 // validateTask validates a task before creating
 func (s *Service) validateTask(task *Task) error {
 	if strings.TrimSpace(task.Name) == "" {
@@ -120,5 +197,8 @@ func (s *Service) validateTask(task *Task) error {
 	if strings.TrimSpace(task.Type) == "" {
 		return errors.New("type is required")
 	}
+	if err := core.ValidateJSONSize("config", task.Config); err != nil {
+		return err
+	}
 	return nil
 }
@@ -2,8 +2,11 @@ package task
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -109,11 +112,75 @@ func TestTaskOperations(t *testing.T) {
 		err := service.CreateTask(ctx, task)
 		require.NoError(t, err)
 
+		exists, err := service.Exists(ctx, "user4", task.ID)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = service.Exists(ctx, "user1", task.ID)
+		require.NoError(t, err)
+		assert.False(t, exists, "another user's task should not exist")
+
 		err = service.DeleteTask(ctx, "user4", task.ID)
 		require.NoError(t, err)
 
 		_, err = service.GetTask(ctx, "user4", task.ID)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
+
+		// The task is soft-deleted, so it no longer exists
+		exists, err = service.Exists(ctx, "user4", task.ID)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.ErrorContains(t, service.DeleteTask(ctx, "user4", task.ID), "not found")
+	})
+}
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+
+	var tasks []*Task
+	for _, name := range []string{"backup", "report", "lint"} {
+		task := &Task{UserID: "user1", Name: name, Type: "shell"}
+		require.NoError(t, service.CreateTask(ctx, task))
+		tasks = append(tasks, task)
+	}
+	require.NoError(t, service.UpdateTaskStatus(ctx, "user1", tasks[0].ID, TaskStatusRunning))
+	require.NoError(t, service.UpdateTaskStatus(ctx, "user1", tasks[1].ID, TaskStatusCancelled))
+
+	count, err := service.Count(ctx, "user1", core.CountFilter{GroupByStatus: true})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceTypeTask, count.ResourceType)
+	assert.Equal(t, map[string]int64{"pending": 1, "running": 1, "cancelled": 1}, count.ByStatus)
+}
+
+func TestTaskJSONLimit(t *testing.T) {
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+	ctx := context.Background()
+	core.SetMaxJSONSize(64)
+	t.Cleanup(func() { core.SetMaxJSONSize(0) })
+
+	t.Run("should reject an oversized config before storing it", func(t *testing.T) {
+		task := &Task{Name: "big", Type: "shell", UserID: "user1", Config: JSONMap{"command": strings.Repeat("x", 100)}}
+		err := service.CreateTask(ctx, task)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, core.ErrJSONTooLarge))
+		assert.NotContains(t, err.Error(), "failed to create task")
+	})
+
+	t.Run("should fail a task whose result is too large to store", func(t *testing.T) {
+		task := &Task{Name: "chatty", Type: "shell", UserID: "user1"}
+		require.NoError(t, service.CreateTask(ctx, task))
+		claimed, err := service.claimTask(ctx)
+		require.NoError(t, err)
+		require.Equal(t, task.ID, claimed.ID)
+
+		require.NoError(t, service.finishTask(ctx, claimed, JSONMap{"stdout": strings.Repeat("x", 100)}, nil))
+		finished, err := service.GetTask(ctx, "user1", task.ID)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusFailed, finished.Status)
+		assert.Contains(t, finished.Error, "result")
+		assert.Empty(t, finished.Result)
 	})
 }
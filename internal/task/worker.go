@@ -0,0 +1,389 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Runner executes a claimed task and returns its result
+type Runner interface {
+	RunTask(ctx context.Context, task *Task) (JSONMap, error)
+}
+
+// ShellRunner runs the shell command in a task's config under "command"
+type ShellRunner struct{}
+
+// RunTask runs the task's command with sh -c and captures its output
+func (ShellRunner) RunTask(ctx context.Context, task *Task) (JSONMap, error) {
+	command, _ := task.Config["command"].(string)
+	if command == "" {
+		return nil, errors.New("task config has no command")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	result := JSONMap{"stdout": stdout.String(), "stderr": stderr.String(), "exit_code": 0}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result["exit_code"] = exitErr.ExitCode()
+	}
+	return result, err
+}
+
+const (
+	// DefaultHeartbeatInterval is how often a worker heartbeats its task by default
+	DefaultHeartbeatInterval = 10 * time.Second
+	// DefaultStaleAfter is how long a task may go without a heartbeat by default
+	DefaultStaleAfter = time.Minute
+)
+
+// WorkerPool claims pending tasks and runs them with a Runner. Claiming is
+// atomic, so several instances can share one task table. Workers heartbeat
+// while running a task, and the pool reaps tasks whose worker has stopped
+// heartbeating, such as those left by a crashed instance.
+type WorkerPool struct {
+	// PollInterval is how long an idle worker waits before looking for tasks again
+	PollInterval time.Duration
+	// HeartbeatInterval is how often a worker records that its task is still running
+	HeartbeatInterval time.Duration
+	// StaleAfter is how long a running task may go without a heartbeat before
+	// it is reaped; it should be several heartbeat intervals
+	StaleAfter time.Duration
+	// MaxRequeues is how many times a stale task is reset to pending before it
+	// is marked failed instead
+	MaxRequeues int
+
+	service *Service
+	runner  Runner
+	workers int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu        sync.Mutex
+	running   map[*Task]context.CancelFunc
+	abandoned bool
+}
+
+// NewWorkerPool creates a pool of workers running tasks from the service
+func NewWorkerPool(service *Service, runner Runner, workers int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &WorkerPool{
+		PollInterval:      time.Second,
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		StaleAfter:        DefaultStaleAfter,
+		MaxRequeues:       3,
+		service:           service,
+		runner:            runner,
+		workers:           workers,
+		stop:              make(chan struct{}),
+		running:           make(map[*Task]context.CancelFunc),
+	}
+}
+
+// reapJobName is the scheduler job reaping stale tasks
+const reapJobName = "task.reap-stale"
+
+// Start launches the workers and schedules the reaper
+func (p *WorkerPool) Start() {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	err := p.service.scheduler.Register(core.Job{
+		Name:     reapJobName,
+		Schedule: core.Every(p.StaleAfter / 2),
+		Run:      p.reap,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule stale task reaping: %v", err)
+	}
+}
+
+// Drain stops claiming new tasks and waits for running ones to finish. If ctx
+// is done first, the unfinished tasks are cancelled and reset to Pending so
+// another instance can pick them up, and their late results are discarded.
+func (p *WorkerPool) Drain(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	if err := p.service.scheduler.Unregister(ctx, reapJobName); err != nil && !errors.Is(err, core.ErrJobNotFound) {
+		log.Printf("⚠️  Failed to stop stale task reaping: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	p.abandoned = true
+	unfinished := make([]*Task, 0, len(p.running))
+	for task, cancel := range p.running {
+		cancel()
+		unfinished = append(unfinished, task)
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, task := range unfinished {
+		// The drain deadline has passed, so requeue without it
+		if err := p.service.requeueTask(context.Background(), task); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(unfinished) > 0 {
+		log.Printf("⚠️  Requeued %d unfinished tasks on shutdown", len(unfinished))
+	}
+	return nil
+}
+
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		task, err := p.service.claimTask(context.Background())
+		if err != nil {
+			log.Printf("⚠️  Failed to claim task: %v", err)
+		}
+		if task == nil {
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(p.PollInterval):
+			}
+			continue
+		}
+		p.run(task)
+	}
+}
+
+// reap requeues tasks whose worker stopped heartbeating
+func (p *WorkerPool) reap(ctx context.Context) error {
+	requeued, failed, err := p.service.ReapStaleTasks(ctx, p.StaleAfter, p.MaxRequeues)
+	if err != nil {
+		return fmt.Errorf("failed to reap stale tasks: %w", err)
+	}
+	if requeued+failed > 0 {
+		log.Printf("⚠️  Reaped stale tasks: %d requeued, %d failed", requeued, failed)
+	}
+	return nil
+}
+
+// run executes a claimed task, heartbeating while it runs, and records its
+// outcome unless the pool gave up on it while draining
+func (p *WorkerPool) run(task *Task) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p.mu.Lock()
+	p.running[task] = cancel
+	p.mu.Unlock()
+
+	go p.heartbeat(ctx, task)
+	result, runErr := p.runner.RunTask(ctx, task)
+	cancel()
+
+	p.mu.Lock()
+	delete(p.running, task)
+	abandoned := p.abandoned
+	p.mu.Unlock()
+	if abandoned {
+		return
+	}
+
+	if err := p.service.finishTask(context.Background(), task, result, runErr); err != nil {
+		log.Printf("⚠️  Failed to record result of task %d: %v", task.ID, err)
+	}
+}
+
+// heartbeat records that a task is still running until ctx is done
+func (p *WorkerPool) heartbeat(ctx context.Context, task *Task) {
+	ticker := time.NewTicker(p.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.service.heartbeatTask(ctx, task); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️  Failed to heartbeat task %d: %v", task.ID, err)
+			}
+		}
+	}
+}
+
+// SetWorkerPool sets the pool that Start starts and Close drains
+func (s *Service) SetWorkerPool(pool *WorkerPool) {
+	s.workers = pool
+}
+
+// Start starts the worker pool, if one is set
+func (s *Service) Start() {
+	if s.workers != nil {
+		s.workers.Start()
+	}
+}
+
+// Close drains the worker pool, if one is set, requeueing tasks still running
+// when ctx is done
+func (s *Service) Close(ctx context.Context) error {
+	if s.workers == nil {
+		return nil
+	}
+	return s.workers.Drain(ctx)
+}
+
+// claimTask marks the next due pending task as running and returns it, or nil
+// when there is none. A task claimed concurrently elsewhere is skipped. Each
+// claim gets a new ClaimID, so a worker whose task was reaped and claimed
+// again cannot heartbeat or finish the new claim.
+func (s *Service) claimTask(ctx context.Context) (*Task, error) {
+	for {
+		var task Task
+		err := s.db.WithContext(ctx).
+			Where("status = ? AND (scheduled_at IS NULL OR scheduled_at <= ?)", TaskStatusPending, s.now()).
+			Order("priority DESC, id").
+			First(&task).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find pending task: %w", err)
+		}
+
+		now := s.now()
+		claimID := uuid.New().String()
+		claim := s.db.WithContext(ctx).Model(&Task{}).
+			Where("id = ? AND status = ?", task.ID, TaskStatusPending).
+			Updates(map[string]interface{}{"status": TaskStatusRunning, "started_at": now, "last_heartbeat": now, "claim_id": claimID})
+		if claim.Error != nil {
+			return nil, fmt.Errorf("failed to claim task %d: %w", task.ID, claim.Error)
+		}
+		if claim.RowsAffected == 1 {
+			task.Status = TaskStatusRunning
+			task.StartedAt = &now
+			task.LastHeartbeat = &now
+			task.ClaimID = claimID
+			return &task, nil
+		}
+	}
+}
+
+// finishTask records the outcome of a claimed task. The result of a claim
+// that was reaped in the meantime is discarded.
+func (s *Service) finishTask(ctx context.Context, task *Task, result JSONMap, runErr error) error {
+	updates := map[string]interface{}{
+		"status":       TaskStatusCompleted,
+		"result":       result,
+		"error":        "",
+		"completed_at": s.now(),
+	}
+	// A result too large to store fails the task rather than its update
+	if err := core.ValidateJSONSize("result", result); err != nil {
+		updates["result"] = JSONMap{}
+		if runErr == nil {
+			runErr = err
+		}
+	}
+	if runErr != nil {
+		updates["status"] = TaskStatusFailed
+		updates["error"] = runErr.Error()
+	}
+
+	finished := s.db.WithContext(ctx).Model(&Task{}).
+		Where("id = ? AND claim_id = ? AND status = ?", task.ID, task.ClaimID, TaskStatusRunning).
+		Updates(updates)
+	if finished.Error != nil {
+		return fmt.Errorf("failed to update task %d: %w", task.ID, finished.Error)
+	}
+	if finished.RowsAffected == 0 {
+		log.Printf("⚠️  Discarded the late result of task %d; it was reaped while running", task.ID)
+	}
+	return nil
+}
+
+// requeueTask resets a claimed task to pending so it is claimed again
+func (s *Service) requeueTask(ctx context.Context, task *Task) error {
+	err := s.db.WithContext(ctx).Model(&Task{}).
+		Where("id = ? AND claim_id = ? AND status = ?", task.ID, task.ClaimID, TaskStatusRunning).
+		Updates(map[string]interface{}{"status": TaskStatusPending, "started_at": nil, "last_heartbeat": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to requeue task %d: %w", task.ID, err)
+	}
+	return nil
+}
+
+// heartbeatTask records that the worker of a claimed task is still alive
+func (s *Service) heartbeatTask(ctx context.Context, task *Task) error {
+	err := s.db.WithContext(ctx).Model(&Task{}).
+		Where("id = ? AND claim_id = ? AND status = ?", task.ID, task.ClaimID, TaskStatusRunning).
+		UpdateColumn("last_heartbeat", s.now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to heartbeat task %d: %w", task.ID, err)
+	}
+	return nil
+}
+
+// ReapStaleTasks resets running tasks that have not heartbeated for staleAfter
+// back to pending so they are retried, and marks those already requeued
+// maxRequeues times as failed. Running tasks that never heartbeated are judged
+// by when they started.
+func (s *Service) ReapStaleTasks(ctx context.Context, staleAfter time.Duration, maxRequeues int) (requeued, failed int64, err error) {
+	now := s.now()
+	cutoff := now.Add(-staleAfter)
+	stale := s.db.WithContext(ctx).Model(&Task{}).
+		Where("status = ?", TaskStatusRunning).
+		Where("last_heartbeat < ? OR (last_heartbeat IS NULL AND started_at < ?)", cutoff, cutoff)
+
+	result := stale.Session(&gorm.Session{}).Where("requeues >= ?", maxRequeues).Updates(map[string]interface{}{
+		"status":       TaskStatusFailed,
+		"error":        fmt.Sprintf("worker stopped heartbeating; gave up after %d requeues", maxRequeues),
+		"completed_at": now,
+	})
+	if result.Error != nil {
+		return 0, 0, fmt.Errorf("failed to fail stale tasks: %w", result.Error)
+	}
+	failed = result.RowsAffected
+
+	result = stale.Session(&gorm.Session{}).Where("requeues < ?", maxRequeues).Updates(map[string]interface{}{
+		"status":         TaskStatusPending,
+		"started_at":     nil,
+		"last_heartbeat": nil,
+		"requeues":       gorm.Expr("requeues + 1"),
+	})
+	if result.Error != nil {
+		return 0, failed, fmt.Errorf("failed to requeue stale tasks: %w", result.Error)
+	}
+	return result.RowsAffected, failed, nil
+}
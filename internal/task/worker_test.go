@@ -0,0 +1,214 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingRunner runs each task until release is closed or its context is cancelled
+type blockingRunner struct {
+	started chan uint
+	release chan struct{}
+}
+
+func (r *blockingRunner) RunTask(ctx context.Context, task *Task) (JSONMap, error) {
+	r.started <- task.ID
+	select {
+	case <-r.release:
+		return JSONMap{"done": true}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func setupWorkers(t *testing.T) (*Service, *blockingRunner, *Task) {
+	db := setupTestDB(t)
+	// Workers query from other goroutines; one connection keeps them on the same in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	service := NewService()
+	service.SetDB(db)
+	runner := &blockingRunner{started: make(chan uint, 1), release: make(chan struct{})}
+
+	pool := NewWorkerPool(service, runner, 1)
+	pool.PollInterval = 10 * time.Millisecond
+	service.SetWorkerPool(pool)
+
+	task := &Task{Name: "backup", Type: "shell", UserID: "user1"}
+	require.NoError(t, service.CreateTask(context.Background(), task))
+	service.Start()
+
+	select {
+	case id := <-runner.started:
+		require.Equal(t, task.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not claimed")
+	}
+	return service, runner, task
+}
+
+func TestWorkerPoolDrain(t *testing.T) {
+	t.Run("should let a running task finish", func(t *testing.T) {
+		service, runner, task := setupWorkers(t)
+
+		running, err := service.GetTask(context.Background(), "user1", task.ID)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusRunning, running.Status)
+
+		time.AfterFunc(20*time.Millisecond, func() { close(runner.release) })
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, service.Close(ctx))
+
+		finished, err := service.GetTask(context.Background(), "user1", task.ID)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusCompleted, finished.Status)
+		assert.Equal(t, true, finished.Result["done"])
+		assert.NotNil(t, finished.CompletedAt)
+	})
+
+	t.Run("should requeue a task still running at the deadline", func(t *testing.T) {
+		service, _, task := setupWorkers(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		require.NoError(t, service.Close(ctx))
+
+		requeued, err := service.GetTask(context.Background(), "user1", task.ID)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusPending, requeued.Status)
+		assert.Nil(t, requeued.StartedAt)
+		assert.Empty(t, requeued.Error, "the cancelled run should not be recorded")
+	})
+
+	t.Run("should not claim tasks once draining", func(t *testing.T) {
+		service, runner, _ := setupWorkers(t)
+		close(runner.release)
+		require.NoError(t, service.Close(context.Background()))
+
+		later := &Task{Name: "later", Type: "shell", UserID: "user1"}
+		require.NoError(t, service.CreateTask(context.Background(), later))
+		time.Sleep(50 * time.Millisecond)
+
+		pending, err := service.GetTask(context.Background(), "user1", later.ID)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusPending, pending.Status)
+	})
+}
+
+func TestShellRunner(t *testing.T) {
+	result, err := ShellRunner{}.RunTask(context.Background(), &Task{Config: JSONMap{"command": "echo hello; exit 3"}})
+	assert.Error(t, err)
+	assert.Equal(t, "hello\n", result["stdout"])
+	assert.Equal(t, 3, result["exit_code"])
+
+	_, err = ShellRunner{}.RunTask(context.Background(), &Task{})
+	assert.ErrorContains(t, err, "no command")
+}
+
+func TestReapStaleTasks(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+	service.SetDB(setupTestDB(t))
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	claim := func() *Task {
+		require.NoError(t, service.CreateTask(ctx, &Task{Name: "backup", Type: "shell", UserID: "user1"}))
+		task, err := service.claimTask(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, task)
+		return task
+	}
+	status := func(id uint) *Task {
+		task, err := service.GetTask(ctx, "user1", id)
+		require.NoError(t, err)
+		return task
+	}
+
+	t.Run("should keep tasks that are still heartbeating", func(t *testing.T) {
+		task := claim()
+		now = now.Add(50 * time.Second)
+		require.NoError(t, service.heartbeatTask(ctx, task))
+		now = now.Add(30 * time.Second)
+
+		requeued, failed, err := service.ReapStaleTasks(ctx, time.Minute, 3)
+		require.NoError(t, err)
+		assert.Zero(t, requeued+failed)
+		assert.Equal(t, TaskStatusRunning, status(task.ID).Status)
+
+		// Finish it so later subtests only see their own tasks
+		require.NoError(t, service.finishTask(ctx, task, nil, nil))
+	})
+
+	t.Run("should requeue a task whose heartbeat is stale", func(t *testing.T) {
+		task := claim()
+		now = now.Add(61 * time.Second)
+
+		requeued, failed, err := service.ReapStaleTasks(ctx, time.Minute, 3)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), requeued)
+		assert.Zero(t, failed)
+
+		reaped := status(task.ID)
+		assert.Equal(t, TaskStatusPending, reaped.Status)
+		assert.Equal(t, 1, reaped.Requeues)
+		assert.Nil(t, reaped.LastHeartbeat)
+
+		// It is claimed again like any pending task
+		again, err := service.claimTask(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, task.ID, again.ID)
+		require.NoError(t, service.finishTask(ctx, again, nil, nil))
+	})
+
+	t.Run("should discard the late result of a reaped claim", func(t *testing.T) {
+		task := claim()
+		now = now.Add(61 * time.Second)
+		_, _, err := service.ReapStaleTasks(ctx, time.Minute, 3)
+		require.NoError(t, err)
+		again, err := service.claimTask(ctx)
+		require.NoError(t, err)
+		require.Equal(t, task.ID, again.ID)
+
+		// The first worker cannot keep the new claim alive or overwrite its result
+		now = now.Add(30 * time.Second)
+		require.NoError(t, service.heartbeatTask(ctx, task))
+		assert.Equal(t, *again.LastHeartbeat, *status(task.ID).LastHeartbeat)
+		require.NoError(t, service.finishTask(ctx, task, JSONMap{"stdout": "stale"}, nil))
+		assert.Equal(t, TaskStatusRunning, status(task.ID).Status)
+
+		require.NoError(t, service.finishTask(ctx, again, JSONMap{"stdout": "fresh"}, nil))
+		finished := status(task.ID)
+		assert.Equal(t, TaskStatusCompleted, finished.Status)
+		assert.Equal(t, "fresh", finished.Result["stdout"])
+	})
+
+	t.Run("should fail a task after too many requeues", func(t *testing.T) {
+		task := claim()
+		for i := 0; i < 2; i++ {
+			now = now.Add(2 * time.Minute)
+			_, _, err := service.ReapStaleTasks(ctx, time.Minute, 2)
+			require.NoError(t, err)
+			_, err = service.claimTask(ctx)
+			require.NoError(t, err)
+		}
+
+		now = now.Add(2 * time.Minute)
+		requeued, failed, err := service.ReapStaleTasks(ctx, time.Minute, 2)
+		require.NoError(t, err)
+		assert.Zero(t, requeued)
+		assert.Equal(t, int64(1), failed)
+
+		reaped := status(task.ID)
+		assert.Equal(t, TaskStatusFailed, reaped.Status)
+		assert.Equal(t, 2, reaped.Requeues)
+		assert.Contains(t, reaped.Error, "stopped heartbeating")
+	})
+}
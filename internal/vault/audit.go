@@ -0,0 +1,283 @@
+package vault
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/crypto"
+)
+
+// AuditExportFormat represents the output format of an audit log export
+type AuditExportFormat int
+
+const (
+	AuditExportFormatJSONLines AuditExportFormat = iota
+	AuditExportFormatCEF
+)
+
+// String returns the string representation of AuditExportFormat
+func (f AuditExportFormat) String() string {
+	switch f {
+	case AuditExportFormatJSONLines:
+		return "jsonl"
+	case AuditExportFormatCEF:
+		return "cef"
+	default:
+		return "unknown"
+	}
+}
+
+// auditExportBatchSize is the number of audit entries fetched and signed per batch
+const auditExportBatchSize = 500
+
+// auditExportKeySalt separates the export signing key from other derived keys
+var auditExportKeySalt = []byte("vertex-audit-export")
+
+// AuditBatchSignature is written after each batch of exported audit entries.
+// The HMAC covers the previous batch signature followed by every line in the batch,
+// so dropped, reordered or edited lines and batches are detectable.
+type AuditBatchSignature struct {
+	Type  string `json:"type"`
+	Batch int    `json:"batch"`
+	Count int    `json:"count"`
+	HMAC  string `json:"hmac"`
+}
+
+const auditSignatureType = "batch_signature"
+
+// ExportAuditLog streams audit entries between from and to as newline-delimited JSON.
+// An empty userID exports entries for all users.
+func (s *Service) ExportAuditLog(ctx context.Context, userID string, from, to time.Time, w io.Writer) error {
+	return s.ExportAuditLogFormat(ctx, userID, from, to, AuditExportFormatJSONLines, w)
+}
+
+// ExportAuditLogFormat streams audit entries in the given format using keyset pagination
+func (s *Service) ExportAuditLogFormat(ctx context.Context, userID string, from, to time.Time, format AuditExportFormat, w io.Writer) error {
+	key, err := s.auditExportKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	var lastID uint
+	var previous []byte
+	batch := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		query := s.db.WithContext(ctx).
+			Where("id > ? AND created_at >= ? AND created_at <= ?", lastID, from, to)
+		if userID != "" {
+			query = query.Where("user_id = ?", userID)
+		}
+
+		var entries []AuditLog
+		if err := query.Order("id ASC").Limit(auditExportBatchSize).Find(&entries).Error; err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		batch++
+		mac := hmac.New(sha256.New, key)
+		mac.Write(previous)
+
+		for i := range entries {
+			line, err := formatAuditEntry(&entries[i], format)
+			if err != nil {
+				return err
+			}
+			mac.Write(line)
+			if _, err := writer.Write(append(line, '\n')); err != nil {
+				return fmt.Errorf("failed to write audit entry: %w", err)
+			}
+		}
+
+		previous = mac.Sum(nil)
+		signature := &AuditBatchSignature{
+			Type:  auditSignatureType,
+			Batch: batch,
+			Count: len(entries),
+			HMAC:  hex.EncodeToString(previous),
+		}
+		line, err := formatAuditSignature(signature, format)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write audit signature: %w", err)
+		}
+
+		lastID = entries[len(entries)-1].ID
+		if len(entries) < auditExportBatchSize {
+			break
+		}
+	}
+
+	return writer.Flush()
+}
+
+// VerifyAuditExport checks the batch signatures of an exported audit log
+func (s *Service) VerifyAuditExport(ctx context.Context, r io.Reader) error {
+	key, err := s.auditExportKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var previous []byte
+	mac := hmac.New(sha256.New, key)
+	mac.Write(previous)
+	count := 0
+	batch := 0
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		signature, ok := parseAuditSignature(line)
+		if !ok {
+			mac.Write(line)
+			count++
+			continue
+		}
+
+		batch++
+		expected := mac.Sum(nil)
+		actual, err := hex.DecodeString(signature.HMAC)
+		if err != nil || !hmac.Equal(expected, actual) {
+			return fmt.Errorf("audit batch %d signature mismatch", batch)
+		}
+		if signature.Batch != batch || signature.Count != count {
+			return fmt.Errorf("audit batch %d is incomplete", batch)
+		}
+
+		previous = expected
+		mac = hmac.New(sha256.New, key)
+		mac.Write(previous)
+		count = 0
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit export: %w", err)
+	}
+	if count > 0 {
+		return errors.New("audit export has unsigned trailing entries")
+	}
+
+	return nil
+}
+
+// auditExportKey derives the HMAC key used to sign audit exports
+func (s *Service) auditExportKey(ctx context.Context) ([]byte, error) {
+	password, err := s.masterKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.DeriveKey(password, auditExportKeySalt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive audit export key: %w", err)
+	}
+	return key, nil
+}
+
+// formatAuditEntry renders a single audit entry in the export format
+func formatAuditEntry(entry *AuditLog, format AuditExportFormat) ([]byte, error) {
+	switch format {
+	case AuditExportFormatJSONLines:
+		return json.Marshal(entry)
+	case AuditExportFormatCEF:
+		extension := fmt.Sprintf("rt=%d suser=%s cs1Label=secretKey cs1=%s src=%s requestClientApplication=%s externalId=%d",
+			entry.CreatedAt.UnixMilli(),
+			cefExtension(entry.UserID),
+			cefExtension(entry.SecretKey),
+			cefExtension(entry.IPAddress),
+			cefExtension(entry.UserAgent),
+			entry.ID,
+		)
+		return []byte(fmt.Sprintf("CEF:0|Ataiva|Vertex Vault|1.0|%s|Secret %s|%d|%s",
+			cefHeader(entry.Action), cefHeader(strings.ToLower(entry.Action)), cefSeverity(entry.Action), extension)), nil
+	default:
+		return nil, fmt.Errorf("unsupported audit export format: %s", format)
+	}
+}
+
+// formatAuditSignature renders a batch signature in the export format
+func formatAuditSignature(signature *AuditBatchSignature, format AuditExportFormat) ([]byte, error) {
+	switch format {
+	case AuditExportFormatJSONLines:
+		return json.Marshal(signature)
+	case AuditExportFormatCEF:
+		return []byte(fmt.Sprintf("CEF:0|Ataiva|Vertex Vault|1.0|%s|Audit batch signature|0|cn1Label=batch cn1=%d cn2Label=count cn2=%d cs1Label=hmac cs1=%s",
+			auditSignatureType, signature.Batch, signature.Count, signature.HMAC)), nil
+	default:
+		return nil, fmt.Errorf("unsupported audit export format: %s", format)
+	}
+}
+
+// parseAuditSignature recognises a batch signature line in either format
+func parseAuditSignature(line []byte) (*AuditBatchSignature, bool) {
+	text := string(line)
+	if strings.HasPrefix(text, "{") {
+		var signature AuditBatchSignature
+		if err := json.Unmarshal(line, &signature); err != nil || signature.Type != auditSignatureType {
+			return nil, false
+		}
+		return &signature, true
+	}
+
+	prefix := "CEF:0|Ataiva|Vertex Vault|1.0|" + auditSignatureType + "|"
+	if !strings.HasPrefix(text, prefix) {
+		return nil, false
+	}
+	signature := &AuditBatchSignature{Type: auditSignatureType}
+	for _, field := range strings.Fields(text[strings.LastIndex(text, "|")+1:]) {
+		name, value, _ := strings.Cut(field, "=")
+		switch name {
+		case "cn1":
+			fmt.Sscanf(value, "%d", &signature.Batch)
+		case "cn2":
+			fmt.Sscanf(value, "%d", &signature.Count)
+		case "cs1":
+			signature.HMAC = value
+		}
+	}
+	return signature, true
+}
+
+// cefSeverity maps audit actions to CEF severities
+func cefSeverity(action string) int {
+	switch action {
+	case "DELETE":
+		return 7
+	case "CREATE", "UPDATE":
+		return 5
+	default:
+		return 3
+	}
+}
+
+// cefHeader escapes a CEF header field
+func cefHeader(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+// cefExtension escapes a CEF extension value
+func cefExtension(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "=", `\=`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
@@ -0,0 +1,103 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogExport(t *testing.T) {
+	os.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	defer os.Unsetenv("VERTEX_MASTER_PASSWORD")
+
+	db := setupTestDB(t)
+	service := NewService(NewEnvKeyProvider())
+	service.SetDB(db)
+	ctx := context.Background()
+
+	require.NoError(t, service.StoreSecret(ctx, "auditor", &Secret{Key: "audit-1", Value: "v1"}))
+	require.NoError(t, service.StoreSecret(ctx, "auditor", &Secret{Key: "audit-2", Value: "v2"}))
+	_, err := service.GetSecret(ctx, "auditor", "audit-1")
+	require.NoError(t, err)
+	require.NoError(t, service.StoreSecret(ctx, "someone-else", &Secret{Key: "audit-3", Value: "v3"}))
+
+	from := time.Now().Add(-time.Hour)
+	to := time.Now().Add(time.Hour)
+
+	t.Run("should stream audit entries as JSON lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := service.ExportAuditLog(ctx, "auditor", from, to, &buf)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 4) // 3 entries + 1 batch signature
+
+		actions := make([]string, 0, 3)
+		for _, line := range lines[:3] {
+			var entry AuditLog
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			assert.Equal(t, "auditor", entry.UserID)
+			actions = append(actions, entry.Action)
+		}
+		assert.Equal(t, []string{"CREATE", "CREATE", "READ"}, actions)
+
+		var signature AuditBatchSignature
+		require.NoError(t, json.Unmarshal([]byte(lines[3]), &signature))
+		assert.Equal(t, "batch_signature", signature.Type)
+		assert.Equal(t, 1, signature.Batch)
+		assert.Equal(t, 3, signature.Count)
+		assert.NotEmpty(t, signature.HMAC)
+	})
+
+	t.Run("should verify an untampered export", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, service.ExportAuditLog(ctx, "", from, to, &buf))
+		assert.NoError(t, service.VerifyAuditExport(ctx, &buf))
+	})
+
+	t.Run("should detect tampered entries", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, service.ExportAuditLog(ctx, "auditor", from, to, &buf))
+
+		tampered := strings.Replace(buf.String(), `"action":"READ"`, `"action":"CREATE"`, 1)
+		err := service.VerifyAuditExport(ctx, strings.NewReader(tampered))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "signature mismatch")
+	})
+
+	t.Run("should detect a signature from another key", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, service.ExportAuditLog(ctx, "auditor", from, to, &buf))
+
+		other := NewService(StaticKeyProvider("another-password"))
+		assert.Error(t, other.VerifyAuditExport(ctx, &buf))
+	})
+
+	t.Run("should only export entries within the time range", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := service.ExportAuditLog(ctx, "auditor", to, to.Add(time.Hour), &buf)
+		require.NoError(t, err)
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("should export CEF lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := service.ExportAuditLogFormat(ctx, "auditor", from, to, AuditExportFormatCEF, &buf)
+		require.NoError(t, err)
+
+		scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+		require.True(t, scanner.Scan())
+		assert.True(t, strings.HasPrefix(scanner.Text(), "CEF:0|Ataiva|Vertex Vault|1.0|CREATE|"))
+		assert.Contains(t, scanner.Text(), "suser=auditor")
+
+		assert.NoError(t, service.VerifyAuditExport(ctx, bytes.NewReader(buf.Bytes())))
+	})
+}
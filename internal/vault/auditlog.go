@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+)
+
+// clientKey is the context key of the client a vault operation is made for
+type clientKey struct{}
+
+// clientInfo is the client recorded in the audit entries of an operation
+type clientInfo struct {
+	ipAddress string
+	userAgent string
+}
+
+// WithClient returns a context recording the client an operation is made for,
+// so the audit entries it writes name the client's IP address and user agent
+func WithClient(ctx context.Context, ipAddress, userAgent string) context.Context {
+	return context.WithValue(ctx, clientKey{}, clientInfo{ipAddress: ipAddress, userAgent: userAgent})
+}
+
+// AuditFilter selects audit log entries. Empty fields match every entry.
+type AuditFilter struct {
+	SecretKey string
+	// Action is an audited action such as READ or GRANT, matched case-insensitively
+	Action string
+	// From and To bound when the entries were written, inclusively
+	From time.Time
+	To   time.Time
+	// Page counts from 1, and PageSize defaults to core.DefaultPageSize
+	Page     int
+	PageSize int
+}
+
+// GetAuditLogs returns a page of the audit entries of the operations a user
+// made matching the filter, newest first, with how many match in total
+func (s *Service) GetAuditLogs(ctx context.Context, userID string, filter AuditFilter) (*core.Page[*AuditLog], error) {
+	if filter.Page < 0 || filter.PageSize < 0 {
+		return nil, errors.New("page and page size must not be negative")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return nil, errors.New("the end of the time range must not be before its start")
+	}
+	page := &core.Page[*AuditLog]{Items: []*AuditLog{}, Page: max(filter.Page, 1), PageSize: filter.PageSize}
+	if page.PageSize == 0 {
+		page.PageSize = core.DefaultPageSize
+	}
+
+	query := s.db.WithContext(ctx).Model(&AuditLog{}).Where("user_id = ?", userID)
+	if filter.SecretKey != "" {
+		query = query.Where("secret_key = ?", filter.SecretKey)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", strings.ToUpper(filter.Action))
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at <= ?", filter.To)
+	}
+
+	// A new session lets the query be both counted and paged
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+	page.Total = int(total)
+
+	offset := (page.Page - 1) * page.PageSize
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(page.PageSize).Find(&page.Items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return page, nil
+}
@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAuditLogs(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+
+	client := WithClient(ctx, "203.0.113.7", "vertex-cli/1.0")
+	require.NoError(t, service.StoreSecret(client, "user1", &Secret{Key: "db-password", Value: "v1"}))
+	_, err := service.GetSecret(client, "user1", "db-password")
+	require.NoError(t, err)
+	require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "api-key", Value: "k"}))
+	require.NoError(t, service.StoreSecret(ctx, "user2", &Secret{Key: "theirs", Value: "x"}))
+
+	t.Run("should record the client of each operation", func(t *testing.T) {
+		page, err := service.GetAuditLogs(ctx, "user1", AuditFilter{SecretKey: "db-password"})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 2)
+		for _, entry := range page.Items {
+			assert.Equal(t, "203.0.113.7", entry.IPAddress)
+			assert.Equal(t, "vertex-cli/1.0", entry.UserAgent)
+		}
+	})
+
+	t.Run("should list a user's entries newest first", func(t *testing.T) {
+		page, err := service.GetAuditLogs(ctx, "user1", AuditFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, page.Total)
+		require.Len(t, page.Items, 3)
+		assert.Equal(t, "api-key", page.Items[0].SecretKey)
+		assert.Equal(t, "READ", page.Items[1].Action)
+		assert.Equal(t, "CREATE", page.Items[2].Action)
+	})
+
+	t.Run("should filter by action and time range", func(t *testing.T) {
+		page, err := service.GetAuditLogs(ctx, "user1", AuditFilter{Action: "read"})
+		require.NoError(t, err)
+		require.Equal(t, 1, page.Total)
+		assert.Equal(t, "db-password", page.Items[0].SecretKey)
+
+		page, err = service.GetAuditLogs(ctx, "user1", AuditFilter{From: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Zero(t, page.Total)
+		assert.Empty(t, page.Items)
+
+		page, err = service.GetAuditLogs(ctx, "user1", AuditFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Equal(t, 3, page.Total)
+
+		_, err = service.GetAuditLogs(ctx, "user1", AuditFilter{From: time.Now(), To: time.Now().Add(-time.Hour)})
+		assert.ErrorContains(t, err, "must not be before its start")
+	})
+
+	t.Run("should page with the total count", func(t *testing.T) {
+		page, err := service.GetAuditLogs(ctx, "user1", AuditFilter{Page: 2, PageSize: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 3, page.Total)
+		assert.Equal(t, 2, page.Page)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "CREATE", page.Items[0].Action)
+		assert.Equal(t, "db-password", page.Items[0].SecretKey)
+
+		_, err = service.GetAuditLogs(ctx, "user1", AuditFilter{PageSize: -1})
+		assert.ErrorContains(t, err, "must not be negative")
+	})
+}
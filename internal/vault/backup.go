@@ -0,0 +1,104 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/crypto"
+)
+
+// ErrWrongPassphrase is returned when an exported secret cannot be decrypted
+// with the passphrase given to ImportSecrets
+var ErrWrongPassphrase = errors.New("wrong backup passphrase")
+
+// ExportedSecret is a secret in a backup archive. Value is encrypted with the
+// backup passphrase rather than the master password, so the archive can be
+// restored into a deployment with a different master password.
+type ExportedSecret struct {
+	Key         string      `json:"key"`
+	Value       string      `json:"value"` // base64, encrypted with the backup passphrase
+	Description string      `json:"description"`
+	Tags        StringSlice `json:"tags"`
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
+}
+
+// ExportSecrets returns the user's secrets re-encrypted with passphrase.
+// Expired secrets are left out.
+func (s *Service) ExportSecrets(ctx context.Context, userID, passphrase string) ([]*ExportedSecret, error) {
+	if passphrase == "" {
+		return nil, errors.New("backup passphrase is required")
+	}
+
+	var secrets []Secret
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("key").Find(&secrets).Error; err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	now := time.Now()
+	exported := make([]*ExportedSecret, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret.expired(now) {
+			continue
+		}
+		plaintext, _, err := s.decryptValue(ctx, secret.UserID, secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export secret '%s': %w", secret.Key, err)
+		}
+		value, err := crypto.EncryptAES(plaintext, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export secret '%s': %w", secret.Key, err)
+		}
+		exported = append(exported, &ExportedSecret{
+			Key:         secret.Key,
+			Value:       base64.StdEncoding.EncodeToString(value),
+			Description: secret.Description,
+			Tags:        secret.Tags,
+			ExpiresAt:   secret.ExpiresAt,
+		})
+	}
+
+	return exported, nil
+}
+
+// ImportSecrets stores exported secrets for the user under the master password
+// and returns how many were stored. Every value is decrypted before anything
+// is stored, so a wrong passphrase imports nothing. Secrets that expired since
+// the export are skipped.
+func (s *Service) ImportSecrets(ctx context.Context, userID, passphrase string, secrets []*ExportedSecret) (int, error) {
+	values := make([]string, len(secrets))
+	for i, secret := range secrets {
+		encrypted, err := base64.StdEncoding.DecodeString(secret.Value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode secret '%s': %w", secret.Key, err)
+		}
+		value, err := crypto.DecryptAES(encrypted, passphrase)
+		if err != nil {
+			return 0, fmt.Errorf("%w: failed to decrypt secret '%s'", ErrWrongPassphrase, secret.Key)
+		}
+		values[i] = string(value)
+	}
+
+	now := time.Now()
+	imported := 0
+	for i, secret := range secrets {
+		if secret.ExpiresAt != nil && !secret.ExpiresAt.After(now) {
+			continue
+		}
+		err := s.StoreSecret(ctx, userID, &Secret{
+			Key:         secret.Key,
+			Value:       values[i],
+			Description: secret.Description,
+			Tags:        secret.Tags,
+			ExpiresAt:   secret.ExpiresAt,
+		})
+		if err != nil {
+			return imported, err
+		}
+		imported++
+	}
+
+	return imported, nil
+}
@@ -0,0 +1,189 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MaxBulkUpdateKeys caps how many secrets one bulk update may change
+const MaxBulkUpdateKeys = 1000
+
+// ErrBulkUpdateFailed is returned when any key of a bulk update fails, in
+// which case no secret is changed
+var ErrBulkUpdateFailed = errors.New("bulk update failed")
+
+// ErrBulkKeysNotFound is returned along with ErrBulkUpdateFailed when every
+// key that failed was not found
+var ErrBulkKeysNotFound = errors.New("secrets not found")
+
+// ErrInvalidBulkUpdate is returned for bulk updates rejected before any secret
+// is looked up
+var ErrInvalidBulkUpdate = errors.New("invalid bulk update")
+
+// BulkUpdateResult reports the outcome of a bulk update for one key. It never
+// carries the secret's value.
+type BulkUpdateResult struct {
+	Key string `json:"key"`
+	// Updated is false when the secret already had the requested metadata,
+	// or when the bulk update failed
+	Updated     bool        `json:"updated"`
+	Description string      `json:"description"`
+	Tags        StringSlice `json:"tags"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// BulkUpdateMetadata adds and removes tags on, and optionally sets the
+// description of, many secrets the user owns in one transaction. Values are
+// neither read nor re-encrypted, and versions are unchanged. If any key is not
+// found, no secret is changed: the results report which keys failed and
+// ErrBulkUpdateFailed is returned, wrapping ErrBulkKeysNotFound when every
+// failure was a missing key.
+func (s *Service) BulkUpdateMetadata(ctx context.Context, userID string, keys []string, addTags, removeTags []string, description *string) ([]BulkUpdateResult, error) {
+	if err := validateBulkUpdate(keys, addTags, removeTags, description); err != nil {
+		return nil, err
+	}
+
+	results := make([]BulkUpdateResult, 0, len(keys))
+	failed, notFound := 0, 0
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, key := range uniqueKeys(keys) {
+			result := BulkUpdateResult{Key: key}
+			var secret Secret
+			err := tx.Scopes(secretMetadata).Where("key = ? AND user_id = ?", key, userID).Limit(1).Find(&secret).Error
+			if err != nil {
+				return fmt.Errorf("failed to find secret: %w", err)
+			}
+			if secret.ID == 0 {
+				result.Error = fmt.Sprintf("secret '%s' not found", key)
+				results = append(results, result)
+				failed++
+				notFound++
+				continue
+			}
+
+			result.Tags = updatedTags(secret.Tags, addTags, removeTags)
+			result.Description = secret.Description
+			if description != nil {
+				result.Description = *description
+			}
+			if result.Description != secret.Description || !equalTags(result.Tags, secret.Tags) {
+				updates := map[string]interface{}{"description": result.Description, "tags": result.Tags}
+				if err := tx.Model(&Secret{}).Where("id = ?", secret.ID).Updates(updates).Error; err != nil {
+					return fmt.Errorf("failed to update secret '%s': %w", key, err)
+				}
+				result.Updated = true
+			}
+			results = append(results, result)
+		}
+		if failed > 0 {
+			return ErrBulkUpdateFailed
+		}
+		return nil
+	})
+	if errors.Is(err, ErrBulkUpdateFailed) {
+		for i := range results {
+			results[i].Updated = false
+		}
+		if notFound == failed {
+			err = fmt.Errorf("%w (%w)", ErrBulkUpdateFailed, ErrBulkKeysNotFound)
+		}
+		return results, fmt.Errorf("%w: %d of %d keys failed, no secrets were changed", err, failed, len(results))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.Updated {
+			s.logOperation(ctx, userID, result.Key, "UPDATE_METADATA")
+		}
+	}
+	return results, nil
+}
+
+// validateBulkUpdate checks a bulk update's arguments, returning errors that
+// wrap ErrInvalidBulkUpdate
+func validateBulkUpdate(keys, addTags, removeTags []string, description *string) error {
+	if err := checkBulkUpdate(keys, addTags, removeTags, description); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBulkUpdate, err)
+	}
+	return nil
+}
+
+func checkBulkUpdate(keys, addTags, removeTags []string, description *string) error {
+	if len(keys) == 0 {
+		return errors.New("at least one key is required")
+	}
+	if len(keys) > MaxBulkUpdateKeys {
+		return fmt.Errorf("too many keys (max %d)", MaxBulkUpdateKeys)
+	}
+	for _, key := range keys {
+		if strings.TrimSpace(key) == "" {
+			return errors.New("keys must not be empty")
+		}
+	}
+	if len(addTags) == 0 && len(removeTags) == 0 && description == nil {
+		return errors.New("nothing to update")
+	}
+
+	removed := make(map[string]bool, len(removeTags))
+	for _, tag := range removeTags {
+		removed[tag] = true
+	}
+	for _, tag := range addTags {
+		if strings.TrimSpace(tag) == "" {
+			return errors.New("tags must not be empty")
+		}
+		if removed[tag] {
+			return fmt.Errorf("tag '%s' is both added and removed", tag)
+		}
+	}
+	return nil
+}
+
+// updatedTags returns tags without those removed and with those added that it
+// lacks, appended in order
+func updatedTags(tags StringSlice, add, remove []string) StringSlice {
+	removed := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		removed[tag] = true
+	}
+	result := make(StringSlice, 0, len(tags)+len(add))
+	present := make(map[string]bool, len(tags)+len(add))
+	for _, tag := range append(append([]string{}, tags...), add...) {
+		if !removed[tag] && !present[tag] {
+			present[tag] = true
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func equalTags(a, b StringSlice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueKeys returns keys without repeats, in order
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
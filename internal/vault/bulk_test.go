@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkUpdateMetadata(t *testing.T) {
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	db := setupTestDB(t)
+	service := NewService(NewEnvKeyProvider())
+	service.SetDB(db)
+	ctx := context.Background()
+
+	for key, tags := range map[string]StringSlice{
+		"staging/db":    {"staging", "db"},
+		"staging/api":   {"staging"},
+		"staging/cache": {"cache"},
+	} {
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: key, Value: "value-of-" + key, Tags: tags}))
+	}
+	require.NoError(t, service.StoreSecret(ctx, "user2", &Secret{Key: "other/db", Value: "theirs", Tags: StringSlice{"staging"}}))
+
+	stored := func(key string) Secret {
+		var secret Secret
+		require.NoError(t, db.Where("key = ?", key).First(&secret).Error)
+		return secret
+	}
+
+	t.Run("should retag many secrets without touching their values", func(t *testing.T) {
+		before := stored("staging/db")
+		description := "Pre-production"
+
+		results, err := service.BulkUpdateMetadata(ctx, "user1", []string{"staging/db", "staging/api", "staging/cache"}, []string{"preprod"}, []string{"staging"}, &description)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		assert.Equal(t, BulkUpdateResult{Key: "staging/db", Updated: true, Description: "Pre-production", Tags: StringSlice{"db", "preprod"}}, results[0])
+		assert.Equal(t, StringSlice{"preprod"}, results[1].Tags)
+		assert.Equal(t, StringSlice{"cache", "preprod"}, results[2].Tags)
+
+		after := stored("staging/db")
+		assert.Equal(t, StringSlice{"db", "preprod"}, after.Tags)
+		assert.Equal(t, "Pre-production", after.Description)
+		assert.Equal(t, before.Value, after.Value, "values are not re-encrypted")
+		assert.Equal(t, before.Version, after.Version)
+
+		secret, err := service.GetSecret(ctx, "user1", "staging/db")
+		require.NoError(t, err)
+		assert.Equal(t, "value-of-staging/db", secret.Value)
+
+		var logged int64
+		require.NoError(t, db.Model(&AuditLog{}).Where("action = ?", "UPDATE_METADATA").Count(&logged).Error)
+		assert.Equal(t, int64(3), logged)
+	})
+
+	t.Run("should report secrets that already match as unchanged", func(t *testing.T) {
+		results, err := service.BulkUpdateMetadata(ctx, "user1", []string{"staging/api", "staging/api"}, []string{"preprod"}, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, results, 1, "repeated keys are updated once")
+		assert.False(t, results[0].Updated)
+	})
+
+	t.Run("should change nothing if any key is missing", func(t *testing.T) {
+		results, err := service.BulkUpdateMetadata(ctx, "user1", []string{"staging/db", "missing", "other/db"}, []string{"archived"}, nil, nil)
+		assert.ErrorIs(t, err, ErrBulkUpdateFailed)
+		assert.ErrorIs(t, err, ErrBulkKeysNotFound)
+		assert.ErrorContains(t, err, "2 of 3 keys failed")
+		require.Len(t, results, 3)
+		assert.False(t, results[0].Updated)
+		assert.Empty(t, results[0].Error)
+		assert.Equal(t, "secret 'missing' not found", results[1].Error)
+		assert.Equal(t, "secret 'other/db' not found", results[2].Error, "secrets of other users are not found")
+
+		assert.Equal(t, StringSlice{"db", "preprod"}, stored("staging/db").Tags)
+		assert.Equal(t, StringSlice{"staging"}, stored("other/db").Tags)
+	})
+
+	t.Run("should reject invalid updates", func(t *testing.T) {
+		_, err := service.BulkUpdateMetadata(ctx, "user1", nil, []string{"a"}, nil, nil)
+		assert.ErrorIs(t, err, ErrInvalidBulkUpdate)
+		assert.ErrorContains(t, err, "at least one key is required")
+		_, err = service.BulkUpdateMetadata(ctx, "user1", []string{"staging/db"}, nil, nil, nil)
+		assert.ErrorContains(t, err, "nothing to update")
+		_, err = service.BulkUpdateMetadata(ctx, "user1", []string{"staging/db"}, []string{"a"}, []string{"a"}, nil)
+		assert.ErrorContains(t, err, "tag 'a' is both added and removed")
+		_, err = service.BulkUpdateMetadata(ctx, "user1", []string{"staging/db"}, []string{" "}, nil, nil)
+		assert.ErrorContains(t, err, "tags must not be empty")
+		_, err = service.BulkUpdateMetadata(ctx, "user1", make([]string, MaxBulkUpdateKeys+1), []string{"a"}, nil, nil)
+		assert.ErrorContains(t, err, "too many keys")
+	})
+}
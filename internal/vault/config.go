@@ -0,0 +1,82 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sources of the master key
+const (
+	MasterKeySourceEnv  = "env"
+	MasterKeySourceFile = "file"
+)
+
+// Config configures a vault Service
+type Config struct {
+	// MasterKeySource is where the master key is read from: "env" reads the
+	// MasterKeyEnv variable and "file" reads MasterKeyFile, see FileKeyProvider
+	MasterKeySource string `json:"master_key_source" yaml:"master_key_source"`
+	MasterKeyEnv    string `json:"master_key_env" yaml:"master_key_env"`
+	MasterKeyFile   string `json:"master_key_file" yaml:"master_key_file"`
+	// PurgeInterval is how often expired secrets are purged
+	PurgeInterval time.Duration `json:"purge_interval" yaml:"purge_interval"`
+	// KeyPolicy is the naming convention secret keys must follow
+	KeyPolicy KeyPolicy `json:"key_policy" yaml:"key_policy"`
+}
+
+// DefaultConfig reads the master key from VERTEX_MASTER_PASSWORD
+func DefaultConfig() Config {
+	return Config{
+		MasterKeySource: MasterKeySourceEnv,
+		MasterKeyEnv:    MasterPasswordEnv,
+		PurgeInterval:   DefaultPurgeInterval,
+		KeyPolicy:       DefaultKeyPolicy(),
+	}
+}
+
+// Validate reports whether the config names a usable master key source
+func (c Config) Validate() error {
+	switch c.MasterKeySource {
+	case MasterKeySourceEnv:
+		if strings.TrimSpace(c.MasterKeyEnv) == "" {
+			return errors.New("master key env variable is required")
+		}
+	case MasterKeySourceFile:
+		if strings.TrimSpace(c.MasterKeyFile) == "" {
+			return errors.New("master key file is required")
+		}
+	default:
+		return fmt.Errorf("unknown master key source '%s'", c.MasterKeySource)
+	}
+	if c.PurgeInterval <= 0 {
+		return errors.New("purge interval must be positive")
+	}
+	if err := c.KeyPolicy.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// KeyProvider returns the provider for the configured master key source
+func (c Config) KeyProvider() KeyProvider {
+	if c.MasterKeySource == MasterKeySourceFile {
+		return NewFileKeyProvider(c.MasterKeyFile)
+	}
+	return &EnvKeyProvider{Variable: c.MasterKeyEnv}
+}
+
+// NewServiceWithConfig validates cfg and creates a vault service reading the
+// master key from the configured source
+func NewServiceWithConfig(cfg Config) (*Service, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid vault config: %w", err)
+	}
+	s := NewService(cfg.KeyProvider())
+	s.SetPurgeInterval(cfg.PurgeInterval)
+	if err := s.SetKeyPolicy(cfg.KeyPolicy); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
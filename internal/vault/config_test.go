@@ -0,0 +1,41 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("should create a service from the default config", func(t *testing.T) {
+		service, err := NewServiceWithConfig(DefaultConfig())
+		require.NoError(t, err)
+		assert.Equal(t, &EnvKeyProvider{Variable: MasterPasswordEnv}, service.keys)
+	})
+
+	t.Run("should read the master key from a file", func(t *testing.T) {
+		service, err := NewServiceWithConfig(Config{MasterKeySource: MasterKeySourceFile, MasterKeyFile: "/run/secrets/key", PurgeInterval: time.Hour})
+		require.NoError(t, err)
+		assert.Equal(t, NewFileKeyProvider("/run/secrets/key"), service.keys)
+		assert.Equal(t, time.Hour, service.purgeInterval)
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		for _, tc := range []struct {
+			config Config
+			err    string
+		}{
+			{Config{}, "unknown master key source"},
+			{Config{MasterKeySource: "kms"}, "unknown master key source 'kms'"},
+			{Config{MasterKeySource: MasterKeySourceEnv}, "master key env variable is required"},
+			{Config{MasterKeySource: MasterKeySourceFile, MasterKeyEnv: MasterPasswordEnv}, "master key file is required"},
+			{Config{MasterKeySource: MasterKeySourceEnv, MasterKeyEnv: MasterPasswordEnv}, "purge interval must be positive"},
+		} {
+			assert.ErrorContains(t, tc.config.Validate(), tc.err)
+			_, err := NewServiceWithConfig(tc.config)
+			assert.ErrorContains(t, err, "invalid vault config")
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ataiva-software/vertex/pkg/crypto"
+	"gorm.io/gorm/clause"
+)
+
+// Stored secret values start with a header identifying how they were
+// encrypted: a magic byte, the header format version, a fingerprint of the
+// master key version and the key-derivation info (a 2-byte length, then the
+// info). The value is encrypted directly with a key derived by HKDF from that
+// info and the root key, which is the master key stretched with PBKDF2 and the
+// install's salt. Each user's secrets have their own key, and guessing the
+// master key costs a full PBKDF2 derivation. Values written before key
+// versioning have no header.
+const (
+	envelopeMagic          byte = 'V'
+	envelopeVersionUserKey byte = 2
+	fingerprintLength           = 8
+	envelopeHeaderLength        = 2 + fingerprintLength
+)
+
+// fingerprintInfo is the key-derivation info key fingerprints are derived
+// from the root key with
+const fingerprintInfo = "vertex/key-fingerprint"
+
+// envelope is a parsed stored secret value
+type envelope struct {
+	version     byte
+	fingerprint []byte
+	info        string
+	ciphertext  []byte
+}
+
+// parseEnvelope splits a stored value into its header and ciphertext. It
+// reports false for values without a recognised header.
+func parseEnvelope(data []byte) (*envelope, bool) {
+	if len(data) <= envelopeHeaderLength+2 || data[0] != envelopeMagic || data[1] != envelopeVersionUserKey {
+		return nil, false
+	}
+
+	env := &envelope{version: data[1], fingerprint: data[2:envelopeHeaderLength]}
+	rest := data[envelopeHeaderLength:]
+	length := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+length {
+		return nil, false
+	}
+	env.info = string(rest[2 : 2+length])
+	env.ciphertext = rest[2+length:]
+	return env, true
+}
+
+// userKeyInfo is the key-derivation info for secrets owned by userID
+func userKeyInfo(userID string) string {
+	return "vertex/secret/user:" + userID
+}
+
+// userKey derives the encryption key for one user's secrets from a root key
+func userKey(rootKey []byte, info string) ([]byte, error) {
+	return crypto.DeriveSubkey(rootKey, info)
+}
+
+// installSalt returns the salt master keys are stretched with, generating and
+// storing it on first use. Instances racing to create it all use the first.
+func (s *Service) installSalt(ctx context.Context) ([]byte, error) {
+	s.saltMu.Lock()
+	defer s.saltMu.Unlock()
+	if s.salt != nil {
+		return s.salt, nil
+	}
+
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key salt: %w", err)
+	}
+	db := s.db.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&KeySalt{ID: 1, Salt: salt}).Error; err != nil {
+		return nil, fmt.Errorf("failed to store key salt: %w", err)
+	}
+	var stored KeySalt
+	if err := db.First(&stored, 1).Error; err != nil {
+		return nil, fmt.Errorf("failed to load key salt: %w", err)
+	}
+	s.salt = stored.Salt
+	return s.salt, nil
+}
+
+// rootKey stretches a master key with the install's salt. It is cached so the
+// slow derivation runs once per master key rather than once per user.
+func (s *Service) rootKey(ctx context.Context, password string) ([]byte, error) {
+	if cached, ok := s.rootKeys.Load(password); ok {
+		return cached.([]byte), nil
+	}
+
+	salt, err := s.installSalt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.DeriveKey(password, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive root key: %w", err)
+	}
+	s.rootKeys.Store(password, key)
+	return key, nil
+}
+
+// masterKeys returns the current master key followed by any previous versions
+func (s *Service) masterKeys(ctx context.Context) ([]string, error) {
+	provider := s.keyProvider()
+	current, err := provider.GetMasterKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get master key: %w", err)
+	}
+
+	keys := []string{string(current)}
+	if history, ok := provider.(KeyHistoryProvider); ok {
+		previous, err := history.GetPreviousKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get previous master keys: %w", err)
+		}
+		for _, key := range previous {
+			keys = append(keys, string(key))
+		}
+	}
+	return keys, nil
+}
+
+// keyFingerprint identifies a master key without revealing it. It is derived
+// from the root key, so it is salted per install and checking a guessed master
+// key against it costs a full PBKDF2 derivation.
+func (s *Service) keyFingerprint(ctx context.Context, password string) ([]byte, error) {
+	rootKey, err := s.rootKey(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.DeriveSubkey(rootKey, fingerprintInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key fingerprint: %w", err)
+	}
+	return key[:fingerprintLength], nil
+}
+
+// keyVersion is the KeyVersion recorded for secrets encrypted under a master key
+func (s *Service) keyVersion(ctx context.Context, password string) (string, error) {
+	fingerprint, err := s.keyFingerprint(ctx, password)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(fingerprint), nil
+}
+
+// encryptValue encrypts a secret value owned by userID under that user's key,
+// derived from the current master key, and encodes it for storage. It also
+// returns the key version to record with the value.
+func (s *Service) encryptValue(ctx context.Context, userID string, plaintext []byte) (value, keyVersion string, err error) {
+	password, err := s.masterKey(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return s.encryptWithKey(ctx, password, userID, plaintext)
+}
+
+// encryptWithKey is encryptValue under the given master key
+func (s *Service) encryptWithKey(ctx context.Context, password, userID string, plaintext []byte) (value, keyVersion string, err error) {
+	fingerprint, err := s.keyFingerprint(ctx, password)
+	if err != nil {
+		return "", "", err
+	}
+
+	info := userKeyInfo(userID)
+	if len(info) > math.MaxUint16 {
+		return "", "", errors.New("user ID is too long")
+	}
+	rootKey, err := s.rootKey(ctx, password)
+	if err != nil {
+		return "", "", err
+	}
+	key, err := userKey(rootKey, info)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to derive user key: %w", err)
+	}
+	encrypted, err := crypto.EncryptWithKey(plaintext, key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	sealed := make([]byte, 0, envelopeHeaderLength+2+len(info)+len(encrypted))
+	sealed = append(sealed, envelopeMagic, envelopeVersionUserKey)
+	sealed = append(sealed, fingerprint...)
+	sealed = binary.BigEndian.AppendUint16(sealed, uint16(len(info)))
+	sealed = append(sealed, info...)
+	sealed = append(sealed, encrypted...)
+	return base64.StdEncoding.EncodeToString(sealed), hex.EncodeToString(fingerprint), nil
+}
+
+// decryptValue decodes and decrypts a stored value of a secret owned by userID,
+// using the master key version it names. A value encrypted for another user
+// does not decrypt. stale reports that the value was not written under the
+// current master key and user key format and should be re-encrypted.
+func (s *Service) decryptValue(ctx context.Context, userID, value string) (plaintext []byte, stale bool, err error) {
+	keys, err := s.masterKeys(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.decryptWithKeys(ctx, userID, value, keys)
+}
+
+// decryptWithKeys is decryptValue with the given master keys, current first
+func (s *Service) decryptWithKeys(ctx context.Context, userID, value string, keys []string) (plaintext []byte, stale bool, err error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode secret: %w", err)
+	}
+
+	if env, ok := parseEnvelope(data); ok {
+		for i, key := range keys {
+			fingerprint, err := s.keyFingerprint(ctx, key)
+			if err != nil {
+				return nil, false, err
+			}
+			if !bytes.Equal(fingerprint, env.fingerprint) {
+				continue
+			}
+
+			plaintext, err := s.openEnvelope(ctx, env, userID, key)
+			if err != nil {
+				return nil, false, err
+			}
+			return plaintext, i > 0, nil
+		}
+	}
+
+	// Values without a recognised header predate key versioning, so try every key
+	for _, key := range keys {
+		if plaintext, err := crypto.DecryptAES(data, key); err == nil {
+			return plaintext, true, nil
+		}
+	}
+	return nil, false, errors.New("failed to decrypt secret: no master key version matches")
+}
+
+// openEnvelope decrypts an envelope written under the given master key
+func (s *Service) openEnvelope(ctx context.Context, env *envelope, userID, masterKey string) ([]byte, error) {
+	info := userKeyInfo(userID)
+	if env.info != info {
+		return nil, errors.New("failed to decrypt secret: it was encrypted for a different user")
+	}
+	rootKey, err := s.rootKey(ctx, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := userKey(rootKey, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive user key: %w", err)
+	}
+	plaintext, err := crypto.DecryptWithKey(env.ciphertext, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,100 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+)
+
+// ErrSecretExpired is returned when reading a secret past its expiry
+var ErrSecretExpired = errors.New("secret expired")
+
+// DefaultPurgeInterval is how often a started service purges expired secrets
+const DefaultPurgeInterval = 5 * time.Minute
+
+// purgeJobName is the scheduler job purging expired secrets
+const purgeJobName = "vault.expired-secrets"
+
+// secretExpiry returns when a secret being stored should expire: its TTL from
+// now if it has one, otherwise its ExpiresAt, which may be unset
+func secretExpiry(secret *Secret, now time.Time) (*time.Time, error) {
+	if secret.TTL < 0 {
+		return nil, errors.New("ttl must not be negative")
+	}
+	if secret.TTL > 0 {
+		expiresAt := now.Add(secret.TTL)
+		return &expiresAt, nil
+	}
+	if secret.ExpiresAt != nil && !secret.ExpiresAt.After(now) {
+		return nil, errors.New("expiry must be in the future")
+	}
+	return secret.ExpiresAt, nil
+}
+
+// expired reports whether the secret is past its expiry
+func (s *Secret) expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+// SetScheduler sets the scheduler expired secrets are purged on, which is
+// shared with other services. Without one, expired secrets are not purged.
+func (s *Service) SetScheduler(scheduler *core.Scheduler) {
+	s.scheduler = scheduler
+}
+
+// SetPurgeInterval sets how often a started service purges expired secrets
+func (s *Service) SetPurgeInterval(interval time.Duration) {
+	s.purgeInterval = interval
+}
+
+// Start purges expired secrets every purge interval
+func (s *Service) Start() {
+	err := s.scheduler.Register(core.Job{
+		Name:     purgeJobName,
+		Schedule: core.Every(s.purgeInterval),
+		Run: func(ctx context.Context) error {
+			_, err := s.PurgeExpiredSecrets(ctx)
+			return err
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to schedule expired secret purges: %v", err)
+	}
+}
+
+// Close stops purging expired secrets
+func (s *Service) Close(ctx context.Context) error {
+	if err := s.scheduler.Unregister(ctx, purgeJobName); err != nil && !errors.Is(err, core.ErrJobNotFound) {
+		return err
+	}
+	return nil
+}
+
+// PurgeExpiredSecrets soft-deletes every secret past its expiry, auditing each
+// as EXPIRE, and returns how many it deleted. Like other deletes the secrets'
+// versions and grants are kept.
+func (s *Service) PurgeExpiredSecrets(ctx context.Context) (int, error) {
+	now := time.Now()
+	var expired []Secret
+	if err := s.db.WithContext(ctx).Scopes(secretMetadata).Where("expires_at <= ?", now).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to list expired secrets: %w", err)
+	}
+
+	purged := 0
+	for _, secret := range expired {
+		// The secret may have been updated with a later expiry since it was listed
+		result := s.db.WithContext(ctx).Where("id = ? AND expires_at <= ?", secret.ID, now).Delete(&Secret{})
+		if result.Error != nil {
+			return purged, fmt.Errorf("failed to purge secret '%s': %w", secret.Key, result.Error)
+		}
+		if result.RowsAffected == 1 {
+			purged++
+			s.logOperation(ctx, secret.UserID, secret.Key, "EXPIRE")
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,115 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretExpiry(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	// Purges run on the scheduler; one connection keeps them on the same in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+
+	// expire moves a secret's expiry into the past
+	expire := func(t *testing.T, key string) {
+		require.NoError(t, db.Model(&Secret{}).Where("key = ?", key).Update("expires_at", time.Now().Add(-time.Second)).Error)
+	}
+
+	t.Run("should set the expiry from a TTL", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "temp-token", Value: "t0k3n", TTL: time.Hour}))
+
+		secret, err := service.GetSecret(ctx, "user1", "temp-token")
+		require.NoError(t, err)
+		assert.Equal(t, "t0k3n", secret.Value)
+		require.NotNil(t, secret.ExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *secret.ExpiresAt, time.Minute)
+	})
+
+	t.Run("should reject invalid expiries", func(t *testing.T) {
+		err := service.StoreSecret(ctx, "user1", &Secret{Key: "bad-ttl", Value: "x", TTL: -time.Minute})
+		assert.ErrorContains(t, err, "ttl must not be negative")
+		past := time.Now().Add(-time.Minute)
+		err = service.StoreSecret(ctx, "user1", &Secret{Key: "bad-expiry", Value: "x", ExpiresAt: &past})
+		assert.ErrorContains(t, err, "expiry must be in the future")
+	})
+
+	t.Run("should fail to read an expired secret and flag it in lists", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "lasting", Value: "forever"}))
+		expire(t, "temp-token")
+
+		_, err := service.GetSecret(ctx, "user1", "temp-token")
+		assert.True(t, errors.Is(err, ErrSecretExpired))
+		assert.ErrorContains(t, err, "secret 'temp-token': secret expired")
+
+		list, err := service.ListSecrets(ctx, "user1")
+		require.NoError(t, err)
+		flags := make(map[string]bool)
+		for _, item := range list {
+			flags[item.Key] = item.Expired
+		}
+		assert.Equal(t, map[string]bool{"temp-token": true, "lasting": false}, flags)
+	})
+
+	t.Run("should renew or clear the expiry on update", func(t *testing.T) {
+		require.NoError(t, service.UpdateSecret(ctx, "user1", &Secret{Key: "temp-token", Value: "renewed", TTL: time.Hour}))
+		secret, err := service.GetSecret(ctx, "user1", "temp-token")
+		require.NoError(t, err)
+		assert.Equal(t, "renewed", secret.Value)
+
+		require.NoError(t, service.UpdateSecret(ctx, "user1", &Secret{Key: "temp-token", Value: "permanent"}))
+		secret, err = service.GetSecret(ctx, "user1", "temp-token")
+		require.NoError(t, err)
+		assert.Nil(t, secret.ExpiresAt)
+	})
+
+	t.Run("should purge expired secrets and audit each", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "user2", &Secret{Key: "short-lived", Value: "x", TTL: time.Hour}))
+		expire(t, "short-lived")
+
+		purged, err := service.PurgeExpiredSecrets(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, purged)
+
+		exists, err := service.Exists(ctx, "user2", "short-lived")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		var deleted Secret
+		require.NoError(t, db.Unscoped().Where("key = ?", "short-lived").First(&deleted).Error)
+		assert.True(t, deleted.DeletedAt.Valid, "purged secrets are soft-deleted")
+
+		var entry AuditLog
+		require.NoError(t, db.Where("action = ?", "EXPIRE").First(&entry).Error)
+		assert.Equal(t, "user2", entry.UserID)
+		assert.Equal(t, "short-lived", entry.SecretKey)
+
+		purged, err = service.PurgeExpiredSecrets(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, purged)
+	})
+
+	t.Run("should purge on a schedule once started", func(t *testing.T) {
+		scheduler := core.NewScheduler()
+		service.SetScheduler(scheduler)
+		service.SetPurgeInterval(10 * time.Millisecond)
+		service.Start()
+		defer service.Close(ctx)
+
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "scheduled", Value: "x", TTL: time.Hour}))
+		expire(t, "scheduled")
+		assert.Eventually(t, func() bool {
+			exists, err := service.Exists(ctx, "user1", "scheduled")
+			return err == nil && !exists
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm/clause"
+)
+
+// GrantSecret lets another user read a secret the user owns. Only the owner
+// can update, delete or share it further. Granting it again is a no-op.
+func (s *Service) GrantSecret(ctx context.Context, userID, key, granteeID string) error {
+	if granteeID == "" {
+		return errors.New("grantee is required")
+	}
+	if granteeID == userID {
+		return errors.New("cannot grant a secret to its owner")
+	}
+	secret, err := s.ownedSecret(ctx, userID, key)
+	if err != nil {
+		return err
+	}
+
+	grant := &SecretGrant{SecretID: secret.ID, GranteeID: granteeID, GrantedBy: userID}
+	err = s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "secret_id"}, {Name: "grantee_id"}}, DoNothing: true}).
+		Create(grant).Error
+	if err != nil {
+		return fmt.Errorf("failed to grant secret: %w", err)
+	}
+
+	s.logOperation(ctx, userID, key, "GRANT")
+
+	return nil
+}
+
+// RevokeSecret withdraws another user's access to a secret the user owns
+func (s *Service) RevokeSecret(ctx context.Context, userID, key, granteeID string) error {
+	secret, err := s.ownedSecret(ctx, userID, key)
+	if err != nil {
+		return err
+	}
+
+	result := s.db.WithContext(ctx).Where("secret_id = ? AND grantee_id = ?", secret.ID, granteeID).Delete(&SecretGrant{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke secret: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("secret '%s' is not granted to '%s'", key, granteeID)
+	}
+
+	s.logOperation(ctx, userID, key, "REVOKE")
+
+	return nil
+}
+
+// ListSecretGrants returns who a secret the user owns is granted to
+func (s *Service) ListSecretGrants(ctx context.Context, userID, key string) ([]*SecretGrant, error) {
+	secret, err := s.ownedSecret(ctx, userID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var grants []*SecretGrant
+	if err := s.db.WithContext(ctx).Where("secret_id = ?", secret.ID).Order("grantee_id").Find(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list secret grants: %w", err)
+	}
+	return grants, nil
+}
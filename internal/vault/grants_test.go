@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretGrants(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(setupTestDB(t))
+	require.NoError(t, service.StoreSecret(ctx, "owner", &Secret{Key: "deploy-key", Value: "s3cret"}))
+
+	t.Run("should let a grantee read but not change a secret", func(t *testing.T) {
+		require.NoError(t, service.GrantSecret(ctx, "owner", "deploy-key", "teammate"))
+		require.NoError(t, service.GrantSecret(ctx, "owner", "deploy-key", "teammate"), "granting again is a no-op")
+
+		secret, err := service.GetSecret(ctx, "teammate", "deploy-key")
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", secret.Value)
+		list, err := service.ListSecrets(ctx, "teammate")
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "deploy-key", list[0].Key)
+
+		assert.ErrorContains(t, service.UpdateSecret(ctx, "teammate", &Secret{Key: "deploy-key", Value: "changed"}), "not found")
+		assert.ErrorContains(t, service.DeleteSecret(ctx, "teammate", "deploy-key"), "not found")
+		assert.ErrorContains(t, service.GrantSecret(ctx, "teammate", "deploy-key", "stranger"), "not found")
+		_, err = service.GetUserSecret(ctx, "teammate", "deploy-key")
+		assert.ErrorContains(t, err, "not found", "services only read a user's own secrets")
+
+		_, err = service.GetSecret(ctx, "stranger", "deploy-key")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("should prefer a grantee's own secret with the same key", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "teammate", &Secret{Key: "deploy-key", Value: "mine"}))
+		defer service.DeleteSecret(ctx, "teammate", "deploy-key")
+
+		secret, err := service.GetSecret(ctx, "teammate", "deploy-key")
+		require.NoError(t, err)
+		assert.Equal(t, "mine", secret.Value)
+	})
+
+	t.Run("should address a key granted by several owners by its owner", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "alice", &Secret{Key: "db", Value: "alice-db"}))
+		require.NoError(t, service.StoreSecret(ctx, "bob", &Secret{Key: "db", Value: "bob-db"}))
+		require.NoError(t, service.GrantSecret(ctx, "alice", "db", "carol"))
+		require.NoError(t, service.GrantSecret(ctx, "bob", "db", "carol"))
+
+		_, err := service.GetSecret(ctx, "carol", "db")
+		assert.ErrorIs(t, err, ErrAmbiguousSecret)
+		for owner, value := range map[string]string{"alice": "alice-db", "bob": "bob-db"} {
+			secret, err := service.GetSharedSecret(ctx, "carol", owner, "db")
+			require.NoError(t, err)
+			assert.Equal(t, value, secret.Value)
+		}
+		_, err = service.GetSharedSecret(ctx, "stranger", "alice", "db")
+		assert.ErrorContains(t, err, "not found")
+
+		list, err := service.ListSecrets(ctx, "carol")
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.ElementsMatch(t, []string{"alice", "bob"}, []string{list[0].Owner, list[1].Owner})
+
+		require.NoError(t, service.RevokeSecret(ctx, "bob", "db", "carol"))
+		secret, err := service.GetSecret(ctx, "carol", "db")
+		require.NoError(t, err)
+		assert.Equal(t, "alice-db", secret.Value, "a key granted by one owner needs no owner")
+	})
+
+	t.Run("should list and revoke grants", func(t *testing.T) {
+		grants, err := service.ListSecretGrants(ctx, "owner", "deploy-key")
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		assert.Equal(t, "teammate", grants[0].GranteeID)
+		assert.Equal(t, "owner", grants[0].GrantedBy)
+
+		require.NoError(t, service.RevokeSecret(ctx, "owner", "deploy-key", "teammate"))
+		_, err = service.GetSecret(ctx, "teammate", "deploy-key")
+		assert.ErrorContains(t, err, "not found")
+		assert.ErrorContains(t, service.RevokeSecret(ctx, "owner", "deploy-key", "teammate"), "is not granted to 'teammate'")
+	})
+
+	t.Run("should reject grants to nobody or the owner", func(t *testing.T) {
+		assert.ErrorContains(t, service.GrantSecret(ctx, "owner", "deploy-key", ""), "grantee is required")
+		assert.ErrorContains(t, service.GrantSecret(ctx, "owner", "deploy-key", "owner"), "cannot grant a secret to its owner")
+	})
+}
@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxKeyLength is the longest key the default policy allows
+const DefaultMaxKeyLength = 255
+
+// KeyPolicy is the naming convention secret keys must follow. Keys are
+// '/'-delimited paths such as "prod/db/password".
+type KeyPolicy struct {
+	// Pattern is a regular expression the whole key must match; empty allows
+	// any key
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// MaxLength is the longest key allowed, in bytes; zero means
+	// DefaultMaxKeyLength
+	MaxLength int `json:"max_length" yaml:"max_length"`
+	// MaxDepth is how many '/'-delimited segments a key may have; zero means
+	// any number
+	MaxDepth int `json:"max_depth" yaml:"max_depth"`
+}
+
+// DefaultKeyPolicy allows any key of up to DefaultMaxKeyLength bytes, as keys
+// have always been
+func DefaultKeyPolicy() KeyPolicy {
+	return KeyPolicy{MaxLength: DefaultMaxKeyLength}
+}
+
+// keyRules is a KeyPolicy with its pattern compiled
+type keyRules struct {
+	policy  KeyPolicy
+	pattern *regexp.Regexp
+}
+
+// compile validates the policy and compiles its pattern
+func (p KeyPolicy) compile() (*keyRules, error) {
+	if p.MaxLength < 0 {
+		return nil, errors.New("max key length must not be negative")
+	}
+	if p.MaxDepth < 0 {
+		return nil, errors.New("max key depth must not be negative")
+	}
+	if p.MaxLength == 0 {
+		p.MaxLength = DefaultMaxKeyLength
+	}
+	rules := &keyRules{policy: p}
+	if p.Pattern != "" {
+		pattern, err := regexp.Compile(`^(?:` + p.Pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern: %w", err)
+		}
+		rules.pattern = pattern
+	}
+	return rules, nil
+}
+
+// Validate reports whether the policy can be enforced
+func (p KeyPolicy) Validate() error {
+	_, err := p.compile()
+	return err
+}
+
+// check returns an error naming the rule key breaks, if any
+func (r *keyRules) check(key string) error {
+	if len(key) > r.policy.MaxLength {
+		return fmt.Errorf("key too long (max %d characters)", r.policy.MaxLength)
+	}
+	if depth := strings.Count(key, "/") + 1; r.policy.MaxDepth > 0 && depth > r.policy.MaxDepth {
+		return fmt.Errorf("key '%s' has %d path segments (max %d)", key, depth, r.policy.MaxDepth)
+	}
+	if r.pattern != nil && !r.pattern.MatchString(key) {
+		return fmt.Errorf("key '%s' does not match the key pattern '%s'", key, r.policy.Pattern)
+	}
+	return nil
+}
+
+// SetKeyPolicy sets the naming convention keys of stored and updated secrets
+// must follow. Secrets already stored under keys it rejects can still be read
+// and deleted.
+func (s *Service) SetKeyPolicy(policy KeyPolicy) error {
+	rules, err := policy.compile()
+	if err != nil {
+		return err
+	}
+	s.keyRules.Store(rules)
+	return nil
+}
+
+// KeyPolicy returns the naming convention secret keys must follow
+func (s *Service) KeyPolicy() KeyPolicy {
+	return s.rules().policy
+}
+
+func (s *Service) rules() *keyRules {
+	if rules := s.keyRules.Load(); rules != nil {
+		return rules
+	}
+	return defaultKeyRules
+}
+
+var defaultKeyRules, _ = DefaultKeyPolicy().compile()
@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyPolicy(t *testing.T) {
+	check := func(t *testing.T, policy KeyPolicy, key string) error {
+		rules, err := policy.compile()
+		require.NoError(t, err)
+		return rules.check(key)
+	}
+
+	t.Run("should allow existing keys under the default policy", func(t *testing.T) {
+		for _, key := range []string{"DB_PASSWORD", "prod/db/password", "api.key", "Team Secret", strings.Repeat("k", 255)} {
+			assert.NoError(t, check(t, DefaultKeyPolicy(), key), key)
+		}
+		assert.ErrorContains(t, check(t, DefaultKeyPolicy(), strings.Repeat("k", 256)), "key too long (max 255 characters)")
+	})
+
+	t.Run("should enforce a lowercase slash-delimited policy", func(t *testing.T) {
+		policy := KeyPolicy{Pattern: `[a-z0-9_-]+(/[a-z0-9_-]+)*`, MaxLength: 64, MaxDepth: 3}
+
+		for _, key := range []string{"db-password", "prod/db/password", "team_a/api"} {
+			assert.NoError(t, check(t, policy, key), key)
+		}
+		for key, rule := range map[string]string{
+			"DB_PASSWORD":             "key 'DB_PASSWORD' does not match the key pattern",
+			"prod//password":          "does not match the key pattern",
+			"/prod/db":                "does not match the key pattern",
+			"prod/db/password/old":    "key 'prod/db/password/old' has 4 path segments (max 3)",
+			strings.Repeat("k", 65):   "key too long (max 64 characters)",
+			"prod/db/password; rm -r": "does not match the key pattern",
+		} {
+			assert.ErrorContains(t, check(t, policy, key), rule, key)
+		}
+	})
+
+	t.Run("should match the pattern against the whole key", func(t *testing.T) {
+		policy := KeyPolicy{Pattern: `app|svc`}
+		assert.NoError(t, check(t, policy, "svc"))
+		assert.Error(t, check(t, policy, "svc/db"), "an unanchored alternative must not match a prefix")
+		assert.Error(t, check(t, policy, "myapp"))
+	})
+
+	t.Run("should reject invalid policies", func(t *testing.T) {
+		assert.ErrorContains(t, KeyPolicy{Pattern: `[a-z`}.Validate(), "invalid key pattern")
+		assert.ErrorContains(t, KeyPolicy{MaxLength: -1}.Validate(), "max key length must not be negative")
+		assert.ErrorContains(t, KeyPolicy{MaxDepth: -1}.Validate(), "max key depth must not be negative")
+
+		config := DefaultConfig()
+		config.KeyPolicy.Pattern = `(`
+		_, err := NewServiceWithConfig(config)
+		assert.ErrorContains(t, err, "invalid vault config: invalid key pattern")
+	})
+
+	t.Run("should enforce the service's policy when storing and updating secrets", func(t *testing.T) {
+		db := setupTestDB(t)
+		service := NewService(StaticKeyProvider("test-password"))
+		service.SetDB(db)
+		ctx := context.Background()
+
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "Legacy_Key", Value: "v1"}))
+		require.NoError(t, service.SetKeyPolicy(KeyPolicy{Pattern: `[a-z]+(/[a-z]+)*`, MaxDepth: 2}))
+		assert.Equal(t, 2, service.KeyPolicy().MaxDepth)
+		assert.Equal(t, DefaultMaxKeyLength, service.KeyPolicy().MaxLength)
+
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "prod/db", Value: "v1"}))
+		err := service.StoreSecret(ctx, "user1", &Secret{Key: "prod/db/password", Value: "v1"})
+		assert.ErrorContains(t, err, "has 3 path segments (max 2)")
+		err = service.UpdateSecret(ctx, "user1", &Secret{Key: "Legacy_Key", Value: "v2"})
+		assert.ErrorContains(t, err, "does not match the key pattern")
+
+		secret, err := service.GetSecret(ctx, "user1", "Legacy_Key")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", secret.Value, "secrets stored before the policy can still be read")
+		assert.Error(t, service.SetKeyPolicy(KeyPolicy{Pattern: `(`}))
+		assert.Equal(t, 2, service.KeyPolicy().MaxDepth, "an invalid policy leaves the current one in place")
+	})
+}
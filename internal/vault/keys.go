@@ -0,0 +1,172 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// MasterPasswordEnv is the environment variable EnvKeyProvider reads by default
+const MasterPasswordEnv = "VERTEX_MASTER_PASSWORD"
+
+// KeyProvider supplies the master key secrets are encrypted with
+type KeyProvider interface {
+	GetMasterKey(ctx context.Context) ([]byte, error)
+}
+
+// KeyHistoryProvider is a KeyProvider that also supplies the master keys it has
+// rotated away from, so secrets written under them can still be decrypted
+type KeyHistoryProvider interface {
+	KeyProvider
+	GetPreviousKeys(ctx context.Context) ([][]byte, error)
+}
+
+// EnvKeyProvider reads the master key from an environment variable
+type EnvKeyProvider struct {
+	Variable string
+}
+
+// NewEnvKeyProvider creates a provider reading VERTEX_MASTER_PASSWORD
+func NewEnvKeyProvider() *EnvKeyProvider {
+	return &EnvKeyProvider{Variable: MasterPasswordEnv}
+}
+
+// GetMasterKey returns the variable's value, failing if it is unset or empty
+func (p *EnvKeyProvider) GetMasterKey(ctx context.Context) ([]byte, error) {
+	value := os.Getenv(p.Variable)
+	if value == "" {
+		return nil, fmt.Errorf("%s environment variable is required", p.Variable)
+	}
+	return []byte(value), nil
+}
+
+// FileKeyProvider reads the master key from a file, such as a mounted
+// Kubernetes secret. The first non-blank line is the current key and any
+// further lines are previous keys, so a key is rotated by adding a new first
+// line. The file is read on every call so a rotated key is picked up without a
+// restart.
+type FileKeyProvider struct {
+	Path string
+}
+
+// NewFileKeyProvider creates a provider reading the key from path
+func NewFileKeyProvider(path string) *FileKeyProvider {
+	return &FileKeyProvider{Path: path}
+}
+
+// GetMasterKey returns the first line of the file with surrounding whitespace removed
+func (p *FileKeyProvider) GetMasterKey(ctx context.Context) ([]byte, error) {
+	keys, err := p.readKeys()
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// GetPreviousKeys returns the remaining lines of the file
+func (p *FileKeyProvider) GetPreviousKeys(ctx context.Context) ([][]byte, error) {
+	keys, err := p.readKeys()
+	if err != nil {
+		return nil, err
+	}
+	return keys[1:], nil
+}
+
+// readKeys returns the non-blank lines of the key file, newest first
+func (p *FileKeyProvider) readKeys() ([][]byte, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+
+	var keys [][]byte
+	for _, line := range strings.Split(string(data), "\n") {
+		if key := strings.TrimSpace(line); key != "" {
+			keys = append(keys, []byte(key))
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("master key file %s is empty", p.Path)
+	}
+	return keys, nil
+}
+
+// StaticKeyProvider returns a fixed master key
+type StaticKeyProvider []byte
+
+// GetMasterKey returns the key
+func (p StaticKeyProvider) GetMasterKey(ctx context.Context) ([]byte, error) {
+	if len(p) == 0 {
+		return nil, errors.New("master key is empty")
+	}
+	return []byte(p), nil
+}
+
+// KeyRing is a fixed current master key and the keys it replaced, newest first
+type KeyRing struct {
+	Current  []byte
+	Previous [][]byte
+}
+
+// GetMasterKey returns the current key
+func (r *KeyRing) GetMasterKey(ctx context.Context) ([]byte, error) {
+	if len(r.Current) == 0 {
+		return nil, errors.New("master key is empty")
+	}
+	return r.Current, nil
+}
+
+// GetPreviousKeys returns the keys the current key replaced
+func (r *KeyRing) GetPreviousKeys(ctx context.Context) ([][]byte, error) {
+	return r.Previous, nil
+}
+
+// KMSClient decrypts data with an external key management service such as
+// AWS KMS or the HashiCorp Vault transit engine
+type KMSClient interface {
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// KMSKeyProvider keeps the master key wrapped by a KMS key and unwraps it on
+// first use. The plaintext key is cached so the KMS is called once per process.
+type KMSKeyProvider struct {
+	client       KMSClient
+	keyID        string
+	encryptedKey []byte
+
+	mu  sync.Mutex
+	key []byte
+}
+
+// NewKMSKeyProvider creates a provider unwrapping encryptedKey with the KMS key keyID
+func NewKMSKeyProvider(client KMSClient, keyID string, encryptedKey []byte) *KMSKeyProvider {
+	return &KMSKeyProvider{
+		client:       client,
+		keyID:        keyID,
+		encryptedKey: encryptedKey,
+	}
+}
+
+// GetMasterKey returns the unwrapped master key, calling the KMS if it is not cached
+func (p *KMSKeyProvider) GetMasterKey(ctx context.Context) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.key != nil {
+		return p.key, nil
+	}
+
+	key, err := p.client.Decrypt(ctx, p.keyID, p.encryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt master key with KMS key '%s': %w", p.keyID, err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("KMS key '%s' returned an empty master key", p.keyID)
+	}
+
+	p.key = key
+	return p.key, nil
+}
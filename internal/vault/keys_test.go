@@ -0,0 +1,305 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ataiva-software/vertex/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeKMS struct {
+	calls int
+	err   error
+}
+
+func (k *fakeKMS) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	k.calls++
+	if k.err != nil {
+		return nil, k.err
+	}
+	return []byte(keyID + ":" + string(ciphertext)), nil
+}
+
+func TestKeyProviders(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("env provider should read the variable", func(t *testing.T) {
+		t.Setenv("VERTEX_MASTER_PASSWORD", "env-password")
+
+		key, err := NewEnvKeyProvider().GetMasterKey(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "env-password", string(key))
+	})
+
+	t.Run("env provider should fail when the variable is unset", func(t *testing.T) {
+		t.Setenv("VERTEX_MASTER_PASSWORD", "")
+
+		_, err := NewEnvKeyProvider().GetMasterKey(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "VERTEX_MASTER_PASSWORD")
+	})
+
+	t.Run("file provider should read and trim the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "master-key")
+		require.NoError(t, os.WriteFile(path, []byte("file-password\n"), 0600))
+
+		key, err := NewFileKeyProvider(path).GetMasterKey(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "file-password", string(key))
+	})
+
+	t.Run("file provider should fail on a missing or empty file", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := NewFileKeyProvider(filepath.Join(dir, "missing")).GetMasterKey(ctx)
+		assert.Error(t, err)
+
+		path := filepath.Join(dir, "empty")
+		require.NoError(t, os.WriteFile(path, []byte(" \n"), 0600))
+		_, err = NewFileKeyProvider(path).GetMasterKey(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("KMS provider should unwrap the key once", func(t *testing.T) {
+		kms := &fakeKMS{}
+		provider := NewKMSKeyProvider(kms, "alias/vertex", []byte("wrapped"))
+
+		for i := 0; i < 2; i++ {
+			key, err := provider.GetMasterKey(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, "alias/vertex:wrapped", string(key))
+		}
+		assert.Equal(t, 1, kms.calls)
+	})
+
+	t.Run("KMS provider should surface KMS errors", func(t *testing.T) {
+		provider := NewKMSKeyProvider(&fakeKMS{err: errors.New("access denied")}, "alias/vertex", []byte("wrapped"))
+
+		_, err := provider.GetMasterKey(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "access denied")
+	})
+}
+
+func TestServiceWithKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+
+	t.Run("should encrypt with a KMS-provided key", func(t *testing.T) {
+		service := NewService(NewKMSKeyProvider(&fakeKMS{}, "alias/vertex", []byte("wrapped")))
+		service.SetDB(db)
+
+		require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "kms-secret", Value: "s3cret"}))
+		secret, err := service.GetSecret(ctx, "user", "kms-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", secret.Value)
+
+		other := NewService(StaticKeyProvider("alias/vertex:other"))
+		other.SetDB(db)
+		_, err = other.GetSecret(ctx, "user", "kms-secret")
+		assert.Error(t, err)
+	})
+
+	t.Run("should fail operations when the key is unavailable", func(t *testing.T) {
+		service := NewService(NewKMSKeyProvider(&fakeKMS{err: errors.New("unreachable")}, "alias/vertex", nil))
+		service.SetDB(db)
+
+		err := service.StoreSecret(ctx, "user", &Secret{Key: "no-key", Value: "value"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get master key")
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	ring := &KeyRing{Current: []byte("key-v1")}
+	service := NewService(ring)
+	service.SetDB(db)
+
+	storedValue := func(key string) []byte {
+		var secret Secret
+		require.NoError(t, db.Where("key = ?", key).First(&secret).Error)
+		data, err := base64.StdEncoding.DecodeString(secret.Value)
+		require.NoError(t, err)
+		return data
+	}
+	fingerprint := func(password string) []byte {
+		fp, err := service.keyFingerprint(ctx, password)
+		require.NoError(t, err)
+		return fp
+	}
+
+	require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "old-secret", Value: "old-value"}))
+	assert.Equal(t, fingerprint("key-v1"), storedValue("old-secret")[2:envelopeHeaderLength])
+
+	// Rotate to a new key version
+	ring.Current = []byte("key-v2")
+	ring.Previous = [][]byte{[]byte("key-v1")}
+
+	t.Run("should write new secrets under the current key", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "new-secret", Value: "new-value"}))
+		assert.Equal(t, fingerprint("key-v2"), storedValue("new-secret")[2:envelopeHeaderLength])
+
+		secret, err := service.GetSecret(ctx, "user", "new-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "new-value", secret.Value)
+	})
+
+	t.Run("should decrypt old secrets and re-encrypt them under the current key", func(t *testing.T) {
+		secret, err := service.GetSecret(ctx, "user", "old-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "old-value", secret.Value)
+		assert.Equal(t, fingerprint("key-v2"), storedValue("old-secret")[2:envelopeHeaderLength])
+
+		// Once re-encrypted the old key is no longer needed
+		current := NewService(StaticKeyProvider("key-v2"))
+		current.SetDB(db)
+		secret, err = current.GetSecret(ctx, "user", "old-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "old-value", secret.Value)
+	})
+
+	t.Run("should not overwrite a value changed since it was read", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "racy-secret", Value: "first"}))
+		var read Secret
+		require.NoError(t, db.Where("key = ?", "racy-secret").First(&read).Error)
+		require.NoError(t, service.UpdateSecret(ctx, "user", &Secret{Key: "racy-secret", Value: "second"}))
+
+		require.NoError(t, service.reencryptSecret(ctx, &read, []byte("first")))
+		secret, err := service.GetSecret(ctx, "user", "racy-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "second", secret.Value)
+	})
+
+	t.Run("should decrypt values written before key versioning", func(t *testing.T) {
+		encrypted, err := crypto.EncryptAES([]byte("legacy-value"), "key-v1")
+		require.NoError(t, err)
+		require.NoError(t, db.Create(&Secret{UserID: "user", Key: "legacy-secret", Value: base64.StdEncoding.EncodeToString(encrypted)}).Error)
+
+		secret, err := service.GetSecret(ctx, "user", "legacy-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "legacy-value", secret.Value)
+		assert.Equal(t, envelopeMagic, storedValue("legacy-secret")[0])
+		assert.Equal(t, fingerprint("key-v2"), storedValue("legacy-secret")[2:envelopeHeaderLength])
+	})
+
+	t.Run("should fail when no key version matches", func(t *testing.T) {
+		other := NewService(StaticKeyProvider("key-v3"))
+		other.SetDB(db)
+		_, err := other.GetSecret(ctx, "user", "new-secret")
+		assert.Error(t, err)
+	})
+
+	t.Run("file provider should supply previous keys", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "master-key")
+		require.NoError(t, os.WriteFile(path, []byte("key-v3\nkey-v2\n"), 0600))
+
+		rotated := NewService(NewFileKeyProvider(path))
+		rotated.SetDB(db)
+		secret, err := rotated.GetSecret(ctx, "user", "new-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "new-value", secret.Value)
+	})
+}
+
+func TestPerUserKeys(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+
+	storedSecret := func(key string) *Secret {
+		var secret Secret
+		require.NoError(t, db.Where("key = ?", key).First(&secret).Error)
+		return &secret
+	}
+
+	require.NoError(t, service.StoreSecret(ctx, "alice", &Secret{Key: "alice-token", Value: "alice-value"}))
+	require.NoError(t, service.StoreSecret(ctx, "bob", &Secret{Key: "bob-token", Value: "bob-value"}))
+
+	t.Run("should record the derivation info, not the key, with the ciphertext", func(t *testing.T) {
+		data, err := base64.StdEncoding.DecodeString(storedSecret("alice-token").Value)
+		require.NoError(t, err)
+
+		env, ok := parseEnvelope(data)
+		require.True(t, ok)
+		assert.Equal(t, envelopeVersionUserKey, env.version)
+		assert.Equal(t, userKeyInfo("alice"), env.info)
+
+		rootKey, err := service.rootKey(ctx, "master")
+		require.NoError(t, err)
+		key, err := userKey(rootKey, env.info)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), string(key))
+
+		// The derived key encrypts the value directly, without a password salt
+		plaintext, err := crypto.DecryptWithKey(env.ciphertext, key)
+		require.NoError(t, err)
+		assert.Equal(t, "alice-value", string(plaintext))
+	})
+
+	t.Run("should stretch the master key before deriving user keys", func(t *testing.T) {
+		data, err := base64.StdEncoding.DecodeString(storedSecret("alice-token").Value)
+		require.NoError(t, err)
+		env, ok := parseEnvelope(data)
+		require.True(t, ok)
+
+		// HKDF over the bare password would make guessing it cheap
+		bareKey, err := crypto.DeriveSubkey([]byte("master"), env.info)
+		require.NoError(t, err)
+		_, err = crypto.DecryptWithKey(env.ciphertext, bareKey)
+		assert.Error(t, err)
+
+		var salt KeySalt
+		require.NoError(t, db.First(&salt).Error)
+		rootKey, err := crypto.DeriveKey("master", salt.Salt)
+		require.NoError(t, err)
+		key, err := crypto.DeriveSubkey(rootKey, env.info)
+		require.NoError(t, err)
+		plaintext, err := crypto.DecryptWithKey(env.ciphertext, key)
+		require.NoError(t, err)
+		assert.Equal(t, "alice-value", string(plaintext))
+	})
+
+	t.Run("should salt key fingerprints per install", func(t *testing.T) {
+		other := NewService(StaticKeyProvider("master"))
+		other.SetDB(setupTestDB(t))
+		ours, err := service.keyFingerprint(ctx, "master")
+		require.NoError(t, err)
+		theirs, err := other.keyFingerprint(ctx, "master")
+		require.NoError(t, err)
+		assert.NotEqual(t, ours, theirs)
+	})
+
+	t.Run("should not decrypt one user's ciphertext as another user's", func(t *testing.T) {
+		aliceValue := storedSecret("alice-token").Value
+
+		_, _, err := service.decryptValue(ctx, "bob", aliceValue)
+		assert.ErrorContains(t, err, "different user")
+
+		// Moving the ciphertext into bob's secret does not expose it to bob
+		require.NoError(t, db.Model(&Secret{}).Where("key = ?", "bob-token").Update("value", aliceValue).Error)
+		_, err = service.GetSecret(ctx, "bob", "bob-token")
+		assert.Error(t, err)
+	})
+
+	t.Run("should not decrypt under another user's derived key even with a forged header", func(t *testing.T) {
+		data, err := base64.StdEncoding.DecodeString(storedSecret("alice-token").Value)
+		require.NoError(t, err)
+		env, ok := parseEnvelope(data)
+		require.True(t, ok)
+
+		rootKey, err := service.rootKey(ctx, "master")
+		require.NoError(t, err)
+		bobKey, err := userKey(rootKey, userKeyInfo("bob"))
+		require.NoError(t, err)
+		_, err = crypto.DecryptWithKey(env.ciphertext, bobKey)
+		assert.Error(t, err)
+	})
+}
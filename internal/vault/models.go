@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -40,9 +41,14 @@ func (s StringSlice) Value() (driver.Value, error) {
 // Secret represents a stored secret
 type Secret struct {
 	ID          uint        `json:"id" gorm:"primaryKey"`
-	UserID      string      `json:"user_id" gorm:"index;not null"`
-	Key         string      `json:"key" gorm:"not null"`
+	UserID      string      `json:"user_id" gorm:"index;uniqueIndex:idx_secrets_user_key,priority:1,where:deleted_at IS NULL;not null"`
+	Key         string      `json:"key" gorm:"uniqueIndex:idx_secrets_user_key,priority:2,where:deleted_at IS NULL;not null"` // unique among the user's live secrets
 	Value       string      `json:"value,omitempty" gorm:"not null"` // Encrypted
+	KeyVersion  string      `json:"key_version" gorm:"index"` // Fingerprint of the master key Value is encrypted under
+	Version     int         `json:"version" gorm:"not null;default:1"` // Incremented by every change to Value
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty" gorm:"index"` // Unset for secrets that never expire
+	// TTL sets ExpiresAt relative to when the secret is stored or updated
+	TTL time.Duration `json:"ttl,omitempty" gorm:"-"`
 	Description string      `json:"description"`
 	Tags        StringSlice `json:"tags" gorm:"type:text"`
 	CreatedAt   time.Time   `json:"created_at"`
@@ -55,13 +61,76 @@ func (Secret) TableName() string {
 	return "secrets"
 }
 
+// MigrateSchema drops the unique index that made keys unique across all users,
+// which idx_secrets_user_key replaces. It runs after AutoMigrate.
+func (s *Service) MigrateSchema(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&Secret{}, "idx_secrets_key") {
+		if err := db.Migrator().DropIndex(&Secret{}, "idx_secrets_key"); err != nil {
+			return fmt.Errorf("failed to drop index idx_secrets_key: %w", err)
+		}
+	}
+	return nil
+}
+
+// secretMetadataColumns are every secrets column except the encrypted value
+var secretMetadataColumns = []string{"id", "user_id", "key", "key_version", "version", "expires_at", "description", "tags", "created_at", "updated_at", "deleted_at"}
+
+// secretMetadata is a query scope that loads secrets without their encrypted
+// values. Queries that do not decrypt a secret should use it so large values
+// are never read.
+func secretMetadata(db *gorm.DB) *gorm.DB {
+	return db.Model(&Secret{}).Select(secretMetadataColumns)
+}
+
+// SecretVersion is a value a secret held before it was changed
+type SecretVersion struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	SecretID   uint      `json:"secret_id" gorm:"uniqueIndex:idx_secret_versions_version;not null"`
+	Version    int       `json:"version" gorm:"uniqueIndex:idx_secret_versions_version;not null"`
+	Value      string    `json:"-" gorm:"not null"` // Encrypted
+	KeyVersion string    `json:"key_version" gorm:"index"`
+	CreatedAt  time.Time `json:"created_at"` // When the value was replaced
+}
+
+// TableName returns the table name for the SecretVersion model
+func (SecretVersion) TableName() string {
+	return "secret_versions"
+}
+
+// SecretGrant lets a user other than a secret's owner read it
+type SecretGrant struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SecretID  uint      `json:"secret_id" gorm:"uniqueIndex:idx_secret_grants_grantee;not null"`
+	GranteeID string    `json:"grantee_id" gorm:"uniqueIndex:idx_secret_grants_grantee;index;not null"`
+	GrantedBy string    `json:"granted_by" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the SecretGrant model
+func (SecretGrant) TableName() string {
+	return "secret_grants"
+}
+
+// SecretVersionItem describes one version of a secret (without its value)
+type SecretVersionItem struct {
+	Version    int       `json:"version"`
+	KeyVersion string    `json:"key_version"`
+	Current    bool      `json:"current"`
+	// CreatedAt is when the version was replaced, or for the current version
+	// when the secret was last updated
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // SecretListItem represents a secret in list operations (without value)
 type SecretListItem struct {
+	Owner       string      `json:"owner"` // Tells apart secrets granted under the same key
 	Key         string      `json:"key"`
 	Description string      `json:"description"`
 	Tags        StringSlice `json:"tags"`
 	CreatedAt   time.Time   `json:"created_at"`
 	UpdatedAt   time.Time   `json:"updated_at"`
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
+	Expired     bool        `json:"expired"`
 }
 
 // AuditLog represents an audit log entry for secret operations
@@ -69,7 +138,7 @@ type AuditLog struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	UserID    string    `json:"user_id" gorm:"index;not null"`
 	SecretKey string    `json:"secret_key" gorm:"not null"`
-	Action    string    `json:"action" gorm:"not null"` // CREATE, READ, UPDATE, DELETE
+	Action    string    `json:"action" gorm:"not null"` // CREATE, READ, UPDATE, UPDATE_METADATA, DELETE, REENCRYPT, ROTATE, READ_VERSION, ROLLBACK, GRANT, REVOKE, EXPIRE
 	IPAddress string    `json:"ip_address"`
 	UserAgent string    `json:"user_agent"`
 	CreatedAt time.Time `json:"created_at"`
@@ -79,3 +148,16 @@ type AuditLog struct {
 func (AuditLog) TableName() string {
 	return "audit_logs"
 }
+
+// KeySalt is the random salt master keys are stretched with. One is generated
+// per install the first time a secret is encrypted.
+type KeySalt struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Salt      []byte    `json:"-" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the KeySalt model
+func (KeySalt) TableName() string {
+	return "vault_key_salts"
+}
@@ -0,0 +1,193 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// rotationBatchSize is how many secrets RotateMasterPassword re-encrypts per transaction
+var rotationBatchSize = 100
+
+// ErrWrongMasterPassword is returned by RotateMasterPassword when the old
+// password is not the master password secrets are encrypted under
+var ErrWrongMasterPassword = errors.New("old password does not match the master password")
+
+// RotateMasterPassword re-encrypts every secret, deleted ones and previous
+// versions included, under newPassword and makes it the master password,
+// returning how many values were re-encrypted. An interrupted rotation resumes
+// when called again with the same passwords. The configured key source must
+// supply newPassword by the next restart.
+func (s *Service) RotateMasterPassword(ctx context.Context, oldPassword, newPassword string) (int, error) {
+	if oldPassword == "" || newPassword == "" {
+		return 0, errors.New("old and new passwords are required")
+	}
+	if oldPassword == newPassword {
+		return 0, errors.New("new password must differ from the old one")
+	}
+
+	s.rotateMu.Lock()
+	defer s.rotateMu.Unlock()
+
+	newVersion, err := s.keyVersion(ctx, newPassword)
+	if err != nil {
+		return 0, err
+	}
+	// Switching keys on a wrong password would leave later writes unreadable.
+	// When resuming, oldPassword may no longer be current, so it is checked
+	// against a secret not yet rotated instead.
+	if err := s.checkOldPassword(ctx, oldPassword, newVersion); err != nil {
+		return 0, err
+	}
+	// Writes use newPassword from here on, while oldPassword and the
+	// provider's keys still decrypt secrets not yet rotated. The provider is
+	// replaced until the next restart.
+	s.setKeyProvider(&KeyRing{
+		Current:  []byte(newPassword),
+		Previous: s.previousKeys(ctx, oldPassword, newPassword),
+	})
+
+	// Each batch is its own transaction and values already under newVersion
+	// are skipped, so an interrupted rotation picks up where it stopped.
+	// Values are decrypted with oldPassword alone; one it cannot decrypt stops
+	// the rotation.
+	secrets, err := s.rotateValues(ctx, &Secret{}, oldPassword, newPassword, func(tx *gorm.DB, lastID uint) ([]rotatedValue, error) {
+		var batch []rotatedValue
+		err := tx.Unscoped().Model(&Secret{}).
+			Select("id, user_id, key, value").
+			Where("id > ? AND (key_version IS NULL OR key_version <> ?)", lastID, newVersion).
+			Order("id").
+			Limit(rotationBatchSize).
+			Find(&batch).Error
+		return batch, err
+	})
+	if err != nil {
+		return secrets, err
+	}
+
+	versions, err := s.rotateValues(ctx, &SecretVersion{}, oldPassword, newPassword, func(tx *gorm.DB, lastID uint) ([]rotatedValue, error) {
+		var batch []rotatedValue
+		err := tx.Table("secret_versions").
+			Select("secret_versions.id, secrets.user_id, secrets.key, secret_versions.value").
+			Joins("JOIN secrets ON secrets.id = secret_versions.secret_id").
+			Where("secret_versions.id > ?", lastID).
+			Where("secret_versions.key_version IS NULL OR secret_versions.key_version <> ?", newVersion).
+			Order("secret_versions.id").
+			Limit(rotationBatchSize).
+			Find(&batch).Error
+		return batch, err
+	})
+	return secrets + versions, err
+}
+
+// checkOldPassword returns ErrWrongMasterPassword unless oldPassword is the
+// current master password or decrypts a secret not yet under newVersion
+func (s *Service) checkOldPassword(ctx context.Context, oldPassword, newVersion string) error {
+	if current, err := s.masterKey(ctx); err == nil && subtle.ConstantTimeCompare([]byte(current), []byte(oldPassword)) == 1 {
+		return nil
+	}
+
+	var pending rotatedValue
+	err := s.db.WithContext(ctx).Unscoped().Model(&Secret{}).
+		Select("id, user_id, key, value").
+		Where("key_version IS NULL OR key_version <> ?", newVersion).
+		Order("id").
+		Limit(1).
+		Find(&pending).Error
+	if err != nil {
+		return fmt.Errorf("failed to find a secret to check the old password with: %w", err)
+	}
+	if pending.ID != 0 {
+		if _, _, err := s.decryptWithKeys(ctx, pending.UserID, pending.Value, []string{oldPassword}); err == nil {
+			return nil
+		}
+	}
+	return ErrWrongMasterPassword
+}
+
+// rotatedValue is an encrypted value to re-encrypt, with the secret it belongs to
+type rotatedValue struct {
+	ID     uint
+	UserID string
+	Key    string
+	Value  string
+}
+
+// rotateValues re-encrypts the values in model's table under newPassword, one
+// transaction per batch returned by load, until load returns none. Rotated
+// secrets are audited. It returns how many values were re-encrypted.
+func (s *Service) rotateValues(ctx context.Context, model interface{}, oldPassword, newPassword string, load func(tx *gorm.DB, lastID uint) ([]rotatedValue, error)) (int, error) {
+	_, isSecret := model.(*Secret)
+	rotated := 0
+	var lastID uint
+	for {
+		var batch, updated []rotatedValue
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			if batch, err = load(tx, lastID); err != nil {
+				return fmt.Errorf("failed to list secrets: %w", err)
+			}
+
+			for _, secret := range batch {
+				plaintext, _, err := s.decryptWithKeys(ctx, secret.UserID, secret.Value, []string{oldPassword})
+				if err != nil {
+					return fmt.Errorf("failed to rotate secret '%s': %w", secret.Key, err)
+				}
+				value, keyVersion, err := s.encryptWithKey(ctx, newPassword, secret.UserID, plaintext)
+				if err != nil {
+					return fmt.Errorf("failed to rotate secret '%s': %w", secret.Key, err)
+				}
+				// A value changed since it was read was written under newPassword, so
+				// only the value read is replaced. Rewriting the value is not a change
+				// to the secret, so leave updated_at alone.
+				result := tx.Unscoped().Model(model).Where("id = ? AND value = ?", secret.ID, secret.Value).
+					UpdateColumns(map[string]interface{}{"value": value, "key_version": keyVersion})
+				if result.Error != nil {
+					return fmt.Errorf("failed to update secret '%s': %w", secret.Key, result.Error)
+				}
+				if result.RowsAffected == 1 {
+					updated = append(updated, secret)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return rotated, err
+		}
+		if len(batch) == 0 {
+			return rotated, nil
+		}
+
+		if isSecret {
+			for _, secret := range updated {
+				s.logOperation(ctx, secret.UserID, secret.Key, "ROTATE")
+			}
+		}
+		rotated += len(updated)
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// previousKeys lists the keys to keep decrypting with after switching to
+// newPassword: oldPassword, then the current provider's keys, if available
+func (s *Service) previousKeys(ctx context.Context, oldPassword, newPassword string) [][]byte {
+	previous := [][]byte{[]byte(oldPassword)}
+	keys, err := s.masterKeys(ctx)
+	if err != nil {
+		return previous
+	}
+	for _, key := range keys {
+		seen := key == newPassword
+		for _, kept := range previous {
+			seen = seen || bytes.Equal(kept, []byte(key))
+		}
+		if !seen {
+			previous = append(previous, []byte(key))
+		}
+	}
+	return previous
+}
@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRotateMasterPassword(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, count int) (*gorm.DB, *Service) {
+		db := setupTestDB(t)
+		service := NewService(StaticKeyProvider("old-password"))
+		service.SetDB(db)
+		for i := 0; i < count; i++ {
+			secret := &Secret{Key: fmt.Sprintf("secret-%d", i), Value: fmt.Sprintf("value-%d", i)}
+			require.NoError(t, service.StoreSecret(ctx, "user", secret))
+		}
+		return db, service
+	}
+	keyVersions := func(t *testing.T, db *gorm.DB) map[string]string {
+		var secrets []Secret
+		require.NoError(t, db.Unscoped().Order("id").Find(&secrets).Error)
+		versions := make(map[string]string, len(secrets))
+		for _, secret := range secrets {
+			versions[secret.Key] = secret.KeyVersion
+		}
+		return versions
+	}
+
+	t.Run("should record the key version of each secret", func(t *testing.T) {
+		db, service := setup(t, 1)
+		version, err := service.keyVersion(ctx, "old-password")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"secret-0": version}, keyVersions(t, db))
+	})
+
+	t.Run("should re-encrypt every secret under the new password", func(t *testing.T) {
+		db, service := setup(t, 3)
+		require.NoError(t, service.DeleteSecret(ctx, "user", "secret-2"))
+
+		rotated, err := service.RotateMasterPassword(ctx, "old-password", "new-password")
+		require.NoError(t, err)
+		assert.Equal(t, 3, rotated)
+
+		version, err := service.keyVersion(ctx, "new-password")
+		require.NoError(t, err)
+		for _, keyVersion := range keyVersions(t, db) {
+			assert.Equal(t, version, keyVersion)
+		}
+
+		current := NewService(StaticKeyProvider("new-password"))
+		current.SetDB(db)
+		secret, err := current.GetSecret(ctx, "user", "secret-1")
+		require.NoError(t, err)
+		assert.Equal(t, "value-1", secret.Value)
+
+		old := NewService(StaticKeyProvider("old-password"))
+		old.SetDB(db)
+		_, err = old.GetSecret(ctx, "user", "secret-1")
+		assert.Error(t, err)
+
+		// The service itself now writes under the new password
+		require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "later", Value: "later-value"}))
+		assert.Equal(t, version, keyVersions(t, db)["later"])
+
+		var entries int64
+		require.NoError(t, db.Model(&AuditLog{}).Where("action = ?", "ROTATE").Count(&entries).Error)
+		assert.Equal(t, int64(3), entries)
+	})
+
+	t.Run("should roll back a batch containing a secret the old password cannot decrypt", func(t *testing.T) {
+		db, service := setup(t, 2)
+		other := NewService(StaticKeyProvider("other-password"))
+		other.SetDB(db)
+		require.NoError(t, other.StoreSecret(ctx, "user", &Secret{Key: "foreign", Value: "foreign-value"}))
+		before := keyVersions(t, db)
+
+		rotated, err := service.RotateMasterPassword(ctx, "old-password", "new-password")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "foreign")
+		assert.Zero(t, rotated)
+		assert.Equal(t, before, keyVersions(t, db))
+	})
+
+	t.Run("should resume an interrupted rotation", func(t *testing.T) {
+		previous := rotationBatchSize
+		rotationBatchSize = 1
+		defer func() { rotationBatchSize = previous }()
+
+		db, service := setup(t, 3)
+		var last Secret
+		require.NoError(t, db.Where("key = ?", "secret-2").First(&last).Error)
+		original := last.Value
+		require.NoError(t, db.Model(&last).UpdateColumn("value", "corrupted").Error)
+
+		rotated, err := service.RotateMasterPassword(ctx, "old-password", "new-password")
+		require.Error(t, err)
+		assert.Equal(t, 2, rotated)
+
+		require.NoError(t, db.Model(&last).UpdateColumn("value", original).Error)
+		rotated, err = service.RotateMasterPassword(ctx, "old-password", "new-password")
+		require.NoError(t, err)
+		assert.Equal(t, 1, rotated)
+
+		current := NewService(StaticKeyProvider("new-password"))
+		current.SetDB(db)
+		for i := 0; i < 3; i++ {
+			secret, err := current.GetSecret(ctx, "user", fmt.Sprintf("secret-%d", i))
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("value-%d", i), secret.Value)
+		}
+	})
+
+	t.Run("should reject a wrong old password without switching keys", func(t *testing.T) {
+		db, service := setup(t, 1)
+		before := keyVersions(t, db)
+
+		_, err := service.RotateMasterPassword(ctx, "wrong-password", "new-password")
+		assert.ErrorIs(t, err, ErrWrongMasterPassword)
+		assert.Equal(t, before, keyVersions(t, db))
+
+		// Writes still use the old password, so they stay readable after a restart
+		require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "later", Value: "later-value"}))
+		restarted := NewService(StaticKeyProvider("old-password"))
+		restarted.SetDB(db)
+		secret, err := restarted.GetSecret(ctx, "user", "later")
+		require.NoError(t, err)
+		assert.Equal(t, "later-value", secret.Value)
+	})
+
+	t.Run("should reject missing or unchanged passwords", func(t *testing.T) {
+		_, service := setup(t, 0)
+		_, err := service.RotateMasterPassword(ctx, "", "new-password")
+		assert.Error(t, err)
+		_, err = service.RotateMasterPassword(ctx, "old-password", "old-password")
+		assert.Error(t, err)
+	})
+}
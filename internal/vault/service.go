@@ -2,31 +2,49 @@ package vault
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/ataiva-software/vertex/pkg/crypto"
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/ataiva-software/vertex/pkg/database"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrAmbiguousSecret is returned when reading a key granted to the user by
+// several owners without naming which one
+var ErrAmbiguousSecret = errors.New("granted by several owners; name the owner")
+
 // Service provides vault operations
 type Service struct {
 	db       *gorm.DB
-	password string // Master password for encryption
+	keysMu   sync.RWMutex
+	keys     KeyProvider // Supplies the master key for encryption
+	rotateMu sync.Mutex  // Serializes master password rotations
+	reads    singleflight.Group
+	rootKeys sync.Map // Master key -> root key stretched from it
+	saltMu   sync.Mutex
+	salt     []byte // Salt root keys are stretched with, loaded once
+	// scheduler runs the purge of expired secrets every purgeInterval
+	scheduler     *core.Scheduler
+	purgeInterval time.Duration
+	// events announces audit entries to services reporting on them
+	events *core.EventBus
+	// keyRules enforces the key policy; nil means DefaultKeyPolicy
+	keyRules atomic.Pointer[keyRules]
 }
 
-// NewService creates a new vault service
-func NewService() *Service {
-	password := os.Getenv("VERTEX_MASTER_PASSWORD")
-	if password == "" {
-		log.Fatal("VERTEX_MASTER_PASSWORD environment variable is required")
-	}
+// NewService creates a new vault service encrypting with the provider's master key
+func NewService(keys KeyProvider) *Service {
 	return &Service{
-		password: password,
+		keys:          keys,
+		purgeInterval: DefaultPurgeInterval,
 	}
 }
 
@@ -35,9 +53,41 @@ func (s *Service) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+// SetEventBus sets the bus written audit entries are announced on
+func (s *Service) SetEventBus(bus *core.EventBus) {
+	s.events = bus
+}
+
+// CheckHealth reports whether the secrets database is reachable
+func (s *Service) CheckHealth(ctx context.Context) *core.HealthStatus {
+	return database.CheckConnection(ctx, s.db)
+}
+
 // SetMasterPassword sets the master password for encryption
 func (s *Service) SetMasterPassword(password string) {
-	s.password = password
+	s.setKeyProvider(StaticKeyProvider(password))
+}
+
+func (s *Service) setKeyProvider(keys KeyProvider) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.keys = keys
+}
+
+// keyProvider returns the provider supplying the master key
+func (s *Service) keyProvider() KeyProvider {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	return s.keys
+}
+
+// masterKey fetches the master key from the key provider
+func (s *Service) masterKey(ctx context.Context) (string, error) {
+	key, err := s.keyProvider().GetMasterKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get master key: %w", err)
+	}
+	return string(key), nil
 }
 
 // StoreSecret stores a new secret
@@ -46,9 +96,9 @@ func (s *Service) StoreSecret(ctx context.Context, userID string, secret *Secret
 		return err
 	}
 
-	// Check if secret already exists (globally, not per user)
+	// Keys are unique per user, so other users' keys are neither seen nor taken
 	var existing Secret
-	err := s.db.Where("key = ?", secret.Key).First(&existing).Error
+	err := s.db.Scopes(secretMetadata).Where("key = ? AND user_id = ?", secret.Key, userID).First(&existing).Error
 	if err == nil {
 		return fmt.Errorf("secret with key '%s' already exists", secret.Key)
 	}
@@ -56,17 +106,25 @@ func (s *Service) StoreSecret(ctx context.Context, userID string, secret *Secret
 		return fmt.Errorf("failed to check existing secret: %w", err)
 	}
 
+	expiresAt, err := secretExpiry(secret, time.Now())
+	if err != nil {
+		return err
+	}
+
 	// Encrypt the value
-	encryptedValue, err := crypto.EncryptAES([]byte(secret.Value), s.password)
+	encryptedValue, keyVersion, err := s.encryptValue(ctx, userID, []byte(secret.Value))
 	if err != nil {
-		return fmt.Errorf("failed to encrypt secret: %w", err)
+		return err
 	}
 
 	// Create new secret record
 	newSecret := &Secret{
 		UserID:      userID,
 		Key:         secret.Key,
-		Value:       base64.StdEncoding.EncodeToString(encryptedValue),
+		Value:       encryptedValue,
+		KeyVersion:  keyVersion,
+		Version:     1,
+		ExpiresAt:   expiresAt,
 		Description: secret.Description,
 		Tags:        StringSlice(secret.Tags),
 	}
@@ -76,126 +134,380 @@ func (s *Service) StoreSecret(ctx context.Context, userID string, secret *Secret
 	}
 
 	// Log the operation
-	s.logOperation(userID, secret.Key, "CREATE", "", "")
+	s.logOperation(ctx, userID, secret.Key, "CREATE")
 
 	return nil
 }
 
-// GetSecret retrieves a secret by key
+// GetSecret retrieves a secret by key. Only its owner and the users it has
+// been granted to can read it; to anyone else it is not found. A secret past
+// its expiry fails with ErrSecretExpired until it is purged or updated.
+//
+// The user's own secret shadows ones granted to them under the same key. A key
+// granted by several owners fails with ErrAmbiguousSecret; read it with
+// GetSharedSecret instead.
 func (s *Service) GetSecret(ctx context.Context, userID, key string) (*Secret, error) {
+	return s.readSecret(ctx, userID, "", key)
+}
+
+// GetSharedSecret retrieves the secret an owner stored under a key, if the
+// user is that owner or has been granted it
+func (s *Service) GetSharedSecret(ctx context.Context, userID, ownerID, key string) (*Secret, error) {
+	if ownerID == "" {
+		return nil, errors.New("owner is required")
+	}
+	return s.readSecret(ctx, userID, ownerID, key)
+}
+
+// readSecret reads a secret the user can see, owned by ownerID unless it is
+// empty
+func (s *Service) readSecret(ctx context.Context, userID, ownerID, key string) (*Secret, error) {
+	// Concurrent reads of the same secret by the same user share one lookup and
+	// one key derivation; each caller still gets its own copy and audit entry.
+	// The shared load ignores cancellation, so one caller giving up does not
+	// fail the others; each stops waiting when its own context is done.
+	shared := s.reads.DoChan(fmt.Sprintf("%q %q %q", userID, ownerID, key), func() (interface{}, error) {
+		return s.loadSecret(context.WithoutCancel(ctx), userID, ownerID, key)
+	})
+	var result singleflight.Result
+	select {
+	case result = <-shared:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	secret := *result.Val.(*Secret)
+	secret.Tags = append(make(StringSlice, 0, len(secret.Tags)), secret.Tags...)
+
+	// Log the operation
+	s.logOperation(ctx, userID, key, "READ")
+
+	return &secret, nil
+}
+
+// GetUserSecret retrieves a secret by key only if it belongs to the user. It is
+// for services reading secrets on a user's behalf; a secret owned by someone
+// else is reported as not found, even if it was granted to the user.
+func (s *Service) GetUserSecret(ctx context.Context, userID, key string) (*Secret, error) {
+	secret, err := s.GetSecret(ctx, userID, key)
+	if err != nil {
+		return nil, err
+	}
+	if secret.UserID != userID {
+		return nil, fmt.Errorf("secret '%s' not found", key)
+	}
+	return secret, nil
+}
+
+// visibleTo is a query scope limiting secrets to those the user owns or has
+// been granted
+func visibleTo(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(user_id = ? OR id IN (SELECT secret_id FROM secret_grants WHERE grantee_id = ?))", userID, userID)
+	}
+}
+
+// ownedSecret retrieves the metadata of a secret the user owns
+func (s *Service) ownedSecret(ctx context.Context, userID, key string) (*Secret, error) {
 	var secret Secret
-	err := s.db.Where("key = ?", key).First(&secret).Error
+	err := s.db.WithContext(ctx).Scopes(secretMetadata).Where("key = ? AND user_id = ?", key, userID).First(&secret).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("secret '%s' not found", key)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find secret: %w", err)
+	}
+	return &secret, nil
+}
+
+// loadSecret retrieves and decrypts a secret the user can read, owned by
+// ownerID unless it is empty
+func (s *Service) loadSecret(ctx context.Context, userID, ownerID, key string) (*Secret, error) {
+	query := s.db.Scopes(visibleTo(userID)).Where("key = ?", key)
+	if ownerID != "" {
+		query = query.Where("user_id = ?", ownerID)
+	}
+	// The user's own secret shadows ones shared with them under the same key,
+	// so a second row only matters when neither is the user's
+	var secrets []Secret
+	err := query.
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "CASE WHEN user_id = ? THEN 0 ELSE 1 END, id", Vars: []interface{}{userID}}}).
+		Limit(2).Find(&secrets).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
 	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("secret '%s' not found", key)
+	}
+	if len(secrets) > 1 && secrets[0].UserID != userID {
+		return nil, fmt.Errorf("secret '%s': %w", key, ErrAmbiguousSecret)
+	}
+	secret := secrets[0]
+	if secret.expired(time.Now()) {
+		return nil, fmt.Errorf("secret '%s': %w", key, ErrSecretExpired)
+	}
 
 	// Decrypt the value
-	encryptedBytes, err := base64.StdEncoding.DecodeString(secret.Value)
+	decryptedValue, stale, err := s.decryptValue(ctx, secret.UserID, secret.Value)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode secret: %w", err)
+		return nil, err
 	}
-	
-	decryptedValue, err := crypto.DecryptAES(encryptedBytes, s.password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+
+	// Move secrets written under a previous master key to the current one
+	if stale {
+		if err := s.reencryptSecret(ctx, &secret, decryptedValue); err != nil {
+			log.Printf("⚠️  Failed to re-encrypt secret '%s' under the current master key: %v", secret.Key, err)
+		}
 	}
 
 	secret.Value = string(decryptedValue)
-
-	// Log the operation
-	s.logOperation(userID, key, "READ", "", "")
-
 	return &secret, nil
 }
 
-// ListSecrets returns a list of all secrets (without values)
+// reencryptSecret stores a secret's value encrypted under the current master
+// key, unless the value has changed since secret was read
+func (s *Service) reencryptSecret(ctx context.Context, secret *Secret, plaintext []byte) error {
+	value, keyVersion, err := s.encryptValue(ctx, secret.UserID, plaintext)
+	if err != nil {
+		return err
+	}
+	// A value changed since it was read was written under the current key, so
+	// only the value read is replaced: no rows changing means there is nothing
+	// left to do. Rewriting the value is not a change to the secret, so leave
+	// updated_at alone.
+	err = s.db.WithContext(ctx).Model(&Secret{}).Where("id = ? AND value = ?", secret.ID, secret.Value).
+		UpdateColumns(map[string]interface{}{"value": value, "key_version": keyVersion}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update secret: %w", err)
+	}
+	return nil
+}
+
+// ListSecrets returns the secrets the user owns or has been granted (without
+// values), flagging those past their expiry
 func (s *Service) ListSecrets(ctx context.Context, userID string) ([]*SecretListItem, error) {
 	var secrets []Secret
-	err := s.db.Select("key, description, tags, created_at, updated_at").
-		Find(&secrets).Error
+	err := s.db.WithContext(ctx).Scopes(secretMetadata, visibleTo(userID)).Find(&secrets).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to list secrets: %w", err)
 	}
 
+	return secretListItems(secrets), nil
+}
+
+// ListSecretsPage returns one page of the secrets the user can read, reading
+// only that page from the store
+func (s *Service) ListSecretsPage(ctx context.Context, userID string, request core.PageRequest) (*core.Page[*SecretListItem], error) {
+	secrets, err := database.Paginate[Secret](s.db.WithContext(ctx).Scopes(secretMetadata, visibleTo(userID)).Order("id"), request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	return &core.Page[*SecretListItem]{Items: secretListItems(secrets.Items), Page: secrets.Page, PageSize: secrets.PageSize, Total: secrets.Total}, nil
+}
+
+func secretListItems(secrets []Secret) []*SecretListItem {
+	now := time.Now()
 	items := make([]*SecretListItem, len(secrets))
 	for i, secret := range secrets {
 		items[i] = &SecretListItem{
+			Owner:       secret.UserID,
 			Key:         secret.Key,
 			Description: secret.Description,
 			Tags:        secret.Tags,
 			CreatedAt:   secret.CreatedAt,
 			UpdatedAt:   secret.UpdatedAt,
+			ExpiresAt:   secret.ExpiresAt,
+			Expired:     secret.expired(now),
 		}
 	}
+	return items
+}
 
-	return items, nil
+// Count returns how many secrets a user has. Secrets have no status, so
+// GroupByStatus is ignored.
+func (s *Service) Count(ctx context.Context, userID string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	query := s.db.WithContext(ctx).Model(&Secret{}).Where("user_id = ?", userID)
+	return database.CountRows(query, core.ResourceTypeSecret, filters...)
 }
 
-// UpdateSecret updates an existing secret
+// UpdateSecret updates a secret the user owns, keeping the value it replaces
+// as a previous version
 func (s *Service) UpdateSecret(ctx context.Context, userID string, secret *Secret) error {
 	if err := s.validateSecret(secret); err != nil {
 		return err
 	}
 
-	// Check if secret exists (globally)
-	var existing Secret
-	err := s.db.Where("key = ?", secret.Key).First(&existing).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("secret '%s' not found", secret.Key)
+	existing, err := s.ownedSecret(ctx, userID, secret.Key)
+	if err != nil {
+		return err
 	}
+	expiresAt, err := secretExpiry(secret, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to find secret: %w", err)
+		return err
 	}
 
-	// Encrypt the new value
-	encryptedValue, err := crypto.EncryptAES([]byte(secret.Value), s.password)
+	// Encrypt the new value under the owner's key
+	encryptedValue, keyVersion, err := s.encryptValue(ctx, existing.UserID, []byte(secret.Value))
 	if err != nil {
-		return fmt.Errorf("failed to encrypt secret: %w", err)
+		return err
 	}
 
-	// Update the secret
+	// Update the secret, keeping the value it replaces as a version
 	updates := map[string]interface{}{
-		"value":       base64.StdEncoding.EncodeToString(encryptedValue),
+		"value":       encryptedValue,
+		"key_version": keyVersion,
+		"expires_at":  expiresAt,
 		"description": secret.Description,
 		"tags":        StringSlice(secret.Tags),
 	}
 
-	if err := s.db.Model(&existing).Updates(updates).Error; err != nil {
-		return fmt.Errorf("failed to update secret: %w", err)
+	matched, err := s.updateVersioned(ctx, updates, "id = ?", existing.ID)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return fmt.Errorf("secret '%s' not found", secret.Key)
 	}
 
 	// Log the operation
-	s.logOperation(userID, secret.Key, "UPDATE", "", "")
+	s.logOperation(ctx, userID, secret.Key, "UPDATE")
 
 	return nil
 }
 
-// DeleteSecret deletes a secret
-func (s *Service) DeleteSecret(ctx context.Context, userID, key string) error {
-	// Check if secret exists (globally)
-	var secret Secret
-	err := s.db.Where("key = ?", key).First(&secret).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("secret '%s' not found", key)
+// UpsertSecret stores a secret, creating it if the user has no secret with its
+// key and updating it otherwise, and reports whether it was created. The insert
+// relies on the unique index on each user's live keys, so concurrent upserts of
+// the same key never create duplicates: all but one of them update the secret
+// the winner created.
+func (s *Service) UpsertSecret(ctx context.Context, userID string, secret *Secret) (bool, error) {
+	if err := s.validateSecret(secret); err != nil {
+		return false, err
+	}
+
+	expiresAt, err := secretExpiry(secret, time.Now())
+	if err != nil {
+		return false, err
 	}
+	encryptedValue, keyVersion, err := s.encryptValue(ctx, userID, []byte(secret.Value))
 	if err != nil {
-		return fmt.Errorf("failed to find secret: %w", err)
+		return false, err
 	}
+	newSecret := &Secret{
+		UserID:      userID,
+		Key:         secret.Key,
+		Value:       encryptedValue,
+		KeyVersion:  keyVersion,
+		Version:     1,
+		ExpiresAt:   expiresAt,
+		Description: secret.Description,
+		Tags:        StringSlice(secret.Tags),
+	}
+
+	// A secret deleted between a failed insert and the update is retried once
+	for attempt := 0; attempt < 2; attempt++ {
+		result := s.db.WithContext(ctx).
+			Clauses(clause.OnConflict{
+				Columns:     []clause.Column{{Name: "user_id"}, {Name: "key"}},
+				TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}},
+				DoNothing:   true,
+			}).
+			Create(newSecret)
+		if result.Error != nil {
+			return false, fmt.Errorf("failed to store secret: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			s.logOperation(ctx, userID, secret.Key, "CREATE")
+			return true, nil
+		}
+		newSecret.ID = 0
+
+		updates := map[string]interface{}{
+			"value":       encryptedValue,
+			"key_version": keyVersion,
+			"expires_at":  expiresAt,
+			"description": secret.Description,
+			"tags":        StringSlice(secret.Tags),
+		}
+		updated, err := s.updateVersioned(ctx, updates, "key = ? AND user_id = ?", secret.Key, userID)
+		if err != nil {
+			return false, err
+		}
+		if updated {
+			s.logOperation(ctx, userID, secret.Key, "UPDATE")
+			return false, nil
+		}
+		// Nothing to update: the secret was deleted after the insert failed
+	}
+	return false, fmt.Errorf("secret '%s' changed concurrently", secret.Key)
+}
+
+// Exists reports whether a secret the user can read exists, without loading or
+// decrypting it. Deleted secrets do not exist.
+func (s *Service) Exists(ctx context.Context, userID, key string) (bool, error) {
+	exists, err := database.Exists(s.db.WithContext(ctx).Model(&Secret{}).Scopes(visibleTo(userID)).Where("key = ?", key))
+	if err != nil {
+		return false, fmt.Errorf("failed to find secret: %w", err)
+	}
+	return exists, nil
+}
 
-	// Delete the secret (soft delete)
-	if err := s.db.Delete(&secret).Error; err != nil {
-		return fmt.Errorf("failed to delete secret: %w", err)
+// DeleteSecret deletes a secret the user owns. The delete is soft, so the
+// secret's versions and grants are kept.
+func (s *Service) DeleteSecret(ctx context.Context, userID, key string) error {
+	result := s.db.WithContext(ctx).Where("key = ? AND user_id = ?", key, userID).Delete(&Secret{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete secret: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("secret '%s' not found", key)
 	}
 
 	// Log the operation
-	s.logOperation(userID, key, "DELETE", "", "")
+	s.logOperation(ctx, userID, key, "DELETE")
 
 	return nil
 }
 
+// Search returns the user's secrets whose key, description or tags match the query
+func (s *Service) Search(ctx context.Context, userID, query string, limit int) ([]*core.SearchHit, error) {
+	pattern := core.LikePattern(query)
+	var secrets []Secret
+	err := s.db.WithContext(ctx).
+		Scopes(secretMetadata).
+		Where("user_id = ?", userID).
+		Where(`LOWER(key) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\' OR LOWER(tags) LIKE ? ESCAPE '\'`, pattern, pattern, pattern).
+		Limit(limit).
+		Find(&secrets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search secrets: %w", err)
+	}
+
+	hits := make([]*core.SearchHit, 0, len(secrets))
+	for _, secret := range secrets {
+		score := core.MatchScore(query, secret.Key)
+		if descriptionScore := 0.6 * core.MatchScore(query, secret.Description); descriptionScore > score {
+			score = descriptionScore
+		}
+		for _, tag := range secret.Tags {
+			if tagScore := 0.8 * core.MatchScore(query, tag); tagScore > score {
+				score = tagScore
+			}
+		}
+		hits = append(hits, &core.SearchHit{
+			ResourceType: core.ResourceTypeSecret,
+			ID:           secret.Key,
+			Title:        secret.Key,
+			Description:  secret.Description,
+			Score:        score,
+		})
+	}
+
+	return hits, nil
+}
+
 // validateSecret validates a secret before storing/updating
 func (s *Service) validateSecret(secret *Secret) error {
 	if strings.TrimSpace(secret.Key) == "" {
@@ -204,29 +516,31 @@ func (s *Service) validateSecret(secret *Secret) error {
 	if strings.TrimSpace(secret.Value) == "" {
 		return errors.New("value is required")
 	}
-	if len(secret.Key) > 255 {
-		return errors.New("key too long (max 255 characters)")
-	}
-	return nil
+	return s.rules().check(secret.Key)
 }
 
-// logOperation logs an audit entry
-func (s *Service) logOperation(userID, secretKey, action, ipAddress, userAgent string) {
+// logOperation logs an audit entry, with the client ctx carries if any; see WithClient
+func (s *Service) logOperation(ctx context.Context, userID, secretKey, action string) {
 	if s.db == nil {
 		return // Skip logging if no database connection
 	}
 
+	client, _ := ctx.Value(clientKey{}).(clientInfo)
 	auditLog := &AuditLog{
 		UserID:    userID,
 		SecretKey: secretKey,
 		Action:    action,
-		IPAddress: ipAddress,
-		UserAgent: userAgent,
+		IPAddress: client.ipAddress,
+		UserAgent: client.userAgent,
 	}
 
 	// Log errors but don't fail the operation
 	if err := s.db.Create(auditLog).Error; err != nil {
 		// In a real implementation, this would use proper logging
 		fmt.Printf("Failed to log audit entry: %v\n", err)
+		return
+	}
+	if s.events != nil {
+		s.events.Publish(ctx, core.BusEvent{Topic: core.TopicAuditLogged, UserID: userID})
 	}
 }
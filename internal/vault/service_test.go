@@ -2,10 +2,16 @@ package vault
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -17,19 +23,37 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	require.NoError(t, err)
 
 	// Auto-migrate the schema
-	err = db.AutoMigrate(&Secret{}, &AuditLog{})
+	err = db.AutoMigrate(&Secret{}, &SecretVersion{}, &SecretGrant{}, &AuditLog{}, &KeySalt{})
 	require.NoError(t, err)
 
 	return db
 }
 
+func TestMigrateSchema(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Exec("CREATE UNIQUE INDEX idx_secrets_key ON secrets(key) WHERE deleted_at IS NULL").Error)
+
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+	require.NoError(t, service.MigrateSchema(db))
+	require.NoError(t, service.MigrateSchema(db), "migrating again is a no-op")
+	assert.False(t, db.Migrator().HasIndex(&Secret{}, "idx_secrets_key"))
+	assert.True(t, db.Migrator().HasIndex(&Secret{}, "idx_secrets_user_key"))
+
+	ctx := context.Background()
+	require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "api-key", Value: "one"}))
+	created, err := service.UpsertSecret(ctx, "user2", &Secret{Key: "api-key", Value: "two"})
+	require.NoError(t, err)
+	assert.True(t, created)
+}
+
 func TestVaultService(t *testing.T) {
 	t.Run("should create new vault service", func(t *testing.T) {
 		// Set required environment variable for test
 		os.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
 		defer os.Unsetenv("VERTEX_MASTER_PASSWORD")
 		
-		service := NewService()
+		service := NewService(NewEnvKeyProvider())
 		assert.NotNil(t, service)
 	})
 }
@@ -40,7 +64,7 @@ func TestSecretOperations(t *testing.T) {
 	defer os.Unsetenv("VERTEX_MASTER_PASSWORD")
 	
 	db := setupTestDB(t)
-	service := NewService()
+	service := NewService(NewEnvKeyProvider())
 	service.SetDB(db)
 	ctx := context.Background()
 
@@ -67,7 +91,7 @@ func TestSecretOperations(t *testing.T) {
 		assert.WithinDuration(t, time.Now(), retrieved.UpdatedAt, time.Second)
 	})
 
-	t.Run("should list all secrets globally", func(t *testing.T) {
+	t.Run("should list only the user's secrets", func(t *testing.T) {
 		// Store multiple secrets
 		secrets := []*Secret{
 			{Key: "secret1", Value: "value1", Description: "First secret"},
@@ -79,11 +103,10 @@ func TestSecretOperations(t *testing.T) {
 			require.NoError(t, err)
 		}
 
-		// List secrets - should return all secrets regardless of user
+		// List secrets - user1's secret from the previous test is not included
 		list, err := service.ListSecrets(ctx, "user2")
 		require.NoError(t, err)
-		// Should include the 2 new secrets plus any from previous tests
-		assert.GreaterOrEqual(t, len(list), 2)
+		assert.Len(t, list, 2)
 
 		// Check that values are not included in list (SecretListItem doesn't have Value field)
 		secretFound := false
@@ -131,6 +154,10 @@ func TestSecretOperations(t *testing.T) {
 		err := service.StoreSecret(ctx, "user4", secret)
 		require.NoError(t, err)
 
+		exists, err := service.Exists(ctx, "user4", "delete-test")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
 		// Delete secret
 		err = service.DeleteSecret(ctx, "user4", "delete-test")
 		require.NoError(t, err)
@@ -139,6 +166,12 @@ func TestSecretOperations(t *testing.T) {
 		_, err = service.GetSecret(ctx, "user4", "delete-test")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
+
+		// The secret is soft-deleted, so it no longer exists
+		exists, err = service.Exists(ctx, "user4", "delete-test")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.ErrorContains(t, service.DeleteSecret(ctx, "user4", "delete-test"), "not found")
 	})
 
 	t.Run("should return error for non-existent secret", func(t *testing.T) {
@@ -147,16 +180,35 @@ func TestSecretOperations(t *testing.T) {
 		assert.Contains(t, err.Error(), "not found")
 	})
 
-	t.Run("should allow global access to secrets", func(t *testing.T) {
+	t.Run("should let users store secrets under the same key", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "shared-name", Value: "one"}))
+		require.NoError(t, service.StoreSecret(ctx, "user2", &Secret{Key: "shared-name", Value: "two"}), "another user's key is not reported as taken")
+		assert.ErrorContains(t, service.StoreSecret(ctx, "user1", &Secret{Key: "shared-name", Value: "again"}), "secret with key 'shared-name' already exists")
+
+		secret, err := service.GetSecret(ctx, "user2", "shared-name")
+		require.NoError(t, err)
+		assert.Equal(t, "two", secret.Value)
+	})
+
+	t.Run("should hide secrets from other users", func(t *testing.T) {
 		// Store secret for user1
-		secret := &Secret{Key: "global-test", Value: "global-value"}
+		secret := &Secret{Key: "private-test", Value: "private-value"}
 		err := service.StoreSecret(ctx, "user1", secret)
 		require.NoError(t, err)
 
-		// Access from user2 should work (global secrets)
-		retrieved, err := service.GetSecret(ctx, "user2", "global-test")
+		// Secrets are not global: to user2 it does not exist
+		_, err = service.GetSecret(ctx, "user2", "private-test")
+		assert.ErrorContains(t, err, "secret 'private-test' not found")
+		err = service.UpdateSecret(ctx, "user2", &Secret{Key: "private-test", Value: "overwritten"})
+		assert.ErrorContains(t, err, "secret 'private-test' not found")
+		assert.ErrorContains(t, service.DeleteSecret(ctx, "user2", "private-test"), "secret 'private-test' not found")
+		exists, err := service.Exists(ctx, "user2", "private-test")
 		require.NoError(t, err)
-		assert.Equal(t, "global-value", retrieved.Value)
+		assert.False(t, exists)
+
+		retrieved, err := service.GetSecret(ctx, "user1", "private-test")
+		require.NoError(t, err)
+		assert.Equal(t, "private-value", retrieved.Value)
 	})
 }
 
@@ -166,7 +218,7 @@ func TestSecretValidation(t *testing.T) {
 	defer os.Unsetenv("VERTEX_MASTER_PASSWORD")
 	
 	db := setupTestDB(t)
-	service := NewService()
+	service := NewService(NewEnvKeyProvider())
 	service.SetDB(db)
 	ctx := context.Background()
 
@@ -209,7 +261,7 @@ func TestSecretEncryption(t *testing.T) {
 	defer os.Unsetenv("VERTEX_MASTER_PASSWORD")
 	
 	db := setupTestDB(t)
-	service := NewService()
+	service := NewService(NewEnvKeyProvider())
 	service.SetDB(db)
 	ctx := context.Background()
 
@@ -237,3 +289,316 @@ func TestSecretEncryption(t *testing.T) {
 		assert.Equal(t, "sensitive-data", retrieved.Value)
 	})
 }
+
+func TestConcurrentGetSecret(t *testing.T) {
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	service := NewService(NewEnvKeyProvider())
+	service.SetDB(db)
+	ctx := context.Background()
+	require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "shared", Value: "s3cret", Tags: StringSlice{"prod"}}))
+
+	var queries atomic.Int32
+	err = db.Callback().Query().Before("gorm:query").Register("test:slow_secret_queries", func(tx *gorm.DB) {
+		if tx.Statement.Table == "secrets" {
+			queries.Add(1)
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	require.NoError(t, err)
+
+	readConcurrently := func(userIDs ...string) []*Secret {
+		results := make([]*Secret, len(userIDs))
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i, userID := range userIDs {
+			wg.Add(1)
+			go func(i int, userID string) {
+				defer wg.Done()
+				<-start
+				secret, err := service.GetSecret(ctx, userID, "shared")
+				assert.NoError(t, err)
+				results[i] = secret
+			}(i, userID)
+		}
+		close(start)
+		wg.Wait()
+		return results
+	}
+
+	t.Run("should load and decrypt once for concurrent identical reads", func(t *testing.T) {
+		queries.Store(0)
+		results := readConcurrently("user1", "user1", "user1", "user1", "user1", "user1", "user1", "user1")
+
+		assert.Equal(t, int32(1), queries.Load())
+		for _, secret := range results {
+			assert.Equal(t, "s3cret", secret.Value)
+		}
+		results[0].Tags[0] = "mutated"
+		assert.Equal(t, "prod", results[1].Tags[0])
+
+		var reads int64
+		require.NoError(t, db.Model(&AuditLog{}).Where("action = ?", "READ").Count(&reads).Error)
+		assert.Equal(t, int64(8), reads)
+	})
+
+	t.Run("should not share reads across users", func(t *testing.T) {
+		require.NoError(t, service.GrantSecret(ctx, "user1", "shared", "user2"))
+		queries.Store(0)
+		readConcurrently("user1", "user2", "user1", "user2")
+		assert.Equal(t, int32(2), queries.Load())
+	})
+}
+
+// blockingKeyProvider holds the first master key request until released
+type blockingKeyProvider struct {
+	KeyProvider
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingKeyProvider) GetMasterKey(ctx context.Context) ([]byte, error) {
+	p.once.Do(func() {
+		close(p.entered)
+		<-p.release
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.KeyProvider.GetMasterKey(ctx)
+}
+
+func TestGetSecretLeaderCancelled(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(setupTestDB(t))
+	require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "shared", Value: "s3cret"}))
+	keys := &blockingKeyProvider{KeyProvider: StaticKeyProvider("master"), entered: make(chan struct{}), release: make(chan struct{})}
+	service.setKeyProvider(keys)
+
+	// The leader starts the shared load, then gives up while it is in flight
+	leaderCtx, cancel := context.WithCancel(ctx)
+	leader := make(chan error, 1)
+	go func() {
+		_, err := service.GetSecret(leaderCtx, "user1", "shared")
+		leader <- err
+	}()
+	<-keys.entered
+	cancel()
+	assert.ErrorIs(t, <-leader, context.Canceled)
+
+	// A reader joining the same load still gets the secret
+	waiter := make(chan *Secret, 1)
+	go func() {
+		secret, err := service.GetSecret(ctx, "user1", "shared")
+		assert.NoError(t, err)
+		waiter <- secret
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(keys.release)
+	secret := <-waiter
+	require.NotNil(t, secret)
+	assert.Equal(t, "s3cret", secret.Value)
+}
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, db.Create(&Secret{UserID: "user1", Key: "old", Value: "x", CreatedAt: old}).Error)
+	require.NoError(t, db.Create(&Secret{UserID: "user1", Key: "new", Value: "x"}).Error)
+	require.NoError(t, db.Create(&Secret{UserID: "user2", Key: "other", Value: "x"}).Error)
+
+	count, err := service.Count(ctx, "user1", core.CountFilter{GroupByStatus: true})
+	require.NoError(t, err)
+	assert.Equal(t, core.ResourceTypeSecret, count.ResourceType)
+	assert.Equal(t, int64(2), count.Total)
+	assert.Nil(t, count.ByStatus, "secrets have no status")
+
+	count, err = service.Count(ctx, "user1", core.CountFilter{CreatedAfter: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count.Total)
+}
+
+func TestListSecretsExcludesValues(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+	require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "api-token", Value: "plaintext-token", Description: "token"}))
+
+	var queries []string
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		queries = append(queries, tx.Statement.SQL.String())
+	}))
+
+	list, err := service.ListSecrets(ctx, "user1")
+	require.NoError(t, err)
+	hits, err := service.Search(ctx, "user1", "api", 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Len(t, hits, 1)
+
+	encoded, err := json.Marshal(list)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), `"value"`)
+	assert.NotContains(t, string(encoded), "plaintext-token")
+
+	require.NotEmpty(t, queries)
+	for _, query := range queries {
+		assert.NotContains(t, query, "`value`", query)
+		assert.False(t, strings.HasPrefix(query, "SELECT *"), query)
+	}
+}
+
+func BenchmarkListSecrets(b *testing.B) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(b, err)
+	require.NoError(b, db.AutoMigrate(&Secret{}))
+
+	// Large encrypted values, as for certificates or key bundles
+	value := strings.Repeat("x", 64<<10)
+	for i := 0; i < 200; i++ {
+		require.NoError(b, db.Create(&Secret{UserID: "user1", Key: fmt.Sprintf("secret-%d", i), Value: value}).Error)
+	}
+
+	b.Run("metadata", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var secrets []Secret
+			require.NoError(b, db.Scopes(secretMetadata).Where("user_id = ?", "user1").Find(&secrets).Error)
+		}
+	})
+
+	b.Run("all columns", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var secrets []Secret
+			require.NoError(b, db.Where("user_id = ?", "user1").Find(&secrets).Error)
+		}
+	})
+}
+
+func TestGetUserSecret(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(setupTestDB(t))
+	require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "db-password", Value: "hunter2"}))
+
+	secret, err := service.GetUserSecret(ctx, "user1", "db-password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", secret.Value)
+
+	_, err = service.GetUserSecret(ctx, "user2", "db-password")
+	assert.ErrorContains(t, err, "secret 'db-password' not found")
+}
+
+func TestUpsertSecret(t *testing.T) {
+	t.Setenv("VERTEX_MASTER_PASSWORD", "test-password")
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*Service, *gorm.DB) {
+		db := setupTestDB(t)
+		// Upserts run concurrently; one connection keeps them on the same in-memory database
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		sqlDB.SetMaxOpenConns(1)
+		service := NewService(NewEnvKeyProvider())
+		service.SetDB(db)
+		return service, db
+	}
+
+	t.Run("should create a new secret", func(t *testing.T) {
+		service, db := setup(t)
+
+		created, err := service.UpsertSecret(ctx, "user1", &Secret{Key: "api-key", Value: "v1", Tags: StringSlice{"prod"}})
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		secret, err := service.GetUserSecret(ctx, "user1", "api-key")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", secret.Value)
+		assert.Equal(t, StringSlice{"prod"}, secret.Tags)
+
+		var creates int64
+		require.NoError(t, db.Model(&AuditLog{}).Where("action = ?", "CREATE").Count(&creates).Error)
+		assert.Equal(t, int64(1), creates)
+	})
+
+	t.Run("should update an existing secret", func(t *testing.T) {
+		service, db := setup(t)
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "api-key", Value: "v1"}))
+
+		created, err := service.UpsertSecret(ctx, "user1", &Secret{Key: "api-key", Value: "v2", Description: "rotated"})
+		require.NoError(t, err)
+		assert.False(t, created)
+
+		secret, err := service.GetUserSecret(ctx, "user1", "api-key")
+		require.NoError(t, err)
+		assert.Equal(t, "v2", secret.Value)
+		assert.Equal(t, "rotated", secret.Description)
+
+		var count int64
+		require.NoError(t, db.Model(&Secret{}).Where("key = ?", "api-key").Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("should recreate a deleted secret", func(t *testing.T) {
+		service, _ := setup(t)
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "api-key", Value: "v1"}))
+		require.NoError(t, service.DeleteSecret(ctx, "user1", "api-key"))
+
+		created, err := service.UpsertSecret(ctx, "user1", &Secret{Key: "api-key", Value: "v2"})
+		require.NoError(t, err)
+		assert.True(t, created)
+	})
+
+	t.Run("should not overwrite another user's secret", func(t *testing.T) {
+		service, _ := setup(t)
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "api-key", Value: "v1"}))
+
+		created, err := service.UpsertSecret(ctx, "user2", &Secret{Key: "api-key", Value: "theirs"})
+		require.NoError(t, err)
+		assert.True(t, created, "keys are unique per user")
+
+		secret, err := service.GetUserSecret(ctx, "user1", "api-key")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", secret.Value)
+		secret, err = service.GetUserSecret(ctx, "user2", "api-key")
+		require.NoError(t, err)
+		assert.Equal(t, "theirs", secret.Value)
+	})
+
+	t.Run("should not duplicate a key upserted concurrently", func(t *testing.T) {
+		service, db := setup(t)
+
+		var wg sync.WaitGroup
+		var creates atomic.Int32
+		start := make(chan struct{})
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				created, err := service.UpsertSecret(ctx, "user1", &Secret{Key: "api-key", Value: fmt.Sprintf("v%d", i)})
+				assert.NoError(t, err)
+				if created {
+					creates.Add(1)
+				}
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), creates.Load())
+		var count int64
+		require.NoError(t, db.Model(&Secret{}).Where("key = ?", "api-key").Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+}
@@ -0,0 +1,73 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+)
+
+// VerifyStatus is the outcome of verifying one secret
+type VerifyStatus string
+
+const (
+	// VerifyStatusOK means the secret decrypts under the current master key
+	VerifyStatusOK VerifyStatus = "ok"
+	// VerifyStatusStale means the secret decrypts but was written under a
+	// previous master key or an older format, and can be re-encrypted
+	VerifyStatusStale VerifyStatus = "stale"
+	// VerifyStatusFailed means the secret cannot be decrypted with any known key
+	VerifyStatusFailed VerifyStatus = "failed"
+)
+
+// VerifyResult reports whether one secret decrypts. It never carries the value.
+type VerifyResult struct {
+	Key      string       `json:"key"`
+	Status   VerifyStatus `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Repaired bool         `json:"repaired,omitempty"`
+}
+
+// VerifySecrets attempts to decrypt every secret owned by the user and reports
+// which ones fail, so operators can find corrupted values or key mismatches
+func (s *Service) VerifySecrets(ctx context.Context, userID string) ([]VerifyResult, error) {
+	return s.verifySecrets(ctx, userID, false)
+}
+
+// RepairSecrets verifies the user's secrets like VerifySecrets and re-encrypts
+// stale ones under the current master key. Failed secrets are left untouched.
+func (s *Service) RepairSecrets(ctx context.Context, userID string) ([]VerifyResult, error) {
+	return s.verifySecrets(ctx, userID, true)
+}
+
+// verifySecrets checks each of the user's secrets, re-encrypting stale ones when repair is set
+func (s *Service) verifySecrets(ctx context.Context, userID string, repair bool) ([]VerifyResult, error) {
+	var secrets []Secret
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("key").Find(&secrets).Error; err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	results := make([]VerifyResult, 0, len(secrets))
+	for i := range secrets {
+		secret := &secrets[i]
+		result := VerifyResult{Key: secret.Key, Status: VerifyStatusOK}
+
+		plaintext, stale, err := s.decryptValue(ctx, secret.UserID, secret.Value)
+		switch {
+		case err != nil:
+			result.Status = VerifyStatusFailed
+			result.Error = err.Error()
+		case stale:
+			result.Status = VerifyStatusStale
+			if repair {
+				if err := s.reencryptSecret(ctx, secret, plaintext); err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Repaired = true
+					s.logOperation(ctx, userID, secret.Key, "REENCRYPT")
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
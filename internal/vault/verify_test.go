@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/ataiva-software/vertex/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySecrets(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+
+	require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "good", Value: "good-value"}))
+	require.NoError(t, service.StoreSecret(ctx, "user", &Secret{Key: "corrupted", Value: "corrupted-value"}))
+	require.NoError(t, service.StoreSecret(ctx, "other", &Secret{Key: "other", Value: "other-value"}))
+
+	// Flip a byte at the end of the ciphertext so authentication fails
+	var corrupted Secret
+	require.NoError(t, db.Where("key = ?", "corrupted").First(&corrupted).Error)
+	data, err := base64.StdEncoding.DecodeString(corrupted.Value)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, db.Model(&corrupted).Update("value", base64.StdEncoding.EncodeToString(data)).Error)
+
+	// A value written before key versioning decrypts but is stale
+	legacy, err := crypto.EncryptAES([]byte("legacy-value"), "master")
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&Secret{UserID: "user", Key: "legacy", Value: base64.StdEncoding.EncodeToString(legacy)}).Error)
+
+	statuses := func(results []VerifyResult) map[string]VerifyStatus {
+		byKey := make(map[string]VerifyStatus, len(results))
+		for _, result := range results {
+			byKey[result.Key] = result.Status
+		}
+		return byKey
+	}
+
+	t.Run("should flag corrupted and stale secrets without revealing values", func(t *testing.T) {
+		results, err := service.VerifySecrets(ctx, "user")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]VerifyStatus{
+			"corrupted": VerifyStatusFailed,
+			"good":      VerifyStatusOK,
+			"legacy":    VerifyStatusStale,
+		}, statuses(results))
+
+		for _, result := range results {
+			assert.False(t, result.Repaired)
+			assert.NotContains(t, result.Error, "value")
+		}
+		assert.NotEmpty(t, results[0].Error)
+	})
+
+	t.Run("should re-encrypt stale secrets when repairing", func(t *testing.T) {
+		results, err := service.RepairSecrets(ctx, "user")
+		require.NoError(t, err)
+		for _, result := range results {
+			assert.Equal(t, result.Key == "legacy", result.Repaired, result.Key)
+		}
+
+		results, err = service.VerifySecrets(ctx, "user")
+		require.NoError(t, err)
+		assert.Equal(t, VerifyStatusOK, statuses(results)["legacy"])
+		assert.Equal(t, VerifyStatusFailed, statuses(results)["corrupted"])
+
+		secret, err := service.GetSecret(ctx, "user", "legacy")
+		require.NoError(t, err)
+		assert.Equal(t, "legacy-value", secret.Value)
+	})
+}
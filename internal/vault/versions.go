@@ -0,0 +1,171 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// versionedUpdateAttempts is how many times an update is tried when the
+// secret's version changes under it
+const versionedUpdateAttempts = 3
+
+// errVersionChanged aborts a versioned update that lost a race with another
+var errVersionChanged = errors.New("secret changed concurrently")
+
+// updateVersioned applies updates, which must change the value, to the live
+// secret matching the conditions, appending the value it replaces to the
+// secret's history. It reports whether a secret matched.
+func (s *Service) updateVersioned(ctx context.Context, updates map[string]interface{}, query interface{}, args ...interface{}) (bool, error) {
+	for attempt := 0; attempt < versionedUpdateAttempts; attempt++ {
+		matched := false
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var current Secret
+			if err := tx.Where(query, args...).Limit(1).Find(&current).Error; err != nil {
+				return fmt.Errorf("failed to find secret: %w", err)
+			}
+			if current.ID == 0 {
+				return nil
+			}
+			matched = true
+
+			// The version guard fails if another update committed since the read
+			updates["version"] = current.Version + 1
+			result := tx.Model(&Secret{}).Where("id = ? AND version = ?", current.ID, current.Version).Updates(updates)
+			if result.Error != nil {
+				return fmt.Errorf("failed to update secret: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return errVersionChanged
+			}
+
+			previous := &SecretVersion{
+				SecretID:   current.ID,
+				Version:    current.Version,
+				Value:      current.Value,
+				KeyVersion: current.KeyVersion,
+			}
+			if err := tx.Create(previous).Error; err != nil {
+				return fmt.Errorf("failed to record secret version: %w", err)
+			}
+			return nil
+		})
+		if !errors.Is(err, errVersionChanged) {
+			return matched, err
+		}
+	}
+	return false, errVersionChanged
+}
+
+// ListSecretVersions returns the versions of a secret the user owns, newest
+// first, without reading their values. The current version is listed first.
+func (s *Service) ListSecretVersions(ctx context.Context, userID, key string) ([]*SecretVersionItem, error) {
+	secret, err := s.ownedSecret(ctx, userID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []SecretVersion
+	err = s.db.WithContext(ctx).
+		Select("version", "key_version", "created_at").
+		Where("secret_id = ?", secret.ID).
+		Order("version DESC").
+		Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secret versions: %w", err)
+	}
+
+	items := make([]*SecretVersionItem, 0, len(versions)+1)
+	items = append(items, &SecretVersionItem{
+		Version:    secret.Version,
+		KeyVersion: secret.KeyVersion,
+		Current:    true,
+		CreatedAt:  secret.UpdatedAt,
+	})
+	for _, version := range versions {
+		items = append(items, &SecretVersionItem{
+			Version:    version.Version,
+			KeyVersion: version.KeyVersion,
+			CreatedAt:  version.CreatedAt,
+		})
+	}
+	return items, nil
+}
+
+// GetSecretVersion retrieves a secret the user owns with the value it held at
+// a version
+func (s *Service) GetSecretVersion(ctx context.Context, userID, key string, version int) (*Secret, error) {
+	secret, err := s.ownedSecret(ctx, userID, key)
+	if err != nil {
+		return nil, err
+	}
+	if version == secret.Version {
+		return s.GetSecret(ctx, userID, key)
+	}
+
+	plaintext, err := s.versionValue(ctx, secret, version)
+	if err != nil {
+		return nil, err
+	}
+	secret.Value = string(plaintext)
+	secret.Version = version
+
+	s.logOperation(ctx, userID, key, "READ_VERSION")
+
+	return secret, nil
+}
+
+// versionValue decrypts the value a secret held at a previous version
+func (s *Service) versionValue(ctx context.Context, secret *Secret, version int) ([]byte, error) {
+	var previous SecretVersion
+	err := s.db.WithContext(ctx).Where("secret_id = ? AND version = ?", secret.ID, version).First(&previous).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("version %d of secret '%s' not found", version, secret.Key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret version: %w", err)
+	}
+
+	plaintext, _, err := s.decryptValue(ctx, secret.UserID, previous.Value)
+	if err != nil {
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// RollbackSecret restores the value a secret the user owns held at a previous
+// version. The rollback is itself a new version, so the value it replaces
+// stays in the history and the rollback can be undone.
+func (s *Service) RollbackSecret(ctx context.Context, userID, key string, version int) error {
+	secret, err := s.ownedSecret(ctx, userID, key)
+	if err != nil {
+		return err
+	}
+	if version == secret.Version {
+		return fmt.Errorf("version %d is already the current version of secret '%s'", version, key)
+	}
+
+	plaintext, err := s.versionValue(ctx, secret, version)
+	if err != nil {
+		return err
+	}
+	value, keyVersion, err := s.encryptValue(ctx, secret.UserID, plaintext)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"value": value, "key_version": keyVersion}
+	matched, err := s.updateVersioned(ctx, updates, "id = ?", secret.ID)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return fmt.Errorf("secret '%s' not found", key)
+	}
+
+	s.logOperation(ctx, userID, key, "ROLLBACK")
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package vault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretVersions(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	service := NewService(StaticKeyProvider("master"))
+	service.SetDB(db)
+
+	require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "db-password", Value: "v1"}))
+	require.NoError(t, service.UpdateSecret(ctx, "user1", &Secret{Key: "db-password", Value: "v2"}))
+	created, err := service.UpsertSecret(ctx, "user1", &Secret{Key: "db-password", Value: "v3"})
+	require.NoError(t, err)
+	require.False(t, created)
+
+	t.Run("should keep every replaced value as a version", func(t *testing.T) {
+		secret, err := service.GetSecret(ctx, "user1", "db-password")
+		require.NoError(t, err)
+		assert.Equal(t, "v3", secret.Value)
+		assert.Equal(t, 3, secret.Version)
+
+		var versions []SecretVersion
+		require.NoError(t, db.Order("version").Find(&versions).Error)
+		require.Len(t, versions, 2)
+		assert.Equal(t, []int{1, 2}, []int{versions[0].Version, versions[1].Version})
+		assert.NotEqual(t, "v1", versions[0].Value, "versions must be stored encrypted")
+	})
+
+	t.Run("should list versions without their values, newest first", func(t *testing.T) {
+		items, err := service.ListSecretVersions(ctx, "user1", "db-password")
+		require.NoError(t, err)
+		require.Len(t, items, 3)
+		assert.Equal(t, 3, items[0].Version)
+		assert.True(t, items[0].Current)
+		assert.Equal(t, 2, items[1].Version)
+		assert.False(t, items[1].Current)
+		assert.Equal(t, 1, items[2].Version)
+		assert.NotEmpty(t, items[2].KeyVersion)
+	})
+
+	t.Run("should read a previous version", func(t *testing.T) {
+		secret, err := service.GetSecretVersion(ctx, "user1", "db-password", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "v1", secret.Value)
+		assert.Equal(t, 1, secret.Version)
+
+		current, err := service.GetSecretVersion(ctx, "user1", "db-password", 3)
+		require.NoError(t, err)
+		assert.Equal(t, "v3", current.Value)
+
+		_, err = service.GetSecretVersion(ctx, "user1", "db-password", 9)
+		assert.ErrorContains(t, err, "version 9 of secret 'db-password' not found")
+	})
+
+	t.Run("should roll back as a new version", func(t *testing.T) {
+		require.NoError(t, service.RollbackSecret(ctx, "user1", "db-password", 1))
+
+		secret, err := service.GetSecret(ctx, "user1", "db-password")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", secret.Value)
+		assert.Equal(t, 4, secret.Version)
+
+		replaced, err := service.GetSecretVersion(ctx, "user1", "db-password", 3)
+		require.NoError(t, err)
+		assert.Equal(t, "v3", replaced.Value)
+
+		assert.ErrorContains(t, service.RollbackSecret(ctx, "user1", "db-password", 4), "already the current version")
+	})
+
+	t.Run("should keep versions when a secret is deleted", func(t *testing.T) {
+		require.NoError(t, service.StoreSecret(ctx, "user1", &Secret{Key: "doomed", Value: "a"}))
+		require.NoError(t, service.UpdateSecret(ctx, "user1", &Secret{Key: "doomed", Value: "b"}))
+		var doomed Secret
+		require.NoError(t, db.Where("key = ?", "doomed").First(&doomed).Error)
+		require.NoError(t, service.DeleteSecret(ctx, "user1", "doomed"))
+
+		var remaining int64
+		require.NoError(t, db.Unscoped().Model(&Secret{}).Where("id = ?", doomed.ID).Count(&remaining).Error)
+		assert.Equal(t, int64(1), remaining, "deletes must stay soft")
+		require.NoError(t, db.Model(&SecretVersion{}).Where("secret_id = ?", doomed.ID).Count(&remaining).Error)
+		assert.Equal(t, int64(1), remaining)
+
+		_, err := service.ListSecretVersions(ctx, "user1", "doomed")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("should re-encrypt versions when the master password is rotated", func(t *testing.T) {
+		_, err := service.RotateMasterPassword(ctx, "master", "master-v2")
+		require.NoError(t, err)
+
+		current := NewService(StaticKeyProvider("master-v2"))
+		current.SetDB(db)
+		secret, err := current.GetSecretVersion(ctx, "user1", "db-password", 2)
+		require.NoError(t, err)
+		assert.Equal(t, "v2", secret.Value)
+	})
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a concurrency-safe in-memory cache with per-entry TTL and LRU eviction
+type Cache[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+	items    map[K]*list.Element
+	order    *list.List
+	stats    CacheStats
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// CacheStats contains cache hit/miss counters
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// NewCache creates a new cache holding at most capacity entries for ttl each.
+// A non-positive capacity means the cache is unbounded; a non-positive ttl means entries never expire.
+func NewCache[K comparable, V any](capacity int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns the cached value for key if present and not expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	element, exists := c.items[key]
+	if !exists {
+		c.stats.Misses++
+		return zero, false
+	}
+
+	entry := element.Value.(*cacheEntry[K, V])
+	if !entry.expiresAt.IsZero() && c.now().After(entry.expiresAt) {
+		c.removeElement(element)
+		c.stats.Misses++
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+	return entry.value, true
+}
+
+// Set stores a value using the cache's default TTL
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores a value with a specific TTL
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	if element, exists := c.items[key]; exists {
+		entry := element.Value.(*cacheEntry[K, V])
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	element := c.order.PushFront(&cacheEntry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	c.items[key] = element
+
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Delete removes a key from the cache
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.items[key]; exists {
+		c.removeElement(element)
+	}
+}
+
+// DeleteFunc removes every entry whose key matches the predicate
+func (c *Cache[K, V]) DeleteFunc(match func(key K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.items {
+		if match(key) {
+			c.removeElement(element)
+		}
+	}
+}
+
+// Prune removes expired entries, which otherwise stay in memory until they are
+// looked up or evicted, and returns how many it removed
+func (c *Cache[K, V]) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	pruned := 0
+	for _, element := range c.items {
+		entry := element.Value.(*cacheEntry[K, V])
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			c.removeElement(element)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// Clear removes all entries from the cache
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+}
+
+// Len returns the number of entries in the cache, including expired ones not yet evicted
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *Cache[K, V]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// removeElement removes an element from both the list and the index; caller must hold the lock
+func (c *Cache[K, V]) removeElement(element *list.Element) {
+	entry := c.order.Remove(element).(*cacheEntry[K, V])
+	delete(c.items, entry.key)
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("should return cached values on hit", func(t *testing.T) {
+		cache := NewCache[string, int](10, time.Minute)
+		cache.Set("a", 1)
+
+		value, ok := cache.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, value)
+		assert.Equal(t, int64(1), cache.Stats().Hits)
+	})
+
+	t.Run("should report misses for unknown keys", func(t *testing.T) {
+		cache := NewCache[string, int](10, time.Minute)
+
+		_, ok := cache.Get("missing")
+		assert.False(t, ok)
+		assert.Equal(t, int64(1), cache.Stats().Misses)
+	})
+
+	t.Run("should expire entries after their TTL", func(t *testing.T) {
+		cache := NewCache[string, int](10, time.Minute)
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		cache.Set("a", 1)
+		cache.SetWithTTL("b", 2, 2*time.Minute)
+
+		now = now.Add(90 * time.Second)
+		_, ok := cache.Get("a")
+		assert.False(t, ok)
+		value, ok := cache.Get("b")
+		assert.True(t, ok)
+		assert.Equal(t, 2, value)
+		assert.Equal(t, 1, cache.Len())
+	})
+
+	t.Run("should prune expired entries", func(t *testing.T) {
+		cache := NewCache[string, int](10, time.Minute)
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+
+		cache.Set("a", 1)
+		cache.SetWithTTL("b", 2, 2*time.Minute)
+		cache.SetWithTTL("c", 3, 0)
+
+		now = now.Add(90 * time.Second)
+		assert.Equal(t, 1, cache.Prune())
+		assert.Equal(t, 2, cache.Len())
+		assert.Zero(t, cache.Stats().Misses, "pruning is not a lookup")
+	})
+
+	t.Run("should evict least recently used entries", func(t *testing.T) {
+		cache := NewCache[string, int](2, 0)
+		cache.Set("a", 1)
+		cache.Set("b", 2)
+		cache.Get("a") // a is now most recently used
+		cache.Set("c", 3)
+
+		_, ok := cache.Get("b")
+		assert.False(t, ok)
+		_, ok = cache.Get("a")
+		assert.True(t, ok)
+		_, ok = cache.Get("c")
+		assert.True(t, ok)
+		assert.Equal(t, int64(1), cache.Stats().Evictions)
+	})
+
+	t.Run("should invalidate entries", func(t *testing.T) {
+		cache := NewCache[string, int](10, time.Minute)
+		cache.Set("user1:a", 1)
+		cache.Set("user1:b", 2)
+		cache.Set("user2:a", 3)
+
+		cache.Delete("user2:a")
+		_, ok := cache.Get("user2:a")
+		assert.False(t, ok)
+
+		cache.DeleteFunc(func(key string) bool { return key[:5] == "user1" })
+		assert.Equal(t, 0, cache.Len())
+
+		cache.Set("x", 1)
+		cache.Clear()
+		assert.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("should be safe under concurrent access", func(t *testing.T) {
+		cache := NewCache[int, int](50, time.Minute)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					cache.Set(j, worker)
+					cache.Get(j - 1)
+					if j%10 == 0 {
+						cache.Delete(j)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.LessOrEqual(t, cache.Len(), 50)
+	})
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	cache := NewCache[string, int](1000, time.Minute)
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(fmt.Sprintf("key-%d", i%1000))
+	}
+}
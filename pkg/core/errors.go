@@ -0,0 +1,36 @@
+package core
+
+import "errors"
+
+// ErrorCode classifies an error independently of its message so callers can
+// react to the kind of failure, e.g. by mapping it to an HTTP status
+type ErrorCode string
+
+const (
+	ErrorCodeUnavailable ErrorCode = "unavailable"
+)
+
+// CodedError is an error carrying an ErrorCode
+type CodedError struct {
+	Code    ErrorCode
+	Message string
+}
+
+// NewCodedError creates a new CodedError
+func NewCodedError(code ErrorCode, message string) *CodedError {
+	return &CodedError{Code: code, Message: message}
+}
+
+// Error implements the error interface
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+// CodeOf returns the code of the first CodedError in err's chain, or "" if there is none
+func CodeOf(err error) ErrorCode {
+	var coded *CodedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return ""
+}
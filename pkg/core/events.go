@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Topics published on the EventBus
+const (
+	TopicIntegrationDisabled = "integration.disabled"
+	TopicIntegrationEnabled  = "integration.enabled"
+	// TopicAuditLogged is published for the user of each audit entry written
+	TopicAuditLogged = "audit.logged"
+	// TopicWebhookReceived is published for each verified webhook an
+	// integration receives
+	TopicWebhookReceived = "webhook.received"
+)
+
+// BusEvent is a message published on an EventBus
+type BusEvent struct {
+	Topic   string
+	UserID  string
+	Payload interface{}
+}
+
+// IntegrationStatusEvent is the payload of the integration topics
+type IntegrationStatusEvent struct {
+	IntegrationID uint
+	Name          string
+	Type          string
+}
+
+// WebhookReceivedEvent is the payload of TopicWebhookReceived
+type WebhookReceivedEvent struct {
+	IntegrationID uint
+	Type          string
+	Body          []byte
+}
+
+// EventHandler handles events of a subscribed topic
+type EventHandler func(ctx context.Context, event BusEvent)
+
+type subscription struct {
+	id      int
+	handler EventHandler
+}
+
+// EventBus lets services announce changes to the services that depend on them
+// without importing each other. Handlers run synchronously on the publishing
+// goroutine, in the order they subscribed, so they should not block.
+type EventBus struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[string][]subscription
+}
+
+// NewEventBus creates an empty event bus
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[string][]subscription)}
+}
+
+// Subscribe registers handler for topic and returns a function removing it
+func (b *EventBus) Subscribe(topic string, handler EventHandler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	b.handlers[topic] = append(b.handlers[topic], subscription{id: id, handler: handler})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		subscriptions := b.handlers[topic]
+		for i, sub := range subscriptions {
+			if sub.id == id {
+				b.handlers[topic] = append(subscriptions[:i:i], subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers event to every handler subscribed to its topic. A handler
+// that panics is logged and does not stop delivery to the others.
+func (b *EventBus) Publish(ctx context.Context, event BusEvent) {
+	b.mu.RLock()
+	subscriptions := b.handlers[event.Topic]
+	b.mu.RUnlock()
+
+	for _, sub := range subscriptions {
+		b.deliver(ctx, sub.handler, event)
+	}
+}
+
+func (b *EventBus) deliver(ctx context.Context, handler EventHandler, event BusEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("⚠️  Event handler for %s panicked: %v", event.Topic, r)
+		}
+	}()
+	handler(ctx, event)
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should deliver events to subscribers of the topic in order", func(t *testing.T) {
+		bus := NewEventBus()
+		var calls []string
+		bus.Subscribe("a", func(ctx context.Context, event BusEvent) { calls = append(calls, "first:"+event.UserID) })
+		bus.Subscribe("a", func(ctx context.Context, event BusEvent) { calls = append(calls, "second:"+event.UserID) })
+		bus.Subscribe("b", func(ctx context.Context, event BusEvent) { calls = append(calls, "other") })
+
+		bus.Publish(ctx, BusEvent{Topic: "a", UserID: "user1"})
+		assert.Equal(t, []string{"first:user1", "second:user1"}, calls)
+	})
+
+	t.Run("should stop delivering after unsubscribe", func(t *testing.T) {
+		bus := NewEventBus()
+		var calls int
+		unsubscribe := bus.Subscribe("a", func(ctx context.Context, event BusEvent) { calls++ })
+
+		bus.Publish(ctx, BusEvent{Topic: "a"})
+		unsubscribe()
+		bus.Publish(ctx, BusEvent{Topic: "a"})
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should keep delivering when a handler panics", func(t *testing.T) {
+		bus := NewEventBus()
+		var delivered bool
+		bus.Subscribe("a", func(ctx context.Context, event BusEvent) { panic("boom") })
+		bus.Subscribe("a", func(ctx context.Context, event BusEvent) { delivered = true })
+
+		bus.Publish(ctx, BusEvent{Topic: "a"})
+		assert.True(t, delivered)
+	})
+}
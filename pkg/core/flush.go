@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FlushFunc writes out the data a component holds in memory
+type FlushFunc func(ctx context.Context) error
+
+type flushHook struct {
+	name  string
+	flush FlushFunc
+}
+
+// FlushRegistry collects the flush hooks of components that buffer data in
+// memory, such as notification batchers, so shutdown can write all of it out
+// before the process exits
+type FlushRegistry struct {
+	mu    sync.Mutex
+	hooks []flushHook
+}
+
+// NewFlushRegistry creates an empty flush registry
+func NewFlushRegistry() *FlushRegistry {
+	return &FlushRegistry{}
+}
+
+// Register adds a hook flushing the named component
+func (r *FlushRegistry) Register(name string, flush FlushFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, flushHook{name: name, flush: flush})
+}
+
+// Flush runs every registered hook concurrently and waits for them to finish
+// or for ctx to be done. It returns the hooks' errors, and names the hooks
+// still running when ctx ended, whose data may be lost.
+func (r *FlushRegistry) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	hooks := append([]flushHook(nil), r.hooks...)
+	r.mu.Unlock()
+
+	results := make([]chan error, len(hooks))
+	for i, hook := range hooks {
+		results[i] = make(chan error, 1)
+		go func(hook flushHook, result chan<- error) {
+			result <- hook.flush(ctx)
+		}(hook, results[i])
+	}
+
+	var errs []error
+	for i, hook := range hooks {
+		var err error
+		select {
+		case err = <-results[i]:
+		case <-ctx.Done():
+			// A hook that finished as ctx ended still counts as finished
+			select {
+			case err = <-results[i]:
+			default:
+				err = ctx.Err()
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush %s: %w", hook.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushRegistry(t *testing.T) {
+	t.Run("should run every hook", func(t *testing.T) {
+		registry := NewFlushRegistry()
+		var mu sync.Mutex
+		var persisted []string
+		buffer := func(items ...string) FlushFunc {
+			return func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				persisted = append(persisted, items...)
+				return nil
+			}
+		}
+		registry.Register("audit", buffer("a1", "a2"))
+		registry.Register("metrics", buffer("m1"))
+
+		require.NoError(t, registry.Flush(context.Background()))
+		assert.ElementsMatch(t, []string{"a1", "a2", "m1"}, persisted)
+		require.NoError(t, NewFlushRegistry().Flush(context.Background()))
+	})
+
+	t.Run("should report failing hooks after running the rest", func(t *testing.T) {
+		registry := NewFlushRegistry()
+		ran := false
+		registry.Register("audit", func(ctx context.Context) error { return errors.New("database down") })
+		registry.Register("metrics", func(ctx context.Context) error { ran = true; return nil })
+
+		err := registry.Flush(context.Background())
+		assert.EqualError(t, err, "failed to flush audit: database down")
+		assert.True(t, ran)
+	})
+
+	t.Run("should give up on hooks still running at the deadline", func(t *testing.T) {
+		registry := NewFlushRegistry()
+		registry.Register("stuck", func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		})
+		registry.Register("quick", func(ctx context.Context) error { return nil })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := registry.Flush(ctx)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "failed to flush stuck")
+		assert.NotContains(t, err.Error(), "quick")
+	})
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// HealthChecker is implemented by services to report whether the dependencies
+// they need to serve requests, such as their database, are available. Services
+// with no external dependencies report healthy unconditionally.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) *HealthStatus
+}
+
+// CheckReadiness runs every checker and reports ready only when all of them are
+// healthy. Each checker's status is included in the details under its name.
+func CheckReadiness(ctx context.Context, checkers map[string]HealthChecker) *HealthStatus {
+	details := make(map[string]interface{}, len(checkers))
+	var failing []string
+	for name, checker := range checkers {
+		status := checker.CheckHealth(ctx)
+		details[name] = status
+		if !status.Healthy {
+			failing = append(failing, name)
+		}
+	}
+
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		return NewHealthStatusWithDetails(false, "Not ready: "+strings.Join(failing, ", ")+" unhealthy", details)
+	}
+	return NewHealthStatusWithDetails(true, "Ready", details)
+}
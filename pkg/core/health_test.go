@@ -0,0 +1,42 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticChecker bool
+
+func (c staticChecker) CheckHealth(ctx context.Context) *HealthStatus {
+	if c {
+		return NewHealthStatus(true, "ok")
+	}
+	return NewHealthStatus(false, "down")
+}
+
+func TestCheckReadiness(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should be ready when every checker is healthy", func(t *testing.T) {
+		status := CheckReadiness(ctx, map[string]HealthChecker{"database": staticChecker(true), "cache": staticChecker(true)})
+		assert.True(t, status.Healthy)
+		assert.Len(t, status.Details, 2)
+	})
+
+	t.Run("should name every unhealthy checker", func(t *testing.T) {
+		status := CheckReadiness(ctx, map[string]HealthChecker{
+			"database": staticChecker(false),
+			"cache":    staticChecker(false),
+			"queue":    staticChecker(true),
+		})
+		assert.False(t, status.Healthy)
+		assert.Equal(t, "Not ready: cache, database unhealthy", status.Message)
+		assert.False(t, status.Details["database"].(*HealthStatus).Healthy)
+	})
+
+	t.Run("should be ready with no checkers", func(t *testing.T) {
+		assert.True(t, CheckReadiness(ctx, nil).Healthy)
+	})
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// DefaultMaxJSONSize is the default limit on a serialized JSON column, 1 MiB
+const DefaultMaxJSONSize = 1 << 20
+
+// ErrJSONTooLarge is returned when a JSON value is larger than MaxJSONSize
+var ErrJSONTooLarge = errors.New("JSON value too large")
+
+var maxJSONSize atomic.Int64
+
+func init() {
+	maxJSONSize.Store(DefaultMaxJSONSize)
+}
+
+// SetMaxJSONSize sets the largest JSON value, in bytes, services store in a
+// column such as a workflow's variables or a task's config. A non-positive
+// size restores DefaultMaxJSONSize.
+func SetMaxJSONSize(size int) {
+	if size <= 0 {
+		size = DefaultMaxJSONSize
+	}
+	maxJSONSize.Store(int64(size))
+}
+
+// MaxJSONSize returns the largest JSON value services store, in bytes
+func MaxJSONSize() int {
+	return int(maxJSONSize.Load())
+}
+
+// CheckJSONSize returns ErrJSONTooLarge if serialized JSON exceeds MaxJSONSize
+func CheckJSONSize(data []byte) error {
+	if limit := MaxJSONSize(); len(data) > limit {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrJSONTooLarge, len(data), limit)
+	}
+	return nil
+}
+
+// ValidateJSONSize serializes value and checks it against MaxJSONSize, naming
+// field in the error so callers can reject oversized input before storing it
+func ValidateJSONSize(field string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%s is not valid JSON: %w", field, err)
+	}
+	if err := CheckJSONSize(data); err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	return nil
+}
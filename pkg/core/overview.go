@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// More resource types reported in overviews
+const (
+	ResourceTypeSyncJob = "sync_job"
+	ResourceTypeAlert   = "alert"
+	ResourceTypeReport  = "report"
+)
+
+// CountFilter narrows a resource count
+type CountFilter struct {
+	// GroupByStatus breaks the total down by status name
+	GroupByStatus bool
+	// CreatedAfter counts only resources created after this time when set
+	CreatedAfter time.Time
+}
+
+// MergeCountFilters combines filters into one: grouping is enabled if any
+// filter asks for it and the latest CreatedAfter wins
+func MergeCountFilters(filters ...CountFilter) CountFilter {
+	var merged CountFilter
+	for _, filter := range filters {
+		merged.GroupByStatus = merged.GroupByStatus || filter.GroupByStatus
+		if filter.CreatedAfter.After(merged.CreatedAfter) {
+			merged.CreatedAfter = filter.CreatedAfter
+		}
+	}
+	return merged
+}
+
+// ResourceCount is how many resources of one type a user has
+type ResourceCount struct {
+	ResourceType string           `json:"resource_type"`
+	Total        int64            `json:"total"`
+	ByStatus     map[string]int64 `json:"by_status,omitempty"`
+}
+
+// Counter is implemented by services that can count their resources for a user
+type Counter interface {
+	Count(ctx context.Context, userID string, filters ...CountFilter) (*ResourceCount, error)
+}
+
+// Overview holds a user's resource totals across services, keyed by resource type
+type Overview struct {
+	UserID    string                    `json:"user_id"`
+	Resources map[string]*ResourceCount `json:"resources"`
+}
+
+// OverviewCoordinator aggregates resource counts across services for dashboards
+type OverviewCoordinator struct {
+	counters []Counter
+}
+
+// NewOverviewCoordinator creates a new overview coordinator
+func NewOverviewCoordinator(counters ...Counter) *OverviewCoordinator {
+	return &OverviewCoordinator{counters: counters}
+}
+
+// Overview counts the user's resources in every service
+func (c *OverviewCoordinator) Overview(ctx context.Context, userID string, filters ...CountFilter) (*Overview, error) {
+	if err := ValidateRequired(userID, "user ID"); err != nil {
+		return nil, err
+	}
+
+	overview := &Overview{
+		UserID:    userID,
+		Resources: make(map[string]*ResourceCount, len(c.counters)),
+	}
+	for _, counter := range c.counters {
+		count, err := counter.Count(ctx, userID, filters...)
+		if err != nil {
+			return nil, fmt.Errorf("count failed: %w", err)
+		}
+		overview.Resources[count.ResourceType] = count
+	}
+
+	return overview, nil
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCounter struct {
+	count   *ResourceCount
+	err     error
+	filters []CountFilter
+}
+
+func (f *fakeCounter) Count(ctx context.Context, userID string, filters ...CountFilter) (*ResourceCount, error) {
+	f.filters = filters
+	return f.count, f.err
+}
+
+func TestOverviewCoordinator(t *testing.T) {
+	secrets := &fakeCounter{count: &ResourceCount{ResourceType: ResourceTypeSecret, Total: 4}}
+	alerts := &fakeCounter{count: &ResourceCount{ResourceType: ResourceTypeAlert, Total: 3, ByStatus: map[string]int64{"active": 1, "triggered": 2}}}
+
+	t.Run("should key counts by resource type and pass filters through", func(t *testing.T) {
+		filter := CountFilter{GroupByStatus: true}
+		overview, err := NewOverviewCoordinator(secrets, alerts).Overview(context.Background(), "user1", filter)
+		require.NoError(t, err)
+
+		assert.Equal(t, "user1", overview.UserID)
+		assert.Equal(t, int64(4), overview.Resources[ResourceTypeSecret].Total)
+		assert.Equal(t, int64(2), overview.Resources[ResourceTypeAlert].ByStatus["triggered"])
+		assert.Equal(t, []CountFilter{filter}, alerts.filters)
+	})
+
+	t.Run("should fail when a counter fails", func(t *testing.T) {
+		broken := &fakeCounter{err: errors.New("db down")}
+		_, err := NewOverviewCoordinator(secrets, broken).Overview(context.Background(), "user1")
+		assert.ErrorContains(t, err, "db down")
+	})
+
+	t.Run("should require a user", func(t *testing.T) {
+		_, err := NewOverviewCoordinator(secrets).Overview(context.Background(), "")
+		assert.Error(t, err)
+	})
+}
+
+func TestMergeCountFilters(t *testing.T) {
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+
+	merged := MergeCountFilters(CountFilter{CreatedAfter: later}, CountFilter{GroupByStatus: true, CreatedAfter: earlier})
+	assert.True(t, merged.GroupByStatus)
+	assert.Equal(t, later, merged.CreatedAfter)
+	assert.Equal(t, CountFilter{}, MergeCountFilters())
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Default page sizes of endpoints without their own limits
+const (
+	DefaultPageSize    = 100
+	DefaultMaxPageSize = 1000
+)
+
+// PageLimits bounds the page size of a list endpoint
+type PageLimits struct {
+	// Default is the page size when a request does not ask for one
+	Default int `json:"default" yaml:"default"`
+	// Max is the largest page size; larger requests are clamped to it
+	Max int `json:"max" yaml:"max"`
+}
+
+// PaginationConfig holds the page limits of every list endpoint
+type PaginationConfig struct {
+	// Default applies to endpoints not listed in Endpoints
+	Default PageLimits `json:"default" yaml:"default"`
+	// Endpoints overrides the limits of individual endpoints by name, e.g. "tasks"
+	Endpoints map[string]PageLimits `json:"endpoints" yaml:"endpoints"`
+}
+
+// DefaultPaginationConfig returns the limits used until SetPaginationConfig is called
+func DefaultPaginationConfig() PaginationConfig {
+	return PaginationConfig{
+		Default: PageLimits{Default: DefaultPageSize, Max: DefaultMaxPageSize},
+		Endpoints: map[string]PageLimits{
+			"search": {Default: 20, Max: 100},
+		},
+	}
+}
+
+var (
+	paginationMu     sync.RWMutex
+	paginationConfig = DefaultPaginationConfig()
+)
+
+// SetPaginationConfig replaces the page limits of every endpoint. Zero values
+// fall back to the global default, and a default above the maximum is lowered
+// to it.
+func SetPaginationConfig(config PaginationConfig) error {
+	if config.Default.Default < 0 || config.Default.Max < 0 {
+		return errors.New("page limits must not be negative")
+	}
+	if config.Default.Max == 0 {
+		config.Default.Max = DefaultMaxPageSize
+	}
+	if config.Default.Default == 0 {
+		config.Default.Default = min(DefaultPageSize, config.Default.Max)
+	}
+	config.Default.Default = min(config.Default.Default, config.Default.Max)
+
+	endpoints := make(map[string]PageLimits, len(config.Endpoints))
+	for name, limits := range config.Endpoints {
+		if limits.Default < 0 || limits.Max < 0 {
+			return fmt.Errorf("page limits of '%s' must not be negative", name)
+		}
+		if limits.Max == 0 {
+			limits.Max = config.Default.Max
+		}
+		if limits.Default == 0 {
+			limits.Default = config.Default.Default
+		}
+		limits.Default = min(limits.Default, limits.Max)
+		endpoints[name] = limits
+	}
+	config.Endpoints = endpoints
+
+	paginationMu.Lock()
+	defer paginationMu.Unlock()
+	paginationConfig = config
+	return nil
+}
+
+// PageLimitsFor returns the page limits of an endpoint
+func PageLimitsFor(endpoint string) PageLimits {
+	paginationMu.RLock()
+	defer paginationMu.RUnlock()
+	if limits, ok := paginationConfig.Endpoints[endpoint]; ok {
+		return limits
+	}
+	return paginationConfig.Default
+}
+
+// PageRequest is a validated request for one page of a list
+type PageRequest struct {
+	Page     int
+	PageSize int
+	// Clamped is set when the requested page size exceeded the endpoint's
+	// maximum and was lowered to it
+	Clamped bool
+}
+
+// Offset returns the index of the first item on the page
+func (p PageRequest) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// Page is one page of a list
+type Page[T any] struct {
+	Items    []T `json:"items"`
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+	Total    int `json:"total"`
+}
+
+// ParsePageRequest reads the page and page_size query parameters of a request
+// to an endpoint; limit is accepted as an alias of page_size. A page size
+// above the endpoint's maximum is clamped to it rather than rejected.
+func ParsePageRequest(r *http.Request, endpoint string) (PageRequest, error) {
+	limits := PageLimitsFor(endpoint)
+	query := r.URL.Query()
+	request := PageRequest{Page: 1, PageSize: limits.Default}
+
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return PageRequest{}, errors.New("page must be a positive integer")
+		}
+		request.Page = page
+	}
+
+	size := query.Get("page_size")
+	if size == "" {
+		size = query.Get("limit")
+	}
+	if size != "" {
+		pageSize, err := strconv.Atoi(size)
+		if err != nil || pageSize < 1 {
+			return PageRequest{}, errors.New("page_size must be a positive integer")
+		}
+		request.PageSize = pageSize
+	}
+	if request.PageSize > limits.Max {
+		request.PageSize = limits.Max
+		request.Clamped = true
+	}
+	return request, nil
+}
+
+// WritePageWarning sets a Warning header on w if the page size of request was clamped
+func WritePageWarning(w http.ResponseWriter, request PageRequest) {
+	if request.Clamped {
+		w.Header().Add("Warning", fmt.Sprintf(`299 - "page size exceeds the maximum of %d; clamped"`, request.PageSize))
+	}
+}
+
+// Paginate returns the page of items a request to an endpoint asks for, with
+// the page size bounded by the endpoint's limits so no request can make a list
+// endpoint return everything at once. When the requested size is clamped a
+// Warning header saying so is set on w.
+func Paginate[T any](w http.ResponseWriter, r *http.Request, endpoint string, items []T) (*Page[T], error) {
+	request, err := ParsePageRequest(r, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	WritePageWarning(w, request)
+
+	page := &Page[T]{Items: []T{}, Page: request.Page, PageSize: request.PageSize, Total: len(items)}
+	// A huge page number overflows the offset, which is past the end either way
+	if start := request.Offset(); start >= 0 && start < len(items) {
+		page.Items = items[start:min(start+request.PageSize, len(items))]
+	}
+	return page, nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	items := make([]int, 250)
+	for i := range items {
+		items[i] = i
+	}
+	paginate := func(endpoint, query string) (*Page[int], *httptest.ResponseRecorder, error) {
+		rec := httptest.NewRecorder()
+		page, err := Paginate(rec, httptest.NewRequest("GET", "/items?"+query, nil), endpoint, items)
+		return page, rec, err
+	}
+
+	t.Cleanup(func() { require.NoError(t, SetPaginationConfig(DefaultPaginationConfig())) })
+	require.NoError(t, SetPaginationConfig(PaginationConfig{
+		Default:   PageLimits{Default: 50, Max: 100},
+		Endpoints: map[string]PageLimits{"tasks": {Default: 10, Max: 20}},
+	}))
+
+	t.Run("should use the endpoint's default page size", func(t *testing.T) {
+		page, rec, err := paginate("secrets", "")
+		require.NoError(t, err)
+		assert.Equal(t, 1, page.Page)
+		assert.Equal(t, 50, page.PageSize)
+		assert.Equal(t, 250, page.Total)
+		assert.Equal(t, items[:50], page.Items)
+		assert.Empty(t, rec.Header().Get("Warning"))
+
+		page, _, err = paginate("tasks", "page=2")
+		require.NoError(t, err)
+		assert.Equal(t, items[10:20], page.Items)
+	})
+
+	t.Run("should clamp an over-limit request to the maximum", func(t *testing.T) {
+		page, rec, err := paginate("secrets", "limit=1000000")
+		require.NoError(t, err)
+		assert.Equal(t, 100, page.PageSize)
+		assert.Len(t, page.Items, 100)
+		assert.Contains(t, rec.Header().Get("Warning"), "maximum of 100")
+
+		page, rec, err = paginate("tasks", "page_size=500")
+		require.NoError(t, err)
+		assert.Equal(t, 20, page.PageSize)
+		assert.Len(t, page.Items, 20)
+		assert.Contains(t, rec.Header().Get("Warning"), "maximum of 20")
+	})
+
+	t.Run("should return an empty page past the end", func(t *testing.T) {
+		page, _, err := paginate("secrets", "page=10")
+		require.NoError(t, err)
+		assert.Empty(t, page.Items)
+		assert.NotNil(t, page.Items)
+
+		page, _, err = paginate("secrets", "page="+strconv.Itoa(int(^uint(0)>>1)))
+		require.NoError(t, err)
+		assert.Empty(t, page.Items)
+	})
+
+	t.Run("should reject invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"page=0", "page=x", "page_size=0", "limit=-1"} {
+			_, _, err := paginate("secrets", query)
+			assert.Error(t, err, query)
+		}
+	})
+
+	t.Run("should fill in missing limits", func(t *testing.T) {
+		require.NoError(t, SetPaginationConfig(PaginationConfig{
+			Default:   PageLimits{Max: 30},
+			Endpoints: map[string]PageLimits{"reports": {Max: 500}},
+		}))
+		assert.Equal(t, PageLimits{Default: 30, Max: 30}, PageLimitsFor("secrets"))
+		assert.Equal(t, PageLimits{Default: 30, Max: 500}, PageLimitsFor("reports"))
+
+		assert.Error(t, SetPaginationConfig(PaginationConfig{Default: PageLimits{Max: -1}}))
+	})
+}
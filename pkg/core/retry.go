@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures Retry. Delays grow from BaseDelay by Multiplier after each
+// failed attempt, capped at MaxDelay, and are randomised by up to Jitter (a
+// fraction of the delay) so callers retrying together spread out.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Multiplier  float64
+	MaxDelay    time.Duration
+	Jitter      float64
+	// Retryable reports whether an error is worth retrying; nil retries every error
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy returns a policy of 3 attempts starting at 100ms and doubling
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		Multiplier:  2,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Delay returns the wait before the retry following the given attempt (1-based),
+// without jitter
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.BaseDelay)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// Retry calls fn until it succeeds, returns an error the policy does not retry, or
+// the attempts run out, and returns fn's last error. fn receives the 1-based
+// attempt number. If ctx is done while waiting between attempts, Retry returns
+// ctx.Err().
+func Retry(ctx context.Context, policy RetryPolicy, fn func(attempt int) error) error {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(attempt); err == nil {
+			return nil
+		}
+		if attempt == attempts || (policy.Retryable != nil && !policy.Retryable(err)) {
+			return err
+		}
+
+		timer := time.NewTimer(policy.jitter(policy.Delay(attempt)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (p RetryPolicy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	spread := float64(delay) * p.Jitter
+	return time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	errTransient := errors.New("transient")
+	fast := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, Multiplier: 2}
+
+	t.Run("should succeed on the nth attempt", func(t *testing.T) {
+		var attempts []int
+		err := Retry(ctx, fast, func(attempt int) error {
+			attempts = append(attempts, attempt)
+			if attempt < 3 {
+				return errTransient
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, attempts)
+	})
+
+	t.Run("should return the last error once attempts are exhausted", func(t *testing.T) {
+		calls := 0
+		err := Retry(ctx, fast, func(attempt int) error {
+			calls++
+			return errTransient
+		})
+		assert.ErrorIs(t, err, errTransient)
+		assert.Equal(t, 5, calls)
+	})
+
+	t.Run("should stop on errors the policy does not retry", func(t *testing.T) {
+		errFatal := errors.New("fatal")
+		policy := fast
+		policy.Retryable = func(err error) bool { return errors.Is(err, errTransient) }
+
+		calls := 0
+		err := Retry(ctx, policy, func(attempt int) error {
+			calls++
+			if attempt == 2 {
+				return errFatal
+			}
+			return errTransient
+		})
+		assert.ErrorIs(t, err, errFatal)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should stop waiting when the context is cancelled", func(t *testing.T) {
+		cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		slow := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second}
+
+		calls := 0
+		start := time.Now()
+		err := Retry(cancelCtx, slow, func(attempt int) error {
+			calls++
+			return errTransient
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, calls)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("should call fn once when MaxAttempts is unset", func(t *testing.T) {
+		calls := 0
+		err := Retry(ctx, RetryPolicy{}, func(attempt int) error {
+			calls++
+			return errTransient
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, Multiplier: 2, MaxDelay: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, policy.Delay(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Delay(2))
+	assert.Equal(t, 800*time.Millisecond, policy.Delay(4))
+	assert.Equal(t, time.Second, policy.Delay(5))
+	assert.Equal(t, time.Second, policy.Delay(50))
+
+	t.Run("should keep jitter within the configured fraction", func(t *testing.T) {
+		policy.Jitter = 0.5
+		for i := 0; i < 100; i++ {
+			delay := policy.jitter(100 * time.Millisecond)
+			assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+			assert.LessOrEqual(t, delay, 150*time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned when unregistering a job that is not registered
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrNoScheduler is returned when registering a job with a nil Scheduler
+var ErrNoScheduler = errors.New("no scheduler configured")
+
+// Job is periodic work run by a Scheduler
+type Job struct {
+	// Name identifies the job; it must be unique within a scheduler
+	Name     string
+	Schedule Schedule
+	// Jitter delays each run by a random duration below it, so instances
+	// sharing a schedule do not all run at once
+	Jitter time.Duration
+	// Run does the work. Its context is cancelled when the job is
+	// unregistered or the scheduler closes.
+	Run func(ctx context.Context) error
+}
+
+// JobStatus describes a registered job
+type JobStatus struct {
+	Name      string    `json:"name"`
+	Running   bool      `json:"running"`
+	Runs      int64     `json:"runs"`
+	Skipped   int64     `json:"skipped"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	NextRun   time.Time `json:"next_run,omitempty"`
+}
+
+type scheduledJob struct {
+	job    Job
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the loop and any run have returned
+
+	mu     sync.Mutex
+	status JobStatus
+}
+
+// Scheduler runs registered jobs on interval or cron schedules, so services
+// share one implementation of periodic work instead of each running its own
+// ticker loop. A job never overlaps itself: a run that is due while the
+// previous one is still going is skipped.
+//
+// A nil Scheduler has no jobs and refuses new ones, so a service that was not
+// given one runs no periodic work.
+type Scheduler struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	jobs   map[string]*scheduledJob
+	closed bool
+}
+
+// NewScheduler creates a scheduler with no jobs
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		now:  time.Now,
+		jobs: make(map[string]*scheduledJob),
+	}
+}
+
+// Register validates a job and starts scheduling it
+func (s *Scheduler) Register(job Job) error {
+	if s == nil {
+		return ErrNoScheduler
+	}
+	if job.Name == "" {
+		return errors.New("job name is required")
+	}
+	if job.Schedule == nil || job.Run == nil {
+		return fmt.Errorf("job '%s' requires a schedule and a run function", job.Name)
+	}
+	if interval, ok := job.Schedule.(intervalSchedule); ok && interval.interval <= 0 {
+		return fmt.Errorf("job '%s' interval must be positive", job.Name)
+	}
+	if job.Jitter < 0 {
+		return fmt.Errorf("job '%s' jitter must not be negative", job.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("scheduler is closed")
+	}
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("job '%s' is already registered", job.Name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduled := &scheduledJob{
+		job:    job,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: JobStatus{Name: job.Name},
+	}
+	s.jobs[job.Name] = scheduled
+	go s.loop(ctx, scheduled)
+	return nil
+}
+
+// Unregister stops scheduling a job, cancels a run in progress and waits for
+// it to return or for ctx to be done
+func (s *Scheduler) Unregister(ctx context.Context, name string) error {
+	if s == nil {
+		return fmt.Errorf("%w: '%s'", ErrJobNotFound, name)
+	}
+	s.mu.Lock()
+	scheduled, ok := s.jobs[name]
+	delete(s.jobs, name)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: '%s'", ErrJobNotFound, name)
+	}
+	return scheduled.stop(ctx)
+}
+
+// Close unregisters every job, waiting for runs in progress to return or for
+// ctx to be done. Jobs cannot be registered after Close.
+func (s *Scheduler) Close(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	s.closed = true
+	jobs := s.jobs
+	s.jobs = make(map[string]*scheduledJob)
+	s.mu.Unlock()
+
+	for _, scheduled := range jobs {
+		scheduled.cancel()
+	}
+	var errs []error
+	for _, scheduled := range jobs {
+		if err := scheduled.stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("job '%s': %w", scheduled.job.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Jobs describes the registered jobs, sorted by name
+func (s *Scheduler) Jobs() []JobStatus {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	jobs := make([]*scheduledJob, 0, len(s.jobs))
+	for _, scheduled := range s.jobs {
+		jobs = append(jobs, scheduled)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, scheduled := range jobs {
+		scheduled.mu.Lock()
+		statuses = append(statuses, scheduled.status)
+		scheduled.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// loop waits for each due time and starts a run, unless one is still going
+func (s *Scheduler) loop(ctx context.Context, scheduled *scheduledJob) {
+	var runs sync.WaitGroup
+	defer func() {
+		runs.Wait()
+		close(scheduled.done)
+	}()
+
+	next := scheduled.job.Schedule.Next(s.now())
+	for !next.IsZero() {
+		fireAt := next
+		if scheduled.job.Jitter > 0 {
+			fireAt = fireAt.Add(time.Duration(rand.Int63n(int64(scheduled.job.Jitter))))
+		}
+		scheduled.mu.Lock()
+		scheduled.status.NextRun = fireAt
+		scheduled.mu.Unlock()
+
+		timer := time.NewTimer(fireAt.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		scheduled.mu.Lock()
+		if scheduled.status.Running {
+			scheduled.status.Skipped++
+			scheduled.mu.Unlock()
+			log.Printf("⚠️  Skipped job '%s': previous run still in progress", scheduled.job.Name)
+		} else {
+			scheduled.status.Running = true
+			scheduled.mu.Unlock()
+			runs.Add(1)
+			go func() {
+				defer runs.Done()
+				s.run(ctx, scheduled)
+			}()
+		}
+
+		// Schedule from the time the run was due, so runs do not drift, but
+		// do not try to catch up on runs missed while the process was paused
+		next = scheduled.job.Schedule.Next(next)
+		if now := s.now(); !next.IsZero() && next.Before(now) {
+			next = scheduled.job.Schedule.Next(now)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, scheduled *scheduledJob) {
+	started := s.now()
+	err := safeRun(ctx, scheduled.job.Run)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("⚠️  Job '%s' failed: %v", scheduled.job.Name, err)
+	}
+
+	scheduled.mu.Lock()
+	defer scheduled.mu.Unlock()
+	scheduled.status.Running = false
+	scheduled.status.Runs++
+	scheduled.status.LastRun = started
+	scheduled.status.LastError = ""
+	if err != nil {
+		scheduled.status.LastError = err.Error()
+	}
+}
+
+// safeRun turns a panicking job into an error, so one bad job cannot take the
+// process down
+func safeRun(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
+
+func (j *scheduledJob) stop(ctx context.Context) error {
+	j.cancel()
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
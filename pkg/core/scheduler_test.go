@@ -0,0 +1,212 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Run("should run interval jobs repeatedly", func(t *testing.T) {
+		scheduler := NewScheduler()
+		defer scheduler.Close(context.Background())
+
+		var runs int32
+		require.NoError(t, scheduler.Register(Job{
+			Name:     "tick",
+			Schedule: Every(10 * time.Millisecond),
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			},
+		}))
+
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, 2*time.Second, 5*time.Millisecond)
+		jobs := scheduler.Jobs()
+		require.Len(t, jobs, 1)
+		assert.Equal(t, "tick", jobs[0].Name)
+		assert.False(t, jobs[0].LastRun.IsZero())
+	})
+
+	t.Run("should skip runs while the previous one is in progress", func(t *testing.T) {
+		scheduler := NewScheduler()
+		defer scheduler.Close(context.Background())
+
+		var runs int32
+		release := make(chan struct{})
+		require.NoError(t, scheduler.Register(Job{
+			Name:     "slow",
+			Schedule: Every(5 * time.Millisecond),
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				<-release
+				return nil
+			},
+		}))
+
+		assert.Eventually(t, func() bool { return scheduler.Jobs()[0].Skipped >= 3 }, 2*time.Second, 5*time.Millisecond)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+		assert.True(t, scheduler.Jobs()[0].Running)
+
+		close(release)
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, 2*time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("should record the last error", func(t *testing.T) {
+		scheduler := NewScheduler()
+		defer scheduler.Close(context.Background())
+
+		require.NoError(t, scheduler.Register(Job{
+			Name:     "failing",
+			Schedule: Every(5 * time.Millisecond),
+			Run:      func(ctx context.Context) error { return errors.New("boom") },
+		}))
+
+		assert.Eventually(t, func() bool { return scheduler.Jobs()[0].LastError == "boom" }, 2*time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("should cancel running jobs and wait for them on close", func(t *testing.T) {
+		scheduler := NewScheduler()
+		started := make(chan struct{})
+		var finished int32
+		require.NoError(t, scheduler.Register(Job{
+			Name:     "long",
+			Schedule: Every(time.Millisecond),
+			Run: func(ctx context.Context) error {
+				if atomic.LoadInt32(&finished) == 0 {
+					close(started)
+				}
+				<-ctx.Done()
+				atomic.StoreInt32(&finished, 1)
+				return ctx.Err()
+			},
+		}))
+		<-started
+
+		require.NoError(t, scheduler.Close(context.Background()))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+		assert.Empty(t, scheduler.Jobs())
+		assert.Error(t, scheduler.Register(Job{Name: "late", Schedule: Every(time.Second), Run: func(ctx context.Context) error { return nil }}))
+	})
+
+	t.Run("should give up waiting when the shutdown deadline passes", func(t *testing.T) {
+		scheduler := NewScheduler()
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		require.NoError(t, scheduler.Register(Job{
+			Name:     "stuck",
+			Schedule: Every(time.Millisecond),
+			Run: func(ctx context.Context) error {
+				close(started)
+				<-release
+				return nil
+			},
+		}))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := scheduler.Close(ctx)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("should stop a job when it is unregistered", func(t *testing.T) {
+		scheduler := NewScheduler()
+		defer scheduler.Close(context.Background())
+
+		var runs int32
+		require.NoError(t, scheduler.Register(Job{
+			Name:     "tick",
+			Schedule: Every(5 * time.Millisecond),
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			},
+		}))
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 1 }, 2*time.Second, 5*time.Millisecond)
+
+		require.NoError(t, scheduler.Unregister(context.Background(), "tick"))
+		stopped := atomic.LoadInt32(&runs)
+		time.Sleep(30 * time.Millisecond)
+		assert.Equal(t, stopped, atomic.LoadInt32(&runs))
+		assert.True(t, errors.Is(scheduler.Unregister(context.Background(), "tick"), ErrJobNotFound))
+	})
+
+	t.Run("should reject invalid and duplicate jobs", func(t *testing.T) {
+		scheduler := NewScheduler()
+		defer scheduler.Close(context.Background())
+		run := func(ctx context.Context) error { return nil }
+
+		assert.Error(t, scheduler.Register(Job{Schedule: Every(time.Second), Run: run}))
+		assert.Error(t, scheduler.Register(Job{Name: "a", Run: run}))
+		assert.Error(t, scheduler.Register(Job{Name: "a", Schedule: Every(0), Run: run}))
+		assert.Error(t, scheduler.Register(Job{Name: "a", Schedule: Every(time.Second), Jitter: -time.Second, Run: run}))
+
+		require.NoError(t, scheduler.Register(Job{Name: "a", Schedule: Every(time.Hour), Jitter: time.Minute, Run: run}))
+		assert.Error(t, scheduler.Register(Job{Name: "a", Schedule: Every(time.Hour), Run: run}))
+
+		assert.Eventually(t, func() bool { return !scheduler.Jobs()[0].NextRun.IsZero() }, 2*time.Second, time.Millisecond)
+		next := scheduler.Jobs()[0].NextRun
+		assert.True(t, next.After(time.Now().Add(59*time.Minute)))
+		assert.True(t, next.Before(time.Now().Add(61*time.Minute)))
+	})
+
+	t.Run("should run nothing without a scheduler", func(t *testing.T) {
+		var scheduler *Scheduler
+		run := func(ctx context.Context) error { return nil }
+
+		assert.ErrorIs(t, scheduler.Register(Job{Name: "a", Schedule: Every(time.Second), Run: run}), ErrNoScheduler)
+		assert.ErrorIs(t, scheduler.Unregister(context.Background(), "a"), ErrJobNotFound)
+		assert.Empty(t, scheduler.Jobs())
+		assert.NoError(t, scheduler.Close(context.Background()))
+	})
+}
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC) // a Monday
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 12, 15, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 1, 2, 2, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week restricted: either matches
+		{"0 0 20 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.next, schedule.Next(base))
+		})
+	}
+
+	t.Run("should never match impossible dates", func(t *testing.T) {
+		schedule, err := ParseCron("0 0 30 2 *")
+		require.NoError(t, err)
+		assert.True(t, schedule.Next(base).IsZero())
+	})
+
+	t.Run("should reject invalid expressions", func(t *testing.T) {
+		for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+			_, err := ParseCron(expr)
+			assert.Error(t, err, expr)
+		}
+	})
+}
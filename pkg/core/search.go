@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Resource types returned in search hits
+const (
+	ResourceTypeSecret      = "secret"
+	ResourceTypeWorkflow    = "workflow"
+	ResourceTypeTask        = "task"
+	ResourceTypeIntegration = "integration"
+)
+
+// SearchHit represents a single search result
+type SearchHit struct {
+	ResourceType string  `json:"resource_type"`
+	ID           string  `json:"id"`
+	Title        string  `json:"title"`
+	Description  string  `json:"description,omitempty"`
+	Score        float64 `json:"score"`
+}
+
+// SearchResults represents a page of search results
+type SearchResults struct {
+	Query    string       `json:"query"`
+	Hits     []*SearchHit `json:"hits"`
+	Total    int          `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
+
+// Searcher is implemented by services that can search their resources for a user
+type Searcher interface {
+	Search(ctx context.Context, userID, query string, limit int) ([]*SearchHit, error)
+}
+
+// SearchCoordinator aggregates search results across services
+type SearchCoordinator struct {
+	searchers   []Searcher
+	maxPerIndex int
+}
+
+// NewSearchCoordinator creates a new search coordinator
+func NewSearchCoordinator(searchers ...Searcher) *SearchCoordinator {
+	return &SearchCoordinator{
+		searchers:   searchers,
+		maxPerIndex: 100,
+	}
+}
+
+// Search queries every searcher, orders hits by relevance and returns the requested page
+func (c *SearchCoordinator) Search(ctx context.Context, userID, query string, page, pageSize int) (*SearchResults, error) {
+	if err := ValidateRequired(userID, "user ID"); err != nil {
+		return nil, err
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("query is required")
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	hits := make([]*SearchHit, 0)
+	for _, searcher := range c.searchers {
+		found, err := searcher.Search(ctx, userID, query, c.maxPerIndex)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		hits = append(hits, found...)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].ResourceType != hits[j].ResourceType {
+			return hits[i].ResourceType < hits[j].ResourceType
+		}
+		return hits[i].Title < hits[j].Title
+	})
+
+	results := &SearchResults{
+		Query:    query,
+		Hits:     []*SearchHit{},
+		Total:    len(hits),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	start := (page - 1) * pageSize
+	if start < len(hits) {
+		end := start + pageSize
+		if end > len(hits) {
+			end = len(hits)
+		}
+		results.Hits = hits[start:end]
+	}
+
+	return results, nil
+}
+
+// MatchScore scores how well a query matches a value, ignoring case:
+// 1 for an exact match, 0.75 for a prefix match, 0.5 for a substring match and 0 otherwise
+func MatchScore(query, value string) float64 {
+	query = strings.ToLower(strings.TrimSpace(query))
+	value = strings.ToLower(value)
+	switch {
+	case query == "":
+		return 0
+	case value == query:
+		return 1
+	case strings.HasPrefix(value, query):
+		return 0.75
+	case strings.Contains(value, query):
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+// LikePattern builds a case-insensitive substring pattern for SQL LIKE ... ESCAPE '\'
+func LikePattern(query string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + escaper.Replace(strings.ToLower(strings.TrimSpace(query))) + "%"
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSearcher struct {
+	hits  []*SearchHit
+	err   error
+	limit int
+}
+
+func (f *fakeSearcher) Search(ctx context.Context, userID, query string, limit int) ([]*SearchHit, error) {
+	f.limit = limit
+	return f.hits, f.err
+}
+
+func TestSearchCoordinator(t *testing.T) {
+	secrets := &fakeSearcher{hits: []*SearchHit{
+		{ResourceType: ResourceTypeSecret, ID: "deploy-key", Title: "deploy-key", Score: 0.75},
+	}}
+	workflows := &fakeSearcher{hits: []*SearchHit{
+		{ResourceType: ResourceTypeWorkflow, ID: "1", Title: "deploy", Score: 1},
+		{ResourceType: ResourceTypeWorkflow, ID: "2", Title: "nightly", Score: 0.3},
+	}}
+	tasks := &fakeSearcher{hits: []*SearchHit{
+		{ResourceType: ResourceTypeTask, ID: "7", Title: "deploy-api", Score: 0.75},
+	}}
+	coordinator := NewSearchCoordinator(secrets, workflows, tasks)
+
+	t.Run("should merge hits ordered by score then type", func(t *testing.T) {
+		results, err := coordinator.Search(context.Background(), "user1", "deploy", 1, 10)
+		require.NoError(t, err)
+
+		assert.Equal(t, 4, results.Total)
+		require.Len(t, results.Hits, 4)
+		assert.Equal(t, "1", results.Hits[0].ID)
+		assert.Equal(t, ResourceTypeSecret, results.Hits[1].ResourceType)
+		assert.Equal(t, ResourceTypeTask, results.Hits[2].ResourceType)
+		assert.Equal(t, "2", results.Hits[3].ID)
+		assert.Equal(t, 100, secrets.limit)
+	})
+
+	t.Run("should paginate results", func(t *testing.T) {
+		results, err := coordinator.Search(context.Background(), "user1", "deploy", 2, 3)
+		require.NoError(t, err)
+		assert.Equal(t, 4, results.Total)
+		require.Len(t, results.Hits, 1)
+		assert.Equal(t, "2", results.Hits[0].ID)
+
+		results, err = coordinator.Search(context.Background(), "user1", "deploy", 3, 3)
+		require.NoError(t, err)
+		assert.Empty(t, results.Hits)
+	})
+
+	t.Run("should require a user and query", func(t *testing.T) {
+		_, err := coordinator.Search(context.Background(), "", "deploy", 1, 10)
+		assert.Error(t, err)
+
+		_, err = coordinator.Search(context.Background(), "user1", "  ", 1, 10)
+		assert.Error(t, err)
+	})
+
+	t.Run("should fail when a searcher fails", func(t *testing.T) {
+		failing := NewSearchCoordinator(secrets, &fakeSearcher{err: errors.New("boom")})
+		_, err := failing.Search(context.Background(), "user1", "deploy", 1, 10)
+		assert.ErrorContains(t, err, "boom")
+	})
+}
+
+func TestMatchScore(t *testing.T) {
+	assert.Equal(t, 1.0, MatchScore("Deploy", "deploy"))
+	assert.Equal(t, 0.75, MatchScore("dep", "Deploy-API"))
+	assert.Equal(t, 0.5, MatchScore("api", "deploy-api"))
+	assert.Equal(t, 0.0, MatchScore("db", "deploy-api"))
+	assert.Equal(t, 0.0, MatchScore("", "deploy"))
+}
+
+func TestLikePattern(t *testing.T) {
+	assert.Equal(t, "%deploy%", LikePattern(" Deploy "))
+	assert.Equal(t, `%50\%\_off\\%`, LikePattern(`50%_off\`))
+}
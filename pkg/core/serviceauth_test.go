@@ -0,0 +1,109 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceAuth(t *testing.T) {
+	auth := NewServiceAuth("shared-key", time.Minute)
+
+	t.Run("should verify a minted token", func(t *testing.T) {
+		token, err := auth.Mint("api-gateway")
+		require.NoError(t, err)
+		service, err := auth.Verify(token)
+		require.NoError(t, err)
+		assert.Equal(t, "api-gateway", service)
+
+		_, err = auth.Mint("api.gateway")
+		assert.ErrorContains(t, err, "invalid service name")
+	})
+
+	t.Run("should reject forged and expired tokens", func(t *testing.T) {
+		token, err := NewServiceAuth("other-key", time.Minute).Mint("api-gateway")
+		require.NoError(t, err)
+		_, err = auth.Verify(token)
+		assert.ErrorIs(t, err, ErrServiceToken)
+
+		token, err = auth.Mint("api-gateway")
+		require.NoError(t, err)
+		_, err = auth.Verify("flow" + token[len("api-gateway"):])
+		assert.ErrorIs(t, err, ErrServiceToken, "the service name is signed")
+
+		expired := NewServiceAuth("shared-key", time.Minute)
+		expired.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+		token, err = expired.Mint("api-gateway")
+		require.NoError(t, err)
+		_, err = auth.Verify(token)
+		assert.ErrorContains(t, err, "expired")
+
+		for _, malformed := range []string{"", "api-gateway", "a.b", ".1.sig", "a.b.c.d"} {
+			_, err = auth.Verify(malformed)
+			assert.ErrorIs(t, err, ErrServiceToken, malformed)
+		}
+	})
+
+	t.Run("should only pass requests with a valid token", func(t *testing.T) {
+		handler := auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		serve := func(path, token string) int {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if token != "" {
+				req.Header.Set(ServiceTokenHeader, token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder.Code
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, serve("/api/v1/secrets", ""))
+		assert.Equal(t, http.StatusUnauthorized, serve("/api/v1/secrets", "flow.9999999999.forged"))
+		assert.Equal(t, http.StatusNoContent, serve("/health", ""), "health checks need no token")
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets", nil)
+		require.NoError(t, auth.Sign(req, "api-gateway"))
+		assert.Equal(t, http.StatusNoContent, serve("/api/v1/secrets", req.Header.Get(ServiceTokenHeader)))
+	})
+
+	t.Run("should pass everything when disabled", func(t *testing.T) {
+		disabled, err := DefaultServiceAuthConfig().NewServiceAuth()
+		require.NoError(t, err)
+		assert.Nil(t, disabled)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets", nil)
+		require.NoError(t, disabled.Sign(req, "api-gateway"))
+		assert.Empty(t, req.Header.Get(ServiceTokenHeader))
+
+		recorder := httptest.NewRecorder()
+		disabled.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+	})
+
+	t.Run("should read the key from the environment", func(t *testing.T) {
+		config := DefaultServiceAuthConfig()
+		config.Enabled = true
+		config.KeyEnv = "VERTEX_TEST_SERVICE_KEY"
+		_, err := config.NewServiceAuth()
+		assert.ErrorContains(t, err, "VERTEX_TEST_SERVICE_KEY is not set")
+
+		t.Setenv("VERTEX_TEST_SERVICE_KEY", "shared-key")
+		enabled, err := config.NewServiceAuth()
+		require.NoError(t, err)
+		token, err := enabled.Mint("api-gateway")
+		require.NoError(t, err)
+		_, err = auth.Verify(token)
+		assert.NoError(t, err)
+
+		assert.ErrorContains(t, ServiceAuthConfig{Enabled: true}.Validate(), "service key env variable is required")
+		assert.ErrorContains(t, ServiceAuthConfig{Enabled: true, KeyEnv: "K"}.Validate(), "TTL must be positive")
+		assert.NoError(t, ServiceAuthConfig{}.Validate())
+	})
+}
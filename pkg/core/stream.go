@@ -0,0 +1,120 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrStreamClosed is returned when writing to a ResultStream that has ended
+var ErrStreamClosed = errors.New("result stream closed")
+
+// ResultStream writes a Result envelope whose data is an array streamed to w
+// one item at a time, so large collections are never held in memory. The
+// envelope is written as {"data":[...],"success":...,"timestamp":...} with
+// success last, which lets a stream that fails partway end as a failed Result
+// carrying the error. It is not safe for concurrent use.
+type ResultStream struct {
+	w      io.Writer
+	count  int
+	err    error
+	closed bool
+}
+
+// NewResultStream starts a Result envelope on w
+func NewResultStream(w io.Writer) (*ResultStream, error) {
+	if _, err := io.WriteString(w, `{"data":[`); err != nil {
+		return nil, fmt.Errorf("failed to write result stream: %w", err)
+	}
+	return &ResultStream{w: w}, nil
+}
+
+// Write appends item to the data array
+func (s *ResultStream) Write(item interface{}) error {
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode item %d: %w", s.count, err)
+	}
+	if s.count > 0 {
+		data = append([]byte{','}, data...)
+	}
+	if _, err := s.w.Write(data); err != nil {
+		s.err = fmt.Errorf("failed to write result stream: %w", err)
+		return s.err
+	}
+	s.count++
+	return nil
+}
+
+// Count returns the number of items written
+func (s *ResultStream) Count() int {
+	return s.count
+}
+
+// Close ends the envelope as a successful Result
+func (s *ResultStream) Close() error {
+	return s.end(nil)
+}
+
+// Fail ends the envelope as a failed Result carrying cause. Items already
+// written stay in its data.
+func (s *ResultStream) Fail(cause error) error {
+	return s.end(cause)
+}
+
+func (s *ResultStream) end(cause error) error {
+	if s.closed {
+		return ErrStreamClosed
+	}
+	s.closed = true
+	if s.err != nil {
+		return s.err
+	}
+
+	tail := struct {
+		Success   bool      `json:"success"`
+		Error     string    `json:"error,omitempty"`
+		Timestamp time.Time `json:"timestamp"`
+	}{Success: cause == nil, Timestamp: time.Now()}
+	if cause != nil {
+		tail.Error = cause.Error()
+	}
+	data, err := json.Marshal(tail)
+	if err != nil {
+		return fmt.Errorf("failed to encode result stream: %w", err)
+	}
+	// Splice the tail's fields in after the array: ],"success":...}
+	data[0] = ','
+	if _, err := io.WriteString(s.w, "]"); err != nil {
+		return fmt.Errorf("failed to write result stream: %w", err)
+	}
+	if _, err := s.w.Write(data); err != nil {
+		return fmt.Errorf("failed to write result stream: %w", err)
+	}
+	return nil
+}
+
+// StreamResult writes a Result envelope to w whose data holds the items
+// produce emits. If produce fails, the envelope ends as a failed Result and
+// the error is returned.
+func StreamResult(w io.Writer, produce func(emit func(item interface{}) error) error) error {
+	stream, err := NewResultStream(w)
+	if err != nil {
+		return err
+	}
+	if err := produce(stream.Write); err != nil {
+		if failErr := stream.Fail(err); failErr != nil {
+			return errors.Join(err, failErr)
+		}
+		return err
+	}
+	return stream.Close()
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type streamedMetric struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+func TestResultStream(t *testing.T) {
+	t.Run("should stream a large collection as a valid Result envelope", func(t *testing.T) {
+		const items = 20000
+		reader, writer := io.Pipe()
+		written := make(chan error, 1)
+		go func() {
+			err := StreamResult(writer, func(emit func(item interface{}) error) error {
+				for i := 0; i < items; i++ {
+					if err := emit(streamedMetric{Name: "cpu", Value: float64(i)}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			writer.CloseWithError(err)
+			written <- err
+		}()
+
+		// The pipe holds nothing, so the envelope must be decodable as it is written
+		var result struct {
+			Result
+			Data []streamedMetric `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(reader).Decode(&result))
+		require.NoError(t, <-written)
+
+		assert.True(t, result.Success)
+		assert.Empty(t, result.Error)
+		assert.WithinDuration(t, time.Now(), result.Timestamp, time.Second)
+		require.Len(t, result.Data, items)
+		assert.Equal(t, streamedMetric{Name: "cpu", Value: items - 1}, result.Data[items-1])
+	})
+
+	t.Run("should write an empty array for an empty collection", func(t *testing.T) {
+		var buf bytes.Buffer
+		stream, err := NewResultStream(&buf)
+		require.NoError(t, err)
+		require.NoError(t, stream.Close())
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &result))
+		assert.Equal(t, []interface{}{}, result["data"])
+		assert.Equal(t, true, result["success"])
+	})
+
+	t.Run("should end as a failed Result when producing fails", func(t *testing.T) {
+		var buf bytes.Buffer
+		cause := errors.New("audit store unavailable")
+		err := StreamResult(&buf, func(emit func(item interface{}) error) error {
+			require.NoError(t, emit("first"))
+			return cause
+		})
+		assert.ErrorIs(t, err, cause)
+
+		var result Result
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &result))
+		assert.False(t, result.Success)
+		assert.Equal(t, "audit store unavailable", result.Error)
+		assert.Equal(t, []interface{}{"first"}, result.Data)
+	})
+
+	t.Run("should reject items that cannot be encoded and writes after the end", func(t *testing.T) {
+		var buf bytes.Buffer
+		stream, err := NewResultStream(&buf)
+		require.NoError(t, err)
+
+		assert.ErrorContains(t, stream.Write(func() {}), "failed to encode item 0")
+		require.NoError(t, stream.Write(1))
+		assert.Equal(t, 1, stream.Count())
+		require.NoError(t, stream.Close())
+
+		assert.ErrorIs(t, stream.Write(2), ErrStreamClosed)
+		assert.ErrorIs(t, stream.Close(), ErrStreamClosed)
+		assert.True(t, json.Valid(buf.Bytes()))
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -42,32 +43,15 @@ func EncryptAES(data []byte, password string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+	sealed, err := EncryptWithKey(data, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	// Generate nonce
-	nonce, err := GenerateRandomBytes(NonceLength)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		return nil, err
 	}
 
-	// Encrypt data
-	ciphertext := gcm.Seal(nil, nonce, data, nil)
-
 	// Combine salt + nonce + ciphertext
-	result := make([]byte, 0, SaltLength+NonceLength+len(ciphertext))
+	result := make([]byte, 0, SaltLength+len(sealed))
 	result = append(result, salt...)
-	result = append(result, nonce...)
-	result = append(result, ciphertext...)
+	result = append(result, sealed...)
 
 	return result, nil
 }
@@ -82,38 +66,65 @@ func DecryptAES(encryptedData []byte, password string) ([]byte, error) {
 		return nil, errors.New("encrypted data too short")
 	}
 
-	// Extract salt, nonce, and ciphertext
-	salt := encryptedData[:SaltLength]
-	nonce := encryptedData[SaltLength : SaltLength+NonceLength]
-	ciphertext := encryptedData[SaltLength+NonceLength:]
-
 	// Derive key from password and salt
-	key, err := DeriveKey(password, salt)
+	key, err := DeriveKey(password, encryptedData[:SaltLength])
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+	return DecryptWithKey(encryptedData[SaltLength:], key)
+}
+
+// EncryptWithKey encrypts data using AES-256-GCM with a key that needs no
+// stretching, such as one from DeriveSubkey. The result is the nonce followed
+// by the ciphertext.
+func EncryptWithKey(data, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, err
 	}
 
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
+	// Generate nonce
+	nonce, err := GenerateRandomBytes(NonceLength)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	// Decrypt data
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// DecryptWithKey decrypts data encrypted by EncryptWithKey
+func DecryptWithKey(encryptedData, key []byte) ([]byte, error) {
+	if len(encryptedData) < NonceLength {
+		return nil, errors.New("encrypted data too short")
+	}
+
+	gcm, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %w", err)
+		return nil, err
 	}
 
+	plaintext, err := gcm.Open(nil, encryptedData[:NonceLength], encryptedData[NonceLength:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
 	return plaintext, nil
 }
 
+// newGCM creates an AES-GCM cipher for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
 // DeriveKey derives a key from password and salt using PBKDF2
 func DeriveKey(password string, salt []byte) ([]byte, error) {
 	if password == "" {
@@ -127,6 +138,20 @@ func DeriveKey(password string, salt []byte) ([]byte, error) {
 	return key, nil
 }
 
+// DeriveSubkey derives a key for one purpose from a master secret using
+// HKDF-SHA256. Different info strings give independent keys.
+func DeriveSubkey(secret []byte, info string) ([]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret cannot be empty")
+	}
+
+	key := make([]byte, KeyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(info)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive subkey: %w", err)
+	}
+	return key, nil
+}
+
 // GenerateSalt generates a random salt
 func GenerateSalt() ([]byte, error) {
 	return GenerateRandomBytes(SaltLength)
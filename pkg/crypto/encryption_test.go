@@ -94,6 +94,64 @@ func TestKeyDerivation(t *testing.T) {
 	})
 }
 
+func TestDeriveSubkey(t *testing.T) {
+	t.Run("should derive consistent keys for the same info", func(t *testing.T) {
+		key1, err := DeriveSubkey([]byte("master"), "user:alice")
+		require.NoError(t, err)
+		key2, err := DeriveSubkey([]byte("master"), "user:alice")
+		require.NoError(t, err)
+
+		assert.Equal(t, key1, key2)
+		assert.Len(t, key1, KeyLength)
+	})
+
+	t.Run("should derive different keys for different info", func(t *testing.T) {
+		key1, err := DeriveSubkey([]byte("master"), "user:alice")
+		require.NoError(t, err)
+		key2, err := DeriveSubkey([]byte("master"), "user:bob")
+		require.NoError(t, err)
+
+		assert.NotEqual(t, key1, key2)
+	})
+
+	t.Run("should reject an empty secret", func(t *testing.T) {
+		_, err := DeriveSubkey(nil, "user:alice")
+		assert.Error(t, err)
+	})
+}
+
+func TestEncryptWithKey(t *testing.T) {
+	key, err := DeriveSubkey([]byte("master"), "user:alice")
+	require.NoError(t, err)
+
+	t.Run("should encrypt and decrypt data successfully", func(t *testing.T) {
+		encrypted, err := EncryptWithKey([]byte("secret data"), key)
+		require.NoError(t, err)
+		assert.Len(t, encrypted, NonceLength+len("secret data")+16)
+
+		decrypted, err := DecryptWithKey(encrypted, key)
+		require.NoError(t, err)
+		assert.Equal(t, "secret data", string(decrypted))
+	})
+
+	t.Run("should fail decryption with another key", func(t *testing.T) {
+		other, err := DeriveSubkey([]byte("master"), "user:bob")
+		require.NoError(t, err)
+		encrypted, err := EncryptWithKey([]byte("secret data"), key)
+		require.NoError(t, err)
+
+		_, err = DecryptWithKey(encrypted, other)
+		assert.Error(t, err)
+		_, err = DecryptWithKey(encrypted[:NonceLength-1], key)
+		assert.Error(t, err)
+	})
+
+	t.Run("should reject keys of the wrong length", func(t *testing.T) {
+		_, err := EncryptWithKey([]byte("secret data"), []byte("short"))
+		assert.Error(t, err)
+	})
+}
+
 func TestGenerateSalt(t *testing.T) {
 	t.Run("should generate salt of correct length", func(t *testing.T) {
 		salt, err := GenerateSalt()
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+)
+
+// ErrUnavailable is returned without touching the database while the circuit is open
+var ErrUnavailable = core.NewCodedError(core.ErrorCodeUnavailable, "database unavailable: circuit breaker is open")
+
+const circuitBreakerName = "vertex:circuit_breaker"
+
+// CircuitState represents the state of a circuit breaker
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String returns the string representation of CircuitState
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker fails database calls fast once the database looks unreachable.
+// After FailureThreshold consecutive connection failures it opens and rejects
+// calls with ErrUnavailable; once OpenTimeout has passed it lets a single probe
+// call through, closing again if the probe succeeds.
+//
+// It is a gorm plugin: install it with db.Use.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// IsFailure reports whether an error means the database is unreachable, as
+	// opposed to a failed query; defaults to IsConnectionError
+	IsFailure func(error) bool
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		IsFailure:        IsConnectionError,
+		now:              time.Now,
+	}
+}
+
+// Name implements gorm.Plugin
+func (b *CircuitBreaker) Name() string {
+	return circuitBreakerName
+}
+
+// Initialize implements gorm.Plugin by guarding every kind of database call
+func (b *CircuitBreaker) Initialize(db *gorm.DB) error {
+	type registrar interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+
+	callbacks := db.Callback()
+	hooks := []struct {
+		name          string
+		before, after registrar
+	}{
+		{"create", callbacks.Create().Before("*"), callbacks.Create().After("*")},
+		{"query", callbacks.Query().Before("*"), callbacks.Query().After("*")},
+		{"update", callbacks.Update().Before("*"), callbacks.Update().After("*")},
+		{"delete", callbacks.Delete().Before("*"), callbacks.Delete().After("*")},
+		{"row", callbacks.Row().Before("*"), callbacks.Row().After("*")},
+		{"raw", callbacks.Raw().Before("*"), callbacks.Raw().After("*")},
+	}
+	for _, hook := range hooks {
+		if err := hook.before.Register("vertex:circuit_breaker_before_"+hook.name, b.beforeCall); err != nil {
+			return err
+		}
+		if err := hook.after.Register("vertex:circuit_breaker_after_"+hook.name, b.afterCall); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) beforeCall(db *gorm.DB) {
+	if err := b.Allow(); err != nil {
+		db.AddError(err)
+	}
+}
+
+func (b *CircuitBreaker) afterCall(db *gorm.DB) {
+	// Calls rejected by the breaker never reached the database
+	if errors.Is(db.Error, ErrUnavailable) {
+		return
+	}
+	b.Record(db.Error)
+}
+
+// Allow returns ErrUnavailable if a call should not be attempted. In the half-open
+// state only one probe call is allowed at a time.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case CircuitOpen:
+		return ErrUnavailable
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrUnavailable
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record feeds the outcome of a call into the breaker
+func (b *CircuitBreaker) Record(err error) {
+	isFailure := b.IsFailure
+	if isFailure == nil {
+		isFailure = IsConnectionError
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.currentState()
+	b.probing = false
+	if err == nil || !isFailure(err) {
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if state == CircuitHalfOpen || b.failures >= b.FailureThreshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// State returns the breaker's current state
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+// currentState moves an open breaker to half-open once OpenTimeout has passed
+func (b *CircuitBreaker) currentState() CircuitState {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.OpenTimeout {
+		b.state = CircuitHalfOpen
+	}
+	return b.state
+}
+
+// circuitBreakerOf returns the breaker installed on db, if any
+func circuitBreakerOf(db *gorm.DB) *CircuitBreaker {
+	if db == nil || db.Config == nil {
+		return nil
+	}
+	breaker, _ := db.Config.Plugins[circuitBreakerName].(*CircuitBreaker)
+	return breaker
+}
+
+// IsConnectionError reports whether err means the database could not be reached,
+// rather than that a query failed. A caller's deadline expiring is a timeout,
+// not a connection error; see IsTimeout.
+func IsConnectionError(err error) bool {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case IsTimeout(err):
+		// context.DeadlineExceeded is itself a net.Error, so this comes first
+		return false
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "database is closed") || strings.Contains(message, "connection refused")
+}
+
+// IsTimeout reports whether err means a call ran out of time, such as a slow
+// query outliving the request's deadline. It says nothing about whether the
+// database is reachable, so timeouts do not trip the circuit breaker.
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
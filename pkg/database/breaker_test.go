@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type breakerRecord struct {
+	ID   uint
+	Name string
+}
+
+// flakyDB returns a database guarded by breaker whose queries fail with a
+// connection error while *failing is set. attempts counts queries that reached it.
+func flakyDB(t *testing.T, breaker *CircuitBreaker) (db *gorm.DB, failing *bool, attempts *int) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&breakerRecord{}))
+	require.NoError(t, db.Create(&breakerRecord{Name: "first"}).Error)
+	require.NoError(t, db.Use(breaker))
+
+	failing, attempts = new(bool), new(int)
+	err = db.Callback().Query().Before("gorm:query").Register("test:flaky", func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		*attempts++
+		if *failing {
+			tx.AddError(driver.ErrBadConn)
+		}
+	})
+	require.NoError(t, err)
+	return db, failing, attempts
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newBreaker := func() *CircuitBreaker {
+		breaker := NewCircuitBreaker(3, time.Minute)
+		breaker.now = func() time.Time { return now }
+		return breaker
+	}
+	query := func(db *gorm.DB) error {
+		var record breakerRecord
+		return db.First(&record).Error
+	}
+
+	t.Run("should open after consecutive failures and fail fast", func(t *testing.T) {
+		breaker := newBreaker()
+		db, failing, attempts := flakyDB(t, breaker)
+		*failing = true
+
+		for i := 0; i < 3; i++ {
+			assert.ErrorIs(t, query(db), driver.ErrBadConn)
+		}
+		assert.Equal(t, CircuitOpen, breaker.State())
+
+		err := query(db)
+		assert.ErrorIs(t, err, ErrUnavailable)
+		assert.Equal(t, core.ErrorCodeUnavailable, core.CodeOf(err))
+		assert.Equal(t, 3, *attempts)
+
+		status := CheckConnection(ctx, db)
+		assert.False(t, status.Healthy)
+		assert.Equal(t, "open", status.Details["circuit"])
+	})
+
+	t.Run("should close again once a probe succeeds", func(t *testing.T) {
+		breaker := newBreaker()
+		db, failing, attempts := flakyDB(t, breaker)
+		*failing = true
+		for i := 0; i < 3; i++ {
+			query(db)
+		}
+		require.Equal(t, CircuitOpen, breaker.State())
+
+		*failing = false
+		now = now.Add(time.Minute)
+		assert.Equal(t, CircuitHalfOpen, breaker.State())
+		require.NoError(t, query(db))
+		assert.Equal(t, CircuitClosed, breaker.State())
+		assert.Equal(t, 4, *attempts)
+
+		status := CheckConnection(ctx, db)
+		assert.True(t, status.Healthy)
+		assert.Equal(t, "closed", status.Details["circuit"])
+	})
+
+	t.Run("should reopen when the probe fails", func(t *testing.T) {
+		breaker := newBreaker()
+		db, failing, attempts := flakyDB(t, breaker)
+		*failing = true
+		for i := 0; i < 3; i++ {
+			query(db)
+		}
+
+		now = now.Add(time.Minute)
+		assert.ErrorIs(t, query(db), driver.ErrBadConn)
+		assert.Equal(t, CircuitOpen, breaker.State())
+		assert.ErrorIs(t, query(db), ErrUnavailable)
+		assert.Equal(t, 4, *attempts)
+	})
+
+	t.Run("should allow a single probe at a time while half-open", func(t *testing.T) {
+		breaker := newBreaker()
+		for i := 0; i < 3; i++ {
+			breaker.Record(driver.ErrBadConn)
+		}
+		now = now.Add(time.Minute)
+
+		assert.NoError(t, breaker.Allow())
+		assert.ErrorIs(t, breaker.Allow(), ErrUnavailable)
+		breaker.Record(nil)
+		assert.NoError(t, breaker.Allow())
+	})
+
+	t.Run("should not count query errors as failures", func(t *testing.T) {
+		breaker := newBreaker()
+		db, _, _ := flakyDB(t, breaker)
+
+		for i := 0; i < 5; i++ {
+			var record breakerRecord
+			err := db.Where("name = ?", "missing").First(&record).Error
+			assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		}
+		assert.Equal(t, CircuitClosed, breaker.State())
+	})
+	t.Run("should not count timeouts as failures", func(t *testing.T) {
+		breaker := newBreaker()
+		for i := 0; i < 5; i++ {
+			require.NoError(t, breaker.Allow())
+			breaker.Record(fmt.Errorf("query: %w", context.DeadlineExceeded))
+		}
+		assert.Equal(t, CircuitClosed, breaker.State())
+	})
+}
+
+func TestErrorClassification(t *testing.T) {
+	timeout := fmt.Errorf("failed to list tasks: %w", context.DeadlineExceeded)
+	assert.True(t, IsTimeout(timeout))
+	assert.False(t, IsConnectionError(timeout))
+
+	refused := fmt.Errorf("failed to list tasks: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	assert.True(t, IsConnectionError(refused))
+	assert.False(t, IsTimeout(refused))
+
+	assert.False(t, IsConnectionError(nil))
+	assert.False(t, IsTimeout(gorm.ErrRecordNotFound))
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ataiva-software/vertex/pkg/core"
@@ -52,6 +53,46 @@ func (c *Config) DSN() string {
 		c.Host, c.Username, c.Password, c.Database, c.Port, sslMode)
 }
 
+// redactedPassword replaces the password wherever connection info is shown
+const redactedPassword = "***"
+
+// RedactedDSN returns the DSN with the password masked, for logs and error messages
+func (c *Config) RedactedDSN() string {
+	redacted := *c
+	if redacted.Password != "" {
+		redacted.Password = redactedPassword
+	}
+	return redacted.DSN()
+}
+
+// String returns the redacted DSN so printing a Config never shows the password
+func (c *Config) String() string {
+	return c.RedactedDSN()
+}
+
+// redactError masks the password in err's message. The driver's errors can
+// echo connection parameters, so errors from connecting pass through here.
+func (c *Config) redactError(err error) error {
+	if err == nil || c.Password == "" || !strings.Contains(err.Error(), c.Password) {
+		return err
+	}
+	return &redactedError{err: err, message: strings.ReplaceAll(err.Error(), c.Password, redactedPassword)}
+}
+
+// redactedError is an error whose message has had the password masked
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
 // ConnectionPool manages database connections
 type ConnectionPool struct {
 	Config          *Config
@@ -59,6 +100,11 @@ type ConnectionPool struct {
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
+	// ConnectRetry controls how Connect retries while the database is unreachable,
+	// e.g. when the service starts before the database is up
+	ConnectRetry core.RetryPolicy
+	// CircuitBreaker, when set, is installed on the connection by Connect
+	CircuitBreaker *CircuitBreaker
 }
 
 // NewConnectionPool creates a new connection pool
@@ -68,6 +114,14 @@ func NewConnectionPool(config *Config) *ConnectionPool {
 		MaxOpenConns:    10,
 		MaxIdleConns:    5,
 		ConnMaxLifetime: 5 * time.Minute,
+		ConnectRetry: core.RetryPolicy{
+			MaxAttempts: 5,
+			BaseDelay:   time.Second,
+			Multiplier:  2,
+			MaxDelay:    10 * time.Second,
+			Jitter:      0.2,
+		},
+		CircuitBreaker: NewCircuitBreaker(5, 30*time.Second),
 	}
 }
 
@@ -77,11 +131,16 @@ func (p *ConnectionPool) Connect() error {
 		return fmt.Errorf("invalid config: %w", err)
 	}
 
-	db, err := gorm.Open(postgres.Open(p.Config.DSN()), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+	var db *gorm.DB
+	err := core.Retry(context.Background(), p.ConnectRetry, func(attempt int) error {
+		var err error
+		db, err = gorm.Open(postgres.Open(p.Config.DSN()), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Info),
+		})
+		return p.Config.redactError(err)
 	})
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return fmt.Errorf("failed to connect to database (%s): %w", p.Config.RedactedDSN(), err)
 	}
 
 	sqlDB, err := db.DB()
@@ -89,6 +148,12 @@ func (p *ConnectionPool) Connect() error {
 		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
 	}
 
+	if p.CircuitBreaker != nil {
+		if err := db.Use(p.CircuitBreaker); err != nil {
+			return fmt.Errorf("failed to install circuit breaker: %w", err)
+		}
+	}
+
 	// Configure connection pool
 	sqlDB.SetMaxOpenConns(p.MaxOpenConns)
 	sqlDB.SetMaxIdleConns(p.MaxIdleConns)
@@ -136,13 +201,31 @@ func (h *HealthCheck) Check(ctx context.Context) *core.HealthStatus {
 	checkCtx, cancel := context.WithTimeout(ctx, h.Timeout)
 	defer cancel()
 
-	sqlDB, err := h.Pool.DB.DB()
+	return CheckConnection(checkCtx, h.Pool.DB)
+}
+
+// CheckConnection pings the database behind db and reports its connection stats.
+// While a circuit breaker on db is open the database is reported unhealthy
+// without being pinged.
+func CheckConnection(ctx context.Context, db *gorm.DB) *core.HealthStatus {
+	if db == nil {
+		return core.NewHealthStatus(false, "Database not connected")
+	}
+
+	breaker := circuitBreakerOf(db)
+	if breaker != nil && breaker.State() == CircuitOpen {
+		return core.NewHealthStatusWithDetails(false, "Database circuit breaker is open", map[string]interface{}{
+			"circuit": CircuitOpen.String(),
+		})
+	}
+
+	sqlDB, err := db.DB()
 	if err != nil {
 		return core.NewHealthStatus(false, fmt.Sprintf("Failed to get database instance: %v", err))
 	}
 
 	// Ping the database
-	if err := sqlDB.PingContext(checkCtx); err != nil {
+	if err := sqlDB.PingContext(ctx); err != nil {
 		return core.NewHealthStatus(false, fmt.Sprintf("Database ping failed: %v", err))
 	}
 
@@ -157,6 +240,9 @@ func (h *HealthCheck) Check(ctx context.Context) *core.HealthStatus {
 		"max_idle_closed":     stats.MaxIdleClosed,
 		"max_lifetime_closed": stats.MaxLifetimeClosed,
 	}
+	if breaker != nil {
+		details["circuit"] = breaker.State().String()
+	}
 
 	return core.NewHealthStatusWithDetails(true, "Database is healthy", details)
 }
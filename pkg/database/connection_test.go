@@ -1,9 +1,12 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/ataiva-software/vertex/pkg/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -77,6 +80,31 @@ func TestDatabaseConfig(t *testing.T) {
 		dsn := config.DSN()
 		assert.Contains(t, dsn, "sslmode=require")
 	})
+
+	t.Run("should mask the password in the redacted DSN", func(t *testing.T) {
+		config := &Config{
+			Host:     "localhost",
+			Port:     5432,
+			Database: "vertex_test",
+			Username: "vertex",
+			Password: "s3cr3t-pw",
+			SSLMode:  "disable",
+		}
+
+		expected := "host=localhost user=vertex password=*** dbname=vertex_test port=5432 sslmode=disable"
+		assert.Equal(t, expected, config.RedactedDSN())
+		assert.Equal(t, expected, fmt.Sprintf("%v", config))
+		assert.Contains(t, config.DSN(), "s3cr3t-pw")
+	})
+
+	t.Run("should mask the password in driver errors", func(t *testing.T) {
+		config := &Config{Password: "s3cr3t-pw"}
+		cause := errors.New("cannot parse `password=s3cr3t-pw`")
+
+		err := config.redactError(cause)
+		assert.Equal(t, "cannot parse `password=***`", err.Error())
+		assert.ErrorIs(t, err, cause)
+	})
 }
 
 func TestConnectionPool(t *testing.T) {
@@ -117,6 +145,24 @@ func TestConnectionPool(t *testing.T) {
 		assert.Equal(t, 10, pool.MaxIdleConns)
 		assert.Equal(t, 10*time.Minute, pool.ConnMaxLifetime)
 	})
+
+	t.Run("should not leak the password when connecting fails", func(t *testing.T) {
+		config := &Config{
+			Host:     "127.0.0.1",
+			Port:     1,
+			Database: "vertex_test",
+			Username: "vertex",
+			Password: "s3cr3t-pw",
+			SSLMode:  "disable",
+		}
+
+		pool := NewConnectionPool(config)
+		pool.ConnectRetry = core.RetryPolicy{MaxAttempts: 1}
+		err := pool.Connect()
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "s3cr3t-pw")
+		assert.Contains(t, err.Error(), "password=***")
+	})
 }
 
 func TestHealthCheck(t *testing.T) {
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+)
+
+// Status is an integer status column with a name for each value
+type Status interface {
+	~int
+	String() string
+}
+
+// CountRows counts the rows matched by query, which must have a model set,
+// without loading them
+func CountRows(query *gorm.DB, resourceType string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	filter := core.MergeCountFilters(filters...)
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at > ?", filter.CreatedAfter)
+	}
+
+	count := &core.ResourceCount{ResourceType: resourceType}
+	if err := query.Count(&count.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count %ss: %w", resourceType, err)
+	}
+	return count, nil
+}
+
+// CountByStatus counts the rows matched by query like CountRows and, when the
+// filter asks for it, breaks the total down by the status column using GROUP BY
+func CountByStatus[S Status](query *gorm.DB, resourceType string, filters ...core.CountFilter) (*core.ResourceCount, error) {
+	filter := core.MergeCountFilters(filters...)
+	if !filter.GroupByStatus {
+		return CountRows(query, resourceType, filter)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at > ?", filter.CreatedAfter)
+	}
+
+	var groups []struct {
+		Status S
+		Count  int64
+	}
+	if err := query.Select("status, COUNT(*) AS count").Group("status").Scan(&groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to count %ss: %w", resourceType, err)
+	}
+
+	count := &core.ResourceCount{ResourceType: resourceType, ByStatus: make(map[string]int64, len(groups))}
+	for _, group := range groups {
+		count.Total += group.Count
+		count.ByStatus[group.Status.String()] += group.Count
+	}
+	return count, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type countStatus int
+
+func (s countStatus) String() string {
+	return []string{"open", "closed"}[s]
+}
+
+type countRecord struct {
+	ID        uint
+	Owner     string
+	Status    countStatus
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+func TestCountByStatus(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&countRecord{}))
+
+	old := time.Now().Add(-48 * time.Hour)
+	deleted := &countRecord{Owner: "user1", Status: 1}
+	require.NoError(t, db.Create([]*countRecord{
+		{Owner: "user1", CreatedAt: old},
+		{Owner: "user1", Status: 1},
+		{Owner: "user1", Status: 1, CreatedAt: old},
+		{Owner: "user2"},
+		deleted,
+	}).Error)
+	require.NoError(t, db.Delete(deleted).Error)
+	owned := func() *gorm.DB { return db.Model(&countRecord{}).Where("owner = ?", "user1") }
+
+	t.Run("should count matching rows without a breakdown by default", func(t *testing.T) {
+		count, err := CountByStatus[countStatus](owned(), "record")
+		require.NoError(t, err)
+		assert.Equal(t, "record", count.ResourceType)
+		assert.Equal(t, int64(3), count.Total, "other owners and soft-deleted rows are not counted")
+		assert.Nil(t, count.ByStatus)
+	})
+
+	t.Run("should break the count down by status name", func(t *testing.T) {
+		count, err := CountByStatus[countStatus](owned(), "record", core.CountFilter{GroupByStatus: true})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), count.Total)
+		assert.Equal(t, map[string]int64{"open": 1, "closed": 2}, count.ByStatus)
+	})
+
+	t.Run("should only count rows created after the filter's time", func(t *testing.T) {
+		since := core.CountFilter{CreatedAfter: time.Now().Add(-time.Hour)}
+		count, err := CountRows(owned(), "record", since)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count.Total)
+
+		count, err = CountByStatus[countStatus](owned(), "record", since, core.CountFilter{GroupByStatus: true})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{"closed": 1}, count.ByStatus)
+	})
+
+	t.Run("should name the resource type in errors", func(t *testing.T) {
+		_, err := CountRows(db.Table("missing"), "record")
+		assert.ErrorContains(t, err, "failed to count records")
+	})
+}
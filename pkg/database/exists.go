@@ -0,0 +1,16 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// Exists reports whether query, which must have a model set, matches any row,
+// selecting a constant with LIMIT 1 rather than loading the row. Soft-deleted
+// rows are excluded as for any other query on the model.
+func Exists(query *gorm.DB) (bool, error) {
+	var found []int
+	if err := query.Select("1").Limit(1).Find(&found).Error; err != nil {
+		return false, err
+	}
+	return len(found) > 0, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type existsRecord struct {
+	ID        uint
+	Owner     string
+	DeletedAt gorm.DeletedAt
+}
+
+func TestExists(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&existsRecord{}))
+
+	kept := &existsRecord{Owner: "user1"}
+	deleted := &existsRecord{Owner: "user1"}
+	require.NoError(t, db.Create(kept).Error)
+	require.NoError(t, db.Create(deleted).Error)
+	require.NoError(t, db.Delete(deleted).Error)
+
+	exists := func(id uint, owner string) bool {
+		found, err := Exists(db.Model(&existsRecord{}).Where("id = ? AND owner = ?", id, owner))
+		require.NoError(t, err)
+		return found
+	}
+	assert.True(t, exists(kept.ID, "user1"))
+	assert.False(t, exists(kept.ID, "user2"))
+	assert.False(t, exists(deleted.ID, "user1"), "soft-deleted rows should not exist")
+	assert.False(t, exists(999, "user1"))
+
+	found, err := Exists(db.Unscoped().Model(&existsRecord{}).Where("id = ?", deleted.ID))
+	require.NoError(t, err)
+	assert.True(t, found)
+}
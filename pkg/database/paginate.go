@@ -0,0 +1,34 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"gorm.io/gorm"
+)
+
+// Paginate reads the page of rows matched by query that request asks for,
+// using LIMIT and OFFSET so only that page is loaded, and counts every match
+// for the page's total. query must have a model and an order that is stable
+// across requests, such as one ending in the primary key.
+func Paginate[T any](query *gorm.DB, request core.PageRequest) (*core.Page[T], error) {
+	page := &core.Page[T]{Items: []T{}, Page: request.Page, PageSize: request.PageSize}
+
+	// A new session lets the query be both counted and paged
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count rows: %w", err)
+	}
+	page.Total = int(total)
+
+	// A huge page number overflows the offset, which is past the end either way
+	offset := request.Offset()
+	if offset < 0 || offset >= page.Total {
+		return page, nil
+	}
+	if err := query.Offset(offset).Limit(request.PageSize).Find(&page.Items).Error; err != nil {
+		return nil, fmt.Errorf("failed to read page: %w", err)
+	}
+	return page, nil
+}
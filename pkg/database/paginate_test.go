@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ataiva-software/vertex/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type pageRecord struct {
+	ID    uint
+	Owner string
+}
+
+func TestPaginate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&pageRecord{}))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Create(&pageRecord{Owner: "user1"}).Error)
+	}
+	require.NoError(t, db.Create(&pageRecord{Owner: "user2"}).Error)
+
+	paginate := func(page, size int) *core.Page[*pageRecord] {
+		result, err := Paginate[*pageRecord](db.Model(&pageRecord{}).Where("owner = ?", "user1").Order("id DESC"), core.PageRequest{Page: page, PageSize: size})
+		require.NoError(t, err)
+		return result
+	}
+
+	t.Run("should read one page of the matching rows in order", func(t *testing.T) {
+		page := paginate(2, 2)
+		assert.Equal(t, 5, page.Total)
+		assert.Equal(t, 2, page.Page)
+		assert.Equal(t, 2, page.PageSize)
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, uint(3), page.Items[0].ID)
+		assert.Equal(t, uint(2), page.Items[1].ID)
+
+		assert.Len(t, paginate(3, 2).Items, 1)
+	})
+
+	t.Run("should return an empty page past the end", func(t *testing.T) {
+		page := paginate(4, 2)
+		assert.Equal(t, 5, page.Total)
+		assert.NotNil(t, page.Items)
+		assert.Empty(t, page.Items)
+
+		page = paginate(int(^uint(0)>>1), 2)
+		assert.Empty(t, page.Items, "an overflowing offset is past the end")
+	})
+}
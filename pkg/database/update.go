@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UpdateChanged applies updates, keyed by column name, to model, a loaded
+// record, writing only the columns whose new values differ from the record's.
+// When any do, updated_at is set with them, if the model has it, and the
+// record is updated in memory to match. Nothing is written when nothing
+// changed. It reports whether the row was changed; conditions already on db,
+// such as the status the caller read, make a write that no longer matches
+// report false.
+func UpdateChanged(db *gorm.DB, model interface{}, updates map[string]interface{}) (bool, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return false, fmt.Errorf("failed to parse model: %w", err)
+	}
+	ctx := context.Background()
+	record := reflect.ValueOf(model)
+
+	changed := make(map[string]interface{}, len(updates)+1)
+	for column, value := range updates {
+		field := stmt.Schema.LookUpField(column)
+		if field == nil {
+			return false, fmt.Errorf("unknown column '%s'", column)
+		}
+		current, _ := field.ValueOf(ctx, record)
+		if !equalValues(current, value) {
+			changed[field.DBName] = value
+		}
+	}
+	if len(changed) == 0 {
+		return false, nil
+	}
+	if field := stmt.Schema.LookUpField("updated_at"); field != nil {
+		if _, ok := changed[field.DBName]; !ok {
+			changed[field.DBName] = time.Now()
+		}
+	}
+
+	result := db.Model(model).Updates(changed)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	for column, value := range changed {
+		if err := stmt.Schema.LookUpField(column).Set(ctx, record, value); err != nil {
+			return true, fmt.Errorf("failed to set %s: %w", column, err)
+		}
+	}
+	return true, nil
+}
+
+// equalValues reports whether a column's current value equals a new one,
+// comparing through pointers and comparing times by instant
+func equalValues(current, value interface{}) bool {
+	a, b := reflect.ValueOf(current), reflect.ValueOf(value)
+	for a.Kind() == reflect.Pointer && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Pointer && !b.IsNil() {
+		b = b.Elem()
+	}
+	if !a.IsValid() || !b.IsValid() || a.Kind() == reflect.Pointer || b.Kind() == reflect.Pointer {
+		// At least one is nil; they are equal only if both are
+		return isNil(a) && isNil(b)
+	}
+	if at, ok := a.Interface().(time.Time); ok {
+		bt, ok := b.Interface().(time.Time)
+		return ok && at.Equal(bt)
+	}
+	// A value of the column's underlying type, such as an int for a status, compares as the column's type
+	if b.Type() != a.Type() && b.Type().ConvertibleTo(a.Type()) && b.Kind() == a.Kind() {
+		b = b.Convert(a.Type())
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// isNil reports whether v is absent or a nil pointer
+func isNil(v reflect.Value) bool {
+	return !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil())
+}
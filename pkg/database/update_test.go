@@ -0,0 +1,83 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type updateStatus int
+
+type updateRecord struct {
+	ID        uint
+	Status    updateStatus
+	Note      string
+	DoneAt    *time.Time
+	UpdatedAt time.Time
+}
+
+func TestUpdateChanged(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&updateRecord{}))
+
+	done := time.Now().Add(-time.Hour).Round(time.Second)
+	record := &updateRecord{Status: 1, Note: "first", DoneAt: &done}
+	require.NoError(t, db.Create(record).Error)
+	stamp := time.Now().Add(-time.Minute).Round(time.Second)
+	require.NoError(t, db.Model(record).UpdateColumn("updated_at", stamp).Error)
+	require.NoError(t, db.First(record, record.ID).Error)
+
+	stored := func() *updateRecord {
+		var found updateRecord
+		require.NoError(t, db.First(&found, record.ID).Error)
+		return &found
+	}
+
+	t.Run("should not write an update that changes nothing", func(t *testing.T) {
+		same := done.In(time.UTC)
+		changed, err := UpdateChanged(db, record, map[string]interface{}{"status": 1, "note": "first", "done_at": &same})
+		require.NoError(t, err)
+		assert.False(t, changed)
+		assert.True(t, stamp.Equal(stored().UpdatedAt), "a no-op update must not bump updated_at")
+	})
+
+	t.Run("should write changed columns and bump updated_at", func(t *testing.T) {
+		changed, err := UpdateChanged(db, record, map[string]interface{}{"status": updateStatus(2), "note": "first"})
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		found := stored()
+		assert.Equal(t, updateStatus(2), found.Status)
+		assert.True(t, found.UpdatedAt.After(stamp))
+		assert.Equal(t, updateStatus(2), record.Status, "the record must match the row")
+		assert.True(t, found.UpdatedAt.Equal(record.UpdatedAt))
+	})
+
+	t.Run("should report no change when the conditions no longer match", func(t *testing.T) {
+		changed, err := UpdateChanged(db.Where("status = ?", 1), record, map[string]interface{}{"status": 3})
+		require.NoError(t, err)
+		assert.False(t, changed)
+		assert.Equal(t, updateStatus(2), stored().Status)
+	})
+
+	t.Run("should clear and set nullable columns", func(t *testing.T) {
+		changed, err := UpdateChanged(db, record, map[string]interface{}{"done_at": nil})
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.Nil(t, stored().DoneAt)
+
+		changed, err = UpdateChanged(db, record, map[string]interface{}{"done_at": nil})
+		require.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("should reject unknown columns", func(t *testing.T) {
+		_, err := UpdateChanged(db, record, map[string]interface{}{"missing": 1})
+		assert.ErrorContains(t, err, "unknown column 'missing'")
+	})
+}
@@ -0,0 +1,214 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config configures a client for an S3-compatible bucket
+type Config struct {
+	Endpoint        string `json:"endpoint" yaml:"endpoint"` // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region          string `json:"region" yaml:"region"`
+	Bucket          string `json:"bucket" yaml:"bucket"`
+	AccessKeyID     string `json:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey string `json:"-" yaml:"secret_access_key"`
+}
+
+// Client sends path-style requests to one bucket, signed with AWS Signature Version 4
+type Client struct {
+	config Config
+	http   *http.Client
+	// Now returns the signing time; tests replace it for deterministic signatures
+	Now func() time.Time
+}
+
+// ResponseError is a non-2xx response from S3
+type ResponseError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("S3 request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if sent again
+func (e *ResponseError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// NewClient validates the config and creates a client
+func NewClient(config Config) (*Client, error) {
+	if strings.TrimSpace(config.Endpoint) == "" {
+		return nil, errors.New("S3 endpoint is required")
+	}
+	if strings.TrimSpace(config.Bucket) == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("S3 credentials are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+
+	return &Client{
+		config: config,
+		http:   &http.Client{Timeout: 5 * time.Minute},
+		Now:    time.Now,
+	}, nil
+}
+
+// Do sends a signed request for an object key (or the bucket when key is empty)
+func (c *Client) Do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	return c.DoWithHeader(ctx, method, key, query, nil, body)
+}
+
+// DoWithHeader is Do with extra request headers, such as Content-MD5, which
+// are signed along with the rest of the request
+func (c *Client) DoWithHeader(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(c.config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	canonicalURI := "/" + Escape(c.config.Bucket, false)
+	if key != "" {
+		canonicalURI += "/" + Escape(key, true)
+	}
+	endpoint.RawPath = canonicalURI
+	endpoint.Path, _ = url.PathUnescape(canonicalURI)
+	endpoint.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	c.sign(req, canonicalURI, header, body)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request, signing the extra
+// headers too
+func (c *Client) sign(req *http.Request, canonicalURI string, extra http.Header, body []byte) {
+	now := c.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	for name := range extra {
+		headers[strings.ToLower(name)] = strings.TrimSpace(extra.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, c.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by key as SigV4 requires
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, Escape(key, false)+"="+Escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Escape percent-encodes everything except unreserved characters (and '/' when keepSlash)
+func Escape(value string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// Error builds a *ResponseError from a failed S3 response
+func Error(resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &ResponseError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 computes HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}